@@ -0,0 +1,224 @@
+// Package cast converts the values of the templates to numbers and strings,
+// failing with explicit errors instead of producing wrong values: the
+// overflows, the negative unsigned numbers, the NaNs and the malformed
+// strings are errors.
+//
+// It implements the to_i, to_u, to_f and to_s builtins of the templates.
+package cast
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Error is the error of a conversion.
+type Error struct {
+	// Value is the converted value.
+	Value interface{}
+	// To is the name of the type of the conversion, as "int64".
+	To string
+	// Err is the cause of the error, if any.
+	Err error
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("cast: can't convert %T %v to %s", e.Value, e.Value, e.To)
+	if e.Value == nil {
+		msg = "cast: can't convert nil to " + e.To
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// indirect returns the value pointed by v, through any pointers and
+// interfaces, and whether it is valid.
+func indirect(v interface{}) (reflect.Value, bool) {
+	rv, ok := v.(reflect.Value)
+	if !ok {
+		rv = reflect.ValueOf(v)
+	}
+	for rv.IsValid() && (rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface) {
+		if rv.IsNil() {
+			return rv, false
+		}
+		rv = rv.Elem()
+	}
+	return rv, rv.IsValid()
+}
+
+// base returns the base of the options, 10 by default. The base 0 parses
+// the prefixes of the integer literals of Go, as "0x".
+func base(opts []int) int {
+	if len(opts) > 0 {
+		return opts[0]
+	}
+	return 10
+}
+
+// ToInt converts v to an int64. The strings are parsed in the base of the
+// options, 10 by default, the floats are truncated and the bools are 1 or
+// 0.
+func ToInt(v interface{}, opts ...int) (i int64, err error) {
+	rv, ok := indirect(v)
+	if !ok {
+		return 0, &Error{v, "int64", nil}
+	}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := rv.Uint(); u <= math.MaxInt64 {
+			return int64(u), nil
+		}
+		err = strconv.ErrRange
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if f >= -(1<<63) && f < 1<<63 {
+			return int64(f), nil
+		}
+		err = strconv.ErrRange
+	case reflect.Bool:
+		if rv.Bool() {
+			return 1, nil
+		}
+		return 0, nil
+	case reflect.String:
+		if i, err = strconv.ParseInt(strings.TrimSpace(rv.String()), base(opts), 64); err == nil {
+			return
+		}
+		err = err.(*strconv.NumError).Err
+	}
+	return 0, &Error{rv.Interface(), "int64", err}
+}
+
+// ToUint converts v to an uint64, like ToInt. The negative numbers are
+// errors.
+func ToUint(v interface{}, opts ...int) (u uint64, err error) {
+	rv, ok := indirect(v)
+	if !ok {
+		return 0, &Error{v, "uint64", nil}
+	}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if i := rv.Int(); i >= 0 {
+			return uint64(i), nil
+		}
+		err = strconv.ErrRange
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return rv.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if f >= 0 && f < 1<<64 {
+			return uint64(f), nil
+		}
+		err = strconv.ErrRange
+	case reflect.Bool:
+		if rv.Bool() {
+			return 1, nil
+		}
+		return 0, nil
+	case reflect.String:
+		if u, err = strconv.ParseUint(strings.TrimSpace(rv.String()), base(opts), 64); err == nil {
+			return
+		}
+		err = err.(*strconv.NumError).Err
+	}
+	return 0, &Error{rv.Interface(), "uint64", err}
+}
+
+// ToFloat converts v to a float64. The NaNs are errors.
+func ToFloat(v interface{}) (f float64, err error) {
+	rv, ok := indirect(v)
+	if !ok {
+		return 0, &Error{v, "float64", nil}
+	}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		if f = rv.Float(); !math.IsNaN(f) {
+			return
+		}
+		err = fmt.Errorf("not a number")
+	case reflect.Bool:
+		if rv.Bool() {
+			return 1, nil
+		}
+		return 0, nil
+	case reflect.String:
+		if f, err = strconv.ParseFloat(strings.TrimSpace(rv.String()), 64); err == nil {
+			if !math.IsNaN(f) {
+				return
+			}
+			err = fmt.Errorf("not a number")
+		} else {
+			err = err.(*strconv.NumError).Err
+		}
+	}
+	return 0, &Error{rv.Interface(), "float64", err}
+}
+
+// ToString converts v to a string. The option of the integers is the base,
+// 10 by default, and the option of the floats is the number of decimals,
+// as many as needed by default. The values of other kinds than numbers,
+// strings, byte slices and bools must be fmt.Stringers or errors.
+func ToString(v interface{}, opts ...int) (string, error) {
+	if rv, ok := v.(reflect.Value); ok {
+		if !rv.IsValid() || !rv.CanInterface() {
+			return "", &Error{nil, "string", nil}
+		}
+		v = rv.Interface()
+	}
+	switch t := v.(type) {
+	case fmt.Stringer:
+		return t.String(), nil
+	case error:
+		return t.Error(), nil
+	}
+	rv, ok := indirect(v)
+	if !ok {
+		return "", &Error{v, "string", nil}
+	}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if b := base(opts); b < 2 || b > 36 {
+			return "", &Error{rv.Interface(), "string", fmt.Errorf("invalid base %d", b)}
+		}
+		return strconv.FormatInt(rv.Int(), base(opts)), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if b := base(opts); b < 2 || b > 36 {
+			return "", &Error{rv.Interface(), "string", fmt.Errorf("invalid base %d", b)}
+		}
+		return strconv.FormatUint(rv.Uint(), base(opts)), nil
+	case reflect.Float32, reflect.Float64:
+		prec := -1
+		if len(opts) > 0 {
+			prec = opts[0]
+		}
+		bits := 64
+		if rv.Kind() == reflect.Float32 {
+			bits = 32
+		}
+		return strconv.FormatFloat(rv.Float(), 'f', prec, bits), nil
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), nil
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return string(rv.Bytes()), nil
+		}
+	}
+	return "", &Error{rv.Interface(), "string", nil}
+}
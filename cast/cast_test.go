@@ -0,0 +1,114 @@
+package cast
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+type stringer struct{}
+
+func (stringer) String() string { return "stringer" }
+
+func TestToInt(t *testing.T) {
+	seven := 7
+	for _, test := range []struct {
+		v    interface{}
+		opts []int
+		want int64
+		err  string
+	}{
+		{int8(-3), nil, -3, ""},
+		{uint32(42), nil, 42, ""},
+		{&seven, nil, 7, ""},
+		{reflect.ValueOf(int16(5)), nil, 5, ""},
+		{3.9, nil, 3, ""},
+		{true, nil, 1, ""},
+		{" 12 ", nil, 12, ""},
+		{"ff", []int{16}, 255, ""},
+		{"0x10", []int{0}, 16, ""},
+		{uint64(math.MaxUint64), nil, 0, "cast: can't convert uint64 18446744073709551615 to int64: value out of range"},
+		{1e19, nil, 0, "cast: can't convert float64 1e+19 to int64: value out of range"},
+		{"abc", nil, 0, `cast: can't convert string abc to int64: invalid syntax`},
+		{nil, nil, 0, "cast: can't convert nil to int64"},
+		{[]int{1}, nil, 0, "cast: can't convert []int [1] to int64"},
+	} {
+		got, err := ToInt(test.v, test.opts...)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("ToInt(%v): got error %v, want %q", test.v, err, test.err)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("ToInt(%v) = %d, %v; want %d", test.v, got, err, test.want)
+		}
+	}
+	if _, err := ToInt("99999999999999999999"); !errors.Is(err, strconv.ErrRange) {
+		t.Errorf("got %v, want a range error", err)
+	}
+}
+
+func TestToUint(t *testing.T) {
+	if got, err := ToUint(int64(9)); err != nil || got != 9 {
+		t.Errorf("ToUint(9) = %d, %v", got, err)
+	}
+	if got, err := ToUint("777", 8); err != nil || got != 511 {
+		t.Errorf(`ToUint("777", 8) = %d, %v`, got, err)
+	}
+	for _, v := range []interface{}{-1, -0.5, "-1", math.Inf(1)} {
+		if _, err := ToUint(v); err == nil {
+			t.Errorf("ToUint(%v): expected error; got none", v)
+		}
+	}
+}
+
+func TestToFloat(t *testing.T) {
+	for v, want := range map[interface{}]float64{
+		int(-2): -2, uint8(3): 3, float32(0.5): 0.5, "1e3": 1000, false: 0,
+	} {
+		if got, err := ToFloat(v); err != nil || got != want {
+			t.Errorf("ToFloat(%v) = %v, %v; want %v", v, got, err, want)
+		}
+	}
+	for _, v := range []interface{}{math.NaN(), "NaN", "x", struct{}{}} {
+		if _, err := ToFloat(v); err == nil {
+			t.Errorf("ToFloat(%v): expected error; got none", v)
+		}
+	}
+}
+
+func TestToString(t *testing.T) {
+	for _, test := range []struct {
+		v    interface{}
+		opts []int
+		want string
+	}{
+		{255, nil, "255"},
+		{255, []int{16}, "ff"},
+		{uint(5), []int{2}, "101"},
+		{2.5, nil, "2.5"},
+		{float32(0.1), nil, "0.1"},
+		{1.005, []int{2}, "1.00"},
+		{true, nil, "true"},
+		{[]byte("b"), nil, "b"},
+		{stringer{}, nil, "stringer"},
+		{errors.New("e"), nil, "e"},
+	} {
+		if got, err := ToString(test.v, test.opts...); err != nil || got != test.want {
+			t.Errorf("ToString(%v, %v) = %q, %v; want %q", test.v, test.opts, got, err, test.want)
+		}
+	}
+	for _, test := range []struct {
+		v    interface{}
+		opts []int
+	}{
+		{nil, nil}, {10, []int{1}}, {[]int{1}, nil}, {reflect.Value{}, nil},
+	} {
+		if _, err := ToString(test.v, test.opts...); err == nil {
+			t.Errorf("ToString(%v, %v): expected error; got none", test.v, test.opts)
+		}
+	}
+}
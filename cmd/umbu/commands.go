@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	htmltemplate "github.com/moisespsena-go/umbu/html/template"
+	"github.com/moisespsena-go/umbu/text/template"
+	"github.com/moisespsena-go/umbu/text/template/parse"
+)
+
+// errUsage reports an invalid usage, already printed.
+var errUsage = errors.New("usage")
+
+// commands are the commands of umbu, by name.
+var commands = map[string]func(args []string, stdin io.Reader, stdout, stderr io.Writer) error{
+	"exec": execCmd,
+	"lint": lintCmd,
+	"fmt":  fmtCmd,
+	"deps": depsCmd,
+}
+
+// run runs the command of the arguments, returning the exit status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 || commands[args[0]] == nil {
+		fmt.Fprintln(stderr, "usage: umbu exec|lint|fmt|deps [flags] files...")
+		return 2
+	}
+	switch err := commands[args[0]](args[1:], stdin, stdout, stderr); {
+	case err == nil:
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	default:
+		fmt.Fprintln(stderr, "umbu:", err)
+		return 1
+	}
+}
+
+// flags returns the flag set of the command, with the -delims flag.
+func flags(name string, stderr io.Writer, delims *string) *flag.FlagSet {
+	fs := flag.NewFlagSet("umbu "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(delims, "delims", "", `left and right delimiters of the actions, separated by a space, as "[[ ]]"`)
+	return fs
+}
+
+// parseFlags parses the flags of the command, which needs files.
+func parseFlags(fs *flag.FlagSet, args []string, delims string) (left, right string, err error) {
+	if err = fs.Parse(args); err != nil {
+		return "", "", errUsage
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintf(fs.Output(), "%s: no files\n", fs.Name())
+		return "", "", errUsage
+	}
+	if delims != "" {
+		d := strings.Fields(delims)
+		if len(d) != 2 {
+			fmt.Fprintf(fs.Output(), "%s: invalid delimiters %q\n", fs.Name(), delims)
+			return "", "", errUsage
+		}
+		left, right = d[0], d[1]
+	}
+	return
+}
+
+func execCmd(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	var (
+		delims, dataFile, name string
+		html, yaml             bool
+	)
+	fs := flags("exec", stderr, &delims)
+	fs.BoolVar(&html, "html", false, "escape the templates as HTML")
+	fs.StringVar(&dataFile, "data", "", "file of the data, instead of the standard input")
+	fs.BoolVar(&yaml, "yaml", false, "decode the data as YAML")
+	fs.StringVar(&name, "name", "", "template to execute, instead of the first file")
+	left, right, err := parseFlags(fs, args, delims)
+	if err != nil {
+		return err
+	}
+	var src []byte
+	if dataFile != "" && dataFile != "-" {
+		src, err = os.ReadFile(dataFile)
+		ext := filepath.Ext(dataFile)
+		yaml = yaml || ext == ".yaml" || ext == ".yml"
+	} else {
+		src, err = io.ReadAll(stdin)
+	}
+	if err != nil {
+		return err
+	}
+	var data interface{}
+	if len(bytes.TrimSpace(src)) > 0 {
+		if yaml {
+			data, err = decodeYAML(src)
+		} else {
+			err = json.Unmarshal(src, &data)
+		}
+		if err != nil {
+			return fmt.Errorf("data: %v", err)
+		}
+	}
+	if name == "" {
+		name = filepath.Base(fs.Arg(0))
+	}
+	if html {
+		tmpl, err := htmltemplate.New(name).Delims(left, right).ParseFiles(fs.Args()...)
+		if err != nil {
+			return err
+		}
+		return tmpl.ExecuteTemplate(stdout, name, data)
+	}
+	tmpl, err := template.New(name).Delims(left, right).ParseFiles(fs.Args()...)
+	if err != nil {
+		return err
+	}
+	return tmpl.ExecuteTemplate(stdout, name, data)
+}
+
+func lintCmd(args []string, _ io.Reader, stdout, stderr io.Writer) error {
+	var (
+		delims, requestData string
+		html                bool
+	)
+	fs := flags("lint", stderr, &delims)
+	fs.BoolVar(&html, "html", false, "escape the templates as HTML")
+	fs.StringVar(&requestData, "request-data", "", "comma separated field paths of the request data, as .Query,.Form")
+	left, right, err := parseFlags(fs, args, delims)
+	if err != nil {
+		return err
+	}
+	var problems int
+	for _, file := range fs.Args() {
+		if !html {
+			if _, err := template.New(filepath.Base(file)).Delims(left, right).ParseFiles(file); err != nil {
+				fmt.Fprintln(stdout, err)
+				problems++
+			}
+			continue
+		}
+		tmpl, err := htmltemplate.New(filepath.Base(file)).Delims(left, right).ParseFiles(file)
+		if err == nil {
+			var policy htmltemplate.EscapePolicy
+			if requestData != "" {
+				policy.RequestData = strings.Split(requestData, ",")
+			}
+			var warnings []*htmltemplate.Error
+			if warnings, err = tmpl.SetEscapePolicy(policy).Lint(); err == nil {
+				for _, w := range warnings {
+					fmt.Fprintln(stdout, w)
+					problems++
+				}
+			}
+		}
+		if err != nil {
+			fmt.Fprintln(stdout, err)
+			problems++
+		}
+	}
+	if problems > 0 {
+		return fmt.Errorf("%d problems", problems)
+	}
+	return nil
+}
+
+func fmtCmd(args []string, _ io.Reader, stdout, stderr io.Writer) error {
+	var (
+		delims      string
+		list, write bool
+	)
+	fs := flags("fmt", stderr, &delims)
+	fs.BoolVar(&list, "l", false, "list the files whose formatting differs")
+	fs.BoolVar(&write, "w", false, "write the formatted files")
+	left, right, err := parseFlags(fs, args, delims)
+	if err != nil {
+		return err
+	}
+	for _, file := range fs.Args() {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		out, err := parse.Format(string(src), left, right)
+		if err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		switch {
+		case list || write:
+			if out == string(src) {
+				continue
+			}
+			if list {
+				fmt.Fprintln(stdout, file)
+			}
+			if write {
+				if err = os.WriteFile(file, []byte(out), 0o644); err != nil {
+					return err
+				}
+			}
+		default:
+			io.WriteString(stdout, out)
+		}
+	}
+	return nil
+}
+
+func depsCmd(args []string, _ io.Reader, stdout, stderr io.Writer) error {
+	var (
+		delims string
+		dot    bool
+	)
+	fs := flags("deps", stderr, &delims)
+	fs.BoolVar(&dot, "dot", false, "print a Graphviz graph")
+	left, right, err := parseFlags(fs, args, delims)
+	if err != nil {
+		return err
+	}
+	tmpl, err := template.New(filepath.Base(fs.Arg(0))).Delims(left, right).ParseFiles(fs.Args()...)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, t := range tmpl.Templates() {
+		names = append(names, t.Name())
+	}
+	sort.Strings(names)
+	if dot {
+		fmt.Fprintln(stdout, "digraph templates {")
+	}
+	for _, name := range names {
+		calls := tmpl.Calls(name)
+		if dot {
+			fmt.Fprintf(stdout, "\t%q;\n", name)
+		}
+		for _, called := range calls {
+			if dot {
+				fmt.Fprintf(stdout, "\t%q -> %q;\n", name, called)
+			} else {
+				fmt.Fprintf(stdout, "%s -> %s\n", name, called)
+			}
+		}
+	}
+	if dot {
+		fmt.Fprintln(stdout, "}")
+	}
+	return nil
+}
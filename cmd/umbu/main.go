@@ -0,0 +1,34 @@
+// Command umbu executes, lints, formats and lists the dependencies of umbu
+// templates, for the continuous integration and the configuration
+// generation out of Go programs.
+//
+// Usage:
+//
+//	umbu exec [-html] [-data file] [-yaml] [-name template] [-delims "[[ ]]"] files...
+//	umbu lint [-html] [-request-data .Query,.Form] [-delims "[[ ]]"] files...
+//	umbu fmt [-l] [-w] [-delims "[[ ]]"] files...
+//	umbu deps [-dot] [-delims "[[ ]]"] files...
+//
+// exec executes the template of the first file, or the named one, with the
+// data read from the standard input, or from the data file, as JSON or, with
+// -yaml or a data file named *.yaml or *.yml, as YAML (a subset: block
+// mappings and sequences, scalars and JSON flow collections).
+//
+// lint parses the files and, with -html, escapes them, reporting the errors
+// and the warnings of the escape policy, as the calls of the safe functions
+// on the request data.
+//
+// fmt prints the files with their actions in canonical form, lists the
+// files whose formatting differs with -l, or rewrites them with -w.
+//
+// deps prints the invocations of the templates, as "caller -> called"
+// lines, or as a Graphviz graph with -dot.
+//
+// The exit status is 1 if an error is reported and 2 on invalid usage.
+package main
+
+import "os"
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRun(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"page.tmpl":   `{{define "item"}}<li>{{.}}</li>{{end}}<h1>{{.Title}}</h1>{{range .Items}}{{template "item" .}}{{end}}`,
+		"search.tmpl": `<p>{{.Query.q | safe_html}}</p><a href="/?q={{.Query.q}}">{{.Query.q}}</a>`,
+		"data.yaml":   "Title: <Home>\nItems:\n  - a\n  - b\n",
+		"ugly.tmpl":   "{{ $x:=.Items|len }}{{$x}}",
+	})
+	page := filepath.Join(dir, "page.tmpl")
+	for _, test := range []struct {
+		args   []string
+		stdin  string
+		status int
+		want   string
+	}{
+		{[]string{"exec", page}, `{"Title": "<Home>", "Items": ["a"]}`, 0, "<h1><Home></h1><li>a</li>"},
+		{[]string{"exec", "-html", page}, `{"Title": "<Home>", "Items": ["a"]}`, 0, "<h1>&lt;Home&gt;</h1><li>a</li>"},
+		{[]string{"exec", "-data", filepath.Join(dir, "data.yaml"), page}, "", 0, "<h1><Home></h1><li>a</li><li>b</li>"},
+		{[]string{"exec", "-yaml", "-name", "item", page}, "x", 0, "<li>x</li>"},
+		{[]string{"exec", page}, `{`, 1, ""},
+		{[]string{"exec"}, "", 2, ""},
+		{[]string{"lint", "-html", page}, "", 0, ""},
+		{[]string{"lint", "-html", "-request-data", ".Query", filepath.Join(dir, "search.tmpl")}, "", 1, "safe_html"},
+		{[]string{"fmt", filepath.Join(dir, "ugly.tmpl")}, "", 0, "{{$x := .Items | len}}{{$x}}"},
+		{[]string{"fmt", "-l", filepath.Join(dir, "ugly.tmpl"), page}, "", 0, filepath.Join(dir, "ugly.tmpl") + "\n"},
+		{[]string{"deps", page}, "", 0, "page.tmpl -> item\n"},
+		{[]string{"deps", "-dot", page}, "", 0, "digraph templates {\n\t\"item\";\n\t\"page.tmpl\";\n\t\"page.tmpl\" -> \"item\";\n}\n"},
+		{[]string{"unknown"}, "", 2, ""},
+	} {
+		var stdout, stderr bytes.Buffer
+		status := run(test.args, strings.NewReader(test.stdin), &stdout, &stderr)
+		if status != test.status {
+			t.Errorf("%v: status %d, want %d: %s", test.args, status, test.status, stderr.String())
+			continue
+		}
+		if test.status == 1 && test.want != "" {
+			if !strings.Contains(stdout.String(), test.want) {
+				t.Errorf("%v: got %q, want it to contain %q", test.args, stdout.String(), test.want)
+			}
+		} else if test.status == 0 && stdout.String() != test.want {
+			t.Errorf("%v: got %q, want %q", test.args, stdout.String(), test.want)
+		}
+	}
+}
+
+func TestFmtWrite(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"a.tmpl": "{{ .X|print }}"})
+	file := filepath.Join(dir, "a.tmpl")
+	var stdout, stderr bytes.Buffer
+	if status := run([]string{"fmt", "-w", file}, nil, &stdout, &stderr); status != 0 {
+		t.Fatalf("status %d: %s", status, stderr.String())
+	}
+	if b, _ := os.ReadFile(file); string(b) != "{{.X | print}}" {
+		t.Errorf("got %q", b)
+	}
+}
+
+func TestDecodeYAML(t *testing.T) {
+	for _, test := range []struct {
+		src  string
+		want interface{}
+	}{
+		{"", nil},
+		{"a: 1\nb: x # comment\nc: 'it''s'\nd: \"q\\n\"\ne: true\nf: ~\ng: 1.5\n", map[string]interface{}{
+			"a": int64(1), "b": "x", "c": "it's", "d": "q\n", "e": true, "f": nil, "g": 1.5,
+		}},
+		{"---\nlist:\n- a\n- b: 1\n  c: 2\n-\nflow: [1, \"x\"]\n", map[string]interface{}{
+			"list": []interface{}{"a", map[string]interface{}{"b": int64(1), "c": int64(2)}, nil},
+			"flow": []interface{}{float64(1), "x"},
+		}},
+		{"a:\n  b:\n    c: d\n  e: f\n", map[string]interface{}{
+			"a": map[string]interface{}{"b": map[string]interface{}{"c": "d"}, "e": "f"},
+		}},
+		{"- - 1\n  - 2\n- 3\n", []interface{}{[]interface{}{int64(1), int64(2)}, int64(3)}},
+	} {
+		got, err := decodeYAML([]byte(test.src))
+		if err != nil {
+			t.Errorf("%q: %v", test.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %#v, want %#v", test.src, got, test.want)
+		}
+	}
+	for _, src := range []string{"a: |\n  x\n", "a: 1\n   b: 2\n", "a: &x 1\n"} {
+		if _, err := decodeYAML([]byte(src)); err == nil {
+			t.Errorf("%q: no error", src)
+		}
+	}
+}
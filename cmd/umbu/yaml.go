@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// yamlLine is a line of a YAML document, without its indentation and
+// comment.
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+// decodeYAML decodes the subset of YAML of the configuration files: the
+// block mappings and sequences, the plain, single and double quoted
+// scalars, and the flow collections written as JSON. The anchors, the tags,
+// the block scalars and the multiple documents aren't supported.
+func decodeYAML(src []byte) (interface{}, error) {
+	var lines []yamlLine
+	for i, text := range strings.Split(string(src), "\n") {
+		text = strings.TrimRight(stripYAMLComment(text), " \t\r")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || (len(lines) == 0 && trimmed == "---") {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: tab in indentation", i+1)
+		}
+		lines = append(lines, yamlLine{i + 1, len(text) - len(trimmed), trimmed})
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+	v, n, err := yamlNode(lines, 0)
+	if err == nil && n < len(lines) {
+		err = fmt.Errorf("line %d: unexpected indentation", lines[n].num)
+	}
+	return v, err
+}
+
+// stripYAMLComment removes the comment of the line, out of the quotes.
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// yamlNode decodes the block node starting at the line i, returning the
+// index of the line after it.
+func yamlNode(lines []yamlLine, i int) (interface{}, int, error) {
+	if isYAMLItem(lines[i].text) {
+		return yamlSequence(lines, i)
+	}
+	if _, _, ok := splitYAMLKey(lines[i].text); ok {
+		return yamlMapping(lines, i)
+	}
+	v, err := yamlScalar(lines[i].text)
+	return v, i + 1, err
+}
+
+func isYAMLItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func yamlSequence(lines []yamlLine, i int) (interface{}, int, error) {
+	indent := lines[i].indent
+	items := []interface{}{}
+	for i < len(lines) && lines[i].indent == indent && isYAMLItem(lines[i].text) {
+		rest := strings.TrimLeft(strings.TrimPrefix(lines[i].text, "-"), " ")
+		var (
+			v   interface{}
+			err error
+		)
+		switch {
+		case rest == "":
+			if i+1 < len(lines) && lines[i+1].indent > indent {
+				v, i, err = yamlNode(lines, i+1)
+			} else {
+				i++
+			}
+		default:
+			// The item is a node indented after the dash.
+			lines[i] = yamlLine{lines[i].num, indent + len(lines[i].text) - len(rest), rest}
+			v, i, err = yamlNode(lines, i)
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		items = append(items, v)
+	}
+	return items, i, nil
+}
+
+func yamlMapping(lines []yamlLine, i int) (interface{}, int, error) {
+	indent := lines[i].indent
+	m := map[string]interface{}{}
+	for i < len(lines) && lines[i].indent == indent && !isYAMLItem(lines[i].text) {
+		key, rest, ok := splitYAMLKey(lines[i].text)
+		if !ok {
+			return nil, 0, fmt.Errorf("line %d: want a key", lines[i].num)
+		}
+		var (
+			v   interface{}
+			err error
+		)
+		switch {
+		case rest != "":
+			v, err = yamlScalar(rest)
+			i++
+		case i+1 < len(lines) && (lines[i+1].indent > indent ||
+			lines[i+1].indent == indent && isYAMLItem(lines[i+1].text)):
+			v, i, err = yamlNode(lines, i+1)
+		default:
+			i++
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		m[key] = v
+	}
+	return m, i, nil
+}
+
+// splitYAMLKey splits the mapping entry "key: value" of the line.
+func splitYAMLKey(text string) (key, rest string, ok bool) {
+	if text[0] == '"' || text[0] == '\'' {
+		end := strings.IndexByte(text[1:], text[0])
+		if end < 0 || !strings.HasPrefix(text[end+2:], ":") {
+			return "", "", false
+		}
+		k, err := yamlScalar(text[:end+2])
+		if err != nil {
+			return "", "", false
+		}
+		return fmt.Sprint(k), strings.TrimSpace(text[end+3:]), true
+	}
+	if text[0] == '[' || text[0] == '{' {
+		return "", "", false
+	}
+	if i := strings.Index(text, ": "); i > 0 {
+		return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+2:]), true
+	}
+	if strings.HasSuffix(text, ":") {
+		return strings.TrimSpace(text[:len(text)-1]), "", true
+	}
+	return "", "", false
+}
+
+// yamlScalar decodes the scalar or the JSON flow collection.
+func yamlScalar(text string) (interface{}, error) {
+	switch text {
+	case "~", "null", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	switch text[0] {
+	case '"':
+		return strconv.Unquote(text)
+	case '\'':
+		if len(text) < 2 || text[len(text)-1] != '\'' {
+			return nil, fmt.Errorf("unclosed string %s", text)
+		}
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	case '[', '{':
+		var v interface{}
+		if err := json.Unmarshal([]byte(text), &v); err != nil {
+			return nil, fmt.Errorf("flow collection %s: %v", text, err)
+		}
+		return v, nil
+	case '|', '>', '&', '*', '!':
+		return nil, fmt.Errorf("unsupported YAML %s", text)
+	}
+	if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(text, 64); err == nil {
+		return f, nil
+	}
+	return text, nil
+}
@@ -0,0 +1,241 @@
+// Package color parses and manipulates the colors of the templates, as the
+// color, lighten, darken, contrast and mix builtins, writing them as CSS
+// hexadecimal colors, which are safe in any CSS context.
+package color
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Color is an RGBA color, with components from 0 to 255.
+type Color struct {
+	R, G, B, A uint8
+}
+
+// Black and White are the default dark and light colors of Contrast.
+var (
+	Black = Color{0, 0, 0, 255}
+	White = Color{255, 255, 255, 255}
+)
+
+// names are the named colors parsed by Parse, the basic colors of CSS.
+var names = map[string]Color{
+	"black":       Black,
+	"white":       White,
+	"silver":      {192, 192, 192, 255},
+	"gray":        {128, 128, 128, 255},
+	"grey":        {128, 128, 128, 255},
+	"red":         {255, 0, 0, 255},
+	"maroon":      {128, 0, 0, 255},
+	"yellow":      {255, 255, 0, 255},
+	"olive":       {128, 128, 0, 255},
+	"lime":        {0, 255, 0, 255},
+	"green":       {0, 128, 0, 255},
+	"aqua":        {0, 255, 255, 255},
+	"teal":        {0, 128, 128, 255},
+	"blue":        {0, 0, 255, 255},
+	"navy":        {0, 0, 128, 255},
+	"fuchsia":     {255, 0, 255, 255},
+	"purple":      {128, 0, 128, 255},
+	"orange":      {255, 165, 0, 255},
+	"transparent": {0, 0, 0, 0},
+}
+
+// Parse parses the CSS color s: "#rgb", "#rgba", "#rrggbb", "#rrggbbaa",
+// "rgb(r, g, b)", "rgba(r, g, b, a)" or a basic color name.
+func Parse(s string) (c Color, err error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if named, ok := names[s]; ok {
+		return named, nil
+	}
+	if strings.HasPrefix(s, "#") {
+		return parseHex(s[1:])
+	}
+	if args, ok := cutFunc(s, "rgba"); ok {
+		return parseRGB(s, args, 4)
+	}
+	if args, ok := cutFunc(s, "rgb"); ok {
+		return parseRGB(s, args, 3)
+	}
+	return c, fmt.Errorf("color: invalid color %q", s)
+}
+
+// cutFunc returns the arguments of the call of the CSS function name in s.
+func cutFunc(s, name string) ([]string, bool) {
+	if !strings.HasPrefix(s, name+"(") || !strings.HasSuffix(s, ")") {
+		return nil, false
+	}
+	return strings.Split(s[len(name)+1:len(s)-1], ","), true
+}
+
+func parseHex(h string) (c Color, err error) {
+	switch len(h) {
+	case 3, 4:
+		h = string([]byte{h[0], h[0], h[1], h[1], h[2], h[2]}) + strings.Repeat(h[3:], 2)
+	case 6, 8:
+	default:
+		return c, fmt.Errorf("color: invalid color %q", "#"+h)
+	}
+	if len(h) == 6 {
+		h += "ff"
+	}
+	v, err := strconv.ParseUint(h, 16, 32)
+	if err != nil {
+		return c, fmt.Errorf("color: invalid color %q", "#"+h)
+	}
+	return Color{uint8(v >> 24), uint8(v >> 16), uint8(v >> 8), uint8(v)}, nil
+}
+
+func parseRGB(s string, args []string, n int) (c Color, err error) {
+	if len(args) != n {
+		return c, fmt.Errorf("color: invalid color %q", s)
+	}
+	var v [4]uint8
+	v[3] = 255
+	for i, arg := range args {
+		arg = strings.TrimSpace(arg)
+		if i == 3 {
+			a, err := strconv.ParseFloat(arg, 64)
+			if err != nil || a < 0 || a > 1 {
+				return c, fmt.Errorf("color: invalid color %q", s)
+			}
+			v[i] = uint8(math.Round(a * 255))
+			continue
+		}
+		x, err := strconv.ParseUint(arg, 10, 8)
+		if err != nil {
+			return c, fmt.Errorf("color: invalid color %q", s)
+		}
+		v[i] = uint8(x)
+	}
+	return Color{v[0], v[1], v[2], v[3]}, nil
+}
+
+// String returns the color as "#rrggbb", or "#rrggbbaa" if it isn't opaque.
+func (c Color) String() string {
+	if c.A == 255 {
+		return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	}
+	return fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A)
+}
+
+// hsl returns the hue, from 0 to 360, the saturation and the lightness,
+// from 0 to 1, of the color.
+func (c Color) hsl() (h, s, l float64) {
+	r, g, b := float64(c.R)/255, float64(c.G)/255, float64(c.B)/255
+	max, min := math.Max(r, math.Max(g, b)), math.Min(r, math.Min(g, b))
+	l = (max + min) / 2
+	if max == min {
+		return 0, 0, l
+	}
+	d := max - min
+	if l > 0.5 {
+		s = d / (2 - max - min)
+	} else {
+		s = d / (max + min)
+	}
+	switch max {
+	case r:
+		h = (g - b) / d
+		if g < b {
+			h += 6
+		}
+	case g:
+		h = (b-r)/d + 2
+	default:
+		h = (r-g)/d + 4
+	}
+	return h * 60, s, l
+}
+
+// fromHSL returns the color of the hue, saturation and lightness, with the
+// alpha a.
+func fromHSL(h, s, l float64, a uint8) Color {
+	if s == 0 {
+		v := uint8(math.Round(l * 255))
+		return Color{v, v, v, a}
+	}
+	var q float64
+	if l < 0.5 {
+		q = l * (1 + s)
+	} else {
+		q = l + s - l*s
+	}
+	p := 2*l - q
+	hue := func(t float64) uint8 {
+		t = math.Mod(t+1, 1)
+		var v float64
+		switch {
+		case t < 1.0/6:
+			v = p + (q-p)*6*t
+		case t < 1.0/2:
+			v = q
+		case t < 2.0/3:
+			v = p + (q-p)*(2.0/3-t)*6
+		default:
+			v = p
+		}
+		return uint8(math.Round(v * 255))
+	}
+	h /= 360
+	return Color{hue(h + 1.0/3), hue(h), hue(h - 1.0/3), a}
+}
+
+func clamp(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+// Lighten increases the lightness of the color by amount, from 0 to 1.
+func (c Color) Lighten(amount float64) Color {
+	h, s, l := c.hsl()
+	return fromHSL(h, s, clamp(l+amount), c.A)
+}
+
+// Darken decreases the lightness of the color by amount, from 0 to 1.
+func (c Color) Darken(amount float64) Color {
+	return c.Lighten(-amount)
+}
+
+// Mix mixes the color with other, weight being the share of other, from 0
+// to 1.
+func (c Color) Mix(other Color, weight float64) Color {
+	weight = clamp(weight)
+	mix := func(a, b uint8) uint8 {
+		return uint8(math.Round(float64(a)*(1-weight) + float64(b)*weight))
+	}
+	return Color{mix(c.R, other.R), mix(c.G, other.G), mix(c.B, other.B), mix(c.A, other.A)}
+}
+
+// Luminance returns the relative luminance of the color, from 0 to 1, as
+// defined by WCAG.
+func (c Color) Luminance() float64 {
+	channel := func(v uint8) float64 {
+		x := float64(v) / 255
+		if x <= 0.03928 {
+			return x / 12.92
+		}
+		return math.Pow((x+0.055)/1.055, 2.4)
+	}
+	return 0.2126*channel(c.R) + 0.7152*channel(c.G) + 0.0722*channel(c.B)
+}
+
+// ContrastRatio returns the WCAG contrast ratio of the colors, from 1 to 21.
+func (c Color) ContrastRatio(other Color) float64 {
+	a, b := c.Luminance()+0.05, other.Luminance()+0.05
+	if a < b {
+		a, b = b, a
+	}
+	return a / b
+}
+
+// Contrast returns the color of dark and light with the highest contrast
+// ratio with the color, to write text over it.
+func (c Color) Contrast(dark, light Color) Color {
+	if c.ContrastRatio(dark) >= c.ContrastRatio(light) {
+		return dark
+	}
+	return light
+}
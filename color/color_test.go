@@ -0,0 +1,51 @@
+package color
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	for s, want := range map[string]string{
+		"#FFF":                 "#ffffff",
+		"#0f08":                "#00ff0088",
+		"#123456":              "#123456",
+		"#12345678":            "#12345678",
+		"rgb(1, 2, 3)":         "#010203",
+		"rgba(255, 0, 0, 0.5)": "#ff000080",
+		" Navy ":               "#000080",
+		"transparent":          "#00000000",
+	} {
+		c, err := Parse(s)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", s, err)
+		} else if c.String() != want {
+			t.Errorf("Parse(%q) = %s, want %s", s, c, want)
+		}
+	}
+	for _, s := range []string{"", "#12", "#ggg", "rgb(1,2)", "rgb(256,0,0)", "rgba(0,0,0,2)", "red;x:y", "url(x)"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q): expected error; got none", s)
+		}
+	}
+}
+
+func TestManipulation(t *testing.T) {
+	red := Color{255, 0, 0, 255}
+	for _, test := range []struct {
+		got  Color
+		want string
+	}{
+		{red.Lighten(0.2), "#ff6666"},
+		{red.Darken(0.2), "#990000"},
+		{White.Darken(2), "#000000"},
+		{red.Mix(Color{0, 0, 255, 255}, 0.5), "#800080"},
+		{red.Mix(White, 0), "#ff0000"},
+		{Color{255, 255, 0, 255}.Contrast(Black, White), "#000000"},
+		{Color{0, 0, 128, 255}.Contrast(Black, White), "#ffffff"},
+	} {
+		if test.got.String() != test.want {
+			t.Errorf("got %s, want %s", test.got, test.want)
+		}
+	}
+	if r := Black.ContrastRatio(White); r < 20.99 || r > 21.01 {
+		t.Errorf("contrast ratio of black and white = %v, want 21", r)
+	}
+}
@@ -0,0 +1,170 @@
+// Package email renders the parts of an email from a single template:
+//
+//	{{define "subject"}}Welcome, {{.Name}}{{end}}
+//
+//	{{define "html"}}
+//	<h1>Hello, {{.Name}}</h1>
+//	{{end}}
+//
+//	{{define "text"}}
+//	Hello, {{.Name}}
+//	{{end}}
+//
+// The subject and the text parts are executed as text templates and the
+// html part as an html template, so it is contextually escaped. The source
+// may define other templates, called by the parts.
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/moisespsena-go/umbu/funcs"
+	htmltemplate "github.com/moisespsena-go/umbu/html/template"
+	"github.com/moisespsena-go/umbu/text/template"
+)
+
+// The names of the templates holding the parts of the email.
+const (
+	SubjectPart = "subject"
+	HTMLPart    = "html"
+	TextPart    = "text"
+)
+
+// Message is a rendered email.
+type Message struct {
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// Inliner transforms the rendered html part, as to inline its style sheets
+// into style attributes, that most email clients require, as
+// filter.InlineCSSString.
+type Inliner func(html string) (string, error)
+
+// Template is the template of an email.
+type Template struct {
+	name    string
+	text    *template.Template
+	html    *htmltemplate.Template
+	funcs   funcs.FuncValues
+	inliner Inliner
+}
+
+// New allocates a new, undefined email template with the given name.
+func New(name string) *Template {
+	return &Template{
+		name: name,
+		text: template.New(name),
+		html: htmltemplate.New(name),
+	}
+}
+
+// Must panics if err is non-nil. It is intended for use in variable
+// initializations such as
+//
+//	var welcome = email.Must(email.New("welcome").Parse(src))
+func Must(t *Template, err error) *Template {
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Name returns the name of the template.
+func (t *Template) Name() string {
+	return t.name
+}
+
+// Funcs adds the functions to the functions of the parts.
+func (t *Template) Funcs(funcMaps ...funcs.FuncMap) *Template {
+	if len(funcMaps) > 0 {
+		fv, err := funcs.CreateValuesFunc(funcMaps...)
+		if err != nil {
+			panic(err)
+		}
+		t.funcs.AppendValues(fv)
+	}
+	return t
+}
+
+// SetInliner sets the inliner of the html part.
+func (t *Template) SetInliner(inliner Inliner) *Template {
+	t.inliner = inliner
+	return t
+}
+
+// Parse parses text as the source of the email. The source must define the
+// subject part and at least one of the html and text parts.
+func (t *Template) Parse(text string) (*Template, error) {
+	if _, err := t.text.Parse(text); err != nil {
+		return nil, err
+	}
+	if _, err := t.html.Parse(text); err != nil {
+		return nil, err
+	}
+	if !t.defines(SubjectPart) {
+		return nil, fmt.Errorf("email: %q doesn't define the %q part", t.name, SubjectPart)
+	}
+	if !t.defines(HTMLPart) && !t.defines(TextPart) {
+		return nil, fmt.Errorf("email: %q defines neither the %q nor the %q part", t.name, HTMLPart, TextPart)
+	}
+	return t, nil
+}
+
+// ParseFS parses the file of fsys with the given name as the source of the
+// email.
+func (t *Template) ParseFS(fsys fs.FS, name string) (*Template, error) {
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	t.text.SetPath(name)
+	t.html.SetPath(name)
+	return t.Parse(string(b))
+}
+
+// defines reports whether the source defines the part.
+func (t *Template) defines(part string) bool {
+	tmpl := t.text.Lookup(part)
+	return tmpl != nil && tmpl.Tree != nil
+}
+
+// Render renders the parts of the email. The subject is reduced to a single
+// line, with its spaces collapsed, and the parts not defined are empty.
+func (t *Template) Render(data interface{}) (*Message, error) {
+	var (
+		msg Message
+		buf bytes.Buffer
+	)
+	if err := t.text.Lookup(SubjectPart).CreateExecutor().Execute(&buf, data, t.funcs); err != nil {
+		return nil, err
+	}
+	msg.Subject = strings.Join(strings.Fields(buf.String()), " ")
+
+	if t.defines(TextPart) {
+		buf.Reset()
+		if err := t.text.Lookup(TextPart).CreateExecutor().Execute(&buf, data, t.funcs); err != nil {
+			return nil, err
+		}
+		msg.Text = strings.TrimSpace(buf.String()) + "\n"
+	}
+
+	if t.defines(HTMLPart) {
+		buf.Reset()
+		if err := t.html.Lookup(HTMLPart).Execute(&buf, data, t.funcs); err != nil {
+			return nil, err
+		}
+		msg.HTML = strings.TrimSpace(buf.String())
+		if t.inliner != nil {
+			var err error
+			if msg.HTML, err = t.inliner(msg.HTML); err != nil {
+				return nil, fmt.Errorf("email: %q: inline: %w", t.name, err)
+			}
+		}
+	}
+	return &msg, nil
+}
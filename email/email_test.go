@@ -0,0 +1,58 @@
+package email
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/moisespsena-go/umbu/funcs"
+)
+
+const welcome = `
+{{define "subject"}}
+  Welcome,
+  {{.Name | title}}!
+{{end}}
+{{define "html"}}
+<h1>Hello, {{.Name}}</h1>{{template "footer"}}
+{{end}}
+{{define "text"}}
+Hello, {{.Name}}
+{{end}}
+{{define "footer"}}<p>Bye</p>{{end}}
+`
+
+func TestRender(t *testing.T) {
+	fsys := fstest.MapFS{"welcome.tmpl": {Data: []byte(welcome)}}
+	tmpl, err := New("welcome").Funcs(funcs.FuncMap{"title": strings.ToUpper}).ParseFS(fsys, "welcome.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.SetInliner(func(html string) (string, error) {
+		return strings.ReplaceAll(html, "<h1>", `<h1 style="color: red">`), nil
+	})
+	msg, err := tmpl.Render(map[string]string{"Name": "<ann>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Message{
+		Subject: "Welcome, <ANN>!",
+		HTML:    `<h1 style="color: red">Hello, &lt;ann&gt;</h1><p>Bye</p>`,
+		Text:    "Hello, <ann>\n",
+	}
+	if *msg != want {
+		t.Errorf("got %+v\nwant %+v", *msg, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for src, want := range map[string]string{
+		`{{define "html"}}x{{end}}`:    `email: "x" doesn't define the "subject" part`,
+		`{{define "subject"}}x{{end}}`: `email: "x" defines neither the "html" nor the "text" part`,
+	} {
+		_, err := New("x").Parse(src)
+		if err == nil || err.Error() != want {
+			t.Errorf("%s: got error %v, want %q", src, err, want)
+		}
+	}
+}
@@ -0,0 +1,508 @@
+// Package filter provides output filters of template executions, see
+// template.Executor.SetOutputFilter.
+package filter
+
+import (
+	"bytes"
+	"html"
+	"io"
+	"sort"
+	"strings"
+)
+
+// InlineCSS returns an output filter moving the rules of the <style>
+// elements of an html document into the style attributes of the matching
+// elements, as required by most email clients.
+//
+// Only the rules with simple selectors are inlined: a tag name, "*", or
+// any of them followed by ".class" and "#id" parts, as "p", ".note" and
+// "td.price#total", listed with commas. The other rules, such as those
+// with combinators, pseudo classes or at-rules, are kept in a <style>
+// element in place of the first one, and the <style> elements with a media
+// attribute other than all and screen are left as they are. The
+// declarations are applied by specificity and order, and the style
+// attributes of the elements take precedence over the rules.
+//
+// The output is buffered and written when the filter is closed.
+func InlineCSS() func(w io.Writer) io.WriteCloser {
+	return func(w io.Writer) io.WriteCloser {
+		return &inliner{w: w}
+	}
+}
+
+// InlineCSSString inlines the style sheets of the html document as
+// InlineCSS.
+func InlineCSSString(doc string) (string, error) {
+	return inlineCSS(doc), nil
+}
+
+type inliner struct {
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+func (i *inliner) Write(p []byte) (int, error) {
+	return i.buf.Write(p)
+}
+
+func (i *inliner) Close() error {
+	_, err := io.WriteString(i.w, inlineCSS(i.buf.String()))
+	return err
+}
+
+// cssRule is a rule with a simple selector.
+type cssRule struct {
+	sel   selector
+	decls []declaration
+	order int
+}
+
+// selector is a simple selector.
+type selector struct {
+	tag     string // empty or "*" for any tag.
+	id      string
+	classes []string
+}
+
+func (s selector) specificity() int {
+	n := len(s.classes) * 100
+	if s.id != "" {
+		n += 10000
+	}
+	if s.tag != "" && s.tag != "*" {
+		n++
+	}
+	return n
+}
+
+func (s selector) match(tag, id string, classes []string) bool {
+	if s.tag != "" && s.tag != "*" && s.tag != tag {
+		return false
+	}
+	if s.id != "" && s.id != id {
+		return false
+	}
+	for _, c := range s.classes {
+		var found bool
+		for _, ec := range classes {
+			if ec == c {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+type declaration struct {
+	property, value string
+}
+
+func inlineCSS(doc string) string {
+	sheets, doc := extractStyles(doc)
+	if len(sheets) == 0 {
+		return doc
+	}
+	var (
+		rules []cssRule
+		kept  []string
+	)
+	for _, sheet := range sheets {
+		r, k := parseSheet(sheet, len(rules))
+		rules = append(rules, r...)
+		kept = append(kept, k...)
+	}
+	var out strings.Builder
+	for len(doc) > 0 {
+		i := strings.IndexByte(doc, '<')
+		if i < 0 {
+			out.WriteString(doc)
+			break
+		}
+		out.WriteString(doc[:i])
+		doc = doc[i:]
+		switch {
+		case strings.HasPrefix(doc, styleMarker):
+			doc = doc[len(styleMarker):]
+			if len(kept) > 0 {
+				out.WriteString("<style>" + strings.Join(kept, "\n") + "</style>")
+				kept = nil
+			}
+			continue
+		case hasPrefixFold(doc, "<style") && len(doc) > 6 && (doc[6] == '>' || isSpace(doc[6])):
+			// A style sheet kept for other media.
+			end := indexFold(doc, "</style>")
+			if end < 0 {
+				end = len(doc) - len("</style>")
+			}
+			out.WriteString(doc[:end+len("</style>")])
+			doc = doc[end+len("</style>"):]
+			continue
+		case strings.HasPrefix(doc, "<!--"):
+			end := strings.Index(doc, "-->")
+			if end < 0 {
+				end = len(doc) - 3
+			}
+			out.WriteString(doc[:end+3])
+			doc = doc[end+3:]
+			continue
+		}
+		end := tagEnd(doc)
+		if end < 0 || len(doc) < 2 || !isLetter(doc[1]) {
+			out.WriteByte('<')
+			doc = doc[1:]
+			continue
+		}
+		out.WriteString(inlineTag(doc[:end+1], rules))
+		doc = doc[end+1:]
+	}
+	return out.String()
+}
+
+// styleMarker replaces the <style> elements extracted from the document.
+const styleMarker = "<\x00style\x00>"
+
+// extractStyles removes the <style> elements of the document, replaced by
+// styleMarker, and returns their contents. The elements for media other
+// than all and screen are kept in the document.
+func extractStyles(doc string) (sheets []string, rest string) {
+	var out strings.Builder
+	for {
+		i := indexFold(doc, "<style")
+		if i < 0 || i+6 >= len(doc) || (doc[i+6] != '>' && !isSpace(doc[i+6])) {
+			out.WriteString(doc)
+			return sheets, out.String()
+		}
+		start := tagEnd(doc[i:])
+		end := indexFold(doc[i:], "</style>")
+		if start < 0 || end < 0 {
+			out.WriteString(doc)
+			return sheets, out.String()
+		}
+		if !screenStyle(doc[i : i+start+1]) {
+			out.WriteString(doc[:i+end+len("</style>")])
+		} else {
+			out.WriteString(doc[:i])
+			out.WriteString(styleMarker)
+			sheets = append(sheets, doc[i+start+1:i+end])
+		}
+		doc = doc[i+end+len("</style>"):]
+	}
+}
+
+// screenStyle reports whether the <style> start tag applies to the screens:
+// its media attribute, if any, is all or screen.
+func screenStyle(tag string) bool {
+	_, attrs := parseTag(tag)
+	for _, a := range attrs {
+		if a.name == "media" {
+			switch strings.ToLower(strings.TrimSpace(a.value)) {
+			case "", "all", "screen":
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// parseSheet parses the rules of the style sheet, numbered from order, and
+// returns the ones with simple selectors. The others are kept as text.
+func parseSheet(sheet string, order int) (rules []cssRule, kept []string) {
+	for {
+		start := strings.Index(sheet, "/*")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(sheet[start+2:], "*/")
+		if end < 0 {
+			sheet = sheet[:start]
+			break
+		}
+		sheet = sheet[:start] + sheet[start+2+end+2:]
+	}
+	for {
+		sheet = strings.TrimSpace(sheet)
+		open := strings.IndexByte(sheet, '{')
+		if open < 0 {
+			return
+		}
+		// find the matching brace, to skip the blocks of the at-rules.
+		depth, end := 0, -1
+		for i := open; i < len(sheet) && end < 0; i++ {
+			switch sheet[i] {
+			case '{':
+				depth++
+			case '}':
+				if depth--; depth == 0 {
+					end = i
+				}
+			}
+		}
+		if end < 0 {
+			end = len(sheet) - 1
+		}
+		prelude, body := strings.TrimSpace(sheet[:open]), sheet[open+1:end]
+		rule := sheet[:end+1]
+		sheet = sheet[end+1:]
+
+		sels, ok := parseSelectors(prelude)
+		if !ok || strings.Contains(body, "{") {
+			kept = append(kept, rule)
+			continue
+		}
+		decls := parseDeclarations(body)
+		for _, sel := range sels {
+			rules = append(rules, cssRule{sel, decls, order})
+			order++
+		}
+	}
+}
+
+// parseSelectors parses the selectors separated by commas, failing if any
+// of them isn't simple.
+func parseSelectors(prelude string) (sels []selector, ok bool) {
+	if prelude == "" || prelude[0] == '@' {
+		return nil, false
+	}
+	for _, s := range strings.Split(prelude, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return nil, false
+		}
+		var sel selector
+		for i := 0; i < len(s); {
+			j := i + 1
+			for j < len(s) && s[j] != '.' && s[j] != '#' {
+				j++
+			}
+			part := s[i:j]
+			switch part[0] {
+			case '.':
+				sel.classes = append(sel.classes, part[1:])
+				part = part[1:]
+			case '#':
+				sel.id = part[1:]
+				part = part[1:]
+			default:
+				if i > 0 {
+					return nil, false
+				}
+				sel.tag = strings.ToLower(part)
+			}
+			if part != "*" && !isName(part) {
+				return nil, false
+			}
+			i = j
+		}
+		sels = append(sels, sel)
+	}
+	return sels, true
+}
+
+func parseDeclarations(body string) (decls []declaration) {
+	for _, d := range strings.Split(body, ";") {
+		prop, value, ok := strings.Cut(d, ":")
+		prop, value = strings.ToLower(strings.TrimSpace(prop)), strings.TrimSpace(value)
+		if ok && prop != "" && value != "" {
+			decls = append(decls, declaration{prop, value})
+		}
+	}
+	return
+}
+
+// inlineTag returns the start tag with the declarations of the matching
+// rules added to its style attribute.
+func inlineTag(tag string, rules []cssRule) string {
+	name, attrs := parseTag(tag)
+	var id, class string
+	style := attribute{start: -1}
+	for _, a := range attrs {
+		switch a.name {
+		case "id":
+			id = a.value
+		case "class":
+			class = a.value
+		case "style":
+			style = a
+		}
+	}
+	classes := strings.Fields(class)
+	var matched []cssRule
+	for _, r := range rules {
+		if r.sel.match(name, id, classes) {
+			matched = append(matched, r)
+		}
+	}
+	if len(matched) == 0 {
+		return tag
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		si, sj := matched[i].sel.specificity(), matched[j].sel.specificity()
+		if si != sj {
+			return si < sj
+		}
+		return matched[i].order < matched[j].order
+	})
+	var decls []declaration
+	for _, r := range matched {
+		decls = append(decls, r.decls...)
+	}
+	decls = append(decls, parseDeclarations(style.value)...)
+
+	// the last declaration of a property wins, at the position of the first.
+	var (
+		props  []string
+		values = make(map[string]string)
+	)
+	for _, d := range decls {
+		if _, ok := values[d.property]; !ok {
+			props = append(props, d.property)
+		}
+		values[d.property] = d.value
+	}
+	parts := make([]string, len(props))
+	for i, p := range props {
+		parts[i] = p + ": " + values[p]
+	}
+	value := `"` + html.EscapeString(strings.Join(parts, "; ")) + `"`
+	if style.start >= 0 {
+		return tag[:style.start] + value + tag[style.end:]
+	}
+	end := len(tag) - 1
+	if strings.HasSuffix(tag, "/>") {
+		end--
+		for end > 0 && isSpace(tag[end-1]) {
+			end--
+		}
+	}
+	return tag[:end] + " style=" + value + tag[end:]
+}
+
+// attribute is an attribute of a tag. start and end delimit its value,
+// including the quotes, in the tag.
+type attribute struct {
+	name, value string
+	start, end  int
+}
+
+// parseTag parses the name and the attributes of the start tag.
+func parseTag(tag string) (name string, attrs []attribute) {
+	i := 1
+	for i < len(tag) && !isSpace(tag[i]) && tag[i] != '>' && tag[i] != '/' {
+		i++
+	}
+	name = strings.ToLower(tag[1:i])
+	for i < len(tag) {
+		for i < len(tag) && (isSpace(tag[i]) || tag[i] == '/') {
+			i++
+		}
+		start := i
+		for i < len(tag) && !isSpace(tag[i]) && tag[i] != '=' && tag[i] != '>' && tag[i] != '/' {
+			i++
+		}
+		if i == start {
+			break
+		}
+		a := attribute{name: strings.ToLower(tag[start:i]), start: -1}
+		for i < len(tag) && isSpace(tag[i]) {
+			i++
+		}
+		if i < len(tag) && tag[i] == '=' {
+			i++
+			for i < len(tag) && isSpace(tag[i]) {
+				i++
+			}
+			a.start = i
+			if i < len(tag) && (tag[i] == '"' || tag[i] == '\'') {
+				q := tag[i]
+				j := strings.IndexByte(tag[i+1:], q)
+				if j < 0 {
+					j = len(tag) - i - 2
+				}
+				a.value = tag[i+1 : i+1+j]
+				i += j + 2
+			} else {
+				for i < len(tag) && !isSpace(tag[i]) && tag[i] != '>' {
+					i++
+				}
+				a.value = tag[a.start:i]
+			}
+			a.end = i
+			a.value = html.UnescapeString(a.value)
+		}
+		attrs = append(attrs, a)
+	}
+	return
+}
+
+// tagEnd returns the index of the '>' ending the tag starting s, skipping
+// the quoted attribute values, or -1.
+func tagEnd(s string) int {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return i
+		}
+	}
+	return -1
+}
+
+// indexFold is like strings.Index, ignoring the case of the ASCII letters
+// of s. substr must be lower case.
+func indexFold(s, substr string) int {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if hasPrefixFold(s[i:], substr) {
+			return i
+		}
+	}
+	return -1
+}
+
+// hasPrefixFold is like strings.HasPrefix, ignoring the case of the ASCII
+// letters of s. prefix must be lower case.
+func hasPrefixFold(s, prefix string) bool {
+	if len(s) < len(prefix) {
+		return false
+	}
+	for i := 0; i < len(prefix); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		if c != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; !isLetter(c) && !('0' <= c && c <= '9') && c != '-' && c != '_' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,51 @@
+package filter
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/moisespsena-go/umbu/text/template"
+)
+
+var inlineTests = []struct {
+	name, input, output string
+}{
+	{"no style", `<p class="a">x</p>`, `<p class="a">x</p>`},
+	{"tag", `<style>p { color: red }</style><p>x</p><P>y</P>`,
+		`<p style="color: red">x</p><P style="color: red">y</P>`},
+	{"specificity", `<style>#t { color: blue } .a { color: green; margin: 0 } p { color: red }</style><p class="a b" id="t">x</p>`,
+		`<p class="a b" id="t" style="color: blue; margin: 0">x</p>`},
+	{"order", `<style type="text/css">.a { color: red } .b { color: blue }</style><p class="b a">x</p>`,
+		`<p class="b a" style="color: blue">x</p>`},
+	{"inline wins", `<style>p, td.x { color: red; padding: 1px }</style><p style="color: blue">x</p><td class=x>y</td>`,
+		`<p style="color: blue; padding: 1px">x</p><td class=x style="color: red; padding: 1px">y</td>`},
+	{"kept", "<style>/* c */ a:hover { color: red } @media (max-width: 600px) { p { margin: 0 } } img { border: 0 }</style><img src=\"a.png\"/><a href=\"#\">x</a>",
+		"<style>a:hover { color: red }\n@media (max-width: 600px) { p { margin: 0 } }</style><img src=\"a.png\" style=\"border: 0\"/><a href=\"#\">x</a>"},
+	{"quotes", `<style>* { font-family: "Arial" }</style><br data-x="a>b">`,
+		`<br data-x="a>b" style="font-family: &#34;Arial&#34;">`},
+	{"comment", `<style>p { color: red }</style><!-- <p> --><p>x</p>`,
+		`<!-- <p> --><p style="color: red">x</p>`},
+	{"media", `<style media="print">p { color: black }</style><STYLE media=screen>p { color: red }</style><style media="all">* { margin: 0 }</style><p>x</p>`,
+		`<style media="print">p { color: black }</style><p style="margin: 0; color: red">x</p>`},
+	{"invalid utf-8", "\xff\xfe<P>\xc3<STYLE>p { color: red }</style><p>x</p>",
+		"\xff\xfe<P style=\"color: red\">\xc3<p style=\"color: red\">x</p>"},
+}
+
+func TestInlineCSS(t *testing.T) {
+	for _, test := range inlineTests {
+		if got, _ := InlineCSSString(test.input); got != test.output {
+			t.Errorf("%s:\ngot  %q\nwant %q", test.name, got, test.output)
+		}
+	}
+}
+
+func TestInlineCSSFilter(t *testing.T) {
+	tmpl := template.Must(template.New("x").Parse(`<style>.n { color: red }</style><p class="n">{{.}}</p>`))
+	var buf bytes.Buffer
+	if err := tmpl.CreateExecutor().SetOutputFilter(InlineCSS()).Execute(&buf, "x"); err != nil {
+		t.Fatal(err)
+	}
+	if want := `<p class="n" style="color: red">x</p>`; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,483 @@
+// Package format implements the canonical formatting of template sources.
+//
+// The formatter re-emits the parse trees of a template, parsed with
+// parse.ParseComments to keep the comments: pipelines are written
+// with canonical spacing, "else" followed by a single "if" is written as
+// "else if", and block actions (if, range, with, define, ...) are placed on
+// their own lines, indented by their nesting level.
+//
+// Formatting never changes the output of a template. Text is written
+// verbatim, so a block action is only moved to its own line when a trim
+// marker can absorb the inserted line break. For the same reason, the
+// original trim markers are not kept: the whitespace they trim is already
+// removed from the parsed text, and the formatter writes a trim marker only
+// where its own layout needs one.
+package format
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/moisespsena-go/umbu/text/template/parse"
+)
+
+// Options configures the formatter. The zero value is ready to use.
+type Options struct {
+	// Indent is the indentation of each nesting level. Defaults to a tab.
+	Indent string
+	// LeftDelim and RightDelim are the action delimiters. They default
+	// to "{{" and "}}".
+	LeftDelim, RightDelim string
+}
+
+func (o *Options) defaults() (opts Options) {
+	if o != nil {
+		opts = *o
+	}
+	if opts.Indent == "" {
+		opts.Indent = "\t"
+	}
+	if opts.LeftDelim == "" {
+		opts.LeftDelim = "{{"
+	}
+	if opts.RightDelim == "" {
+		opts.RightDelim = "}}"
+	}
+	return
+}
+
+// sourceName is the name of the template parsed by Source.
+const sourceName = "\x00source"
+
+// Source formats the template source src. A nil opts uses the defaults.
+func Source(src []byte, opts *Options) ([]byte, error) {
+	o := opts.defaults()
+	trees := make(map[string]*parse.Tree)
+	tree := parse.New(sourceName)
+	tree.Mode = parse.ParseComments
+	if _, err := tree.Parse(string(src), o.LeftDelim, o.RightDelim, trees); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := Fprint(&buf, trees, sourceName, &o); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Fprint writes the formatted source of the template name of the tree set
+// to w, followed by the templates defined by the same source. A nil opts
+// uses the defaults.
+func Fprint(w io.Writer, trees map[string]*parse.Tree, name string, opts *Options) error {
+	p := &printer{opts: opts.defaults(), trees: trees}
+	p.source(trees[name])
+	_, err := w.Write(p.buf.Bytes())
+	return err
+}
+
+// trim is the policy of the right trim marker of an action.
+type trim int
+
+const (
+	trimAuto   trim = iota // the marker may be added by the layout
+	trimNever              // the marker would change the meaning of the action
+	trimAlways             // the marker is part of the action
+)
+
+// item is a node to print or, at the top level, a {{define}} action.
+type item struct {
+	node   parse.Node
+	define *parse.Tree
+}
+
+// actionItem is the item following a list that ends with an action.
+var actionItem = &item{}
+
+func items(l *parse.ListNode) (items []item) {
+	if l == nil {
+		return
+	}
+	for _, n := range l.Nodes {
+		items = append(items, item{node: n})
+	}
+	return
+}
+
+type printer struct {
+	opts  Options
+	trees map[string]*parse.Tree
+	buf   bytes.Buffer
+	depth int
+	// lineStart reports that a line break was inserted and that the
+	// indentation is pending.
+	lineStart bool
+	// last is the text written last, or nil if it was an action.
+	last []byte
+}
+
+// source prints the tree t, interleaving the definitions parsed from the
+// same source at their positions.
+func (p *printer) source(t *parse.Tree) {
+	if t == nil || t.Root == nil {
+		return
+	}
+	blocks := map[string]bool{}
+	for _, tree := range p.trees {
+		if tree.Root == nil {
+			continue
+		}
+		parse.Inspect(tree.Root, func(n parse.Node) bool {
+			if n, ok := n.(*parse.TemplateNode); ok && n.Block {
+				blocks[n.Name] = true
+			}
+			return true
+		})
+	}
+	var defines []*parse.Tree
+	for name, tree := range p.trees {
+		if tree != t && tree.Root != nil && tree.ParseName == t.ParseName && !blocks[name] {
+			defines = append(defines, tree)
+		}
+	}
+	sort.Slice(defines, func(i, j int) bool {
+		return defines[i].Root.Pos < defines[j].Root.Pos
+	})
+
+	var all []item
+	for _, n := range t.Root.Nodes {
+		for len(defines) > 0 && defines[0].Root.Pos < n.Position() {
+			all = append(all, item{define: defines[0]})
+			defines = defines[1:]
+		}
+		all = append(all, item{node: n})
+	}
+	for _, d := range defines {
+		all = append(all, item{define: d})
+	}
+	p.list(all, nil)
+}
+
+// list prints the items. next is the item following the list, nil at the
+// end of the source.
+func (p *printer) list(items []item, next *item) {
+	for i := range items {
+		following := next
+		if i+1 < len(items) {
+			following = &items[i+1]
+		}
+		p.item(items[i], following)
+	}
+}
+
+// body prints the list l one level deeper.
+func (p *printer) body(l *parse.ListNode) {
+	p.depth++
+	p.list(items(l), actionItem)
+	p.depth--
+}
+
+// first returns the first item of the list l, which follows the action
+// opening it.
+func first(l *parse.ListNode) *item {
+	if l == nil || len(l.Nodes) == 0 {
+		return actionItem
+	}
+	return &item{node: l.Nodes[0]}
+}
+
+func (p *printer) item(it item, next *item) {
+	if it.define != nil {
+		header := "define " + strconv.Quote(it.define.Name)
+		if params := it.define.Params(); params != nil {
+			list := make([]string, len(params))
+			for i, param := range params {
+				list[i] = param.String()
+			}
+			header += " (" + strings.Join(list, ", ") + ")"
+		} else {
+			for _, arg := range it.define.Args() {
+				header += " " + arg
+			}
+		}
+		p.action(header, true, first(it.define.Root), trimAuto)
+		p.body(it.define.Root)
+		p.action("end", true, next, trimAuto)
+		return
+	}
+
+	switch n := it.node.(type) {
+	case *parse.TextNode:
+		p.text(n.Text)
+	case *parse.CommentNode:
+		p.action(n.Text, false, next, trimAuto)
+	case *parse.ActionNode:
+		p.action(pipe(n.Pipe), false, next, trimAuto)
+	case *parse.TemplateNode:
+		s := strconv.Quote(n.Name)
+		if n.NameNode != nil {
+			s = operand(n.NameNode)
+		}
+		if n.Pipe != nil {
+			s += " " + pipe(n.Pipe)
+		}
+		if tree := p.trees[n.Name]; n.Block && tree != nil {
+			p.action("block "+s, true, first(tree.Root), trimAuto)
+			p.body(tree.Root)
+			p.action("end", true, next, trimAuto)
+			return
+		}
+		p.action("template "+s, false, next, trimAuto)
+	case *parse.IfNode:
+		p.branch(&n.BranchNode, next)
+	case *parse.RangeNode:
+		p.branch(&n.BranchNode, next)
+	case *parse.WithNode:
+		p.branch(&n.BranchNode, next)
+	case *parse.ArgNode:
+		p.branch(&n.BranchNode, next)
+	case *parse.CallbackNode:
+		p.branch(&n.BranchNode, next)
+	case *parse.WrapNode:
+		p.wrap(n, next)
+	case *parse.CustomNode:
+		p.custom(n, next)
+	case *parse.ReturnNode:
+		s := "return"
+		if n.Pipe != nil {
+			s += " " + pipe(n.Pipe)
+		}
+		p.action(s, false, next, trimAuto)
+	default:
+		p.action(n.String(), false, next, trimAuto)
+	}
+}
+
+func (p *printer) branch(b *parse.BranchNode, next *item) {
+	p.action(b.Type().String()+" "+pipe(b.Pipe), true, first(b.List), trimAuto)
+	p.body(b.List)
+	for b.ElseList != nil {
+		if elseIf, ok := singleIf(b); ok {
+			b = &elseIf.BranchNode
+			p.action("else if "+pipe(b.Pipe), true, first(b.List), trimAuto)
+			p.body(b.List)
+			continue
+		}
+		p.action("else", true, first(b.ElseList), trimAuto)
+		p.body(b.ElseList)
+		break
+	}
+	p.action("end", true, next, trimAuto)
+}
+
+// singleIf returns the if action of the else branch of an if action when
+// it's the only node of the branch, which is equivalent to "else if".
+func singleIf(b *parse.BranchNode) (n *parse.IfNode, ok bool) {
+	if b.Type() == parse.NodeIf && len(b.ElseList.Nodes) == 1 {
+		n, ok = b.ElseList.Nodes[0].(*parse.IfNode)
+	}
+	return
+}
+
+func (p *printer) wrap(n *parse.WrapNode, next *item) {
+	// The right trim marker of the wrap action, or of its enter action,
+	// strips the wrapped output.
+	strip := trimNever
+	if n.Pipe.TrimRight {
+		strip = trimAlways
+	}
+	head := "wrap"
+	if len(n.Pipe.Cmds) > 0 {
+		head += " " + pipe(n.Pipe)
+	}
+	if n.BeginList != nil {
+		p.action(head, true, actionItem, trimAuto)
+		p.action("begin", true, first(n.BeginList), trimAuto)
+		p.body(n.BeginList)
+		p.action("enter", true, first(n.List), strip)
+	} else {
+		p.action(head, true, first(n.List), strip)
+	}
+	p.body(n.List)
+	if n.AfterList != nil {
+		p.action("after", true, first(n.AfterList), trimAuto)
+		p.body(n.AfterList)
+	}
+	if n.ElseList != nil {
+		p.action("else", true, first(n.ElseList), trimAuto)
+		p.body(n.ElseList)
+	}
+	p.action("end", true, next, trimAuto)
+}
+
+func (p *printer) custom(n *parse.CustomNode, next *item) {
+	head := n.Keyword
+	if n.Pipe != nil {
+		head += " " + pipe(n.Pipe)
+	}
+	if n.List == nil {
+		p.action(head, false, next, trimAuto)
+		return
+	}
+	p.action(head, true, first(n.List), trimAuto)
+	p.body(n.List)
+	if n.ElseList != nil {
+		p.action("else", true, first(n.ElseList), trimAuto)
+		p.body(n.ElseList)
+	}
+	p.action("end", true, next, trimAuto)
+}
+
+func (p *printer) indent() {
+	p.buf.WriteString(strings.Repeat(p.opts.Indent, p.depth))
+	p.lineStart = false
+}
+
+func (p *printer) text(text []byte) {
+	if p.lineStart {
+		p.indent()
+	}
+	p.buf.Write(text)
+	p.last = text
+}
+
+// action writes the action s. A block action is placed on its own line,
+// unless that changes the output of the template. next is the item
+// following the action, nil at the end of the source.
+func (p *printer) action(s string, block bool, next *item, right trim) {
+	trimLeft := block && p.breakBefore()
+	trimRight := right == trimAlways
+	breakAfter := block && right != trimNever && p.breakAfter(next)
+	if p.lineStart {
+		p.indent()
+	}
+	p.buf.WriteString(p.opts.LeftDelim)
+	if trimLeft {
+		p.buf.WriteString("- ")
+	}
+	p.buf.WriteString(s)
+	if trimRight || breakAfter {
+		p.buf.WriteString(" -")
+	}
+	p.buf.WriteString(p.opts.RightDelim)
+	p.last = nil
+	if breakAfter {
+		p.buf.WriteByte('\n')
+		p.lineStart = true
+	}
+}
+
+// breakBefore inserts a line break before a block action, when needed.
+// It reports whether the action needs a left trim marker to remove it.
+func (p *printer) breakBefore() bool {
+	if p.buf.Len() == 0 || p.lineStart {
+		return false
+	}
+	if p.last != nil {
+		text := bytes.TrimRight(p.last, " \t")
+		if len(text) == 0 || text[len(text)-1] == '\n' || len(text) < len(p.last) {
+			// Already on its own line, or the trailing spaces are part
+			// of the output.
+			return false
+		}
+	}
+	p.buf.WriteByte('\n')
+	p.lineStart = true
+	return true
+}
+
+// breakAfter reports whether a line break, removed by a right trim marker,
+// may be inserted after a block action followed by next.
+func (p *printer) breakAfter(next *item) bool {
+	if next == nil {
+		return false
+	}
+	if next.node == nil {
+		return true
+	}
+	text, ok := next.node.(*parse.TextNode)
+	if !ok {
+		return true
+	}
+	trimmed := bytes.TrimLeft(text.Text, " \t")
+	if len(trimmed) == 0 {
+		return false
+	}
+	switch trimmed[0] {
+	case '\n', '\r':
+		// The text starts a new line.
+		return false
+	}
+	// Leading spaces are part of the output.
+	return len(trimmed) == len(text.Text)
+}
+
+func pipe(p *parse.PipeNode) string {
+	var b strings.Builder
+	for i, v := range p.Decl {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		if v.Ptr {
+			b.WriteByte('&')
+		}
+		b.WriteString(v.String())
+	}
+	if len(p.Decl) > 0 {
+		v := p.Decl[len(p.Decl)-1]
+		switch {
+		case v.Op != '=':
+			b.WriteString(" " + string(v.Op) + "= ")
+		case v.Update:
+			b.WriteString(" = ")
+		default:
+			b.WriteString(" := ")
+		}
+	}
+	for i, c := range p.Cmds {
+		if i > 0 {
+			b.WriteString(" | ")
+		}
+		b.WriteString(command(c))
+	}
+	return b.String()
+}
+
+func command(c *parse.CommandNode) string {
+	args := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		args[i] = operand(arg)
+	}
+	return strings.Join(args, " ")
+}
+
+func operand(n parse.Node) string {
+	switch n := n.(type) {
+	case *parse.PipeNode:
+		return "(" + pipe(n) + ")"
+	case *parse.ChainNode:
+		s := operand(n.Node)
+		for _, field := range n.Field {
+			s += "." + field
+		}
+		return s
+	case *parse.FieldNode:
+		if n.NotRequired {
+			return n.String() + "?"
+		}
+	case *parse.ExprNode:
+		return command(n.A) + " " + string(n.Op) + " " + command(n.B)
+	case *parse.TemplateNode:
+		s := "template " + strconv.Quote(n.Name)
+		if n.NameNode != nil {
+			s = "template " + operand(n.NameNode)
+		}
+		if n.Pipe != nil {
+			s += " " + pipe(n.Pipe)
+		}
+		return s
+	}
+	return n.String()
+}
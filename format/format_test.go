@@ -0,0 +1,95 @@
+package format
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/moisespsena-go/umbu/text/template"
+)
+
+var formatTests = []struct {
+	name, input, output string
+}{
+	{"text", "hello", "hello"},
+	{"comment", "a{{/* note */}}b{{- /* trim */ -}} c", "a{{/* note */}}b{{/* trim */}}c"},
+	{"comment in block", "{{if .}}{{/* x */}}{{end}}", "{{if . -}}\n\t{{/* x */}}\n{{- end}}"},
+	{"spacing", "{{  .X|printf   \"%d\"  }}", `{{.X | printf "%d"}}`},
+	{"decl", "{{$x:=1}}{{$x =2}}{{$x += 3}}{{$x}}", "{{$x := 1}}{{$x = 2}}{{$x += 3}}{{$x}}"},
+	{"range decl", "{{range $i,$v:=.}}{{$i}}{{end}}", "{{range $i, $v := . -}}\n\t{{$i}}\n{{- end}}"},
+	{"expr", "{{1 + (2 * 3)}}", "{{1 + (2 * 3)}}"},
+	{"optional field", "{{.X?}}", "{{.X?}}"},
+	{"block", "{{if .}}yes{{else}}no{{end}}",
+		"{{if . -}}\n\tyes\n{{- else -}}\n\tno\n{{- end}}"},
+	{"else if", "{{if .A}}a{{else}}{{if .B}}b{{end}}{{end}}",
+		"{{if .A -}}\n\ta\n{{- else if .B -}}\n\tb\n{{- end}}"},
+	{"nested", "<ul>{{range .}}{{if .}}<li>{{.}}</li>{{end}}{{end}}</ul>",
+		"<ul>\n{{- range . -}}\n\t{{if . -}}\n\t\t<li>{{.}}</li>\n\t{{- end -}}\n{{end -}}\n</ul>"},
+	{"own lines", "{{range .}}\n  <li>{{.}}</li>\n{{end}}\n", "{{range .}}\n  <li>{{.}}</li>\n{{end}}\n"},
+	{"trim markers", "<ul>\n{{- range .}}\n  <li>{{.}}</li>\n{{- end}}\n</ul>",
+		"<ul>\n{{- range .}}\n  <li>{{.}}</li>\n{{- end}}\n</ul>"},
+	{"significant spaces", "a {{if .}} b {{end}} c", "a {{if .}} b {{end}} c"},
+	{"define", `{{define "x" $a}}{{$a}}{{end}}body{{template "x" . 1}}`,
+		"{{define \"x\" $a -}}\n\t{{$a}}\n{{- end -}}\nbody{{template \"x\" . 1}}"},
+	{"define params", `{{define "x" (a string,b  []int ,$c)}}{{$a}}{{end}}{{template "x" . "s" nil 1}}`,
+		"{{define \"x\" (a string, b []int, c) -}}\n\t{{$a}}\n{{- end -}}\n{{template \"x\" . \"s\" nil 1}}"},
+	{"dynamic template", "{{template  (print  \"a\")   .}}{{define \"a\"}}A{{end}}",
+		"{{template (print \"a\") .}}\n{{- define \"a\" -}}\n\tA\n{{- end}}"},
+	{"block action", `{{block "x" .}}{{.}}{{end}}`, "{{block \"x\" . -}}\n\t{{.}}\n{{- end}}"},
+	{"wrap strip", "{{wrap -}}a{{end}}", "{{wrap -}}\n\ta\n{{- end}}"},
+	{"wrap", "{{wrap}}{{begin}}<p>{{enter}}{{.}}{{after}}</p>{{end}}",
+		"{{wrap -}}\n{{begin -}}\n\t<p>\n{{- enter}}{{.}}\n{{- after -}}\n\t</p>\n{{- end}}"},
+}
+
+func TestSource(t *testing.T) {
+	for _, test := range formatTests {
+		out, err := Source([]byte(test.input), nil)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if string(out) != test.output {
+			t.Errorf("%s:\ngot\n%q\nwant\n%q", test.name, out, test.output)
+			continue
+		}
+		again, err := Source(out, nil)
+		if err != nil {
+			t.Errorf("%s: reformat: %v", test.name, err)
+		} else if !bytes.Equal(again, out) {
+			t.Errorf("%s: not idempotent:\n%q\n%q", test.name, out, again)
+		}
+	}
+}
+
+func TestSourcePreservesOutput(t *testing.T) {
+	data := map[string]interface{}{"A": true, "B": 0, "X": 1}
+	for _, test := range formatTests {
+		out, err := Source([]byte(test.input), nil)
+		if err != nil {
+			continue
+		}
+		execute := func(src string) string {
+			tmpl, err := template.New(test.name).Parse(src)
+			if err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+			var buf bytes.Buffer
+			if err := tmpl.Execute(&buf, data); err != nil {
+				return "error: " + err.Error()
+			}
+			return buf.String()
+		}
+		if want, got := execute(test.input), execute(string(out)); got != want {
+			t.Errorf("%s: output changed:\ngot  %q\nwant %q", test.name, got, want)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	out, err := Source([]byte("[[range .]][[.]][[end]]"), &Options{Indent: "  ", LeftDelim: "[[", RightDelim: "]]"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[[range . -]]\n  [[.]]\n[[- end]]"; string(out) != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+}
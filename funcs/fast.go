@@ -0,0 +1,135 @@
+package funcs
+
+import "reflect"
+
+// FastFunc calls a function without reflect.Value.Call, with the arguments
+// converted to the types of its parameters, as reflect.Value.Call does,
+// returning its results.
+type FastFunc func(args []reflect.Value) []reflect.Value
+
+// NewFastFuncValue returns the FuncValue of f called by fast, for the
+// functions whose shape isn't called without reflect.Value.Call by
+// NewFuncValue:
+//
+//	fv := funcs.NewFastFuncValue(repeat, func(args []reflect.Value) []reflect.Value {
+//		return []reflect.Value{reflect.ValueOf(repeat(args[0].String(), int(args[1].Int())))}
+//	})
+func NewFastFuncValue(f interface{}, fast FastFunc) *FuncValue {
+	fv := NewFuncValue(f, nil)
+	fv.fast = fast
+	return fv
+}
+
+// Fast returns the function calling fv without reflect.Value.Call, or nil.
+func (fv *FuncValue) Fast() FastFunc {
+	return fv.fast
+}
+
+// fastFunc returns the FastFunc of the functions of the common shapes, or
+// nil.
+func fastFunc(f interface{}) FastFunc {
+	switch f := f.(type) {
+	case func(string) string:
+		return func(args []reflect.Value) []reflect.Value {
+			return values(reflect.ValueOf(f(args[0].String())))
+		}
+	case func(string) (string, error):
+		return func(args []reflect.Value) []reflect.Value {
+			r, err := f(args[0].String())
+			return values(reflect.ValueOf(r), errorValue(err))
+		}
+	case func(string) bool:
+		return func(args []reflect.Value) []reflect.Value {
+			return values(reflect.ValueOf(f(args[0].String())))
+		}
+	case func(string) int:
+		return func(args []reflect.Value) []reflect.Value {
+			return values(reflect.ValueOf(f(args[0].String())))
+		}
+	case func(string, string) string:
+		return func(args []reflect.Value) []reflect.Value {
+			return values(reflect.ValueOf(f(args[0].String(), args[1].String())))
+		}
+	case func(string, string) bool:
+		return func(args []reflect.Value) []reflect.Value {
+			return values(reflect.ValueOf(f(args[0].String(), args[1].String())))
+		}
+	case func(int, int) int:
+		return func(args []reflect.Value) []reflect.Value {
+			return values(reflect.ValueOf(f(int(args[0].Int()), int(args[1].Int()))))
+		}
+	case func(interface{}) interface{}:
+		return func(args []reflect.Value) []reflect.Value {
+			return values(interfaceValue(f(iface(args[0]))))
+		}
+	case func(interface{}) (interface{}, error):
+		return func(args []reflect.Value) []reflect.Value {
+			r, err := f(iface(args[0]))
+			return values(interfaceValue(r), errorValue(err))
+		}
+	case func(interface{}) string:
+		return func(args []reflect.Value) []reflect.Value {
+			return values(reflect.ValueOf(f(iface(args[0]))))
+		}
+	case func(interface{}) bool:
+		return func(args []reflect.Value) []reflect.Value {
+			return values(reflect.ValueOf(f(iface(args[0]))))
+		}
+	case func(interface{}) int:
+		return func(args []reflect.Value) []reflect.Value {
+			return values(reflect.ValueOf(f(iface(args[0]))))
+		}
+	case func(interface{}, interface{}) interface{}:
+		return func(args []reflect.Value) []reflect.Value {
+			return values(interfaceValue(f(iface(args[0]), iface(args[1]))))
+		}
+	case func(interface{}, interface{}) bool:
+		return func(args []reflect.Value) []reflect.Value {
+			return values(reflect.ValueOf(f(iface(args[0]), iface(args[1]))))
+		}
+	case func(...interface{}) string:
+		return func(args []reflect.Value) []reflect.Value {
+			a := make([]interface{}, len(args))
+			for i, arg := range args {
+				a[i] = iface(arg)
+			}
+			return values(reflect.ValueOf(f(a...)))
+		}
+	}
+	return nil
+}
+
+func values(v ...reflect.Value) []reflect.Value {
+	return v
+}
+
+// iface returns the interface of the argument, nil if it is the zero Value.
+func iface(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	return v.Interface()
+}
+
+var interfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+// interfaceValue returns the result of type interface{}, as returned by
+// reflect.Value.Call.
+func interfaceValue(r interface{}) reflect.Value {
+	if r == nil {
+		return reflect.Zero(interfaceType)
+	}
+	v := reflect.New(interfaceType).Elem()
+	v.Set(reflect.ValueOf(r))
+	return v
+}
+
+// errorValue returns the error result, as returned by reflect.Value.Call.
+func errorValue(err error) reflect.Value {
+	if err == nil {
+		return reflect.Zero(errorType)
+	}
+	v := reflect.New(errorType).Elem()
+	v.Set(reflect.ValueOf(err))
+	return v
+}
@@ -3,6 +3,9 @@ package funcs
 import (
 	"fmt"
 	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"unicode"
 )
 
@@ -21,10 +24,17 @@ type FuncMap map[string]interface{}
 
 type FuncMapSlice []FuncMap
 
+func (this *FuncMapSlice) Append(m ...FuncMap) {
+	*this = append(*this, m...)
+}
+
 type FuncValue struct {
-	f   interface{}
-	v   reflect.Value
-	ctx *FuncValue
+	f          interface{}
+	v          reflect.Value
+	ctx        *FuncValue
+	deprecated string
+	provider   FuncProvider // the provider of a provider layer.
+	fast       FastFunc     // the call without reflect.Value.Call, or nil.
 }
 
 func NewFuncValue(f interface{}, v *reflect.Value) (fv *FuncValue) {
@@ -37,7 +47,7 @@ func NewFuncValue(f interface{}, v *reflect.Value) (fv *FuncValue) {
 		*v = (*v).Elem()
 	}
 
-	fv = &FuncValue{f: f, v: *v}
+	fv = &FuncValue{f: f, v: *v, fast: fastFunc(f)}
 	typ := v.Type()
 
 	if typ.NumIn() == 1 && typ.In(0) == ContextType && typ.NumOut() == 1 {
@@ -58,6 +68,92 @@ func (fv *FuncValue) Context() *FuncValue {
 	return fv.ctx
 }
 
+// Deprecate marks the function as deprecated. Template calls to it are
+// reported to the executor logger with msg as reason.
+func (fv *FuncValue) Deprecate(msg string) *FuncValue {
+	fv.deprecated = msg
+	return fv
+}
+
+// Deprecated returns the deprecation message, or empty if the function isn't
+// deprecated.
+func (fv *FuncValue) Deprecated() string {
+	return fv.deprecated
+}
+
+// Bind returns a copy of the function with its leading arguments fixed to
+// args, taking the other ones:
+//
+//	get, err := funcs.NewFuncValue(client.Get, nil).Bind(ctx)
+//	// get.F() is a func(url string) (*http.Response, error)
+//
+// The arguments must be assignable to the types of the parameters, with nil
+// for the interfaces, pointers, maps, slices, channels and functions. The
+// arguments after the fixed parameters of a variadic function are the
+// leading ones of its variadic parameter. The contextual functions, which
+// take a *Context, can't be bound.
+func (fv *FuncValue) Bind(args ...interface{}) (*FuncValue, error) {
+	if fv.ctx != nil || fv.provider != nil {
+		return nil, fmt.Errorf("bind: contextual function")
+	}
+	typ := fv.v.Type()
+	fixed, variadic := typ.NumIn(), typ.IsVariadic()
+	if variadic {
+		fixed--
+	} else if len(args) > fixed {
+		return nil, fmt.Errorf("bind: %d arguments, want at most %d", len(args), fixed)
+	}
+	bound := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		want := typ.In(i)
+		if i >= fixed {
+			want = typ.In(fixed).Elem()
+		}
+		switch v := reflect.ValueOf(arg); {
+		case !v.IsValid():
+			switch want.Kind() {
+			case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func:
+				bound[i] = reflect.Zero(want)
+			default:
+				return nil, fmt.Errorf("bind: nil argument %d for type %s", i, want)
+			}
+		case v.Type().AssignableTo(want):
+			bound[i] = v
+		default:
+			return nil, fmt.Errorf("bind: argument %d of type %s not assignable to %s", i, v.Type(), want)
+		}
+	}
+	var in []reflect.Type
+	for i := len(args); i < typ.NumIn(); i++ {
+		in = append(in, typ.In(i))
+	}
+	if variadic && len(args) > fixed {
+		in = append(in, typ.In(fixed))
+	}
+	out := make([]reflect.Type, typ.NumOut())
+	for i := range out {
+		out[i] = typ.Out(i)
+	}
+	f := fv.v
+	v := reflect.MakeFunc(reflect.FuncOf(in, out, variadic), func(in []reflect.Value) []reflect.Value {
+		args := append(append(make([]reflect.Value, 0, len(bound)+len(in)), bound...), in...)
+		if !variadic {
+			return f.Call(args)
+		}
+		// The bound variadic arguments lead the variadic slice.
+		rest := args[len(args)-1]
+		args = args[:len(args)-1]
+		if len(args) > fixed {
+			slice := reflect.MakeSlice(rest.Type(), 0, len(args)-fixed+rest.Len())
+			slice = reflect.Append(slice, args[fixed:]...)
+			rest = reflect.AppendSlice(slice, rest)
+			args = args[:fixed]
+		}
+		return f.CallSlice(append(args, rest))
+	})
+	return &FuncValue{f: v.Interface(), v: v, deprecated: fv.deprecated}, nil
+}
+
 func (fv *FuncValue) Value(context *Context) reflect.Value {
 	return fv.ContextualValue(reflect.ValueOf(context))
 }
@@ -89,6 +185,12 @@ func (this *FuncValuesSlice) AppendMap(m ...map[string]*FuncValue) {
 	this.Append(m)
 }
 
+// FuncValues is a stack of layers of functions, looked up from the last
+// layer to the first one. The layers are never changed once built: the
+// methods setting or appending functions replace v by a new stack, copying
+// the layer they change, so the FuncValues read by an execution aren't
+// changed by another. Use AtomicFuncValues to share FuncValues changed while
+// they are read.
 type FuncValues []map[string]*FuncValue
 
 var ContextType = reflect.TypeOf(&Context{})
@@ -99,18 +201,32 @@ func (v FuncValues) Get(name string) *FuncValue {
 	}
 
 	for i := len(v); i > 0; i-- {
-		if f := v[i-1][name]; f != nil {
+		if f := lookup(v[i-1], name); f != nil {
 			return f
 		}
 	}
 	return nil
 }
 
+// lookup returns the named function of the layer, or of its provider.
+func lookup(layer map[string]*FuncValue, name string) *FuncValue {
+	if f := layer[name]; f != nil && name != "" {
+		return f
+	}
+	if p := layer[""]; p != nil && p.provider != nil {
+		if f, ok := p.provider.Lookup(name); ok {
+			return f
+		}
+	}
+	return nil
+}
+
+// With appends the values to v, returning the function restoring v.
 func (v *FuncValues) With(values ...FuncValues) (reset func()) {
-	at := len(*v)
+	old := *v
 	v.AppendValues(values...)
 	return func() {
-		*v = (*v)[:at]
+		*v = old
 	}
 }
 
@@ -132,17 +248,46 @@ func (v *FuncValues) SetValue(name string, value *FuncValue, check ...bool) erro
 			return err
 		}
 	}
-	if len(*v) == 0 {
-		*v = []map[string]*FuncValue{{}}
-	}
-	(*v)[0][name] = value
+	v.setLayer(0, map[string]*FuncValue{name: value})
 	return nil
 }
 
+// setLayer replaces v by a copy with the functions set in a copy of the
+// layer i.
+func (v *FuncValues) setLayer(i int, values map[string]*FuncValue) {
+	layers := make(FuncValues, len(*v))
+	copy(layers, *v)
+	if len(layers) == 0 {
+		layers = FuncValues{nil}
+	}
+	layer := make(map[string]*FuncValue, len(layers[i])+len(values))
+	for name, f := range layers[i] {
+		layer[name] = f
+	}
+	for name, f := range values {
+		layer[name] = f
+	}
+	layers[i] = layer
+	*v = layers
+}
+
 func (v *FuncValues) Set(name string, f interface{}, check ...bool) error {
 	return v.SetPair(name, f, reflect.ValueOf(f), check...)
 }
 
+// Deprecate marks the named function as deprecated, replacing it by a
+// deprecated copy.
+func (v *FuncValues) Deprecate(name, msg string) error {
+	for i := len(*v); i > 0; i-- {
+		if fv := (*v)[i-1][name]; fv != nil {
+			deprecated := *fv
+			v.setLayer(i-1, map[string]*FuncValue{name: deprecated.Deprecate(msg)})
+			return nil
+		}
+	}
+	return fmt.Errorf("function %q doesn't exists", name)
+}
+
 func (v *FuncValues) Has(name string) bool {
 	return v.Get(name) != nil
 }
@@ -165,23 +310,158 @@ func (v *FuncValues) GetDefault(name string, f interface{}) interface{} {
 }
 
 func (v *FuncValues) Append(funcMaps ...FuncMap) error {
+	values := map[string]*FuncValue{}
 	for _, funcMap := range funcMaps {
 		for name, fn := range funcMap {
-			err := v.Set(name, fn)
-			if err != nil {
+			vf := reflect.ValueOf(fn)
+			if err := CheckFuncValue(name, vf); err != nil {
 				return err
 			}
+			values[name] = NewFuncValue(fn, &vf)
 		}
 	}
+	if len(values) > 0 {
+		v.setLayer(0, values)
+	}
 	return nil
 }
 
 func (v *FuncValues) AppendValues(items ...FuncValues) {
 	for _, item := range items {
 		if item != nil {
-			*v = append(*v, item...)
+			// The full slice expression makes append copy the layers.
+			*v = append((*v)[:len(*v):len(*v)], item...)
+		}
+	}
+}
+
+// Delete removes the named function from the layers of v, reporting
+// whether it was defined.
+func (v *FuncValues) Delete(name string) bool {
+	var layers FuncValues
+	for i, layer := range *v {
+		if _, ok := layer[name]; !ok {
+			continue
+		}
+		if layers == nil {
+			layers = make(FuncValues, len(*v))
+			copy(layers, *v)
+		}
+		m := make(map[string]*FuncValue, len(layer))
+		for n, f := range layer {
+			if n != name {
+				m[n] = f
+			}
+		}
+		layers[i] = m
+	}
+	if layers == nil {
+		return false
+	}
+	*v = layers
+	return true
+}
+
+// Layer returns the index of the layer whose function named is returned by
+// Get, or -1 if none defines it.
+func (v FuncValues) Layer(name string) int {
+	for i := len(v); i > 0; i-- {
+		if lookup(v[i-1], name) != nil {
+			return i - 1
 		}
 	}
+	return -1
+}
+
+// AppendPolicy is the policy of the functions appended with the names of
+// functions already defined.
+type AppendPolicy int
+
+const (
+	// Override appends the functions over the ones defined.
+	Override AppendPolicy = iota
+	// KeepFirst keeps the functions defined, skipping the appended ones.
+	KeepFirst
+	// ErrorOnConflict fails with a *ConflictError, appending nothing.
+	ErrorOnConflict
+)
+
+// ConflictError reports a function appended with ErrorOnConflict whose name
+// is already defined.
+type ConflictError struct {
+	Name  string
+	Layer int // the layer defining the function, see Layer.
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("function %q already defined in layer %d", e.Name, e.Layer)
+}
+
+// Resolve returns the functions of the maps to append to v by the policy.
+func (v FuncValues) Resolve(policy AppendPolicy, funcMaps ...FuncMap) (map[string]*FuncValue, error) {
+	var added FuncValues
+	if err := added.Append(funcMaps...); err != nil {
+		return nil, err
+	}
+	values := map[string]*FuncValue{}
+	for _, layer := range added {
+		for name, f := range layer {
+			if i := v.Layer(name); i >= 0 {
+				switch policy {
+				case KeepFirst:
+					continue
+				case ErrorOnConflict:
+					return nil, &ConflictError{name, i}
+				}
+			}
+			values[name] = f
+		}
+	}
+	return values, nil
+}
+
+// AppendWithPolicy appends a layer with the functions of the maps, applying
+// the policy to the names already defined by v:
+//
+//	err := v.AppendWithPolicy(funcs.ErrorOnConflict, funcs.FuncMap{"upper": strings.ToUpper})
+//	var conflict *funcs.ConflictError
+//	if errors.As(err, &conflict) {
+//		// upper is defined by the layer conflict.Layer
+//	}
+func (v *FuncValues) AppendWithPolicy(policy AppendPolicy, funcMaps ...FuncMap) error {
+	values, err := v.Resolve(policy, funcMaps...)
+	if err == nil && len(values) > 0 {
+		v.AppendValues(FuncValues{values})
+	}
+	return err
+}
+
+// Shadowing is a function defined by many layers.
+type Shadowing struct {
+	Name string
+	// Layers are the indexes of the layers defining the function, from the
+	// one winning, returned by Get, to the first one.
+	Layers []int
+}
+
+// Shadowings returns the functions of v defined by many layers, sorted by
+// name.
+func (v FuncValues) Shadowings() (shadowings []Shadowing) {
+	layers := map[string][]int{}
+	for i := len(v); i > 0; i-- {
+		for _, name := range layerNames(v[i-1]) {
+			layers[name] = append(layers[name], i-1)
+		}
+	}
+	for name, l := range layers {
+		if len(l) > 1 {
+			shadowings = append(shadowings, Shadowing{name, l})
+		}
+	}
+	sort.Slice(shadowings, func(i, j int) bool {
+		return shadowings[i].Name < shadowings[j].Name
+	})
+	return
 }
 
 func (v *FuncValues) Start() *FuncValues {
@@ -191,6 +471,137 @@ func (v *FuncValues) Start() *FuncValues {
 	return v
 }
 
+// FuncProvider provides functions by name, so the functions of a library
+// are checked and wrapped once called and not when added. The providers
+// returning the names of their functions by a method Names() []string have
+// them listed by FuncValues.Names and reported by FuncValues.Shadowings.
+type FuncProvider interface {
+	Lookup(name string) (*FuncValue, bool)
+}
+
+// AppendProvider appends a layer with the functions of the provider.
+func (v *FuncValues) AppendProvider(p FuncProvider) {
+	v.AppendValues(FuncValues{{"": &FuncValue{provider: p}}})
+}
+
+// Names returns the sorted names of the functions of v.
+func (v FuncValues) Names() []string {
+	seen := map[string]bool{}
+	for _, layer := range v {
+		for _, name := range layerNames(layer) {
+			seen[name] = true
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// layerNames returns the names of the functions of the layer, including
+// the ones of its provider.
+func layerNames(layer map[string]*FuncValue) (names []string) {
+	for name := range layer {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	if p := layer[""]; p != nil {
+		if n, ok := p.provider.(interface{ Names() []string }); ok {
+			names = append(names, n.Names()...)
+		}
+	}
+	return
+}
+
+// LazyFuncMap returns a FuncProvider of the functions of the map, checked
+// and wrapped on their first lookup. The invalid functions aren't found:
+//
+//	var v funcs.FuncValues
+//	v.AppendProvider(funcs.LazyFuncMap(library))
+func LazyFuncMap(m FuncMap) FuncProvider {
+	return &lazyFuncMap{m: m}
+}
+
+type lazyFuncMap struct {
+	m      FuncMap
+	values sync.Map // the *FuncValue of the functions looked up, by name.
+}
+
+func (l *lazyFuncMap) Lookup(name string) (*FuncValue, bool) {
+	if fv, ok := l.values.Load(name); ok {
+		return fv.(*FuncValue), fv.(*FuncValue) != nil
+	}
+	f, ok := l.m[name]
+	if !ok {
+		return nil, false
+	}
+	var fv *FuncValue
+	if vf := reflect.ValueOf(f); CheckFuncValue(name, vf) == nil {
+		fv = NewFuncValue(f, &vf)
+	}
+	l.values.Store(name, fv)
+	return fv, fv != nil
+}
+
+func (l *lazyFuncMap) Names() []string {
+	names := make([]string, 0, len(l.m))
+	for name := range l.m {
+		names = append(names, name)
+	}
+	return names
+}
+
+// AtomicFuncValues holds FuncValues replaced atomically, so executions may
+// read them while functions are added. The zero value holds no functions.
+type AtomicFuncValues struct {
+	p atomic.Pointer[FuncValues]
+}
+
+// NewAtomicFuncValues returns an AtomicFuncValues holding v.
+func NewAtomicFuncValues(v FuncValues) *AtomicFuncValues {
+	a := &AtomicFuncValues{}
+	a.Store(v)
+	return a
+}
+
+// Load returns the FuncValues held by a, or nil if a is nil.
+func (a *AtomicFuncValues) Load() FuncValues {
+	if a == nil {
+		return nil
+	}
+	if v := a.p.Load(); v != nil {
+		return *v
+	}
+	return nil
+}
+
+// Store replaces the FuncValues held by a.
+func (a *AtomicFuncValues) Store(v FuncValues) {
+	a.p.Store(&v)
+}
+
+// Update replaces the FuncValues held by a by the ones changed by f, which
+// may be called again if they were replaced meanwhile. If f returns an
+// error, they aren't replaced.
+func (a *AtomicFuncValues) Update(f func(v *FuncValues) error) error {
+	for {
+		old := a.p.Load()
+		var v FuncValues
+		if old != nil {
+			v = *old
+		}
+		if err := f(&v); err != nil {
+			return err
+		}
+		if a.p.CompareAndSwap(old, &v) {
+			return nil
+		}
+	}
+}
+
 func NewValues(items ...FuncValues) FuncValues {
 	values := FuncValues{{}}
 
@@ -224,12 +635,13 @@ var errorType = reflect.TypeOf((*error)(nil)).Elem()
 
 // GoodFunc reports whether the function or method has the right result signature.
 func GoodFunc(typ reflect.Type) bool {
-	// We allow functions with 0 or 1 result or 2 results where the second is an error.
+	// We allow functions with 0 or 1 result or 2 results where the second is
+	// an error or an ok, as the ones of {{if $v, $ok := lookup .Key}}.
 	switch typ.NumOut() {
 	case 0, 1:
 		return true
 	case 2:
-		return typ.NumOut() == 2 && typ.Out(1) == errorType
+		return typ.Out(1) == errorType || typ.Out(1).Kind() == reflect.Bool
 	default:
 		return false
 	}
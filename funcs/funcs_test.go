@@ -1,6 +1,10 @@
 package funcs
 
-import "testing"
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
 
 func TestCheckName(t *testing.T) {
 	type args struct {
@@ -28,3 +32,197 @@ func TestCheckName(t *testing.T) {
 		})
 	}
 }
+
+func TestFuncValuesCopyOnWrite(t *testing.T) {
+	one := func() int { return 1 }
+	base, err := CreateValuesFunc(FuncMap{"one": one})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := base
+	if err = v.Append(FuncMap{"two": func() int { return 2 }}); err != nil {
+		t.Fatal(err)
+	}
+	v.AppendValues(NewValues(FuncValues{{"three": NewFuncValue(one, nil)}}))
+	if err = v.Deprecate("one", "use two"); err != nil {
+		t.Fatal(err)
+	}
+	if base.Has("two") || base.Has("three") || base.Get("one").Deprecated() != "" {
+		t.Errorf("base changed: %v", base)
+	}
+	if !v.Has("two") || !v.Has("three") || v.Get("one").Deprecated() != "use two" {
+		t.Errorf("got %v", v)
+	}
+	if err = v.Append(FuncMap{"four": one, "bad": 1}); err == nil || v.Has("four") {
+		t.Errorf("got error %v, four set %v", err, v.Has("four"))
+	}
+
+	var a AtomicFuncValues
+	if a.Load() != nil {
+		t.Errorf("zero value holds %v", a.Load())
+	}
+	a.Store(base)
+	if err = a.Update(func(v *FuncValues) error { return v.Set("two", one) }); err != nil {
+		t.Fatal(err)
+	}
+	if a.Load().Get("two") == nil || base.Has("two") {
+		t.Errorf("got %v, base %v", a.Load(), base)
+	}
+}
+
+func TestFuncValuesPolicy(t *testing.T) {
+	one := func() int { return 1 }
+	two := func() int { return 2 }
+	v, _ := CreateValuesFunc(FuncMap{"a": one, "b": one})
+	if err := v.AppendWithPolicy(KeepFirst, FuncMap{"a": two, "c": two}); err != nil {
+		t.Fatal(err)
+	}
+	if v.Get("a").F().(func() int)() != 1 || v.Layer("c") != 1 {
+		t.Errorf("keep first: a from layer %d, c from layer %d", v.Layer("a"), v.Layer("c"))
+	}
+	if err := v.AppendWithPolicy(Override, FuncMap{"b": two}); err != nil {
+		t.Fatal(err)
+	}
+	if v.Get("b").F().(func() int)() != 2 || v.Layer("b") != 2 {
+		t.Errorf("override: b from layer %d", v.Layer("b"))
+	}
+	err := v.AppendWithPolicy(ErrorOnConflict, FuncMap{"d": two, "c": two})
+	if conflict, ok := err.(*ConflictError); !ok || conflict.Name != "c" || conflict.Layer != 1 || v.Has("d") {
+		t.Errorf("got error %v", err)
+	}
+	if got := v.Shadowings(); len(got) != 1 || got[0].Name != "b" || fmt.Sprint(got[0].Layers) != "[2 0]" {
+		t.Errorf("got shadowings %v", got)
+	}
+	old := v
+	if !v.Delete("b") || v.Has("b") || !old.Has("b") || v.Delete("b") {
+		t.Errorf("delete: got %v", v)
+	}
+}
+
+func TestLazyFuncMap(t *testing.T) {
+	var v FuncValues
+	v.AppendProvider(LazyFuncMap(FuncMap{"one": func() int { return 1 }, "bad": 1}))
+	v.Set("two", func() int { return 2 })
+	f := v.Get("one")
+	if f == nil || f != v.Get("one") {
+		t.Fatalf("got %v, then %v", f, v.Get("one"))
+	}
+	if v.Get("bad") != nil || v.Get("none") != nil || v.Layer("one") != 0 {
+		t.Errorf("got bad %v, none %v, layer %d", v.Get("bad"), v.Get("none"), v.Layer("one"))
+	}
+	if got := fmt.Sprint(v.Names()); got != "[bad one two]" {
+		t.Errorf("got names %s", got)
+	}
+}
+
+func TestBind(t *testing.T) {
+	join := func(sep string, a, b string, more ...string) string {
+		return fmt.Sprint(append([]string{a, b}, more...), sep)
+	}
+	fv := NewFuncValue(join, nil).Deprecate("old")
+	bound, err := fv.Bind("-", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, ok := bound.F().(func(string, ...string) string)
+	if !ok {
+		t.Fatalf("got %T", bound.F())
+	}
+	if got := f("y", "z"); got != "[x y z]-" {
+		t.Errorf("got %q", got)
+	}
+	more, err := fv.Bind("-", "x", "y", "z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := more.F().(func(...string) string)("w"); got != "[x y z w]-" {
+		t.Errorf("got %q", got)
+	}
+	if bound.Deprecated() != "old" {
+		t.Errorf("got deprecation %q", bound.Deprecated())
+	}
+	for _, args := range [][]interface{}{{"-", "a", "b", 1}, {1}, {nil}} {
+		if _, err := fv.Bind(args...); err == nil {
+			t.Errorf("%v: no error", args)
+		}
+	}
+	p, err := NewFuncValue(func(err error) bool { return err == nil }, nil).Bind(nil)
+	if err != nil || !p.F().(func() bool)() {
+		t.Errorf("nil interface: %v", err)
+	}
+}
+
+func TestFastFunc(t *testing.T) {
+	errBad := fmt.Errorf("bad")
+	for _, test := range []struct {
+		f    interface{}
+		args []interface{}
+	}{
+		{func(s string) string { return s + "!" }, []interface{}{"a"}},
+		{func(s string) (string, error) { return s, nil }, []interface{}{"a"}},
+		{func(s string) (string, error) { return "", errBad }, []interface{}{"a"}},
+		{func(s string) bool { return s == "a" }, []interface{}{"a"}},
+		{func(s string) int { return len(s) }, []interface{}{"abc"}},
+		{func(a, b string) string { return a + b }, []interface{}{"a", "b"}},
+		{func(a, b string) bool { return a < b }, []interface{}{"a", "b"}},
+		{func(a, b int) int { return a + b }, []interface{}{1, 2}},
+		{func(v interface{}) interface{} { return v }, []interface{}{nil}},
+		{func(v interface{}) interface{} { return v }, []interface{}{1}},
+		{func(v interface{}) (interface{}, error) { return nil, errBad }, []interface{}{1}},
+		{func(v interface{}) string { return fmt.Sprint(v) }, []interface{}{1}},
+		{func(v interface{}) bool { return v == nil }, []interface{}{nil}},
+		{func(v interface{}) int { return 1 }, []interface{}{"x"}},
+		{func(a, b interface{}) interface{} { return b }, []interface{}{1, "b"}},
+		{func(a, b interface{}) bool { return a == b }, []interface{}{1, 1}},
+		{fmt.Sprint, []interface{}{1, "a", nil}},
+	} {
+		fv := NewFuncValue(test.f, nil)
+		if fv.Fast() == nil {
+			t.Errorf("%T: no fast call", test.f)
+			continue
+		}
+		args := make([]reflect.Value, len(test.args))
+		for i, arg := range test.args {
+			want := fv.V().Type()
+			var typ reflect.Type
+			if want.IsVariadic() {
+				typ = want.In(0).Elem()
+			} else {
+				typ = want.In(i)
+			}
+			if arg == nil {
+				args[i] = reflect.Zero(typ)
+			} else {
+				args[i] = reflect.ValueOf(arg).Convert(typ)
+			}
+		}
+		got, want := fv.Fast()(args), fv.V().Call(args)
+		if len(got) != len(want) {
+			t.Fatalf("%T: got %d results, want %d", test.f, len(got), len(want))
+		}
+		for i := range got {
+			if got[i].Type() != want[i].Type() || !reflect.DeepEqual(got[i].Interface(), want[i].Interface()) {
+				t.Errorf("%T: result %d: got %v (%s), want %v (%s)", test.f, i, got[i], got[i].Type(), want[i], want[i].Type())
+			}
+		}
+	}
+	if NewFuncValue(func(a, b, c string) string { return a }, nil).Fast() != nil {
+		t.Error("fast call of an uncommon shape")
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	var values FuncValues
+	for i := 0; i < 20; i++ {
+		if err := values.Append(FuncMap{fmt.Sprint("f", i): fmt.Sprint}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if values.Get("f0") == nil {
+			b.Fatal("f0 not found")
+		}
+	}
+}
@@ -0,0 +1,636 @@
+package funcs
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/moisespsena-go/umbu/cast"
+)
+
+// sprigNative are the Sprig functions implemented by other packages. See
+// RegisterSprig.
+var sprigNative = FuncMap{}
+
+// RegisterSprig registers Sprig functions implemented by other packages,
+// replacing the ones of this package. The templates register their builtins
+// of the same names and arguments, as keys and pluck.
+func RegisterSprig(funcMap FuncMap) {
+	for name, f := range funcMap {
+		sprigNative[name] = f
+	}
+}
+
+// Sprig returns the functions of the widely known Sprig names, so the
+// templates written for Helm may be reused with minimal edits. The
+// functions have the Sprig arguments, the argument piped being the last
+// one, as in {{.Name | trunc 10 | quote}}, and, as in Sprig, the
+// conversions are lenient: a value which isn't a number converts to 0.
+//
+// Only the most used Sprig functions are available. The join, set and get
+// functions of the executions take precedence over these and accept the
+// Sprig arguments too.
+func Sprig() FuncValues {
+	funcMap := make(FuncMap, len(sprigFuncs)+len(sprigNative))
+	for name, f := range sprigFuncs {
+		funcMap[name] = f
+	}
+	for name, f := range sprigNative {
+		funcMap[name] = f
+	}
+	values, err := CreateValuesFunc(funcMap)
+	if err != nil {
+		panic(err)
+	}
+	return values
+}
+
+var sprigFuncs = FuncMap{
+	// Strings
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+	"title":      sprigTitle,
+	"trim":       strings.TrimSpace,
+	"trimAll":    func(cutset, s string) string { return strings.Trim(s, cutset) },
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"nospace":    sprigNospace,
+	"repeat":     func(count int, s string) string { return strings.Repeat(s, count) },
+	"substr":     sprigSubstr,
+	"trunc":      sprigTrunc,
+	"abbrev":     sprigAbbrev,
+	"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+	"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+	"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+	"replace":    func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+	"quote":      func(args ...interface{}) string { return sprigQuote(args, strconv.Quote) },
+	"squote":     func(args ...interface{}) string { return sprigQuote(args, sprigSingleQuote) },
+	"cat":        sprigCat,
+	"indent":     sprigIndent,
+	"nindent":    func(n int, s string) string { return "\n" + sprigIndent(n, s) },
+	"plural":     sprigPlural,
+	"split":      sprigSplit,
+	"splitList":  func(sep, s string) []string { return strings.Split(s, sep) },
+	"join":       sprigJoin,
+	"sortAlpha":  sprigSortAlpha,
+	"toString":   sprigString,
+	"toStrings":  sprigStrings,
+
+	// Conversions
+	"atoi":    func(s string) int { i, _ := strconv.Atoi(s); return i },
+	"int":     func(v interface{}) int { return int(sprigInt(v)) },
+	"int64":   sprigInt,
+	"float64": sprigFloat,
+
+	// Math
+	"add":   sprigAdd,
+	"add1":  func(a interface{}) int64 { return sprigInt(a) + 1 },
+	"sub":   func(a, b interface{}) int64 { return sprigInt(a) - sprigInt(b) },
+	"mul":   sprigMul,
+	"div":   sprigDiv,
+	"mod":   sprigMod,
+	"max":   sprigMax,
+	"min":   sprigMin,
+	"floor": func(a interface{}) float64 { return math.Floor(sprigFloat(a)) },
+	"ceil":  func(a interface{}) float64 { return math.Ceil(sprigFloat(a)) },
+	"round": sprigRound,
+
+	// Defaults
+	"default":  sprigDefault,
+	"empty":    sprigEmpty,
+	"coalesce": sprigCoalesce,
+	"ternary":  sprigTernary,
+	"fail":     func(msg string) (string, error) { return "", errors.New(msg) },
+
+	// Encoding
+	"b64enc":       func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	"b64dec":       sprigB64dec,
+	"sha1sum":      func(s string) string { sum := sha1.Sum([]byte(s)); return hex.EncodeToString(sum[:]) },
+	"sha256sum":    func(s string) string { sum := sha256.Sum256([]byte(s)); return hex.EncodeToString(sum[:]) },
+	"toJson":       sprigToJSON,
+	"toPrettyJson": sprigToPrettyJSON,
+	"fromJson":     sprigFromJSON,
+
+	// Lists
+	"list":    func(items ...interface{}) []interface{} { return items },
+	"first":   sprigFirst,
+	"last":    sprigLast,
+	"rest":    sprigRest,
+	"initial": sprigInitial,
+	"append":  func(list, v interface{}) ([]interface{}, error) { return sprigPush(list, v, false) },
+	"prepend": func(list, v interface{}) ([]interface{}, error) { return sprigPush(list, v, true) },
+	"concat":  sprigConcat,
+	"uniq":    sprigUniq,
+	"has":     sprigHas,
+	"without": sprigWithout,
+	"compact": sprigCompact,
+	"reverse": sprigReverse,
+	"chunk":   sprigChunk,
+
+	// Dicts
+	"dict":  sprigDict,
+	"get":   func(d map[string]interface{}, key string) interface{} { return d[key] },
+	"set":   sprigSet,
+	"unset": sprigUnset,
+	"merge": sprigMerge,
+
+	// Dates
+	"now":  time.Now,
+	"date": sprigDate,
+}
+
+func sprigTitle(s string) string {
+	prev := ' '
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(prev) {
+			prev = r
+			return unicode.ToTitle(r)
+		}
+		prev = r
+		return r
+	}, s)
+}
+
+func sprigNospace(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// sprigSubstr returns the bytes of s from start to end, end being the
+// length of s if negative.
+func sprigSubstr(start, end int, s string) string {
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 || end > len(s) {
+		end = len(s)
+	}
+	if start > end {
+		return ""
+	}
+	return s[start:end]
+}
+
+// sprigTrunc returns the first n bytes of s, or the last -n bytes if n is
+// negative.
+func sprigTrunc(n int, s string) string {
+	switch {
+	case n < 0 && len(s)+n > 0:
+		return s[len(s)+n:]
+	case n >= 0 && len(s) > n:
+		return s[:n]
+	}
+	return s
+}
+
+// sprigAbbrev truncates s to the width with ellipses.
+func sprigAbbrev(width int, s string) string {
+	if width < 4 || len(s) <= width {
+		return s
+	}
+	return s[:width-3] + "..."
+}
+
+func sprigQuote(args []interface{}, quote func(string) string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg != nil {
+			quoted = append(quoted, quote(sprigString(arg)))
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+func sprigSingleQuote(s string) string {
+	return "'" + s + "'"
+}
+
+func sprigCat(args ...interface{}) string {
+	parts := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg != nil {
+			parts = append(parts, sprigString(arg))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func sprigIndent(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	return pad + strings.Replace(s, "\n", "\n"+pad, -1)
+}
+
+func sprigPlural(one, many string, count int) string {
+	if count == 1 {
+		return one
+	}
+	return many
+}
+
+// sprigSplit splits s by sep in a map of the keys "_0", "_1"...
+func sprigSplit(sep, s string) map[string]string {
+	parts := strings.Split(s, sep)
+	result := make(map[string]string, len(parts))
+	for i, part := range parts {
+		result["_"+strconv.Itoa(i)] = part
+	}
+	return result
+}
+
+func sprigJoin(sep string, list interface{}) string {
+	return strings.Join(sprigStrings(list), sep)
+}
+
+func sprigSortAlpha(list interface{}) []string {
+	s := sprigStrings(list)
+	sort.Strings(s)
+	return s
+}
+
+func sprigString(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case []byte:
+		return string(t)
+	case error:
+		return t.Error()
+	case fmt.Stringer:
+		return t.String()
+	}
+	return fmt.Sprint(v)
+}
+
+// sprigStrings converts the items of the list, or the value, to strings.
+func sprigStrings(list interface{}) []string {
+	v := reflect.ValueOf(list)
+	switch v.Kind() {
+	case reflect.Array, reflect.Slice:
+		result := make([]string, v.Len())
+		for i := range result {
+			result[i] = sprigString(v.Index(i).Interface())
+		}
+		return result
+	case reflect.Invalid:
+		return []string{}
+	}
+	return []string{sprigString(list)}
+}
+
+func sprigInt(v interface{}) int64 {
+	if f, ok := v.(float64); ok {
+		return int64(f)
+	}
+	i, err := cast.ToInt(v)
+	if err != nil {
+		if f, err := cast.ToFloat(v); err == nil {
+			return int64(f)
+		}
+	}
+	return i
+}
+
+func sprigFloat(v interface{}) float64 {
+	f, _ := cast.ToFloat(v)
+	return f
+}
+
+func sprigFold(a interface{}, b []interface{}, f func(x, y int64) int64) int64 {
+	result := sprigInt(a)
+	for _, v := range b {
+		result = f(result, sprigInt(v))
+	}
+	return result
+}
+
+func sprigAdd(a interface{}, b ...interface{}) int64 {
+	return sprigFold(a, b, func(x, y int64) int64 { return x + y })
+}
+
+func sprigMul(a interface{}, b ...interface{}) int64 {
+	return sprigFold(a, b, func(x, y int64) int64 { return x * y })
+}
+
+func sprigMax(a interface{}, b ...interface{}) int64 {
+	return sprigFold(a, b, func(x, y int64) int64 {
+		if y > x {
+			return y
+		}
+		return x
+	})
+}
+
+func sprigMin(a interface{}, b ...interface{}) int64 {
+	return sprigFold(a, b, func(x, y int64) int64 {
+		if y < x {
+			return y
+		}
+		return x
+	})
+}
+
+func sprigDiv(a, b interface{}) (int64, error) {
+	d := sprigInt(b)
+	if d == 0 {
+		return 0, errors.New("div: division by zero")
+	}
+	return sprigInt(a) / d, nil
+}
+
+func sprigMod(a, b interface{}) (int64, error) {
+	d := sprigInt(b)
+	if d == 0 {
+		return 0, errors.New("mod: division by zero")
+	}
+	return sprigInt(a) % d, nil
+}
+
+// sprigRound rounds a half away from zero to the decimals.
+func sprigRound(a interface{}, decimals int) float64 {
+	pow := math.Pow10(decimals)
+	return math.Round(sprigFloat(a)*pow) / pow
+}
+
+// sprigEmpty reports whether v is nil or the zero value of its type.
+func sprigEmpty(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return true
+	}
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return rv.IsNil()
+	}
+	return rv.IsZero()
+}
+
+// sprigDefault returns the given value, or def if it's empty.
+func sprigDefault(def interface{}, given ...interface{}) interface{} {
+	if len(given) == 0 || sprigEmpty(given[0]) {
+		return def
+	}
+	return given[0]
+}
+
+func sprigCoalesce(values ...interface{}) interface{} {
+	for _, v := range values {
+		if !sprigEmpty(v) {
+			return v
+		}
+	}
+	return nil
+}
+
+func sprigTernary(ifTrue, ifFalse interface{}, cond bool) interface{} {
+	if cond {
+		return ifTrue
+	}
+	return ifFalse
+}
+
+func sprigB64dec(s string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	return string(b), err
+}
+
+func sprigToJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+func sprigToPrettyJSON(v interface{}) (string, error) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	return string(b), err
+}
+
+func sprigFromJSON(s string) (interface{}, error) {
+	var v interface{}
+	err := json.Unmarshal([]byte(s), &v)
+	return v, err
+}
+
+// sprigList returns the items of the list, an array or a slice.
+func sprigList(name string, list interface{}) ([]interface{}, error) {
+	v := reflect.ValueOf(list)
+	switch v.Kind() {
+	case reflect.Array, reflect.Slice:
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = v.Index(i).Interface()
+		}
+		return items, nil
+	case reflect.Invalid:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("%s: want a list, got %s", name, v.Type())
+}
+
+func sprigFirst(list interface{}) (interface{}, error) {
+	items, err := sprigList("first", list)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[0], nil
+}
+
+func sprigLast(list interface{}) (interface{}, error) {
+	items, err := sprigList("last", list)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[len(items)-1], nil
+}
+
+func sprigRest(list interface{}) ([]interface{}, error) {
+	items, err := sprigList("rest", list)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[1:], nil
+}
+
+func sprigInitial(list interface{}) ([]interface{}, error) {
+	items, err := sprigList("initial", list)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[:len(items)-1], nil
+}
+
+func sprigPush(list, v interface{}, front bool) ([]interface{}, error) {
+	items, err := sprigList("append", list)
+	if err != nil {
+		return nil, err
+	}
+	if front {
+		return append([]interface{}{v}, items...), nil
+	}
+	return append(items, v), nil
+}
+
+func sprigConcat(lists ...interface{}) ([]interface{}, error) {
+	var result []interface{}
+	for _, list := range lists {
+		items, err := sprigList("concat", list)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, items...)
+	}
+	return result, nil
+}
+
+func sprigUniq(list interface{}) ([]interface{}, error) {
+	items, err := sprigList("uniq", list)
+	if err != nil {
+		return nil, err
+	}
+	var result []interface{}
+	for _, item := range items {
+		if !sprigContains(result, item) {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+func sprigContains(items []interface{}, v interface{}) bool {
+	for _, item := range items {
+		if reflect.DeepEqual(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func sprigHas(needle, list interface{}) (bool, error) {
+	items, err := sprigList("has", list)
+	return sprigContains(items, needle), err
+}
+
+func sprigWithout(list interface{}, omit ...interface{}) ([]interface{}, error) {
+	items, err := sprigList("without", list)
+	if err != nil {
+		return nil, err
+	}
+	var result []interface{}
+	for _, item := range items {
+		if !sprigContains(omit, item) {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+func sprigCompact(list interface{}) ([]interface{}, error) {
+	items, err := sprigList("compact", list)
+	if err != nil {
+		return nil, err
+	}
+	var result []interface{}
+	for _, item := range items {
+		if !sprigEmpty(item) {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+func sprigReverse(list interface{}) ([]interface{}, error) {
+	items, err := sprigList("reverse", list)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]interface{}, len(items))
+	for i, item := range items {
+		result[len(items)-1-i] = item
+	}
+	return result, nil
+}
+
+func sprigChunk(size int, list interface{}) ([][]interface{}, error) {
+	if size < 1 {
+		return nil, fmt.Errorf("chunk: invalid size %d", size)
+	}
+	items, err := sprigList("chunk", list)
+	if err != nil {
+		return nil, err
+	}
+	var result [][]interface{}
+	for len(items) > size {
+		result = append(result, items[:size:size])
+		items = items[size:]
+	}
+	if len(items) > 0 {
+		result = append(result, items)
+	}
+	return result, nil
+}
+
+func sprigDict(pairs ...interface{}) map[string]interface{} {
+	d := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		var v interface{}
+		if i+1 < len(pairs) {
+			v = pairs[i+1]
+		}
+		d[sprigString(pairs[i])] = v
+	}
+	return d
+}
+
+func sprigSet(d map[string]interface{}, key string, v interface{}) map[string]interface{} {
+	d[key] = v
+	return d
+}
+
+func sprigUnset(d map[string]interface{}, key string) map[string]interface{} {
+	delete(d, key)
+	return d
+}
+
+// sprigMerge merges the keys of the sources missing in dst.
+func sprigMerge(dst map[string]interface{}, sources ...map[string]interface{}) map[string]interface{} {
+	for _, src := range sources {
+		for k, v := range src {
+			if _, ok := dst[k]; !ok {
+				dst[k] = v
+			}
+		}
+	}
+	return dst
+}
+
+// sprigDate formats the date, a time.Time or an Unix time, with the Go
+// layout.
+func sprigDate(layout string, date interface{}) string {
+	var t time.Time
+	switch d := date.(type) {
+	case time.Time:
+		t = d
+	case *time.Time:
+		if d != nil {
+			t = *d
+		}
+	default:
+		t = time.Unix(sprigInt(date), 0)
+	}
+	return t.Format(layout)
+}
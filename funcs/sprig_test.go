@@ -0,0 +1,63 @@
+package funcs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSprigFuncs(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"trunc", sprigTrunc(3, "hello"), "hel"},
+		{"trunc negative", sprigTrunc(-3, "hello"), "llo"},
+		{"substr", sprigSubstr(1, 3, "hello"), "el"},
+		{"abbrev", sprigAbbrev(5, "hello world"), "he..."},
+		{"title", sprigTitle("hello big world"), "Hello Big World"},
+		{"indent", sprigIndent(2, "a\nb"), "  a\n  b"},
+		{"split", sprigSplit(",", "a,b"), map[string]string{"_0": "a", "_1": "b"}},
+		{"join", sprigJoin("-", []int{1, 2}), "1-2"},
+		{"int", sprigInt("12"), int64(12)},
+		{"int float", sprigInt(2.9), int64(2)},
+		{"int invalid", sprigInt("x"), int64(0)},
+		{"add", sprigAdd(1, "2", 3.0), int64(6)},
+		{"max", sprigMax(1, 5, 3), int64(5)},
+		{"round", sprigRound(2.345, 2), 2.35},
+		{"default", sprigDefault("x", ""), "x"},
+		{"default given", sprigDefault("x", 0.5), 0.5},
+		{"empty", sprigEmpty(map[string]int{}), true},
+		{"coalesce", sprigCoalesce(nil, "", "a"), "a"},
+		{"ternary", sprigTernary("y", "n", false), "n"},
+		{"dict", sprigDict("a", 1, "b"), map[string]interface{}{"a": 1, "b": nil}},
+		{"merge", sprigMerge(map[string]interface{}{"a": 1}, map[string]interface{}{"a": 2, "b": 3}), map[string]interface{}{"a": 1, "b": 3}},
+	} {
+		if !reflect.DeepEqual(test.got, test.want) {
+			t.Errorf("%s: got %#v, want %#v", test.name, test.got, test.want)
+		}
+	}
+
+	uniq, _ := sprigUniq([]int{1, 2, 1, 3})
+	without, _ := sprigWithout(uniq, 2)
+	chunks, _ := sprigChunk(2, without)
+	if want := [][]interface{}{{1, 3}}; !reflect.DeepEqual(chunks, want) {
+		t.Errorf("got %v, want %v", chunks, want)
+	}
+	if _, err := sprigFirst(1); err == nil {
+		t.Error("first: expected error for a non list; got none")
+	}
+}
+
+func TestSprigNative(t *testing.T) {
+	defer func(native FuncMap) { sprigNative = native }(sprigNative)
+	sprigNative = FuncMap{}
+	RegisterSprig(FuncMap{"upper": func(s string) string { return "native" }})
+	f := Sprig().Get("upper")
+	if f == nil {
+		t.Fatal("upper not found")
+	}
+	if got := f.F().(func(string) string)("x"); got != "native" {
+		t.Errorf("got %q, want the native function", got)
+	}
+}
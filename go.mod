@@ -1,6 +1,6 @@
 module github.com/moisespsena-go/umbu
 
-go 1.20
+go 1.21
 
 require (
 	github.com/moisespsena-go/tracederror v0.0.1
@@ -7,6 +7,8 @@ import (
 
 type (
 	Executor        = template.Executor
+	Renderer        = template.Renderer
+	Signer          = template.Signer
 	DataFuncs       = funcs.DataFuncs
 	FuncMap         = funcs.FuncMap
 	FuncMapSlice    = funcs.FuncMapSlice
@@ -16,10 +18,29 @@ type (
 	State           = template.State
 	WalkHandler     = template.WalkHandler
 	RangeElemState  = template.RangeElemState
+	TemplateDoc     = template.TemplateDoc
+	ArgDoc          = template.ArgDoc
+	Schema          = template.Schema
+	Definition      = template.Definition
+	OrderedMap      = template.OrderedMap
+	Set             = template.Set
+	Group           = template.Group
+	GridPage        = template.GridPage
+	PrintMode       = template.PrintMode
+	EnvPolicy       = template.EnvPolicy
+	FetchPolicy     = template.FetchPolicy
+	Secrets         = template.Secrets
+	SecretsProvider = template.SecretsProvider
+	SecretsFunc     = template.SecretsFunc
 )
 
 var (
-	NewDataFuncs      = funcs.NewDataFuncs
-	RangeCallback     = template.RangeCallback
-	ExecutorOfRawData = template.ExecutorOfRawData
+	NewDataFuncs        = funcs.NewDataFuncs
+	RangeCallback       = template.RangeCallback
+	ExecutorOfRawData   = template.ExecutorOfRawData
+	RegisterGlobalFuncs = template.RegisterGlobalFuncs
+	NewOrderedMap       = template.NewOrderedMap
+	NewSet              = template.NewSet
+	NewSecrets          = template.NewSecrets
+	NewSigner           = template.NewSigner
 )
@@ -22,8 +22,11 @@ var builtinsFuncMap = funcs.FuncMap{
 	"_html_template_rcdataescaper":   rcdataEscaper,
 	"_html_template_urlescaper":      urlEscaper,
 	"_html_template_urlfilter":       urlFilter,
+	"_html_template_urlstrictfilter": urlStrictFilter,
+	"_html_template_urltyped":        urlTyped,
 	"_html_template_urlnormalizer":   urlNormalizer,
 	"_eval_args_":                    evalArgs,
+	renderFunc:                       renderHTML,
 
 	"safe_html": func(v string) HTML {
 		return HTML(v)
@@ -48,6 +51,9 @@ var (
 )
 
 func init() {
+	for _, name := range safeFuncs {
+		builtinsFuncMap[requestSafeFuncPrefix+name] = requestSafeFunc(name, builtinsFuncMap[name])
+	}
 	fcs, err := funcs.CreateValuesFunc(builtinsFuncMap)
 	if err != nil {
 		panic(err)
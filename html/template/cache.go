@@ -0,0 +1,87 @@
+package template
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/moisespsena-go/umbu/text/template"
+)
+
+// cachedExecutor is the executor of a template parsed from a file, reused
+// while the file is unchanged, or of a template warmed up by WarmUp, reused
+// until the template changes.
+type cachedExecutor struct {
+	fingerprint string // empty if the template isn't parsed from a file.
+	executor    *template.Executor
+}
+
+// fingerprint returns the fingerprint of the content of the file.
+func fingerprint(path string, content []byte) string {
+	sum := sha256.Sum256(content)
+	return path + ":" + hex.EncodeToString(sum[:])
+}
+
+// parsedFile reports whether the template named name was parsed from the
+// file with the fingerprint. The caller must hold ns.mu.
+func (ns *nameSpace) parsedFile(name, fingerprint string) bool {
+	return fingerprint != "" && ns.files[name] == fingerprint
+}
+
+// setFile records the fingerprint of the file of the template named name.
+// The caller must hold ns.mu.
+func (ns *nameSpace) setFile(name, fingerprint string) {
+	if ns.files == nil {
+		ns.files = make(map[string]string)
+	}
+	ns.files[name] = fingerprint
+	delete(ns.executors, name)
+}
+
+// forget forgets the file and the executor of the template named name,
+// after it is redefined. The caller must hold ns.mu.
+func (ns *nameSpace) forget(name string) {
+	delete(ns.files, name)
+	delete(ns.executors, name)
+}
+
+// cachedExecutor returns a copy of the cached executor of t, creating it if
+// t was parsed from a file, and whether it is cached.
+func (t *Template) cachedExecutor() (*template.Executor, bool) {
+	ns := t.nameSpace
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	name := t.Name()
+	if ns.set[name] != t {
+		return nil, false
+	}
+	fp := ns.files[name]
+	if cached, ok := ns.executors[name]; ok && cached.fingerprint == fp {
+		return cached.executor.Clone(), true
+	}
+	if fp == "" {
+		return nil, false
+	}
+	executor := t.newExecutor()
+	ns.setExecutor(name, cachedExecutor{fp, executor})
+	return executor.Clone(), true
+}
+
+// setExecutor caches the executor of the template named name. The caller
+// must hold ns.mu.
+func (ns *nameSpace) setExecutor(name string, cached cachedExecutor) {
+	if ns.executors == nil {
+		ns.executors = make(map[string]cachedExecutor)
+	}
+	ns.executors[name] = cached
+}
+
+// resetExecutor removes the cached executor of t, after its functions
+// change.
+func (t *Template) resetExecutor() {
+	if t.nameSpace == nil {
+		return
+	}
+	t.nameSpace.mu.Lock()
+	delete(t.nameSpace.executors, t.Name())
+	t.nameSpace.mu.Unlock()
+}
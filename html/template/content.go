@@ -90,6 +90,10 @@ func stringify(args ...interface{}) (string, contentType) {
 			return string(s), contentTypeJSStr
 		case URL:
 			return string(s), contentTypeURL
+		default:
+			if s, t, ok := safeContentOf(s); ok {
+				return s, t
+			}
 		}
 	}
 	for i, arg := range args {
@@ -44,7 +44,7 @@ func (c context) eq(d context) bool {
 // from template names mangled with different contexts.
 func (c context) mangle(templateName string) string {
 	// The mangled name for the default context is the input templateName.
-	if c.state == stateText {
+	if c.state == stateText && c.element == elementNone {
 		return templateName
 	}
 	s := templateName + "$htmltemplate_" + c.state.String()
@@ -294,14 +294,24 @@ const (
 	elementTextarea
 	// elementTitle corresponds to the RCDATA <title> element.
 	elementTitle
+	// elementSVG corresponds to the start tag of an SVG element, whose
+	// attributes are typed by the SVG rules, see svgAttrType, and to the
+	// body of an <svg> element, where the elements are SVG.
+	elementSVG
+	// elementSVGNoHref corresponds to the start tag of an SVG element
+	// animating an attribute other than an href, whose animation values
+	// aren't URLs.
+	elementSVGNoHref
 )
 
 var elementNames = [...]string{
-	elementNone:     "elementNone",
-	elementScript:   "elementScript",
-	elementStyle:    "elementStyle",
-	elementTextarea: "elementTextarea",
-	elementTitle:    "elementTitle",
+	elementNone:      "elementNone",
+	elementScript:    "elementScript",
+	elementStyle:     "elementStyle",
+	elementTextarea:  "elementTextarea",
+	elementTitle:     "elementTitle",
+	elementSVG:       "elementSVG",
+	elementSVGNoHref: "elementSVGNoHref",
 }
 
 func (e element) String() string {
@@ -0,0 +1,82 @@
+package template
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/moisespsena-go/umbu/text/template/parse"
+)
+
+var (
+	safeActionsMu sync.RWMutex
+	safeActions   = map[string]ContentKind{}
+)
+
+// RegisterSafeAction declares the output of the walker of the custom action
+// keyword, registered by template.RegisterAction, as trusted content of
+// kind. The output isn't escaped, so the actions of the keyword are allowed
+// only in the context of the content of kind: HTML text for ContentHTML, a
+// style element for ContentCSS, a script for ContentJS, a quoted JavaScript
+// string for ContentJSStr, the attributes of a tag for ContentHTMLAttr and
+// the start of a quoted URL attribute for ContentURL. The body of the action
+// is escaped as the one of a {{with}}.
+//
+// The actions of the keywords not declared fail the escaping. It panics if
+// kind is invalid. It is intended to be called at initialization, after
+// template.RegisterAction.
+func RegisterSafeAction(keyword string, kind ContentKind) {
+	if kind.contentType() == contentTypePlain {
+		panic(fmt.Errorf("html/template: invalid content kind %d", kind))
+	}
+	safeActionsMu.Lock()
+	defer safeActionsMu.Unlock()
+	safeActions[keyword] = kind
+}
+
+// safeActionContext reports whether the output of the actions of the keyword
+// is trusted in the context c.
+func safeActionContext(keyword string, c context) (kind ContentKind, ok bool) {
+	safeActionsMu.RLock()
+	kind, declared := safeActions[keyword]
+	safeActionsMu.RUnlock()
+	if !declared {
+		return 0, false
+	}
+	switch kind {
+	case ContentHTML:
+		return kind, c.state == stateText
+	case ContentCSS:
+		return kind, c.state == stateCSS
+	case ContentJS:
+		return kind, c.state == stateJS
+	case ContentJSStr:
+		return kind, c.state == stateJSDqStr || c.state == stateJSSqStr
+	case ContentHTMLAttr:
+		return kind, c.state == stateAttrName
+	case ContentURL:
+		return kind, c.state == stateURL && c.urlPart == urlPartNone && c.delim != delimSpaceOrTagEnd
+	}
+	return kind, false
+}
+
+// escapeCustom escapes the action of a custom keyword, whose output must be
+// declared by RegisterSafeAction as trusted in the context of the action.
+func (e *escaper) escapeCustom(c context, n *parse.CustomNode) context {
+	c = nudge(c)
+	if c.state == stateError {
+		return c
+	}
+	kind, ok := safeActionContext(n.Keyword, c)
+	if !ok {
+		return context{
+			state: stateError,
+			err: errorf(ErrCustomAction, n, n.Line, "output of the action %s can't be escaped in the %s context, see RegisterSafeAction",
+				n.Keyword, c.state),
+		}
+	}
+	if kind == ContentJS {
+		// A slash after a value starts a div operator.
+		c.jsCtx = jsCtxDivOp
+	}
+	return join(e.escapeList(c, n.List), e.escapeList(c, n.ElseList), n, n.Keyword)
+}
@@ -215,6 +215,62 @@ const (
 	//   pipeline occurs in an unquoted attribute value context, "html" is
 	//   disallowed. Avoid using "html" and "urlquery" entirely in new templates.
 	ErrPredefinedEscaper
+
+	// ErrPolicy: "function ... forbidden by the escape policy"
+	// Example:
+	//   {{.Bio | safe_html}}
+	// Discussion:
+	//   The escape policy set by Template.SetEscapePolicy forbids the
+	//   functions marking content as safe without checking it. Build the
+	//   typed contents (HTML, JS, ...) in Go code, where they can be
+	//   reviewed, instead. Any escape policy also forbids the pragma
+	//   "umbu:option autoescape=false".
+	ErrPolicy
+
+	// ErrSafeRequestData: "function ... on the request data ..."
+	// Example:
+	//   {{.Query.q | safe_html}}
+	// Discussion:
+	//   A function marking content as safe is called on a value derived
+	//   from the request data of the escape policy, so the request may
+	//   inject markup or scripts into the page. It is a warning reported by
+	//   Template.Lint, unless the policy forbids it. Let the contextual
+	//   autoescaper escape the value instead.
+	ErrSafeRequestData
+
+	// ErrUnescaped: "pragma autoescape=false not allowed ..."
+	// Example:
+	//   {{/* umbu:option autoescape=false */}}{{.Body}}
+	// Discussion:
+	//   The pragma disables the contextual escaping of the template, so the
+	//   authors of the templates could inject any markup or script. It is
+	//   honored only in the templates associated with a template calling
+	//   Template.AllowUnescaped, by the embedder trusting their authors.
+	ErrUnescaped
+
+	// ErrInvoke: "yield appears in the ... context, not in HTML text"
+	// Examples:
+	//   <script>var card = {{yield "card" .}}</script>
+	//   {{if .}}{{yield "card" .}}{{end}}{{$x := yield "card" .}}
+	// Discussion:
+	//   The yield builtin writes the output of a template as is, so it is
+	//   escaped only as the only command of an action in HTML text, where
+	//   the template is escaped as by {{template}}. The templates rendered
+	//   by render are escaped in HTML text, and its result is HTML. The
+	//   deprecated builtins tpl_yield, tpl_render and template_exec can't
+	//   be escaped.
+	ErrInvoke
+
+	// ErrCustomAction: "output of the action ... can't be escaped ..."
+	// Example:
+	//   <script>var icon = {{svg "logo"}}</script>
+	// Discussion:
+	//   The walker of a custom action keyword, registered by
+	//   template.RegisterAction, writes its output as is, so the output
+	//   must be declared as trusted content of a kind by
+	//   RegisterSafeAction, and the action used in the context of the
+	//   kind, as HTML text for ContentHTML.
+	ErrCustomAction
 )
 
 func (e *Error) Error() string {
@@ -62,6 +62,12 @@ type escaper struct {
 	actionNodeEdits   map[*parse.ActionNode][]string
 	templateNodeEdits map[*parse.TemplateNode]string
 	textNodeEdits     map[*parse.TextNode][]byte
+	identNodeEdits    map[*parse.IdentifierNode]string
+	// actionNodeSources holds the template and the context of the edited
+	// actions, for the escape report.
+	actionNodeSources map[*parse.ActionNode]actionSource
+	// current is the name of the template being escaped.
+	current string
 }
 
 // makeEscaper creates a blank escaper for the given set.
@@ -74,6 +80,9 @@ func makeEscaper(n *nameSpace) escaper {
 		map[*parse.ActionNode][]string{},
 		map[*parse.TemplateNode]string{},
 		map[*parse.TextNode][]byte{},
+		map[*parse.IdentifierNode]string{},
+		map[*parse.ActionNode]actionSource{},
+		"",
 	}
 }
 
@@ -89,6 +98,8 @@ func (e *escaper) escape(c context, n parse.Node) context {
 	switch n := n.(type) {
 	case *parse.ActionNode:
 		return e.escapeAction(c, n)
+	case *parse.CommentNode:
+		return c
 	case *parse.IfNode:
 		return e.escapeBranch(c, &n.BranchNode, "if")
 	case *parse.ListNode:
@@ -101,12 +112,20 @@ func (e *escaper) escape(c context, n parse.Node) context {
 		return e.escapeText(c, n)
 	case *parse.WithNode:
 		return e.escapeBranch(c, &n.BranchNode, "with")
+	case *parse.CustomNode:
+		return e.escapeCustom(c, n)
+	case *parse.ReturnNode:
+		// The value returned isn't output.
+		return c
 	}
 	panic("escaping " + n.String() + " is unimplemented")
 }
 
 // escapeAction escapes an action template node.
 func (e *escaper) escapeAction(c context, n *parse.ActionNode) context {
+	if isYield(n) {
+		return e.escapeYield(c, n)
+	}
 	if len(n.Pipe.Decl) != 0 {
 		// A local variable assignment, not an interpolation.
 		return c
@@ -143,7 +162,7 @@ func (e *escaper) escapeAction(c context, n *parse.ActionNode) context {
 	case stateURL, stateCSSDqStr, stateCSSSqStr, stateCSSDqURL, stateCSSSqURL, stateCSSURL:
 		switch c.urlPart {
 		case urlPartNone:
-			s = append(s, "_html_template_urlfilter")
+			s = append(s, e.urlFilter())
 			fallthrough
 		case urlPartPreQuery:
 			switch c.state {
@@ -197,6 +216,7 @@ func (e *escaper) escapeAction(c context, n *parse.ActionNode) context {
 		s = append(s, "_html_template_attrescaper")
 	}
 	e.editActionNode(n, s)
+	e.actionNodeSources[n] = actionSource{e.current, c}
 	return c
 }
 
@@ -464,6 +484,7 @@ func (e *escaper) escapeList(c context, n *parse.ListNode) context {
 // which is the same as whether e was updated.
 func (e *escaper) escapeListConditionally(c context, n *parse.ListNode, filter func(*escaper, context) bool) (context, bool) {
 	e1 := makeEscaper(e.ns)
+	e1.current = e.current
 	// Make type inferences available to f.
 	for k, v := range e.output {
 		e1.output[k] = v
@@ -484,18 +505,31 @@ func (e *escaper) escapeListConditionally(c context, n *parse.ListNode, filter f
 		for k, v := range e1.actionNodeEdits {
 			e.editActionNode(k, v)
 		}
+		for k, v := range e1.actionNodeSources {
+			e.actionNodeSources[k] = v
+		}
 		for k, v := range e1.templateNodeEdits {
 			e.editTemplateNode(k, v)
 		}
 		for k, v := range e1.textNodeEdits {
 			e.editTextNode(k, v)
 		}
+		for k, v := range e1.identNodeEdits {
+			e.identNodeEdits[k] = v
+		}
 	}
 	return c, ok
 }
 
 // escapeTemplate escapes a {{template}} call node.
 func (e *escaper) escapeTemplate(c context, n *parse.TemplateNode) context {
+	if n.NameNode != nil {
+		// The output context of the called template can't be known.
+		return context{
+			state: stateError,
+			err:   errorf(ErrNoSuchTemplate, n, n.Line, "dynamic template name %s can't be escaped", n.NameNode),
+		}
+	}
 	c, name := e.escapeTree(c, n, n.Name, n.Line)
 	if name != n.Name {
 		e.editTemplateNode(n, name)
@@ -568,6 +602,25 @@ func (e *escaper) computeOutCtx(c context, t *template.Template) context {
 // context, and returns the best guess at the output context and whether the
 // assumption was correct.
 func (e *escaper) escapeTemplateBody(c context, t *template.Template) (context, bool) {
+	if err := e.checkPolicy(t.Tree.Root); err != nil {
+		return context{state: stateError, err: err}, true
+	}
+	if err := e.escapeInvokes(t.Tree.Root); err != nil {
+		return context{state: stateError, err: err}, true
+	}
+	if autoescape, _ := t.Tree.Option("autoescape"); autoescape == "false" {
+		// The "umbu:option autoescape=false" pragma leaves the body as is,
+		// if allowed by the embedder and unless an escape policy is set.
+		if e.ns != nil && e.ns.policy.isSet() {
+			return context{state: stateError, err: errorf(ErrPolicy, t.Tree.Root, 0,
+				"%s: pragma autoescape=false forbidden by the escape policy", t.Name())}, true
+		}
+		if e.ns == nil || !e.ns.unescaped {
+			return context{state: stateError, err: errorf(ErrUnescaped, t.Tree.Root, 0,
+				"%s: pragma autoescape=false not allowed, see Template.AllowUnescaped", t.Name())}, true
+		}
+		return c, true
+	}
 	filter := func(e1 *escaper, c1 context) bool {
 		if c1.state == stateError {
 			// Do not update the input escaper, e.
@@ -586,6 +639,8 @@ func (e *escaper) escapeTemplateBody(c context, t *template.Template) (context,
 	// Naively assuming that the input context is the same as the output
 	// works >90% of the time.
 	e.output[t.Name()] = c
+	defer func(current string) { e.current = current }(e.current)
+	e.current = t.Name()
 	return e.escapeListConditionally(c, t.Tree.Root, filter)
 }
 
@@ -752,6 +807,11 @@ func (e *escaper) editTemplateNode(n *parse.TemplateNode, callee string) {
 	e.templateNodeEdits[n] = callee
 }
 
+// editIdentNode records a change to an identifier node for later commit.
+func (e *escaper) editIdentNode(n *parse.IdentifierNode, ident string) {
+	e.identNodeEdits[n] = ident
+}
+
 // editTextNode records a change to a text node for later commit.
 func (e *escaper) editTextNode(n *parse.TextNode, text []byte) {
 	if _, ok := e.textNodeEdits[n]; ok {
@@ -775,6 +835,7 @@ func (e *escaper) commit() {
 		}
 	}
 	for n, s := range e.actionNodeEdits {
+		e.report(n, s)
 		ensurePipelineContains(n.Pipe, s)
 	}
 	for n, name := range e.templateNodeEdits {
@@ -783,12 +844,17 @@ func (e *escaper) commit() {
 	for n, s := range e.textNodeEdits {
 		n.Text = s
 	}
+	for n, s := range e.identNodeEdits {
+		n.Ident = s
+	}
 	// Reset state that is specific to this commit so that the same changes are
 	// not re-applied to the template on subsequent calls to commit.
 	e.called = make(map[string]bool)
 	e.actionNodeEdits = make(map[*parse.ActionNode][]string)
+	e.actionNodeSources = make(map[*parse.ActionNode]actionSource)
 	e.templateNodeEdits = make(map[*parse.TemplateNode]string)
 	e.textNodeEdits = make(map[*parse.TextNode][]byte)
+	e.identNodeEdits = make(map[*parse.IdentifierNode]string)
 }
 
 // template returns the named template given a mangled template name.
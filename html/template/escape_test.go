@@ -8,10 +8,17 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"reflect"
+	"sort"
 	"strings"
 	"testing"
+	"testing/fstest"
 
+	"github.com/moisespsena-go/umbu/funcs"
+	"github.com/moisespsena-go/umbu/qrcode"
 	"github.com/moisespsena-go/umbu/text/template"
 	"github.com/moisespsena-go/umbu/text/template/parse"
 )
@@ -1891,3 +1898,581 @@ func BenchmarkEscapedExecute(b *testing.B) {
 		buf.Reset()
 	}
 }
+
+func BenchmarkEscapedRange(b *testing.B) {
+	tmpl := Must(New("t").Parse(`<ul>{{range .}}<li title="{{.}}"><a href="/?q={{.}}">{{.}}</a></li>{{end}}</ul>`))
+	rows := make([]string, 100)
+	for i := range rows {
+		rows[i] = fmt.Sprintf("<row %d> & 'q'", i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := tmpl.Execute(io.Discard, rows); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestPragmaAutoescape(t *testing.T) {
+	const src = `{{.}}{{template "raw" .}}{{define "raw"}}{{/* umbu:option autoescape=false */}}{{.}}{{end}}`
+	err := Must(New("page").Parse(src)).Execute(&bytes.Buffer{}, "<b>")
+	if err == nil || !strings.Contains(err.Error(), "pragma autoescape=false not allowed") {
+		t.Errorf("got error %v, want the pragma not allowed", err)
+	}
+	tmpl := Must(New("page").Parse(src)).AllowUnescaped(true)
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, "<b>"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "&lt;b&gt;<b>"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestEscapeDynamicTemplateName(t *testing.T) {
+	tmpl := Must(New("page").Parse(`{{template .Name .}}`))
+	err := tmpl.Execute(&bytes.Buffer{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "dynamic template name .Name can't be escaped") {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestEscapeInvokes(t *testing.T) {
+	const card = `{{define "card"}}<b title="{{.}}">{{.}}</b>{{end}}`
+	tests := []struct {
+		src, out, err string
+	}{
+		{`{{yield "card" .}}`, `<b title="&lt;i&gt;">&lt;i&gt;</b>`, ""},
+		{`{{$c := render "card" .}}<p>{{$c}}</p>`, `<p><b title="&lt;i&gt;">&lt;i&gt;</b></p>`, ""},
+		{`<script>var c = {{render "card" .}};</script>`, `<script>var c = "\u003cb title=\"\u0026lt;i\u0026gt;\"\u003e\u0026lt;i\u0026gt;\u003c/b\u003e";</script>`, ""},
+		{`{{$c := template "card" .}}<p>{{$c}}</p>`, `<p><b title="&lt;i&gt;">&lt;i&gt;</b></p>`, ""},
+		{`{{$v := template "value" .}}<p>{{$v}}</p>{{define "value"}}<b>{{return .}}{{end}}`, `<p>&lt;i&gt;</p>`, ""},
+		{`{{$c := template .}}`, "", `dynamic template name . can't be escaped`},
+		{`<script>{{yield "card" .}}</script>`, "", `appears in the stateJS context, not in HTML text`},
+		{`{{$x := yield "card" .}}`, "", `yield can't be escaped unless the only command of its action`},
+		{`{{yield .}}`, "", `dynamic template name . can't be escaped`},
+		{`{{render (print "card") .}}`, "", `dynamic template name print "card" can't be escaped`},
+		{`{{tpl_yield "card" .}}`, "", `tpl_yield can't be escaped, use yield`},
+		{`{{template_exec "card" .}}`, "", `template_exec can't be escaped, use render`},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		err := Must(New("page").Parse(test.src+card)).Execute(&buf, "<i>")
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want %q", test.src, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+		} else if buf.String() != test.out {
+			t.Errorf("%s: got %q, want %q", test.src, buf.String(), test.out)
+		}
+	}
+}
+
+func TestEscapeCustomAction(t *testing.T) {
+	icon := func(s *template.State, dot reflect.Value, n *parse.CustomNode) {
+		io.WriteString(s.Writer(), `<svg id="logo"></svg>`)
+	}
+	template.RegisterAction(parse.Keyword{Name: "testsafeicon"}, icon)
+	template.RegisterAction(parse.Keyword{Name: "testrawicon"}, icon)
+	RegisterSafeAction("testsafeicon", ContentHTML)
+	tests := []struct {
+		src, out, err string
+	}{
+		{`<p>{{testsafeicon}}{{.}}</p>`, `<p><svg id="logo"></svg>&lt;i&gt;</p>`, ""},
+		{`<script>var icon = {{testsafeicon}}</script>`, "", `output of the action testsafeicon can't be escaped in the stateJS context`},
+		{`<p>{{testrawicon}}</p>`, "", `output of the action testrawicon can't be escaped in the stateText context`},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		err := Must(New("page").Parse(test.src)).Execute(&buf, "<i>")
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want %q", test.src, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+		} else if buf.String() != test.out {
+			t.Errorf("%s: got %q, want %q", test.src, buf.String(), test.out)
+		}
+	}
+}
+
+func TestTextHooks(t *testing.T) {
+	const header = `{{define "header"}}<h1>{{.}}</h1>{{end}}`
+	tests := []struct {
+		src, out string
+	}{
+		{`@header<p>@@home</p>`, `<h1>&lt;x&gt;</h1><p>@home</p>`},
+		{`<style>@media print { p { color: red } }</style>@header`, `<style>@media print { p { color: red } }</style><h1>&lt;x&gt;</h1>`},
+		{`<style>p { color: {{"red"}} } @import url(a.css);</style>`, `<style>p { color: red } @import url(a.css);</style>`},
+		{`<script>var at = "@header";</script>`, `<script>var at = "@header";</script>`},
+		{`<p style="@header" onclick="f('@header')">@header</p>`, `<p style="@header" onclick="f('@header')"><h1>&lt;x&gt;</h1></p>`},
+	}
+	for _, test := range tests {
+		tmpl, err := New("page").TextHooks(parse.TemplateShorthand()).Parse(test.src + header)
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+			continue
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, "<x>"); err != nil {
+			t.Errorf("%s: %v", test.src, err)
+		} else if buf.String() != test.out {
+			t.Errorf("%s: got %q, want %q", test.src, buf.String(), test.out)
+		}
+	}
+}
+
+func TestWarmUp(t *testing.T) {
+	tmpl := Must(New("page").Parse(`<a href="{{.}}">{{template "label" .}}</a>{{define "label"}}{{.}}{{end}}`))
+	if err := tmpl.WarmUp(2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tmpl.Parse(`x`); err == nil {
+		t.Error("parsed after warm up")
+	}
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, "label", "<b>"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "&lt;b&gt;"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+	// The executors are cached until the templates change.
+	if _, ok := tmpl.Lookup("label").cachedExecutor(); !ok {
+		t.Error("executor not cached")
+	}
+	tmpl.Funcs(FuncMap{"f": strings.ToUpper})
+	if _, ok := tmpl.cachedExecutor(); ok {
+		t.Error("executor cached after Funcs")
+	}
+
+	bad := Must(New("bad").Parse(`<a href="{{if .}}x{{else}}"{{end}}">`))
+	if err := bad.WarmUp(0); err == nil || !strings.Contains(err.Error(), "{{if}} branches end in different contexts") {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestEscapeReport(t *testing.T) {
+	tmpl := Must(New("page").Parse(`<a href="/u?q={{.Q}}" onclick="f({{.F}})">{{.Name}}</a>` +
+		`{{template "style" .}}{{define "style"}}<p style="color: {{.Color}}">{{end}}`))
+	report, err := tmpl.EscapeReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range report {
+		got = append(got, fmt.Sprintf("%s %s %s %s %s %v", d.Template, d.Location, d.Action, d.Context, d.Attr, d.Escapers))
+	}
+	want := []string{
+		"page 'page':1:16 {{.Q}} URL URL [urlescaper attrescaper]",
+		"page 'page':1:35 {{.F}} JS Script [jsvalescaper attrescaper]",
+		"page 'page':1:44 {{.Name}} Text  [htmlescaper]",
+		"style 'page':1:114 {{.Color}} CSS Style [cssvaluefilter attrescaper]",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if js := report.InContext("JS", "JSDqStr"); len(js) != 1 || js[0].Action != "{{.F}}" {
+		t.Errorf("InContext: got %v", js)
+	}
+}
+
+func TestEscapePolicy(t *testing.T) {
+	tests := []struct {
+		policy EscapePolicy
+		src    string
+		data   interface{}
+		out    string
+		err    string
+	}{
+		{EscapePolicy{}, `<a href="{{.}}">{{safe_html "<b>"}}</a>`, "javascript:x", `<a href="#ZgotmplZ"><b></a>`, ""},
+		{EscapePolicy{ForbidSafeFuncs: true}, `{{if .}}{{safe_html "<b>"}}{{end}}`, true, "",
+			`function "safe_html" forbidden by the escape policy`},
+		{EscapePolicy{ForbiddenFuncs: []string{"printf"}}, `{{printf "%d" 1}}`, nil, "",
+			`function "printf" forbidden by the escape policy`},
+		{EscapePolicy{RejectUnsafeURLs: true}, `<a href="{{.}}">`, "javascript:x", "",
+			`unsafe URL "javascript:x" forbidden by the escape policy`},
+		{EscapePolicy{RejectUnsafeURLs: true}, `<a href="{{.}}">`, "/x?a=1", `<a href="/x?a=1">`, ""},
+		{EscapePolicy{TypedURLs: true}, `<a href="{{.}}">`, "/x", "",
+			`untyped value "/x" in URL forbidden by the escape policy`},
+		{EscapePolicy{TypedURLs: true}, `<a href="{{.}}?q={{.}}">`, URL("/x"), `<a href="/x?q=/x">`, ""},
+		{EscapePolicy{ForbidSafeFuncs: true}, `{{/* umbu:option autoescape=false */}}{{safe_html .}}`, "<b>", "",
+			`function "safe_html" forbidden by the escape policy`},
+		{EscapePolicy{RejectUnsafeURLs: true}, `{{/* umbu:option autoescape=false */}}{{.}}`, "<b>", "",
+			`pragma autoescape=false forbidden by the escape policy`},
+	}
+	for _, test := range tests {
+		tmpl := Must(New("x").Parse(test.src)).SetEscapePolicy(test.policy)
+		var buf bytes.Buffer
+		err := tmpl.Execute(&buf, test.data)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want %q", test.src, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+		} else if buf.String() != test.out {
+			t.Errorf("%s: got %q, want %q", test.src, buf.String(), test.out)
+		}
+	}
+}
+
+func TestSafeRequestData(t *testing.T) {
+	src := `{{.Query.q | safe_html}}{{safe_html .Title}}{{$c := .Form.c}}<p style="{{safe_css $c}}">` +
+		`{{with .Query}}{{safe_html .n}}{{end}}{{range .Items}}{{safe_html $.Query.s}}{{safe_html .}}{{end}}` +
+		`{{safe_html (printf "<i>%s</i>" .Query.p)}}`
+	policy := EscapePolicy{RequestData: []string{".Query", "Form"}}
+	tmpl := Must(New("page").Parse(src)).SetEscapePolicy(policy)
+	warnings, err := tmpl.Lint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, w := range warnings {
+		if w.ErrorCode != ErrSafeRequestData {
+			t.Errorf("%v: got code %v", w, w.ErrorCode)
+		}
+		got = append(got, w.Description)
+	}
+	want := []string{
+		`function "safe_html" on the request data .Query.q`,
+		`function "safe_css" on the request data $c`,
+		`function "safe_html" on the request data .n`,
+		`function "safe_html" on the request data .Query.s`,
+		`function "safe_html" on the request data .Query.p`,
+	}
+	sort.Strings(got)
+	sort.Strings(want)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	report, err := tmpl.EscapeReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report[0].Action != "{{.Query.q | safe_html}}" {
+		t.Errorf("got action %s", report[0].Action)
+	}
+
+	var log bytes.Buffer
+	data := map[string]interface{}{
+		"Query": map[string]string{"q": "<b>", "n": "<u>", "s": "s", "p": "p"},
+		"Form":  map[string]string{"c": "color:red"},
+		"Title": "<em>",
+		"Items": []string{"<br>"},
+	}
+	out, err := tmpl.CreateExecutor().SetLogger(slog.New(slog.NewTextHandler(&log, nil))).ExecuteString(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<b><em><p style="color:red"><u>s<br><i>p</i>`; out != want {
+		t.Errorf("got %s, want %s", out, want)
+	}
+	if n := strings.Count(log.String(), "safe function on request data"); n != 5 {
+		t.Errorf("got %d warnings:\n%s", n, log.String())
+	}
+
+	policy.ForbidSafeRequestData = true
+	tmpl = Must(New("page").Parse(src)).SetEscapePolicy(policy)
+	if err = tmpl.Execute(&bytes.Buffer{}, data); err == nil || !strings.Contains(err.Error(), `function "safe_html" on the request data .Query.q`) {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestParseFSCache(t *testing.T) {
+	fsys := fstest.MapFS{
+		"page.html":   {Data: []byte(`<p>{{.}}</p>{{template "footer.html"}}`)},
+		"footer.html": {Data: []byte(`<footer>{{year}}</footer>`)},
+	}
+	tmpl := New("page.html").Funcs(funcs.FuncMap{"year": func() int { return 2024 }})
+	if _, err := tmpl.ParseFS(fsys, "*.html"); err != nil {
+		t.Fatal(err)
+	}
+	if path := tmpl.Lookup("footer.html").text.Path; path != "footer.html" {
+		t.Errorf("got path %q, want %q", path, "footer.html")
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, "<x>"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "<p>&lt;x&gt;</p><footer>2024</footer>"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+	if first, second := tmpl.CreateExecutor(), tmpl.CreateExecutor(); first == second {
+		t.Error("the cached executor isn't cloned")
+	}
+
+	// The unchanged files aren't parsed again, after the execution too.
+	if _, err := tmpl.ParseFS(fsys, "*.html"); err != nil {
+		t.Errorf("reparsing unchanged files: %v", err)
+	}
+	fsys["footer.html"] = &fstest.MapFile{Data: []byte(`<footer>changed</footer>`)}
+	if _, err := tmpl.ParseFS(fsys, "*.html"); err == nil || !strings.Contains(err.Error(), "cannot Parse after Execute") {
+		t.Errorf("parsing changed files after Execute: got error %v", err)
+	}
+}
+
+type (
+	testSafeSVG    string
+	testSafeJSONLD string
+)
+
+func TestRegisterSafeContent(t *testing.T) {
+	RegisterSafeContent(testSafeSVG(""), ContentHTML, func(s string) error {
+		if strings.Contains(s, "<script") {
+			return fmt.Errorf("script in SVG")
+		}
+		return nil
+	})
+	RegisterSafeContent(testSafeJSONLD(""), ContentJS, nil)
+
+	tests := []struct {
+		src  string
+		data interface{}
+		out  string
+	}{
+		{`<div>{{.}}</div>`, testSafeSVG(`<svg><circle r="1"/></svg>`), `<div><svg><circle r="1"/></svg></div>`},
+		{`<div>{{.}}</div>`, testSafeSVG(`<svg><script>x()</script></svg>`),
+			`<div>&lt;svg&gt;&lt;script&gt;x()&lt;/script&gt;&lt;/svg&gt;</div>`},
+		{`<p title="{{.}}">`, testSafeSVG(`<svg/>`), `<p title="">`},
+		{`<script type="application/json">{{.}}</script>`, testSafeJSONLD(`{"@type":"Person"}`),
+			`<script type="application/json">{"@type":"Person"}</script>`},
+		{`<div>{{.}}</div>`, testSafeJSONLD(`<b>`), `<div>&lt;b&gt;</div>`},
+	}
+	for _, test := range tests {
+		tmpl := Must(New("x").Parse(test.src))
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, test.data); err != nil {
+			t.Errorf("%s: %v", test.src, err)
+		} else if buf.String() != test.out {
+			t.Errorf("%s: got %q, want %q", test.src, buf.String(), test.out)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic registering a predefined type; got none")
+		}
+	}()
+	RegisterSafeContent(HTML(""), ContentHTML, nil)
+}
+
+func TestSVGEscaping(t *testing.T) {
+	tests := []struct {
+		src  string
+		data interface{}
+		out  string
+	}{
+		{`<svg><use xlink:href="{{.}}"/></svg>`, "javascript:x()", `<svg><use xlink:href="#ZgotmplZ"/></svg>`},
+		{`<svg><use href="{{.}}"/></svg>`, "#icon", `<svg><use href="#icon"/></svg>`},
+		{`<svg fill="{{.}}"></svg>`, "#f00", `<svg fill="#f00"></svg>`},
+		{`<svg><path fill="{{.}}"/></svg>`, "expression(x)", `<svg><path fill="ZgotmplZ"/></svg>`},
+		{`<svg><rect stroke="url({{.}})"/></svg>`, "#grad 1", `<svg><rect stroke="url(#grad%201)"/></svg>`},
+		{`<svg><a><set attributeName="href" to="{{.}}"/></a></svg>`, "javascript:x()",
+			`<svg><a><set attributeName="href" to="#ZgotmplZ"/></a></svg>`},
+		{`<svg><set attributeName="{{.}}" to="{{.}}"/></svg>`, "javascript:x()",
+			`<svg><set attributeName="javascript:x()" to="#ZgotmplZ"/></svg>`},
+		// The values of the animations of other attributes aren't URLs.
+		{`<svg><animate attributeName="opacity" values="{{.}}"/></svg>`, "0; 0.5; 1",
+			`<svg><animate attributeName="opacity" values="0; 0.5; 1"/></svg>`},
+		// The elements in an <svg> are SVG, even after a <title>, and the
+		// templates invoked there too.
+		{`<svg><title>x</title><g><a fill="{{.}}"></a></g></svg>`, "expression(x)",
+			`<svg><title>x</title><g><a fill="ZgotmplZ"></a></g></svg>`},
+		{`<svg>{{template "path" .}}</svg>{{define "path"}}<path fill="{{.}}"/>{{end}}`, "expression(x)",
+			`<svg><path fill="ZgotmplZ"/></svg>`},
+		// The HTML attributes keep the HTML rules.
+		{`<div fill="{{.}}" to="{{.}}">`, "a(b)", `<div fill="a(b)" to="a(b)">`},
+		{`<image fill="{{.}}"><text to="{{.}}">`, "a(b)", `<image fill="a(b)"><text to="a(b)">`},
+		{`<svg></svg><path fill="{{.}}">`, "a(b)", `<svg></svg><path fill="a(b)">`},
+	}
+	for _, test := range tests {
+		tmpl := Must(New("x").Parse(test.src))
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, test.data); err != nil {
+			t.Errorf("%s: %v", test.src, err)
+		} else if buf.String() != test.out {
+			t.Errorf("%s: got %q, want %q", test.src, buf.String(), test.out)
+		}
+	}
+}
+
+func TestColorBuiltins(t *testing.T) {
+	src := `<div style="color: {{contrast .}}; background: {{darken . "10%"}}; border-color: {{mix . "#fff" 0.25}}">` +
+		`{{lighten . 0.1}}</div>`
+	var buf bytes.Buffer
+	if err := Must(New("x").Parse(src)).Execute(&buf, "rgb(0, 0, 255)"); err != nil {
+		t.Fatal(err)
+	}
+	want := `<div style="color: #ffffff; background: #0000cc; border-color: #4040ff">#3333ff</div>`
+	if buf.String() != want {
+		t.Errorf("got %s, want %s", buf.String(), want)
+	}
+	if err := Must(New("x").Parse(`{{darken . 0.1}}`)).Execute(&buf, "red;}"); err == nil {
+		t.Error("expected error for an invalid color; got none")
+	}
+}
+
+func TestQRCode(t *testing.T) {
+	tmpl := Must(New("x").Funcs(qrcode.FuncMap).Parse(`<img src="{{qrcode .}}"><img src="{{qrcode . "png"}}">`))
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, "https://example.com/t/1"); err != nil {
+		t.Fatal(err)
+	}
+	svg, _ := qrcode.DataURI("https://example.com/t/1")
+	png, _ := qrcode.DataURI("https://example.com/t/1", "png")
+	// The attribute escaper writes the plus signs of the base64 data as &#43;.
+	want := strings.ReplaceAll(`<img src="`+string(svg)+`"><img src="`+string(png)+`">`, "+", "&#43;")
+	if buf.String() != want {
+		t.Errorf("got %s, want %s", buf.String(), want)
+	}
+}
+
+func TestAvatar(t *testing.T) {
+	tmpl := Must(New("x").Parse(`<img src="{{avatar .}}"><img src="{{avatar . 80 "https://example.com/a.png"}}">`))
+	if err := tmpl.escape(); err != nil {
+		t.Fatal(err)
+	}
+	const hash = "b4c9a289323b21a01c3e940f150eb9b8c542587f1abfd8f0e1cc1ffc5e475514"
+	for _, test := range []struct {
+		executor *template.Executor
+		want     string
+	}{
+		{tmpl.CreateExecutor(), `<img src="https://www.gravatar.com/avatar/` + hash + `">` +
+			`<img src="https://www.gravatar.com/avatar/` + hash + `?d=https%3A%2F%2Fexample.com%2Fa.png&amp;s=80">`},
+		{tmpl.CreateExecutor().SetAvatarProvider(&template.AvatarProvider{URL: "https://avatars.example.com/", Size: "size", Default: "default"}),
+			`<img src="https://avatars.example.com/` + hash + `">` +
+				`<img src="https://avatars.example.com/` + hash + `?default=https%3A%2F%2Fexample.com%2Fa.png&amp;size=80">`},
+	} {
+		var buf bytes.Buffer
+		if err := test.executor.Execute(&buf, " User@Example.com"); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != test.want {
+			t.Errorf("got %s, want %s", buf.String(), test.want)
+		}
+	}
+}
+
+func TestPrintMode(t *testing.T) {
+	tmpl := Must(New("x").Parse(`{{print_css}}<header style="{{running "header"}}">{{.}}</header>` +
+		`<section style="{{keep_together}}">a</section>{{page_break}}` +
+		`<p>{{page_number}}/{{page_count}}{{if print_mode}}!{{end}}</p>`))
+	if err := tmpl.escape(); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		executor *template.Executor
+		want     string
+	}{
+		{tmpl.CreateExecutor(), `<header style="">Title</header><section style="">a</section><p>/</p>`},
+		{tmpl.CreateExecutor().SetPrintMode(&template.PrintMode{Size: "letter", Running: map[string]string{"chapter": "top-left"}}),
+			`<style>@page{size:letter;margin:2cm;@top-left{content:element(chapter)}@bottom-center{content:element(footer)}` +
+				`@top-center{content:element(header)}}.umbu-page-number::after{content:counter(page)}` +
+				`.umbu-page-count::after{content:counter(pages)}</style>` +
+				`<header style="position:running(header);">Title</header>` +
+				`<section style="break-inside:avoid;page-break-inside:avoid;">a</section>` +
+				`<div style="break-after:page;page-break-after:always"></div>` +
+				`<p><span class="umbu-page-number"></span>/<span class="umbu-page-count"></span>!</p>`},
+	} {
+		var buf bytes.Buffer
+		if err := test.executor.Execute(&buf, "Title"); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != test.want {
+			t.Errorf("got %s, want %s", buf.String(), test.want)
+		}
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	tmpl := Must(New("x").Parse(`{{range .Items}}<a title="{{$.Title | printf "%s!"}}">{{.}}{{printf "<%d>" 1}}</a>{{end}}`))
+	tmpl.Optimize()
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, map[string]interface{}{"Title": `"T"`, "Items": []string{"<a>", "b"}})
+	want := `<a title="&#34;T&#34;!">&lt;a&gt;&lt;1&gt;</a><a title="&#34;T&#34;!">b&lt;1&gt;</a>`
+	if err != nil || buf.String() != want {
+		t.Errorf("got %s, %v, want %s", buf.String(), err, want)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tmpl := Must(New("x").Parse(`<a href="{{.URL}}">{{.Items.Name}}</a>`))
+	if err := tmpl.Check(map[string]interface{}{"URL": "/", "Items": []string{"a"}}); err == nil {
+		t.Error("no error")
+	}
+	if err := Must(New("y").Parse(`<a href="{{.}}`)).Check("/"); err == nil || !strings.Contains(err.Error(), "ends in a non-text context") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestBufferedExecute(t *testing.T) {
+	tmpl := Must(New("x").Parse(`<a href="{{.URL}}">{{.Items.Name}}</a>`))
+	var buf bytes.Buffer
+	if err := tmpl.BufferedExecute(&buf, map[string]interface{}{"URL": "/", "Items": []string{"a"}}); err == nil || buf.Len() != 0 {
+		t.Errorf("got %q, %v", buf.String(), err)
+	}
+	if err := tmpl.BufferedExecute(&buf, map[string]interface{}{"URL": "/?a b", "Items": map[string]string{"Name": "<b>"}}); err != nil ||
+		buf.String() != `<a href="/?a%20b">&lt;b&gt;</a>` {
+		t.Errorf("got %q, %v", buf.String(), err)
+	}
+}
+
+func TestReturn(t *testing.T) {
+	tmpl := Must(New("x").Parse(`{{define "name"}}{{return printf "<%s>" .}}{{end}}{{$n := template "name" .}}<a title="{{$n}}">{{$n}}</a>`))
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, "b"); err != nil || buf.String() != `<a title="&lt;b&gt;">&lt;b&gt;</a>` {
+		t.Errorf("got %q, %v", buf.String(), err)
+	}
+}
+
+func TestReparseTemplateAfterExecute(t *testing.T) {
+	root := Must(New("page").Parse(`{{define "card"}}<b>{{.}}</b>{{end}}<a title="{{template "card" .}}">{{template "card" .}}</a>`))
+	var changed []string
+	root.OnChange(func(names []string) {
+		// The listeners may use the templates.
+		if root.Lookup(names[0]) == nil {
+			t.Errorf("%s isn't defined", names[0])
+		}
+		changed = names
+	})
+	var b strings.Builder
+	if err := root.Execute(&b, "<x>"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), `<a title="<b>&lt;x&gt;</b>"><b>&lt;x&gt;</b></a>`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	card, err := root.ReparseTemplate("card", `<i>{{.}}</i>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(changed, []string{"card", "page"}) {
+		t.Errorf("changed %v", changed)
+	}
+	if deps := root.Dependents("card"); !reflect.DeepEqual(deps, []string{"page"}) {
+		t.Errorf("dependents %v", deps)
+	}
+	b.Reset()
+	if err := root.Execute(&b, "<x>"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), `<a title="<i>&lt;x&gt;</i>"><i>&lt;x&gt;</i></a>`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	b.Reset()
+	if err := card.Execute(&b, "<y>"); err != nil || b.String() != `<i>&lt;y&gt;</i>` {
+		t.Errorf("card: got %s, %v", b.String(), err)
+	}
+}
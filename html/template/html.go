@@ -176,7 +176,7 @@ func stripTags(html string) string {
 		if c.delim == delimNone {
 			st := c.state
 			// Use RCDATA instead of parsing into JS or CSS styles.
-			if c.element != elementNone && !isInTag(st) {
+			if c.element != elementNone && !isSVG(c.element) && !isInTag(st) {
 				st = stateRCDATA
 			}
 			d, nread := transitionFunc[st](c, s[i:])
@@ -0,0 +1,159 @@
+package template
+
+import (
+	"reflect"
+
+	"github.com/moisespsena-go/umbu/text/template/parse"
+)
+
+// renderFunc replaces the render builtin in the escaped templates, see
+// renderHTML.
+const renderFunc = "_html_template_render"
+
+// renderHTML is the render builtin of the escaped templates: the templates
+// rendered are escaped in the HTML text context, so their output is HTML.
+func renderHTML(state *State, name string, args ...reflect.Value) (HTML, error) {
+	in := make([]any, len(args)+1)
+	in[0] = name
+	for i, arg := range args {
+		in[i+1] = arg
+	}
+	var (
+		out string
+		err error
+	)
+	state.Call("render", in, []any{&out, &err})
+	return HTML(out), err
+}
+
+// isYield reports whether the action writes a template by the yield
+// builtin, as {{yield "card" .}}, the only form of yield escaped.
+func isYield(n *parse.ActionNode) bool {
+	if len(n.Pipe.Decl) != 0 || len(n.Pipe.Cmds) != 1 {
+		return false
+	}
+	id, ok := n.Pipe.Cmds[0].Args[0].(*parse.IdentifierNode)
+	return ok && id.Ident == "yield"
+}
+
+// invokedName returns the name of the template invoked by the command,
+// which must be a constant to be escaped.
+func invokedName(cmd *parse.CommandNode) (string, *Error) {
+	builtin := cmd.Args[0].(*parse.IdentifierNode).Ident
+	if len(cmd.Args) < 2 {
+		return "", errorf(ErrInvoke, cmd, 0, "%s without a template name", builtin)
+	}
+	s, ok := cmd.Args[1].(*parse.StringNode)
+	if !ok {
+		return "", errorf(ErrNoSuchTemplate, cmd, 0, "dynamic template name %s can't be escaped", cmd.Args[1])
+	}
+	return s.Text, nil
+}
+
+// operandHTML types the output of the templates invoked as operands, as
+// {{$x := template "name" .}}, which are escaped in the HTML text context.
+// See template.Executor.SetOperandOutput.
+func operandHTML(output string) interface{} {
+	return HTML(output)
+}
+
+// escapeInvokes escapes the templates invoked by the body but by the
+// {{template}} actions: the templates invoked as operands, and the ones
+// rendered by render, are escaped in the HTML text context, as their
+// output is HTML, and the calls of render replaced by renderHTML; the
+// templates written by yield are escaped in the context of its action, by
+// escapeYield, so yield must be the only command of its action. The
+// deprecated builtins invoking templates can't be escaped.
+func (e *escaper) escapeInvokes(root *parse.ListNode) (err *Error) {
+	if root == nil {
+		return nil
+	}
+	yields := map[*parse.CommandNode]bool{}
+	actions := map[*parse.TemplateNode]bool{}
+	parse.Inspect(root, func(n parse.Node) bool {
+		switch n := n.(type) {
+		case *parse.ListNode:
+			for _, n := range n.Nodes {
+				if t, ok := n.(*parse.TemplateNode); ok {
+					actions[t] = true
+				}
+			}
+		case *parse.TemplateNode:
+			if !actions[n] {
+				err = e.escapeOperand(n)
+			}
+		case *parse.ActionNode:
+			if isYield(n) {
+				yields[n.Pipe.Cmds[0]] = true
+			}
+		case *parse.CommandNode:
+			id, ok := n.Args[0].(*parse.IdentifierNode)
+			if !ok {
+				break
+			}
+			switch id.Ident {
+			case "render":
+				var name string
+				if name, err = invokedName(n); err != nil {
+					break
+				}
+				c, _ := e.escapeTree(context{}, n, name, 0)
+				if c.state == stateError {
+					err = c.err
+				} else if c.state != stateText {
+					err = errorf(ErrEndContext, n, 0, "render of %q ends in a non-text context: %v", name, c)
+				} else {
+					e.editIdentNode(id, renderFunc)
+				}
+			case "yield":
+				if !yields[n] {
+					err = errorf(ErrInvoke, n, 0, "yield can't be escaped unless the only command of its action")
+				}
+			case "tpl_render", "template_exec":
+				err = errorf(ErrInvoke, n, 0, "%s can't be escaped, use render", id.Ident)
+			case "tpl_yield":
+				err = errorf(ErrInvoke, n, 0, "%s can't be escaped, use yield", id.Ident)
+			}
+		}
+		return err == nil
+	})
+	return
+}
+
+// escapeOperand escapes the template invoked as an operand in the HTML text
+// context.
+func (e *escaper) escapeOperand(n *parse.TemplateNode) *Error {
+	if n.NameNode != nil {
+		return errorf(ErrNoSuchTemplate, n, n.Line, "dynamic template name %s can't be escaped", n.NameNode)
+	}
+	c, _ := e.escapeTree(context{}, n, n.Name, n.Line)
+	if c.state == stateError {
+		return c.err
+	}
+	if c.state != stateText {
+		return errorf(ErrEndContext, n, n.Line, "template %q invoked as an operand ends in a non-text context: %v", n.Name, c)
+	}
+	return nil
+}
+
+// escapeYield escapes the action writing a template by yield, which is
+// escaped in the context of the action, as by {{template}}. The output of
+// the template is written as is, so the context must be HTML text.
+func (e *escaper) escapeYield(c context, n *parse.ActionNode) context {
+	c = nudge(c)
+	if c.state == stateError {
+		return c
+	}
+	if c.state != stateText {
+		return context{
+			state: stateError,
+			err:   errorf(ErrInvoke, n, n.Line, "%s appears in the %s context, not in HTML text", n, c.state),
+		}
+	}
+	name, err := invokedName(n.Pipe.Cmds[0])
+	if err != nil {
+		return context{state: stateError, err: err}
+	}
+	c, _ = e.escapeTree(c, n, name, n.Line)
+	return c
+}
@@ -136,6 +136,14 @@ func jsValEscaper(args ...interface{}) string {
 	var a interface{}
 	if len(args) == 1 {
 		a = indirectToJSONMarshaler(args[0])
+		if s, t, ok := safeContentOf(indirect(a)); ok {
+			switch t {
+			case contentTypeJS:
+				return s
+			case contentTypeJSStr:
+				return `"` + s + `"`
+			}
+		}
 		switch t := a.(type) {
 		case JS:
 			return string(t)
@@ -0,0 +1,145 @@
+package template
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/moisespsena-go/umbu/text/template/parse"
+)
+
+// EscapePolicy tightens the contextual escaping of the templates, for the
+// products that must not rely on the sanitizing of untrusted content.
+type EscapePolicy struct {
+	// ForbidSafeFuncs fails the escaping of the templates calling the
+	// functions marking content as safe without checking it: safe_html,
+	// safe_css, safe_js, safe_raw_js and safe_attr.
+	ForbidSafeFuncs bool
+	// ForbiddenFuncs are other functions failing the escaping of the templates
+	// calling them.
+	ForbiddenFuncs []string
+	// TypedURLs fails the execution when a value starting a URL, which may
+	// set its scheme, as in <a href="{{.}}">, isn't a URL.
+	TypedURLs bool
+	// RejectUnsafeURLs fails the execution when a value starting a URL has an
+	// unsafe scheme, as "javascript:", instead of replacing it by
+	// "#ZgotmplZ".
+	RejectUnsafeURLs bool
+	// RequestData are the field paths of the request data of the templates,
+	// as ".Query" or ".Form", which the safe functions must not be called
+	// on: their calls on the values derived from the request data, as
+	// {{.Query.q | safe_html}}, are reported by Template.Lint and log a
+	// warning, by the logger of the executor, on each execution.
+	RequestData []string
+	// ForbidSafeRequestData fails the escaping of the templates calling the
+	// safe functions on request data, instead of warning.
+	ForbidSafeRequestData bool
+}
+
+// safeFuncs are the functions forbidden by EscapePolicy.ForbidSafeFuncs.
+var safeFuncs = []string{"safe_html", "safe_css", "safe_js", "safe_raw_js", "safe_attr"}
+
+// SetEscapePolicy sets the escape policy of the templates associated with t.
+// It must be set before the first execution, as the templates are escaped
+// once.
+func (t *Template) SetEscapePolicy(policy EscapePolicy) *Template {
+	t.nameSpace.mu.Lock()
+	defer t.nameSpace.mu.Unlock()
+	t.policy = policy
+	return t
+}
+
+// AllowUnescaped allows the "umbu:option autoescape=false" pragma in the
+// templates associated with t, which fails their escaping otherwise. The
+// pragma disables the escaping of the template, so it must be allowed only
+// for templates written by trusted authors. Any escape policy still forbids
+// it. It must be set before the first execution, as the templates are
+// escaped once.
+func (t *Template) AllowUnescaped(allow bool) *Template {
+	t.nameSpace.mu.Lock()
+	defer t.nameSpace.mu.Unlock()
+	t.unescaped = allow
+	return t
+}
+
+// isSet reports whether the policy tightens the escaping at all.
+func (p *EscapePolicy) isSet() bool {
+	return p.ForbidSafeFuncs || len(p.ForbiddenFuncs) > 0 || p.TypedURLs || p.RejectUnsafeURLs ||
+		len(p.RequestData) > 0 || p.ForbidSafeRequestData
+}
+
+// forbidden reports whether the policy forbids the function.
+func (p *EscapePolicy) forbidden(name string) bool {
+	if p.ForbidSafeFuncs {
+		for _, f := range safeFuncs {
+			if f == name {
+				return true
+			}
+		}
+	}
+	for _, f := range p.ForbiddenFuncs {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPolicy checks the calls of the template body against the policy.
+func (e *escaper) checkPolicy(root *parse.ListNode) (err *Error) {
+	if e.ns == nil || root == nil {
+		return nil
+	}
+	policy := &e.ns.policy
+	if len(policy.RequestData) > 0 {
+		if err = e.checkRequestData(root); err != nil {
+			return
+		}
+	}
+	if !policy.ForbidSafeFuncs && len(policy.ForbiddenFuncs) == 0 {
+		return nil
+	}
+	parse.Inspect(root, func(n parse.Node) bool {
+		if id, ok := n.(*parse.IdentifierNode); ok && err == nil && policy.forbidden(id.Ident) {
+			err = errorf(ErrPolicy, id, 0, "function %q forbidden by the escape policy", id.Ident)
+		}
+		return err == nil
+	})
+	return
+}
+
+// urlFilter returns the escaper of the values starting a URL.
+func (e *escaper) urlFilter() string {
+	if e.ns != nil {
+		switch {
+		case e.ns.policy.TypedURLs:
+			return "_html_template_urltyped"
+		case e.ns.policy.RejectUnsafeURLs:
+			return "_html_template_urlstrictfilter"
+		}
+	}
+	return "_html_template_urlfilter"
+}
+
+// urlTyped fails on values starting a URL that aren't URLs.
+func urlTyped(args ...interface{}) (string, error) {
+	s, t := stringify(args...)
+	if t != contentTypeURL {
+		return "", fmt.Errorf("html/template: untyped value %q in URL forbidden by the escape policy", s)
+	}
+	return s, nil
+}
+
+// urlStrictFilter is like urlFilter, but fails on unsafe URLs.
+func urlStrictFilter(args ...interface{}) (string, error) {
+	s, t := stringify(args...)
+	if t == contentTypeURL {
+		return s, nil
+	}
+	if i := strings.IndexRune(s, ':'); i >= 0 && !strings.ContainsRune(s[:i], '/') {
+		protocol := strings.ToLower(s[:i])
+		if protocol != "http" && protocol != "https" && protocol != "mailto" {
+			return "", fmt.Errorf("html/template: unsafe URL %q forbidden by the escape policy", s)
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,111 @@
+package template
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/moisespsena-go/umbu/text/template/parse"
+)
+
+// EscapeDecision is the escaping of an action decided by the contextual
+// escaping of the templates.
+type EscapeDecision struct {
+	// Template is the name of the template holding the action.
+	Template string
+	// Location is the location of the action, as "'name':line:col".
+	Location string
+	// Action is the action, before the escaping.
+	Action string
+	// Context is the context of the output of the action: "Text", "RCDATA",
+	// "Attr", "AttrName", "URL", "JS", "JSDqStr", "CSS", "CSSDqStr" and so
+	// on. A template invoked from many contexts has a decision per context.
+	Context string
+	// Attr is the kind of the attribute holding the action, if any, as
+	// "Script", "Style", "URL" or "Srcset", or empty for the other ones.
+	Attr string
+	// Escapers are the escapers appended to the pipeline of the action, as
+	// "htmlescaper", "urlfilter", "jsvalescaper" or "attrescaper".
+	Escapers []string
+
+	pos parse.Pos
+}
+
+// EscapeReport lists the escaping decisions of the templates, sorted by
+// template and position.
+type EscapeReport []EscapeDecision
+
+// Filter returns the decisions accepted by f.
+func (r EscapeReport) Filter(f func(d EscapeDecision) bool) (filtered EscapeReport) {
+	for _, d := range r {
+		if f(d) {
+			filtered = append(filtered, d)
+		}
+	}
+	return
+}
+
+// InContext returns the decisions of the actions in any of the contexts.
+func (r EscapeReport) InContext(contexts ...string) EscapeReport {
+	return r.Filter(func(d EscapeDecision) bool {
+		for _, c := range contexts {
+			if d.Context == c {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// EscapeReport escapes all the templates associated with t, as WarmUp, and
+// returns the escaping decisions taken for their actions, so it can be
+// audited where the data flows into URL, JavaScript or CSS contexts.
+func (t *Template) EscapeReport() (EscapeReport, error) {
+	if err := t.WarmUp(1); err != nil {
+		return nil, err
+	}
+	t.nameSpace.mu.Lock()
+	defer t.nameSpace.mu.Unlock()
+	report := append(EscapeReport(nil), t.report...)
+	sort.SliceStable(report, func(i, j int) bool {
+		if report[i].Template != report[j].Template {
+			return report[i].Template < report[j].Template
+		}
+		return report[i].pos < report[j].pos
+	})
+	return report, nil
+}
+
+// actionSource is the template and the context of an action.
+type actionSource struct {
+	template string
+	ctx      context
+}
+
+// report records the escaping of the action to the report of the name
+// space.
+func (e *escaper) report(n *parse.ActionNode, escapers []string) {
+	if e.ns == nil {
+		return
+	}
+	src := e.actionNodeSources[n]
+	name := src.template
+	if i := strings.Index(name, "$htmltemplate_"); i >= 0 {
+		name = name[:i]
+	}
+	d := EscapeDecision{
+		Template: name,
+		Action:   n.String(),
+		Context:  strings.TrimPrefix(src.ctx.state.String(), "state"),
+		pos:      n.Position(),
+	}
+	if src.ctx.attr != attrNone {
+		d.Attr = strings.TrimPrefix(src.ctx.attr.String(), "attr")
+	}
+	if t := e.template(src.template); t != nil && t.Tree != nil {
+		d.Location, _ = t.ErrorContext(n)
+	}
+	for _, s := range escapers {
+		d.Escapers = append(d.Escapers, strings.TrimPrefix(s, "_html_template_"))
+	}
+	e.ns.report = append(e.ns.report, d)
+}
@@ -0,0 +1,228 @@
+package template
+
+import (
+	"log/slog"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/moisespsena-go/umbu/text/template/parse"
+)
+
+// requestSafeFuncPrefix prefixes the names of the safe functions logging a
+// warning, replacing the calls of the safe functions on request data.
+const requestSafeFuncPrefix = "_html_template_request_"
+
+// requestSafeFunc returns the safe function f, named name, logging a warning
+// by the logger of the executor on each call.
+func requestSafeFunc(name string, f interface{}) func(state *State, v string) interface{} {
+	fv := reflect.ValueOf(f)
+	return func(state *State, v string) interface{} {
+		state.Log(slog.LevelWarn, "safe function on request data", "func", name)
+		return fv.Call([]reflect.Value{reflect.ValueOf(v)})[0].Interface()
+	}
+}
+
+// Lint escapes all the templates associated with t, as WarmUp, and returns
+// the warnings of the escape policy, sorted by location: the calls of the
+// safe functions on values derived from the request data of the policy, of
+// code ErrSafeRequestData. See EscapePolicy.RequestData.
+func (t *Template) Lint() ([]*Error, error) {
+	if err := t.WarmUp(1); err != nil {
+		return nil, err
+	}
+	t.nameSpace.mu.Lock()
+	defer t.nameSpace.mu.Unlock()
+	warnings := append([]*Error(nil), t.lint...)
+	sort.SliceStable(warnings, func(i, j int) bool {
+		return warnings[i].Error() < warnings[j].Error()
+	})
+	return warnings, nil
+}
+
+// dotSource is the source of the value of dot.
+type dotSource uint8
+
+const (
+	dotData    dotSource = iota // The data of the template.
+	dotRequest                  // A value derived from request data.
+	dotOther                    // Any other value.
+)
+
+// requestData finds the calls of the safe functions on values derived from
+// the request data in a template body. It follows the values through the
+// pipelines, the variables and the dot of range and with, but not into the
+// called templates.
+type requestData struct {
+	roots []string
+	// vars are the variables holding request data, by name.
+	vars  map[string]string
+	calls []requestDataCall
+}
+
+// requestDataCall is a call of a safe function on the request data src.
+type requestDataCall struct {
+	ident *parse.IdentifierNode
+	src   string
+}
+
+// source returns the request data of the field path, if any.
+func (r *requestData) source(path string) (string, bool) {
+	for _, root := range r.roots {
+		root = "." + strings.TrimPrefix(root, ".")
+		if path == root || strings.HasPrefix(path, root+".") {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// walk walks the node with dot from the source.
+func (r *requestData) walk(n parse.Node, dot dotSource) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			r.walk(c, dot)
+		}
+	case *parse.ActionNode:
+		r.pipe(n.Pipe, dot)
+	case *parse.IfNode:
+		r.pipe(n.Pipe, dot)
+		r.walk(n.List, dot)
+		r.walk(n.ElseList, dot)
+	case *parse.RangeNode:
+		r.branch(&n.BranchNode, dot)
+	case *parse.WithNode:
+		r.branch(&n.BranchNode, dot)
+	default:
+		parse.Inspect(n, func(c parse.Node) bool {
+			if pipe, ok := c.(*parse.PipeNode); ok {
+				r.pipe(pipe, dot)
+				return false
+			}
+			return true
+		})
+	}
+}
+
+// branch walks the range or with node, whose dot is the value of its
+// pipeline.
+func (r *requestData) branch(n *parse.BranchNode, dot dotSource) {
+	inner := dotOther
+	if _, ok := r.pipe(n.Pipe, dot); ok {
+		inner = dotRequest
+	}
+	r.walk(n.List, inner)
+	r.walk(n.ElseList, dot)
+}
+
+// pipe returns the request data the value of the pipeline derives from, if
+// any, recording the calls of the safe functions on it.
+func (r *requestData) pipe(pipe *parse.PipeNode, dot dotSource) (src string, ok bool) {
+	if pipe == nil {
+		return
+	}
+	for _, cmd := range pipe.Cmds {
+		for _, arg := range cmd.Args {
+			if s, argOK := r.arg(arg, dot); argOK && !ok {
+				src, ok = s, true
+			}
+		}
+		if id, isIdent := cmd.Args[0].(*parse.IdentifierNode); isIdent && ok && isSafeFunc(id.Ident) {
+			r.calls = append(r.calls, requestDataCall{id, src})
+		}
+	}
+	for _, v := range pipe.Decl {
+		if ok {
+			r.vars[v.Ident[0]] = src
+		} else {
+			delete(r.vars, v.Ident[0])
+		}
+	}
+	return
+}
+
+// arg returns the request data the argument derives from, if any.
+func (r *requestData) arg(n parse.Node, dot dotSource) (string, bool) {
+	switch n := n.(type) {
+	case *parse.DotNode:
+		return ".", dot == dotRequest
+	case *parse.FieldNode:
+		path := "." + strings.Join(n.Ident, ".")
+		switch dot {
+		case dotRequest:
+			return path, true
+		case dotData:
+			return r.source(path)
+		}
+	case *parse.VariableNode:
+		if n.Ident[0] == "$" {
+			if len(n.Ident) > 1 {
+				return r.source("." + strings.Join(n.Ident[1:], "."))
+			}
+			return "", false
+		}
+		if _, ok := r.vars[n.Ident[0]]; ok {
+			return strings.Join(n.Ident, "."), true
+		}
+	case *parse.ChainNode:
+		return r.arg(n.Node, dot)
+	case *parse.PipeNode:
+		return r.pipe(n, dot)
+	case *parse.ExprNode:
+		for _, c := range []*parse.CommandNode{n.A, n.B} {
+			if c == nil {
+				continue
+			}
+			for _, arg := range c.Args {
+				if src, ok := r.arg(arg, dot); ok {
+					return src, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// isSafeFunc reports whether the function marks content as safe.
+func isSafeFunc(name string) bool {
+	for _, f := range safeFuncs {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRequestData checks the calls of the safe functions on request data
+// in the template body against the policy: they fail the escaping, if
+// forbidden, or are recorded as warnings for Lint, logging a warning on
+// each execution.
+func (e *escaper) checkRequestData(root *parse.ListNode) *Error {
+	policy := &e.ns.policy
+	r := &requestData{roots: policy.RequestData, vars: map[string]string{}}
+	r.walk(root, dotData)
+	for _, call := range r.calls {
+		err := errorf(ErrSafeRequestData, call.ident, 0, "function %q on the request data %s", call.ident.Ident, call.src)
+		if policy.ForbidSafeRequestData {
+			return err
+		}
+		e.addLint(err)
+		e.editIdentNode(call.ident, requestSafeFuncPrefix+call.ident.Ident)
+	}
+	return nil
+}
+
+// addLint records the warning, once, for Lint.
+func (e *escaper) addLint(err *Error) {
+	msg := err.Error()
+	for _, w := range e.ns.lint {
+		if w.Error() == msg {
+			return
+		}
+	}
+	e.ns.lint = append(e.ns.lint, err)
+}
@@ -0,0 +1,116 @@
+package template
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// ContentKind is the kind of content the values of a type registered by
+// RegisterSafeContent are trusted as.
+type ContentKind uint8
+
+const (
+	// ContentCSS trusts the values as CSS, as the CSS type.
+	ContentCSS ContentKind = iota + 1
+	// ContentHTML trusts the values as an HTML document fragment, as the
+	// HTML type. It fits the inline SVG images.
+	ContentHTML
+	// ContentHTMLAttr trusts the values as HTML attributes, as the HTMLAttr
+	// type.
+	ContentHTMLAttr
+	// ContentJS trusts the values as a JavaScript expression, as the JS type.
+	// It fits the JSON-LD documents.
+	ContentJS
+	// ContentJSStr trusts the values as the content of a JavaScript string,
+	// as the JSStr type.
+	ContentJSStr
+	// ContentURL trusts the values as a URL, as the URL type.
+	ContentURL
+)
+
+func (k ContentKind) contentType() contentType {
+	switch k {
+	case ContentCSS:
+		return contentTypeCSS
+	case ContentHTML:
+		return contentTypeHTML
+	case ContentHTMLAttr:
+		return contentTypeHTMLAttr
+	case ContentJS:
+		return contentTypeJS
+	case ContentJSStr:
+		return contentTypeJSStr
+	case ContentURL:
+		return contentTypeURL
+	}
+	return contentTypePlain
+}
+
+// safeContent is a registered safe content type.
+type safeContent struct {
+	kind   contentType
+	verify func(s string) error
+}
+
+var (
+	safeContentsMu sync.Mutex
+	// safeContents holds the map[reflect.Type]safeContent of the registered
+	// types, replaced on each registration, so the escapers read it without
+	// locking.
+	safeContents atomic.Value
+)
+
+// RegisterSafeContent registers the string type of sample, as a SafeSVG or a
+// SafeJSONLD type of the embedder, as trusted content of kind: the escapers
+// of the templates handle its values like the values of the type of the
+// kind, as HTML for ContentHTML, not escaping them in the matching context.
+//
+// If verify isn't nil, it checks each value before it is trusted: the values
+// it rejects are escaped as untrusted strings.
+//
+// RegisterSafeContent panics if the type of sample isn't a string type, is
+// one of the types of the package, or kind is invalid. It is intended to be
+// called at initialization.
+func RegisterSafeContent(sample interface{}, kind ContentKind, verify func(s string) error) {
+	typ := reflect.TypeOf(sample)
+	if typ == nil || typ.Kind() != reflect.String {
+		panic(fmt.Errorf("html/template: safe content type %v isn't a string type", typ))
+	}
+	switch sample.(type) {
+	case string, CSS, HTML, HTMLAttr, JS, JSStr, URL:
+		panic(fmt.Errorf("html/template: safe content type %v is predefined", typ))
+	}
+	if kind.contentType() == contentTypePlain {
+		panic(fmt.Errorf("html/template: invalid content kind %d", kind))
+	}
+
+	safeContentsMu.Lock()
+	defer safeContentsMu.Unlock()
+	old, _ := safeContents.Load().(map[reflect.Type]safeContent)
+	m := make(map[reflect.Type]safeContent, len(old)+1)
+	for t, c := range old {
+		m[t] = c
+	}
+	m[typ] = safeContent{kind.contentType(), verify}
+	safeContents.Store(m)
+}
+
+// safeContentOf returns the string and the content type of the value of a
+// registered safe content type, verified.
+func safeContentOf(a interface{}) (string, contentType, bool) {
+	m, _ := safeContents.Load().(map[reflect.Type]safeContent)
+	if len(m) == 0 || a == nil {
+		return "", contentTypePlain, false
+	}
+	c, ok := m[reflect.TypeOf(a)]
+	if !ok {
+		return "", contentTypePlain, false
+	}
+	s := reflect.ValueOf(a).String()
+	if c.verify != nil && c.verify(s) != nil {
+		return s, contentTypePlain, true
+	}
+	return s, c.kind, true
+}
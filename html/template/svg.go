@@ -0,0 +1,90 @@
+package template
+
+import (
+	"bytes"
+	"strings"
+)
+
+// svgElement returns the element of the start or end tag of the element e in
+// the body of an <svg> element, which keeps the tags in SVG but the end of
+// the <svg> and the raw text elements. The elements shared with HTML, as
+// <a>, are SVG; <title> and <textarea> have no special body there.
+func svgElement(e element, end bool) element {
+	switch {
+	case end && e == elementSVG:
+		return elementNone
+	case e == elementScript || e == elementStyle:
+		return e
+	}
+	return elementSVG
+}
+
+// isSVG reports whether the start tag of e is typed by the SVG rules.
+func isSVG(e element) bool {
+	return e == elementSVG || e == elementSVGNoHref
+}
+
+// svgAttrTypeMap are the types of the SVG attributes differing from the
+// HTML attributes with the same names, lower cased.
+var svgAttrTypeMap = map[string]contentType{
+	// The presentation attributes hold CSS values, which may reference
+	// resources by url(...).
+	"clip-path":    contentTypeCSS,
+	"cursor":       contentTypeCSS,
+	"fill":         contentTypeCSS,
+	"filter":       contentTypeCSS,
+	"marker-end":   contentTypeCSS,
+	"marker-mid":   contentTypeCSS,
+	"marker-start": contentTypeCSS,
+	"mask":         contentTypeCSS,
+	"stroke":       contentTypeCSS,
+	// The values of the animations may set any attribute, as href, so they
+	// are filtered as URLs, unless the animated attribute isn't an href, see
+	// svgAnimationElement.
+	"by":     contentTypeURL,
+	"from":   contentTypeURL,
+	"to":     contentTypeURL,
+	"values": contentTypeURL,
+}
+
+// svgAttrType returns the type of the attribute of the start tag of the SVG
+// element e: the xlink:href and href attributes are URLs, as in attrType, the
+// presentation attributes, as fill and stroke, are CSS and the values of the
+// animations are URLs, but for elementSVGNoHref.
+func svgAttrType(name string, e element) contentType {
+	local := name
+	if colon := strings.IndexRune(name, ':'); colon != -1 && name[:colon] != "xmlns" {
+		local = name[colon+1:]
+	}
+	if t, ok := svgAttrTypeMap[local]; ok {
+		if t == contentTypeURL && e == elementSVGNoHref {
+			return contentTypePlain
+		}
+		return t
+	}
+	return attrType(name)
+}
+
+// svgAnimationElement returns the element of the start tag of an SVG element
+// after its attributeName attribute, whose value starts s: elementSVGNoHref
+// if the animated attribute isn't a URL, as opacity, elementSVG if it is or
+// if the value isn't known, as set by an action.
+func svgAnimationElement(s []byte) element {
+	i := eatWhiteSpace(s, 0)
+	if i == len(s) || s[i] != '=' {
+		return elementSVG
+	}
+	i = eatWhiteSpace(s, i+1)
+	ends := " \t\n\f\r>"
+	if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+		ends, i = string(s[i]), i+1
+	}
+	j := bytes.IndexAny(s[i:], ends)
+	if j <= 0 {
+		return elementSVG
+	}
+	if svgAttrType(strings.ToLower(string(s[i:i+j])), elementSVG) == contentTypeURL {
+		return elementSVG
+	}
+	return elementSVGNoHref
+}
@@ -5,10 +5,15 @@
 package template
 
 import (
+	gocontext "context"
 	"fmt"
 	"io"
-	"io/ioutil"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/moisespsena-go/umbu/funcs"
@@ -28,7 +33,7 @@ type Template struct {
 	// The underlying template's parse tree, updated to be HTML-safe.
 	Tree       *parse.Tree
 	*nameSpace // common to all associated templates
-	funcs      funcs.FuncValues
+	funcs      funcs.AtomicFuncValues
 }
 
 // escapeOK is a sentinel value used to indicate valid escaping.
@@ -40,6 +45,22 @@ type nameSpace struct {
 	set     map[string]*Template
 	escaped bool
 	esc     escaper
+	report  EscapeReport
+	lint    []*Error
+	policy  EscapePolicy
+	// unescaped allows the "umbu:option autoescape=false" pragma, as set by
+	// AllowUnescaped.
+	unescaped bool
+	// files are the fingerprints of the files of the templates parsed by
+	// ParseFiles, ParseGlob or ParseFS, by template name.
+	files map[string]string
+	// executors are the executors of the templates parsed from files.
+	executors map[string]cachedExecutor
+	// sources are the copies of the templates before they were first
+	// escaped, for ReparseTemplate.
+	sources *template.Template
+	// onChange are the functions registered by OnChange.
+	onChange []func(names []string)
 }
 
 // Funcs add funcs to this Template
@@ -49,28 +70,49 @@ func (t *Template) Funcs(funcMaps ...funcs.FuncMap) *Template {
 		if err != nil {
 			panic(err)
 		}
-		t.funcs.AppendValues(fv)
+		t.funcs.Update(func(v *funcs.FuncValues) error {
+			v.AppendValues(fv)
+			return nil
+		})
+		t.resetExecutor()
 	}
 	return t
 }
 
+// FuncProvider adds the functions of the provider to this Template,
+// resolved when called. See funcs.FuncProvider.
+func (t *Template) FuncProvider(p funcs.FuncProvider) *Template {
+	t.funcs.Update(func(v *funcs.FuncValues) error {
+		v.AppendProvider(p)
+		return nil
+	})
+	t.resetExecutor()
+	return t
+}
+
 // FuncsValues add funcs values to this Template
 func (t *Template) FuncsValues(funcValues ...funcs.FuncValues) *Template {
 	if len(funcValues) > 0 {
-		t.funcs.AppendValues(funcs.NewValues(funcValues...))
+		fv := funcs.NewValues(funcValues...)
+		t.funcs.Update(func(v *funcs.FuncValues) error {
+			v.AppendValues(fv)
+			return nil
+		})
+		t.resetExecutor()
 	}
 	return t
 }
 
 // SetFuncs set funcs values to this template
 func (t *Template) SetFuncs(values funcs.FuncValues) *Template {
-	t.funcs = values
+	t.funcs.Store(values)
+	t.resetExecutor()
 	return t
 }
 
 // GetFuncs get all funcs values in this template
 func (t *Template) GetFuncs() funcs.FuncValues {
-	return t.funcs
+	return t.funcs.Load()
 }
 
 func (t *Template) SetPath(path string) *Template {
@@ -133,6 +175,7 @@ func (t *Template) checkCanParse() error {
 func (t *Template) escape() error {
 	t.nameSpace.mu.Lock()
 	defer t.nameSpace.mu.Unlock()
+	t.keepSources()
 	t.nameSpace.escaped = true
 	if t.escapeErr == nil {
 		if t.Tree == nil {
@@ -147,8 +190,19 @@ func (t *Template) escape() error {
 	return nil
 }
 
+// CreateExecutor returns a new executor of t. The executors of the templates
+// parsed from files are cached while the files are unchanged, so only the
+// first one is built, and the ones built by WarmUp until the templates change.
 func (t *Template) CreateExecutor() *template.Executor {
-	return t.text.CreateExecutor().FuncsValues(builtins, t.funcs)
+	if executor, ok := t.cachedExecutor(); ok {
+		return executor
+	}
+	return t.newExecutor()
+}
+
+// newExecutor returns a new executor of t.
+func (t *Template) newExecutor() *template.Executor {
+	return t.text.CreateExecutor().FuncsValues(builtins, t.funcs.Load()).SetOperandOutput(operandHTML)
 }
 
 // Execute applies a parsed template to the specified data object,
@@ -180,16 +234,69 @@ func (t *Template) ExecuteTemplate(wr io.Writer, name string, data interface{})
 	return tmpl.CreateExecutor().Execute(wr, data)
 }
 
+// ExecuteContext applies the template to the data, as Execute, with the
+// context ctx. See template.Executor.ExecuteContext.
+func (t *Template) ExecuteContext(ctx gocontext.Context, wr io.Writer, data interface{}, funcs ...interface{}) error {
+	if err := t.escape(); err != nil {
+		return err
+	}
+	return t.CreateExecutor().ExecuteContext(ctx, wr, data, funcs...)
+}
+
+// Check executes the template with the data as Execute, discarding the
+// output, so the errors, of escaping as well, are detected before writing to
+// the real writer. See template.Executor.Check.
+func (t *Template) Check(data interface{}, funcs ...interface{}) error {
+	if err := t.escape(); err != nil {
+		return err
+	}
+	return t.CreateExecutor().Check(data, funcs...)
+}
+
+// Renderer returns a renderer of the template, escaped once, with its
+// functions. See template.Executor.Renderer.
+func (t *Template) Renderer() (*template.Renderer, error) {
+	if err := t.escape(); err != nil {
+		return nil, err
+	}
+	return t.CreateExecutor().Renderer(), nil
+}
+
+// BufferedExecute executes the template as Execute, writing the output to
+// wr only if the execution succeeds. See template.Executor.BufferedExecute.
+func (t *Template) BufferedExecute(wr io.Writer, data interface{}, funcs ...interface{}) error {
+	if err := t.escape(); err != nil {
+		return err
+	}
+	return t.CreateExecutor().BufferedExecute(wr, data, funcs...)
+}
+
 func (t *Template) ExecuteString(data interface{}) (string, error) {
 	return t.CreateExecutor().ExecuteString(data)
 }
 
+// ExecuteBytes applies the template to the data, returning the output. See
+// template.Executor.ExecuteBytes.
+func (t *Template) ExecuteBytes(data interface{}) ([]byte, error) {
+	return t.AppendExecute(nil, data)
+}
+
+// AppendExecute applies the template to the data, appending the output to
+// dst. See template.Executor.AppendExecute.
+func (t *Template) AppendExecute(dst []byte, data interface{}) ([]byte, error) {
+	if err := t.escape(); err != nil {
+		return dst, err
+	}
+	return t.CreateExecutor().AppendExecute(dst, data)
+}
+
 // lookupAndEscapeTemplate guarantees that the template with the given name
 // is escaped, or returns an error if it cannot be. It returns the named
 // template.
 func (t *Template) lookupAndEscapeTemplate(name string) (tmpl *Template, err error) {
 	t.nameSpace.mu.Lock()
 	defer t.nameSpace.mu.Unlock()
+	t.keepSources()
 	t.nameSpace.escaped = true
 	tmpl = t.set[name]
 	if tmpl == nil {
@@ -217,6 +324,18 @@ func (t *Template) DefinedTemplates() string {
 	return t.text.DefinedTemplates()
 }
 
+// FuncNames returns the sorted names of the functions t may call, including
+// the safe functions. See text/template.Executor.FuncNames.
+func (t *Template) FuncNames() []string {
+	return t.text.CreateExecutor().FuncsValues(builtins, t.funcs.Load()).SetOperandOutput(operandHTML).FuncNames()
+}
+
+// TemplateNames returns the sorted names of the templates associated with
+// t which a {{template}} action may call.
+func (t *Template) TemplateNames() []string {
+	return t.text.TemplateNames()
+}
+
 // Parse parses text as a template body for t.
 // Named template definitions ({{define ...}} or {{block ...}} statements) in text
 // define additional templates associated with t and are removed from the
@@ -229,11 +348,29 @@ func (t *Template) DefinedTemplates() string {
 // This allows using Parse to add new named template definitions without
 // overwriting the main template body.
 func (t *Template) Parse(text string, cb ...func(t *Template) error) (*Template, error) {
+	return t.ParseWithLimits(text, Limits{}, cb...)
+}
+
+// Limits bounds the resources used to parse a template. See parse.Limits.
+type Limits = template.Limits
+
+// ParseSigned parses text as the body of t, as Parse, once verified by the
+// signer as the text of the template named as t. See template.Signer.
+func (t *Template) ParseSigned(text, signature string, s *Signer) (*Template, error) {
+	if err := s.Verify(t.Name(), text, signature); err != nil {
+		return nil, err
+	}
+	return t.Parse(text)
+}
+
+// ParseWithLimits is like Parse, but rejects texts exceeding the limits
+// while parsing. Use it to parse untrusted templates.
+func (t *Template) ParseWithLimits(text string, limits Limits, cb ...func(t *Template) error) (*Template, error) {
 	if err := t.checkCanParse(); err != nil {
 		return nil, err
 	}
 
-	ret, err := t.text.Parse(text)
+	ret, err := t.text.ParseWithLimits(text, limits)
 	if err != nil {
 		return nil, err
 	}
@@ -249,6 +386,9 @@ func (t *Template) Parse(text string, cb ...func(t *Template) error) (*Template,
 		if tmpl == nil {
 			tmpl = t.new(name)
 		}
+		if tmpl.Tree != v.Tree {
+			t.nameSpace.forget(name)
+		}
 		tmpl.text = v
 		tmpl.Tree = v.Tree
 	}
@@ -278,12 +418,13 @@ func (t *Template) AddParseTree(name string, tree *parse.Tree) (*Template, error
 	if err != nil {
 		return nil, err
 	}
+	t.nameSpace.forget(name)
 	ret := &Template{
 		nil,
 		text,
 		text.Tree,
 		t.nameSpace,
-		nil,
+		funcs.AtomicFuncValues{},
 	}
 	t.set[name] = ret
 	return ret, nil
@@ -307,14 +448,14 @@ func (t *Template) Clone() (*Template, error) {
 	if err != nil {
 		return nil, err
 	}
-	ns := &nameSpace{set: make(map[string]*Template)}
+	ns := &nameSpace{set: make(map[string]*Template), policy: t.policy, unescaped: t.unescaped, onChange: t.onChange}
 	ns.esc = makeEscaper(ns)
 	ret := &Template{
 		nil,
 		textClone,
 		textClone.Tree,
 		ns,
-		nil,
+		funcs.AtomicFuncValues{},
 	}
 	ret.set[ret.Name()] = ret
 	for _, x := range textClone.Templates() {
@@ -329,7 +470,7 @@ func (t *Template) Clone() (*Template, error) {
 			x,
 			x.Tree,
 			ret.nameSpace,
-			nil,
+			funcs.AtomicFuncValues{},
 		}
 	}
 	// Return the template associated with the name of this template.
@@ -345,7 +486,7 @@ func New(name string) *Template {
 		template.New(name),
 		nil,
 		ns,
-		nil,
+		funcs.AtomicFuncValues{},
 	}
 	tmpl.set[name] = tmpl
 	return tmpl
@@ -367,7 +508,7 @@ func (t *Template) new(name string) *Template {
 		t.text.New(name),
 		nil,
 		t.nameSpace,
-		nil,
+		funcs.AtomicFuncValues{},
 	}
 	tmpl.set[name] = tmpl
 	return tmpl
@@ -388,6 +529,228 @@ func (t *Template) Delims(left, right string) *Template {
 	return t
 }
 
+// ParseMode sets the parsing mode, to be used in subsequent calls to Parse.
+// See text/template.Template.ParseMode.
+// The return value is the template, so calls can be chained.
+func (t *Template) ParseMode(mode parse.Mode) *Template {
+	t.text.ParseMode(mode)
+	return t
+}
+
+// TextHooks adds hooks rewriting the text between the actions, to be used in
+// subsequent calls to Parse. See text/template.Template.TextHooks.
+//
+// The hooks don't apply to the text of CSS, as the at-rules in
+// <style>@media print {...}</style>, nor of the raw text elements and of the
+// attributes of JavaScript. The context of the text is followed in the order
+// of the source, as if the actions wrote nothing.
+func (t *Template) TextHooks(hooks ...parse.TextHook) *Template {
+	t.text.TextHooks(hooks...).TextFilter(newTextFilter)
+	return t
+}
+
+// newTextFilter returns the filter of the text hooks of a parse, which
+// allows them in the contexts out of the raw text elements and of the style
+// and script attributes.
+func newTextFilter() parse.TextFilter {
+	var c context
+	return func(text string) func(offset int) bool {
+		var (
+			s      = []byte(text)
+			ends   []int
+			allows []bool
+		)
+		for i := 0; i < len(s); {
+			c1, n := contextAfterText(c, s[i:])
+			i += n
+			ends = append(ends, i)
+			allows = append(allows, (c.element == elementNone || isSVG(c.element)) && c.attr != attrStyle && c.attr != attrScript)
+			if n == 0 && c1.state == c.state {
+				break
+			}
+			c = c1
+		}
+		return func(offset int) bool {
+			for j, end := range ends {
+				if offset < end {
+					return allows[j]
+				}
+			}
+			return false
+		}
+	}
+}
+
+// Doc returns the documentation of t. See text/template.TemplateDoc.
+func (t *Template) Doc() (TemplateDoc, bool) {
+	return t.text.Doc()
+}
+
+// Docs returns the documentation of t and its associated templates, sorted
+// by name. See text/template.Template.Docs.
+func (t *Template) Docs() []TemplateDoc {
+	return t.text.Docs()
+}
+
+// Schema returns the description of the data expected by t. See
+// text/template.Template.Schema.
+func (t *Template) Schema() *Schema {
+	return t.text.Schema()
+}
+
+// Definitions returns where the templates associated with t are defined,
+// sorted by name. See text/template.Template.Definitions.
+func (t *Template) Definitions() []Definition {
+	return t.text.Definitions()
+}
+
+// Optimize rewrites the trees of the templates associated with t to execute
+// faster, taking the functions of t and values for user functions. See
+// text/template.Template.Optimize.
+func (t *Template) Optimize(values ...funcs.FuncValues) *Template {
+	t.text.Optimize(append([]funcs.FuncValues{builtins, t.funcs.Load()}, values...)...)
+	return t
+}
+
+// ReparseTemplate parses text as the new definition of the template named
+// name, associated with t. See text/template.Template.ReparseTemplate.
+//
+// If the templates have already been executed, the template and the
+// templates depending on it are escaped again when next executed, from the
+// copies of their trees kept before they were first escaped.
+func (t *Template) ReparseTemplate(name, text string) (*Template, error) {
+	ns := t.nameSpace
+	ns.mu.Lock()
+	nt, err := t.text.ReparseTemplate(name, text)
+	if err != nil {
+		ns.mu.Unlock()
+		return nil, err
+	}
+	changed := []string{name}
+	if ns.sources == nil {
+		changed = append(changed, t.text.Dependents(name)...)
+		t.reparsed(name, nt)
+	} else if changed, err = t.unescape(name, nt); err != nil {
+		ns.mu.Unlock()
+		return nil, err
+	}
+	ret := t.set[name]
+	listeners := ns.onChange
+	ns.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(changed)
+	}
+	return ret, nil
+}
+
+// reparsed sets nt as the text template of the template named name, to be
+// escaped again. The caller must hold t.nameSpace.mu.
+func (t *Template) reparsed(name string, nt *template.Template) {
+	tmpl := t.set[name]
+	if tmpl == nil {
+		tmpl = t.new(name)
+	}
+	t.nameSpace.forget(name)
+	tmpl.escapeErr = nil
+	tmpl.text = nt
+	tmpl.Tree = nt.Tree
+}
+
+// keepSources keeps copies of the trees of the templates associated with t
+// before they are first escaped, so ReparseTemplate can escape them again.
+// The caller must hold t.nameSpace.mu.
+func (t *Template) keepSources() {
+	ns := t.nameSpace
+	if ns.escaped {
+		return
+	}
+	ns.sources = template.New(t.text.Name())
+	for _, tmpl := range t.text.Templates() {
+		if tmpl.Tree != nil {
+			ns.sources.AddParseTree(tmpl.Name(), tmpl.Tree.Copy())
+		}
+	}
+}
+
+// unescape replaces the escaped trees of the template named name, reparsed
+// as nt, and of the templates depending on it, derived ones included, by
+// copies of their sources, and returns the names of the changed templates.
+// The caller must hold t.nameSpace.mu.
+func (t *Template) unescape(name string, nt *template.Template) ([]string, error) {
+	ns := t.nameSpace
+	if _, err := ns.sources.AddParseTree(name, nt.Tree.Copy()); err != nil {
+		return nil, err
+	}
+	changed := append([]string{name}, ns.sources.Dependents(name)...)
+	isChanged := make(map[string]bool, len(changed))
+	for _, name := range changed {
+		isChanged[name] = true
+	}
+	t.reparsed(name, nt)
+	for _, dep := range changed[1:] {
+		if src := ns.sources.Lookup(dep); src != nil && src.Tree != nil {
+			text, err := t.text.AddParseTree(dep, src.Tree.Copy())
+			if err != nil {
+				return nil, err
+			}
+			t.reparsed(dep, text)
+		}
+	}
+	// The templates derived for the other contexts are copied again, as
+	// the escaper looks them up before deriving them.
+	for _, tmpl := range t.text.Templates() {
+		base, _, ok := strings.Cut(tmpl.Name(), "$htmltemplate_")
+		if !ok || !isChanged[base] {
+			continue
+		}
+		if src := ns.sources.Lookup(base); src != nil && src.Tree != nil {
+			tree := &parse.Tree{Name: tmpl.Name(), Root: src.Root.CopyList()}
+			if _, err := t.text.AddParseTree(tmpl.Name(), tree); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for dname := range ns.esc.output {
+		if base, _, _ := strings.Cut(dname, "$htmltemplate_"); isChanged[base] {
+			delete(ns.esc.output, dname)
+			delete(ns.esc.derived, dname)
+		}
+	}
+	return changed, nil
+}
+
+// OnChange registers fn to be called with the names of the templates
+// changed by ReparseTemplate. See text/template.Template.OnChange.
+func (t *Template) OnChange(fn func(names []string)) *Template {
+	ns := t.nameSpace
+	ns.mu.Lock()
+	ns.onChange = append(ns.onChange[:len(ns.onChange):len(ns.onChange)], fn)
+	ns.mu.Unlock()
+	return t
+}
+
+// Dependents returns the names of the templates associated with t that
+// invoke the template named name. See text/template.Template.Dependents.
+func (t *Template) Dependents(name string) []string {
+	ns := t.nameSpace
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	if ns.sources != nil {
+		// The invocations of the escaped templates are renamed for their
+		// contexts.
+		return ns.sources.Dependents(name)
+	}
+	return t.text.Dependents(name)
+}
+
+// SetLogger sets the logger receiving the parse warnings of the templates
+// associated with t. See text/template.Template.SetLogger.
+func (t *Template) SetLogger(logger *slog.Logger) *Template {
+	t.text.SetLogger(logger)
+	return t
+}
+
 // Lookup returns the template with the given name that is associated with t,
 // or nil if there is no such template.
 func (t *Template) Lookup(name string) *Template {
@@ -430,7 +793,7 @@ func MustE(t *Template, err error) *Executor {
 // For instance, ParseFiles("a/foo", "b/foo") stores "b/foo" as the template
 // named "foo", while "a/foo" is unavailable.
 func ParseFiles(filenames ...string) (*Template, error) {
-	return parseFiles(nil, filenames...)
+	return parseFiles(nil, readFileOS, filenames...)
 }
 
 // ParseFiles parses the named files and associates the resulting templates with
@@ -442,27 +805,28 @@ func ParseFiles(filenames ...string) (*Template, error) {
 //
 // ParseFiles returns an error if t or any associated template has already been executed.
 func (t *Template) ParseFiles(filenames ...string) (*Template, error) {
-	return parseFiles(t, filenames...)
+	return parseFiles(t, readFileOS, filenames...)
 }
 
 // parseFiles is the helper for the method and function. If the argument
-// template is nil, it is created from the first file.
-func parseFiles(t *Template, filenames ...string) (*Template, error) {
-	if err := t.checkCanParse(); err != nil {
-		return nil, err
-	}
-
+// template is nil, it is created from the first file. The Path of the
+// templates is the name of their files.
+//
+// The files parsed before with the same content aren't parsed again, so
+// parsing the same files again, such as to check for changes, is cheap and
+// allowed after the execution, as long as they are unchanged.
+func parseFiles(t *Template, readFile func(string) (string, []byte, error), filenames ...string) (*Template, error) {
 	if len(filenames) == 0 {
 		// Not really a problem, but be consistent.
 		return nil, fmt.Errorf("html/template: no files named in call to ParseFiles")
 	}
 	for _, filename := range filenames {
-		b, err := ioutil.ReadFile(filename)
+		name, b, err := readFile(filename)
 		if err != nil {
 			return nil, err
 		}
 		s := string(b)
-		name := filepath.Base(filename)
+		fp := fingerprint(filename, b)
 		// First template becomes return value if not already defined,
 		// and we use that one for subsequent New calls to associate
 		// all the templates together. Also, if this file has the same name
@@ -473,15 +837,28 @@ func parseFiles(t *Template, filenames ...string) (*Template, error) {
 		if t == nil {
 			t = New(name)
 		}
+		t.nameSpace.mu.Lock()
+		parsed := t.nameSpace.parsedFile(name, fp)
+		t.nameSpace.mu.Unlock()
+		if parsed {
+			continue
+		}
+		if err := t.checkCanParse(); err != nil {
+			return nil, err
+		}
 		if name == t.Name() {
 			tmpl = t
 		} else {
 			tmpl = t.New(name)
 		}
+		tmpl.SetPath(filename)
 		_, err = tmpl.Parse(s)
 		if err != nil {
 			return nil, err
 		}
+		t.nameSpace.mu.Lock()
+		t.nameSpace.setFile(name, fp)
+		t.nameSpace.mu.Unlock()
 	}
 	return t, nil
 }
@@ -524,7 +901,56 @@ func parseGlob(t *Template, pattern string) (*Template, error) {
 	if len(filenames) == 0 {
 		return nil, fmt.Errorf("html/template: pattern matches no files: %#q", pattern)
 	}
-	return parseFiles(t, filenames...)
+	return parseFiles(t, readFileOS, filenames...)
+}
+
+// ParseFS is like ParseFiles or ParseGlob but reads from the file system fsys
+// instead of the host operating system's file system.
+// It accepts a list of glob patterns (see path.Match).
+// (Note that most file names serve as glob patterns matching only themselves.)
+func ParseFS(fsys fs.FS, patterns ...string) (*Template, error) {
+	return parseFS(nil, fsys, patterns)
+}
+
+// ParseFS is like ParseFiles or ParseGlob but reads from the file system fsys
+// instead of the host operating system's file system.
+// It accepts a list of glob patterns (see path.Match).
+// (Note that most file names serve as glob patterns matching only themselves.)
+func (t *Template) ParseFS(fsys fs.FS, patterns ...string) (*Template, error) {
+	return parseFS(t, fsys, patterns)
+}
+
+func parseFS(t *Template, fsys fs.FS, patterns []string) (*Template, error) {
+	var filenames []string
+	for _, pattern := range patterns {
+		list, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(list) == 0 {
+			return nil, fmt.Errorf("html/template: pattern matches no files: %#q", pattern)
+		}
+		filenames = append(filenames, list...)
+	}
+	return parseFiles(t, readFileFS(fsys), filenames...)
+}
+
+// readFileOS reads the file of the host operating system's file system and
+// returns the name of its template, its base name.
+func readFileOS(file string) (name string, b []byte, err error) {
+	name = filepath.Base(file)
+	b, err = os.ReadFile(file)
+	return
+}
+
+// readFileFS returns a function reading the files of fsys, and the names of
+// their templates, their base names.
+func readFileFS(fsys fs.FS) func(string) (string, []byte, error) {
+	return func(file string) (name string, b []byte, err error) {
+		name = path.Base(file)
+		b, err = fs.ReadFile(fsys, file)
+		return
+	}
 }
 
 // IsTrue reports whether the value is 'true', in the sense of not the zero of its type,
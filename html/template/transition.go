@@ -63,7 +63,9 @@ func tText(c context, s []byte) (context, int) {
 		}
 		j, e := eatTagName(s, i)
 		if j != i {
-			if end {
+			if c.element == elementSVG {
+				e = svgElement(e, end)
+			} else if end {
 				e = elementNone
 			}
 			// We've found an HTML tag.
@@ -74,11 +76,13 @@ func tText(c context, s []byte) (context, int) {
 }
 
 var elementContentType = [...]state{
-	elementNone:     stateText,
-	elementScript:   stateJS,
-	elementStyle:    stateCSS,
-	elementTextarea: stateRCDATA,
-	elementTitle:    stateRCDATA,
+	elementNone:      stateText,
+	elementScript:    stateJS,
+	elementStyle:     stateCSS,
+	elementTextarea:  stateRCDATA,
+	elementTitle:     stateRCDATA,
+	elementSVG:       stateText,
+	elementSVGNoHref: stateText,
 }
 
 // tTag is the context transition function for the tag state.
@@ -89,9 +93,14 @@ func tTag(c context, s []byte) (context, int) {
 		return c, len(s)
 	}
 	if s[i] == '>' {
+		e := c.element
+		if e == elementSVGNoHref {
+			// The SVG elements have no special body, but are in an <svg>.
+			e = elementSVG
+		}
 		return context{
 			state:   elementContentType[c.element],
-			element: c.element,
+			element: e,
 		}, i + 1
 	}
 	j, err := eatAttrName(s, i)
@@ -107,10 +116,18 @@ func tTag(c context, s []byte) (context, int) {
 	}
 
 	attrName := strings.ToLower(string(s[i:j]))
+	element := c.element
 	if c.element == elementScript && attrName == "type" {
 		attr = attrScriptType
 	} else {
-		switch attrType(attrName) {
+		typ := attrType(attrName)
+		if isSVG(c.element) {
+			typ = svgAttrType(attrName, c.element)
+			if attrName == "attributename" {
+				element = svgAnimationElement(s[j:])
+			}
+		}
+		switch typ {
 		case contentTypeURL:
 			attr = attrURL
 		case contentTypeCSS:
@@ -125,7 +142,7 @@ func tTag(c context, s []byte) (context, int) {
 	} else {
 		state = stateAfterName
 	}
-	return context{state: state, element: c.element, attr: attr}, j
+	return context{state: state, element: element, attr: attr}, j
 }
 
 // tAttrName is the context transition function for stateAttrName.
@@ -206,7 +223,7 @@ var (
 // tSpecialTagEnd is the context transition function for raw text and RCDATA
 // element states.
 func tSpecialTagEnd(c context, s []byte) (context, int) {
-	if c.element != elementNone {
+	if c.element != elementNone && !isSVG(c.element) {
 		if i := indexTagEnd(s, specialTagEndMarkers[c.element]); i != -1 {
 			return context{}, i
 		}
@@ -571,7 +588,14 @@ func eatTagName(s []byte, i int) (int, element) {
 		}
 		break
 	}
-	return j, elementNameMap[strings.ToLower(string(s[i:j]))]
+	name := strings.ToLower(string(s[i:j]))
+	if e, ok := elementNameMap[name]; ok {
+		return j, e
+	}
+	if name == "svg" {
+		return j, elementSVG
+	}
+	return j, elementNone
 }
 
 // eatWhiteSpace returns the largest j such that s[i:j] is white space.
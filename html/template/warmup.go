@@ -0,0 +1,70 @@
+package template
+
+import (
+	"errors"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// WarmUp prepares the templates associated with t for execution, at
+// startup: it escapes all the templates, caching an executor of each for
+// CreateExecutor and Execute, then warms up the underlying text templates.
+// See text/template.Template.WarmUp. The templates are prepared by up to
+// workers goroutines, or runtime.GOMAXPROCS(0) if workers is less than 1,
+// the escaping itself being serialized. The errors of all the templates are
+// returned joined, sorted by template name.
+//
+// As after Execute, the templates can't be parsed once warmed up.
+func (t *Template) WarmUp(workers int) error {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	t.nameSpace.mu.Lock()
+	names := make([]string, 0, len(t.set))
+	for name, tmpl := range t.set {
+		if tmpl.text.Tree != nil && tmpl.text.Root != nil {
+			names = append(names, name)
+		}
+	}
+	t.nameSpace.mu.Unlock()
+	sort.Strings(names)
+
+	var (
+		errs = make([]error, len(names)+1)
+		wg   sync.WaitGroup
+		jobs = make(chan int)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				errs[i] = t.warmUp(names[i])
+			}
+		}()
+	}
+	for i := range names {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	errs[len(names)] = t.text.WarmUp(workers)
+	return errors.Join(errs...)
+}
+
+// warmUp escapes the template named name and caches its executor.
+func (t *Template) warmUp(name string) error {
+	tmpl, err := t.lookupAndEscapeTemplate(name)
+	if err != nil {
+		return err
+	}
+	executor := tmpl.newExecutor()
+	ns := t.nameSpace
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	if ns.set[name] == tmpl {
+		ns.setExecutor(name, cachedExecutor{ns.files[name], executor})
+	}
+	return nil
+}
@@ -13,3 +13,12 @@ type Iterator interface {
 type IteratorGetter interface {
 	Iterator() Iterator
 }
+
+// KeyValueIterator is an Iterator of the pairs of keys and values of a map,
+// which range reads as the ones of a Go map, but in the order of the
+// iterator.
+type KeyValueIterator interface {
+	Iterator
+	// Pair returns the key and the value of the item.
+	Pair(item interface{}) (key, value interface{})
+}
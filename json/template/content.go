@@ -0,0 +1,88 @@
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/moisespsena-go/umbu/funcs"
+)
+
+// JSON encapsulates a known safe JSON text, written as is in place of the
+// values, once validated:
+//
+//	{"user": {{.User}}, "extra": {{.Extra}}}
+//
+// with Extra of type JSON. The json.RawMessage values are trusted as well.
+type JSON string
+
+// builtins are the escapers added to the pipelines of the actions.
+var builtins funcs.FuncValues
+
+func init() {
+	fv, err := funcs.CreateValuesFunc(funcs.FuncMap{
+		"_json_template_value":  valueEscaper,
+		"_json_template_key":    keyEscaper,
+		"_json_template_string": stringEscaper,
+	})
+	if err != nil {
+		panic(err)
+	}
+	builtins = fv
+}
+
+// valueEscaper returns the JSON encoding of the value.
+func valueEscaper(v interface{}) (string, error) {
+	var raw []byte
+	switch v := v.(type) {
+	case JSON:
+		raw = []byte(v)
+	case json.RawMessage:
+		raw = v
+	default:
+		return marshal(v)
+	}
+	if !json.Valid(raw) {
+		return "", fmt.Errorf("invalid JSON %q", raw)
+	}
+	return string(raw), nil
+}
+
+// keyEscaper returns the text of the value as a JSON string.
+func keyEscaper(v interface{}) string {
+	s, _ := marshal(text(v))
+	return s
+}
+
+// stringEscaper returns the text of the value escaped as the content of a
+// JSON string.
+func stringEscaper(v interface{}) string {
+	s := keyEscaper(v)
+	return s[1 : len(s)-1]
+}
+
+// marshal returns the JSON encoding of the value, without escaping the
+// HTML characters as json.Marshal does.
+func marshal(v interface{}) (string, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// text returns the text of the value, empty if nil.
+func text(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case JSON:
+		return string(v)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,46 @@
+package template
+
+import (
+	"sync"
+
+	"github.com/moisespsena-go/umbu/text/template/parse"
+)
+
+var (
+	safeActionsMu sync.RWMutex
+	safeActions   = map[string]bool{}
+)
+
+// RegisterSafeAction declares the output of the walker of the custom action
+// keyword, registered by template.RegisterAction, as a JSON value, trusted
+// as the values of type JSON. The output isn't escaped, so the actions of
+// the keyword are allowed only in place of a value and without a body, whose
+// context in the value can't be known.
+//
+// The custom actions of the keywords not declared fail the escaping. It is
+// intended to be called at initialization, after template.RegisterAction.
+func RegisterSafeAction(keyword string) {
+	safeActionsMu.Lock()
+	defer safeActionsMu.Unlock()
+	safeActions[keyword] = true
+}
+
+// escapeCustom escapes the action of a custom keyword, which must be
+// declared by RegisterSafeAction.
+func (e *escaper) escapeCustom(c context, n *parse.CustomNode) context {
+	safeActionsMu.RLock()
+	safe := safeActions[n.Keyword]
+	safeActionsMu.RUnlock()
+	switch {
+	case c.state == stateError:
+		return c
+	case !safe:
+		return e.errorf(n, "custom actions can't be escaped: %s isn't declared by RegisterSafeAction", n.Keyword)
+	case n.List != nil || n.ElseList != nil:
+		return e.errorf(n, "custom action %s with a body can't be escaped", n.Keyword)
+	case c.state != stateValue:
+		return e.errorf(n, "custom action %s is in the JSON context %v, not in place of a value", n.Keyword, c)
+	}
+	c.state = stateAfterValue
+	return c
+}
@@ -0,0 +1,36 @@
+/*
+Package template (json/template) implements data-driven templates for
+generating JSON output which is always valid, as the bodies of the API
+responses. It wraps package text/template, as html/template does, and should
+be used instead of it whenever the output is JSON.
+
+	tmpl := template.Must(template.New("user").Parse(`{
+		"name": {{.Name}},
+		"greeting": "Hello, {{.Name}}!",
+		"tags": [{{range $i, $t := .Tags}}{{if $i}}, {{end}}{{$t}}{{end}}]
+	}`))
+	err := tmpl.Execute(w, user)
+
+The escaping is contextual: the templates are rewritten, before their first
+execution, so the actions write
+
+  - in place of a value, the JSON encoding of the value of the action, as
+    "Ann" for a string, 3 for an int and {"a":1} for a map;
+  - in place of a key of an object, the value as a JSON string;
+  - within a string, the value escaped as the content of a JSON string.
+
+The actions which can't write a valid JSON text, as the ones following a
+value or within a number, fail the escaping with an error. The values of
+type JSON are trusted and written as is, once validated, as the output of
+the custom actions declared by RegisterSafeAction; the other custom actions
+fail the escaping.
+
+The output is buffered and validated before being written, so a template
+doesn't write a broken JSON text, as the ones with a missing comma, which
+the escaping can't detect. The template calls are escaped in the context of
+the call and must be called in the same context everywhere. So are the
+templates written by yield, whose name must be a constant and which must be
+the only command of its action; the output of render is a string, escaped
+as the one of any function.
+*/
+package template
@@ -0,0 +1,379 @@
+package template
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/moisespsena-go/umbu/text/template/parse"
+)
+
+// state is the part of the JSON text the output is in.
+type state uint8
+
+const (
+	// stateValue is where a value is expected: at the start of the text,
+	// after a ':' and in an array.
+	stateValue state = iota
+	// stateKey is where a key of an object is expected.
+	stateKey
+	// stateAfterKey is after a key, where a ':' is expected.
+	stateAfterKey
+	// stateAfterValue is after a value, where a ',' or the end of the
+	// object or the array is expected.
+	stateAfterValue
+	// stateString is within a string value.
+	stateString
+	// stateKeyString is within a string key.
+	stateKeyString
+	// stateEscape is after the '\' of an escape sequence of a string value.
+	stateEscape
+	// stateKeyEscape is after the '\' of an escape sequence of a string key.
+	stateKeyEscape
+	// stateError is an error, the err of the context.
+	stateError
+)
+
+var stateNames = [...]string{
+	stateValue:      "value",
+	stateKey:        "key",
+	stateAfterKey:   "after key",
+	stateAfterValue: "after value",
+	stateString:     "string",
+	stateKeyString:  "key string",
+	stateEscape:     "escape",
+	stateKeyEscape:  "key escape",
+	stateError:      "error",
+}
+
+func (s state) String() string {
+	return stateNames[s]
+}
+
+// context describes the state of the output at a point of a template.
+type context struct {
+	state state
+	stack string // the objects, as '{', and the arrays, as '[', open.
+	err   error
+}
+
+func (c context) String() string {
+	if c.err != nil {
+		return c.err.Error()
+	}
+	return fmt.Sprintf("{%s %q}", c.state, c.stack)
+}
+
+func (c context) eq(d context) bool {
+	return c.state == d.state && c.stack == d.stack && c.err == d.err
+}
+
+// top returns the innermost open object or array, 0 if none.
+func (c context) top() byte {
+	if c.stack == "" {
+		return 0
+	}
+	return c.stack[len(c.stack)-1]
+}
+
+// call is the escaping of a template for its input context.
+type call struct {
+	in, out context
+	// pending tells whether the template is being escaped, out being
+	// assumed for the recursive calls, and used whether it was.
+	pending, used bool
+}
+
+// escapeTemplate rewrites the template, and the ones it calls, so the
+// actions write valid JSON texts in their contexts, returning escapeOK if
+// escaped.
+func escapeTemplate(t *Template) error {
+	e := &escaper{
+		ns:    t.nameSpace,
+		calls: map[string]call{},
+		edits: map[*parse.ActionNode]string{},
+	}
+	c := e.escapeTree(context{}, t.Name(), t.text.Root)
+	if c.err == nil && (c.state != stateAfterValue || c.stack != "") {
+		c = e.errorf(t.text.Root, "%q ends in an incomplete JSON text: %v", t.Name(), c)
+	}
+	if c.err != nil {
+		return c.err
+	}
+	for n, esc := range e.edits {
+		n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Args:     []parse.Node{parse.NewIdentifier(esc).SetTree(nil).SetPos(n.Pipe.Position())},
+		})
+	}
+	for name, call := range e.calls {
+		e.ns.calls[name] = call
+	}
+	return escapeOK
+}
+
+// escaper collects the escapers of the actions of the templates escaped.
+// The actions are rewritten once all the templates are escaped.
+type escaper struct {
+	ns    *nameSpace
+	calls map[string]call              // the templates escaped, by name.
+	edits map[*parse.ActionNode]string // the escapers of the actions.
+	tree  *parse.Tree                  // the tree being escaped.
+}
+
+func (e *escaper) errorf(n parse.Node, format string, args ...interface{}) context {
+	location := ""
+	if e.tree != nil {
+		location, _ = e.tree.ErrorContext(n)
+		location += ": "
+	}
+	return context{state: stateError, err: fmt.Errorf("json/template: "+location+format, args...)}
+}
+
+// escapeTree escapes the named template in the context c, the one of its
+// call by the node n, returning its output context.
+func (e *escaper) escapeTree(c context, name string, n parse.Node) context {
+	cl, ok := e.calls[name]
+	if !ok {
+		cl, ok = e.ns.calls[name]
+	}
+	if ok {
+		if !cl.in.eq(c) {
+			return e.errorf(n, "template %q called in different JSON contexts: %v, %v", name, cl.in, c)
+		}
+		if cl.pending {
+			cl.used = true
+			e.calls[name] = cl
+		}
+		return cl.out
+	}
+	tmpl := e.ns.set[name]
+	if tmpl == nil || tmpl.text.Tree == nil || tmpl.text.Root == nil {
+		return e.errorf(n, "no such template %q", name)
+	}
+	assumed := c
+	if c.state == stateValue {
+		assumed.state = stateAfterValue
+	}
+	e.calls[name] = call{in: c, out: assumed, pending: true}
+	tree := e.tree
+	e.tree = tmpl.text.Tree
+	out := e.checkInvokes(tmpl.text.Root)
+	if out.err == nil {
+		out = e.escapeList(c, tmpl.text.Root)
+	}
+	e.tree = tree
+	if out.err == nil && e.calls[name].used && !out.eq(assumed) {
+		out = e.errorf(n, "recursive template %q ends in the JSON context %v, want %v", name, out, assumed)
+	}
+	e.calls[name] = call{in: c, out: out}
+	return out
+}
+
+// escape escapes the node in the context c, returning its output context.
+func (e *escaper) escape(c context, n parse.Node) context {
+	switch n := n.(type) {
+	case *parse.ActionNode:
+		if isYield(n) {
+			return e.escapeYield(c, n)
+		}
+		return e.escapeAction(c, n)
+	case *parse.CommentNode:
+		return c
+	case *parse.IfNode:
+		return e.escapeBranch(c, &n.BranchNode, "if")
+	case *parse.ListNode:
+		return e.escapeList(c, n)
+	case *parse.RangeNode:
+		return e.escapeBranch(c, &n.BranchNode, "range")
+	case *parse.TemplateNode:
+		if n.NameNode != nil {
+			return e.errorf(n, "dynamic template name %s can't be escaped", n.NameNode)
+		}
+		return e.escapeTree(c, n.Name, n)
+	case *parse.TextNode:
+		return e.escapeText(c, n)
+	case *parse.WithNode:
+		return e.escapeBranch(c, &n.BranchNode, "with")
+	case *parse.CustomNode:
+		return e.escapeCustom(c, n)
+	case *parse.ReturnNode:
+		// The value returned isn't output.
+		return c
+	}
+	return e.errorf(n, "%s actions can't be escaped", n.Type())
+}
+
+// escapeAction adds the escaper of the context to the action.
+func (e *escaper) escapeAction(c context, n *parse.ActionNode) context {
+	if len(n.Pipe.Decl) != 0 {
+		// A local variable assignment, not an interpolation.
+		return c
+	}
+	var esc string
+	switch c.state {
+	case stateError:
+		return c
+	case stateValue:
+		esc, c.state = "_json_template_value", stateAfterValue
+	case stateKey:
+		esc, c.state = "_json_template_key", stateAfterKey
+	case stateString, stateKeyString:
+		esc = "_json_template_string"
+	case stateAfterValue:
+		return e.errorf(n, "%s follows a JSON value", n)
+	case stateAfterKey:
+		return e.errorf(n, "%s is in place of the ':' of a JSON object", n)
+	default:
+		return e.errorf(n, "%s is in a JSON escape sequence", n)
+	}
+	if prev, ok := e.edits[n]; ok && prev != esc {
+		return e.errorf(n, "%s is in different JSON contexts", n)
+	}
+	e.edits[n] = esc
+	return c
+}
+
+// escapeBranch escapes a branch template node: "if", "range" and "with".
+func (e *escaper) escapeBranch(c context, n *parse.BranchNode, nodeName string) context {
+	c0 := e.escapeList(c, n.List)
+	if nodeName == "range" && c0.err == nil {
+		// The "true" branch of a "range" node can execute multiple times.
+		c1 := e.escapeList(c0, n.List)
+		if c0 = e.join(c0, c1, n, nodeName); c0.err != nil {
+			c0.err = fmt.Errorf("%v, on range loop re-entry", c0.err)
+			return c0
+		}
+	}
+	c1 := e.escapeList(c, n.ElseList)
+	return e.join(c0, c1, n, nodeName)
+}
+
+// escapeList escapes a list template node.
+func (e *escaper) escapeList(c context, n *parse.ListNode) context {
+	if n == nil {
+		return c
+	}
+	for _, m := range n.Nodes {
+		if c = e.escape(c, m); c.err != nil {
+			break
+		}
+	}
+	return c
+}
+
+// join returns the context of the end of the branches of the node. The
+// value or the key of a branch may follow the value of another, for the
+// commas written conditionally:
+//
+//	[{{range $i, $v := .}}{{if $i}},{{end}}{{$v}}{{end}}]
+//
+// The output is validated after the execution.
+func (e *escaper) join(a, b context, n parse.Node, nodeName string) context {
+	switch {
+	case a.err != nil:
+		return a
+	case b.err != nil:
+		return b
+	case a.eq(b):
+		return a
+	case a.stack == b.stack && a.state == stateAfterValue && (b.state == stateValue || b.state == stateKey):
+		return b
+	case a.stack == b.stack && b.state == stateAfterValue && (a.state == stateValue || a.state == stateKey):
+		return a
+	}
+	return e.errorf(n, "{{%s}} branches end in different JSON contexts: %v, %v", nodeName, a, b)
+}
+
+// escapeText returns the context of the end of the text.
+func (e *escaper) escapeText(c context, n *parse.TextNode) context {
+	s := n.Text
+	for i := 0; i < len(s) && c.err == nil; i++ {
+		b := s[i]
+		switch c.state {
+		case stateString, stateKeyString:
+			switch {
+			case b == '\\':
+				c.state += stateEscape - stateString
+			case b == '"' && c.state == stateString:
+				c.state = stateAfterValue
+			case b == '"':
+				c.state = stateAfterKey
+			case b < 0x20:
+				c = e.errorf(n, "control character %q in a JSON string", b)
+			}
+			continue
+		case stateEscape, stateKeyEscape:
+			c.state -= stateEscape - stateString
+			continue
+		}
+		if b == ' ' || b == '\t' || b == '\n' || b == '\r' {
+			continue
+		}
+		switch c.state {
+		case stateValue:
+			switch {
+			case b == '"':
+				c.state = stateString
+			case b == '{':
+				c.stack += "{"
+				c.state = stateKey
+			case b == '[':
+				c.stack += "["
+			case b == ']' && c.top() == '[':
+				c.stack = c.stack[:len(c.stack)-1]
+				c.state = stateAfterValue
+			case b == ',' && c.top() == '[':
+				// The comma of a value written conditionally.
+			case b == ',' && c.top() == '{':
+				c.state = stateKey
+			case b == '-' || '0' <= b && b <= '9' || 'a' <= b && b <= 'z':
+				j := i + 1
+				for j < len(s) && isLiteral(s[j]) {
+					j++
+				}
+				if !json.Valid(s[i:j]) {
+					return e.errorf(n, "invalid JSON literal %q", s[i:j])
+				}
+				i = j - 1
+				c.state = stateAfterValue
+			default:
+				c = e.errorf(n, "unexpected %q in place of a JSON value", b)
+			}
+		case stateKey:
+			switch {
+			case b == '"':
+				c.state = stateKeyString
+			case b == '}':
+				c.stack = c.stack[:len(c.stack)-1]
+				c.state = stateAfterValue
+			case b == ',':
+				// The comma of a key written conditionally.
+			default:
+				c = e.errorf(n, "unexpected %q in place of a JSON object key", b)
+			}
+		case stateAfterKey:
+			if b != ':' {
+				c = e.errorf(n, "unexpected %q in place of the ':' of a JSON object", b)
+			}
+			c.state = stateValue
+		case stateAfterValue:
+			switch {
+			case b == ',' && c.top() == '{':
+				c.state = stateKey
+			case b == ',' && c.top() == '[':
+				c.state = stateValue
+			case b == '}' && c.top() == '{', b == ']' && c.top() == '[':
+				c.stack = c.stack[:len(c.stack)-1]
+			default:
+				c = e.errorf(n, "unexpected %q after a JSON value", b)
+			}
+		}
+	}
+	return c
+}
+
+// isLiteral reports whether b may be part of a number or of the true, false
+// and null literals.
+func isLiteral(b byte) bool {
+	return '0' <= b && b <= '9' || 'a' <= b && b <= 'z' || b == '.' || b == '+' || b == '-' || b == 'E'
+}
@@ -0,0 +1,134 @@
+package template
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/moisespsena-go/umbu/text/template"
+	"github.com/moisespsena-go/umbu/text/template/parse"
+)
+
+func TestEscape(t *testing.T) {
+	type user struct {
+		Name  string
+		Age   int
+		Tags  []string
+		Extra interface{}
+	}
+	data := user{Name: "Ann \"A\"\n<b>", Age: 30, Tags: []string{"a", "b"}, Extra: map[string]int{"x": 1}}
+	for _, test := range []struct{ text, want string }{
+		{`{{.Name}}`, `"Ann \"A\"\n<b>"`},
+		{`{"name": {{.Name}}, "age": {{.Age}}, "extra": {{.Extra}}}`, `{"name": "Ann \"A\"\n<b>", "age": 30, "extra": {"x":1}}`},
+		{`{"greeting": "Hello, {{.Name}}!"}`, `{"greeting": "Hello, Ann \"A\"\n<b>!"}`},
+		{`{ {{.Age}}: {{.Tags}} }`, `{ "30": ["a","b"] }`},
+		{`{"{{.Age}}": true}`, `{"30": true}`},
+		{`[{{range $i, $t := .Tags}}{{if $i}}, {{end}}{{$t}}{{end}}]`, `["a", "b"]`},
+		{`{{"{"}}`, `"{"`},
+		{`[{{range .Tags}}{"tag": {{.}}, "n": 1},{{end}} null]`, `[{"tag": "a", "n": 1},{"tag": "b", "n": 1}, null]`},
+		{`{ {{range $i, $t := .Tags}}{{if $i}},{{end}}{{$t}}: {{$i}}{{end}} }`, `{ "a": 0,"b": 1 }`},
+		{`{{if .Age}}{{.Age}}{{else}}null{{end}}`, `30`},
+		{`{{$n := .Name}}{"n": {{$n}}, "raw": {{json_raw}}}`, `{"n": "Ann \"A\"\n<b>", "raw": [1, 2]}`},
+		{`[{{template "item" .Name}}, {{template "item" .Age}}]{{define "item"}}{"v": {{.}}}{{end}}`, `[{"v": "Ann \"A\"\n<b>"}, {"v": 30}]`},
+	} {
+		tmpl, err := New("x").Funcs(FuncMap{"json_raw": func() JSON { return "[1, 2]" }}).Parse(test.text)
+		if err != nil {
+			t.Fatalf("%s: %v", test.text, err)
+		}
+		out, err := tmpl.ExecuteString(data)
+		if err != nil || out != test.want {
+			t.Errorf("%s: got %s, %v, want %s", test.text, out, err, test.want)
+		}
+		if err == nil && !json.Valid([]byte(out)) {
+			t.Errorf("%s: invalid output %s", test.text, out)
+		}
+	}
+}
+
+func TestEscapeErrors(t *testing.T) {
+	for _, test := range []struct{ text, err string }{
+		{`{"a": 1 {{.}}}`, `{{.}} follows a JSON value`},
+		{`{"a" {{.}}}`, `{{.}} is in place of the ':' of a JSON object`},
+		{`"\{{.}}"`, `{{.}} is in a JSON escape sequence`},
+		{`{"a": 1{{.}}}`, `{{.}} follows a JSON value`},
+		{`{"a": tru}`, `invalid JSON literal "tru"`},
+		{`{"a": 1]`, `unexpected ']' after a JSON value`},
+		{`{a: 1}`, `unexpected 'a' in place of a JSON object key`},
+		{`{"a": 1`, `ends in an incomplete JSON text`},
+		{`{{if .}}[{{else}}{{end}}1]`, `{{if}} branches end in different JSON contexts`},
+		{`[{{range .}}{{.}}{{end}}]`, `follows a JSON value`},
+		{`[{{template "item" .}}, "{{template "item" .}}"]{{define "item"}}{{.}}{{end}}`, `template "item" called in different JSON contexts`},
+		{`{{template .}}`, `dynamic template name`},
+		{`[{{print (yield "item" .)}}]{{define "item"}}1{{end}}`, `yield can't be escaped unless the only command of its action`},
+		{`[{{yield .}}]`, `dynamic template name`},
+		{`[{{tpl_yield "item" .}}]{{define "item"}}1{{end}}`, `tpl_yield can't be escaped, use yield`},
+	} {
+		tmpl, err := New("x").Parse(test.text)
+		if err == nil {
+			_, err = tmpl.ExecuteString(1)
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got error %v, want %q", test.text, err, test.err)
+		}
+	}
+}
+
+func TestEscapeInvokes(t *testing.T) {
+	// The data can't add members to the object through the templates
+	// invoked: the ones yielded are escaped in the context of the action and
+	// the output of render is a string.
+	const hostile = `x", "admin": true, "y": "z`
+	for _, test := range []struct{ text, want string }{
+		{`{"a": "{{yield "x" .}}"}{{define "x"}}{{.}}{{end}}`, `{"a": "x\", \"admin\": true, \"y\": \"z"}`},
+		{`{"a": {{yield "x" .}}}{{define "x"}}{{.}}{{end}}`, `{"a": "x\", \"admin\": true, \"y\": \"z"}`},
+		{`{"a": {{render "x" .}}}{{define "x"}}"{{.}}"{{end}}`, `{"a": "\"x\", \"admin\": true, \"y\": \"z\""}`},
+	} {
+		var b strings.Builder
+		err := Must(New("page").Parse(test.text)).Execute(&b, hostile)
+		if err != nil || b.String() != test.want {
+			t.Errorf("%s: got %s, %v, want %s", test.text, b.String(), err, test.want)
+		}
+	}
+}
+
+func TestEscapeCustomAction(t *testing.T) {
+	write := func(s *template.State, dot reflect.Value, n *parse.CustomNode) {
+		io.WriteString(s.Writer(), `{"v": 1}`)
+	}
+	template.RegisterAction(parse.Keyword{Name: "jsonsafeobj"}, write)
+	template.RegisterAction(parse.Keyword{Name: "jsonrawobj"}, write)
+	template.RegisterAction(parse.Keyword{Name: "jsonsafeblock", Block: true}, write)
+	RegisterSafeAction("jsonsafeobj")
+	RegisterSafeAction("jsonsafeblock")
+	if out, err := Must(New("x").Parse(`{"a": {{jsonsafeobj}}, "b": {{.}}}`)).ExecuteString(1); err != nil || out != `{"a": {"v": 1}, "b": 1}` {
+		t.Errorf("got %s, %v", out, err)
+	}
+	for _, test := range []struct{ text, err string }{
+		{`{"a": {{jsonrawobj}}}`, `custom actions can't be escaped: jsonrawobj isn't declared`},
+		{`{"a": "{{jsonsafeobj}}"}`, `custom action jsonsafeobj is in the JSON context`},
+		{`{"a": {{jsonsafeblock}}{{.}}{{end}}}`, `custom action jsonsafeblock with a body can't be escaped`},
+	} {
+		if _, err := Must(New("x").Parse(test.text)).ExecuteString(1); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got error %v, want %q", test.text, err, test.err)
+		}
+	}
+}
+
+func TestInvalidOutput(t *testing.T) {
+	tmpl := Must(New("x").Parse(`[{{range .}}{{.}},{{end}}]`))
+	var b strings.Builder
+	if err := tmpl.Execute(&b, []int{1, 2}); err == nil || !strings.Contains(err.Error(), "invalid output") || b.Len() != 0 {
+		t.Errorf("got %q, %v", b.String(), err)
+	}
+	if out, err := tmpl.ExecuteString(nil); err != nil || out != "[]" {
+		t.Errorf("got %q, %v", out, err)
+	}
+	if _, err := Must(New("x").Parse(`{{.}}`)).ExecuteString(JSON("{")); err == nil || !strings.Contains(err.Error(), `invalid JSON "{"`) {
+		t.Errorf("got %v", err)
+	}
+	if _, err := tmpl.Parse(`1`); err == nil {
+		t.Error("parsed after execute")
+	}
+}
@@ -0,0 +1,64 @@
+package template
+
+import "github.com/moisespsena-go/umbu/text/template/parse"
+
+// isYield reports whether the action writes a template by the yield
+// builtin, as {{yield "item" .}}, the only form of yield escaped.
+func isYield(n *parse.ActionNode) bool {
+	if len(n.Pipe.Decl) != 0 || len(n.Pipe.Cmds) != 1 {
+		return false
+	}
+	id, ok := n.Pipe.Cmds[0].Args[0].(*parse.IdentifierNode)
+	return ok && id.Ident == "yield"
+}
+
+// checkInvokes checks the builtins invoking templates in the body: the
+// output of render is a string, escaped as the one of any function, but
+// yield writes the output of its template, so it must be the only command
+// of its action, escaped by escapeYield. The deprecated builtins writing
+// templates can't be escaped.
+func (e *escaper) checkInvokes(root *parse.ListNode) (c context) {
+	yields := map[*parse.CommandNode]bool{}
+	parse.Inspect(root, func(n parse.Node) bool {
+		switch n := n.(type) {
+		case *parse.ActionNode:
+			if isYield(n) {
+				yields[n.Pipe.Cmds[0]] = true
+			}
+		case *parse.CommandNode:
+			id, ok := n.Args[0].(*parse.IdentifierNode)
+			if !ok {
+				break
+			}
+			switch id.Ident {
+			case "yield":
+				if !yields[n] {
+					c = e.errorf(n, "yield can't be escaped unless the only command of its action")
+				}
+			case "tpl_render", "template_exec":
+				c = e.errorf(n, "%s can't be escaped, use render", id.Ident)
+			case "tpl_yield":
+				c = e.errorf(n, "%s can't be escaped, use yield", id.Ident)
+			}
+		}
+		return c.err == nil
+	})
+	return
+}
+
+// escapeYield escapes the action writing a template by yield: the template
+// is escaped in the context of the action, as by {{template}}.
+func (e *escaper) escapeYield(c context, n *parse.ActionNode) context {
+	if c.state == stateError {
+		return c
+	}
+	cmd := n.Pipe.Cmds[0]
+	if len(cmd.Args) < 2 {
+		return e.errorf(n, "yield without a template name")
+	}
+	name, ok := cmd.Args[1].(*parse.StringNode)
+	if !ok {
+		return e.errorf(n, "dynamic template name %s can't be escaped", cmd.Args[1])
+	}
+	return e.escapeTree(c, name.Text, n)
+}
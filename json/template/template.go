@@ -0,0 +1,214 @@
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"sync"
+
+	"github.com/moisespsena-go/umbu/funcs"
+	"github.com/moisespsena-go/umbu/text/template"
+)
+
+// FuncMap is the type of the map defining the mapping from names to
+// functions. See text/template.FuncMap.
+type FuncMap = funcs.FuncMap
+
+// Template is a specialized Template from "text/template" that produces a
+// valid JSON text.
+type Template struct {
+	// Sticky error if escaping fails, or escapeOK if succeeded.
+	escapeErr  error
+	text       *template.Template
+	*nameSpace // common to all associated templates
+}
+
+// escapeOK is a sentinel value used to indicate valid escaping.
+var escapeOK = fmt.Errorf("template escaped correctly")
+
+// nameSpace is the data structure shared by all templates in an association.
+type nameSpace struct {
+	mu      sync.Mutex
+	set     map[string]*Template
+	escaped bool
+	// calls are the contexts of the templates escaped, by name.
+	calls map[string]call
+}
+
+// New allocates a new JSON template with the given name.
+func New(name string) *Template {
+	ns := &nameSpace{set: map[string]*Template{}, calls: map[string]call{}}
+	tmpl := &Template{text: template.New(name), nameSpace: ns}
+	tmpl.set[name] = tmpl
+	return tmpl
+}
+
+// Must is a helper that wraps a call to a function returning (*Template, error)
+// and panics if the error is non-nil.
+func Must(t *Template, err error) *Template {
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// New allocates a new JSON template associated with the given one and with
+// the same delimiters.
+func (t *Template) New(name string) *Template {
+	t.nameSpace.mu.Lock()
+	defer t.nameSpace.mu.Unlock()
+	return t.new(name)
+}
+
+// new is the implementation of New, without the lock.
+func (t *Template) new(name string) *Template {
+	tmpl := &Template{text: t.text.New(name), nameSpace: t.nameSpace}
+	tmpl.set[name] = tmpl
+	return tmpl
+}
+
+// Name returns the name of the template.
+func (t *Template) Name() string {
+	return t.text.Name()
+}
+
+// Funcs adds the functions of the maps to the template's function map. It
+// must be called before the template is parsed.
+func (t *Template) Funcs(funcMaps ...FuncMap) *Template {
+	t.text.Funcs(funcMaps...)
+	return t
+}
+
+// Delims sets the action delimiters to the specified strings, to be used in
+// subsequent calls to Parse. See text/template.Template.Delims.
+func (t *Template) Delims(left, right string) *Template {
+	t.text.Delims(left, right)
+	return t
+}
+
+// Option sets options for the template. See text/template.Template.Option.
+func (t *Template) Option(opt ...string) *Template {
+	t.text.Option(opt...)
+	return t
+}
+
+// Lookup returns the template with the given name that is associated with
+// t, or nil if there is no such template.
+func (t *Template) Lookup(name string) *Template {
+	t.nameSpace.mu.Lock()
+	defer t.nameSpace.mu.Unlock()
+	return t.set[name]
+}
+
+// Parse parses text as a template body for t. The named template
+// definitions define additional templates associated with t. Templates may
+// not be parsed after the first execution of any of them.
+func (t *Template) Parse(text string) (*Template, error) {
+	if err := t.checkCanParse(); err != nil {
+		return nil, err
+	}
+	if _, err := t.text.Parse(text); err != nil {
+		return nil, err
+	}
+	t.update()
+	return t, nil
+}
+
+// ParseFS parses the templates of the files of fsys matching the patterns,
+// as fs.Glob. See text/template.Template.ParseFS.
+func (t *Template) ParseFS(fsys fs.FS, patterns ...string) (*Template, error) {
+	if err := t.checkCanParse(); err != nil {
+		return nil, err
+	}
+	if _, err := t.text.ParseFS(fsys, patterns...); err != nil {
+		return nil, err
+	}
+	t.update()
+	return t, nil
+}
+
+// update adds the templates defined by the parsed texts to the set.
+func (t *Template) update() {
+	t.nameSpace.mu.Lock()
+	defer t.nameSpace.mu.Unlock()
+	for _, v := range t.text.Templates() {
+		tmpl := t.set[v.Name()]
+		if tmpl == nil {
+			tmpl = t.new(v.Name())
+		}
+		tmpl.text = v
+	}
+}
+
+// checkCanParse checks whether it is OK to parse templates.
+func (t *Template) checkCanParse() error {
+	t.nameSpace.mu.Lock()
+	defer t.nameSpace.mu.Unlock()
+	if t.nameSpace.escaped {
+		return fmt.Errorf("json/template: cannot Parse after Execute")
+	}
+	return nil
+}
+
+// escape escapes t and the templates it calls.
+func (t *Template) escape() error {
+	t.nameSpace.mu.Lock()
+	defer t.nameSpace.mu.Unlock()
+	t.nameSpace.escaped = true
+	if t.escapeErr == nil {
+		if t.text.Tree == nil || t.text.Root == nil {
+			return fmt.Errorf("json/template: %q is an incomplete or empty template", t.Name())
+		}
+		t.escapeErr = escapeTemplate(t)
+	}
+	if t.escapeErr != escapeOK {
+		return t.escapeErr
+	}
+	return nil
+}
+
+// CreateExecutor returns a new executor of t, writing the output unchecked.
+// Use it only once t is escaped, as by Execute.
+func (t *Template) CreateExecutor() *template.Executor {
+	return t.text.CreateExecutor().FuncsValues(builtins)
+}
+
+// Execute applies the template to the data and writes the output to wr if
+// it is a valid JSON text. Nothing is written on errors.
+func (t *Template) Execute(wr io.Writer, data interface{}) error {
+	if err := t.escape(); err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	if err := t.CreateExecutor().Execute(&b, data); err != nil {
+		return err
+	}
+	var raw json.RawMessage
+	if err := json.Unmarshal(b.Bytes(), &raw); err != nil {
+		return fmt.Errorf("json/template: %q: invalid output: %v", t.Name(), err)
+	}
+	_, err := b.WriteTo(wr)
+	return err
+}
+
+// ExecuteTemplate applies the template associated with t that has the given
+// name to the data, as Execute.
+func (t *Template) ExecuteTemplate(wr io.Writer, name string, data interface{}) error {
+	tmpl := t.Lookup(name)
+	if tmpl == nil {
+		return fmt.Errorf("json/template: no template %q associated with template %q", name, t.Name())
+	}
+	return tmpl.Execute(wr, data)
+}
+
+// ExecuteString applies the template to the data, as Execute, returning
+// the output.
+func (t *Template) ExecuteString(data interface{}) (string, error) {
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,316 @@
+// Package loader loads templates from a source store, such as a database
+// table of templates edited by the end users, and caches the parsed
+// templates until their sources change.
+package loader
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+	"time"
+
+	"github.com/moisespsena-go/umbu/text/template"
+)
+
+// SourceStore stores the sources of the templates.
+type SourceStore interface {
+	// Get returns the source of the template named name and its version,
+	// which changes whenever the source changes. It returns an error matching
+	// fs.ErrNotExist if the store hasn't the template.
+	Get(name string) (source, version string, err error)
+}
+
+// StoreFunc is a function implementing SourceStore.
+type StoreFunc func(name string) (source, version string, err error)
+
+func (f StoreFunc) Get(name string) (source, version string, err error) {
+	return f(name)
+}
+
+// SQLStore is a SourceStore reading the templates from a database. Query
+// selects the source and the version of the template named by its only
+// argument, as:
+//
+//	SELECT source, updated_at FROM templates WHERE name = $1
+//
+// The version is scanned as a string.
+type SQLStore struct {
+	DB    *sql.DB
+	Query string
+}
+
+func (s *SQLStore) Get(name string) (source, version string, err error) {
+	err = s.DB.QueryRow(s.Query, name).Scan(&source, &version)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = fmt.Errorf("template %q: %w", name, fs.ErrNotExist)
+	}
+	return
+}
+
+// MapStore is an in memory SourceStore. The version of a template is the
+// count of its updates. It is safe for concurrent use.
+type MapStore struct {
+	mu      sync.RWMutex
+	sources map[string]mapSource
+}
+
+type mapSource struct {
+	source  string
+	version int
+}
+
+// Set sets the source of the template named name.
+func (s *MapStore) Set(name, source string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sources == nil {
+		s.sources = make(map[string]mapSource)
+	}
+	s.sources[name] = mapSource{source, s.sources[name].version + 1}
+}
+
+// Delete removes the template named name.
+func (s *MapStore) Delete(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sources, name)
+}
+
+func (s *MapStore) Get(name string) (source, version string, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	src, ok := s.sources[name]
+	if !ok {
+		return "", "", fmt.Errorf("template %q: %w", name, fs.ErrNotExist)
+	}
+	return src.source, fmt.Sprint(src.version), nil
+}
+
+// Loader loads the templates of a SourceStore and caches them.
+//
+// A template is parsed in a clone of the base template, so it may call the
+// templates defined by the base. The other templates it calls are loaded
+// from the store on demand, see template.TemplateProvider, and are cached
+// with it.
+//
+// The cached template is returned until any of its sources, including
+// those of the templates it called, changes version. The versions are
+// checked again once the TTL elapses; a zero TTL checks them on every Get.
+// Invalidate drops the cached templates, as when the store notifies their
+// changes.
+type Loader struct {
+	store SourceStore
+	base  *template.Template
+	ttl   time.Duration
+	codec template.SourceCodec
+	now   func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]*entry
+	loads map[string]*loading // Loads in progress, by name.
+	gen   int                 // Count of the invalidations.
+}
+
+// loading is a load of a template in progress, shared by the Gets of the
+// template while it reads the store.
+type loading struct {
+	done chan struct{}
+	tmpl *template.Template
+	err  error
+}
+
+// entry is a cached template.
+type entry struct {
+	tmpl    *template.Template
+	checked time.Time
+
+	mu       sync.Mutex
+	versions map[string]string // Versions of the sources loaded by tmpl.
+}
+
+// New returns a loader of the templates of store. The base template, which
+// may be nil, provides the functions, the delimiters and the options of the
+// loaded templates and the templates they share.
+func New(store SourceStore, base *template.Template) *Loader {
+	if base == nil {
+		base = template.New("")
+	}
+	return &Loader{
+		store: store,
+		base:  base,
+		now:   time.Now,
+		cache: make(map[string]*entry),
+		loads: make(map[string]*loading),
+	}
+}
+
+// SetTTL sets how long the cached templates are used before checking the
+// versions of their sources.
+func (l *Loader) SetTTL(ttl time.Duration) *Loader {
+	l.ttl = ttl
+	return l
+}
+
+// SetCodec sets the codec of the sources of the store, as the encrypted
+// texts of the templates authored by the customers, decoded when parsed:
+//
+//	codec, err := template.NewAESCodec(key)
+//	l := loader.New(&loader.SQLStore{DB: db, Query: query}, base).SetCodec(codec)
+//
+// The versions aren't decoded. See template.SourceCodec.
+func (l *Loader) SetCodec(codec template.SourceCodec) *Loader {
+	l.codec = codec
+	return l
+}
+
+// Get returns the template named name, loading it if not cached or stale.
+// The name may be the versioned name of a template of a VersionedStore, see
+// template.VersionedName.
+// It returns an error matching fs.ErrNotExist if the store hasn't the
+// template.
+//
+// The store is read out of the lock of the loader, once for the concurrent
+// Gets of a template, which wait for it, so the other templates are served
+// meanwhile.
+func (l *Loader) Get(name string) (*template.Template, error) {
+	l.mu.Lock()
+	now := l.now()
+	e := l.cache[name]
+	if e != nil && now.Sub(e.checked) < l.ttl {
+		l.mu.Unlock()
+		return e.tmpl, nil
+	}
+	if ld := l.loads[name]; ld != nil {
+		l.mu.Unlock()
+		<-ld.done
+		return ld.tmpl, ld.err
+	}
+	ld := &loading{done: make(chan struct{})}
+	l.loads[name] = ld
+	gen := l.gen
+	l.mu.Unlock()
+
+	defer close(ld.done)
+	ld.tmpl, ld.err = l.refresh(name, e, now, gen)
+	return ld.tmpl, ld.err
+}
+
+// refresh returns the template of the entry e, if its sources are
+// unchanged, or loads it again, caching it unless invalidated meanwhile.
+func (l *Loader) refresh(name string, e *entry, now time.Time, gen int) (*template.Template, error) {
+	var err error
+	if e != nil {
+		var fresh bool
+		if fresh, err = l.fresh(e); err == nil && !fresh {
+			e = nil
+		}
+	}
+	if err == nil && e == nil {
+		e, err = l.load(name)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.loads, name)
+	if err != nil {
+		return nil, err
+	}
+	if gen == l.gen {
+		e.checked = now
+		l.cache[name] = e
+	}
+	return e.tmpl, nil
+}
+
+// Invalidate drops the cached templates loading any of the sources named,
+// in any version, or all of them if none is named.
+func (l *Loader) Invalidate(names ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.gen++
+	if len(names) == 0 {
+		l.cache = make(map[string]*entry)
+		return
+	}
+	for key, e := range l.cache {
+		e.mu.Lock()
+		for loaded := range e.versions {
+			if base, _ := template.SplitVersion(loaded); contains(names, base) || contains(names, loaded) {
+				delete(l.cache, key)
+				break
+			}
+		}
+		e.mu.Unlock()
+	}
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// load parses the template named name in a clone of the base template.
+func (l *Loader) load(name string) (*entry, error) {
+	source, version, err := l.source(name)
+	if err != nil {
+		return nil, err
+	}
+	set, err := l.base.Clone()
+	if err != nil {
+		return nil, err
+	}
+	e := &entry{versions: map[string]string{name: version}}
+	set.SetProvider(template.ProviderFunc(func(name string) (string, error) {
+		source, version, err := l.source(name)
+		if err == nil {
+			e.mu.Lock()
+			e.versions[name] = version
+			e.mu.Unlock()
+		}
+		return source, err
+	}))
+	if e.tmpl, err = set.New(name).Parse(source); err != nil {
+		return nil, err
+	}
+	e.tmpl.SetFuncs(l.base.GetFuncs())
+	return e, nil
+}
+
+// source returns the source of the template named name, decoded by the
+// codec, and its version.
+func (l *Loader) source(name string) (source, version string, err error) {
+	if source, version, err = l.get(name); err != nil || l.codec == nil {
+		return
+	}
+	if source, err = l.codec.Decode(name, source); err != nil {
+		err = fmt.Errorf("template %q: decode: %w", name, err)
+	}
+	return
+}
+
+// fresh reports whether the sources loaded by the entry are unchanged.
+func (l *Loader) fresh(e *entry) (bool, error) {
+	e.mu.Lock()
+	versions := make(map[string]string, len(e.versions))
+	for name, version := range e.versions {
+		versions[name] = version
+	}
+	e.mu.Unlock()
+	for name, version := range versions {
+		_, current, err := l.get(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		if current != version {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,222 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/moisespsena-go/umbu/funcs"
+	"github.com/moisespsena-go/umbu/text/template"
+)
+
+func execute(t *testing.T, l *Loader, name string, data interface{}) string {
+	t.Helper()
+	tmpl, err := l.Get(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tmpl.ExecuteString(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestLoader(t *testing.T) {
+	store := new(MapStore)
+	store.Set("page", `{{template "header" .}}<p>{{upper .}}</p>{{template "base"}}`)
+	store.Set("header", `<h1>{{.}}</h1>`)
+	base := template.Must(template.New("").Parse(`{{define "base"}}<footer/>{{end}}`))
+	base.Funcs(funcs.FuncMap{"upper": strings.ToUpper})
+	l := New(store, base)
+
+	now := time.Unix(0, 0)
+	l.now = func() time.Time { return now }
+	l.SetTTL(time.Minute)
+
+	if got, want := execute(t, l, "page", "a"), "<h1>a</h1><p>A</p><footer/>"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	first, _ := l.Get("page")
+
+	// The cached template is used within the TTL.
+	store.Set("header", `<h2>{{.}}</h2>`)
+	if got, want := execute(t, l, "page", "a"), "<h1>a</h1><p>A</p><footer/>"; got != want {
+		t.Errorf("within TTL: got %q, want %q", got, want)
+	}
+
+	// Then, the change of a called template reloads it.
+	now = now.Add(time.Minute)
+	if got, want := execute(t, l, "page", "a"), "<h2>a</h2><p>A</p><footer/>"; got != want {
+		t.Errorf("after TTL: got %q, want %q", got, want)
+	}
+
+	// Unchanged templates are kept.
+	now = now.Add(time.Minute)
+	second, _ := l.Get("page")
+	if second == first {
+		t.Error("stale template returned")
+	}
+	if again, _ := l.Get("page"); again != second {
+		t.Error("unchanged template reloaded")
+	}
+
+	store.Set("header", `<h3>{{.}}</h3>`)
+	l.Invalidate("header")
+	if got, want := execute(t, l, "page", "a"), "<h3>a</h3><p>A</p><footer/>"; got != want {
+		t.Errorf("after invalidation: got %q, want %q", got, want)
+	}
+
+	if _, err := l.Get("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing template: got error %v", err)
+	}
+	store.Delete("page")
+	now = now.Add(time.Minute)
+	if _, err := l.Get("page"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("deleted template: got error %v", err)
+	}
+}
+
+type versionedStore struct {
+	MapStore
+	versions map[string]string
+}
+
+func (s *versionedStore) GetVersion(name, version string) (string, error) {
+	source, ok := s.versions[template.VersionedName(name, version)]
+	if !ok {
+		return "", fs.ErrNotExist
+	}
+	return source, nil
+}
+
+type userKey struct{}
+
+func TestLoaderCodec(t *testing.T) {
+	codec, err := template.NewAESCodec([]byte("0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := new(MapStore)
+	for name, text := range map[string]string{"page": `{{template "header" .}}<p>{{.}}</p>`, "header": `<h1>{{.}}</h1>`} {
+		stored, err := codec.Encode(name, text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		store.Set(name, stored)
+	}
+	store.Set("plain", `{{.}}`)
+	l := New(store, nil).SetCodec(codec)
+	if got, want := execute(t, l, "page", "a"), "<h1>a</h1><p>a</p>"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if _, err := l.Get("plain"); err == nil || !strings.Contains(err.Error(), `template "plain": decode`) {
+		t.Errorf("got error %v, want the decode error", err)
+	}
+}
+
+func TestLoaderConcurrent(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		gets    = make(map[string]int)
+		started = make(chan struct{}, 1)
+		blocked = make(chan struct{})
+	)
+	store := StoreFunc(func(name string) (string, string, error) {
+		mu.Lock()
+		gets[name]++
+		mu.Unlock()
+		if name == "slow" {
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			<-blocked
+		}
+		return name, "1", nil
+	})
+	l := New(store, nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got := execute(t, l, "slow", nil); got != "slow" {
+				t.Errorf("got %q, want %q", got, "slow")
+			}
+		}()
+	}
+	// The other templates load while the store reads "slow", once for the
+	// concurrent Gets.
+	<-started
+	if got := execute(t, l, "fast", nil); got != "fast" {
+		t.Errorf("got %q, want %q", got, "fast")
+	}
+	mu.Lock()
+	if gets["slow"] != 1 {
+		t.Errorf("store read %d times, want 1", gets["slow"])
+	}
+	mu.Unlock()
+	close(blocked)
+	wg.Wait()
+}
+
+func TestRollout(t *testing.T) {
+	store := &versionedStore{versions: map[string]string{"welcome@v2": `Hi v2 {{.}}`}}
+	store.Set("welcome", `Hello {{.}}`)
+	store.Set("email", `[{{template "welcome" .}}]`)
+	l := New(store, nil)
+
+	rollout := &Rollout{Key: func(ctx context.Context) string {
+		user, _ := ctx.Value(userKey{}).(string)
+		return user
+	}}
+	rollout.Set("welcome", Stage{Version: "v2", Percent: 30})
+
+	tmpl, err := l.Get("email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		e := tmpl.CreateExecutor().SetVersionSelector(rollout.Select)
+		e.Context = context.WithValue(context.Background(), userKey{}, fmt.Sprint("user", i))
+		out, err := e.ExecuteString("ann")
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[out]++
+		again, _ := e.ExecuteString("ann")
+		if again != out {
+			t.Fatalf("user%d: got %q, then %q", i, out, again)
+		}
+	}
+	if v2 := counts["[Hi v2 ann]"]; v2 < 250 || v2 > 350 || v2+counts["[Hello ann]"] != 1000 {
+		t.Errorf("bad rollout: %v", counts)
+	}
+
+	// The executed templates are selected too.
+	rollout.Set("welcome", Stage{Version: "v2", Percent: 100})
+	welcome, err := l.Get("welcome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := welcome.CreateExecutor().SetVersionSelector(rollout.Select).ExecuteString("ann"); err != nil || out != "Hi v2 ann" {
+		t.Errorf("Execute: got %q, %v", out, err)
+	}
+	var buf strings.Builder
+	if err := tmpl.CreateExecutor().SetVersionSelector(rollout.Select).ExecuteTemplate(&buf, "welcome", "ann"); err != nil || buf.String() != "Hi v2 ann" {
+		t.Errorf("ExecuteTemplate: got %q, %v", buf.String(), err)
+	}
+
+	rollout.Set("welcome", Stage{Version: "v3", Percent: 100})
+	_, err = tmpl.CreateExecutor().SetVersionSelector(rollout.Select).ExecuteString("ann")
+	if err == nil || !strings.Contains(err.Error(), `template "welcome@v3" not defined`) {
+		t.Errorf("missing version: got error %v", err)
+	}
+}
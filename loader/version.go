@@ -0,0 +1,100 @@
+package loader
+
+import (
+	"context"
+	"hash/fnv"
+	"math/rand"
+	"sync"
+
+	"github.com/moisespsena-go/umbu/text/template"
+)
+
+// VersionedStore is a SourceStore keeping many versions of each template.
+// Get returns the current version, the one executed unless a version is
+// selected, see template.Executor.SetVersionSelector.
+type VersionedStore interface {
+	SourceStore
+	// GetVersion returns the source of the version of the template named
+	// name. It returns an error matching fs.ErrNotExist if the store hasn't
+	// the version.
+	GetVersion(name, version string) (source string, err error)
+}
+
+// get returns the source of the template named name, which may be a
+// versioned name (see template.VersionedName), and its version. The
+// versions kept by a VersionedStore never change, so their version is the
+// version name.
+func (l *Loader) get(name string) (source, version string, err error) {
+	if vs, ok := l.store.(VersionedStore); ok {
+		if base, v := template.SplitVersion(name); v != "" {
+			source, err = vs.GetVersion(base, v)
+			return source, v, err
+		}
+	}
+	return l.store.Get(name)
+}
+
+// Stage is a stage of the rollout of a template version: the version is
+// executed by Percent percent of the executions.
+type Stage struct {
+	Version string
+	Percent float64
+}
+
+// Rollout selects the versions of the templates being rolled out, as a
+// template.VersionSelector. It is safe for concurrent use.
+//
+// If Key is set, the share of executions is chosen by the hash of the key
+// returned for the context, such as the ID of the user, so the executions of
+// a key always get the same version. Otherwise the version is chosen at
+// random.
+type Rollout struct {
+	Key func(ctx context.Context) string
+
+	mu     sync.RWMutex
+	stages map[string]Stage
+}
+
+// Set sets the stage of the rollout of the template named name. A zero
+// percent stops the rollout, executing the current version again, and 100
+// percent executes the version always.
+func (r *Rollout) Set(name string, stage Stage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stages == nil {
+		r.stages = make(map[string]Stage)
+	}
+	if stage.Percent <= 0 {
+		delete(r.stages, name)
+		return
+	}
+	r.stages[name] = stage
+}
+
+// Stage returns the stage of the rollout of the template named name.
+func (r *Rollout) Stage(name string) (stage Stage, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	stage, ok = r.stages[name]
+	return
+}
+
+// Select implements template.VersionSelector.
+func (r *Rollout) Select(ctx context.Context, name string) string {
+	stage, ok := r.Stage(name)
+	if !ok {
+		return ""
+	}
+	var n float64
+	if r.Key != nil {
+		h := fnv.New32a()
+		h.Write([]byte(name + "\x00" + r.Key(ctx)))
+		n = float64(h.Sum32()%10000) / 100
+	} else {
+		n = rand.Float64() * 100
+	}
+	if n < stage.Percent {
+		return stage.Version
+	}
+	return ""
+}
@@ -0,0 +1,178 @@
+//go:build cldr
+
+package locale
+
+import "time"
+
+// The data of the locales below is derived from CLDR.
+func init() {
+	for _, l := range []*Locale{
+		{
+			Tag: "en-GB",
+			Months: [12]string{"January", "February", "March", "April", "May", "June", "July",
+				"August", "September", "October", "November", "December"},
+			ShortMonths: [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sept", "Oct", "Nov", "Dec"},
+			Days:        [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+			ShortDays:   [7]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"},
+			Decimal:     ".",
+			Group:       ",",
+			FirstDay:    time.Monday,
+		},
+		{
+			Tag: "de",
+			Months: [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli",
+				"August", "September", "Oktober", "November", "Dezember"},
+			ShortMonths: [12]string{"Jan.", "Feb.", "März", "Apr.", "Mai", "Juni", "Juli", "Aug.", "Sept.", "Okt.", "Nov.", "Dez."},
+			Days:        [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+			ShortDays:   [7]string{"So.", "Mo.", "Di.", "Mi.", "Do.", "Fr.", "Sa."},
+			Decimal:     ",",
+			Group:       ".",
+			Percent:     "%s\u00a0%",
+			FirstDay:    time.Monday,
+			Relative: &RelativeForms{
+				Now:    "jetzt",
+				Past:   "vor %s",
+				Future: "in %s",
+				Units: [Year + 1][2]string{
+					Second: {"%d Sekunde", "%d Sekunden"},
+					Minute: {"%d Minute", "%d Minuten"},
+					Hour:   {"%d Stunde", "%d Stunden"},
+					Day:    {"%d Tag", "%d Tagen"},
+					Week:   {"%d Woche", "%d Wochen"},
+					Month:  {"%d Monat", "%d Monaten"},
+					Year:   {"%d Jahr", "%d Jahren"},
+				},
+			},
+		},
+		{
+			Tag: "es",
+			Months: [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio",
+				"agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+			ShortMonths: [12]string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sept", "oct", "nov", "dic"},
+			Days:        [7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+			ShortDays:   [7]string{"dom", "lun", "mar", "mié", "jue", "vie", "sáb"},
+			Decimal:     ",",
+			Group:       ".",
+			Percent:     "%s\u00a0%",
+			FirstDay:    time.Monday,
+			Relative: &RelativeForms{
+				Now:    "ahora",
+				Past:   "hace %s",
+				Future: "dentro de %s",
+				Units: [Year + 1][2]string{
+					Second: {"%d segundo", "%d segundos"},
+					Minute: {"%d minuto", "%d minutos"},
+					Hour:   {"%d hora", "%d horas"},
+					Day:    {"%d día", "%d días"},
+					Week:   {"%d semana", "%d semanas"},
+					Month:  {"%d mes", "%d meses"},
+					Year:   {"%d año", "%d años"},
+				},
+			},
+		},
+		{
+			Tag: "fr",
+			Months: [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet",
+				"août", "septembre", "octobre", "novembre", "décembre"},
+			ShortMonths: [12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+			Days:        [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+			ShortDays:   [7]string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+			Decimal:     ",",
+			Group:       "\u202f",
+			Percent:     "%s\u202f%",
+			FirstDay:    time.Monday,
+			Relative: &RelativeForms{
+				Now:    "maintenant",
+				Past:   "il y a %s",
+				Future: "dans %s",
+				Units: [Year + 1][2]string{
+					Second: {"%d seconde", "%d secondes"},
+					Minute: {"%d minute", "%d minutes"},
+					Hour:   {"%d heure", "%d heures"},
+					Day:    {"%d jour", "%d jours"},
+					Week:   {"%d semaine", "%d semaines"},
+					Month:  {"%d mois", "%d mois"},
+					Year:   {"%d an", "%d ans"},
+				},
+			},
+		},
+		{
+			Tag: "it",
+			Months: [12]string{"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno", "luglio",
+				"agosto", "settembre", "ottobre", "novembre", "dicembre"},
+			ShortMonths: [12]string{"gen", "feb", "mar", "apr", "mag", "giu", "lug", "ago", "set", "ott", "nov", "dic"},
+			Days:        [7]string{"domenica", "lunedì", "martedì", "mercoledì", "giovedì", "venerdì", "sabato"},
+			ShortDays:   [7]string{"dom", "lun", "mar", "mer", "gio", "ven", "sab"},
+			Decimal:     ",",
+			Group:       ".",
+			FirstDay:    time.Monday,
+			Relative: &RelativeForms{
+				Now:    "ora",
+				Past:   "%s fa",
+				Future: "tra %s",
+				Units: [Year + 1][2]string{
+					Second: {"%d secondo", "%d secondi"},
+					Minute: {"%d minuto", "%d minuti"},
+					Hour:   {"%d ora", "%d ore"},
+					Day:    {"%d giorno", "%d giorni"},
+					Week:   {"%d settimana", "%d settimane"},
+					Month:  {"%d mese", "%d mesi"},
+					Year:   {"%d anno", "%d anni"},
+				},
+			},
+		},
+		{
+			Tag: "nl",
+			Months: [12]string{"januari", "februari", "maart", "april", "mei", "juni", "juli",
+				"augustus", "september", "oktober", "november", "december"},
+			ShortMonths: [12]string{"jan", "feb", "mrt", "apr", "mei", "jun", "jul", "aug", "sep", "okt", "nov", "dec"},
+			Days:        [7]string{"zondag", "maandag", "dinsdag", "woensdag", "donderdag", "vrijdag", "zaterdag"},
+			ShortDays:   [7]string{"zo", "ma", "di", "wo", "do", "vr", "za"},
+			Decimal:     ",",
+			Group:       ".",
+			FirstDay:    time.Monday,
+			Relative: &RelativeForms{
+				Now:    "nu",
+				Past:   "%s geleden",
+				Future: "over %s",
+				Units: [Year + 1][2]string{
+					Second: {"%d seconde", "%d seconden"},
+					Minute: {"%d minuut", "%d minuten"},
+					Hour:   {"%d uur", "%d uur"},
+					Day:    {"%d dag", "%d dagen"},
+					Week:   {"%d week", "%d weken"},
+					Month:  {"%d maand", "%d maanden"},
+					Year:   {"%d jaar", "%d jaar"},
+				},
+			},
+		},
+		{
+			Tag: "pt",
+			Months: [12]string{"janeiro", "fevereiro", "março", "abril", "maio", "junho", "julho",
+				"agosto", "setembro", "outubro", "novembro", "dezembro"},
+			ShortMonths: [12]string{"jan.", "fev.", "mar.", "abr.", "mai.", "jun.", "jul.", "ago.", "set.", "out.", "nov.", "dez."},
+			Days: [7]string{"domingo", "segunda-feira", "terça-feira", "quarta-feira", "quinta-feira",
+				"sexta-feira", "sábado"},
+			ShortDays: [7]string{"dom.", "seg.", "ter.", "qua.", "qui.", "sex.", "sáb."},
+			Decimal:   ",",
+			Group:     ".",
+			FirstDay:  time.Sunday,
+			Relative: &RelativeForms{
+				Now:    "agora",
+				Past:   "há %s",
+				Future: "em %s",
+				Units: [Year + 1][2]string{
+					Second: {"%d segundo", "%d segundos"},
+					Minute: {"%d minuto", "%d minutos"},
+					Hour:   {"%d hora", "%d horas"},
+					Day:    {"%d dia", "%d dias"},
+					Week:   {"%d semana", "%d semanas"},
+					Month:  {"%d mês", "%d meses"},
+					Year:   {"%d ano", "%d anos"},
+				},
+			},
+		},
+	} {
+		Register(l)
+	}
+}
@@ -0,0 +1,181 @@
+// Package locale holds the data formatting dates and numbers by locale,
+// used by the timef, numberf, first_weekday, reltime and percent builtins of
+// the templates.
+//
+// Only the English data is built in. The data of more locales, derived from
+// CLDR, is built with the "cldr" build tag, to keep the binaries small, and
+// other locales may be registered by Register.
+package locale
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Locale is the formatting data of a locale.
+type Locale struct {
+	// Tag is the BCP 47 tag of the locale, as "pt-BR".
+	Tag string
+	// Months are the names of the months, from January.
+	Months [12]string
+	// ShortMonths are the abbreviated names of the months.
+	ShortMonths [12]string
+	// Days are the names of the days of the week, from Sunday.
+	Days [7]string
+	// ShortDays are the abbreviated names of the days of the week.
+	ShortDays [7]string
+	// Decimal is the decimal separator of the numbers.
+	Decimal string
+	// Group is the separator of the groups of thousands of the numbers.
+	Group string
+	// Percent is the format of the percentages, where %s is the number, as
+	// "%s %". The default is "%s%".
+	Percent string
+	// FirstDay is the first day of the week.
+	FirstDay time.Weekday
+	// Relative are the forms of the relative times, or nil for the English
+	// forms.
+	Relative *RelativeForms
+}
+
+// English is the locale used when no other matches.
+var English = &Locale{
+	Tag: "en",
+	Months: [12]string{"January", "February", "March", "April", "May", "June", "July",
+		"August", "September", "October", "November", "December"},
+	ShortMonths: [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+	Days:        [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+	ShortDays:   [7]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"},
+	Decimal:     ".",
+	Group:       ",",
+	FirstDay:    time.Sunday,
+}
+
+var (
+	mu      sync.RWMutex
+	locales = map[string]*Locale{"en": English}
+)
+
+// Register registers the locale, replacing the one with the same tag.
+func Register(l *Locale) {
+	mu.Lock()
+	locales[strings.ToLower(l.Tag)] = l
+	mu.Unlock()
+}
+
+// Get returns the locale of the tag, or of its language, as "pt" for
+// "pt-BR", or English if none is registered.
+func Get(tag string) *Locale {
+	tag = strings.ToLower(strings.ReplaceAll(tag, "_", "-"))
+	mu.RLock()
+	defer mu.RUnlock()
+	for tag != "" {
+		if l, ok := locales[tag]; ok {
+			return l
+		}
+		i := strings.LastIndexByte(tag, '-')
+		if i < 0 {
+			break
+		}
+		tag = tag[:i]
+	}
+	return English
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx with the locale tag, used by the
+// executions whose executor has no locale.
+func NewContext(ctx context.Context, tag string) context.Context {
+	return context.WithValue(ctx, contextKey{}, tag)
+}
+
+// FromContext returns the locale tag of ctx, or "".
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	tag, _ := ctx.Value(contextKey{}).(string)
+	return tag
+}
+
+// TimeLayout returns the joda layout with the names of the months (MMM and
+// MMMM) and of the days of the week (E to EEEE) replaced by the names of the
+// locale at t, quoted, so jodaTime.Format writes them.
+func (l *Locale) TimeLayout(layout string, t time.Time) string {
+	if l == English {
+		return layout
+	}
+	var b strings.Builder
+	for i := 0; i < len(layout); {
+		c := layout[i]
+		if c == '\'' {
+			// Copy the quoted text, or the escaped quote.
+			j := strings.IndexByte(layout[i+1:], '\'')
+			if j < 0 {
+				b.WriteString(layout[i:])
+				break
+			}
+			b.WriteString(layout[i : i+j+2])
+			i += j + 2
+			continue
+		}
+		if c != 'M' && c != 'E' {
+			b.WriteByte(c)
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(layout) && layout[j] == c {
+			j++
+		}
+		n := j - i
+		switch {
+		case c == 'M' && n == 3:
+			quote(&b, l.ShortMonths[t.Month()-1])
+		case c == 'M' && n >= 4:
+			quote(&b, l.Months[t.Month()-1])
+		case c == 'E' && n <= 3:
+			quote(&b, l.ShortDays[t.Weekday()])
+		case c == 'E':
+			quote(&b, l.Days[t.Weekday()])
+		default:
+			b.WriteString(layout[i:j])
+		}
+		i = j
+	}
+	return b.String()
+}
+
+// quote writes s as quoted text of a joda layout, which can't hold quotes.
+func quote(b *strings.Builder, s string) {
+	b.WriteByte('\'')
+	b.WriteString(strings.ReplaceAll(s, "'", "’"))
+	b.WriteByte('\'')
+}
+
+// FormatNumber formats the decimal number s, as formatted by
+// strconv.FormatFloat with the 'f' format, with the separators of the
+// locale.
+func (l *Locale) FormatNumber(s string) string {
+	var sign string
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	intPart, frac, hasFrac := strings.Cut(s, ".")
+	var b strings.Builder
+	b.WriteString(sign)
+	for i := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteString(l.Group)
+		}
+		b.WriteByte(intPart[i])
+	}
+	if hasFrac {
+		b.WriteString(l.Decimal)
+		b.WriteString(frac)
+	}
+	return b.String()
+}
@@ -0,0 +1,92 @@
+package locale
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGet(t *testing.T) {
+	pt := &Locale{Tag: "pt-BR", Decimal: ",", Group: "."}
+	Register(pt)
+	for tag, want := range map[string]*Locale{
+		"pt-BR":    pt,
+		"pt_br":    pt,
+		"pt-BR-x1": pt,
+		"pt":       English,
+		"":         English,
+	} {
+		if got := Get(tag); got != want {
+			t.Errorf("Get(%q) = %q, want %q", tag, got.Tag, want.Tag)
+		}
+	}
+	if tag := FromContext(NewContext(context.Background(), "pt-BR")); tag != "pt-BR" {
+		t.Errorf("FromContext = %q", tag)
+	}
+}
+
+func TestTimeLayout(t *testing.T) {
+	l := &Locale{Tag: "x"}
+	l.Months[1] = "fevereiro"
+	l.ShortMonths[1] = "fev."
+	l.Days[0] = "domingo"
+	l.ShortDays[0] = "dom."
+	date := time.Date(2024, 2, 4, 0, 0, 0, 0, time.UTC)
+	for layout, want := range map[string]string{
+		"dd MMMM yyyy":  "dd 'fevereiro' yyyy",
+		"EEE, d MMM":    "'dom.', d 'fev.'",
+		"EEEE 'MMM' MM": "'domingo' 'MMM' MM",
+		"d ''MMMM''":    "d '''fevereiro'''",
+		"yyyy-MM-dd":    "yyyy-MM-dd",
+	} {
+		if got := l.TimeLayout(layout, date); got != want {
+			t.Errorf("TimeLayout(%q) = %q, want %q", layout, got, want)
+		}
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+	l := &Locale{Decimal: ",", Group: "."}
+	for s, want := range map[string]string{
+		"0":          "0",
+		"123":        "123",
+		"1234":       "1.234",
+		"-1234567.5": "-1.234.567,5",
+		"100000.25":  "100.000,25",
+	} {
+		if got := l.FormatNumber(s); got != want {
+			t.Errorf("FormatNumber(%q) = %q, want %q", s, got, want)
+		}
+	}
+}
+
+func TestRelativeTime(t *testing.T) {
+	for _, test := range []struct {
+		d    time.Duration
+		want string
+	}{
+		{5 * time.Second, "now"},
+		{-30 * time.Second, "30 seconds ago"},
+		{-time.Minute, "1 minute ago"},
+		{3 * time.Hour, "in 3 hours"},
+		{-36 * time.Hour, "2 days ago"},
+		{14 * 24 * time.Hour, "in 2 weeks"},
+		{-90 * 24 * time.Hour, "3 months ago"},
+		{800 * 24 * time.Hour, "in 2 years"},
+	} {
+		if got := English.RelativeTime(test.d, nil); got != test.want {
+			t.Errorf("RelativeTime(%v) = %q, want %q", test.d, got, test.want)
+		}
+	}
+
+	pt := &Locale{Relative: &RelativeForms{Now: "agora", Past: "há %s", Future: "em %s"}}
+	pt.Relative.Units[Hour] = [2]string{"%d hora", "%d horas"}
+	pt.Relative.Units[Day] = [2]string{"%d dia", "%d dias"}
+	thresholds := []Threshold{{time.Minute, Now}, {48 * time.Hour, Hour}}
+	if got, want := pt.RelativeTime(-30*time.Hour, thresholds), "há 30 horas"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := pt.RelativeTime(time.Hour, thresholds), "em 1 hora"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,122 @@
+package locale
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Unit is a unit of the relative times.
+type Unit uint8
+
+const (
+	// Now is the unit of the times close enough to be written as now.
+	Now Unit = iota
+	Second
+	Minute
+	Hour
+	Day
+	Week
+	Month
+	Year
+)
+
+// durations are the durations of the units, the months having 30 days and
+// the years 365.
+var durations = [Year + 1]time.Duration{
+	Second: time.Second,
+	Minute: time.Minute,
+	Hour:   time.Hour,
+	Day:    24 * time.Hour,
+	Week:   7 * 24 * time.Hour,
+	Month:  30 * 24 * time.Hour,
+	Year:   365 * 24 * time.Hour,
+}
+
+// Threshold writes the relative times shorter than Below in Unit.
+type Threshold struct {
+	Below time.Duration
+	Unit  Unit
+}
+
+// DefaultThresholds are the thresholds of the relative times used when none
+// are given. The times beyond the last threshold are written in years.
+var DefaultThresholds = []Threshold{
+	{10 * time.Second, Now},
+	{45 * time.Second, Second},
+	{45 * time.Minute, Minute},
+	{22 * time.Hour, Hour},
+	{7 * 24 * time.Hour, Day},
+	{30 * 24 * time.Hour, Week},
+	{365 * 24 * time.Hour, Month},
+}
+
+// RelativeForms are the forms of the relative times of a locale.
+type RelativeForms struct {
+	// Now is the form of the times written as now.
+	Now string
+	// Past and Future are the forms of the past and future times, where %s
+	// is the amount, as "%s ago" and "in %s".
+	Past, Future string
+	// Units are the singular and plural forms of the amounts, by unit, where
+	// %d is the number, as "%d hour" and "%d hours".
+	Units [Year + 1][2]string
+}
+
+// EnglishRelative are the relative forms of English, used by the locales
+// without them.
+var EnglishRelative = &RelativeForms{
+	Now:    "now",
+	Past:   "%s ago",
+	Future: "in %s",
+	Units: [Year + 1][2]string{
+		Second: {"%d second", "%d seconds"},
+		Minute: {"%d minute", "%d minutes"},
+		Hour:   {"%d hour", "%d hours"},
+		Day:    {"%d day", "%d days"},
+		Week:   {"%d week", "%d weeks"},
+		Month:  {"%d month", "%d months"},
+		Year:   {"%d year", "%d years"},
+	},
+}
+
+// RelativeTime writes the time at d from now, in the past if d is
+// negative, as "3 hours ago" or "in 2 days", in the unit of the first
+// threshold d is below, or in years. Nil thresholds are DefaultThresholds.
+func (l *Locale) RelativeTime(d time.Duration, thresholds []Threshold) string {
+	forms := l.Relative
+	if forms == nil {
+		forms = EnglishRelative
+	}
+	if thresholds == nil {
+		thresholds = DefaultThresholds
+	}
+	abs := d
+	if abs < 0 {
+		abs = -abs
+	}
+	unit := Year
+	for _, th := range thresholds {
+		if abs < th.Below {
+			unit = th.Unit
+			break
+		}
+	}
+	if unit == Now {
+		return forms.Now
+	}
+	n := int64(math.Round(float64(abs) / float64(durations[unit])))
+	if n < 1 {
+		n = 1
+	}
+	form := forms.Units[unit][1]
+	if n == 1 {
+		form = forms.Units[unit][0]
+	}
+	amount := fmt.Sprintf(form, n)
+	if d < 0 {
+		return strings.Replace(forms.Past, "%s", amount, 1)
+	}
+	return strings.Replace(forms.Future, "%s", amount, 1)
+}
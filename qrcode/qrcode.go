@@ -0,0 +1,423 @@
+// Package qrcode encodes QR codes, written by the qrcode function of the
+// templates as PNG or SVG data URIs.
+//
+// The function isn't a builtin: it is enabled by adding FuncMap to the
+// functions of the templates. The texts are encoded in the byte mode, in
+// the versions 1 to 10, so up to 271 bytes with the L level of error
+// correction.
+package qrcode
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Level is the level of error correction of a QR code.
+type Level uint8
+
+const (
+	// L recovers 7% of the code.
+	L Level = iota
+	// M recovers 15% of the code.
+	M
+	// Q recovers 25% of the code.
+	Q
+	// H recovers 30% of the code.
+	H
+)
+
+// formatBits are the bits of the levels in the format information.
+var formatBits = [...]int{L: 1, M: 0, Q: 3, H: 2}
+
+// ParseLevel parses the level "L", "M", "Q" or "H".
+func ParseLevel(s string) (Level, error) {
+	switch s {
+	case "L", "l":
+		return L, nil
+	case "M", "m", "":
+		return M, nil
+	case "Q", "q":
+		return Q, nil
+	case "H", "h":
+		return H, nil
+	}
+	return M, fmt.Errorf("qrcode: invalid level %q", s)
+}
+
+// blocks describes the blocks of a version and level: the number of error
+// correction codewords per block, and the number of blocks and of data
+// codewords per block of its two groups.
+type blocks struct {
+	ecc, n1, data1, n2, data2 int
+}
+
+func (b blocks) dataLen() int {
+	return b.n1*b.data1 + b.n2*b.data2
+}
+
+// versionBlocks are the blocks of the versions 1 to 10, by level.
+var versionBlocks = [...][4]blocks{
+	1:  {L: {7, 1, 19, 0, 0}, M: {10, 1, 16, 0, 0}, Q: {13, 1, 13, 0, 0}, H: {17, 1, 9, 0, 0}},
+	2:  {L: {10, 1, 34, 0, 0}, M: {16, 1, 28, 0, 0}, Q: {22, 1, 22, 0, 0}, H: {28, 1, 16, 0, 0}},
+	3:  {L: {15, 1, 55, 0, 0}, M: {26, 1, 44, 0, 0}, Q: {18, 2, 17, 0, 0}, H: {22, 2, 13, 0, 0}},
+	4:  {L: {20, 1, 80, 0, 0}, M: {18, 2, 32, 0, 0}, Q: {26, 2, 24, 0, 0}, H: {16, 4, 9, 0, 0}},
+	5:  {L: {26, 1, 108, 0, 0}, M: {24, 2, 43, 0, 0}, Q: {18, 2, 15, 2, 16}, H: {22, 2, 11, 2, 12}},
+	6:  {L: {18, 2, 68, 0, 0}, M: {16, 4, 27, 0, 0}, Q: {24, 4, 19, 0, 0}, H: {28, 4, 15, 0, 0}},
+	7:  {L: {20, 2, 78, 0, 0}, M: {18, 4, 31, 0, 0}, Q: {18, 2, 14, 4, 15}, H: {26, 4, 13, 1, 14}},
+	8:  {L: {24, 2, 97, 0, 0}, M: {22, 2, 38, 2, 39}, Q: {22, 4, 18, 2, 19}, H: {26, 4, 14, 2, 15}},
+	9:  {L: {30, 2, 116, 0, 0}, M: {22, 3, 36, 2, 37}, Q: {20, 4, 16, 4, 17}, H: {24, 4, 12, 4, 13}},
+	10: {L: {18, 2, 68, 2, 69}, M: {26, 4, 43, 1, 44}, Q: {24, 6, 19, 2, 20}, H: {28, 6, 15, 2, 16}},
+}
+
+// alignments are the positions of the alignment patterns of the versions.
+var alignments = [...][]int{
+	2: {6, 18}, 3: {6, 22}, 4: {6, 26}, 5: {6, 30}, 6: {6, 34},
+	7: {6, 22, 38}, 8: {6, 24, 42}, 9: {6, 26, 46}, 10: {6, 28, 50},
+}
+
+// ErrTooLong is returned when the text doesn't fit in a QR code of the
+// supported versions.
+var ErrTooLong = errors.New("qrcode: text too long")
+
+// Code is a QR code.
+type Code struct {
+	// Size is the number of modules of each side of the code, without the
+	// quiet zone.
+	Size     int
+	modules  [][]bool
+	function [][]bool
+}
+
+// Dark reports whether the module at the column x and the row y is dark.
+func (c *Code) Dark(x, y int) bool {
+	return c.modules[y][x]
+}
+
+// Encode encodes the text in the smallest QR code with the level.
+func Encode(text string, level Level) (*Code, error) {
+	data := []byte(text)
+	version := 0
+	for v := 1; v < len(versionBlocks); v++ {
+		countBits := 8
+		if v >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(data) <= versionBlocks[v][level].dataLen()*8 {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, ErrTooLong
+	}
+	b := versionBlocks[version][level]
+
+	// The data codewords: the byte mode, the count, the bytes, the
+	// terminator and the padding.
+	var bits bitBuffer
+	bits.append(4, 4)
+	if version >= 10 {
+		bits.append(len(data), 16)
+	} else {
+		bits.append(len(data), 8)
+	}
+	for _, c := range data {
+		bits.append(int(c), 8)
+	}
+	capacity := b.dataLen() * 8
+	if n := capacity - len(bits); n < 4 {
+		bits.append(0, n)
+	} else {
+		bits.append(0, 4)
+	}
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	c := newCode(version)
+	c.drawCodewords(interleave(bits.bytes(), b))
+	c.applyBestMask(level, version)
+	return c, nil
+}
+
+// bitBuffer is a sequence of bits.
+type bitBuffer []bool
+
+func (b *bitBuffer) append(v, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, v>>uint(i)&1 == 1)
+	}
+}
+
+func (b bitBuffer) bytes() []byte {
+	out := make([]byte, len(b)/8)
+	for i, bit := range b {
+		if bit {
+			out[i/8] |= 1 << uint(7-i%8)
+		}
+	}
+	return out
+}
+
+// interleave splits the data in the blocks, computes their error
+// correction codewords and interleaves them.
+func interleave(data []byte, b blocks) []byte {
+	var dataBlocks, eccBlocks [][]byte
+	gen := rsGenerator(b.ecc)
+	for i := 0; i < b.n1+b.n2; i++ {
+		n := b.data1
+		if i >= b.n1 {
+			n = b.data2
+		}
+		block := data[:n]
+		data = data[n:]
+		dataBlocks = append(dataBlocks, block)
+		eccBlocks = append(eccBlocks, rsRemainder(block, gen))
+	}
+	var out []byte
+	for i := 0; i < b.data1 || i < b.data2; i++ {
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				out = append(out, block[i])
+			}
+		}
+	}
+	for i := 0; i < b.ecc; i++ {
+		for _, block := range eccBlocks {
+			out = append(out, block[i])
+		}
+	}
+	return out
+}
+
+// newCode returns the code of the version with its function patterns.
+func newCode(version int) *Code {
+	size := version*4 + 17
+	c := &Code{Size: size, modules: make([][]bool, size), function: make([][]bool, size)}
+	for i := range c.modules {
+		c.modules[i] = make([]bool, size)
+		c.function[i] = make([]bool, size)
+	}
+	for i := 0; i < size; i++ {
+		c.set(6, i, i%2 == 0)
+		c.set(i, 6, i%2 == 0)
+	}
+	c.drawFinder(3, 3)
+	c.drawFinder(size-4, 3)
+	c.drawFinder(3, size-4)
+	pos := alignments[version]
+	for i := range pos {
+		for j := range pos {
+			if i == 0 && j == 0 || i == 0 && j == len(pos)-1 || i == len(pos)-1 && j == 0 {
+				continue
+			}
+			c.drawAlignment(pos[i], pos[j])
+		}
+	}
+	// Reserve the format modules.
+	c.drawFormat(0, 0)
+	if version >= 7 {
+		rem := version
+		for i := 0; i < 12; i++ {
+			rem = rem<<1 ^ (rem>>11)*0x1F25
+		}
+		bits := version<<12 | rem
+		for i := 0; i < 18; i++ {
+			dark := bits>>uint(i)&1 == 1
+			a, b := size-11+i%3, i/3
+			c.set(a, b, dark)
+			c.set(b, a, dark)
+		}
+	}
+	return c
+}
+
+// set sets the function module at the column x and the row y.
+func (c *Code) set(x, y int, dark bool) {
+	c.modules[y][x] = dark
+	c.function[y][x] = true
+}
+
+func (c *Code) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			dist := max(abs(dx), abs(dy))
+			if xx, yy := x+dx, y+dy; 0 <= xx && xx < c.Size && 0 <= yy && yy < c.Size {
+				c.set(xx, yy, dist != 2 && dist != 4)
+			}
+		}
+	}
+}
+
+func (c *Code) drawAlignment(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			c.set(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// drawFormat draws the format information of the level bits and the mask.
+func (c *Code) drawFormat(levelBits, mask int) {
+	data := levelBits<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return bits>>uint(i)&1 == 1 }
+	for i := 0; i <= 5; i++ {
+		c.set(8, i, bit(i))
+	}
+	c.set(8, 7, bit(6))
+	c.set(8, 8, bit(7))
+	c.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		c.set(14-i, 8, bit(i))
+	}
+	for i := 0; i < 8; i++ {
+		c.set(c.Size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		c.set(8, c.Size-15+i, bit(i))
+	}
+	c.set(8, c.Size-8, true)
+}
+
+// drawCodewords draws the codewords in the zigzag order.
+func (c *Code) drawCodewords(data []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < c.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = c.Size - 1 - vert
+				}
+				if !c.function[y][x] && i < len(data)*8 {
+					c.modules[y][x] = data[i>>3]>>uint(7-i&7)&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+// masks are the mask patterns, by column and row.
+var masks = [8]func(x, y int) bool{
+	func(x, y int) bool { return (x+y)%2 == 0 },
+	func(x, y int) bool { return y%2 == 0 },
+	func(x, y int) bool { return x%3 == 0 },
+	func(x, y int) bool { return (x+y)%3 == 0 },
+	func(x, y int) bool { return (x/3+y/2)%2 == 0 },
+	func(x, y int) bool { return x*y%2+x*y%3 == 0 },
+	func(x, y int) bool { return (x*y%2+x*y%3)%2 == 0 },
+	func(x, y int) bool { return ((x+y)%2+x*y%3)%2 == 0 },
+}
+
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.function[y][x] && masks[mask](x, y) {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+// applyBestMask applies the mask with the lowest penalty.
+func (c *Code) applyBestMask(level Level, version int) {
+	best, bestPenalty := 0, -1
+	for mask := range masks {
+		c.applyMask(mask)
+		c.drawFormat(formatBits[level], mask)
+		if p := c.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		c.applyMask(mask)
+	}
+	c.applyMask(best)
+	c.drawFormat(formatBits[level], best)
+}
+
+// penalty returns the penalty score of the code, by the rules of the
+// standard.
+func (c *Code) penalty() (p int) {
+	line := func(i, j int, rows bool) bool {
+		if rows {
+			return c.modules[i][j]
+		}
+		return c.modules[j][i]
+	}
+	finder := []bool{true, false, true, true, true, false, true}
+	for _, rows := range []bool{true, false} {
+		for i := 0; i < c.Size; i++ {
+			run := 1
+			for j := 1; j <= c.Size; j++ {
+				if j < c.Size && line(i, j, rows) == line(i, j-1, rows) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					p += 3 + run - 5
+				}
+				run = 1
+			}
+			for j := 0; j+7 <= c.Size; j++ {
+				match := true
+				for k, dark := range finder {
+					if line(i, j+k, rows) != dark {
+						match = false
+						break
+					}
+				}
+				if match && (c.light(i, j-4, j, rows) || c.light(i, j+7, j+11, rows)) {
+					p += 40
+				}
+			}
+		}
+	}
+	dark := 0
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.modules[y][x] {
+				dark++
+			}
+			if x > 0 && y > 0 {
+				m := c.modules[y][x]
+				if c.modules[y-1][x] == m && c.modules[y][x-1] == m && c.modules[y-1][x-1] == m {
+					p += 3
+				}
+			}
+		}
+	}
+	total := c.Size * c.Size
+	p += abs(dark*20-total*10) / total * 10
+	return
+}
+
+// light reports whether the modules from "from" to "to" of the line i are
+// light, the modules out of the code being light.
+func (c *Code) light(i, from, to int, rows bool) bool {
+	for j := from; j < to; j++ {
+		if j < 0 || j >= c.Size {
+			continue
+		}
+		if rows && c.modules[i][j] || !rows && c.modules[j][i] {
+			return false
+		}
+	}
+	return true
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
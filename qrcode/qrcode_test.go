@@ -0,0 +1,88 @@
+package qrcode
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image/png"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRSRemainder(t *testing.T) {
+	// The codewords of "HELLO WORLD" in the version 1-M.
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := rsRemainder(data, rsGenerator(10)); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	for _, test := range []struct {
+		text  string
+		level Level
+		size  int
+	}{
+		{"hello", M, 21},
+		{"https://example.com/ticket/12345", M, 29},
+		{strings.Repeat("x", 60), H, 45},
+		{strings.Repeat("x", 271), L, 57},
+	} {
+		c, err := Encode(test.text, test.level)
+		if err != nil {
+			t.Errorf("Encode(%q): %v", test.text, err)
+			continue
+		}
+		if c.Size != test.size {
+			t.Errorf("Encode(%q): size %d, want %d", test.text, c.Size, test.size)
+		}
+		// The finder patterns and the dark module.
+		for _, p := range [][2]int{{0, 0}, {c.Size - 1, 0}, {0, c.Size - 1}, {3, 3}, {8, c.Size - 8}} {
+			if !c.Dark(p[0], p[1]) {
+				t.Errorf("Encode(%q): light module at %v", test.text, p)
+			}
+		}
+	}
+	if _, err := Encode(strings.Repeat("x", 272), L); err != ErrTooLong {
+		t.Errorf("expected ErrTooLong; got %v", err)
+	}
+}
+
+func TestDataURI(t *testing.T) {
+	uri, err := DataURI("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const svgPrefix = "data:image/svg+xml;base64,"
+	if !strings.HasPrefix(string(uri), svgPrefix) {
+		t.Fatalf("got %s, want a SVG data URI", uri)
+	}
+	svg, _ := base64.StdEncoding.DecodeString(string(uri)[len(svgPrefix):])
+	if !bytes.Contains(svg, []byte(`viewBox="0 0 29 29"`)) {
+		t.Errorf("unexpected SVG %s", svg)
+	}
+
+	uri, err = DataURI("hello", "png", "Q", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const pngPrefix = "data:image/png;base64,"
+	data, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(string(uri), pngPrefix))
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Dx(); size != 58 {
+		t.Errorf("got a %d pixels image, want 58", size)
+	}
+	if cached, _ := DataURI("hello", "png", "Q", 2); cached != uri {
+		t.Error("expected the cached data URI")
+	}
+
+	for _, opts := range [][]interface{}{{"gif"}, {"svg", "X"}, {"png", "M", 0}, {"png", "M", 1, 2}} {
+		if _, err := DataURI("hello", opts...); err == nil {
+			t.Errorf("DataURI(%v): expected error; got none", opts)
+		}
+	}
+}
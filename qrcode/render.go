@@ -0,0 +1,146 @@
+package qrcode
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/moisespsena-go/umbu/funcs"
+)
+
+// QuietZone is the number of light modules around the codes rendered.
+const QuietZone = 4
+
+// PNG renders the code as a PNG image with scale pixels per module.
+func (c *Code) PNG(scale int) ([]byte, error) {
+	if scale < 1 {
+		scale = 1
+	}
+	side := (c.Size + 2*QuietZone) * scale
+	img := image.NewPaletted(image.Rect(0, 0, side, side), color.Palette{color.White, color.Black})
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.modules[y][x] {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				row := img.Pix[((y+QuietZone)*scale+dy)*img.Stride:]
+				for dx := 0; dx < scale; dx++ {
+					row[(x+QuietZone)*scale+dx] = 1
+				}
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SVG renders the code as a SVG image, scalable, with a module per unit.
+func (c *Code) SVG() string {
+	side := c.Size + 2*QuietZone
+	var path strings.Builder
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.modules[y][x] {
+				continue
+			}
+			start := x
+			for x+1 < c.Size && c.modules[y][x+1] {
+				x++
+			}
+			fmt.Fprintf(&path, "M%d %dh%dv1h-%dz", start+QuietZone, y+QuietZone, x-start+1, x-start+1)
+		}
+	}
+	return `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 ` + strconv.Itoa(side) + ` ` + strconv.Itoa(side) +
+		`" shape-rendering="crispEdges"><rect width="100%" height="100%" fill="#fff"/><path d="` + path.String() + `" fill="#000"/></svg>`
+}
+
+// cacheSize is the maximum number of data URIs cached by DataURI.
+const cacheSize = 256
+
+var cache = struct {
+	sync.Mutex
+	uris map[string]template.URL
+}{uris: map[string]template.URL{}}
+
+// DataURI encodes the text as a QR code written as a data URI, safe as
+// the URL of the html templates. The options are the format, "svg" (the
+// default) or "png", the level of error correction, "M" by default, and,
+// for PNG, the number of pixels per module, 4 by default:
+//
+//	<img src="{{qrcode .Ticket.Code "png" "Q" 8}}">
+//
+// The data URIs are cached, so the templates rendering the same codes
+// don't encode them again.
+func DataURI(text string, opts ...interface{}) (template.URL, error) {
+	format, levelName, scale := "svg", "M", 4
+	for i, opt := range opts {
+		switch i {
+		case 0:
+			format = strings.ToLower(fmt.Sprint(opt))
+		case 1:
+			levelName = fmt.Sprint(opt)
+		case 2:
+			n, err := strconv.Atoi(fmt.Sprint(opt))
+			if err != nil || n < 1 {
+				return "", fmt.Errorf("qrcode: invalid scale %v", opt)
+			}
+			scale = n
+		default:
+			return "", fmt.Errorf("qrcode: too many options")
+		}
+	}
+	level, err := ParseLevel(levelName)
+	if err != nil {
+		return "", err
+	}
+	if format != "svg" && format != "png" {
+		return "", fmt.Errorf("qrcode: invalid format %q", format)
+	}
+
+	key := format + "\x00" + strconv.Itoa(int(level)) + "\x00" + strconv.Itoa(scale) + "\x00" + text
+	cache.Lock()
+	uri, ok := cache.uris[key]
+	cache.Unlock()
+	if ok {
+		return uri, nil
+	}
+
+	code, err := Encode(text, level)
+	if err != nil {
+		return "", err
+	}
+	if format == "png" {
+		data, err := code.PNG(scale)
+		if err != nil {
+			return "", err
+		}
+		uri = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(data))
+	} else {
+		uri = template.URL("data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString([]byte(code.SVG())))
+	}
+
+	cache.Lock()
+	if len(cache.uris) >= cacheSize {
+		cache.uris = map[string]template.URL{}
+	}
+	cache.uris[key] = uri
+	cache.Unlock()
+	return uri, nil
+}
+
+// FuncMap has the qrcode function. It isn't a builtin of the templates,
+// which enable it by adding FuncMap to their functions.
+var FuncMap = funcs.FuncMap{
+	"qrcode": DataURI,
+}
@@ -2,7 +2,11 @@ package render
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"runtime"
+	"sync"
 
 	"github.com/moisespsena-go/umbu/html/template"
 )
@@ -15,6 +19,11 @@ type Template struct {
 	Layout             string
 	Funcs              template.FuncMapSlice
 	FuncValues         template.FuncValuesSlice
+	// Locales are the locales of the site, listed by alternate_locales.
+	Locales []string
+	// LocalizedPath returns the path of the page at path in the locale, used
+	// by localized_path. The default prefixes the path by "/" and the locale.
+	LocalizedPath func(path, locale string) string
 }
 
 func (this Template) SetLayout(layout string) *Template {
@@ -37,3 +46,41 @@ func (this *Template) Render(state *template.State, w io.Writer, ctx context.Con
 	r := NewTemplateRender(this, obj, lang...)
 	return r.RenderC(state, w, ctx, templateName)
 }
+
+// ExecuteContext renders the template named, in its layout, with the object
+// and the context ctx, preferring the templates of the languages lang.
+func (this *Template) ExecuteContext(ctx context.Context, w io.Writer, templateName string, obj interface{}, lang ...string) error {
+	return this.Render(nil, w, ctx, templateName, obj, lang...)
+}
+
+// WarmUp gets the executors of the templates named, by up to workers
+// goroutines, or runtime.GOMAXPROCS(0) if workers is less than 1, so the
+// templates are loaded at startup. The errors are returned joined, in the
+// order of the names.
+func (this *Template) WarmUp(workers int, names ...string) error {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	var (
+		errs = make([]error, len(names))
+		wg   sync.WaitGroup
+		jobs = make(chan int)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if _, err := this.GetExecutor(names[i]); err != nil {
+					errs[i] = fmt.Errorf("render: warm up %q: %w", names[i], err)
+				}
+			}
+		}()
+	}
+	for i := range names {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return errors.Join(errs...)
+}
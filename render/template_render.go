@@ -3,8 +3,11 @@ package render
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"log/slog"
 	"path"
 	"path/filepath"
 	"strings"
@@ -17,6 +20,7 @@ type TemplateRender struct {
 	funcValues template.FuncValues
 	obj        interface{}
 	lang       []string
+	name       string // the name of the rendered page.
 }
 
 func NewTemplateRender(tmpl *Template, obj interface{}, lang ...string) (r *TemplateRender) {
@@ -26,9 +30,69 @@ func NewTemplateRender(tmpl *Template, obj interface{}, lang ...string) (r *Temp
 	r.funcValues.SetDefault("render", r.Require)
 	r.funcValues.SetDefault("require", r.Require)
 	r.funcValues.SetDefault("include", r.Include)
+	r.funcValues.SetDefault("current_locale", r.CurrentLocale)
+	r.funcValues.SetDefault("alternate_locales", r.AlternateLocales)
+	r.funcValues.SetDefault("localized_path", r.LocalizedPath)
 	return
 }
 
+// localizedName returns the name of the version of the template named name
+// in the lang, as "page/en.tmpl" for "page.tmpl", or "" if name has no
+// extension.
+func localizedName(name, lang string) string {
+	extPos := strings.LastIndexByte(name, '.')
+	if extPos <= 0 {
+		return ""
+	}
+	if lang == "_" {
+		lang = "default"
+	}
+	return path.Join(name[0:extPos], lang+name[extPos:])
+}
+
+// CurrentLocale returns the locale of the render, the first of its lang
+// chain, or "" if it has none.
+func (this *TemplateRender) CurrentLocale() string {
+	for _, lang := range this.lang {
+		if lang != "_" {
+			return lang
+		}
+	}
+	return ""
+}
+
+// AlternateLocales returns the locales of Template.Locales in which the
+// rendered page is available, including the current one, to emit its
+// hreflang alternates. The page is available in every locale if it has a
+// version that isn't localized or a default one, otherwise only in the
+// locales of its localized versions.
+func (this *TemplateRender) AlternateLocales() (locales []string) {
+	if this.name == "" || localizedName(this.name, "_") == "" {
+		return this.template.Locales
+	}
+	if _, err := this.template.GetExecutor(this.name); err == nil {
+		return this.template.Locales
+	}
+	if _, err := this.template.GetExecutor(localizedName(this.name, "_")); err == nil {
+		return this.template.Locales
+	}
+	for _, locale := range this.template.Locales {
+		if _, err := this.template.GetExecutor(localizedName(this.name, locale)); err == nil {
+			locales = append(locales, locale)
+		}
+	}
+	return
+}
+
+// LocalizedPath returns the path of the page at path in the locale, by
+// Template.LocalizedPath, as "/pt-BR/about" for "/about" by default.
+func (this *TemplateRender) LocalizedPath(pth, locale string) string {
+	if this.template.LocalizedPath != nil {
+		return this.template.LocalizedPath(pth, locale)
+	}
+	return path.Join("/", locale, pth)
+}
+
 func (this *TemplateRender) Render(state *template.State, w io.Writer, ctx context.Context, name string, require bool, objs ...interface{}) (err error) {
 	var renderObj = this.obj
 
@@ -44,13 +108,10 @@ func (this *TemplateRender) Render(state *template.State, w io.Writer, ctx conte
 	if len(this.lang) == 0 {
 		exectr, err = this.template.GetExecutor(name)
 	} else {
-		if extPos := strings.LastIndexByte(name, '.'); extPos > 0 {
+		if localizedName(name, "_") != "" {
 			for _, lang := range this.lang {
-				if lang == "_" {
-					lang = "default"
-				}
-				name2 := path.Join(name[0:extPos], lang+name[extPos:])
-				if exectr, err = this.template.GetExecutor(name2); err == nil {
+				exectr, err = this.template.GetExecutor(localizedName(name, lang))
+				if err == nil || !errors.Is(err, fs.ErrNotExist) {
 					break
 				}
 			}
@@ -59,31 +120,43 @@ func (this *TemplateRender) Render(state *template.State, w io.Writer, ctx conte
 		}
 	}
 
-	if err == nil {
-		exectr.SetSuper(state)
-		exectr = exectr.FuncsValues(this.funcValues)
-		if len(objs) > 0 {
-			for i, max := 0, len(objs); i < max; i++ {
-				switch ot := objs[i].(type) {
-				case template.LocalData:
-					if i == 0 {
-						exectr.Local = ot
-					} else {
-						exectr.Local.Merge(ot)
-					}
-				case map[interface{}]interface{}:
+	if err != nil {
+		if !require && errors.Is(err, fs.ErrNotExist) {
+			// include of a missing template renders nothing
+			if state != nil {
+				state.Log(slog.LevelWarn, "include failed", "name", name, "error", err)
+			}
+			return nil
+		}
+		return err
+	}
+
+	exectr.SetSuper(state)
+	if state != nil && exectr.Logger == nil {
+		exectr.SetLogger(state.Executor().Logger)
+	}
+	exectr = exectr.FuncsValues(this.funcValues)
+	if len(objs) > 0 {
+		for i, max := 0, len(objs); i < max; i++ {
+			switch ot := objs[i].(type) {
+			case template.LocalData:
+				if i == 0 {
+					exectr.Local = ot
+				} else {
 					exectr.Local.Merge(ot)
-				default:
-					exectr.Local.Set(objs[i], objs[i+1])
-					i++
 				}
+			case map[interface{}]interface{}:
+				exectr.Local.Merge(ot)
+			default:
+				exectr.Local.Set(objs[i], objs[i+1])
+				i++
 			}
 		}
-		exectr.Context = ctx
-		err = exectr.Execute(w, renderObj)
 	}
-
-	return err
+	if exectr.Locale == "" {
+		exectr.SetLocale(this.CurrentLocale())
+	}
+	return exectr.ExecuteContext(ctx, w, renderObj)
 }
 
 func (this *TemplateRender) renderC(state *template.State, ctx context.Context, name string, require bool, objs ...interface{}) (s template.HTML, err error) {
@@ -106,6 +179,9 @@ func (this *TemplateRender) Require(state *template.State, name string, objs ...
 	return template.HTML(w.String()), nil
 }
 
+// IncludeC renders the template named name as RequireC, but renders
+// nothing, logging a warning, if Template.GetExecutor fails with an error
+// matching fs.ErrNotExist. Its other errors are returned.
 func (this *TemplateRender) IncludeC(state *template.State, w io.Writer, ctx context.Context, name string, objs ...interface{}) error {
 	return this.Render(state, w, ctx, name, false, objs...)
 }
@@ -119,6 +195,7 @@ func (this *TemplateRender) Include(state *template.State, name string, objs ...
 }
 
 func (this *TemplateRender) RenderC(state *template.State, w io.Writer, ctx context.Context, name string) (err error) {
+	this.name = name
 	this.funcValues.SetDefault("yield", func(state *template.State) (template.HTML, error) {
 		return this.Require(state, name)
 	})
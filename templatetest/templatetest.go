@@ -0,0 +1,175 @@
+// Package templatetest provides helpers to test templates: rendering against
+// fixtures, comparing with golden files and asserting on rendered fragments.
+//
+// Golden files are rewritten instead of compared when Update is true, which
+// defaults to the UMBU_UPDATE_GOLDEN environment variable being set to a
+// non empty value:
+//
+//	UMBU_UPDATE_GOLDEN=1 go test ./...
+package templatetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+// Update causes Golden and RunFixtures to write the golden files.
+var Update = os.Getenv("UMBU_UPDATE_GOLDEN") != ""
+
+// Executable is a template that can be executed, as the text/template and
+// html/template Template types.
+type Executable interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+// Option configures the comparison of outputs.
+type Option func(o *options)
+
+type options struct {
+	ignoreWhitespace bool
+}
+
+// IgnoreWhitespace compares outputs ignoring whitespace differences: lines
+// are trimmed, blank lines dropped and inner whitespace runs collapsed.
+func IgnoreWhitespace() Option {
+	return func(o *options) {
+		o.ignoreWhitespace = true
+	}
+}
+
+func newOptions(opts []Option) (o options) {
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return
+}
+
+func (o options) normalize(s string) string {
+	if o.ignoreWhitespace {
+		return NormalizeWhitespace(s)
+	}
+	return s
+}
+
+// NormalizeWhitespace trims every line, drops the blank ones and collapses
+// the whitespace runs into a single space.
+func NormalizeWhitespace(s string) string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.Join(strings.FieldsFunc(line, unicode.IsSpace), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Render executes tmpl with data and returns the output, failing the test
+// on error.
+func Render(tb testing.TB, tmpl Executable, data interface{}) string {
+	tb.Helper()
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		tb.Fatalf("execute: %v", err)
+	}
+	return out.String()
+}
+
+// Golden executes tmpl with data and compares the output with the contents of
+// the golden file. When Update is true, the golden file is written instead.
+func Golden(tb testing.TB, tmpl Executable, data interface{}, golden string, opts ...Option) {
+	tb.Helper()
+	AssertGolden(tb, Render(tb, tmpl, data), golden, opts...)
+}
+
+// AssertGolden compares got with the contents of the golden file. When
+// Update is true, the golden file is written instead.
+func AssertGolden(tb testing.TB, got, golden string, opts ...Option) {
+	tb.Helper()
+	if Update {
+		if err := os.MkdirAll(filepath.Dir(golden), 0755); err != nil {
+			tb.Fatal(err)
+		}
+		if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+			tb.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		tb.Fatalf("read golden file: %v", err)
+	}
+	AssertEqual(tb, got, string(want), opts...)
+}
+
+// AssertEqual compares got with want, reporting a line diff on mismatch.
+func AssertEqual(tb testing.TB, got, want string, opts ...Option) {
+	tb.Helper()
+	o := newOptions(opts)
+	if g, w := o.normalize(got), o.normalize(want); g != w {
+		tb.Errorf("output mismatch (-want +got):\n%s", Diff(w, g))
+	}
+}
+
+// Contains asserts that out contains all of the fragments.
+func Contains(tb testing.TB, out string, fragments ...string) {
+	tb.Helper()
+	for _, f := range fragments {
+		if !strings.Contains(out, f) {
+			tb.Errorf("output doesn't contain %q:\n%s", f, out)
+		}
+	}
+}
+
+// NotContains asserts that out contains none of the fragments.
+func NotContains(tb testing.TB, out string, fragments ...string) {
+	tb.Helper()
+	for _, f := range fragments {
+		if strings.Contains(out, f) {
+			tb.Errorf("output contains %q:\n%s", f, out)
+		}
+	}
+}
+
+// RunFixtures runs a subtest for each "*.json" fixture file in dir: the
+// template is executed with the decoded fixture as data and the output is
+// compared with the golden file of the same base name and ".golden" extension.
+func RunFixtures(t *testing.T, tmpl Executable, dir string, opts ...Option) {
+	t.Helper()
+	fixtures, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatalf("no fixtures found in %q", dir)
+	}
+	for _, fixture := range fixtures {
+		name := strings.TrimSuffix(filepath.Base(fixture), ".json")
+		golden := strings.TrimSuffix(fixture, ".json") + ".golden"
+		t.Run(name, func(t *testing.T) {
+			data, err := LoadFixture(fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+			Golden(t, tmpl, data, golden, opts...)
+		})
+	}
+}
+
+// LoadFixture decodes the JSON fixture file.
+func LoadFixture(name string) (data interface{}, err error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(b, &data); err != nil {
+		err = fmt.Errorf("fixture %q: %v", name, err)
+	}
+	return
+}
@@ -0,0 +1,32 @@
+package templatetest
+
+import (
+	"testing"
+
+	"github.com/moisespsena-go/umbu/text/template"
+)
+
+const greet = `Hello {{.Name}}!
+{{range .Items}}  - {{.}}
+{{end}}`
+
+func TestRunFixtures(t *testing.T) {
+	tmpl := template.Must(template.New("greet").Parse(greet))
+	RunFixtures(t, tmpl, "testdata/greet")
+}
+
+func TestIgnoreWhitespace(t *testing.T) {
+	tmpl := template.Must(template.New("greet").Parse(greet))
+	out := Render(t, tmpl, map[string]interface{}{"Name": "Ana", "Items": []string{"a", "b"}})
+	AssertEqual(t, out, "Hello   Ana!\n\n- a\n- b", IgnoreWhitespace())
+	Contains(t, out, "Hello Ana!", "- b")
+	NotContains(t, out, "<no value>")
+}
+
+func TestDiff(t *testing.T) {
+	got := Diff("a\nb\nc", "a\nx\nc")
+	want := "  a\n- b\n+ x\n  c\n"
+	if got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
@@ -0,0 +1,179 @@
+package template
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/moisespsena-go/umbu/cast"
+)
+
+// keyFunc returns the function of the values of the items for the
+// aggregate builtin, by the key: the field path, "." or none for the item
+// itself, or a function called with the item, as call does.
+func keyFunc(state *State, name string, key []reflect.Value) (func(item reflect.Value) (reflect.Value, error), error) {
+	var k reflect.Value
+	switch len(key) {
+	case 0:
+		return sortKey{}.value, nil
+	case 1:
+		k = indirectInterface(key[0])
+	default:
+		return nil, fmt.Errorf("%s: want one key, got %d", name, len(key))
+	}
+	switch {
+	case k.Kind() == reflect.String:
+		if len(strings.Fields(k.String())) != 1 {
+			return nil, fmt.Errorf("%s: invalid key %q", name, k.String())
+		}
+		field, _ := parseSortKey(name, k.String())
+		return field.value, nil
+	case k.Kind() == reflect.Func:
+		return func(item reflect.Value) (reflect.Value, error) {
+			v, err := call(state, k, item)
+			if err != nil {
+				return v, err
+			}
+			return sortKey{}.value(v)
+		}, nil
+	}
+	return nil, fmt.Errorf("%s: want a field path or a function, got %v", name, k)
+}
+
+// aggregate calls f with the items of the list and their values by the key.
+func aggregate(state *State, name string, list reflect.Value, key []reflect.Value, f func(item, value reflect.Value) error) error {
+	list, err := listArg(name, list)
+	if err != nil {
+		return err
+	}
+	value, err := keyFunc(state, name, key)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < list.Len(); i++ {
+		item := list.Index(i)
+		v, err := value(item)
+		if err == nil {
+			err = f(item, v)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: item %d: %v", name, i, err)
+		}
+	}
+	return nil
+}
+
+// sumOf returns the sum of the numbers, an int64, or a float64 if any of
+// them isn't an integer, and their count. The invalid values are skipped.
+func sumOf(state *State, name string, list reflect.Value, key []reflect.Value) (sum interface{}, n int, err error) {
+	var (
+		i       int64
+		f       float64
+		isFloat bool
+	)
+	err = aggregate(state, name, list, key, func(_, v reflect.Value) error {
+		if !v.IsValid() {
+			return nil
+		}
+		n++
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			i += v.Int()
+			return nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			i += int64(v.Uint())
+			return nil
+		}
+		x, err := cast.ToFloat(v.Interface())
+		f += x
+		isFloat = true
+		return err
+	})
+	if isFloat {
+		return f + float64(i), n, err
+	}
+	return i, n, err
+}
+
+// sum returns the sum of the items of the list or of their values by the
+// key, the field path or a function, an int64, or a float64 if any of them
+// isn't an integer:
+//
+//	Total: {{sum .Orders "Total"}}
+func sum(state *State, list reflect.Value, key ...reflect.Value) (interface{}, error) {
+	s, _, err := sumOf(state, "sum", list, key)
+	return s, err
+}
+
+// avg returns the average of the items of the list or of their values by
+// the key, as sum, skipping the nil values, or nil if there are none.
+func avg(state *State, list reflect.Value, key ...reflect.Value) (interface{}, error) {
+	s, n, err := sumOf(state, "avg", list, key)
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	f, _ := cast.ToFloat(s)
+	return f / float64(n), nil
+}
+
+// extremeBy returns the first item of the list with the least, or the
+// greatest, value by the key, skipping the nil values.
+func extremeBy(state *State, name string, list reflect.Value, key []reflect.Value, greatest bool) (interface{}, error) {
+	var item, value reflect.Value
+	err := aggregate(state, name, list, key, func(i, v reflect.Value) error {
+		if !v.IsValid() {
+			return nil
+		}
+		if value.IsValid() {
+			c, err := sortKey{}.compare(v, value)
+			if err != nil || c == 0 || c < 0 == greatest {
+				return err
+			}
+		}
+		item, value = i, v
+		return nil
+	})
+	if err != nil || !item.IsValid() {
+		return nil, err
+	}
+	return item.Interface(), nil
+}
+
+// minBy returns the item of the list with the least value by the key, the
+// field path or a function, or nil if the list is empty:
+//
+//	Cheapest: {{(min_by .Products "Price").Name}}
+func minBy(state *State, list reflect.Value, key ...reflect.Value) (interface{}, error) {
+	return extremeBy(state, "min_by", list, key, false)
+}
+
+// maxBy returns the item of the list with the greatest value by the key, as
+// min_by.
+func maxBy(state *State, list reflect.Value, key ...reflect.Value) (interface{}, error) {
+	return extremeBy(state, "max_by", list, key, true)
+}
+
+// countBy returns the counts of the items of the list by their values by
+// the key, the field path or a function, in the order of their first
+// items:
+//
+//	{{range $status, $n := count_by .Orders "Status"}}{{$status}}: {{$n}}{{end}}
+func countBy(state *State, list reflect.Value, key ...reflect.Value) (*OrderedMap, error) {
+	counts, _ := NewOrderedMap()
+	err := aggregate(state, "count_by", list, key, func(_, v reflect.Value) error {
+		var k interface{}
+		if v.IsValid() {
+			if !v.Type().Comparable() {
+				return fmt.Errorf("key %s isn't comparable", v.Type())
+			}
+			k = v.Interface()
+		}
+		n, _ := counts.Get(k).(int)
+		counts.Set(k, n+1)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
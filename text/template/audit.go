@@ -0,0 +1,148 @@
+package template
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/moisespsena-go/umbu/text/template/parse"
+)
+
+// AuditCall is a function or method call recorded by an Audit.
+type AuditCall struct {
+	Name     string        `json:"name"`
+	ArgTypes []string      `json:"arg_types"`
+	Duration time.Duration `json:"duration"`
+	Template string        `json:"template"`
+	Location string        `json:"location,omitempty"`
+}
+
+// AuditField is a field access path recorded by an Audit.
+type AuditField struct {
+	Path  string `json:"path"`
+	Count int    `json:"count"`
+}
+
+// AuditReport is the result of the executions recorded by an Audit.
+type AuditReport struct {
+	Calls  []AuditCall  `json:"calls"`
+	Fields []AuditField `json:"fields"`
+}
+
+// FuncNames returns the sorted unique names of called functions.
+func (r AuditReport) FuncNames() (names []string) {
+	seen := map[string]bool{}
+	for _, c := range r.Calls {
+		if !seen[c.Name] {
+			seen[c.Name] = true
+			names = append(names, c.Name)
+		}
+	}
+	sort.Strings(names)
+	return
+}
+
+// Audit records every function call and field access of the executions it
+// is attached to. It is safe for concurrent use.
+type Audit struct {
+	mu     sync.Mutex
+	calls  []AuditCall
+	fields map[string]int
+}
+
+// NewAudit creates a new empty Audit.
+func NewAudit() *Audit {
+	return &Audit{fields: map[string]int{}}
+}
+
+// SetAudit enables the audit mode, recording the execution into a.
+// A nil value disables it.
+func (this *Executor) SetAudit(a *Audit) *Executor {
+	this.StateOptions.Audit = a
+	return this
+}
+
+// Report returns the recorded calls, in call order, and the field paths,
+// sorted by path.
+func (a *Audit) Report() (r AuditReport) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	r.Calls = append(r.Calls, a.calls...)
+	for pth, count := range a.fields {
+		r.Fields = append(r.Fields, AuditField{pth, count})
+	}
+	sort.Slice(r.Fields, func(i, j int) bool {
+		return r.Fields[i].Path < r.Fields[j].Path
+	})
+	return
+}
+
+// Reset clears the recorded data.
+func (a *Audit) Reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.calls = nil
+	a.fields = map[string]int{}
+}
+
+func (a *Audit) call(c AuditCall) {
+	a.mu.Lock()
+	a.calls = append(a.calls, c)
+	a.mu.Unlock()
+}
+
+func (a *Audit) field(pth string) {
+	a.mu.Lock()
+	a.fields[pth]++
+	a.mu.Unlock()
+}
+
+// auditCall records the call of fun after it returns.
+func (this *State) auditCall(a *Audit, name string, argv []reflect.Value, start time.Time) {
+	c := AuditCall{
+		Name:     name,
+		Duration: time.Since(start),
+		Template: this.tmpl.Name(),
+		ArgTypes: make([]string, 0, len(argv)),
+	}
+	for _, arg := range argv {
+		if arg.IsValid() && arg.Type() == stateType {
+			continue
+		}
+		c.ArgTypes = append(c.ArgTypes, argTypeName(arg))
+	}
+	if this.node != nil && this.tmpl.Tree != nil {
+		c.Location, _ = this.tmpl.ErrorContext(this.node)
+	}
+	a.call(c)
+}
+
+// auditField records the field path evaluated by node.
+func (this *State) auditField(a *Audit, node parse.Node, ident []string) {
+	var prefix string
+	switch n := node.(type) {
+	case *parse.VariableNode:
+		prefix = n.Ident[0]
+	case *parse.ChainNode:
+		prefix = "(" + n.Node.String() + ")"
+	}
+	a.field(prefix + "." + strings.Join(ident, "."))
+}
+
+func argTypeName(v reflect.Value) string {
+	if !v.IsValid() {
+		return "nil"
+	}
+	if v.Type() == reflectValueType {
+		v = v.Interface().(reflect.Value)
+		if !v.IsValid() {
+			return "nil"
+		}
+	}
+	if v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v.Type().String()
+}
@@ -0,0 +1,31 @@
+package template
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	tmpl := Must(New("audit").Parse(`{{.User.Name}}{{printf "%d" .N}}{{with .User}}{{upper .Name}}{{end}}`))
+	tmpl.Funcs(FuncMap{"upper": func(s string) string { return s + "!" }})
+
+	a := NewAudit()
+	data := map[string]interface{}{
+		"User": struct{ Name string }{"joe"},
+		"N":    1,
+	}
+	if _, err := tmpl.CreateExecutor().SetAudit(a).ExecuteString(data); err != nil {
+		t.Fatal(err)
+	}
+	r := a.Report()
+	if got, want := r.FuncNames(), []string{"printf", "upper"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("funcs: got %v want %v", got, want)
+	}
+	if got, want := r.Calls[0].ArgTypes, []string{"string", "int"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("printf arg types: got %v want %v", got, want)
+	}
+	want := []AuditField{{".N", 1}, {".Name", 1}, {".User", 1}, {".User.Name", 1}}
+	if !reflect.DeepEqual(r.Fields, want) {
+		t.Errorf("fields: got %v want %v", r.Fields, want)
+	}
+}
@@ -0,0 +1,97 @@
+package template
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	htmltemplate "html/template"
+	"net/url"
+	"strings"
+
+	"github.com/moisespsena-go/umbu/cast"
+)
+
+// AvatarProvider builds the URLs of the avatar builtin.
+type AvatarProvider struct {
+	// URL is the base URL, to which the hash of the email is appended.
+	URL string
+	// Hash hashes the trimmed and lower cased email. The default is the
+	// hexadecimal SHA-256 hash.
+	Hash func(email string) string
+	// Size and Default are the names of the query parameters of the size
+	// and of the default image. The defaults are "s" and "d".
+	Size, Default string
+}
+
+// Gravatar is the default avatar provider.
+var Gravatar = &AvatarProvider{URL: "https://www.gravatar.com/avatar/"}
+
+// SetAvatarProvider sets the provider of the avatar builtin.
+func (this *Executor) SetAvatarProvider(provider *AvatarProvider) *Executor {
+	this.StateOptions.AvatarProvider = provider
+	return this
+}
+
+// URLOf returns the avatar URL of the email, with the size in pixels and
+// the default image if they aren't zero.
+func (p *AvatarProvider) URLOf(email string, size int, def string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	var hash string
+	if p.Hash != nil {
+		hash = p.Hash(email)
+	} else {
+		sum := sha256.Sum256([]byte(email))
+		hash = hex.EncodeToString(sum[:])
+	}
+	sizeParam, defParam := p.Size, p.Default
+	if sizeParam == "" {
+		sizeParam = "s"
+	}
+	if defParam == "" {
+		defParam = "d"
+	}
+	query := url.Values{}
+	if size > 0 {
+		query.Set(sizeParam, fmt.Sprint(size))
+	}
+	if def != "" {
+		query.Set(defParam, def)
+	}
+	u := p.URL + hash
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// avatar returns the avatar URL of the email by the provider of the
+// execution, Gravatar by default, typed as a safe URL. The options are
+// the size in pixels and the default image, as "identicon" or an URL:
+//
+//	<img src="{{avatar .Email 80 "identicon"}}">
+func avatar(state *State, email string, opts ...interface{}) (htmltemplate.URL, error) {
+	var (
+		size int64
+		def  string
+		err  error
+	)
+	switch len(opts) {
+	case 2:
+		if def, err = cast.ToString(opts[1]); err != nil {
+			return "", fmt.Errorf("avatar: %v", err)
+		}
+		fallthrough
+	case 1:
+		if size, err = cast.ToInt(opts[0]); err != nil || size < 0 {
+			return "", fmt.Errorf("avatar: invalid size %v", opts[0])
+		}
+	case 0:
+	default:
+		return "", fmt.Errorf("avatar: want the size and the default image, got %d options", len(opts))
+	}
+	provider := state.e.StateOptions.AvatarProvider
+	if provider == nil {
+		provider = Gravatar
+	}
+	return htmltemplate.URL(provider.URLOf(email, int(size), def)), nil
+}
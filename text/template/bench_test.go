@@ -0,0 +1,126 @@
+package template
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/moisespsena-go/umbu/funcs"
+)
+
+type benchNode struct {
+	Name string
+	N    int
+	Next *benchNode
+}
+
+type benchCase struct {
+	name     string
+	executor func() *Executor
+	data     interface{}
+	// maxAllocs is the limit of the allocations of an execution, a little
+	// over the current count, checked by TestAllocs so the regressions of
+	// the executor get caught.
+	maxAllocs float64
+}
+
+func benchRows(n int) []benchNode {
+	rows := make([]benchNode, n)
+	for i := range rows {
+		rows[i] = benchNode{Name: fmt.Sprint("row", i), N: i}
+	}
+	return rows
+}
+
+func benchFuncLayers(n int) []funcs.FuncMap {
+	layers := make([]funcs.FuncMap, n)
+	for i := range layers {
+		layers[i] = funcs.FuncMap{fmt.Sprint("f", i): strings.ToUpper}
+	}
+	return layers
+}
+
+var benchCases = []benchCase{
+	{
+		name: "FieldChain",
+		executor: func() *Executor {
+			return Must(New("t").Parse(`{{.Next.Next.Next.Name}}`)).CreateExecutor()
+		},
+		data:      &benchNode{Next: &benchNode{Next: &benchNode{Next: &benchNode{Name: "x"}}}},
+		maxAllocs: 36,
+	},
+	{
+		name: "Range",
+		executor: func() *Executor {
+			return Must(New("t").Parse(`{{range .}}{{.Name}}:{{.N}};{{end}}`)).CreateExecutor()
+		},
+		data:      benchRows(1000),
+		maxAllocs: 4100,
+	},
+	{
+		name: "NestedTemplates",
+		executor: func() *Executor {
+			return Must(New("t").Parse(`{{template "a" .}}` +
+				`{{define "a"}}<{{template "b" .}}>{{end}}` +
+				`{{define "b"}}<{{template "c" .}}>{{end}}` +
+				`{{define "c"}}<{{.Name}}>{{end}}`)).CreateExecutor()
+		},
+		data:      &benchNode{Name: "x"},
+		maxAllocs: 60,
+	},
+	{
+		name: "Wrap",
+		executor: func() *Executor {
+			return Must(New("t").Parse(`{{range .}}{{wrap}}{{begin}}<p>{{enter}} {{.Name}}{{after}}</p>{{end}}{{end}}`)).CreateExecutor()
+		},
+		data:      benchRows(100),
+		maxAllocs: 450,
+	},
+	{
+		name: "FuncLayers",
+		executor: func() *Executor {
+			e := Must(New("t").Parse(`{{range .}}{{f0 .Name}}{{end}}`)).CreateExecutor()
+			for _, layer := range benchFuncLayers(20) {
+				e = e.Funcs(layer)
+			}
+			return e
+		},
+		data:      benchRows(100),
+		maxAllocs: 560,
+	},
+}
+
+func BenchmarkExecute(b *testing.B) {
+	for _, bc := range benchCases {
+		b.Run(bc.name, func(b *testing.B) {
+			e := bc.executor()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := e.Execute(io.Discard, bc.data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the race detector allocates")
+	}
+	for _, bc := range benchCases {
+		e := bc.executor()
+		var err error
+		allocs := testing.AllocsPerRun(20, func() {
+			err = e.Execute(io.Discard, bc.data)
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", bc.name, err)
+		}
+		if allocs > bc.maxAllocs {
+			t.Errorf("%s: %v allocations, want at most %v", bc.name, allocs, bc.maxAllocs)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package template
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// maxPooledBufferSize is the capacity of the largest buffers kept by the
+// pool, so a large output doesn't keep its memory.
+const maxPooledBufferSize = 64 << 10
+
+// DefaultMaxBufferedSize is the maximum size of the outputs buffered by
+// BufferedExecute, unless set by SetMaxBufferedSize.
+const DefaultMaxBufferedSize = 4 << 20
+
+// ErrOutputTooLarge is the error of BufferedExecute when the output is
+// larger than the maximum buffered size, and of the executions writing more
+// than the output limit of their profile.
+var ErrOutputTooLarge = errors.New("template: output too large")
+
+// bufferPool holds the buffers of the outputs captured by the executions,
+// as the ones of the arg and wrap blocks and of the exec builtin.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// SetBufferSize sets the initial capacity of the buffers of the outputs
+// captured by the executions, as the ones of the arg and wrap blocks and of
+// the exec builtin. The buffers are reused by the executions, so size only
+// avoids growing them the first times.
+func (this *Executor) SetBufferSize(size int) *Executor {
+	this.StateOptions.BufferSize = size
+	return this
+}
+
+// getBuffer returns an empty buffer of capacity size at least.
+func getBuffer(size int) *bytes.Buffer {
+	b := bufferPool.Get().(*bytes.Buffer)
+	if size > 0 {
+		b.Grow(size)
+	}
+	return b
+}
+
+// putBuffer returns the buffer to the pool. It must not be used after.
+func putBuffer(b *bytes.Buffer) {
+	if b.Cap() > maxPooledBufferSize {
+		return
+	}
+	b.Reset()
+	bufferPool.Put(b)
+}
+
+// buffer returns an empty buffer of the execution, returned by putBuffer.
+// The buffers aren't returned when the execution panics, as the writer of
+// the state may still be the buffer.
+func (this *State) buffer() *bytes.Buffer {
+	return getBuffer(this.e.StateOptions.BufferSize)
+}
+
+// SetMaxBufferedSize sets the maximum size of the outputs buffered by
+// BufferedExecute, DefaultMaxBufferedSize if zero. A negative size doesn't
+// limit the outputs.
+func (this *Executor) SetMaxBufferedSize(size int) *Executor {
+	this.StateOptions.MaxBufferedSize = size
+	return this
+}
+
+// BufferedExecute executes the template as Execute, buffering the output,
+// and writes it to wr only if the execution succeeds, so nothing is written
+// on errors, as for the small pages and the emails:
+//
+//	if err := executor.BufferedExecute(w, page); err != nil {
+//		http.Error(w, "internal error", http.StatusInternalServerError)
+//	}
+//
+// The execution fails with an error wrapping ErrOutputTooLarge once the
+// output is larger than the maximum buffered size, see SetMaxBufferedSize.
+// For the larger outputs, see Check.
+func (this *Executor) BufferedExecute(wr io.Writer, data interface{}, funcs ...interface{}) error {
+	max := this.StateOptions.MaxBufferedSize
+	if max == 0 {
+		max = DefaultMaxBufferedSize
+	}
+	b := &limitedBuffer{Buffer: getBuffer(this.StateOptions.BufferSize), max: max}
+	defer putBuffer(b.Buffer)
+	if err := this.Execute(b, data, funcs...); err != nil {
+		if b.full {
+			return fmt.Errorf("%w: more than %d bytes", ErrOutputTooLarge, max)
+		}
+		return err
+	}
+	_, err := b.WriteTo(wr)
+	return err
+}
+
+// limitedBuffer is a buffer failing the writes past max bytes, if positive.
+type limitedBuffer struct {
+	*bytes.Buffer
+	max  int
+	full bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.max > 0 && b.Len()+len(p) > b.max {
+		b.full = true
+		return 0, ErrOutputTooLarge
+	}
+	return b.Buffer.Write(p)
+}
+
+func (b *limitedBuffer) WriteString(s string) (int, error) {
+	if b.max > 0 && b.Len()+len(s) > b.max {
+		b.full = true
+		return 0, ErrOutputTooLarge
+	}
+	return b.Buffer.WriteString(s)
+}
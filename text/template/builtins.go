@@ -8,11 +8,11 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
-	"strconv"
 	"strings"
 	"text/template"
 	"time"
 
+	"github.com/moisespsena-go/umbu/cast"
 	"github.com/moisespsena-go/umbu/expr"
 	"github.com/vjeantet/jodaTime"
 
@@ -21,6 +21,7 @@ import (
 
 var builtins = funcs.FuncMap{
 	"and":            and,
+	"bind":           bind,
 	"call":           call,
 	"html":           template.HTMLEscaper,
 	"index":          index,
@@ -31,6 +32,10 @@ var builtins = funcs.FuncMap{
 	"or":             or,
 	"int":            toI,
 	"uint":           toUi,
+	"to_i":           toI,
+	"to_u":           toUi,
+	"to_f":           toF,
+	"to_s":           toS,
 	"bool":           truth,
 	"string":         fmt.Sprint,
 	"print":          fmt.Sprint,
@@ -40,6 +45,16 @@ var builtins = funcs.FuncMap{
 	"contains":       contains,
 	"to_time":        toTime,
 	"timef":          timeFormat,
+	"numberf":        numberFormat,
+	"first_weekday":  firstWeekday,
+	"in_tz":          inTimezone,
+	"reltime":        relativeTime,
+	"now":            now,
+	"rand_int":       randInt,
+	"rand_float":     randFloat,
+	"unique_id":      uniqueID,
+	"percent":        percent,
+	"ratio":          ratio,
 	"default":        defaultValue,
 	"is_null":        isNull,
 	"not_null":       isNotNull,
@@ -54,6 +69,9 @@ var builtins = funcs.FuncMap{
 	"first_valid":    firstValid,
 	"range_callback": RangeCallback,
 	"dict":           dict,
+	"ordered_map":    NewOrderedMap,
+	"json_line":      jsonLine,
+	"json_lines":     jsonLines,
 
 	// Comparisons
 	"eq": eq, // ==
@@ -63,6 +81,87 @@ var builtins = funcs.FuncMap{
 	"lt": lt, // <
 	"ne": ne, // !=
 
+	// Calendar
+	"start_of_day":      startOfDay,
+	"start_of_week":     startOfWeek,
+	"start_of_month":    startOfMonth,
+	"end_of_month":      endOfMonth,
+	"date_range":        dateRange,
+	"add_business_days": addBusinessDays,
+	"business_days":     businessDays,
+	"iso_week":          isoWeek,
+
+	// Colors
+	"color":    parseColor,
+	"lighten":  lighten,
+	"darken":   darken,
+	"contrast": contrast,
+	"mix":      mix,
+
+	// Images
+	"image_size":  imageSize,
+	"image_color": imageColor,
+	"avatar":      avatar,
+
+	// Templates
+	"render": render,
+	"yield":  yield,
+
+	// Files
+	"include_file": includeFile,
+	"render_file":  renderFile,
+
+	// Collections
+	"chunk":     chunk,
+	"batch":     batch,
+	"zip":       zip,
+	"transpose": transpose,
+	"grid":      grid,
+	"pluck":     pluck,
+	"keys":      keys,
+	"values":    values,
+	"has_key":   hasKey,
+	"pick":      pick,
+	"omit":      omit,
+	"seq":       seq,
+	"until":     until,
+	"take":      take,
+	"skip":      skip,
+	"first":     first,
+	"last":      last,
+	"any":       anyItem,
+	"all":       allItems,
+	"sort_by":   sortBy,
+	"group_by":  groupBy,
+	"sum":       sum,
+	"avg":       avg,
+	"min_by":    minBy,
+	"max_by":    maxBy,
+	"count_by":  countBy,
+
+	// Statistics
+	"median":     median,
+	"percentile": percentile,
+	"variance":   variance,
+	"stddev":     stddev,
+
+	// Print
+	"print_mode":    printMode,
+	"print_css":     printCSS,
+	"page_break":    pageBreak,
+	"keep_together": keepTogether,
+	"running":       running,
+	"page_number":   pageNumber,
+	"page_count":    pageCount,
+
+	// Sets
+	"set_new":        setNew,
+	"set_add":        setAdd,
+	"set_has":        setHas,
+	"set_union":      setUnion,
+	"set_intersect":  setIntersect,
+	"set_difference": setDifference,
+
 	"pow":      pow,
 	"floor":    floor,
 	"typeof":   typeof,
@@ -322,9 +421,46 @@ func length(item reflect.Value) (int, error) {
 
 // Function invocation
 
+// bind returns the function, or the function named, with its leading
+// arguments fixed to args, for call. The functions taking the state are
+// bound to it. See funcs.FuncValue.Bind.
+func bind(state *State, fn interface{}, args ...interface{}) (interface{}, error) {
+	var fv *funcs.FuncValue
+	if name, ok := fn.(string); ok {
+		if fv = state.GetFunc(name); fv == nil {
+			return nil, fmt.Errorf("%q is not a defined function", name)
+		}
+		if err := state.checkFuncAllowed(name); err != nil {
+			return nil, err
+		}
+		if fv.Context() != nil {
+			v := fv.ContextualValue(state.contextValue)
+			fv = funcs.NewFuncValue(v.Interface(), &v)
+		}
+		if state.e.StateOptions.CallLimits != nil {
+			fv = state.countedFunc(name, fv)
+		}
+	} else if v := reflect.ValueOf(fn); v.Kind() == reflect.Func {
+		fv = funcs.NewFuncValue(fn, &v)
+	} else {
+		return nil, fmt.Errorf("bind of non-function %T", fn)
+	}
+	if typ := fv.V().Type(); typ.NumIn() > 0 && typ.In(0) == stateType {
+		args = append([]interface{}{state}, args...)
+	}
+	bound, err := fv.Bind(args...)
+	if err != nil {
+		return nil, err
+	}
+	return bound.F(), nil
+}
+
 // call returns the result of evaluating the first argument as a function.
-// The function must return 1 result, or 2 results, the second of which is an error.
+// The function must return 1 result, or 2 results, the second of which is an
+// error or an ok, returned as a ResultOk if declared, as in
+// {{$v, $ok := call .Lookup "key"}}.
 func call(state *State, fn reflect.Value, args ...reflect.Value) (reflect.Value, error) {
+	okCall := state.okCall
 	v := indirectInterface(fn)
 	if !v.IsValid() {
 		return reflect.Value{}, fmt.Errorf("call of nil")
@@ -375,6 +511,12 @@ func call(state *State, fn reflect.Value, args ...reflect.Value) (reflect.Value,
 		}
 	}
 	result := v.Call(argv)
+	if len(result) == 2 && result[1].Kind() == reflect.Bool {
+		if !okCall {
+			return reflect.Value{}, fmt.Errorf("the function returns a value and an ok, which must be declared, as in {{$v, $ok := call ...}}")
+		}
+		return reflect.ValueOf(ResultOk{result[0].Interface(), result[1].Bool()}), nil
+	}
 	if len(result) == 2 && !result[1].IsNil() {
 		return result[0], result[1].Interface().(error)
 	}
@@ -418,52 +560,27 @@ func or(arg0 reflect.Value, args ...reflect.Value) reflect.Value {
 	return arg0
 }
 
-// toI convert arg to int64
-func toI(arg reflect.Value) (v reflect.Value, err error) {
-	var i int64
-	switch arg.Kind() {
-	case reflect.String:
-		i, err = strconv.ParseInt(arg.String(), 10, 64)
-	case reflect.Bool:
-		if arg.Bool() {
-			i = 1
-		}
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		i = v.Int()
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		i = int64(v.Uint())
-	default:
-		err = fmt.Errorf("can't convert %q to int64", arg.Type().String())
-	}
-	if err != nil {
-		return
-	}
-	v = reflect.ValueOf(i)
-	return
+// toI converts arg to an int64, parsing the strings in the base, 10 by
+// default. See cast.ToInt.
+func toI(arg reflect.Value, base ...int) (int64, error) {
+	return cast.ToInt(arg, base...)
 }
 
-// toUi convert arg to i
-func toUi(arg reflect.Value) (v reflect.Value, err error) {
-	var i uint64
-	switch arg.Kind() {
-	case reflect.String:
-		i, err = strconv.ParseUint(arg.String(), 10, 64)
-	case reflect.Bool:
-		if arg.Bool() {
-			i = 1
-		}
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		i = uint64(v.Int())
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		i = v.Uint()
-	default:
-		err = fmt.Errorf("can't convert %q to int64", arg.Type().String())
-	}
-	if err != nil {
-		return
-	}
-	v = reflect.ValueOf(i)
-	return
+// toUi converts arg to an uint64, parsing the strings in the base, 10 by
+// default. See cast.ToUint.
+func toUi(arg reflect.Value, base ...int) (uint64, error) {
+	return cast.ToUint(arg, base...)
+}
+
+// toF converts arg to a float64. See cast.ToFloat.
+func toF(arg reflect.Value) (float64, error) {
+	return cast.ToFloat(arg)
+}
+
+// toS converts arg to a string, formatting the integers in the base, or the
+// floats with the decimals, of the option. See cast.ToString.
+func toS(arg reflect.Value, opt ...int) (string, error) {
+	return cast.ToString(arg, opt...)
 }
 
 // not returns the Boolean negation of its argument.
@@ -660,8 +777,9 @@ func toTime(item interface{}) (t time.Time, err error) {
 	return t, fmt.Errorf("toTime of type %s", v.Type())
 }
 
-// timeFormat format time object
-func timeFormat(item interface{}, layout string, defaul ...string) (vs string, err error) {
+// timeFormat format time object, in the location of the execution, with
+// the names of the months and days of the locale of the execution
+func timeFormat(state *State, item interface{}, layout string, defaul ...string) (vs string, err error) {
 	if len(defaul) > 0 {
 		vs = defaul[0]
 	}
@@ -676,7 +794,10 @@ func timeFormat(item interface{}, layout string, defaul ...string) (vs string, e
 	}
 	var ok bool
 	if t, ok = v.Interface().(time.Time); ok {
-		vs = jodaTime.Format(layout, t)
+		if loc := state.Location(); loc != nil {
+			t = t.In(loc)
+		}
+		vs = jodaTime.Format(state.Locale().TimeLayout(layout, t), t)
 		return
 	}
 	return
@@ -0,0 +1,130 @@
+package template
+
+import (
+	"fmt"
+	"time"
+)
+
+// startOfDay returns the midnight starting the day of t.
+func startOfDay(item interface{}) (time.Time, error) {
+	t, err := toTime(item)
+	if err != nil {
+		return t, err
+	}
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location()), nil
+}
+
+// startOfWeek returns the midnight starting the week of t, on the first day
+// of the week of the locale of the execution.
+func startOfWeek(state *State, item interface{}) (time.Time, error) {
+	t, err := startOfDay(item)
+	if err != nil {
+		return t, err
+	}
+	days := (int(t.Weekday()) - int(state.Locale().FirstDay) + 7) % 7
+	return t.AddDate(0, 0, -days), nil
+}
+
+// startOfMonth returns the midnight starting the month of t.
+func startOfMonth(item interface{}) (time.Time, error) {
+	t, err := toTime(item)
+	if err != nil {
+		return t, err
+	}
+	y, m, _ := t.Date()
+	return time.Date(y, m, 1, 0, 0, 0, 0, t.Location()), nil
+}
+
+// endOfMonth returns the last instant of the month of t.
+func endOfMonth(item interface{}) (time.Time, error) {
+	t, err := startOfMonth(item)
+	if err != nil {
+		return t, err
+	}
+	return t.AddDate(0, 1, 0).Add(-time.Nanosecond), nil
+}
+
+// dateRange returns the days from the day of from to the day of to,
+// inclusive, stepping by step days, 1 by default.
+func dateRange(from, to interface{}, step ...int) ([]time.Time, error) {
+	start, err := startOfDay(from)
+	if err != nil {
+		return nil, err
+	}
+	end, err := startOfDay(to)
+	if err != nil {
+		return nil, err
+	}
+	days := 1
+	if len(step) > 0 {
+		if days = step[0]; days < 1 {
+			return nil, fmt.Errorf("date_range: step %d is not positive", days)
+		}
+	}
+	var dates []time.Time
+	for t := start; !t.After(end); t = t.AddDate(0, 0, days) {
+		dates = append(dates, t)
+	}
+	return dates, nil
+}
+
+// isBusinessDay reports whether t is a day from Monday to Friday.
+func isBusinessDay(t time.Time) bool {
+	return t.Weekday() != time.Saturday && t.Weekday() != time.Sunday
+}
+
+// addBusinessDays adds n business days, from Monday to Friday, to t, or
+// subtracts them if n is negative.
+func addBusinessDays(item interface{}, n int) (time.Time, error) {
+	t, err := toTime(item)
+	if err != nil {
+		return t, err
+	}
+	step := 1
+	if n < 0 {
+		step, n = -1, -n
+	}
+	for n > 0 {
+		t = t.AddDate(0, 0, step)
+		if isBusinessDay(t) {
+			n--
+		}
+	}
+	return t, nil
+}
+
+// businessDays returns the number of business days, from Monday to Friday,
+// after the day of from until the day of to, inclusive, negative if to is
+// before from.
+func businessDays(from, to interface{}) (int, error) {
+	start, err := startOfDay(from)
+	if err != nil {
+		return 0, err
+	}
+	end, err := startOfDay(to)
+	if err != nil {
+		return 0, err
+	}
+	sign := 1
+	if end.Before(start) {
+		sign, start, end = -1, end, start
+	}
+	n := 0
+	for t := start.AddDate(0, 0, 1); !t.After(end); t = t.AddDate(0, 0, 1) {
+		if isBusinessDay(t) {
+			n++
+		}
+	}
+	return sign * n, nil
+}
+
+// isoWeek returns the ISO 8601 week number of t.
+func isoWeek(item interface{}) (int, error) {
+	t, err := toTime(item)
+	if err != nil {
+		return 0, err
+	}
+	_, week := t.ISOWeek()
+	return week, nil
+}
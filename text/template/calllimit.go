@@ -0,0 +1,62 @@
+package template
+
+import (
+	"path"
+	"reflect"
+
+	"github.com/moisespsena-go/umbu/funcs"
+)
+
+// SetCallLimits bounds the calls of the expensive functions by an
+// execution, including the templates it invokes, as the budget of the
+// untrusted templates. The keys of limits are the names of the functions,
+// or their patterns, as "fetch*", in the syntax of path.Match, and the
+// values the maximum calls:
+//
+//	executor.SetCallLimits(map[string]int{"fetch*": 5, "include_file": 20, "regex_*": 50})
+//
+// The calls of the functions matching a pattern count together, whether
+// called by name, by the functions bound by bind or by State.Call. The call
+// exceeding a limit fails the execution. A nil limits, the default, doesn't
+// limit the calls.
+func (this *Executor) SetCallLimits(limits map[string]int) *Executor {
+	this.StateOptions.CallLimits = limits
+	return this
+}
+
+// countCall counts the call of the function named name by the execution,
+// failing if it exceeds its limit.
+func (this *State) countCall(name string) {
+	limits := this.e.StateOptions.CallLimits
+	if limits == nil {
+		return
+	}
+	for pattern, max := range limits {
+		if ok, _ := path.Match(pattern, name); !ok && pattern != name {
+			continue
+		}
+		if this.execution.calls == nil {
+			this.execution.calls = make(map[string]int)
+		}
+		if this.execution.calls[pattern]++; this.execution.calls[pattern] > max {
+			if pattern == name {
+				this.errorf("%q called more than %d times", name, max)
+			}
+			this.errorf("%q called, the functions %q more than %d times", name, pattern, max)
+		}
+	}
+}
+
+// countedFunc returns the function named name counting its calls, as the
+// ones of the function bound by bind.
+func (this *State) countedFunc(name string, fv *funcs.FuncValue) *funcs.FuncValue {
+	f := fv.V()
+	v := reflect.MakeFunc(f.Type(), func(in []reflect.Value) []reflect.Value {
+		this.countCall(name)
+		if f.Type().IsVariadic() {
+			return f.CallSlice(in)
+		}
+		return f.Call(in)
+	})
+	return funcs.NewFuncValue(v.Interface(), &v)
+}
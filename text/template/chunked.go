@@ -0,0 +1,100 @@
+package template
+
+import (
+	"io"
+	"net/http"
+)
+
+// DefaultChunkElements is the number of the range elements between the
+// yields of the chunked executions, unless set by Chunking.Every.
+const DefaultChunkElements = 1000
+
+// Chunking makes the executions yield to their writers periodically, as
+// for the huge exports rendered directly to the clients. See
+// Executor.SetChunking.
+type Chunking struct {
+	// Every is the number of the range elements executed between the
+	// yields, DefaultChunkElements if zero.
+	Every int
+	// Progress, if not nil, is called on each yield and at the end of the
+	// execution.
+	Progress func(p ChunkProgress)
+}
+
+// ChunkProgress is the progress of a chunked execution.
+type ChunkProgress struct {
+	Elements int64 // the number of the range elements executed.
+	Bytes    int64 // the number of the bytes written to the writer.
+}
+
+// SetChunking makes the executions chunked. A nil c disables it, the
+// default:
+//
+//	executor.SetChunking(&template.Chunking{Every: 500, Progress: func(p template.ChunkProgress) {
+//		log.Printf("%d rows, %d bytes", p.Elements, p.Bytes)
+//	}}).ExecuteContext(r.Context(), w, rows)
+//
+// Every c.Every elements of the ranges, of any template executed, the
+// execution flushes its writer, if a http.Flusher or a writer flushing with
+// an error, as a *bufio.Writer, so the writes block while the client doesn't
+// read, stops if its context is done, and reports its progress to
+// c.Progress.
+func (this *Executor) SetChunking(c *Chunking) *Executor {
+	this.StateOptions.Chunking = c
+	return this
+}
+
+// chunkWriter is the writer of a chunked execution, counting the bytes
+// written.
+type chunkWriter struct {
+	w        io.Writer
+	bytes    int64
+	elements int64 // the number of the range elements executed.
+}
+
+func (w *chunkWriter) Write(p []byte) (n int, err error) {
+	n, err = w.w.Write(p)
+	w.bytes += int64(n)
+	return
+}
+
+func (w *chunkWriter) flush() error {
+	switch f := w.w.(type) {
+	case interface{ Flush() error }:
+		return f.Flush()
+	case http.Flusher:
+		f.Flush()
+	}
+	return nil
+}
+
+// rangeElemDone yields the chunked execution, after a range element, every
+// Chunking.Every elements.
+func (this *State) rangeElemDone() {
+	c := this.e.StateOptions.Chunking
+	if c == nil || this.execution.chunks == nil {
+		return
+	}
+	every := int64(c.Every)
+	if every <= 0 {
+		every = DefaultChunkElements
+	}
+	if this.execution.chunks.elements++; this.execution.chunks.elements%every == 0 {
+		this.yieldChunk()
+	}
+}
+
+// yieldChunk flushes the writer of the chunked execution, stops it if its
+// context is done and reports its progress.
+func (this *State) yieldChunk() {
+	w := this.execution.chunks
+	if err := w.flush(); err != nil {
+		this.writeError(err)
+	}
+	if err := this.context.Err(); err != nil {
+		this.errorf("%w", err)
+	}
+	if c := this.e.StateOptions.Chunking; c.Progress != nil {
+		c.Progress(ChunkProgress{Elements: w.elements, Bytes: w.bytes})
+	}
+}
@@ -0,0 +1,28 @@
+package template
+
+import "time"
+
+// Clock tells the current time of the executions. See Executor.SetClock.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc is the Clock of the function returning the current time.
+type ClockFunc func() time.Time
+
+// Now returns f().
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// SetClock sets the clock of the current time of the time builtins, as now
+// and the base of reltime, so the templates are rendered as of an instant:
+//
+//	executor.SetClock(template.ClockFunc(func() time.Time { return asOf }))
+//
+// A nil clock is the system clock, the default. The clock takes precedence
+// over the time of Deterministic.
+func (this *Executor) SetClock(clock Clock) *Executor {
+	this.StateOptions.Clock = clock
+	return this
+}
@@ -0,0 +1,93 @@
+package template
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// SourceCodec encodes the texts of the templates stored out of the
+// application, as the encrypted ones of the templates authored by the
+// customers, and decodes them when loaded. See CodecProvider and the
+// SetCodec of the loader package.
+type SourceCodec interface {
+	// Encode returns the stored form of the text of the template named
+	// name.
+	Encode(name, text string) (string, error)
+	// Decode returns the text of the template named name from its stored
+	// form.
+	Decode(name, stored string) (string, error)
+}
+
+// CodecProvider returns a provider decoding the texts of the templates of
+// p, stored encoded by the codec, so they are decoded only when parsed:
+//
+//	codec, err := template.NewAESCodec(key)
+//	stored, err := codec.Encode("invoice", text) // stored
+//
+//	tmpl := template.New("invoice").SetProvider(template.CodecProvider(db, codec))
+//
+// See Template.SetProvider.
+func CodecProvider(p TemplateProvider, codec SourceCodec) TemplateProvider {
+	return ProviderFunc(func(name string) (string, error) {
+		stored, err := p.TemplateSource(name)
+		if err != nil {
+			return "", err
+		}
+		text, err := codec.Decode(name, stored)
+		if err != nil {
+			return "", fmt.Errorf("template: decode %q: %w", name, err)
+		}
+		return text, nil
+	})
+}
+
+// aesCodec is the SourceCodec of NewAESCodec.
+type aesCodec struct {
+	aead cipher.AEAD
+}
+
+// NewAESCodec returns a codec encrypting the texts with AES-GCM, keyed by
+// the key of 16, 24 or 32 bytes, as base64 strings. The name of the
+// template is authenticated as well, so a text can't be used as the one of
+// another template.
+func NewAESCodec(key []byte) (SourceCodec, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &aesCodec{aead}, nil
+}
+
+func (c *aesCodec) Encode(name, text string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(text), []byte(name))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (c *aesCodec) Decode(name, stored string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(stored)
+	if err != nil {
+		return "", err
+	}
+	n := c.aead.NonceSize()
+	if len(sealed) < n {
+		return "", errors.New("encrypted text too short")
+	}
+	text, err := c.aead.Open(nil, sealed[:n], sealed[n:], []byte(name))
+	if err != nil {
+		return "", err
+	}
+	return string(text), nil
+}
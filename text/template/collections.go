@@ -0,0 +1,162 @@
+package template
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/moisespsena-go/umbu/cast"
+)
+
+// listArg returns the list argument of the builtin, a slice or an array.
+func listArg(name string, list reflect.Value) (reflect.Value, error) {
+	list = indirectInterface(list)
+	if list, isNil := indirect(list); !isNil {
+		switch list.Kind() {
+		case reflect.Array, reflect.Slice:
+			return list, nil
+		}
+		if list.IsValid() {
+			return reflect.Value{}, fmt.Errorf("%s: want a list, got %s", name, list.Type())
+		}
+	}
+	return reflect.Value{}, fmt.Errorf("%s: list is nil", name)
+}
+
+// sizeArg returns the size argument of the builtin, a positive integer.
+func sizeArg(name string, size reflect.Value) (int, error) {
+	var n int64
+	var err error
+	if size.IsValid() {
+		n, err = cast.ToInt(size)
+	}
+	if !size.IsValid() || err != nil || n < 1 {
+		return 0, fmt.Errorf("%s: invalid size %v", name, size)
+	}
+	return int(n), nil
+}
+
+// chunk splits the list in lists of size items, the last one having the
+// remaining items:
+//
+//	{{range chunk .Cards 3}}<div class="row">{{range .}}...{{end}}</div>{{end}}
+func chunk(list, size reflect.Value) (reflect.Value, error) {
+	return split("chunk", list, size, nil)
+}
+
+// batch splits the list in lists of size items, like chunk, filling the
+// last one with the fill value, if given, up to the size.
+func batch(list, size reflect.Value, fill ...reflect.Value) (reflect.Value, error) {
+	return split("batch", list, size, fill)
+}
+
+// split splits the list for the chunk and batch builtins.
+func split(name string, list, size reflect.Value, fill []reflect.Value) (reflect.Value, error) {
+	list, err := listArg(name, list)
+	if err != nil {
+		return list, err
+	}
+	n, err := sizeArg(name, size)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	sliceType := reflect.SliceOf(list.Type().Elem())
+	var fillValue reflect.Value
+	switch len(fill) {
+	case 0:
+	case 1:
+		if fillValue, err = prepareArg(indirectInterface(fill[0]), sliceType.Elem()); err != nil {
+			return reflect.Value{}, fmt.Errorf("%s: fill: %v", name, err)
+		}
+	default:
+		return reflect.Value{}, fmt.Errorf("%s: want one fill value, got %d", name, len(fill))
+	}
+	chunks := reflect.MakeSlice(reflect.SliceOf(sliceType), 0, (list.Len()+n-1)/n)
+	for i := 0; i < list.Len(); i += n {
+		end := i + n
+		if end > list.Len() {
+			end = list.Len()
+		}
+		c := reflect.MakeSlice(sliceType, end-i, n)
+		reflect.Copy(c, list.Slice(i, end))
+		if fillValue.IsValid() {
+			for c.Len() < n {
+				c = reflect.Append(c, fillValue)
+			}
+		}
+		chunks = reflect.Append(chunks, c)
+	}
+	return chunks, nil
+}
+
+// zip returns the lists of the items of the same index of the lists, up to
+// the length of the shortest one:
+//
+//	{{range zip .Labels .Values}}{{index . 0}}: {{index . 1}}{{end}}
+func zip(lists ...reflect.Value) ([][]interface{}, error) {
+	if len(lists) < 2 {
+		return nil, fmt.Errorf("zip: want at least 2 lists, got %d", len(lists))
+	}
+	n := -1
+	for i, list := range lists {
+		list, err := listArg("zip", list)
+		if err != nil {
+			return nil, err
+		}
+		lists[i] = list
+		if n < 0 || list.Len() < n {
+			n = list.Len()
+		}
+	}
+	result := make([][]interface{}, n)
+	for i := range result {
+		result[i] = make([]interface{}, len(lists))
+		for j, list := range lists {
+			result[i][j] = list.Index(i).Interface()
+		}
+	}
+	return result, nil
+}
+
+// transpose returns the columns of the rows of the list of lists. The
+// columns of the shorter rows, as the last one of chunk, have only the
+// items of the longer rows.
+func transpose(rows reflect.Value) (reflect.Value, error) {
+	rows, err := listArg("transpose", rows)
+	if err != nil {
+		return rows, err
+	}
+	var (
+		elemType reflect.Type
+		columns  int
+	)
+	for i := 0; i < rows.Len(); i++ {
+		row, err := listArg("transpose", rows.Index(i))
+		if err != nil {
+			return row, err
+		}
+		if i == 0 {
+			elemType = row.Type().Elem()
+		} else if elemType != row.Type().Elem() {
+			elemType = reflect.TypeOf((*interface{})(nil)).Elem()
+		}
+		if row.Len() > columns {
+			columns = row.Len()
+		}
+	}
+	if elemType == nil {
+		elemType = reflect.TypeOf((*interface{})(nil)).Elem()
+	}
+	sliceType := reflect.SliceOf(elemType)
+	result := reflect.MakeSlice(reflect.SliceOf(sliceType), columns, columns)
+	for j := 0; j < columns; j++ {
+		column := reflect.MakeSlice(sliceType, 0, rows.Len())
+		for i := 0; i < rows.Len(); i++ {
+			row, _ := listArg("transpose", rows.Index(i))
+			if j < row.Len() {
+				column = reflect.Append(column, row.Index(j))
+			}
+		}
+		result.Index(j).Set(column)
+	}
+	return result, nil
+}
@@ -0,0 +1,110 @@
+package template
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/moisespsena-go/umbu/cast"
+	"github.com/moisespsena-go/umbu/color"
+)
+
+// toColor converts v, a color.Color or a CSS color string, to a color.
+func toColor(v interface{}) (color.Color, error) {
+	switch t := v.(type) {
+	case color.Color:
+		return t, nil
+	case *color.Color:
+		if t != nil {
+			return *t, nil
+		}
+	}
+	s, err := cast.ToString(v)
+	if err != nil {
+		return color.Color{}, fmt.Errorf("invalid color %v", v)
+	}
+	return color.Parse(s)
+}
+
+// toAmount converts v, a number from 0 to 1 or a percentage string as
+// "10%", to an amount.
+func toAmount(v interface{}) (float64, error) {
+	if s, ok := v.(string); ok && strings.HasSuffix(s, "%") {
+		f, err := strconv.ParseFloat(strings.TrimSpace(s[:len(s)-1]), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid amount %q", s)
+		}
+		return f / 100, nil
+	}
+	return cast.ToFloat(v)
+}
+
+// parseColor parses the CSS color.
+func parseColor(v interface{}) (color.Color, error) {
+	return toColor(v)
+}
+
+// lighten increases the lightness of the color by the amount.
+func lighten(v, amount interface{}) (c color.Color, err error) {
+	if c, err = toColor(v); err != nil {
+		return
+	}
+	a, err := toAmount(amount)
+	if err != nil {
+		return c, fmt.Errorf("lighten: %v", err)
+	}
+	return c.Lighten(a), nil
+}
+
+// darken decreases the lightness of the color by the amount.
+func darken(v, amount interface{}) (c color.Color, err error) {
+	if c, err = toColor(v); err != nil {
+		return
+	}
+	a, err := toAmount(amount)
+	if err != nil {
+		return c, fmt.Errorf("darken: %v", err)
+	}
+	return c.Darken(a), nil
+}
+
+// contrast returns the color of the dark and light colors, black and white
+// by default, to write text over the color.
+func contrast(v interface{}, darkLight ...interface{}) (c color.Color, err error) {
+	if c, err = toColor(v); err != nil {
+		return
+	}
+	dark, light := color.Black, color.White
+	switch len(darkLight) {
+	case 0:
+	case 2:
+		if dark, err = toColor(darkLight[0]); err != nil {
+			return
+		}
+		if light, err = toColor(darkLight[1]); err != nil {
+			return
+		}
+	default:
+		return c, fmt.Errorf("contrast: want the dark and light colors, got %d", len(darkLight))
+	}
+	return c.Contrast(dark, light), nil
+}
+
+// mix mixes the colors, weight being the share of the other color, 0.5 by
+// default.
+func mix(v, other interface{}, weight ...interface{}) (c color.Color, err error) {
+	if c, err = toColor(v); err != nil {
+		return
+	}
+	o, err := toColor(other)
+	if err != nil {
+		return
+	}
+	w := 0.5
+	if len(weight) > 0 {
+		if w, err = toAmount(weight[0]); err != nil {
+			return c, fmt.Errorf("mix: %v", err)
+		}
+	}
+	return c.Mix(o, w), nil
+}
@@ -0,0 +1,56 @@
+package template
+
+import (
+	"sort"
+	"strings"
+)
+
+// FuncNames returns the sorted names of the functions the templates
+// executed by the executor may call: the builtins, the functions of the
+// executor and of its parents, and the functions enabled by its options, as
+// eval or env. The internal functions, whose names start with "_", aren't
+// listed.
+func (this *Executor) FuncNames() []string {
+	seen := map[string]bool{}
+	for name := range DefaultFuncMap {
+		seen[name] = true
+	}
+	for name := range (&State{e: this}).stateFuncs() {
+		seen[name] = true
+	}
+	for _, name := range this.AllFuncs().Names() {
+		seen[name] = true
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		if !strings.HasPrefix(name, "_") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FuncNames returns the sorted names of the functions t may call, as the
+// executors created by CreateExecutor. See Executor.FuncNames.
+func (t *Template) FuncNames() []string {
+	return t.CreateExecutor().FuncNames()
+}
+
+// TemplateNames returns the sorted names of the templates associated with
+// t which a {{template}} action may call, the parsed ones.
+func (t *Template) TemplateNames() []string {
+	if t.common == nil {
+		return nil
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	var names []string
+	for name, tmpl := range t.tmpl {
+		if tmpl.Tree != nil && tmpl.Root != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,315 @@
+package template
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/moisespsena-go/umbu/text/template/parse"
+)
+
+// CoverageBlock is an instrumented node of a template: an action, a
+// template invocation, a control structure or one of its branches.
+type CoverageBlock struct {
+	File     string
+	Template string
+	Kind     string
+	Pos      int
+	Line     int
+	Col      int
+	Context  string
+	Count    int
+}
+
+// FileCoverage holds the coverage of the templates parsed from a file.
+type FileCoverage struct {
+	File   string
+	Blocks []CoverageBlock
+}
+
+// Total returns the number of blocks.
+func (f FileCoverage) Total() int {
+	return len(f.Blocks)
+}
+
+// Covered returns the number of executed blocks.
+func (f FileCoverage) Covered() (n int) {
+	for _, b := range f.Blocks {
+		if b.Count > 0 {
+			n++
+		}
+	}
+	return
+}
+
+// Percent returns the percentage of executed blocks.
+func (f FileCoverage) Percent() float64 {
+	if len(f.Blocks) == 0 {
+		return 100
+	}
+	return float64(f.Covered()) * 100 / float64(len(f.Blocks))
+}
+
+// Missed returns the blocks never executed.
+func (f FileCoverage) Missed() (blocks []CoverageBlock) {
+	for _, b := range f.Blocks {
+		if b.Count == 0 {
+			blocks = append(blocks, b)
+		}
+	}
+	return
+}
+
+type coverageKey struct {
+	file, template, node string
+	pos                  int
+}
+
+// coverageNode returns the node type name of a block kind. The branches
+// and the template bodies ("body" kind) are list nodes.
+func coverageNode(kind string) string {
+	if kind == "body" || strings.Contains(kind, ".") {
+		return parse.NodeList.String()
+	}
+	return kind
+}
+
+// Coverage collects which parse nodes were executed. Attach it to executors
+// with Executor.SetCoverage; it is safe for concurrent use.
+type Coverage struct {
+	mu     sync.Mutex
+	blocks map[coverageKey]*CoverageBlock
+	trees  map[*parse.Tree]bool
+}
+
+// NewCoverage creates a new empty Coverage.
+func NewCoverage() *Coverage {
+	return &Coverage{
+		blocks: map[coverageKey]*CoverageBlock{},
+		trees:  map[*parse.Tree]bool{},
+	}
+}
+
+// SetCoverage enables the coverage instrumentation into c. A nil value
+// disables it.
+func (this *Executor) SetCoverage(c *Coverage) *Executor {
+	this.StateOptions.Coverage = c
+	return this
+}
+
+// Register adds the blocks of t and all of its associated templates, so the
+// never executed templates are reported too.
+func (c *Coverage) Register(t *Template) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t.common == nil {
+		c.register(t)
+		return
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, tmpl := range t.tmpl {
+		c.register(tmpl)
+	}
+}
+
+func coverageFile(t *Template) string {
+	if t.Path != "" {
+		return t.Path
+	}
+	if t.Tree != nil && t.Tree.ParseName != "" {
+		return t.Tree.ParseName
+	}
+	return t.name
+}
+
+func (c *Coverage) register(t *Template) {
+	if t.Tree == nil || t.Root == nil || c.trees[t.Tree] {
+		return
+	}
+	c.trees[t.Tree] = true
+	file := coverageFile(t)
+	add := func(kind string, n parse.Node, context string) {
+		key := coverageKey{file, t.name, coverageNode(kind), int(n.Position())}
+		if _, ok := c.blocks[key]; ok {
+			return
+		}
+		line, col := t.Tree.LineCol(n.Position())
+		c.blocks[key] = &CoverageBlock{
+			File:     file,
+			Template: t.name,
+			Kind:     kind,
+			Pos:      key.pos,
+			Line:     line,
+			Col:      col,
+			Context:  context,
+		}
+	}
+	add("body", t.Root, t.name)
+	parse.Inspect(t.Root, func(n parse.Node) bool {
+		switch n := n.(type) {
+		case *parse.ActionNode:
+			add(n.Type().String(), n, n.String())
+		case *parse.TemplateNode:
+			add(n.Type().String(), n, n.String())
+		case *parse.IfNode, *parse.RangeNode, *parse.WithNode, *parse.ArgNode, *parse.CallbackNode:
+			b := branchOf(n)
+			head := fmt.Sprintf("{{%s %s}}", n.Type(), b.Pipe)
+			add(n.Type().String(), n, head)
+			if b.List != nil {
+				add(n.Type().String()+".then", b.List, head)
+			}
+			if b.ElseList != nil {
+				add(n.Type().String()+".else", b.ElseList, head+"{{else}}")
+			}
+		case *parse.WrapNode:
+			head := fmt.Sprintf("{{wrap %s}}", n.Pipe)
+			add("wrap", n, head)
+			if n.ElseList != nil {
+				add("wrap.else", n.ElseList, head+"{{else}}")
+			}
+		}
+		return true
+	})
+}
+
+func branchOf(n parse.Node) *parse.BranchNode {
+	switch n := n.(type) {
+	case *parse.IfNode:
+		return &n.BranchNode
+	case *parse.RangeNode:
+		return &n.BranchNode
+	case *parse.WithNode:
+		return &n.BranchNode
+	case *parse.ArgNode:
+		return &n.BranchNode
+	case *parse.CallbackNode:
+		return &n.BranchNode
+	}
+	return nil
+}
+
+// hit marks the node n of the template t as executed. Nodes that aren't
+// blocks are ignored.
+func (c *Coverage) hit(t *Template, n parse.Node) {
+	if t.Tree == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.register(t)
+	if b := c.blocks[coverageKey{coverageFile(t), t.name, n.Type().String(), int(n.Position())}]; b != nil {
+		b.Count++
+	}
+}
+
+// Merge adds the counters of other into c.
+func (c *Coverage) Merge(other *Coverage) {
+	if other == c {
+		return
+	}
+	other.mu.Lock()
+	blocks := make([]CoverageBlock, 0, len(other.blocks))
+	for _, b := range other.blocks {
+		blocks = append(blocks, *b)
+	}
+	other.mu.Unlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, b := range blocks {
+		c.merge(b)
+	}
+}
+
+func (c *Coverage) merge(b CoverageBlock) {
+	key := coverageKey{b.File, b.Template, coverageNode(b.Kind), b.Pos}
+	if cur := c.blocks[key]; cur != nil {
+		cur.Count += b.Count
+	} else {
+		c.blocks[key] = &b
+	}
+}
+
+// Report returns the coverage grouped by file, sorted by file name. The
+// blocks of each file are sorted by template and position.
+func (c *Coverage) Report() (files []FileCoverage) {
+	c.mu.Lock()
+	byFile := map[string][]CoverageBlock{}
+	for _, b := range c.blocks {
+		byFile[b.File] = append(byFile[b.File], *b)
+	}
+	c.mu.Unlock()
+
+	for file, blocks := range byFile {
+		sort.Slice(blocks, func(i, j int) bool {
+			if blocks[i].Template != blocks[j].Template {
+				return blocks[i].Template < blocks[j].Template
+			}
+			if blocks[i].Pos != blocks[j].Pos {
+				return blocks[i].Pos < blocks[j].Pos
+			}
+			return blocks[i].Kind < blocks[j].Kind
+		})
+		files = append(files, FileCoverage{file, blocks})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].File < files[j].File
+	})
+	return
+}
+
+// WriteTo writes the coverage profile to w, one tab separated block per line,
+// so profiles of many runs can be merged with ReadCoverage and Merge.
+func (c *Coverage) WriteTo(w io.Writer) (n int64, err error) {
+	bw := bufio.NewWriter(w)
+	for _, f := range c.Report() {
+		for _, b := range f.Blocks {
+			var m int
+			m, err = fmt.Fprintf(bw, "%s\t%s\t%s\t%d\t%d\t%d\t%d\t%s\n", b.File, b.Template, b.Kind, b.Pos,
+				b.Line, b.Col, b.Count, strconv.Quote(b.Context))
+			n += int64(m)
+			if err != nil {
+				return
+			}
+		}
+	}
+	err = bw.Flush()
+	return
+}
+
+// ReadCoverage reads a coverage profile written by Coverage.WriteTo.
+func ReadCoverage(r io.Reader) (*Coverage, error) {
+	c := NewCoverage()
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, "\t", 8)
+		if len(parts) != 8 {
+			return nil, fmt.Errorf("coverage: line %d: bad number of fields", lineNum)
+		}
+		var (
+			b    = CoverageBlock{File: parts[0], Template: parts[1], Kind: parts[2]}
+			ints = []*int{&b.Pos, &b.Line, &b.Col, &b.Count}
+			err  error
+		)
+		for i, p := range ints {
+			if *p, err = strconv.Atoi(parts[3+i]); err != nil {
+				return nil, fmt.Errorf("coverage: line %d: %v", lineNum, err)
+			}
+		}
+		if b.Context, err = strconv.Unquote(parts[7]); err != nil {
+			return nil, fmt.Errorf("coverage: line %d: %v", lineNum, err)
+		}
+		c.merge(b)
+	}
+	return c, scanner.Err()
+}
@@ -0,0 +1,51 @@
+package template
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCoverage(t *testing.T) {
+	tmpl := Must(New("cov").Parse(`{{define "unused"}}x{{end}}{{if .}}yes{{else}}no{{end}}`))
+
+	c := NewCoverage()
+	c.Register(tmpl)
+	if _, err := tmpl.CreateExecutor().SetCoverage(c).ExecuteString(true); err != nil {
+		t.Fatal(err)
+	}
+
+	files := c.Report()
+	if len(files) != 1 {
+		t.Fatalf("got %d files", len(files))
+	}
+	f := files[0]
+	// cov: body, if, if.then, if.else; unused: body
+	if f.Total() != 5 || f.Covered() != 3 {
+		t.Errorf("got %d/%d covered", f.Covered(), f.Total())
+	}
+	var missed []string
+	for _, b := range f.Missed() {
+		missed = append(missed, b.Template+":"+b.Kind)
+	}
+	if got, want := len(missed), 2; got != want || missed[0] != "cov:if.else" || missed[1] != "unused:body" {
+		t.Errorf("missed: got %v", missed)
+	}
+
+	// merge other run through the profile format
+	other := NewCoverage()
+	if _, err := tmpl.CreateExecutor().SetCoverage(other).ExecuteString(false); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := other.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadCoverage(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Merge(read)
+	if f := c.Report()[0]; f.Covered() != 4 {
+		t.Errorf("after merge got %d covered", f.Covered())
+	}
+}
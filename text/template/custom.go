@@ -0,0 +1,67 @@
+package template
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/moisespsena-go/umbu/text/template/parse"
+)
+
+// ActionWalker executes the actions of a custom keyword. It writes to
+// s.Writer() and may evaluate the pipeline of the action with
+// s.EvalPipeline and execute its body with s.Walk.
+type ActionWalker func(s *State, dot reflect.Value, n *parse.CustomNode)
+
+var (
+	walkersMu sync.RWMutex
+	walkers   = map[string]ActionWalker{}
+)
+
+// RegisterAction registers the custom action keyword k, executed by walk:
+//
+//	RegisterAction(parse.Keyword{Name: "svg"}, func(s *State, dot reflect.Value, n *parse.CustomNode) {
+//		name := s.EvalPipeline(dot, n.Pipe).String()
+//		io.WriteString(s.Writer(), icons[name])
+//	})
+//
+// The keyword is known by all the templates parsed after the registration,
+// so it's usually registered on package initialization. See
+// parse.RegisterKeyword for the restrictions on the keyword.
+func RegisterAction(k parse.Keyword, walk ActionWalker) {
+	if walk == nil {
+		panic("template: nil walker for keyword " + k.Name)
+	}
+	parse.RegisterKeyword(k)
+	walkersMu.Lock()
+	defer walkersMu.Unlock()
+	walkers[k.Name] = walk
+}
+
+// EvalPipeline evaluates the pipeline with dot and returns its value. The
+// variables declared by the pipeline persist until the end of the current
+// action.
+func (this *State) EvalPipeline(dot reflect.Value, pipe *parse.PipeNode) reflect.Value {
+	return this.evalPipeline(dot, pipe)
+}
+
+// Walk executes the node with dot.
+func (this *State) Walk(dot reflect.Value, node parse.Node) {
+	this.walk(dot, node)
+}
+
+// Errorf stops the execution with an error at the current node.
+func (this *State) Errorf(format string, args ...interface{}) {
+	this.errorf(format, args...)
+}
+
+func (this *State) walkCustom(dot reflect.Value, n *parse.CustomNode) {
+	walkersMu.RLock()
+	walk := walkers[n.Keyword]
+	walkersMu.RUnlock()
+	if walk == nil {
+		this.errorf("no walker for keyword %q", n.Keyword)
+	}
+	defer this.pop(this.mark())
+	walk(this, dot, n)
+	this.at(n)
+}
@@ -0,0 +1,62 @@
+package template
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/moisespsena-go/umbu/text/template/parse"
+)
+
+func init() {
+	RegisterAction(parse.Keyword{Name: "testicon"}, func(s *State, dot reflect.Value, n *parse.CustomNode) {
+		io.WriteString(s.Writer(), "<icon:"+fmt.Sprint(s.EvalPipeline(dot, n.Pipe))+">")
+	})
+	RegisterAction(parse.Keyword{Name: "testrepeat", Block: true}, func(s *State, dot reflect.Value, n *parse.CustomNode) {
+		count := s.EvalPipeline(dot, n.Pipe)
+		if count.Kind() != reflect.Int {
+			s.Errorf("testrepeat: bad count %v", count)
+		}
+		if count.Int() == 0 && n.ElseList != nil {
+			s.Walk(dot, n.ElseList)
+		}
+		for i := 0; i < int(count.Int()); i++ {
+			s.Walk(reflect.ValueOf(i), n.List)
+		}
+	})
+}
+
+func TestCustomActions(t *testing.T) {
+	for _, test := range []struct {
+		name, text string
+		data       interface{}
+		out, err   string
+	}{
+		{"icon", `a{{testicon .}}b`, "star", "a<icon:star>b", ""},
+		{"block", `{{testrepeat .}}[{{.}}]{{else}}none{{end}}`, 3, "[0][1][2]", ""},
+		{"else", `{{testrepeat .}}[{{.}}]{{else}}none{{end}}`, 0, "none", ""},
+		{"vars", `{{testrepeat $n := .}}{{$n}}{{end}}`, 2, "22", ""},
+		{"error", `{{testrepeat .}}x{{end}}`, "x", "", "testrepeat: bad count x"},
+	} {
+		tmpl, err := New(test.name).Parse(test.text)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		var buf bytes.Buffer
+		err = tmpl.Execute(&buf, test.data)
+		switch {
+		case test.err != "":
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+			}
+		case err != nil:
+			t.Errorf("%s: %v", test.name, err)
+		case buf.String() != test.out:
+			t.Errorf("%s: got %q, want %q", test.name, buf.String(), test.out)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package template
+
+import "strings"
+
+// templateCall is a frame of the chain of the templates being executed.
+type templateCall struct {
+	tmpl   *Template
+	parent *templateCall
+}
+
+// cycle returns the chain of templates from the last call of tmpl, as in
+// "A → B → A", or an empty string if tmpl isn't being executed.
+func (this *templateCall) cycle(tmpl *Template) string {
+	names := []string{tmpl.name}
+	for c := this; c != nil; c = c.parent {
+		names = append(names, c.tmpl.name)
+		if c.tmpl == tmpl {
+			for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+				names[i], names[j] = names[j], names[i]
+			}
+			return strings.Join(names, " → ")
+		}
+	}
+	return ""
+}
+
+// SetDetectCycles enables the detection of template cycles: a template
+// invoking itself, directly or through other templates, fails immediately
+// reporting the cycle, as in "template cycle: A → B → A". It's disabled by
+// default because recursive templates bounded by the data, such as those
+// rendering trees, are legit.
+func (this *Executor) SetDetectCycles(detect bool) *Executor {
+	this.StateOptions.DetectCycles = detect
+	return this
+}
+
+// enterTemplate checks the execution of tmpl from the current template and
+// returns the frame of its call.
+func (this *State) enterTemplate(tmpl *Template) *templateCall {
+	if this.e.StateOptions.DetectCycles {
+		if cycle := this.calls.cycle(tmpl); cycle != "" {
+			this.errorf("template cycle: %s", cycle)
+		}
+	}
+	if this.depth == maxExecDepth {
+		if cycle := this.calls.cycle(tmpl); cycle != "" {
+			this.errorf("exceeded maximum template depth (%v) in cycle %s", maxExecDepth, cycle)
+		}
+		this.errorf("exceeded maximum template depth (%v)", maxExecDepth)
+	}
+	return &templateCall{tmpl, this.calls}
+}
@@ -0,0 +1,234 @@
+package template
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// cycleMarker is printed in place of the values within themselves.
+const cycleMarker = "…cycle…"
+
+// fprint prints the value to w as fmt.Fprint does, but the maps and the
+// slices within themselves, as the ones of the cyclic structures, which
+// fmt.Fprint prints endlessly, are printed as cycleMarker:
+//
+//	m := map[string]interface{}{"a": 1}
+//	m["self"] = m // printed as map[a:1 self:…cycle…]
+func fprint(w io.Writer, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct, reflect.Ptr:
+		if hasCycle(rv, map[cycleKey]bool{}, 0) {
+			break
+		}
+		fallthrough
+	default:
+		_, err := fmt.Fprint(w, v)
+		return err
+	}
+	var b strings.Builder
+	printCycleSafe(&b, rv, map[cycleKey]bool{}, 0)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// cycleKey identifies a map or a slice being printed.
+type cycleKey struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+// printsMethod reports whether fmt prints v by its Error or String method,
+// not walking it.
+func printsMethod(v reflect.Value) bool {
+	if !v.CanInterface() {
+		return false
+	}
+	t := v.Type()
+	return t.Implements(errorType) || t.Implements(fmtStringerType)
+}
+
+// enter marks the map or the slice v as being printed, returning false if
+// it already is, and the function unmarking it.
+func enter(v reflect.Value, path map[cycleKey]bool) (bool, func()) {
+	if v.Kind() != reflect.Map && v.Kind() != reflect.Slice || v.IsNil() {
+		return true, func() {}
+	}
+	key := cycleKey{v.Pointer(), v.Type()}
+	if path[key] {
+		return false, nil
+	}
+	path[key] = true
+	return true, func() { delete(path, key) }
+}
+
+// hasCycle reports whether fmt walks v within itself. The pointers are
+// followed only at depth 0, as fmt does.
+func hasCycle(v reflect.Value, path map[cycleKey]bool, depth int) bool {
+	if printsMethod(v) {
+		return false
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if depth == 0 && !v.IsNil() {
+			return hasCycle(v.Elem(), path, depth+1)
+		}
+	case reflect.Interface:
+		if !v.IsNil() {
+			return hasCycle(v.Elem(), path, depth+1)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if hasCycle(v.Field(i), path, depth+1) {
+				return true
+			}
+		}
+	case reflect.Map:
+		ok, leave := enter(v, path)
+		if !ok {
+			return true
+		}
+		defer leave()
+		for it := v.MapRange(); it.Next(); {
+			if hasCycle(it.Key(), path, depth+1) || hasCycle(it.Value(), path, depth+1) {
+				return true
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return false
+		}
+		ok, leave := enter(v, path)
+		if !ok {
+			return true
+		}
+		defer leave()
+		for i := 0; i < v.Len(); i++ {
+			if hasCycle(v.Index(i), path, depth+1) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// printCycleSafe prints v to b as fmt.Fprint does, printing the maps and
+// the slices within themselves as cycleMarker.
+func printCycleSafe(b *strings.Builder, v reflect.Value, path map[cycleKey]bool, depth int) {
+	if printsMethod(v) {
+		fmt.Fprint(b, v.Interface())
+		return
+	}
+	switch v.Kind() {
+	case reflect.Invalid:
+		b.WriteString("<invalid reflect.Value>")
+	case reflect.Ptr:
+		if depth == 0 && !v.IsNil() {
+			switch v.Elem().Kind() {
+			case reflect.Array, reflect.Slice, reflect.Struct, reflect.Map:
+				b.WriteByte('&')
+				printCycleSafe(b, v.Elem(), path, depth+1)
+				return
+			}
+		}
+		printPointer(b, v)
+	case reflect.Interface:
+		if v.IsNil() {
+			b.WriteString("<nil>")
+			return
+		}
+		printCycleSafe(b, v.Elem(), path, depth+1)
+	case reflect.Struct:
+		b.WriteByte('{')
+		for i := 0; i < v.NumField(); i++ {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			printCycleSafe(b, v.Field(i), path, depth+1)
+		}
+		b.WriteByte('}')
+	case reflect.Map:
+		ok, leave := enter(v, path)
+		if !ok {
+			b.WriteString(cycleMarker)
+			return
+		}
+		defer leave()
+		keys := v.MapKeys()
+		texts := make([]string, len(keys))
+		for i, key := range keys {
+			var kb strings.Builder
+			printCycleSafe(&kb, key, path, depth+1)
+			texts[i] = kb.String()
+		}
+		sort.Sort(keysByText{keys, texts})
+		b.WriteString("map[")
+		for i, key := range keys {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(texts[i])
+			b.WriteByte(':')
+			printCycleSafe(b, v.MapIndex(key), path, depth+1)
+		}
+		b.WriteByte(']')
+	case reflect.Slice, reflect.Array:
+		ok, leave := enter(v, path)
+		if !ok {
+			b.WriteString(cycleMarker)
+			return
+		}
+		defer leave()
+		b.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			printCycleSafe(b, v.Index(i), path, depth+1)
+		}
+		b.WriteByte(']')
+	case reflect.Bool:
+		fmt.Fprint(b, v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		fmt.Fprint(b, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		fmt.Fprint(b, v.Uint())
+	case reflect.Float32:
+		fmt.Fprint(b, float32(v.Float()))
+	case reflect.Float64:
+		fmt.Fprint(b, v.Float())
+	case reflect.Complex64:
+		fmt.Fprint(b, complex64(v.Complex()))
+	case reflect.Complex128:
+		fmt.Fprint(b, v.Complex())
+	case reflect.String:
+		b.WriteString(v.String())
+	default:
+		printPointer(b, v)
+	}
+}
+
+// printPointer prints the pointer, the channel or the function v.
+func printPointer(b *strings.Builder, v reflect.Value) {
+	if v.IsNil() {
+		b.WriteString("<nil>")
+		return
+	}
+	fmt.Fprintf(b, "%#x", v.Pointer())
+}
+
+// keysByText sorts the keys of a map by their texts.
+type keysByText struct {
+	keys  []reflect.Value
+	texts []string
+}
+
+func (x keysByText) Len() int           { return len(x.keys) }
+func (x keysByText) Less(i, j int) bool { return x.texts[i] < x.texts[j] }
+func (x keysByText) Swap(i, j int) {
+	x.keys[i], x.keys[j] = x.keys[j], x.keys[i]
+	x.texts[i], x.texts[j] = x.texts[j], x.texts[i]
+}
@@ -0,0 +1,43 @@
+package template
+
+import (
+	"reflect"
+	"strings"
+)
+
+// SetMaxFieldDepth bounds the traversal of the data by the field chains,
+// as the budget of the untrusted data: the fields of a chain, as the 3 of
+// .A.B.C, and the pointers and interfaces followed to get each field, as
+// the ones of the self-referential data structures. The chains deeper fail
+// the execution. A zero depth, the default, doesn't limit the chains.
+func (this *Executor) SetMaxFieldDepth(depth int) *Executor {
+	this.StateOptions.MaxFieldDepth = depth
+	return this
+}
+
+// checkFieldChain fails the field chain deeper than the maximum field
+// depth.
+func (this *State) checkFieldChain(ident []string) {
+	if max := this.e.StateOptions.MaxFieldDepth; max > 0 && len(ident) > max {
+		this.errorf("field chain .%s deeper than %d", strings.Join(ident, "."), max)
+	}
+}
+
+// checkIndirections fails the receiver of the field reached through more
+// pointers and interfaces than the maximum field depth.
+func (this *State) checkIndirections(receiver reflect.Value, fieldName string) {
+	max := this.e.StateOptions.MaxFieldDepth
+	if max <= 0 {
+		return
+	}
+	v := receiver
+	for i := 0; v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface; i++ {
+		if v.IsNil() {
+			return
+		}
+		if i == max {
+			this.errorf("field %s of %s reached through more than %d indirections", fieldName, receiver.Type(), max)
+		}
+		v = v.Elem()
+	}
+}
@@ -0,0 +1,114 @@
+package template
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Deterministic makes the executions of the same templates and data write
+// the same output, as for the snapshot tests and the generated files. See
+// Executor.SetDeterministic.
+type Deterministic struct {
+	// Seed is the seed of the random builtins of each execution.
+	Seed int64
+	// Now is the time of the now builtin and the base of the relative
+	// times of reltime.
+	Now time.Time
+}
+
+// execution holds the state shared by an execution and its executions of
+// other templates, as by template_exec.
+type execution struct {
+	rand *rand.Rand // the random generator of the deterministic execution.
+	ids  int        // the number of the unique IDs of the deterministic execution.
+
+	chunks *chunkWriter   // the writer of the chunked execution.
+	steps  int64          // the number of the nodes executed.
+	calls  map[string]int // the calls of the limited functions, by pattern.
+
+	nested int // the nesting of the templates executed by render or yield.
+}
+
+// uniqueIDs is the number of the unique IDs of the executions that aren't
+// deterministic.
+var uniqueIDs int64
+
+// SetDeterministic makes the executions deterministic. A nil d disables it,
+// the default. The builtins
+//
+//	{{rand_int 6}}       the random int in [0, 6).
+//	{{rand_float}}       the random float64 in [0, 1).
+//	{{unique_id "tab"}}  the ID unique in the process, as "tab-3".
+//	{{now}}              the current time.
+//
+// are deterministic then: rand_int and rand_float are seeded by d.Seed,
+// unique_id counts the IDs of each execution from 1, and now, as the base
+// of reltime, is d.Now, unless the executor has a clock. The maps are ranged
+// and printed in the order of their keys anyway.
+func (this *Executor) SetDeterministic(d *Deterministic) *Executor {
+	this.StateOptions.Deterministic = d
+	return this
+}
+
+// random returns the random generator of the execution, or nil if it
+// isn't deterministic.
+func (this *State) random() *rand.Rand {
+	d := this.e.StateOptions.Deterministic
+	if d == nil {
+		return nil
+	}
+	if this.execution.rand == nil {
+		this.execution.rand = rand.New(rand.NewSource(d.Seed))
+	}
+	return this.execution.rand
+}
+
+// now returns the current time of the execution.
+func (this *State) now() time.Time {
+	if c := this.e.StateOptions.Clock; c != nil {
+		return c.Now()
+	}
+	if d := this.e.StateOptions.Deterministic; d != nil {
+		return d.Now
+	}
+	return time.Now()
+}
+
+func randInt(state *State, n int) (int, error) {
+	if n <= 0 {
+		return 0, fmt.Errorf("rand_int: non-positive n %d", n)
+	}
+	if r := state.random(); r != nil {
+		return r.Intn(n), nil
+	}
+	return rand.Intn(n), nil
+}
+
+func randFloat(state *State) float64 {
+	if r := state.random(); r != nil {
+		return r.Float64()
+	}
+	return rand.Float64()
+}
+
+func uniqueID(state *State, prefix ...string) string {
+	var n int64
+	if state.e.StateOptions.Deterministic != nil {
+		state.execution.ids++
+		n = int64(state.execution.ids)
+	} else {
+		n = atomic.AddInt64(&uniqueIDs, 1)
+	}
+	id := strconv.FormatInt(n, 10)
+	if len(prefix) > 0 {
+		id = prefix[0] + "-" + id
+	}
+	return id
+}
+
+func now(state *State) time.Time {
+	return state.now()
+}
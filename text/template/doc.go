@@ -117,6 +117,19 @@ data, defined in detail in the corresponding sections that follow.
 		The template with the specified name is executed with dot set
 		to the value of the pipeline.
 
+	{{$x := template "name" pipeline}}
+		The template with the specified name is executed with dot set
+		to the value of the pipeline and $x set to the value of its
+		{{return}} action or, if it doesn't return, to its output.
+
+	{{return}}
+	{{return pipeline}}
+		The execution of the template ends, with the value of the
+		pipeline, if any, as its result. Only a template invoked as an
+		operand has a result: in a template executed directly or by a
+		{{template}} action, {{return}} just ends its execution, the
+		output written so far kept.
+
 	{{block "name" pipeline}} T1 {{end}}
 		A block is shorthand for defining a template
 			{{define "name"}} T1 {{end}}
@@ -272,6 +285,14 @@ characters '|'. In a chained pipeline, the result of each command is
 passed as the last argument of the following command. The output of the final
 command in the pipeline is the value of the pipeline.
 
+In the filter form, a function name followed by a colon, as the filters of
+Django and Tera, the result of the previous command is passed as the first
+argument instead:
+
+	{{.Nickname | default: .Name "anonymous"}}
+
+calls default(.Nickname, .Name, "anonymous").
+
 The output of a command will be either one value or two values, the second of
 which has type error. If that second value is present and evaluates to
 non-nil, execution terminates and the error is returned to the caller of
@@ -380,6 +401,11 @@ Predefined global functions are named as follows.
 		first empty argument or the last argument, that is,
 		"and x y" behaves as "if x then y else x". All the
 		arguments are evaluated.
+	bind
+		Returns the function of the first argument, a function value
+		or the name of a function, with its leading parameters fixed
+		to the remaining arguments, for call. Thus
+		"call (bind "printf" "%d-%d" 1) 2" is "printf "%d-%d" 1 2".
 	call
 		Returns the result of calling the first argument, which
 		must be a function, with the remaining arguments as parameters.
@@ -417,11 +443,26 @@ Predefined global functions are named as follows.
 		An alias for fmt.Sprintf
 	println
 		An alias for fmt.Sprintln
+	render
+		Returns the output of the template named by the first argument,
+		executed with dot set to the second argument, if any. Thus
+		"render "card" .User" is the output of {{template "card" .User}}.
+		The options following the data set the variables the template
+		inherits: "vars:none", the default, none, as {{template}};
+		"vars:globals" the ones inherited by the invoking template; and
+		"vars:all" these and the ones in scope at the call. The template
+		executes in the execution of the invoking one, counting in its
+		depth and its limits.
 	urlquery
 		Returns the escaped value of the textual representation of
 		its arguments in a form suitable for embedding in a URL query.
 		This function is unavailable in html/template, with a few
 		exceptions.
+	yield
+		Writes the output of the template named by the first argument,
+		as render, with the same options. Thus
+		"yield .Widget.Template .Widget" is {{template}} with a name
+		evaluated on execution.
 
 The boolean functions take any zero value to be false and a non-zero
 value to be true.
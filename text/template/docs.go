@@ -0,0 +1,145 @@
+package template
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/moisespsena-go/umbu/text/template/parse"
+)
+
+// TemplateDoc is the documentation of a template, extracted from the
+// comment leading its body:
+//
+//	{{define "card" $title}}
+//	{{/*
+//	Card renders a card with a title and a list of items.
+//
+//	@arg $title string The card title.
+//	@arg .Items []Item The items listed by the card.
+//	*/}}
+//	...
+//	{{end}}
+//
+// Each "@arg" line documents an argument: its name, its type and its
+// description. The text before the first "@arg" line is the description.
+//
+// The comments are only kept by parsing in the parse.ParseComments mode,
+// see Template.ParseMode.
+type TemplateDoc struct {
+	Name        string
+	Description string
+	Args        []ArgDoc
+}
+
+// ArgDoc is the documentation of a template argument. The arguments
+// declared by a {{define}} action and not documented have an empty
+// Description and the declared type, if any.
+type ArgDoc struct {
+	Name        string
+	Type        string
+	Description string
+}
+
+// Doc returns the documentation of t. The ok result reports whether t has
+// a leading doc comment.
+func (t *Template) Doc() (doc TemplateDoc, ok bool) {
+	doc.Name = t.name
+	if t.Tree != nil && t.Root != nil {
+		var comment string
+		if comment, ok = leadingComment(t.Root); ok {
+			doc.Description, doc.Args = parseDoc(comment)
+		}
+	}
+	var params []parse.Param
+	if t.Tree != nil {
+		params = t.Tree.Params()
+	}
+	for i, name := range t.args {
+		var documented bool
+		for _, arg := range doc.Args {
+			if arg.Name == name {
+				documented = true
+				break
+			}
+		}
+		if !documented {
+			arg := ArgDoc{Name: name}
+			if i < len(params) {
+				arg.Type = params[i].Type
+			}
+			doc.Args = append(doc.Args, arg)
+		}
+	}
+	return
+}
+
+// Docs returns the documentation of t and its associated templates, sorted
+// by name. Templates without doc comment are skipped.
+func (t *Template) Docs() (docs []TemplateDoc) {
+	if t.common == nil {
+		if doc, ok := t.Doc(); ok {
+			docs = append(docs, doc)
+		}
+		return
+	}
+	t.mu.RLock()
+	for _, tmpl := range t.tmpl {
+		if doc, ok := tmpl.Doc(); ok {
+			docs = append(docs, doc)
+		}
+	}
+	t.mu.RUnlock()
+	sort.Slice(docs, func(i, j int) bool {
+		return docs[i].Name < docs[j].Name
+	})
+	return
+}
+
+// leadingComment returns the text of the comment preceding any non space
+// text or action of the list.
+func leadingComment(list *parse.ListNode) (string, bool) {
+	for _, n := range list.Nodes {
+		switch n := n.(type) {
+		case *parse.TextNode:
+			if strings.TrimSpace(string(n.Text)) != "" {
+				return "", false
+			}
+		case *parse.CommentNode:
+			text := strings.TrimPrefix(n.Text, "/*")
+			return strings.TrimSuffix(text, "*/"), true
+		default:
+			return "", false
+		}
+	}
+	return "", false
+}
+
+func parseDoc(comment string) (description string, args []ArgDoc) {
+	var lines []string
+	for _, line := range strings.Split(comment, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != "@arg" {
+			if len(args) == 0 {
+				lines = append(lines, strings.TrimSpace(line))
+			} else if len(fields) > 0 {
+				// continuation of the argument description
+				last := &args[len(args)-1]
+				last.Description = strings.TrimSpace(last.Description + " " + strings.Join(fields, " "))
+			}
+			continue
+		}
+		var arg ArgDoc
+		if len(fields) > 1 {
+			arg.Name = fields[1]
+		}
+		if len(fields) > 2 {
+			arg.Type = fields[2]
+		}
+		if len(fields) > 3 {
+			arg.Description = strings.Join(fields[3:], " ")
+		}
+		args = append(args, arg)
+	}
+	description = strings.TrimSpace(strings.Join(lines, "\n"))
+	return
+}
@@ -0,0 +1,45 @@
+package template
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/moisespsena-go/umbu/text/template/parse"
+)
+
+const docsText = `{{/* Page renders the page. */}}<p>{{template "card" . "x"}}</p>
+{{define "card" $title}}
+	{{/*
+	Card renders a card.
+	It lists the items.
+
+	@arg $title string The card
+	  title.
+	@arg .Items []string The items.
+	*/}}
+	<h1>{{$title}}</h1>
+{{end}}
+{{define "plain" $a}}{{$a}}{{/* not a doc */}}{{end}}
+{{block "box" .}}{{/* Box renders a box. */}}{{.}}{{end}}`
+
+func TestDocs(t *testing.T) {
+	tmpl := Must(New("page").ParseMode(parse.ParseComments).Parse(docsText))
+	want := []TemplateDoc{
+		{Name: "box", Description: "Box renders a box."},
+		{Name: "card", Description: "Card renders a card.\nIt lists the items.", Args: []ArgDoc{
+			{"$title", "string", "The card title."},
+			{".Items", "[]string", "The items."},
+		}},
+		{Name: "page", Description: "Page renders the page."},
+	}
+	if got := tmpl.Docs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got docs\n%#v\nwant\n%#v", got, want)
+	}
+	doc, ok := tmpl.Lookup("plain").Doc()
+	if ok {
+		t.Errorf("plain: unexpected doc %#v", doc)
+	}
+	if want := []ArgDoc{{Name: "$a"}}; !reflect.DeepEqual(doc.Args, want) {
+		t.Errorf("plain: got args %#v, want %#v", doc.Args, want)
+	}
+}
@@ -0,0 +1,36 @@
+package template
+
+import (
+	"path"
+	"reflect"
+
+	"github.com/moisespsena-go/umbu/text/template/parse"
+)
+
+// SetDynamicTemplates restricts the templates invoked by a dynamic name,
+// as in {{template .Widget.Template .Widget}}, to those whose names match
+// any of the patterns, with the syntax of path.Match. With no patterns, the
+// default, any associated template may be invoked.
+func (this *Executor) SetDynamicTemplates(patterns ...string) *Executor {
+	this.StateOptions.DynamicTemplates = patterns
+	return this
+}
+
+// templateName evaluates the dynamic name of a {{template}} action, failing
+// if the name isn't allowed.
+func (this *State) templateName(dot reflect.Value, n parse.Node) string {
+	name := this.evalArg(dot, reflect.TypeOf(""), n).String()
+	patterns := this.e.StateOptions.DynamicTemplates
+	if len(patterns) == 0 {
+		return name
+	}
+	for _, pattern := range patterns {
+		if ok, err := path.Match(pattern, name); err != nil {
+			this.errorf("bad dynamic template pattern %q: %v", pattern, err)
+		} else if ok {
+			return name
+		}
+	}
+	this.errorf("template %q not allowed as dynamic template", name)
+	return ""
+}
@@ -0,0 +1,61 @@
+package template
+
+import (
+	"fmt"
+	"os"
+	"path"
+)
+
+// EnvPolicy enables the env builtin and restricts the environment variables
+// it reads. See Executor.SetEnv.
+type EnvPolicy struct {
+	// Allow are the names of the variables the templates may read, or their
+	// patterns, as "APP_*", in the syntax of path.Match.
+	Allow []string
+	// Lookup looks up the variables. If nil, os.LookupEnv.
+	Lookup func(name string) (value string, ok bool)
+}
+
+// SetEnv enables the env builtin, restricted by the policy. A nil policy
+// disables it, the default:
+//
+//	server_name {{env "SERVER_NAME" "localhost"}};
+//
+// env returns the value of the allowed variable, or the default value, if
+// given, or an empty string if it isn't set. Reading other variables fails.
+func (this *Executor) SetEnv(policy *EnvPolicy) *Executor {
+	this.StateOptions.Env = policy
+	return this
+}
+
+// Allowed reports whether the policy allows the variable named name.
+func (this *EnvPolicy) Allowed(name string) bool {
+	for _, pattern := range this.Allow {
+		if ok, _ := path.Match(pattern, name); ok || pattern == name {
+			return true
+		}
+	}
+	return false
+}
+
+// env implements the env builtin.
+func (this *State) env(name string, def ...string) (string, error) {
+	policy := this.e.StateOptions.Env
+	if len(def) > 1 {
+		return "", fmt.Errorf("env: want one default value, got %d", len(def))
+	}
+	if !policy.Allowed(name) {
+		return "", fmt.Errorf("env: variable %q isn't allowed", name)
+	}
+	lookup := policy.Lookup
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+	if value, ok := lookup(name); ok {
+		return value, nil
+	}
+	if len(def) > 0 {
+		return def[0], nil
+	}
+	return "", nil
+}
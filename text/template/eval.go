@@ -0,0 +1,169 @@
+package template
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/moisespsena-go/umbu/text/template/parse"
+)
+
+// DefaultEvalFuncs are the functions allowed in the expressions of the eval
+// builtin by an EvalPolicy without Funcs.
+var DefaultEvalFuncs = []string{"and", "or", "not", "eq", "ne", "lt", "le", "gt", "ge", "len", "index", "print", "printf"}
+
+// EvalPolicy enables the eval builtin and restricts the expressions it
+// evaluates. See Executor.SetEval.
+type EvalPolicy struct {
+	// Funcs are the functions the expressions may call. If nil,
+	// DefaultEvalFuncs.
+	Funcs []string
+	// Methods are the methods the expressions may call on the values they
+	// reach, as .Order.Total, by name. If nil, none.
+	Methods []string
+	// Fields are the fields of the structs and the keys of the maps the
+	// expressions may access, by name. If nil, any: the expressions reach
+	// all the exported fields and the keys of the values they are given.
+	Fields []string
+	// MaxLen is the maximum length of an expression, 0 for no limit.
+	MaxLen int
+	// MaxCached is the maximum number of parsed expressions kept, by
+	// source, or DefaultEvalMaxCached if 0.
+	MaxCached int
+
+	mu    sync.Mutex
+	cache map[string]*parse.PipeNode // parsed expressions, by source
+}
+
+// DefaultEvalMaxCached is the maximum number of parsed expressions kept by
+// an EvalPolicy without MaxCached.
+const DefaultEvalMaxCached = 1024
+
+// SetEval enables the eval builtin, restricted by the policy. A nil policy
+// disables it, the default:
+//
+//	{{if eval .Rule.Condition .Order}}...{{end}}
+//
+// eval parses the string as a single pipeline, without declarations, and
+// evaluates it with the dot given as second argument, or the data of the
+// execution. The variable $ is the data of the execution; the other variables
+// and the templates aren't visible to the expression. The expressions calling
+// functions out of the policy fail before being evaluated, the ones calling
+// methods or accessing fields out of the policy when they are reached.
+func (this *Executor) SetEval(policy *EvalPolicy) *Executor {
+	this.StateOptions.Eval = policy
+	return this
+}
+
+// eval implements the eval builtin.
+func (this *State) eval(expr string, dot ...reflect.Value) (reflect.Value, error) {
+	policy := this.e.StateOptions.Eval
+	pipe, err := policy.parse(expr)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	s := *this
+	s.vars = []variable{{"$", this.dataValue}}
+	s.evalPolicy = policy
+	value := this.dataValue
+	if len(dot) > 0 {
+		value = dot[0]
+	}
+	return s.evalPipeline(value, pipe), nil
+}
+
+// parse parses the expression into a pipeline, checking it against the
+// policy.
+func (this *EvalPolicy) parse(expr string) (*parse.PipeNode, error) {
+	this.mu.Lock()
+	pipe, ok := this.cache[expr]
+	this.mu.Unlock()
+	if ok {
+		return pipe, nil
+	}
+	if this.MaxLen > 0 && len(expr) > this.MaxLen {
+		return nil, fmt.Errorf("eval: expression exceeds maximum length of %d bytes", this.MaxLen)
+	}
+	trees, err := parse.Parse("eval", "{{"+expr+"}}", "", "")
+	if err != nil {
+		return nil, fmt.Errorf("eval: %v", err)
+	}
+	root := trees["eval"].Root
+	if len(trees) != 1 || len(root.Nodes) != 1 {
+		return nil, fmt.Errorf("eval: %q isn't a single expression", expr)
+	}
+	action, ok := root.Nodes[0].(*parse.ActionNode)
+	if !ok || len(action.Pipe.Decl) > 0 {
+		return nil, fmt.Errorf("eval: %q isn't an expression", expr)
+	}
+	allowed := this.Funcs
+	if allowed == nil {
+		allowed = DefaultEvalFuncs
+	}
+	parse.Inspect(action.Pipe, func(n parse.Node) bool {
+		switch n := n.(type) {
+		case *parse.IdentifierNode:
+			for _, name := range allowed {
+				if name == n.Ident {
+					return true
+				}
+			}
+			err = fmt.Errorf("eval: function %q not allowed", n.Ident)
+		case *parse.VariableNode:
+			if n.Ident[0] != "$" {
+				err = fmt.Errorf("eval: variable %s not defined", n.Ident[0])
+			}
+		}
+		return err == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	this.store(expr, action.Pipe)
+	return action.Pipe, nil
+}
+
+// store caches the parsed expression, removing any other over MaxCached.
+func (this *EvalPolicy) store(expr string, pipe *parse.PipeNode) {
+	max := this.MaxCached
+	if max <= 0 {
+		max = DefaultEvalMaxCached
+	}
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.cache == nil {
+		this.cache = make(map[string]*parse.PipeNode)
+	}
+	for k := range this.cache {
+		if len(this.cache) < max {
+			break
+		}
+		delete(this.cache, k)
+	}
+	this.cache[expr] = pipe
+}
+
+// checkEvalMethod fails the evaluation of the eval expression calling the
+// method named name out of its policy.
+func (this *State) checkEvalMethod(name string) {
+	for _, allowed := range this.evalPolicy.Methods {
+		if allowed == name {
+			return
+		}
+	}
+	this.errorf("eval: method %q not allowed", name)
+}
+
+// checkEvalField fails the evaluation of the eval expression accessing the
+// field or the map key named name out of its policy.
+func (this *State) checkEvalField(name string) {
+	if this.evalPolicy.Fields == nil {
+		return
+	}
+	for _, allowed := range this.evalPolicy.Fields {
+		if allowed == name {
+			return
+		}
+	}
+	this.errorf("eval: field %q not allowed", name)
+}
@@ -9,11 +9,12 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"log/slog"
 	"reflect"
 	"runtime"
-	"runtime/debug"
 	"sort"
 	"strings"
+	"time"
 	"unicode"
 
 	"github.com/moisespsena-go/umbu/expr"
@@ -22,6 +23,8 @@ import (
 
 	"github.com/moisespsena-go/tracederror"
 	"github.com/moisespsena-go/umbu/funcs"
+	"github.com/moisespsena-go/umbu/locale"
+	"github.com/moisespsena-go/umbu/text/template/internal/nodeplan"
 	"github.com/moisespsena-go/umbu/text/template/parse"
 )
 
@@ -35,6 +38,88 @@ type StateOptions struct {
 	RequireFields bool
 	OnNoField     func(recorde interface{}, fieldName string) (r interface{}, ok bool)
 	Global        []variable
+	// Logger receives the non-fatal execution events. See Executor.SetLogger.
+	Logger *slog.Logger
+	// Audit records function calls and field accesses. See Executor.SetAudit.
+	Audit *Audit
+	// Coverage marks the executed nodes. See Executor.SetCoverage.
+	Coverage *Coverage
+	// DetectCycles fails the template cycles. See Executor.SetDetectCycles.
+	DetectCycles bool
+	// Eval enables the eval builtin. See Executor.SetEval.
+	Eval *EvalPolicy
+	// DynamicTemplates restricts the templates invoked by a dynamic name.
+	// See Executor.SetDynamicTemplates.
+	DynamicTemplates []string
+	// VersionSelector selects the versions of the invoked templates. See
+	// Executor.SetVersionSelector.
+	VersionSelector VersionSelector
+	// Hydration marks the boundaries of the components. See
+	// Executor.SetHydration.
+	Hydration *Hydration
+	// Locale is the locale tag of the execution. See Executor.SetLocale.
+	Locale string
+	// RelativeThresholds choose the units of the relative times. See
+	// Executor.SetRelativeThresholds.
+	RelativeThresholds []locale.Threshold
+	// Location is the default time location of the execution. See
+	// Executor.SetLocation.
+	Location *time.Location
+	// ZeroDivision is the placeholder of the zero denominators. See
+	// Executor.SetZeroDivision.
+	ZeroDivision *string
+	// Assets is the file system of the files read by the builtins. See
+	// Executor.SetAssets.
+	Assets *Assets
+	// AvatarProvider builds the URLs of the avatar builtin. See
+	// Executor.SetAvatarProvider.
+	AvatarProvider *AvatarProvider
+	// PrintMode renders for print. See Executor.SetPrintMode.
+	PrintMode *PrintMode
+	// Env enables the env builtin. See Executor.SetEnv.
+	Env *EnvPolicy
+	// Fetch enables the fetch builtins. See Executor.SetFetch.
+	Fetch *FetchPolicy
+	// Secrets enables the secret builtin. See Executor.SetSecrets.
+	Secrets *Secrets
+	// BufferSize is the initial capacity of the buffers of the captured
+	// outputs. See Executor.SetBufferSize.
+	BufferSize int
+	// ResultCache caches the outputs of ExecuteCached. See
+	// Executor.SetResultCache.
+	ResultCache *ResultCache
+	// Deterministic makes the executions deterministic. See
+	// Executor.SetDeterministic.
+	Deterministic *Deterministic
+	// Clock tells the current time. See Executor.SetClock.
+	Clock Clock
+	// Preview renders the missing fields and the failed calls as
+	// placeholders. See Executor.SetPreview.
+	Preview *Preview
+	// ValidateData validates the data against the declarations of the
+	// templates. See Executor.SetValidateData.
+	ValidateData bool
+	// MaxBufferedSize is the maximum size of the outputs buffered by
+	// BufferedExecute. See Executor.SetMaxBufferedSize.
+	MaxBufferedSize int
+	// Chunking makes the executions yield to their writers periodically.
+	// See Executor.SetChunking.
+	Chunking *Chunking
+	// MaxSteps bounds the nodes executed by an execution. See
+	// Executor.SetMaxSteps.
+	MaxSteps int64
+	// Profile restricts the functions called by the templates and the
+	// output. See Executor.SetProfile.
+	Profile *Profile
+	// CallLimits bounds the calls of the expensive functions. See
+	// Executor.SetCallLimits.
+	CallLimits map[string]int
+	// MaxFieldDepth bounds the traversal of the data by the field chains.
+	// See Executor.SetMaxFieldDepth.
+	MaxFieldDepth int
+	// OperandOutput converts the output of the templates invoked as
+	// operands. See Executor.SetOperandOutput.
+	OperandOutput func(output string) interface{}
 }
 
 // State represents the State of an execution. It's not part of the
@@ -47,13 +132,26 @@ type State struct {
 	node         parse.Node // current node, for errors
 	vars         []variable // push-down stack of variable values.
 	global       []variable
-	depth        int // the height of the stack of executing templates.
+	depth        int           // the height of the stack of executing templates.
+	calls        *templateCall // the chain of executing templates.
 	funcsValue   map[string]*funcs.FuncValue
 	contextValue reflect.Value
 	local        LocalData
 	context      context.Context
+	done         <-chan struct{} // the Done channel of the context.
 	data         interface{}
 	dataValue    reflect.Value
+	islands      map[string]int // the number of invocations of the components.
+	execution    *execution     // the state shared with the executions of other templates.
+
+	// okDecl is the command of the value and the ok declared, as in
+	// {{$v, $ok := lookup .}}, and okCall reports whether the call being
+	// made is the one of okDecl.
+	okDecl *parse.CommandNode
+	okCall bool
+
+	// evalPolicy is the policy of the eval expression evaluated, if any.
+	evalPolicy *EvalPolicy
 }
 
 // variable holds the dynamic value of a variable such as $, $x etc.
@@ -101,10 +199,13 @@ func (this *State) Context() context.Context {
 
 // WithContext set temporary context and rollback it on ret func called.
 func (this *State) WithContext(ctx context.Context) func() {
-	old := this.context
-	this.context = ctx
+	old, oldDone := this.context, this.done
+	this.context, this.done = ctx, nil
+	if ctx != nil {
+		this.done = ctx.Done()
+	}
 	return func() {
-		this.context = old
+		this.context, this.done = old, oldDone
 	}
 }
 
@@ -254,7 +355,7 @@ func (this *State) panic(err error) {
 	}:
 		ewt = &fatal{errors.Wrap(err, info), t.Trace()}
 	default:
-		ewt = &fatal{errors.Wrap(err, info), debug.Stack()}
+		ewt = &fatal{errors.Wrap(err, info), stack()}
 	}
 	panic(ewt)
 }
@@ -308,10 +409,7 @@ func errRecover(errp *error) {
 // A template may be executed safely in parallel, although if parallel
 // executions share a Writer the output may be interleaved.
 func (t *Template) ExecuteTemplate(wr io.Writer, name string, data interface{}) error {
-	var tmpl *Template
-	if t.common != nil {
-		tmpl = t.tmpl[name]
-	}
+	tmpl := t.Lookup(name)
 	if tmpl == nil {
 		return fmt.Errorf("template: no template %q associated with template %q", name, t.name)
 	}
@@ -323,7 +421,16 @@ func (t *Template) Executor(funcMaps ...funcs.FuncMap) *Executor {
 }
 
 func (t *Template) CreateExecutor(funcMaps ...funcs.FuncMap) *Executor {
-	return NewExecutor(t).SetFuncs(builtinFuncs).FuncsValues(t.funcs).Funcs(funcMaps...)
+	if executor := t.executor.Load(); executor != nil && len(funcMaps) == 0 {
+		return executor.Clone()
+	}
+	return t.newExecutor(funcMaps...)
+}
+
+// newExecutor returns a new executor of t, with the functions of t and the
+// funcMaps.
+func (t *Template) newExecutor(funcMaps ...funcs.FuncMap) *Executor {
+	return NewExecutor(t).SetFuncs(builtinFuncs).FuncsValues(globalFuncs.Load(), t.funcs.Load()).Funcs(funcMaps...)
 }
 
 // Execute applies a parsed template to the specified data object,
@@ -340,10 +447,28 @@ func (t *Template) Execute(wr io.Writer, data interface{}) error {
 	return t.Executor().Execute(wr, data)
 }
 
+// ExecuteContext applies the template to the data, as Execute, with the
+// context ctx. See Executor.ExecuteContext.
+func (t *Template) ExecuteContext(ctx context.Context, wr io.Writer, data interface{}) error {
+	return t.Executor().ExecuteContext(ctx, wr, data)
+}
+
 func (t *Template) ExecuteString(data interface{}) (string, error) {
 	return t.CreateExecutor().ExecuteString(data)
 }
 
+// ExecuteBytes applies the template to the data, returning the output. See
+// Executor.ExecuteBytes.
+func (t *Template) ExecuteBytes(data interface{}) ([]byte, error) {
+	return t.CreateExecutor().ExecuteBytes(data)
+}
+
+// AppendExecute applies the template to the data, appending the output to
+// dst. See Executor.AppendExecute.
+func (t *Template) AppendExecute(dst []byte, data interface{}) ([]byte, error) {
+	return t.CreateExecutor().AppendExecute(dst, data)
+}
+
 // DefinedTemplates returns a string listing the defined templates,
 // prefixed by the string "; defined templates are: ". If there are none,
 // it returns the empty string. For generating an error message here
@@ -352,6 +477,8 @@ func (t *Template) DefinedTemplates() string {
 	if t.common == nil {
 		return ""
 	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	var b bytes.Buffer
 	for name, tmpl := range t.tmpl {
 		if tmpl.Tree == nil || tmpl.Root == nil {
@@ -373,6 +500,19 @@ func (t *Template) DefinedTemplates() string {
 // generating output as they go.
 func (this *State) walk(dot reflect.Value, node parse.Node) {
 	this.at(node)
+	if c := this.e.StateOptions.Coverage; c != nil && node.Type() != parse.NodeText {
+		c.hit(this.tmpl, node)
+	}
+	select {
+	case <-this.done:
+		this.errorf("%w", this.context.Err())
+	default:
+	}
+	if max := this.e.StateOptions.MaxSteps; max > 0 {
+		if this.execution.steps++; this.execution.steps > max {
+			this.errorf("more than %d steps executed", max)
+		}
+	}
 	switch node := node.(type) {
 	case *parse.ActionNode:
 		// Do not pop variables so they persist until next end.
@@ -381,6 +521,7 @@ func (this *State) walk(dot reflect.Value, node parse.Node) {
 		if len(node.Pipe.Decl) == 0 {
 			this.printValue(node, val)
 		}
+	case *parse.CommentNode:
 	case *parse.ExprNode:
 		println("***")
 	case *parse.IfNode:
@@ -405,6 +546,10 @@ func (this *State) walk(dot reflect.Value, node parse.Node) {
 		this.walkCallback(parse.NodeCallback, dot, node.Pipe, node.List)
 	case *parse.WrapNode:
 		this.walkWrap(parse.NodeWrap, dot, node)
+	case *parse.CustomNode:
+		this.walkCustom(dot, node)
+	case *parse.ReturnNode:
+		this.walkReturn(dot, node)
 	default:
 		this.errorf("unknown node: %s", node)
 	}
@@ -421,6 +566,9 @@ func (this *State) walkIfOrWith(typ parse.NodeType, dot reflect.Value, pipe *par
 	}
 	if truth {
 		if typ == parse.NodeWith {
+			if pipe.OkDecl {
+				val = reflect.ValueOf(val.Interface().(ResultOk).Val)
+			}
 			this.walk(val, list)
 		} else {
 			this.walk(dot, list)
@@ -442,13 +590,14 @@ func (this *State) walkArg(typ parse.NodeType, dot reflect.Value, pipe *parse.Pi
 		}
 	}
 	oldWr := this.wr
-	var w bytes.Buffer
-	this.wr = &w
+	w := this.buffer()
+	this.wr = w
 	this.walk(dot, list)
 	this.wr = oldWr
 
 	pipec = pipec.Copy().(*parse.CommandNode)
 	pipec.Args = append(pipec.Args, &parse.StringNode{Text: w.String()})
+	putBuffer(w)
 	var value reflect.Value
 	value = this.evalCommand(dot, pipec, value)
 	switch value.Kind() {
@@ -532,6 +681,7 @@ func (this *State) walkWrap(_ parse.NodeType, dot reflect.Value, node *parse.Wra
 	defer this.pop(this.mark())
 	oldWr := this.wr
 	var w = wrapWriter{
+		buf: this.buffer(),
 		begin: func(w io.Writer) {
 			oldW := this.wr
 			defer func() {
@@ -550,6 +700,8 @@ func (this *State) walkWrap(_ parse.NodeType, dot reflect.Value, node *parse.Wra
 	}
 	this.wr = &w
 	this.walk(dot, node.List)
+	putBuffer(w.buf)
+	w.buf = nil
 	if w.noEmpty {
 		if node.AfterList != nil {
 			this.walk(dot, node.AfterList)
@@ -610,25 +762,26 @@ func isTrue(val reflect.Value) (truth, ok bool) {
 	return truth, true
 }
 
-func (this *State) walkTemplate(dot reflect.Value, t *parse.TemplateNode) {
+func (this *State) walkTemplate(dot reflect.Value, t *parse.TemplateNode) (result templateResult) {
 	this.at(t)
-	tmpl := this.tmpl.tmpl[t.Name]
-	if tmpl == nil {
-		this.errorf("template %q not defined", t.Name)
-	}
-	if this.depth == maxExecDepth {
-		this.errorf("exceeded maximum template depth (%v)", maxExecDepth)
+	name := t.Name
+	if t.NameNode != nil {
+		name = this.templateName(dot, t.NameNode)
+		this.at(t)
 	}
+	tmpl := this.lookupTemplate(name)
+	calls := this.enterTemplate(tmpl)
 
 	var args []parse.Node
 	if t.Pipe != nil {
 		if len(t.Pipe.Cmds) == 1 {
-			oldArgs := t.Pipe.Cmds[0].Args
-			args = oldArgs[1:]
-			t.Pipe.Cmds[0].Args = oldArgs[0:1]
+			// The pipeline is evaluated without the arguments, on copies
+			// of the nodes, as the tree may be executed concurrently.
+			pipe, cmd := *t.Pipe, t.Pipe.Cmds[0]
+			args = cmd.Args[1:]
+			pipe.Cmds = []*parse.CommandNode{cmd.WithArgs(cmd.Args[0])}
 			// Variables declared by the pipeline persist.
-			dot = this.evalPipeline(dot, t.Pipe)
-			t.Pipe.Cmds[0].Args = oldArgs
+			dot = this.evalPipeline(dot, &pipe)
 		}
 	}
 	if len(args) < len(tmpl.args) {
@@ -637,17 +790,33 @@ func (this *State) walkTemplate(dot reflect.Value, t *parse.TemplateNode) {
 	newState := *this
 	newState.depth++
 	newState.tmpl = tmpl
-	if len(tmpl.funcs) > 0 {
-		defer this.e.funcs.With(tmpl.funcs)()
+	newState.calls = calls
+	if fv := tmpl.funcs.Load(); len(fv) > 0 {
+		newState.e = this.e.withFuncs(fv)
 	}
 	// No dynamic scoping: template invocations inherit no variables.
-	newState.vars = append(append([]variable{}, newState.vars[:tmpl.Tree.InheritedVarsLen]...), variable{"$", dot})
+	inherited := tmpl.Tree.InheritedVarsLen
+	if inherited > len(newState.vars) {
+		// The template is invoked for the value of a variable declared
+		// before its definition, as in {{$t := template "t"}}{{define "t"}}.
+		inherited = len(newState.vars)
+	}
+	newState.vars = append(append([]variable{}, newState.vars[:inherited]...), variable{"$", dot})
 	for i, arg := range args {
-		cmd := *t.Pipe.Cmds[0]
-		cmd.Args = []parse.Node{arg}
-		newState.vars = append(newState.vars, variable{tmpl.args[i], this.evalCommand(dot, &cmd, reflect.Value{})})
+		cmd := t.Pipe.Cmds[0].WithArgs(arg)
+		newState.vars = append(newState.vars, variable{tmpl.args[i], this.evalCommand(dot, cmd, reflect.Value{})})
 	}
-	newState.walk(dot, tmpl.Root)
+	if this.e.StateOptions.ValidateData {
+		if err := newState.validateData(dot, newState.vars[len(newState.vars)-len(args):]); err != nil {
+			this.errorf("%v", err)
+		}
+	}
+	newState.checkRequired(dot)
+	newState.walkComponent(dot, tmpl, newState.vars[len(newState.vars)-len(args):], func() {
+		defer newState.recoverReturn(&result)
+		newState.walk(dot, tmpl.Root)
+	})
+	return
 }
 
 // Eval functions evaluate pipelines, commands, and their elements and extract
@@ -663,14 +832,25 @@ func (this *State) evalPipeline(dot reflect.Value, pipe *parse.PipeNode) (value
 		return
 	}
 	this.at(pipe)
-	for _, cmd := range pipe.Cmds {
+	okDecl := this.okDecl
+	for i, cmd := range pipe.Cmds {
+		this.okDecl = nil
+		if pipe.OkDecl && i == len(pipe.Cmds)-1 {
+			this.okDecl = cmd
+		}
 		value = this.evalCommand(dot, cmd, value) // previous value is this one's final arg.
 		// If the object has type interface{}, dig down one level to the thing inside.
 		if value.Kind() == reflect.Interface && value.Type().NumMethod() == 0 {
 			value = reflect.ValueOf(value.Interface()) // lovely!
 		}
 	}
-	for _, variable := range pipe.Decl {
+	this.okDecl = okDecl
+	values := []reflect.Value{value}
+	if pipe.OkDecl {
+		values = this.okDeclValues(pipe, value)
+	}
+	for i, variable := range pipe.Decl {
+		value := values[i%len(values)]
 		if variable.Op == '=' {
 			if variable.Update {
 				this.updateVar(variable.Ident[0], value)
@@ -684,6 +864,22 @@ func (this *State) evalPipeline(dot reflect.Value, pipe *parse.PipeNode) (value
 	return value
 }
 
+// okDeclValues returns the value and the ok of the result of a call
+// returning two values, declared by {{if $v, $ok := lookup .Key}}.
+func (this *State) okDeclValues(pipe *parse.PipeNode, value reflect.Value) []reflect.Value {
+	var (
+		r  ResultOk
+		ok bool
+	)
+	if value.IsValid() && value.CanInterface() {
+		r, ok = value.Interface().(ResultOk)
+	}
+	if !ok {
+		this.errorf("can't declare the value and the ok of %s: it doesn't return a value and an ok", pipe.Cmds[len(pipe.Cmds)-1])
+	}
+	return []reflect.Value{reflect.ValueOf(r.Val), reflect.ValueOf(r.Ok)}
+}
+
 func (this *State) notAFunction(args []parse.Node, final reflect.Value) {
 	if len(args) > 1 || final.IsValid() {
 		this.errorf("can't give argument to non-function %s", args[0])
@@ -697,6 +893,9 @@ func (this *State) evalCommand(dot reflect.Value, cmd *parse.CommandNode, final
 		return this.evalFieldNode(dot, n, cmd.Args, final)
 	case *parse.ChainNode:
 		return this.evalChainNode(dot, n, cmd.Args, final)
+	case *parse.TemplateNode:
+		this.notAFunction(cmd.Args, final)
+		return this.evalTemplate(dot, n)
 	case *parse.IdentifierNode:
 		if n.Ident == Globals {
 			return this.dataValue
@@ -811,6 +1010,10 @@ func (this *State) evalExprNode(dot reflect.Value, node *parse.ExprNode, args []
 // dot is the environment in which to evaluate arguments, while
 // receiver is the value being walked along the chain.
 func (this *State) evalFieldChain(dot, receiver reflect.Value, node parse.Node, ident []string, args []parse.Node, final reflect.Value) reflect.Value {
+	if a := this.e.StateOptions.Audit; a != nil {
+		this.auditField(a, node, ident)
+	}
+	this.checkFieldChain(ident)
 	n := len(ident)
 	for i := 0; i < n-1; i++ {
 		receiver = this.evalField(dot, ident[i], node, nil, zero, receiver)
@@ -872,6 +1075,10 @@ func (this *State) getFuncValue(name string) (v *funcs.FuncValue) {
 	if v = this.GetFunc(name); v == nil {
 		this.errorf("%q is not a defined function", name)
 	}
+	if err := this.checkFuncAllowed(name); err != nil {
+		this.errorf("%v", err)
+	}
+	this.countCall(name)
 	return v
 }
 
@@ -879,7 +1086,7 @@ func (this *State) GetFunc(name string) (v *funcs.FuncValue) {
 	if v, ok := this.funcsValue[name]; ok {
 		return v
 	}
-	if v = this.tmpl.funcs.Get(name); v != nil {
+	if v = this.tmpl.funcs.Load().Get(name); v != nil {
 		return v
 	}
 	if v = this.e.FindFunc(name); v != nil {
@@ -951,6 +1158,10 @@ func (this *State) Call(name string, args, result []any) (ok bool) {
 	if f == nil {
 		return
 	}
+	if err := this.checkFuncAllowed(name); err != nil {
+		this.errorf("%v", err)
+	}
+	this.countCall(name)
 	ok = true
 
 	var (
@@ -987,15 +1198,15 @@ func (this *State) Call(name string, args, result []any) (ok bool) {
 	return
 }
 
-func (this *State) getFuncRvalue(name string) reflect.Value {
-	return this.getFuncValue(name).ContextualValue(this.contextValue)
-}
-
 func (this *State) evalFunction(dot reflect.Value, node *parse.IdentifierNode, cmd parse.Node, args []parse.Node, final reflect.Value) reflect.Value {
 	this.at(node)
 	name := node.Ident
-	v := this.getFuncRvalue(name)
-	return this.evalCall(dot, v, cmd, name, args, final)
+	fv := this.getFuncValue(name)
+	if msg := fv.Deprecated(); msg != "" {
+		this.Log(slog.LevelWarn, "deprecated function", "func", name, "reason", msg)
+	}
+	v := fv.ContextualValue(this.contextValue)
+	return this.evalCall(dot, v, cmd, name, args, final, fv.Fast())
 }
 
 // evalField evaluates an expression like (.Field) or (.Field arg1 arg2).
@@ -1003,7 +1214,10 @@ func (this *State) evalFunction(dot reflect.Value, node *parse.IdentifierNode, c
 // value of the pipeline, if any.
 func (this *State) evalField(dot reflect.Value, fieldName string, node parse.Node, args []parse.Node, final, receiver reflect.Value) reflect.Value {
 	if !receiver.IsValid() {
-		if this.tmpl.option.missingKey == mapError { // Treat invalid value as missing map key.
+		if v, ok := this.previewField(fieldName); ok {
+			return v
+		}
+		if this.missingKey() == mapError { // Treat invalid value as missing map key.
 			this.errorf("nil data; no entry for key %q", fieldName)
 		}
 		return zero
@@ -1015,13 +1229,20 @@ func (this *State) evalField(dot reflect.Value, fieldName string, node parse.Nod
 		if val, ok := i.GetAttr(fieldName); ok {
 			val := reflect.ValueOf(val)
 			if val.Kind() == reflect.Func {
-				return this.evalCall(dot, val, node, fieldName, args, final)
+				if this.evalPolicy != nil {
+					this.checkEvalMethod(fieldName)
+				}
+				return this.evalCall(dot, val, node, fieldName, args, final, nil)
+			}
+			if this.evalPolicy != nil {
+				this.checkEvalField(fieldName)
 			}
 			return val
 		}
 		return reflect.Value{}
 	}
 
+	this.checkIndirections(receiver, fieldName)
 	receiver, isNil := indirect(receiver)
 	// Unless it's an interface, need to get to a value of type *T to guarantee
 	// we see all methods of T and *T.
@@ -1030,7 +1251,13 @@ func (this *State) evalField(dot reflect.Value, fieldName string, node parse.Nod
 		ptr = ptr.Addr()
 	}
 	if method := ptr.MethodByName(fieldName); method.IsValid() {
-		return this.evalCall(dot, method, node, fieldName, args, final)
+		if this.evalPolicy != nil {
+			this.checkEvalMethod(fieldName)
+		}
+		return this.evalCall(dot, method, node, fieldName, args, final, nil)
+	}
+	if this.evalPolicy != nil {
+		this.checkEvalField(fieldName)
 	}
 	hasArgs := len(args) > 1 || final.IsValid()
 	// It's not a method; must be a field of a struct or an element of a map.
@@ -1051,10 +1278,8 @@ func (this *State) evalField(dot reflect.Value, fieldName string, node parse.Nod
 			}
 			return field
 		} else if f, ok := node.(*parse.FieldNode); ok {
-			if !this.e.StateOptions.RequireFields && f.NotRequired {
-				return reflect.ValueOf("")
-			} else if result, ok := this.e.StateOptions.OnNoField(receiver.Interface(), fieldName); ok {
-				return reflect.ValueOf(result)
+			if v, ok := this.noField(f, receiver, fieldName); ok {
+				return v
 			}
 		}
 	case reflect.Map:
@@ -1066,19 +1291,27 @@ func (this *State) evalField(dot reflect.Value, fieldName string, node parse.Nod
 		if nameVal.Type().AssignableTo(receiver.Type().Key()) {
 			result := receiver.MapIndex(nameVal)
 			if !result.IsValid() {
-				switch this.tmpl.option.missingKey {
+				switch this.missingKey() {
 				case mapInvalid:
 					// Just use the invalid value.
 					if f, ok := node.(*parse.FieldNode); ok {
-						if !this.e.StateOptions.RequireFields && f.NotRequired {
-							return reflect.ValueOf("")
-						} else if result, ok := this.e.StateOptions.OnNoField(receiver.Interface(), fieldName); ok {
-							return reflect.ValueOf(result)
+						if v, ok := this.noField(f, receiver, fieldName); ok {
+							return v
 						}
 					}
+					if v, ok := this.previewField(fieldName); ok {
+						return v
+					}
+					this.Log(slog.LevelDebug, "missing map key", "key", fieldName)
 				case mapZeroValue:
+					if v, ok := this.previewField(fieldName); ok {
+						return v
+					}
 					result = reflect.Zero(receiver.Type().Elem())
 				case mapError:
+					if v, ok := this.previewField(fieldName); ok {
+						return v
+					}
 					this.errorf("map has no entry for key %q", fieldName)
 				}
 			}
@@ -1090,6 +1323,9 @@ func (this *State) evalField(dot reflect.Value, fieldName string, node parse.Nod
 		typ = ptr.Type()
 	}
 
+	if v, ok := this.previewField(fieldName); ok {
+		return v
+	}
 	var nils string
 	if isNil {
 		nils = "(nil)"
@@ -1098,6 +1334,22 @@ func (this *State) evalField(dot reflect.Value, fieldName string, node parse.Nod
 	panic("not reached")
 }
 
+// noField resolves a field that the receiver doesn't have, either as an
+// optional field or through the OnNoField handler.
+func (this *State) noField(f *parse.FieldNode, receiver reflect.Value, fieldName string) (reflect.Value, bool) {
+	if !this.requireFields() && f.NotRequired {
+		this.Log(slog.LevelDebug, "missing optional field", "field", fieldName, "type", receiver.Type().String())
+		return reflect.ValueOf(""), true
+	}
+	if onNoField := this.e.StateOptions.OnNoField; onNoField != nil {
+		if result, ok := onNoField(receiver.Interface(), fieldName); ok {
+			this.Log(slog.LevelInfo, "field resolved by OnNoField", "field", fieldName, "type", receiver.Type().String())
+			return reflect.ValueOf(result), true
+		}
+	}
+	return zero, false
+}
+
 var (
 	errorType        = reflect.TypeOf((*error)(nil)).Elem()
 	fmtStringerType  = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
@@ -1108,13 +1360,57 @@ var (
 // evalCall executes a function or method call. If it's a method, fun already has the receiver bound, so
 // it looks just like a function call. The arg list, if non-nil, includes (in the manner of the shell), arg[0]
 // as the function itself.
-func (this *State) evalCall(dot, fun reflect.Value, node parse.Node, name string, args []parse.Node, final reflect.Value) reflect.Value {
+func (this *State) evalCall(dot, fun reflect.Value, node parse.Node, name string, args []parse.Node, final reflect.Value, fast funcs.FastFunc) reflect.Value {
 	if args != nil {
 		args = args[1:] // Zeroth arg is function name/node; not passed to function.
 	}
-	typ := fun.Type()
-	numIn := len(args)
-	if final.IsValid() {
+	plan := this.planCall(fun.Type(), node, name, len(args), final.IsValid())
+	// Build the arg list. The final value is the last argument, or the
+	// first one of the filter form.
+	argv := make([]reflect.Value, len(plan.argTypes))
+	for i, k := 0, 0; i < len(argv); i++ {
+		if i == plan.finalAt {
+			argv[i] = this.validateType(final, plan.argTypes[i])
+			continue
+		}
+		argv[i] = this.evalArg(dot, plan.argTypes[i], args[k])
+		k++
+	}
+	if fun.IsNil() || !fun.IsValid() {
+		this.errorf("error calling %q: %s", name, fun.String())
+	}
+	if plan.stateArg {
+		argv = append([]reflect.Value{reflect.ValueOf(this)}, argv...)
+	}
+	this.okCall = this.okDecl != nil && (node == this.okDecl || node == this.okDecl.Args[0])
+	return this.funCallResult(node, name, fun, argv, fast)
+}
+
+// callPlan is the analysis of the calls of a function by a command: the
+// types of the arguments, without the state, and the position of the final
+// value.
+type callPlan struct {
+	typ      reflect.Type
+	name     string
+	numArgs  int
+	final    bool
+	stateArg bool
+	finalAt  int
+	argTypes []reflect.Type
+}
+
+// planCall returns the plan of the call of the function of type typ with
+// numArgs arguments, and the final value if final, checking their number.
+// The plans are cached on the command nodes, for the calls in loops.
+func (this *State) planCall(typ reflect.Type, node parse.Node, name string, numArgs int, final bool) *callPlan {
+	cmd, _ := node.(*parse.CommandNode)
+	if cmd != nil {
+		if p, _ := nodeplan.Plan(cmd).Load().(*callPlan); p != nil && p.typ == typ && p.name == name && p.numArgs == numArgs && p.final == final {
+			return p
+		}
+	}
+	numIn := numArgs
+	if final {
 		numIn++
 	}
 	fNumIn := typ.NumIn()
@@ -1122,72 +1418,61 @@ func (this *State) evalCall(dot, fun reflect.Value, node parse.Node, name string
 	if stateArg {
 		fNumIn--
 	}
-	numFixed := len(args)
+	numFixed := numArgs
 	if typ.IsVariadic() {
 		numFixed = fNumIn - 1 // last arg is the variadic one.
 		if numIn < numFixed {
-			this.errorf("wrong number of args for %s: want at least %d got %d", name, typ.NumIn()-1, len(args))
+			this.errorf("wrong number of args for %s: want at least %d got %d", name, typ.NumIn()-1, numArgs)
 		}
 	} else if numIn != fNumIn {
-		this.errorf("wrong number of args for %s: want %d got %d", name, typ.NumIn(), len(args))
+		this.errorf("wrong number of args for %s: want %d got %d", name, typ.NumIn(), numArgs)
 	}
 	if !funcs.GoodFunc(typ) {
 		// TODO: This could still be a confusing error; maybe goodFunc should provide info.
 		this.errorf("can't call method/function %q with %d results", name, typ.NumOut())
 	}
-	// Build the arg list.
-	argv := make([]reflect.Value, numIn)
-	// Args must be evaluated. Fixed args first.
-	i, j := 0, 0
+	p := &callPlan{typ: typ, name: name, numArgs: numArgs, final: final, stateArg: stateArg, finalAt: -1}
+	j := 0
 	if stateArg {
 		j++
 	}
-
-	for ; i < numFixed && i < len(args); i++ {
-		argv[i] = this.evalArg(dot, typ.In(i+j), args[i])
-	}
-
-	// Now the ... args.
-	if typ.IsVariadic() {
-		argType := typ.In(typ.NumIn() - 1).Elem() // Argument is a slice.
-		for ; i < len(args); i++ {
-			argv[i] = this.evalArg(dot, argType, args[i])
-		}
-	}
-	// Add final value if necessary.
-	if final.IsValid() {
-		t := typ.In(typ.NumIn() - 1 + j)
-		if typ.IsVariadic() {
-			if numIn-1 < numFixed {
-				// The added final argument corresponds to a fixed parameter of the function.
-				// Validate against the type of the actual parameter.
-				t = typ.In(numIn - 1 + j)
-			} else {
-				// The added final argument corresponds to the variadic part.
-				// Validate against the type of the elements of the variadic slice.
-				t = t.Elem()
-			}
+	p.argTypes = make([]reflect.Type, numIn)
+	for i := range p.argTypes {
+		if typ.IsVariadic() && i >= numFixed {
+			p.argTypes[i] = typ.In(typ.NumIn() - 1).Elem() // Argument is a slice.
+		} else {
+			p.argTypes[i] = typ.In(i + j)
 		}
-		argv[i] = this.validateType(final, t)
 	}
-	if fun.IsNil() || !fun.IsValid() {
-		this.errorf("error calling %q: %s", name, fun.String())
+	if final {
+		p.finalAt = numIn - 1
+		if cmd != nil && cmd.Filter {
+			p.finalAt = 0
+		}
 	}
-	if stateArg {
-		argv = append([]reflect.Value{reflect.ValueOf(this)}, argv...)
+	if cmd != nil {
+		nodeplan.Plan(cmd).Store(p)
 	}
-	return this.funCallResult(node, name, fun, argv)
+	return p
 }
 
-func (this *State) funCallResult(node parse.Node, name string, fun reflect.Value, argv []reflect.Value) (v reflect.Value) {
+func (this *State) funCallResult(node parse.Node, name string, fun reflect.Value, argv []reflect.Value, fast funcs.FastFunc) (v reflect.Value) {
 	if name == "" {
 		name = "≪anonymous≫"
 	}
-	result, err := this.funCall(fun, argv)
+	if a := this.e.StateOptions.Audit; a != nil {
+		defer this.auditCall(a, name, argv, time.Now())
+	}
+	okCall := this.okCall
+	result, err := this.funCall(fun, argv, fast)
+	this.okCall = false
 	if err != nil {
 		if IsFatal(err) {
 			panic(err)
 		}
+		if v, ok := this.previewCall(name, err); ok {
+			return v
+		}
 		this.panic(errors.Wrap(err, fmt.Sprintf("calling %q", name)))
 	}
 
@@ -1199,6 +1484,9 @@ func (this *State) funCallResult(node parse.Node, name string, fun reflect.Value
 			// If we have an error that is not nil, stop execution and return that error to the caller.
 			if !result[0].IsNil() {
 				this.at(node)
+				if v, ok := this.previewCall(name, result[0].Interface().(error)); ok {
+					return v
+				}
 				this.errorf("error calling %s: %s", name, result[0].Interface().(error))
 			}
 			return blankValue
@@ -1206,12 +1494,19 @@ func (this *State) funCallResult(node parse.Node, name string, fun reflect.Value
 	case 2:
 		switch result[1].Kind() {
 		case reflect.Bool:
+			if !okCall {
+				this.at(node)
+				this.errorf("%s returns a value and an ok, which must be declared, as in {{$v, $ok := %s}}", name, node)
+			}
 			result[0] = reflect.ValueOf(ResultOk{result[0].Interface(), result[1].Bool()})
 		default:
 			if valType := result[1].Type(); valType.Kind() == reflect.Interface && valType.Name() == "error" {
 				// If we have an error that is not nil, stop execution and return that error to the caller.
 				if !result[1].IsNil() {
 					this.at(node)
+					if v, ok := this.previewCall(name, result[1].Interface().(error)); ok {
+						return v
+					}
 					this.errorf("error calling %s: %s", name, result[1].Interface().(error))
 				}
 			} else {
@@ -1234,13 +1529,18 @@ func (this *State) funCallResult(node parse.Node, name string, fun reflect.Value
 	return v
 }
 
-func (this *State) funCall(fun reflect.Value, argv []reflect.Value) (r []reflect.Value, err tracederror.TracedError) {
+// funCall calls the function, by fast if not nil.
+func (this *State) funCall(fun reflect.Value, argv []reflect.Value, fast funcs.FastFunc) (r []reflect.Value, err tracederror.TracedError) {
 	defer func() {
 		if r := recover(); r != nil {
 			if r == errExit {
 				panic(r)
 			}
 			switch t := r.(type) {
+			case ExecError:
+				// The error of the execution, as of the limits of the
+				// functions called through State.Call, already located.
+				panic(t)
 			case tracederror.TracedError:
 				err = t
 			case error:
@@ -1258,6 +1558,9 @@ func (this *State) funCall(fun reflect.Value, argv []reflect.Value) (r []reflect
 			}
 		}
 	}()
+	if fast != nil {
+		return fast(argv), nil
+	}
 	return fun.Call(argv), nil
 }
 
@@ -1510,7 +1813,7 @@ func indirectInterface(v reflect.Value) reflect.Value {
 func (this *State) printValue(n parse.Node, v reflect.Value) {
 	this.at(n)
 	if v.IsValid() && v.Type().Kind() == reflect.Func {
-		if v = this.funCallResult(n, "", v, nil); v == blankValue {
+		if v = this.funCallResult(n, "", v, nil, nil); v == blankValue {
 			return
 		}
 	}
@@ -1518,8 +1821,7 @@ func (this *State) printValue(n parse.Node, v reflect.Value) {
 	if !ok {
 		this.errorf("can't print %s of type %s", n, v.Type())
 	}
-	_, err := fmt.Fprint(this.wr, iface)
-	if err != nil {
+	if err := fprint(this.wr, iface); err != nil {
 		this.writeError(err)
 	}
 }
@@ -1574,8 +1876,15 @@ func (this *State) trim(value reflect.Value, sep ...reflect.Value) reflect.Value
 
 // trim remove left spaces of value
 func (this *State) join(value reflect.Value, args ...reflect.Value) {
+	sep := ", "
+	value = indirectInterface(value)
+	// The Sprig order: join SEP LIST.
+	if value.Kind() == reflect.String && len(args) == 1 {
+		if list := indirectInterface(args[0]); list.Kind() == reflect.Slice || list.Kind() == reflect.Array {
+			sep, value, args = value.String(), list, nil
+		}
+	}
 	var (
-		sep  = ", "
 		and  string
 		l, i = value.Len(), 1
 	)
@@ -1642,54 +1951,34 @@ func (this *State) exp(op rune, a, b reflect.Value) (value reflect.Value) {
 	return
 }
 
-// templateExec executes the template and return the result value.
-func (this *State) templateExec(name reflect.Value, pipe ...reflect.Value) reflect.Value {
-	var (
-		result bytes.Buffer
-		oldW   = this.wr
-	)
-	this.wr = &result
-	defer func() {
-		this.wr = oldW
-	}()
-
-	this.templateYield(name, pipe...)
-
-	return reflect.ValueOf(result.String())
+// templateExec returns the output of the template, inheriting all the
+// variables.
+//
+// Deprecated: use the render builtin.
+func (this *State) templateExec(name reflect.Value, pipe ...reflect.Value) (string, error) {
+	w := this.buffer()
+	defer putBuffer(w)
+	if err := this.execTemplate(w, name.String(), dataArg(pipe), inheritAll); err != nil {
+		return "", err
+	}
+	return w.String(), nil
 }
 
-// templateYield executes the template and writes result into this writer
-func (this *State) templateYield(name reflect.Value, pipe ...reflect.Value) {
-	this.templateYieldName(name.String(), pipe...)
+// templateYield writes the output of the template, inheriting all the
+// variables.
+//
+// Deprecated: use the yield builtin.
+func (this *State) templateYield(name reflect.Value, pipe ...reflect.Value) error {
+	return this.execTemplate(this.wr, name.String(), dataArg(pipe), inheritAll)
 }
 
-// templateYield executes the template and writes result into this writer
-func (this *State) templateYieldName(name string, pipe ...reflect.Value) {
-	var data reflect.Value
-
+// dataArg returns the data of the deprecated builtins invoking a template,
+// given only if the pipe is a single value.
+func dataArg(pipe []reflect.Value) (data reflect.Value) {
 	if len(pipe) == 1 {
 		data = pipe[0]
 	}
-
-	tmpl := this.tmpl.tmpl[name]
-	if tmpl == nil {
-		this.errorf("template %q not defined", name)
-	}
-	if this.depth == maxExecDepth {
-		this.errorf("exceeded maximum template depth (%v)", maxExecDepth)
-	}
-
-	executor := tmpl.CreateExecutor()
-	executor.noCaptureError = true
-	executor.parent = this.e
-	executor.StateOptions.Global = append(this.global, this.vars...)
-	err := executor.Execute(this.wr, data)
-	if err != nil {
-		this.panic(ExecError{
-			Name: this.tmpl.name + "/" + name,
-			Err:  err,
-		})
-	}
+	return
 }
 
 // Exec executes the template and return the result value.
@@ -1707,25 +1996,15 @@ func (this *State) Exec(name string, pipe ...interface{}) string {
 		}
 	}
 
-	tmpl := this.tmpl.tmpl[name]
-	if tmpl == nil {
-		this.errorf("template %q not defined", name)
-	}
-	if this.depth == maxExecDepth {
-		this.errorf("exceeded maximum template depth (%v)", maxExecDepth)
-	}
-
-	executor := tmpl.CreateExecutor()
-	executor.noCaptureError = true
-	executor.parent = this.e
-	result, err := executor.ExecuteString(data)
-	if err != nil {
+	result := this.buffer()
+	defer putBuffer(result)
+	if err := this.execTemplate(result, name, data, inheritNone); err != nil {
 		this.panic(ExecError{
 			Name: this.tmpl.name + "/" + name,
 			Err:  err,
 		})
 	}
-	return result
+	return result.String()
 }
 
 // printableValue returns the, possibly indirected, interface value inside v that
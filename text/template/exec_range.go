@@ -54,6 +54,7 @@ func (this *State) walkRangeDefault(onElem func(elem reflect.Value), mark int, v
 		onElem(elem)
 		this.walk(elem, r.List)
 		this.pop(mark)
+		this.rangeElemDone()
 	}
 	switch val.Kind() {
 	case reflect.Array, reflect.Slice:
@@ -93,6 +94,13 @@ func (this *State) walkRangeDefault(onElem func(elem reflect.Value), mark int, v
 		for i, max := int64(0), val.Int(); i < max; i++ {
 			oneIteration(reflect.ValueOf(i))
 		}
+	case reflect.Struct:
+		if it := iteratorOf(val); it != nil {
+			return rangeIterator(it, func(i int, key, elem reflect.Value, isLast bool) {
+				oneIteration(elem)
+			})
+		}
+		this.errorf("range can't iterate over %v: %s doesn't implements Iterator", val, val.Type())
 	case reflect.Invalid:
 		break // An invalid value is likely a nil map, etc. and acts like an empty map.
 	default:
@@ -110,6 +118,7 @@ func (this *State) walkRangeWithArgElemAndIndex(dot reflect.Value, mark int, val
 		this.setVar(2, index)
 		this.walk(dot, r.List)
 		this.pop(mark)
+		this.rangeElemDone()
 	}
 	switch val.Kind() {
 	case reflect.Array, reflect.Slice:
@@ -143,35 +152,13 @@ func (this *State) walkRangeWithArgElemAndIndex(dot reflect.Value, mark int, val
 		}
 		return
 	case reflect.Struct:
-		valPtr := val
-		if valPtr.CanAddr() {
-			valPtr = val.Addr()
-		}
-
-		var it umbu.Iterator
-
-		switch t := valPtr.Interface().(type) {
-		case umbu.Iterator:
-			it = t
-		case umbu.IteratorGetter:
-			it = t.Iterator()
-		}
-
+		it := iteratorOf(val)
 		if it == nil {
 			this.errorf("range can't iterate over %v: %s doesn't implements Iterator", val, val.Type())
 		}
-
-		var (
-			state = it.Start()
-			item  interface{}
-		)
-		var i int
-		for !it.Done(state) {
-			item, state = it.Next(state)
-			oneIteration(reflect.ValueOf(i), reflect.ValueOf(item))
-			i++
-		}
-		return i == 0
+		return rangeIterator(it, func(i int, key, elem reflect.Value, isLast bool) {
+			oneIteration(key, elem)
+		})
 	case reflect.Invalid:
 		break // An invalid value is likely a nil map, etc. and acts like an empty map.
 	default:
@@ -190,6 +177,7 @@ func (this *State) walkRangeWithArgElemAndIndexAndLast(dot reflect.Value, mark i
 		this.setVar(3, isLast)
 		this.walk(dot, r.List)
 		this.pop(mark)
+		this.rangeElemDone()
 	}
 	switch val.Kind() {
 	case reflect.Array, reflect.Slice:
@@ -236,6 +224,14 @@ func (this *State) walkRangeWithArgElemAndIndexAndLast(dot reflect.Value, mark i
 		}
 		oneIteration(reflect.ValueOf(i), elem, reflect.ValueOf(true))
 		return
+	case reflect.Struct:
+		it := iteratorOf(val)
+		if it == nil {
+			this.errorf("range can't iterate over %v: %s doesn't implements Iterator", val, val.Type())
+		}
+		return rangeIterator(it, func(i int, key, elem reflect.Value, isLast bool) {
+			oneIteration(key, elem, reflect.ValueOf(isLast))
+		})
 	case reflect.Invalid:
 		break // An invalid value is likely a nil map, etc. and acts like an empty map.
 	default:
@@ -254,6 +250,7 @@ func (this *State) walkRangeWithState(dot reflect.Value, mark int, val reflect.V
 		this.setVar(1, stateValue)
 		this.walk(dot, r.List)
 		this.pop(mark)
+		this.rangeElemDone()
 	}
 	switch val.Kind() {
 	case reflect.Array, reflect.Slice:
@@ -315,6 +312,21 @@ func (this *State) walkRangeWithState(dot reflect.Value, mark int, val reflect.V
 		state.Key = state.Index
 		oneIteration(elem)
 		return
+	case reflect.Struct:
+		it := iteratorOf(val)
+		if it == nil {
+			this.errorf("range can't iterate over %v: %s doesn't implements Iterator", val, val.Type())
+		}
+		_, isMap := it.(umbu.KeyValueIterator)
+		return rangeIterator(it, func(i int, key, elem reflect.Value, isLast bool) {
+			state.IsLast = isLast
+			state.IsFirst = i == 0
+			state.Index = i
+			if state.Key = uint64(i); isMap {
+				state.Key = key.Interface()
+			}
+			oneIteration(elem)
+		})
 	case reflect.Invalid:
 		break // An invalid value is likely a nil map, etc. and acts like an empty map.
 	default:
@@ -323,6 +335,54 @@ func (this *State) walkRangeWithState(dot reflect.Value, mark int, val reflect.V
 	return true
 }
 
+// iteratorOf returns the iterator of val, an umbu.Iterator or an
+// umbu.IteratorGetter, or nil.
+func iteratorOf(val reflect.Value) umbu.Iterator {
+	if val.CanAddr() {
+		val = val.Addr()
+	}
+	if !val.CanInterface() {
+		return nil
+	}
+	switch t := val.Interface().(type) {
+	case umbu.Iterator:
+		return t
+	case umbu.IteratorGetter:
+		return t.Iterator()
+	}
+	return nil
+}
+
+// rangeIterator calls f with the items of the iterator, reading an item
+// ahead to tell the last one, and reports whether it has no items. The key of
+// the item is its index or, for an umbu.KeyValueIterator, the key of its
+// pair, whose value is the element.
+func rangeIterator(it umbu.Iterator, f func(i int, key, elem reflect.Value, isLast bool)) (empty bool) {
+	kv, _ := it.(umbu.KeyValueIterator)
+	call := func(i int, item interface{}, isLast bool) {
+		if kv == nil {
+			f(i, reflect.ValueOf(i), reflect.ValueOf(item), isLast)
+			return
+		}
+		key, value := kv.Pair(item)
+		f(i, reflect.ValueOf(key), reflect.ValueOf(value), isLast)
+	}
+	state := it.Start()
+	if it.Done(state) {
+		return true
+	}
+	item, state := it.Next(state)
+	for i := 0; ; i++ {
+		if it.Done(state) {
+			call(i, item, true)
+			return false
+		}
+		next, nextState := it.Next(state)
+		call(i, item, false)
+		item, state = next, nextState
+	}
+}
+
 type RangeElemState struct {
 	Value   interface{}
 	Index   int
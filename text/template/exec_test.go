@@ -6,14 +6,33 @@ package template
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"html/template"
+	"image"
+	imgcolor "image/color"
+	"image/png"
+	"io"
 	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/moisespsena-go/umbu/funcs"
+	"github.com/moisespsena-go/umbu/locale"
+	"github.com/moisespsena-go/umbu/text/template/parse"
 )
 
 var debug = flag.Bool("debug", false, "show the errors produced by the tests")
@@ -1284,10 +1303,36 @@ func TestMaxExecDepth(t *testing.T) {
 	if err != nil {
 		got = err.Error()
 	}
-	const want = "exceeded maximum template depth"
+	const want = "exceeded maximum template depth (100000) in cycle tmpl → tmpl"
+	if !strings.Contains(got, want) {
+		t.Errorf("got error %q; want %q", got, want)
+	}
+}
+
+func TestDetectCycles(t *testing.T) {
+	tmpl := Must(New("a").Parse(`{{template "b" .}}{{define "b"}}{{template "c" .}}{{end}}{{define "c"}}{{template "b" .}}{{end}}`))
+	err := tmpl.CreateExecutor().SetDetectCycles(true).Execute(ioutil.Discard, nil)
+	got := "<nil>"
+	if err != nil {
+		got = err.Error()
+	}
+	const want = "template cycle: b → c → b"
 	if !strings.Contains(got, want) {
 		t.Errorf("got error %q; want %q", got, want)
 	}
+	// Recursion bounded by the data isn't a cycle without detection.
+	tree := Must(New("tree").Parse(`{{.Name}}{{range .Children}}({{template "tree" .}}){{end}}`))
+	type node struct {
+		Name     string
+		Children []node
+	}
+	var buf bytes.Buffer
+	if err := tree.Execute(&buf, node{"a", []node{{"b", []node{{"c", nil}}}}}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "a(b(c))" {
+		t.Errorf("got %q", buf.String())
+	}
 }
 
 func TestAddrOfIndex(t *testing.T) {
@@ -1385,3 +1430,2215 @@ func TestInterfaceValues(t *testing.T) {
 		}
 	}
 }
+
+func TestExecuteParseComments(t *testing.T) {
+	tmpl, err := New("comments").ParseMode(parse.ParseComments).Parse(`a{{/* one */}}b {{- /* two */}}{{template "x"}}{{define "x"}}{{/* three */}}c{{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "abc" {
+		t.Errorf("got %q, want %q", got, "abc")
+	}
+}
+
+func TestExecutePragmas(t *testing.T) {
+	for _, test := range []struct {
+		name, text string
+		data       interface{}
+		out, err   string
+	}{
+		{"missingkey", `{{/* umbu:option missingkey=error */}}{{.A}}`, map[string]int{}, "", `map has no entry for key "A"`},
+		{"missingkey zero", `{{/* umbu:option missingkey=zero */}}{{.A}}`, map[string]int{}, "0", ""},
+		{"strictfields", `{{/* umbu:option strictfields=true */}}{{.A?}}`, struct{}{}, "", "can't evaluate field A"},
+		{"optional fields", `{{.A?}}`, struct{}{}, "", ""},
+		{"require", `{{/* umbu:require .A.B */}}{{.A.B}}`, map[string]interface{}{"A": map[string]int{"B": 1}}, "1", ""},
+		{"require missing", `{{/* umbu:require .A.B */}}x`, map[string]interface{}{"A": map[string]int{}}, "", "missing required field .A.B"},
+		{"require nil", `{{/* umbu:require .A */}}x`, map[string]interface{}{"A": nil}, "", "missing required .A"},
+		{"require arg", `{{template "x" . 1}}{{define "x" $n}}{{/* umbu:require $n */}}{{$n}}{{end}}`, nil, "1", ""},
+		{"require undefined", `{{template "x"}}{{define "x"}}{{/* umbu:require $n */}}{{end}}`, nil, "", "missing required variable $n"},
+	} {
+		tmpl, err := New(test.name).Parse(test.text)
+		if err != nil {
+			t.Errorf("%s: parse: %v", test.name, err)
+			continue
+		}
+		var buf bytes.Buffer
+		err = tmpl.Execute(&buf, test.data)
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+		case err == nil && buf.String() != test.out:
+			t.Errorf("%s: got %q, want %q", test.name, buf.String(), test.out)
+		}
+	}
+}
+
+func TestDefineParams(t *testing.T) {
+	const card = `{{define "card" (title string, n int, items []string, u User)}}{{$title}}:{{$n}}:{{len $items}}{{end}}`
+	for _, test := range []struct {
+		name, text, out, err string
+	}{
+		{"ok", `{{template "card" . "t" 1 .Items .}}`, "t:1:2", ""},
+		{"fields", `{{template "card" . .Title .N .Items nil}}`, "x:2:2", ""},
+		{"arity", `{{template "card" . "t"}}`, "", `template "card" called with 1 arguments, want 4 (title string, n int, items []string, u User)`},
+		{"string", `{{template "card" . 1 1 nil 1}}`, "", `template "card" called with 1 as title string`},
+		{"int", `{{template "card" . "t" 1.5 nil 1}}`, "", `template "card" called with 1.5 as n int`},
+		{"slice", `{{template "card" . "t" 1 "a" 1}}`, "", `template "card" called with "a" as items []string`},
+		{"defined first", `{{define "b"}}{{template "card" . "t"}}{{end}}`, "", "called with 1 arguments"},
+	} {
+		tmpl, err := New(test.name).Parse(card + test.text)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		var buf bytes.Buffer
+		data := map[string]interface{}{"Title": "x", "N": 2, "Items": []string{"a", "b"}}
+		if err := tmpl.Execute(&buf, data); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if buf.String() != test.out {
+			t.Errorf("%s: got %q, want %q", test.name, buf.String(), test.out)
+		}
+	}
+	// The calls parsed before the definition are checked too.
+	tmpl := Must(New("root").Parse(`{{template "card" . "t"}}`))
+	if _, err := tmpl.New("card").Parse(card); err == nil || !strings.Contains(err.Error(), "called with 1 arguments") {
+		t.Errorf("got error %v", err)
+	}
+	// The invalid trees aren't added.
+	if tmpl.Lookup("card") != nil {
+		t.Errorf("the invalid card was added")
+	}
+	trees, err := parse.Parse("card", card, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := trees["card"].Copy()
+	if len(tree.Params()) != 4 {
+		t.Errorf("got params %v of the copy", tree.Params())
+	}
+	if _, err := tmpl.AddParseTree("card", tree); err == nil || tmpl.Lookup("card") != nil {
+		t.Errorf("got error %v, card added: %v", err, tmpl.Lookup("card") != nil)
+	}
+}
+
+func TestTextHooks(t *testing.T) {
+	tmpl := Must(New("page").TextHooks(parse.TemplateShorthand()).Parse(`@header body {{.}}{{define "header"}}<h1>{{.}}</h1>{{end}}`))
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, "x"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "<h1>x</h1> body x"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestEval(t *testing.T) {
+	data := map[string]interface{}{"Total": 150, "Country": "BR", "Rule": "gt .Total 100", "T": tVal}
+	for _, test := range []struct {
+		name, text string
+		policy     *EvalPolicy
+		out, err   string
+	}{
+		{"rule", `{{if eval .Rule}}big{{end}}`, &EvalPolicy{}, "big", ""},
+		{"dot", `{{eval "eq . \"BR\"" .Country}}`, &EvalPolicy{}, "true", ""},
+		{"root", `{{with .Country}}{{eval "len $.Country"}}{{end}}`, &EvalPolicy{}, "2", ""},
+		{"disabled", `{{eval .Rule}}`, nil, "", `"eval" is not a defined function`},
+		{"not allowed", `{{eval "printf \"%d\" .Total"}}`, &EvalPolicy{Funcs: []string{"gt"}}, "", `function "printf" not allowed`},
+		{"variables", `{{$x := 1}}{{eval "$x"}}`, &EvalPolicy{}, "", "variable $x not defined"},
+		{"declaration", `{{eval "$x := 1"}}`, &EvalPolicy{}, "", "isn't an expression"},
+		{"actions", `{{eval "1}}{{2"}}`, &EvalPolicy{}, "", "isn't a single expression"},
+		{"max len", `{{eval .Rule}}`, &EvalPolicy{MaxLen: 5}, "", "exceeds maximum length of 5 bytes"},
+		{"method", `{{eval ".T.GetU.TrueFalse true"}}`, &EvalPolicy{Methods: []string{"GetU", "TrueFalse"}}, "true", ""},
+		{"method not allowed", `{{eval ".T.GetU.TrueFalse true"}}`, &EvalPolicy{Methods: []string{"GetU"}}, "", `method "TrueFalse" not allowed`},
+		{"chain method not allowed", `{{eval "(.T).Copy.X"}}`, &EvalPolicy{}, "", `method "Copy" not allowed`},
+		{"field", `{{eval "gt .Total 100"}}`, &EvalPolicy{Fields: []string{"Total"}}, "true", ""},
+		{"field not allowed", `{{eval ".T.X"}}`, &EvalPolicy{Fields: []string{"T"}}, "", `field "X" not allowed`},
+		{"key not allowed", `{{eval ".Country"}}`, &EvalPolicy{Fields: []string{}}, "", `field "Country" not allowed`},
+	} {
+		tmpl, err := New(test.name).Parse(test.text)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		var buf bytes.Buffer
+		err = tmpl.CreateExecutor().SetEval(test.policy).Execute(&buf, data)
+		switch {
+		case test.err != "":
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+			}
+		case err != nil:
+			t.Errorf("%s: %v", test.name, err)
+		case buf.String() != test.out:
+			t.Errorf("%s: got %q, want %q", test.name, buf.String(), test.out)
+		}
+	}
+	// The parsed expressions kept are bounded.
+	policy := &EvalPolicy{MaxCached: 2}
+	e := Must(New("cache").Parse(`{{range .}}{{eval .}}{{end}}`)).CreateExecutor().SetEval(policy)
+	if out, err := e.ExecuteString([]string{"1", "2", "3", "1"}); err != nil || out != "1231" {
+		t.Errorf("got %q, %v", out, err)
+	}
+	if n := len(policy.cache); n != 2 {
+		t.Errorf("got %d parsed expressions, want 2", n)
+	}
+}
+
+func TestDynamicTemplateName(t *testing.T) {
+	tmpl := Must(New("page").Parse(`{{range .}}{{template .Kind .}}{{end}}` +
+		`{{define "widget/a"}}[a {{.Value}}]{{end}}{{define "widget/b"}}[b {{.Value}}]{{end}}{{define "secret"}}!{{end}}`))
+	type widget struct{ Kind, Value string }
+	var buf bytes.Buffer
+	data := []widget{{"widget/a", "1"}, {"widget/b", "2"}}
+	if err := tmpl.CreateExecutor().SetDynamicTemplates("widget/*").Execute(&buf, data); err != nil {
+		t.Fatal(err)
+	}
+	if want := "[a 1][b 2]"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+	for _, test := range []struct {
+		patterns []string
+		kind     string
+		err      string
+	}{
+		{[]string{"widget/*"}, "secret", `template "secret" not allowed as dynamic template`},
+		{nil, "missing", `template "missing" not defined`},
+	} {
+		err := tmpl.CreateExecutor().SetDynamicTemplates(test.patterns...).Execute(&buf, []widget{{test.kind, ""}})
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got error %v, want %q", test.kind, err, test.err)
+		}
+	}
+}
+
+// recordFilter is an output filter transforming the output by f when
+// closed, and recording the close in closed.
+type recordFilter struct {
+	w      io.Writer
+	buf    bytes.Buffer
+	f      func(string) string
+	closed *[]string
+	name   string
+}
+
+func (r *recordFilter) Write(p []byte) (int, error) { return r.buf.Write(p) }
+
+func (r *recordFilter) Close() error {
+	*r.closed = append(*r.closed, r.name)
+	_, err := io.WriteString(r.w, r.f(r.buf.String()))
+	return err
+}
+
+func TestOutputFilters(t *testing.T) {
+	var closed []string
+	filter := func(name string, f func(string) string) OutputFilter {
+		return func(w io.Writer) io.WriteCloser {
+			return &recordFilter{w: w, f: f, closed: &closed, name: name}
+		}
+	}
+	upper := filter("upper", strings.ToUpper)
+	quote := filter("quote", strconv.Quote)
+
+	tmpl := Must(New("x").Parse(`a{{.}}{{template "y"}}{{define "y"}}c{{end}}`))
+	out, err := tmpl.CreateExecutor().AddOutputFilter(upper).AddOutputFilter(quote).ExecuteString("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `"ABC"`; out != want {
+		t.Errorf("got %s, want %s", out, want)
+	}
+	if want := "upper quote"; strings.Join(closed, " ") != want {
+		t.Errorf("closed %q, want %q", closed, want)
+	}
+
+	// The filters are closed and flushed when the execution fails.
+	closed = nil
+	var buf bytes.Buffer
+	err = Must(New("x").Parse(`ok{{.X}}`)).CreateExecutor().
+		SetOutputFilter(quote).AddOutputFilter(upper).Execute(&buf, 1)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if want := `"OK"`; buf.String() != want || len(closed) != 2 {
+		t.Errorf("got %s, closed %q; want %s", buf.String(), closed, want)
+	}
+}
+
+func TestHydration(t *testing.T) {
+	tmpl := Must(New("page").Parse(`{{template "card" .A}}{{template "badge" 1}}{{template "card" .B}}` +
+		`{{template "pair" .A $.B}}` +
+		`{{define "card"}}<b>{{.}}</b>{{end}}{{define "badge"}}{{.}}{{end}}{{define "pair" $other}}{{.}}{{$other}}{{end}}`))
+	out, err := tmpl.CreateExecutor().SetHydration(&Hydration{Components: []string{"card", "pair"}}).
+		ExecuteString(map[string]string{"A": "x", "B": "--><script>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<!--umbu:island card-1 "x"--><b>x</b><!--/umbu:island card-1-->1` +
+		`<!--umbu:island card-2 "-\u002d\u003e\u003cscript\u003e"--><b>--><script></b><!--/umbu:island card-2-->` +
+		`<!--umbu:island pair-1 {".":"x","other":"-\u002d\u003e\u003cscript\u003e"}-->x--><script><!--/umbu:island pair-1-->`
+	if out != want {
+		t.Errorf("got %s\nwant %s", out, want)
+	}
+}
+
+func TestLocaleFormatting(t *testing.T) {
+	locale.Register(&locale.Locale{
+		Tag:      "xx-test",
+		Months:   [12]string{"jan-x", "feb-x", "mar-x"},
+		Days:     [7]string{"sun-x", "mon-x"},
+		Decimal:  ",",
+		Group:    ".",
+		FirstDay: time.Monday,
+	})
+	tmpl := Must(New("x").Parse(`{{timef .T "EEEE d MMMM"}} {{numberf .N 2}} {{numberf 1234567}} {{first_weekday}}`))
+	data := map[string]interface{}{"T": time.Date(2024, 2, 5, 0, 0, 0, 0, time.UTC), "N": 1234.5}
+	for _, test := range []struct {
+		executor *Executor
+		want     string
+	}{
+		{tmpl.CreateExecutor(), "Monday 5 February 1,234.50 1,234,567 Sunday"},
+		{tmpl.CreateExecutor().SetLocale("xx-test"), "mon-x 5 feb-x 1.234,50 1.234.567 Monday"},
+	} {
+		out, err := test.executor.ExecuteString(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != test.want {
+			t.Errorf("got %q, want %q", out, test.want)
+		}
+	}
+	executor := tmpl.CreateExecutor()
+	executor.Context = locale.NewContext(context.Background(), "xx-test")
+	if out, err := executor.ExecuteString(data); err != nil || !strings.HasPrefix(out, "mon-x") {
+		t.Errorf("got %q, %v; want the locale of the context", out, err)
+	}
+}
+
+func TestTimezone(t *testing.T) {
+	saoPaulo := time.FixedZone("BRT", -3*3600)
+	tokyo := time.FixedZone("JST", 9*3600)
+	tmpl := Must(New("x").Parse(`{{timef .T "HH:mm"}} {{(in_tz .T).Hour}} {{(in_tz .T "UTC").Hour}}`))
+	data := map[string]interface{}{"T": time.Date(2024, 2, 5, 12, 0, 0, 0, time.UTC)}
+
+	executor := tmpl.CreateExecutor()
+	for _, test := range []struct {
+		executor *Executor
+		ctx      context.Context
+		want     string
+	}{
+		{executor, context.Background(), "12:00 12 12"},
+		{tmpl.CreateExecutor().SetLocation(saoPaulo), context.Background(), "09:00 9 12"},
+		{tmpl.CreateExecutor().SetLocation(saoPaulo), ContextWithLocation(context.Background(), tokyo), "21:00 21 12"},
+	} {
+		test.executor.Context = test.ctx
+		out, err := test.executor.ExecuteString(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != test.want {
+			t.Errorf("got %q, want %q", out, test.want)
+		}
+	}
+	if _, err := Must(New("x").Parse(`{{in_tz .T "No/Where"}}`)).CreateExecutor().ExecuteString(data); err == nil {
+		t.Error("expected error for unknown location; got none")
+	}
+}
+
+func TestRelativeTimeBuiltin(t *testing.T) {
+	base := time.Date(2024, 2, 5, 12, 0, 0, 0, time.UTC)
+	data := map[string]interface{}{"T": base.Add(-3 * time.Hour), "Base": base}
+	tmpl := Must(New("x").Parse(`{{reltime .T .Base}}`))
+	for _, test := range []struct {
+		executor *Executor
+		want     string
+	}{
+		{tmpl.CreateExecutor(), "3 hours ago"},
+		{tmpl.CreateExecutor().SetRelativeThresholds([]locale.Threshold{{Below: time.Hour, Unit: locale.Minute}, {Below: 365 * 24 * time.Hour, Unit: locale.Day}}),
+			"1 day ago"},
+	} {
+		out, err := test.executor.ExecuteString(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != test.want {
+			t.Errorf("got %q, want %q", out, test.want)
+		}
+	}
+}
+
+func TestCalendarBuiltins(t *testing.T) {
+	// Wednesday, 2024-01-03.
+	data := map[string]interface{}{"T": time.Date(2024, 1, 3, 15, 4, 5, 0, time.UTC)}
+	for _, test := range []struct {
+		src, want string
+	}{
+		{`{{(start_of_day .T).Format "2006-01-02 15:04"}}`, "2024-01-03 00:00"},
+		{`{{(start_of_week .T).Format "Mon 2006-01-02"}}`, "Sun 2023-12-31"},
+		{`{{(start_of_month .T).Format "2006-01-02"}}`, "2024-01-01"},
+		{`{{(end_of_month .T).Format "2006-01-02 15:04:05"}}`, "2024-01-31 23:59:59"},
+		{`{{range date_range .T (add_business_days .T 3)}}{{.Day}} {{end}}`, "3 4 5 6 7 8 "},
+		{`{{range date_range .T (end_of_month .T) 7}}{{.Day}} {{end}}`, "3 10 17 24 31 "},
+		{`{{(add_business_days .T 3).Format "Mon 02"}} {{(add_business_days .T -3).Format "Mon 02"}}`, "Mon 08 Fri 29"},
+		{`{{business_days .T (add_business_days .T 7)}} {{business_days (add_business_days .T 7) .T}}`, "7 -7"},
+		{`{{iso_week .T}} {{iso_week (start_of_week .T)}}`, "1 52"},
+	} {
+		out, err := Must(New("x").Parse(test.src)).CreateExecutor().ExecuteString(data)
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+		} else if out != test.want {
+			t.Errorf("%s: got %q, want %q", test.src, out, test.want)
+		}
+	}
+}
+
+func TestConversionBuiltins(t *testing.T) {
+	for _, test := range []struct {
+		src, want, err string
+	}{
+		{`{{int .I}} {{uint .U16}} {{int "ff" 16}}`, "17 16 255", ""},
+		{`{{to_i 3.9}} {{to_u "12"}} {{to_f "2.5"}} {{to_s 255 16}} {{to_s .FloatZero 2}}`, "3 12 2.5 ff 0.00", ""},
+		{`{{to_u -1}}`, "", "cast: can't convert int -1 to uint64: value out of range"},
+		{`{{to_i "x"}}`, "", "cast: can't convert string x to int64: invalid syntax"},
+	} {
+		out, err := Must(New("x").Parse(test.src)).CreateExecutor().ExecuteString(tVal)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want %q", test.src, err, test.err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+		} else if out != test.want {
+			t.Errorf("%s: got %q, want %q", test.src, out, test.want)
+		}
+	}
+}
+
+func TestNumberfRounding(t *testing.T) {
+	for _, test := range []struct {
+		src, want string
+	}{
+		{`{{numberf 1.005 2}} {{numberf 2.675 2}} {{numberf 1234.5}}`, "1.01 2.68 1,234.5"},
+		{`{{numberf 2.5 0 "half_even"}} {{numberf 3.5 0 "half_even"}} {{numberf 2.51 0 "half_even"}}`, "2 4 3"},
+		{`{{numberf -2.5 0 "half_up"}} {{numberf -2.5 0 "half_down"}} {{numberf -2.4 0 "up"}}`, "-3 -2 -3"},
+		{`{{numberf 2.9 0 "down"}} {{numberf 2.1 0 "ceil"}} {{numberf -2.1 0 "ceil"}} {{numberf -2.1 0 "floor"}}`, "2 3 -2 -3"},
+		{`{{numberf -0.004 2}} {{numberf 999.995 2}} {{numberf 7 2}}`, "0.00 1,000.00 7.00"},
+		{`{{numberf "12345.675" 2 "half_even"}} {{numberf ".5" 0}} {{numberf "1e3" 1}}`, "12,345.68 1 1,000.0"},
+	} {
+		out, err := Must(New("x").Parse(test.src)).CreateExecutor().ExecuteString(nil)
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+		} else if out != test.want {
+			t.Errorf("%s: got %q, want %q", test.src, out, test.want)
+		}
+	}
+	for _, src := range []string{`{{numberf 1.5 0 "sideways"}}`, `{{numberf "abc"}}`, `{{numberf 1 -1}}`} {
+		if _, err := Must(New("x").Parse(src)).CreateExecutor().ExecuteString(nil); err == nil {
+			t.Errorf("%s: expected error; got none", src)
+		}
+	}
+}
+
+func TestPercentRatio(t *testing.T) {
+	tmpl := Must(New("x").Parse(`{{percent 1 8 1}} {{percent 2 3}} {{ratio 1 3}} {{ratio 3 2 1}} {{percent 1 0}} {{ratio 1 0.0}} {{percent 29 200}}`))
+	for _, test := range []struct {
+		executor *Executor
+		want     string
+	}{
+		{tmpl.CreateExecutor(), "12.5% 67% 0.33 1.5 — — 15%"},
+		{tmpl.CreateExecutor().SetZeroDivision("n/a"), "12.5% 67% 0.33 1.5 n/a n/a 15%"},
+	} {
+		out, err := test.executor.ExecuteString(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != test.want {
+			t.Errorf("got %q, want %q", out, test.want)
+		}
+	}
+	if _, err := Must(New("x").Parse(`{{percent "x" 1}}`)).CreateExecutor().ExecuteString(nil); err == nil {
+		t.Error("expected error for a non number; got none")
+	}
+}
+
+func TestImageBuiltins(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 30))
+	for y := 0; y < 30; y++ {
+		for x := 0; x < 40; x++ {
+			if x < 30 {
+				img.Set(x, y, imgcolor.NRGBA{200, 10, 10, 255})
+			} else {
+				img.Set(x, y, imgcolor.NRGBA{0, 0, 255, 255})
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{"img/a.png": {Data: buf.Bytes()}, "img/b.txt": {Data: []byte("x")}}
+	assets := NewAssets(fsys)
+
+	tmpl := Must(New("x").Parse(`{{with image_size "/img/a.png"}}{{.Format}} {{.Width}}x{{.Height}}{{end}} {{image_color "img/a.png"}}`))
+	out, err := tmpl.CreateExecutor().SetAssets(assets).ExecuteString(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "png 40x30 #c80a0a"; out != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+	if info, _ := assets.Image("img/a.png"); info.Width != 40 {
+		t.Errorf("got %+v", info)
+	}
+
+	for _, src := range []string{`{{image_size "img/b.txt"}}`, `{{image_size "img/c.png"}}`, `{{image_size "../a.png"}}`} {
+		if _, err := Must(New("x").Parse(src)).CreateExecutor().SetAssets(assets).ExecuteString(nil); err == nil {
+			t.Errorf("%s: expected error; got none", src)
+		}
+	}
+	if _, err := Must(New("x").Parse(`{{image_size "img/a.png"}}`)).CreateExecutor().ExecuteString(nil); err == nil {
+		t.Error("expected error without assets; got none")
+	}
+}
+
+func TestCollectionBuiltins(t *testing.T) {
+	data := map[string]interface{}{
+		"Items":  []int{1, 2, 3, 4, 5},
+		"Labels": []string{"a", "b", "c"},
+		"Values": [2]float64{1.5, 2.5},
+	}
+	for _, test := range []struct {
+		src, want string
+	}{
+		{`{{chunk .Items 2}}`, "[[1 2] [3 4] [5]]"},
+		{`{{chunk .Items 5}} {{chunk .Items 9}} {{len (chunk (slice .Items 0 0) 2)}}`, "[[1 2 3 4 5]] [[1 2 3 4 5]] 0"},
+		{`{{batch .Items 3 0}}`, "[[1 2 3] [4 5 0]]"},
+		{`{{batch .Labels 2 "-"}} {{batch .Labels 3 "-"}}`, "[[a b] [c -]] [[a b c]]"},
+		{`{{range zip .Labels .Values}}{{index . 0}}={{index . 1}} {{end}}`, "a=1.5 b=2.5 "},
+		{`{{zip .Labels .Items .Values}}`, "[[a 1 1.5] [b 2 2.5]]"},
+		{`{{transpose (chunk .Items 2)}}`, "[[1 3 5] [2 4]]"},
+		{`{{transpose (array .Labels .Items)}}`, "[[a 1] [b 2] [c 3] [4] [5]]"},
+	} {
+		out, err := Must(New("x").Parse(test.src)).CreateExecutor().ExecuteString(data)
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+		} else if out != test.want {
+			t.Errorf("%s: got %q, want %q", test.src, out, test.want)
+		}
+	}
+	for _, src := range []string{`{{chunk .Items 0}}`, `{{chunk 1 2}}`, `{{batch .Items 2 "x"}}`, `{{zip .Items}}`, `{{transpose .Items}}`} {
+		if _, err := Must(New("x").Parse(src)).CreateExecutor().ExecuteString(data); err == nil {
+			t.Errorf("%s: expected error; got none", src)
+		}
+	}
+}
+
+func TestProjectionBuiltins(t *testing.T) {
+	type user struct {
+		Name, Email string
+		Age         int
+		password    string
+	}
+	data := map[string]interface{}{
+		"Users": []*user{{Name: "Ann", Age: 30}, {Name: "Bob", Age: 25}},
+		"Map":   map[string]int{"b": 2, "a": 1, "c": 3},
+		"IntMap": map[int]string{
+			10: "x", 2: "y",
+		},
+		"User": user{"Ann", "ann@example.com", 30, "secret"},
+	}
+	for _, test := range []struct {
+		src, want string
+	}{
+		{`{{pluck "Name" .Users}} {{pluck "Age" .Users}}`, "[Ann Bob] [30 25]"},
+		{`{{pluck "a" .Map (dict "b" 1) (dict "a" 9)}}`, "[1 9]"},
+		{`{{keys .Map}} {{keys .IntMap}} {{values .Map}} {{values .IntMap}}`, "[a b c] [2 10] [1 2 3] [y x]"},
+		{`{{keys .Map (dict "z" 1)}}`, "[a b c z]"},
+		{`{{has_key .Map "a"}} {{has_key .Map "z"}} {{has_key .IntMap 2}}`, "true false true"},
+		{`{{pick .Map "a" "c" "z"}} {{omit .Map "a"}}`, "map[a:1 c:3] map[b:2 c:3]"},
+		{`{{pick .User "Name" "Email"}} {{omit .User "Email" "Age"}}`, "map[Email:ann@example.com Name:Ann] map[Name:Ann]"},
+	} {
+		out, err := Must(New("x").Parse(test.src)).CreateExecutor().ExecuteString(data)
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+		} else if out != test.want {
+			t.Errorf("%s: got %q, want %q", test.src, out, test.want)
+		}
+	}
+	for _, src := range []string{`{{pluck "password" .Users}}`, `{{keys .Users}}`, `{{has_key .Map 1}}`, `{{pick 1 "a"}}`} {
+		if _, err := Must(New("x").Parse(src)).CreateExecutor().ExecuteString(data); err == nil {
+			t.Errorf("%s: expected error; got none", src)
+		}
+	}
+}
+
+func TestSprig(t *testing.T) {
+	src := `{{.Name | trunc 3 | quote}} {{join ", " .List}} {{join .List "; "}} {{default "x" .Empty}} {{contains "el" "hello"}} ` +
+		`{{hasKey .Map "a"}} {{keys .Map}} {{pluck "a" .Map}} {{chunk 2 .List}} ` +
+		`{{$d := dict "a" 1}}{{set $d "b" 2 | toJson}} {{get $d "b"}} {{set "k" "v"}}{{get "k"}}`
+	data := map[string]interface{}{"Name": "Sprig", "List": []string{"a", "b", "c"}, "Empty": "", "Map": map[string]int{"b": 2, "a": 1}}
+	out, err := Must(New("x").Parse(src)).CreateExecutor().FuncsValues(funcs.Sprig()).ExecuteString(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `"Spr" a, b, c a; b; c x true true [a b] [1] [[a b] [c]] {"a":1,"b":2} 2 v`; out != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+}
+
+func TestSeqBuiltins(t *testing.T) {
+	for _, test := range []struct {
+		src, want string
+	}{
+		{`{{range seq 3}}{{.}} {{end}}`, "1 2 3 "},
+		{`{{range $i, $n := seq 2 10 4}}{{$i}}:{{$n}} {{end}}`, "0:2 1:6 2:10 "},
+		{`{{range $last, $i, $n := seq 3 1}}{{$n}}{{if not $last}},{{end}}{{end}}`, "3,2,1"},
+		{`{{range &$s := until 3}}{{$s.Value}}{{if $s.IsLast}}.{{end}}{{end}}`, "012."},
+		{`{{range until -2}}{{.}} {{end}}`, "0 -1 "},
+		{`{{range until 0}}x{{else}}empty{{end}}`, "empty"},
+		{`{{seq 1 7 3}} {{until 2}} {{seq 1 0 1}}`, "[1 4 7] [0 1] []"},
+	} {
+		out, err := Must(New("x").Parse(test.src)).CreateExecutor().ExecuteString(nil)
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+		} else if out != test.want {
+			t.Errorf("%s: got %q, want %q", test.src, out, test.want)
+		}
+	}
+	for _, src := range []string{`{{seq}}`, `{{seq 1 2 0}}`, `{{seq "x"}}`} {
+		if _, err := Must(New("x").Parse(src)).CreateExecutor().ExecuteString(nil); err == nil {
+			t.Errorf("%s: expected error; got none", src)
+		}
+	}
+}
+
+func TestLazyBuiltins(t *testing.T) {
+	type item struct {
+		Name   string
+		Active bool
+	}
+	data := map[string]interface{}{
+		"Items": []item{{"a", false}, {"b", true}, {"c", true}},
+		"Array": [3]int{1, 2, 3},
+	}
+	for _, test := range []struct {
+		src, want string
+	}{
+		{`{{range seq 1 1000000000 | take 3}}{{.}} {{end}}`, "1 2 3 "},
+		{`{{range seq 1000000000 | skip 2 | take 2}}{{.}} {{end}}`, "3 4 "},
+		{`{{range until 2 | skip 5}}x{{else}}empty{{end}}`, "empty"},
+		{`{{range .Items | skip 1 | take 5}}{{.Name}}{{end}}`, "bc"},
+		{`{{take 2 .Array}} {{skip 2 .Array}} {{take 0 .Array}}`, "[1 2] [3] []"},
+		{`{{first (seq 5 1000000000)}} {{last (until 4)}} {{(first .Items).Name}} {{last .Array}}`, "5 3 a 3"},
+		{`{{first (until 0)}} {{last (take 0 .Items)}}`, "<no value> <no value>"},
+		{`{{any .Items "Active"}} {{all .Items "Active"}} {{all (skip 1 .Items) "Active"}}`, "true false true"},
+		{`{{any (seq 1000000000)}} {{all (until 1000000000)}} {{any (until 1)}} {{all (until 0)}}`, "true false false true"},
+	} {
+		out, err := Must(New("x").Parse(test.src)).CreateExecutor().ExecuteString(data)
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+		} else if out != test.want {
+			t.Errorf("%s: got %q, want %q", test.src, out, test.want)
+		}
+	}
+	for _, src := range []string{`{{take -1 .Items}}`, `{{first 1}}`, `{{any .Items "Missing"}}`, `{{all .Items "A" "B"}}`} {
+		if _, err := Must(New("x").Parse(src)).CreateExecutor().ExecuteString(data); err == nil {
+			t.Errorf("%s: expected error; got none", src)
+		}
+	}
+}
+
+func TestOrderedMap(t *testing.T) {
+	for _, test := range []struct {
+		src, want string
+	}{
+		{`{{$m := ordered_map "z" 1 "a" 2 "m" 3}}{{range $k, $v := $m}}{{$k}}={{$v}} {{end}}`, "z=1 a=2 m=3 "},
+		{`{{$m := ordered_map "z" 1 "a" 2}}{{$m.Set "b" 3}}{{$m.Set "z" 4}}{{$m.Delete "a"}}{{$m}} {{$m.Len}} {{$m.Get "b"}} {{$m.Has "a"}}`, "map[z:4 b:3] 2 3 false"},
+		{`{{range ordered_map "b" 1 "a" 2}}{{.}}{{end}}`, "12"},
+		{`{{range $last, $k, $v := ordered_map "b" 1 "a" 2}}{{$k}}{{if not $last}},{{end}}{{end}}`, "b,a"},
+		{`{{range &$s := ordered_map "b" 1 "a" 2}}{{$s.Index}}{{$s.Key}}{{$s.Value}}{{end}}`, "0b11a2"},
+		{`{{range ordered_map}}x{{else}}empty{{end}}`, "empty"},
+	} {
+		out, err := Must(New("x").Parse(test.src)).CreateExecutor().ExecuteString(nil)
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+		} else if out != test.want {
+			t.Errorf("%s: got %q, want %q", test.src, out, test.want)
+		}
+	}
+	if _, err := Must(New("x").Parse(`{{ordered_map "a"}}`)).CreateExecutor().ExecuteString(nil); err == nil {
+		t.Error("expected error; got none")
+	}
+	m, _ := NewOrderedMap("b", 1, "a", []int{2})
+	if b, err := json.Marshal(m); err != nil || string(b) != `{"b":1,"a":[2]}` {
+		t.Errorf("json: got %s, %v", b, err)
+	}
+}
+
+func TestSetBuiltins(t *testing.T) {
+	data := map[string]interface{}{
+		"Perms": []string{"read", "write", "read"},
+		"Tags":  []interface{}{"go", 1, "go"},
+		"Lists": []interface{}{[]int{1}},
+	}
+	for _, test := range []struct {
+		src, want string
+	}{
+		{`{{set_new .Perms "admin" "write"}}`, "[read write admin]"},
+		{`{{$s := set_new}}{{set_add $s "b" "a" "b"}}{{set_add $s .Perms}}{{$s}} {{$s.Len}}`, "[b a read write] 4"},
+		{`{{set_has .Perms "read"}} {{set_has .Perms "read" "admin"}} {{set_has (set_new .Tags) 1}} {{set_has .Missing "x"}}`, "true false true false"},
+		{`{{set_union .Perms (set_new "exec" "read")}}`, "[read write exec]"},
+		{`{{set_intersect .Perms (set_new "write" "exec") (set_new "write")}}`, "[write]"},
+		{`{{set_difference .Perms (set_new "write")}} {{set_difference .Perms .Perms}}`, "[read] []"},
+		{`{{range $i, $p := set_new .Perms}}{{$i}}{{$p}} {{end}}`, "0read 1write "},
+	} {
+		out, err := Must(New("x").Parse(test.src)).CreateExecutor().ExecuteString(data)
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+		} else if out != test.want {
+			t.Errorf("%s: got %q, want %q", test.src, out, test.want)
+		}
+	}
+	for _, src := range []string{`{{set_new .Lists}}`, `{{set_union .Perms}}`} {
+		if _, err := Must(New("x").Parse(src)).CreateExecutor().ExecuteString(data); err == nil {
+			t.Errorf("%s: expected error; got none", src)
+		}
+	}
+	s := NewSet("a", "b", "c")
+	s.Remove("b")
+	if b, err := json.Marshal(s); err != nil || string(b) != `["a","c"]` || !s.Has("c") || s.Has("b") {
+		t.Errorf("json: got %s, %v", b, err)
+	}
+}
+
+func TestSortBy(t *testing.T) {
+	type user struct {
+		Name  string
+		Age   int
+		Admin bool
+		Boss  *user
+	}
+	boss := &user{Name: "Zed"}
+	data := map[string]interface{}{
+		"Users": []user{
+			{"bob", 30, false, nil},
+			{"Alice", 25, true, boss},
+			{"carol", 30, true, nil},
+			{"Dave", 25, false, boss},
+		},
+		"Files":   []string{"file10", "File2", "file1", "file02"},
+		"Numbers": []interface{}{"10", 9, "8.5"},
+		"Ints":    []int{3, 1, 2},
+		"Maps":    []map[string]interface{}{{"n": 2}, {"n": 1}, {}},
+	}
+	for _, test := range []struct {
+		src, want string
+	}{
+		{`{{range sort_by .Users "Name"}}{{.Name}} {{end}}`, "Alice Dave bob carol "},
+		{`{{range sort_by .Users "Name nocase"}}{{.Name}} {{end}}`, "Alice bob carol Dave "},
+		{`{{range sort_by .Users "Age desc" "Name"}}{{.Name}} {{end}}`, "bob carol Alice Dave "},
+		{`{{range sort_by .Users "Admin desc"}}{{.Name}} {{end}}`, "Alice carol bob Dave "},
+		{`{{range sort_by .Users "Boss.Name desc"}}{{.Name}} {{end}}`, "Alice Dave bob carol "},
+		{`{{sort_by .Files ". natural"}} {{sort_by .Files ". natural nocase"}}`, "[File2 file1 file02 file10] [file1 File2 file02 file10]"},
+		{`{{sort_by .Numbers ". numeric"}} {{sort_by .Ints}} {{sort_by .Ints ". desc"}}`, "[8.5 9 10] [1 2 3] [3 2 1]"},
+		{`{{range sort_by .Maps "n"}}{{.n}},{{end}}`, "<no value>,1,2,"},
+	} {
+		out, err := Must(New("x").Parse(test.src)).CreateExecutor().ExecuteString(data)
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+		} else if out != test.want {
+			t.Errorf("%s: got %q, want %q", test.src, out, test.want)
+		}
+	}
+	for _, src := range []string{`{{sort_by .Users "Name up"}}`, `{{sort_by .Users ""}}`, `{{sort_by .Numbers}}`, `{{sort_by .Users "Missing"}}`} {
+		if _, err := Must(New("x").Parse(src)).CreateExecutor().ExecuteString(data); err == nil {
+			t.Errorf("%s: expected error; got none", src)
+		}
+	}
+}
+
+func TestGroupBy(t *testing.T) {
+	type order struct {
+		Day   string
+		Total float64
+		Tags  []string
+	}
+	data := map[string]interface{}{
+		"Orders": []order{
+			{"tue", 10, nil},
+			{"mon", 5, nil},
+			{"tue", 1, nil},
+			{"wed", 20, nil},
+			{"mon", 7, nil},
+			{"mon", 1, nil},
+		},
+		"Words": []string{"b", "a", "b"},
+	}
+	for _, test := range []struct {
+		src, want string
+	}{
+		{`{{range group_by .Orders "Day"}}{{.Key}}:{{range .Items}} {{.Total}}{{end}};{{end}}`, "tue: 10 1;mon: 5 7 1;wed: 20;"},
+		{`{{range group_by .Orders "Day" "key"}}{{.Key}}{{end}} {{range group_by .Orders "Day" "key desc"}}{{.Key}}{{end}}`, "montuewed wedtuemon"},
+		{`{{range group_by .Orders "Day" "count desc"}}{{.Key}}{{.Len}}{{end}}`, "mon3tue2wed1"},
+		{`{{range group_by .Orders "Day" "sum Total desc"}}{{.Key}}{{end}} {{range group_by .Orders "Day" "max Total"}}{{.Key}}{{end}}`, "wedmontue montuewed"},
+		{`{{range group_by .Orders "Day" "avg Total"}}{{.Key}}{{end}} {{range group_by .Orders "Day" "min Total desc"}}{{.Key}}{{end}}`, "montuewed wedtuemon"},
+		{`{{range group_by .Words "."}}{{.Key}}{{len .Items}}{{end}}`, "b2a1"},
+	} {
+		out, err := Must(New("x").Parse(test.src)).CreateExecutor().ExecuteString(data)
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+		} else if out != test.want {
+			t.Errorf("%s: got %q, want %q", test.src, out, test.want)
+		}
+	}
+	for _, src := range []string{`{{group_by .Orders "Day desc"}}`, `{{group_by .Orders "Tags"}}`, `{{group_by .Orders "Day" "sum"}}`, `{{group_by .Orders "Day" "median Total"}}`, `{{group_by .Orders "Day" "sum Day"}}`} {
+		if _, err := Must(New("x").Parse(src)).CreateExecutor().ExecuteString(data); err == nil {
+			t.Errorf("%s: expected error; got none", src)
+		}
+	}
+}
+
+func TestAggregateBuiltins(t *testing.T) {
+	type product struct {
+		Name   string
+		Price  float64
+		Stock  int
+		Status string
+	}
+	data := map[string]interface{}{
+		"Products": []product{
+			{"pen", 1.5, 10, "active"},
+			{"book", 12, 3, "draft"},
+			{"mug", 7.25, 0, "active"},
+		},
+		"Ints":   []int{3, 1, 2},
+		"Nums":   []interface{}{1, nil, "2.5"},
+		"Empty":  []product{},
+		"Double": func(p product) int { return p.Stock * 2 },
+	}
+	for _, test := range []struct {
+		src, want string
+	}{
+		{`{{sum .Products "Stock"}} {{sum .Products "Price"}} {{sum .Ints}} {{sum .Nums}} {{sum .Empty "Stock"}}`, "13 20.75 6 3.5 0"},
+		{`{{avg .Products "Stock"}} {{avg .Ints "."}} {{avg .Nums}} {{avg .Empty "Price"}}`, "4.333333333333333 2 1.75 <no value>"},
+		{`{{(min_by .Products "Price").Name}} {{(max_by .Products "Price").Name}} {{(max_by .Products "Name").Name}} {{min_by .Ints}} {{min_by .Empty "Price"}}`, "pen book pen 1 <no value>"},
+		{`{{range $k, $n := count_by .Products "Status"}}{{$k}}={{$n}} {{end}}`, "active=2 draft=1 "},
+		{`{{sum .Products .Double}} {{(max_by .Products .Double).Name}}`, "26 pen"},
+	} {
+		out, err := Must(New("x").Parse(test.src)).CreateExecutor().ExecuteString(data)
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+		} else if out != test.want {
+			t.Errorf("%s: got %q, want %q", test.src, out, test.want)
+		}
+	}
+	for _, src := range []string{`{{sum .Products "Name"}}`, `{{sum .Products "Stock desc"}}`, `{{sum .Products 1}}`, `{{min_by .Products "Missing"}}`} {
+		if _, err := Must(New("x").Parse(src)).CreateExecutor().ExecuteString(data); err == nil {
+			t.Errorf("%s: expected error; got none", src)
+		}
+	}
+}
+
+func TestStatsBuiltins(t *testing.T) {
+	type request struct {
+		Path    string
+		Latency float64
+	}
+	data := map[string]interface{}{
+		"Floats": []float64{4, 1, 3, 2},
+		"Ints":   []int{2, 4, 4, 4, 5, 5, 7, 9},
+		"Requests": []request{
+			{"/a", 30},
+			{"/b", 10},
+			{"/c", 20},
+		},
+		"Empty": []int{},
+	}
+	for _, test := range []struct {
+		src, want string
+	}{
+		{`{{median .Floats}} {{median .Ints}} {{median .Requests "Latency"}} {{median .Empty}}`, "2.5 4.5 20 <no value>"},
+		{`{{percentile .Floats 0}} {{percentile .Floats 100}} {{percentile .Floats 50}} {{percentile .Ints 25}}`, "1 4 2.5 4"},
+		{`{{percentile .Requests 90 "Latency"}}`, "28"},
+		{`{{variance .Ints}} {{stddev .Ints}} {{stddev .Empty}}`, "4 2 <no value>"},
+	} {
+		out, err := Must(New("x").Parse(test.src)).CreateExecutor().ExecuteString(data)
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+		} else if out != test.want {
+			t.Errorf("%s: got %q, want %q", test.src, out, test.want)
+		}
+	}
+	for _, src := range []string{`{{percentile .Ints 101}}`, `{{median .Requests "Path"}}`} {
+		if _, err := Must(New("x").Parse(src)).CreateExecutor().ExecuteString(data); err == nil {
+			t.Errorf("%s: expected error; got none", src)
+		}
+	}
+}
+
+func TestGrid(t *testing.T) {
+	data := map[string]interface{}{"Items": []int{1, 2, 3, 4, 5, 6, 7}}
+	for _, test := range []struct {
+		src, want string
+	}{
+		{`{{range grid .Items 2 2}}{{.Number}}/{{.Total}}@{{.Offset}}:{{range .Rows}}{{.}}{{end}}{{if .BreakAfter}}|{{end}}{{end}}`, "1/2@0:[1 2][3 4]|2/2@4:[5 6][7]"},
+		{`{{range grid .Items 1 3 0}}{{.Rows}}{{.Len}}{{if .IsFirst}}f{{end}}{{if .IsLast}}l{{end}}{{if .BreakBefore}}b{{end}} {{end}}`, "[[1 2 3]]3f [[4 5 6]]3b [[7 0 0]]3lb "},
+		{`{{range grid .Items 5 5}}{{.Rows}}{{end}}`, "[[1 2 3 4 5] [6 7]]"},
+		{`{{range grid (slice .Items 0 0) 2 2}}x{{else}}empty{{end}}`, "empty"},
+	} {
+		out, err := Must(New("x").Parse(test.src)).CreateExecutor().ExecuteString(data)
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+		} else if out != test.want {
+			t.Errorf("%s: got %q, want %q", test.src, out, test.want)
+		}
+	}
+	for _, src := range []string{`{{grid .Items 0 2}}`, `{{grid .Items 2 -1}}`, `{{grid .Items 2 2 0 0}}`} {
+		if _, err := Must(New("x").Parse(src)).CreateExecutor().ExecuteString(data); err == nil {
+			t.Errorf("%s: expected error; got none", src)
+		}
+	}
+}
+
+func TestEnv(t *testing.T) {
+	vars := map[string]string{"APP_NAME": "shop", "APP_PORT": "8080", "SECRET": "x"}
+	lookup := func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+	for _, test := range []struct {
+		name, text string
+		policy     *EnvPolicy
+		out, err   string
+	}{
+		{"allowed", `{{env "APP_NAME"}}:{{env "APP_PORT"}}`, &EnvPolicy{Allow: []string{"APP_NAME", "APP_PORT"}, Lookup: lookup}, "shop:8080", ""},
+		{"pattern", `{{env "APP_NAME"}}`, &EnvPolicy{Allow: []string{"APP_*"}, Lookup: lookup}, "shop", ""},
+		{"default", `{{env "APP_HOST" "localhost"}}[{{env "APP_USER"}}]`, &EnvPolicy{Allow: []string{"APP_*"}, Lookup: lookup}, "localhost[]", ""},
+		{"disabled", `{{env "APP_NAME"}}`, nil, "", `"env" is not a defined function`},
+		{"not allowed", `{{env "SECRET"}}`, &EnvPolicy{Allow: []string{"APP_*"}, Lookup: lookup}, "", `variable "SECRET" isn't allowed`},
+	} {
+		tmpl, err := New(test.name).Parse(test.text)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		var buf bytes.Buffer
+		err = tmpl.CreateExecutor().SetEnv(test.policy).Execute(&buf, nil)
+		switch {
+		case test.err != "":
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+			}
+		case err != nil:
+			t.Errorf("%s: %v", test.name, err)
+		case buf.String() != test.out:
+			t.Errorf("%s: got %q, want %q", test.name, buf.String(), test.out)
+		}
+	}
+}
+
+func TestFileBuiltins(t *testing.T) {
+	fsys := fstest.MapFS{
+		"conf/gzip.conf":  {Data: []byte("gzip on; {{.}}")},
+		"sites/site.conf": {Data: []byte(`server { server_name [[.Name]]; [[template "port" .]] }[[define "port"]]listen [[.Port]];[[end]]`)},
+		"sites/loop.conf": {Data: []byte(`[[render_file "sites/loop.conf"]]`)},
+		"sites/a.conf":    {Data: []byte(`[[render_file "sites/b.conf"]]`)},
+		"sites/b.conf":    {Data: []byte(`[[render_file "/sites/a.conf"]]`)},
+	}
+	type site struct {
+		Name string
+		Port int
+	}
+	data := []site{{"a.com", 80}, {"b.com", 443}}
+	for _, test := range []struct {
+		src, want string
+	}{
+		{`[[include_file "/conf/gzip.conf"]]`, "gzip on; {{.}}"},
+		{`[[range .]][[render_file "sites/site.conf" .]]
+[[end]]`, "server { server_name a.com; listen 80; }\nserver { server_name b.com; listen 443; }\n"},
+	} {
+		tmpl := Must(New("x").Delims("[[", "]]").Parse(test.src))
+		out, err := tmpl.CreateExecutor().SetAssets(NewAssets(fsys)).ExecuteString(data)
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+		} else if out != test.want {
+			t.Errorf("%s: got %q, want %q", test.src, out, test.want)
+		}
+	}
+	for _, src := range []string{`[[include_file "../etc/passwd"]]`, `[[include_file "/conf/../../x"]]`, `[[include_file "conf/none"]]`, `[[render_file "sites/loop.conf"]]`, `[[render_file "sites/a.conf"]]`} {
+		if _, err := Must(New("x").Delims("[[", "]]").Parse(src)).CreateExecutor().SetAssets(NewAssets(fsys)).ExecuteString(data); err == nil {
+			t.Errorf("%s: expected error; got none", src)
+		}
+	}
+	if _, err := Must(New("x").Parse(`{{include_file "conf/gzip.conf"}}`)).CreateExecutor().ExecuteString(nil); err == nil || !strings.Contains(err.Error(), "no assets") {
+		t.Errorf("got error %v, want no assets", err)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		switch r.URL.Path {
+		case "/banner":
+			fmt.Fprint(w, "<b>maintenance</b>")
+		case "/status.json":
+			fmt.Fprint(w, `{"message": "ok", "count": 2}`)
+		case "/big":
+			fmt.Fprint(w, strings.Repeat("x", 100))
+		case "/away":
+			http.Redirect(w, r, "http://example.com/", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	policy := &FetchPolicy{Hosts: []string{"127.0.0.1"}, MaxSize: 50, TTL: time.Minute}
+	for _, test := range []struct {
+		name, text string
+		policy     *FetchPolicy
+		out, err   string
+	}{
+		{"body", `{{fetch .}}{{fetch .}}`, policy, "<b>maintenance</b><b>maintenance</b>", ""},
+		{"json", `{{with fetch_json (print . "/status.json")}}{{.message}} {{.count}}{{end}}`, policy, "ok 2", ""},
+		{"disabled", `{{fetch .}}`, nil, "", `"fetch" is not a defined function`},
+		{"host", `{{fetch "http://example.com/"}}`, policy, "", `URL "http://example.com/" isn't allowed`},
+		{"scheme", `{{fetch "file:///etc/passwd"}}`, policy, "", "isn't allowed"},
+		{"status", `{{fetch (print . "/none")}}`, policy, "", "404 Not Found"},
+		{"size", `{{fetch (print . "/big")}}`, policy, "", "exceeds maximum size of 50 bytes"},
+		{"redirect", `{{fetch (print . "/away")}}`, policy, "", `redirection to "http://example.com/" isn't allowed`},
+	} {
+		tmpl, err := New(test.name).Parse(strings.ReplaceAll(test.text, "(print . ", `(print "`+srv.URL+`" `))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		var buf bytes.Buffer
+		err = tmpl.CreateExecutor().SetFetch(test.policy).Execute(&buf, srv.URL+"/banner")
+		switch {
+		case test.err != "":
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+			}
+		case err != nil:
+			t.Errorf("%s: %v", test.name, err)
+		case buf.String() != test.out:
+			t.Errorf("%s: got %q, want %q", test.name, buf.String(), test.out)
+		}
+	}
+	if n := atomic.LoadInt32(&hits); n != 5 {
+		t.Errorf("got %d requests, want 5", n)
+	}
+
+	bounded := &FetchPolicy{Hosts: []string{"127.0.0.1"}, TTL: time.Minute, MaxEntries: 2}
+	tmpl := Must(New("bounded").Parse(`{{range .}}{{fetch .}}{{end}}`))
+	urls := []string{srv.URL + "/banner?a", srv.URL + "/banner?b", srv.URL + "/banner?c"}
+	if err := tmpl.CreateExecutor().SetFetch(bounded).Execute(io.Discard, urls); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(bounded.cache); n != 2 {
+		t.Errorf("got %d cached responses, want 2", n)
+	}
+}
+
+func TestSecrets(t *testing.T) {
+	secrets := NewSecrets(SecretsFunc(func(ctx context.Context, key string) (string, error) {
+		switch key {
+		case "db/password":
+			return "s3cr3t", nil
+		case "db/user":
+			return "admin", nil
+		}
+		return "", errors.New("not found")
+	}))
+	tmpl := Must(New("x").Parse(`user={{secret "db/user"}} password={{secret "db/password"}}`))
+	out, err := tmpl.CreateExecutor().SetSecrets(secrets).ExecuteString(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "user=admin password=s3cr3t"; out != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+	if keys := fmt.Sprint(secrets.Keys()); keys != "[db/password db/user]" {
+		t.Errorf("got keys %s", keys)
+	}
+
+	tmpl = Must(New("x").Parse(`{{seq (secret "db/password")}}`))
+	_, err = tmpl.CreateExecutor().SetSecrets(secrets).ExecuteString(nil)
+	if err == nil || strings.Contains(err.Error(), "s3cr3t") || !strings.Contains(err.Error(), SecretMask) {
+		t.Errorf("got error %v, want the secret masked", err)
+	}
+	if inner := errors.Unwrap(err); inner != nil {
+		t.Errorf("got the unwrapped error %v, want none", inner)
+	}
+	var log bytes.Buffer
+	tmpl = Must(New("x").Funcs(FuncMap{"warn": func(state *State, s string) string {
+		state.Log(slog.LevelWarn, "got "+s, "value", s, "err", errors.New(s))
+		return ""
+	}}).Parse(`{{warn (secret "db/password")}}`))
+	_, err = tmpl.CreateExecutor().SetSecrets(secrets).SetLogger(slog.New(slog.NewTextHandler(&log, nil))).ExecuteString(nil)
+	if err != nil || strings.Contains(log.String(), "s3cr3t") || !strings.Contains(log.String(), SecretMask) {
+		t.Errorf("got log %q, %v, want the secret masked", log.String(), err)
+	}
+	_, err = Must(New("x").Parse(`{{secret "none"}}`)).CreateExecutor().SetSecrets(secrets).ExecuteString(nil)
+	if err == nil || !strings.Contains(err.Error(), `secret "none": not found`) {
+		t.Errorf("got error %v", err)
+	}
+	_, err = Must(New("x").Parse(`{{secret "db/user"}}`)).CreateExecutor().ExecuteString(nil)
+	if err == nil || !strings.Contains(err.Error(), `"secret" is not a defined function`) {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestFilterForm(t *testing.T) {
+	data := map[string]interface{}{"Nickname": "", "Name": "Ann"}
+	for _, test := range []struct{ src, want string }{
+		{`{{.Nickname | default: "anonymous"}}`, "anonymous"},
+		{`{{.Name | default: "anonymous"}}`, "Ann"},
+		{`{{.Nickname | default: .Nickname .Name "anonymous"}}`, "Ann"},
+		{`{{.Name | eq: "Ann" "Bob"}}`, "true"},
+		{`{{default: .Nickname "x"}}`, "x"},
+	} {
+		tmpl := Must(New("x").Parse(test.src))
+		out, err := tmpl.CreateExecutor().ExecuteString(data)
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+		} else if out != test.want {
+			t.Errorf("%s: got %q, want %q", test.src, out, test.want)
+		}
+	}
+}
+
+func TestSession(t *testing.T) {
+	s := NewSession(New("repl").Funcs(funcs.FuncMap{"double": func(i int) int { return i * 2 }}),
+		map[string]interface{}{"Items": []string{"a", "b", "c"}})
+	for _, test := range []struct{ src, want, err string }{
+		{`{{$total := len .Items}}`, "", ""},
+		{`{{$total}} items`, "3 items", ""},
+		{`{{$total = double $total}}{{$first := index .Items 0}}`, "", ""},
+		{`{{$total}} {{$first}}`, "6 a", ""},
+		{`{{define "item"}}<{{.}}>{{end}}`, "", ""},
+		{`{{range .Items}}{{template "item" .}}{{end}}`, "<a><b><c>", ""},
+		{`{{$total := "x"}}{{$undefined}}`, "", "undefined variable"},
+		{`{{$total := index .Items 9}}`, "", "index out of range"},
+		{`{{$total}}`, "6", ""},
+	} {
+		out, err := s.Eval(test.src)
+		switch {
+		case test.err != "":
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want %q", test.src, err, test.err)
+			}
+		case err != nil:
+			t.Errorf("%s: %v", test.src, err)
+		case out != test.want:
+			t.Errorf("%s: got %q, want %q", test.src, out, test.want)
+		}
+	}
+	if vars := fmt.Sprint(s.Vars()); vars != "[$total $first]" {
+		t.Errorf("got vars %s", vars)
+	}
+	s.SetVar("name", "Ann")
+	if v, ok := s.Var("$name"); !ok || v != "Ann" {
+		t.Errorf("got %v, %v", v, ok)
+	}
+	if out, err := s.Eval(`{{$name}}`); err != nil || out != "Ann" {
+		t.Errorf("got %q, %v", out, err)
+	}
+	s.Reset()
+	if _, err := s.Eval(`{{$total}}`); err == nil {
+		t.Error("want undefined variable after Reset")
+	}
+}
+
+func TestCompletionNames(t *testing.T) {
+	tmpl := Must(New("page").Funcs(funcs.FuncMap{"shout": strings.ToUpper}).Parse(`{{define "item"}}{{.}}{{end}}{{define "empty"}}{{end}}x`))
+	has := func(names []string, name string) bool {
+		i := sort.SearchStrings(names, name)
+		return i < len(names) && names[i] == name
+	}
+	names := tmpl.FuncNames()
+	for _, name := range []string{"shout", "printf", "sort_by", "template_exec"} {
+		if !has(names, name) {
+			t.Errorf("function %s not listed", name)
+		}
+	}
+	if has(names, "env") || has(names, "_tpl_state") {
+		t.Errorf("got %v", names)
+	}
+	if !has(tmpl.CreateExecutor().SetEnv(&EnvPolicy{}).FuncNames(), "env") {
+		t.Error("function env not listed")
+	}
+	if got := fmt.Sprint(tmpl.TemplateNames()); got != "[empty item page]" {
+		t.Errorf("got templates %s", got)
+	}
+}
+
+func TestExecuteContext(t *testing.T) {
+	type key struct{}
+	tmpl := Must(New("ctx").Funcs(FuncMap{
+		"value": func(s *State) interface{} { return s.Context().Value(key{}) },
+	}).Parse(`{{value}}{{range .}}{{.}}{{end}}`))
+	executor := tmpl.CreateExecutor()
+	var wg sync.WaitGroup
+	for _, v := range []string{"a", "b", "c"} {
+		wg.Add(1)
+		go func(v string) {
+			defer wg.Done()
+			var b bytes.Buffer
+			ctx := context.WithValue(context.Background(), key{}, v)
+			if err := executor.ExecuteContext(ctx, &b, []int{1, 2}); err != nil {
+				t.Error(err)
+			} else if b.String() != v+"12" {
+				t.Errorf("got %q, want %q", b.String(), v+"12")
+			}
+		}(v)
+	}
+	wg.Wait()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var b bytes.Buffer
+	err := tmpl.ExecuteContext(ctx, &b, []int{1, 2})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+	if b.Len() != 0 {
+		t.Errorf("got output %q", b.String())
+	}
+}
+
+func TestConcurrentFuncs(t *testing.T) {
+	tmpl := Must(New("page").Parse(`{{template "item" .}}`))
+	Must(tmpl.New("item").Funcs(FuncMap{"twice": func(i int) int { return 2 * i }}).Parse(`{{twice .}}`))
+	executor := tmpl.CreateExecutor()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			var b bytes.Buffer
+			if err := executor.Execute(&b, i); err != nil {
+				t.Error(err)
+			} else if want := strconv.Itoa(2 * i); b.String() != want {
+				t.Errorf("got %q, want %q", b.String(), want)
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("f%d", i)
+			if err := executor.AppendFuncs(FuncMap{name: func() int { return i }}); err != nil {
+				t.Error(err)
+			}
+			tmpl.Funcs(FuncMap{name: func() int { return i }})
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < 8; i++ {
+		if executor.FindFunc(fmt.Sprintf("f%d", i)) == nil {
+			t.Errorf("f%d not found", i)
+		}
+	}
+}
+
+func TestFuncsPolicy(t *testing.T) {
+	tmpl := Must(New("t").Funcs(FuncMap{"len": func(s string) int { return -1 }}).Parse(`{{len "abc"}}`))
+	executor := tmpl.CreateExecutor()
+	var shadowed []string
+	for _, s := range executor.FuncShadowings() {
+		shadowed = append(shadowed, s.Name)
+	}
+	if fmt.Sprint(shadowed) != "[len]" {
+		t.Errorf("got shadowings %v", shadowed)
+	}
+	err := executor.AppendFuncsWithPolicy(funcs.ErrorOnConflict, FuncMap{"print": fmt.Sprint})
+	if conflict, ok := err.(*funcs.ConflictError); !ok || conflict.Name != "print" {
+		t.Errorf("got error %v", err)
+	}
+	if err = executor.AppendFuncsWithPolicy(funcs.KeepFirst, FuncMap{"len": strings.ToUpper}); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := executor.ExecuteString(nil); err != nil || out != "-1" {
+		t.Errorf("got %q, %v", out, err)
+	}
+}
+
+func TestFuncProvider(t *testing.T) {
+	var called []string
+	library := FuncMap{}
+	for _, name := range []string{"a", "b", "c"} {
+		name := name
+		library[name] = func() string { called = append(called, name); return name }
+	}
+	tmpl := Must(New("t").FuncProvider(funcs.LazyFuncMap(library)).Parse(`{{a}}{{c}}`))
+	if out, err := tmpl.ExecuteString(nil); err != nil || out != "ac" {
+		t.Errorf("got %q, %v", out, err)
+	}
+	names := tmpl.FuncNames()
+	if i := sort.SearchStrings(names, "b"); i == len(names) || names[i] != "b" {
+		t.Errorf("b not in %v", names)
+	}
+	executor := New("e").CreateExecutor().AppendFuncProvider(funcs.LazyFuncMap(library))
+	if f := executor.FindFunc("b"); f == nil {
+		t.Error("b not found")
+	}
+	if fmt.Sprint(called) != "[a c]" {
+		t.Errorf("called %v", called)
+	}
+}
+
+func TestBind(t *testing.T) {
+	fm := FuncMap{
+		"tag":   func(name, value string) string { return "<" + name + ">" + value },
+		"where": func(s *State, prefix string) string { return prefix + s.Template().Name() },
+	}
+	for _, test := range []struct{ src, want string }{
+		{`{{call (bind "printf" "%d-%d" 1) 2}}`, "1-2"},
+		{`{{$b := bind "tag" "b"}}{{call $b "x"}}{{call $b "y"}}`, "<b>x<b>y"},
+		{`{{call (bind "where" "in ")}}`, "in bind"},
+		{`{{call (bind .F 2) 3}}`, "5"},
+	} {
+		tmpl, err := New("bind").Funcs(fm).Parse(test.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := tmpl.ExecuteString(map[string]interface{}{"F": func(a, b int) int { return a + b }})
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+		} else if got != test.want {
+			t.Errorf("%s: got %q, want %q", test.src, got, test.want)
+		}
+	}
+	for _, src := range []string{`{{bind "none"}}`, `{{bind "tag" "a" "b" "c"}}`, `{{bind 1}}`} {
+		if _, err := Must(New("bind").Funcs(fm).Parse(src)).ExecuteString(nil); err == nil {
+			t.Errorf("%s: no error", src)
+		}
+	}
+}
+
+func TestFastFuncValue(t *testing.T) {
+	var fast int
+	repeat := func(s string, n int) string { return strings.Repeat(s, n) }
+	fv := funcs.NewFastFuncValue(repeat, func(args []reflect.Value) []reflect.Value {
+		fast++
+		return []reflect.Value{reflect.ValueOf(repeat(args[0].String(), int(args[1].Int())))}
+	})
+	tmpl := New("fast").FuncsValues(FuncValues{{"repeat": fv}}).Funcs(FuncMap{"upper": strings.ToUpper})
+	Must(tmpl.Parse(`{{repeat "ab" 2}}{{2 | repeat "y" | upper}}`))
+	if out, err := tmpl.ExecuteString(nil); err != nil || out != "ababYY" {
+		t.Errorf("got %q, %v", out, err)
+	}
+	if fast != 2 {
+		t.Errorf("fast calls: got %d, want 2", fast)
+	}
+}
+
+func TestCallPlan(t *testing.T) {
+	tmpl := Must(New("plan").Funcs(FuncMap{"f": func(a int, b ...string) string { return fmt.Sprint(a, b) }}).
+		Parse(`{{f 1}}{{f 2 "x" "y"}}{{range .}}{{f . "z"}}{{end}}`))
+	const want = "1 []2 [x y]3 [z]4 [z]"
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if out, err := tmpl.ExecuteString([]int{3, 4}); err != nil || out != want {
+					t.Errorf("got %q, %v, want %q", out, err, want)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	// The plan of the command isn't reused by a function of another type.
+	tmpl.Funcs(FuncMap{"f": func(a string, b ...interface{}) string { return a + fmt.Sprint(len(b)) }})
+	if _, err := tmpl.ExecuteString([]int{3}); err == nil {
+		t.Error("no error calling f with an int")
+	}
+	tmpl = Must(New("plan").Funcs(FuncMap{"f": func(a string, b ...interface{}) string { return a + fmt.Sprint(len(b)) }}).
+		Parse(`{{f "a"}}{{f "b" 1 2}}`))
+	if out, err := tmpl.ExecuteString(nil); err != nil || out != "a0b2" {
+		t.Errorf("got %q, %v", out, err)
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	data := map[string]interface{}{"Title": "T", "Items": []int{1, 2}, "None": []int{}, "Admin": nil}
+	for _, test := range []struct{ src, want, tree string }{
+		{`{{2 * 60}}|{{printf "%d%%" 50}}|{{print (printf "%s" "a") 1}}`, "120|50%|a1", `{{<int Value>}}|{{"50%"}}|{{"a1"}}`},
+		{`{{printf "%T" (1.5 + 2)}}`, "float64", `{{"float64"}}`},
+		{`{{1 / 0}}`, "", `{{1 / 0}}`},
+		{`{{range .Items}}{{.}}{{$.Title | printf "%s-"}}{{printf "%s%d" (printf "%s:" $.Title) .}}{{end}}`, "1T-T:12T-T:2",
+			`{{$_hoist0 := false}}{{$_hoist1 := false}}{{$_hoist2 := false}}{{range .Items}}{{if $_hoist2}}{{else}}{{$_hoist0 := $.Title | printf "%s-"}}{{$_hoist1 := printf "%s:" $.Title}}{{$_hoist2 := true}}{{end}}{{.}}{{$_hoist0}}{{printf "%s%d" $_hoist1 .}}{{end}}`},
+		{`{{$x := 1}}{{range $i, $e := .Items}}{{print $x $e}}{{$x = 2}}{{len $.Items}}{{end}}`, "1 122 22",
+			`{{$x := 1}}{{$_hoist0 := false}}{{$_hoist1 := false}}{{range $i, $e := .Items}}{{if $_hoist1}}{{else}}{{$_hoist0 := len $.Items}}{{$_hoist1 := true}}{{end}}{{print $x $e}}{{$x := 2}}{{$_hoist0}}{{end}}`},
+		{`{{range .None}}{{user $.Title}}{{end}}`, "", `{{range .None}}{{user $.Title}}{{end}}`},
+		// The moved pipelines aren't evaluated if the range has no elements.
+		{`{{range .None}}{{$.Admin.Name}}{{end}}done`, "done",
+			`{{$_hoist0 := false}}{{$_hoist1 := false}}{{range .None}}{{if $_hoist1}}{{else}}{{$_hoist0 := $.Admin.Name}}{{$_hoist1 := true}}{{end}}{{$_hoist0}}{{end}}done`},
+		{`{{range .None}}{{index $.None 5}}{{end}}`, "",
+			`{{$_hoist0 := false}}{{$_hoist1 := false}}{{range .None}}{{if $_hoist1}}{{else}}{{$_hoist0 := index $.None 5}}{{$_hoist1 := true}}{{end}}{{$_hoist0}}{{end}}`},
+	} {
+		tmpl := Must(New("opt").Funcs(FuncMap{"user": strings.ToUpper}).Parse(test.src))
+		want, wantErr := tmpl.ExecuteString(data)
+		if test.want != "" && (wantErr != nil || want != test.want) {
+			t.Errorf("%s: got %q, %v, want %q", test.src, want, wantErr, test.want)
+		}
+		tmpl.Optimize()
+		if tree := tmpl.Root.String(); tree != test.tree {
+			t.Errorf("%s: got tree %s, want %s", test.src, tree, test.tree)
+		}
+		if got, err := tmpl.ExecuteString(data); got != want || (err == nil) != (wantErr == nil) {
+			t.Errorf("%s: optimized: got %q, %v, want %q", test.src, got, err, want)
+		}
+	}
+	// The functions of the template aren't the builtins.
+	tmpl := Must(New("opt").Funcs(FuncMap{"printf": func(string) string { return "user" }}).Parse(`{{printf "x"}}`)).Optimize()
+	if tree := tmpl.Root.String(); tree != `{{printf "x"}}` {
+		t.Errorf("got tree %s", tree)
+	}
+}
+
+func TestBufferSize(t *testing.T) {
+	tmpl := Must(New("buf").Funcs(FuncMap{"echo": echo}).Parse(
+		`{{range .}}{{wrap}}{{begin}}<ul>{{enter}} {{.}}{{after}}</ul>{{else}}-{{end}}` +
+			`{{arg | echo}}({{.}}){{end}}[{{template_exec "item" .}}]{{end}}` +
+			`{{define "item"}}<{{.}}>{{end}}`))
+	e := tmpl.CreateExecutor().SetBufferSize(256)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s := strings.Repeat("x", 1+i*40)
+			want := "<ul> " + s + "</ul>(" + s + ")[<" + s + ">]-()[<>]"
+			for j := 0; j < 20; j++ {
+				if got, err := e.ExecuteString([]string{s, ""}); err != nil || got != want {
+					t.Errorf("got %q, %v, want %q", got, err, want)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestExecuteCached(t *testing.T) {
+	var calls int
+	tmpl := Must(New("menu").Funcs(FuncMap{"count": func() int { calls++; return calls }}).Parse(`{{.}}{{count}}`))
+	cache := &ResultCache{MaxEntries: 2}
+	e := tmpl.CreateExecutor().SetResultCache(cache)
+	for _, test := range []struct {
+		data, key, want string
+	}{
+		{"a", "k", "a1"},
+		{"b", "k", "a1"}, // The output of the key.
+		{"b", "b", "b2"},
+		{"b", "b", "b2"},
+		{"c", "c", "c3"},
+		{"c", "c", "c3"},
+	} {
+		var buf bytes.Buffer
+		if err := e.ExecuteCached(&buf, test.data, test.key); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != test.want {
+			t.Errorf("%s %q: got %q, want %q", test.data, test.key, buf.String(), test.want)
+		}
+	}
+	if n := len(cache.entries); n != 2 {
+		t.Errorf("got %d entries, want 2", n)
+	}
+	// The data doesn't make the key.
+	if err := e.ExecuteCached(io.Discard, "d", ""); err != ErrNoCacheKey {
+		t.Errorf("got error %v, want ErrNoCacheKey", err)
+	}
+	// The keys are of the template.
+	other := Must(New("footer").Parse(`footer`)).CreateExecutor().SetResultCache(cache)
+	var buf bytes.Buffer
+	if err := other.ExecuteCached(&buf, nil, "k"); err != nil || buf.String() != "footer" {
+		t.Errorf("got %q, %v", buf.String(), err)
+	}
+	// The outputs expire.
+	cache = &ResultCache{TTL: time.Nanosecond}
+	e.SetResultCache(cache)
+	for i := 0; i < 2; i++ {
+		buf.Reset()
+		e.ExecuteCached(&buf, "d", "d")
+		time.Sleep(time.Millisecond)
+	}
+	if want := fmt.Sprint("d", calls); buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+	// The expired outputs are removed without MaxEntries.
+	e.ExecuteCached(io.Discard, "e", "e")
+	if _, ok := cache.entries["menu\x00d"]; ok || len(cache.entries) != 1 {
+		t.Errorf("got %d entries, want the expired ones removed", len(cache.entries))
+	}
+	// The data makes the key.
+	e.SetResultCache(&ResultCache{})
+	for _, test := range []struct {
+		data   interface{}
+		key    string
+		cached bool
+	}{
+		{map[string]int{"A": 1}, "en", false},
+		{map[string]int{"A": 1}, "en", true},
+		{map[string]int{"A": 2}, "en", false},
+		{map[string]int{"A": 1}, "pt", false},
+		{map[string]int{"A": 2}, "en", true},
+	} {
+		buf.Reset()
+		before := calls
+		if err := e.ExecuteCachedHash(&buf, test.data, test.key); err != nil {
+			t.Fatal(err)
+		}
+		if cached := calls == before; cached != test.cached || !strings.HasPrefix(buf.String(), fmt.Sprint(test.data)) {
+			t.Errorf("%v %q: got %q, cached %v", test.data, test.key, buf.String(), cached)
+		}
+	}
+	if err := e.ExecuteCachedHash(io.Discard, func() {}, ""); err == nil {
+		t.Error("the functions are encoded")
+	}
+	// The failed executions aren't cached.
+	e = Must(New("err").Parse(`{{.X}}`)).CreateExecutor().SetResultCache(cache)
+	if err := e.ExecuteCached(&buf, 1, "x"); err == nil || len(cache.entries) != 1 {
+		t.Errorf("got %v, %d entries", err, len(cache.entries))
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	tmpl := Must(New("det").Parse(`{{rand_int 1000}} {{printf "%.6f" rand_float}} {{unique_id "tab"}} {{template_exec "id" .}} ` +
+		`{{unique_id}} {{now.Format "2006-01-02"}} {{reltime .}}{{define "id"}}{{unique_id "x"}}{{end}}`))
+	d := &Deterministic{Seed: 1, Now: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)}
+	var outs []string
+	for i := 0; i < 2; i++ {
+		out, err := tmpl.CreateExecutor().SetDeterministic(d).ExecuteString(d.Now.Add(-2 * time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		outs = append(outs, out)
+	}
+	if outs[0] != outs[1] {
+		t.Errorf("got %q and %q", outs[0], outs[1])
+	}
+	if want := " tab-1 x-2 3 2024-05-01 2 hours ago"; !strings.HasSuffix(outs[0], want) {
+		t.Errorf("got %q, want the suffix %q", outs[0], want)
+	}
+	tmpl = Must(New("ids").Parse(`{{unique_id}}`))
+	a, _ := tmpl.ExecuteString(nil)
+	b, _ := tmpl.ExecuteString(nil)
+	if a == b {
+		t.Errorf("got the same IDs %q", a)
+	}
+	if _, err := tmpl.CreateExecutor().SetDeterministic(d).ExecuteString(nil); err != nil {
+		t.Error(err)
+	}
+	if _, err := Must(New("rand").Parse(`{{rand_int 0}}`)).ExecuteString(nil); err == nil {
+		t.Error("rand_int 0: no error")
+	}
+}
+
+func TestSetClock(t *testing.T) {
+	asOf := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	clock := ClockFunc(func() time.Time { return asOf })
+	tmpl := Must(New("clock").Parse(`{{now.Format "15:04"}} {{reltime .}}`))
+	e := tmpl.CreateExecutor().SetClock(clock).SetDeterministic(&Deterministic{})
+	if out, err := e.ExecuteString(asOf.Add(3 * 24 * time.Hour)); err != nil || out != "12:00 in 3 days" {
+		t.Errorf("got %q, %v", out, err)
+	}
+	// The now of Sprig.
+	tmpl = Must(New("sprig").FuncsValues(funcs.Sprig()).Parse(`{{now.Year}}`))
+	if out, err := tmpl.CreateExecutor().SetClock(clock).ExecuteString(nil); err != nil || out != "2024" {
+		t.Errorf("got %q, %v", out, err)
+	}
+}
+
+func TestPreview(t *testing.T) {
+	type user struct{ Name string }
+	tmpl := Must(New("preview").Funcs(FuncMap{
+		"price": func(v interface{}) (string, error) { return "", fmt.Errorf("no price") },
+		"upper": strings.ToUpper,
+	}).Parse(`{{.User.Name}} {{.User.Email}} {{.Missing | upper}} {{price .}} {{with .User}}{{.Phone?}}{{end}}.`))
+	p := &Preview{}
+	out, err := tmpl.CreateExecutor().SetPreview(p).ExecuteString(map[string]interface{}{"User": user{"Ann"}})
+	if want := "Ann ⟨Email⟩ ⟨MISSING⟩ ⟨price⟩ ."; err != nil || out != want {
+		t.Errorf("got %q, %v, want %q", out, err, want)
+	}
+	var names []string
+	for _, issue := range p.Issues() {
+		names = append(names, fmt.Sprintf("%s %v %v %v", issue.Name, issue.Func, issue.Error != "", issue.Location != ""))
+	}
+	if got, want := strings.Join(names, " "), "Email false false true Missing false false true price true true true"; got != want {
+		t.Errorf("got issues %s, want %s", got, want)
+	}
+	p = &Preview{Placeholder: func(name string) string { return "[" + name + "]" }}
+	out, err = tmpl.Option("missingkey=error").CreateExecutor().SetPreview(p).ExecuteString(nil)
+	if want := "[Name] [Email] [MISSING] [price] [Phone]."; err != nil || out != want {
+		t.Errorf("got %q, %v, want %q", out, err, want)
+	}
+	// Without preview, the executions fail.
+	if _, err := tmpl.ExecuteString(nil); err == nil {
+		t.Error("no error")
+	}
+}
+
+func TestSchema(t *testing.T) {
+	tmpl := Must(New("page").ParseMode(parse.ParseComments).Parse(`{{.Title}}{{if .Draft}}draft{{end}}
+{{with .Author}}{{.Name}} {{.Phone?}}{{end}}
+{{range $i, $item := .Items}}{{$item.Name}}{{if eq $item.Status "sold"}}{{.Price}}{{end}}{{end}}
+{{$total := .Count}}{{add $total 1}}{{.Ratio * 2}}
+{{template "card" .Card .Tags .Size}}
+{{define "card" (tags []string, size int)}}{{/*
+Card renders a card.
+
+@arg .Footer.Links []string The footer links.
+*/}}{{.Heading}}{{range $tags}}{{.}}{{end}}{{$size}}{{end}}`))
+	tmpl.Funcs(FuncMap{"add": func(a, b int) int { return a + b }})
+	b, err := json.Marshal(tmpl.Schema())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"type":"object","properties":{` +
+		`"Author":{"type":"object","properties":{"Name":{},"Phone":{}},"required":["Name"]},` +
+		`"Card":{"type":"object","properties":{` +
+		`"Footer":{"type":"object","properties":{"Links":{"type":"array","description":"The footer links.","items":{"type":"string"}}},"required":["Links"]},` +
+		`"Heading":{}},"required":["Footer","Heading"]},` +
+		`"Count":{},"Draft":{},` +
+		`"Items":{"type":"array","items":{"type":"object","properties":{"Name":{},"Price":{},"Status":{"type":"string"}},"required":["Name","Price","Status"]}},` +
+		`"Ratio":{"type":"number"},"Size":{"type":"integer"},"Tags":{"type":"array","items":{"type":"string"}},"Title":{}},` +
+		`"required":["Card","Count","Items","Ratio","Size","Tags","Title"]}`
+	if string(b) != want {
+		t.Errorf("got\n%s\nwant\n%s", b, want)
+	}
+	// The recursive templates are walked once.
+	tmpl = Must(New("tree").Parse(`{{define "node"}}{{.Name}}{{range .Children}}{{template "node" .}}{{end}}{{end}}{{template "node" .Root}}`))
+	if b, _ = json.Marshal(tmpl.Schema()); string(b) != `{"type":"object","properties":{"Root":{"type":"object","properties":{"Children":{"type":"array","items":{}},"Name":{}},"required":["Children","Name"]}},"required":["Root"]}` {
+		t.Errorf("got %s", b)
+	}
+}
+
+func TestValidateData(t *testing.T) {
+	tmpl := Must(New("page").Parse(`{{/* umbu:require .Title */}}{{/* umbu:arg .Count int */}}{{/* umbu:arg .Tags []string */}}` +
+		`{{/* umbu:arg .Phone? string */}}{{/* umbu:arg .User.Name string */}}{{.Title}}{{template "card" . .Title .Count}}` +
+		`{{define "card" (title string, size int)}}[{{$title}} {{$size}}]{{end}}`))
+	e := tmpl.CreateExecutor().SetValidateData(true)
+	var buf bytes.Buffer
+	err := e.Execute(&buf, map[string]interface{}{"Count": "3", "Tags": []interface{}{"a", 1}, "Phone": 5})
+	var dataErr *DataError
+	if !errors.As(err, &dataErr) {
+		t.Fatalf("got %v, want a *DataError", err)
+	}
+	want := `template "page": invalid data: missing .Title; .Count is string, want int; .Tags[1] is int, want string; .Phone is int, want string; missing .User.Name`
+	if err.Error() != want {
+		t.Errorf("got %q, want %q", err, want)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("wrote %q", buf.String())
+	}
+	// The integers may be decoded from JSON.
+	var data interface{}
+	json.Unmarshal([]byte(`{"Title":"T","Count":3,"Tags":["a"],"User":{"Name":"Ann"}}`), &data)
+	if out, err := e.ExecuteString(data); err != nil || out != "T[T 3]" {
+		t.Errorf("got %q, %v", out, err)
+	}
+	// The floats with fractions aren't integers.
+	_, err = e.ExecuteString(map[string]interface{}{"Title": "T", "Count": 1.5, "Tags": nil, "User": map[string]string{"Name": "Ann"}})
+	if err == nil || !strings.Contains(err.Error(), `.Count is float64, want int`) {
+		t.Errorf("got %v", err)
+	}
+	// The arguments of the template calls.
+	tmpl = Must(New("call").Parse(`{{template "card" . .Title .Count}}{{define "card" (title string, size int)}}{{end}}`))
+	_, err = tmpl.CreateExecutor().SetValidateData(true).ExecuteString(map[string]interface{}{"Title": 1, "Count": "x"})
+	if err == nil || !strings.Contains(err.Error(), `template "card": invalid data: $title is int, want string; $size is string, want int`) {
+		t.Errorf("got %v", err)
+	}
+	// Without validation, the data isn't checked.
+	if out, err := tmpl.ExecuteString(map[string]interface{}{"Title": 1, "Count": "x"}); err != nil || out != "" {
+		t.Errorf("got %q, %v", out, err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tmpl := Must(New("check").Parse(`<h1>{{.Title}}</h1>{{range .Items}}{{.Price}}{{end}}`))
+	e := tmpl.CreateExecutor()
+	if err := e.Check(map[string]interface{}{"Title": "T", "Items": []interface{}{1}}); err == nil || !strings.Contains(err.Error(), "Price") {
+		t.Errorf("got %v", err)
+	}
+	type item struct{ Price int }
+	data := map[string]interface{}{"Title": "T", "Items": []item{{1}, {2}}}
+	if err := e.Check(data); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := e.ExecuteString(data); err != nil || out != "<h1>T</h1>12" {
+		t.Errorf("got %q, %v", out, err)
+	}
+}
+
+func TestBufferedExecute(t *testing.T) {
+	tmpl := Must(New("buffered").Parse(`<p>{{range .}}{{.Name}}{{end}}</p>`))
+	type item struct{ Name string }
+	var buf bytes.Buffer
+	if err := tmpl.CreateExecutor().BufferedExecute(&buf, []interface{}{item{"a"}, 1}); err == nil || buf.Len() != 0 {
+		t.Errorf("got %q, %v", buf.String(), err)
+	}
+	if err := tmpl.CreateExecutor().BufferedExecute(&buf, []item{{"a"}, {"b"}}); err != nil || buf.String() != "<p>ab</p>" {
+		t.Errorf("got %q, %v", buf.String(), err)
+	}
+	buf.Reset()
+	err := tmpl.CreateExecutor().SetMaxBufferedSize(5).BufferedExecute(&buf, []item{{"abc"}})
+	if !errors.Is(err, ErrOutputTooLarge) || buf.Len() != 0 {
+		t.Errorf("got %q, %v", buf.String(), err)
+	}
+	if err := tmpl.CreateExecutor().SetMaxBufferedSize(-1).BufferedExecute(&buf, []item{{"abc"}}); err != nil || buf.String() != "<p>abc</p>" {
+		t.Errorf("got %q, %v", buf.String(), err)
+	}
+}
+
+// flushRecorder records the output flushed at each flush.
+type flushRecorder struct {
+	bytes.Buffer
+	flushed []string
+}
+
+func (w *flushRecorder) Flush() error {
+	w.flushed = append(w.flushed, w.String())
+	return nil
+}
+
+func TestChunking(t *testing.T) {
+	tmpl := Must(New("export").Parse(`{{range .}}{{.}};{{end}}{{range $i, $v := .}}{{$i}}{{end}}`))
+	var progress []string
+	e := tmpl.CreateExecutor().SetChunking(&Chunking{Every: 2, Progress: func(p ChunkProgress) {
+		progress = append(progress, fmt.Sprint(p.Elements, "/", p.Bytes))
+	}})
+	var w flushRecorder
+	if err := e.Execute(&w, []string{"a", "b", "c"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(w.flushed, " "), "a;b; a;b;c;0 a;b;c;012 a;b;c;012"; got != want {
+		t.Errorf("got flushes %q, want %q", got, want)
+	}
+	if got, want := strings.Join(progress, " "), "2/4 4/7 6/9 6/9"; got != want {
+		t.Errorf("got progress %q, want %q", got, want)
+	}
+	// The execution stops once its context is done.
+	ctx, cancel := context.WithCancel(context.Background())
+	e = tmpl.CreateExecutor().SetChunking(&Chunking{Every: 1, Progress: func(p ChunkProgress) {
+		if p.Elements == 2 {
+			cancel()
+		}
+	}})
+	w = flushRecorder{}
+	if err := e.ExecuteContext(ctx, &w, []string{"a", "b", "c"}); !errors.Is(err, context.Canceled) || w.String() != "a;b;" {
+		t.Errorf("got %q, %v", w.String(), err)
+	}
+}
+
+func TestJSONLines(t *testing.T) {
+	type order struct {
+		ID   int
+		Note string
+	}
+	orders := []order{{1, "a\nb"}, {2, "<x> & y"}}
+	tmpl := Must(New("jsonl").Parse(`{{range .}}{{json_line (dict "id" .ID "note" .Note)}}{{end}}|{{json_lines .}}`))
+	out, err := tmpl.ExecuteString(orders)
+	want := `{"id":1,"note":"a\nb"}` + "\n" + `{"id":2,"note":"<x> & y"}` + "\n|" +
+		`{"ID":1,"Note":"a\nb"}` + "\n" + `{"ID":2,"Note":"<x> & y"}` + "\n"
+	if err != nil || out != want {
+		t.Errorf("got %q, %v, want %q", out, err, want)
+	}
+	if _, err := Must(New("jsonl").Parse(`{{json_line .}}`)).ExecuteString(make(chan int)); err == nil || !strings.Contains(err.Error(), "json_line:") {
+		t.Errorf("got %v", err)
+	}
+	if _, err := Must(New("jsonl").Parse(`{{json_lines .}}`)).ExecuteString(1); err == nil || !strings.Contains(err.Error(), "json_lines: want a list") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestAppendExecute(t *testing.T) {
+	tmpl := Must(New("x").Parse(`{{.}}!`))
+	buf, err := tmpl.AppendExecute([]byte("hello, "), "world")
+	if err != nil || string(buf) != "hello, world!" {
+		t.Fatalf("got %q, %v", buf, err)
+	}
+	if buf, err = tmpl.ExecuteBytes(1); err != nil || string(buf) != "1!" {
+		t.Fatalf("got %q, %v", buf, err)
+	}
+	tmpl = Must(New("x").Parse(`a{{.X}}`))
+	if buf, err = tmpl.AppendExecute([]byte("b"), 1); err == nil || string(buf) != "b" {
+		t.Errorf("got %q, %v", buf, err)
+	}
+}
+
+func TestRenderer(t *testing.T) {
+	executor := Must(New("x").Parse(`{{greet .}}{{set "n" 1}}`)).
+		CreateExecutor(FuncMap{"greet": func(s string) string { return "hi " + s }}).
+		FuncsValues(funcs.NewValues()).
+		SetValidateData(true)
+	r := executor.Renderer()
+	executor.SetFuncs(nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var b strings.Builder
+			if err := r.Execute(context.Background(), &b, fmt.Sprint(i)); err != nil || b.String() != "hi "+fmt.Sprint(i) {
+				t.Errorf("got %q, %v", b.String(), err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if r.executor.parent != nil {
+		t.Error("the executor chain isn't flattened")
+	}
+}
+
+func TestRegisterGlobalFuncs(t *testing.T) {
+	tmpl := Must(New("x").Parse(`{{test_global_a}} {{test_global_b}}`))
+	before := tmpl.CreateExecutor()
+	RegisterGlobalFuncs(FuncMap{
+		"test_global_a": func() string { return "global a" },
+		"test_global_b": func() string { return "global b" },
+	})
+	if _, err := before.ExecuteString(nil); err == nil {
+		t.Error("the executor created before got the global functions")
+	}
+	tmpl.Funcs(FuncMap{"test_global_b": func() string { return "template b" }})
+	if out, err := tmpl.ExecuteString(nil); err != nil || out != "global a template b" {
+		t.Errorf("got %q, %v", out, err)
+	}
+}
+
+func TestTemplateSet(t *testing.T) {
+	a := NewTemplateSet("a").Funcs(FuncMap{"name": func() string { return "a" }})
+	b := NewTemplateSet("b").Funcs(FuncMap{"name": func() string { return "b" }})
+	for _, s := range []*TemplateSet{a, b} {
+		if err := s.Parse("page", `{{template "common" .}}`); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.Parse("common", `{{name}}: {{.}}`); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Parse("common", `{{.}} by {{name}}`); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		set  *TemplateSet
+		want string
+	}{{a, "a: 1"}, {b, "1 by b"}} {
+		var out strings.Builder
+		if err := test.set.Render(context.Background(), &out, "page", 1); err != nil || out.String() != test.want {
+			t.Errorf("%s: got %q, %v, want %q", test.set.Name(), out.String(), err, test.want)
+		}
+	}
+	r, _ := a.Renderer("page")
+	if err := a.Parse("common", `{{.}}!`); err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := r.Execute(context.Background(), &out, 1); err != nil || out.String() != "a: 1" {
+		t.Errorf("got %q, %v from the old renderer", out.String(), err)
+	}
+	out.Reset()
+	if err := a.Render(context.Background(), &out, "page", 1); err != nil || out.String() != "1!" {
+		t.Errorf("got %q, %v after Parse", out.String(), err)
+	}
+	if err := a.Render(context.Background(), &out, "missing", 1); err == nil || !strings.Contains(err.Error(), `no template "missing" in the set "a"`) {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestMaxSteps(t *testing.T) {
+	tmpl := Must(New("x").Parse(`{{range .}}{{.}}{{end}}`))
+	if out, err := tmpl.CreateExecutor().SetMaxSteps(10).ExecuteString([]int{1, 2, 3}); err != nil || out != "123" {
+		t.Errorf("got %q, %v", out, err)
+	}
+	if _, err := tmpl.CreateExecutor().SetMaxSteps(10).ExecuteString(make([]int, 10)); !errors.Is(err, ErrMaxSteps) {
+		t.Errorf("got error %v, want ErrMaxSteps", err)
+	}
+}
+
+func TestTemplateSetQuota(t *testing.T) {
+	s := NewTemplateSet("tenant").SetQuota(Quota{MaxTemplates: 2, MaxSteps: 20, MaxOutputBytes: 8})
+	if err := s.Parse("a", `{{range .}}{{.}}{{end}}`); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Parse("loop", `{{range .}}{{end}}`); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Parse("b", `b{{define "c"}}c{{end}}`); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("got error %v, want ErrQuotaExceeded", err)
+	}
+	if s.Lookup("b") != nil {
+		t.Error("the set changed on error")
+	}
+	var out strings.Builder
+	if err := s.Render(context.Background(), &out, "a", []int{1, 2}); err != nil || out.String() != "12" {
+		t.Errorf("got %q, %v", out.String(), err)
+	}
+	if err := s.Render(context.Background(), io.Discard, "a", make([]int, 9)); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("got error %v, want ErrQuotaExceeded", err)
+	}
+	if err := s.Render(context.Background(), io.Discard, "loop", make([]int, 100)); !errors.Is(err, ErrMaxSteps) {
+		t.Errorf("got error %v, want ErrMaxSteps", err)
+	}
+	m := s.Metrics()
+	if m.Templates != 2 || m.Executions != 3 || m.Failures != 2 || m.Rejections != 3 || m.OutputBytes != 2+8 {
+		t.Errorf("got metrics %+v", m)
+	}
+
+	// The size of the templates is kept, the one of the unchanged ones not
+	// estimated again.
+	if m.CacheBytes <= 0 || m.CacheBytes != treeSize(s.Lookup("a").Tree)+treeSize(s.Lookup("loop").Tree) {
+		t.Errorf("got cache bytes %d", m.CacheBytes)
+	}
+	loop := s.Lookup("loop").Tree
+	if err := s.Parse("a", `{{.}}`); err != nil {
+		t.Fatal(err)
+	}
+	if s.usage.trees[loop] == 0 || s.Lookup("loop").Tree != loop {
+		t.Error("the size of the unchanged template is lost")
+	}
+	s.SetQuota(Quota{MaxCacheBytes: s.Metrics().CacheBytes + treeSize(loop)/2})
+	if err := s.Parse("b", `{{range .}}{{end}}`); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("got error %v, want ErrQuotaExceeded", err)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	RegisterProfile(&Profile{Name: "test-safe", Funcs: []string{"print*", "upper"}, MaxOutputBytes: 8})
+	p := LookupProfile("test-safe")
+	if p == nil || !p.AllowsFunc("printf") || !p.AllowsFunc("_html_template_htmlescaper") || p.AllowsFunc("_internal") || p.AllowsFunc("env") {
+		t.Fatalf("got profile %+v", p)
+	}
+	fm := FuncMap{"upper": strings.ToUpper, "lower": strings.ToLower}
+	for _, test := range []struct {
+		text, data, want, err string
+	}{
+		{`{{printf "%s" . | upper}}`, "ab", "AB", ""},
+		{`{{lower .}}`, "ab", "", `function "lower" not allowed by the profile "test-safe"`},
+		{`{{.}}`, "abcdefghij", "", "output too large"},
+	} {
+		out, err := Must(New("x").Funcs(fm).Parse(test.text)).CreateExecutor().SetProfile(p).ExecuteString(test.data)
+		if test.err == "" && (err != nil || out != test.want) {
+			t.Errorf("%s: got %q, %v, want %q", test.text, out, err, test.want)
+		} else if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s: got error %v, want %q", test.text, err, test.err)
+		}
+	}
+	if _, err := Must(New("x").Parse(`{{.}}`)).CreateExecutor().SetProfile(p).ExecuteString("abcdefghij"); !errors.Is(err, ErrOutputTooLarge) {
+		t.Errorf("got error %v, want ErrOutputTooLarge", err)
+	}
+	s := NewTemplateSet("tenant").Funcs(FuncMap{"lower": strings.ToLower}).SetProfile(p)
+	if err := s.Parse("x", `{{lower .}}`); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Render(context.Background(), io.Discard, "x", "A"); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("got error %v", err)
+	}
+	// The state functions give access to the executor: no profile allows
+	// them, lest the templates remove the profile.
+	for _, p := range []*Profile{{Name: "len", Funcs: []string{"len"}}, {Name: "all"}} {
+		escape := `{{$e := (_tpl_state).Executor}}{{$_ := $e.SetProfile nil}}{{print "ESCAPED"}}`
+		out, err := Must(New("x").Parse(escape)).CreateExecutor().SetProfile(p).ExecuteString(nil)
+		if err == nil || !strings.Contains(err.Error(), `function "_tpl_state" not allowed`) {
+			t.Errorf("%s: got %q, %v, want an error", p.Name, out, err)
+		}
+	}
+}
+
+func TestSigner(t *testing.T) {
+	oldKey, key := []byte("0123456789abcdef0123456789abcdef"), []byte("fedcba9876543210fedcba9876543210")
+	old, err := NewSigner(oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewSigner(key, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, keys := range [][][]byte{{nil}, {[]byte("key")}, {key, []byte("old key")}} {
+		if _, err := NewSigner(keys[0], keys[1:]...); err == nil {
+			t.Errorf("%q: expected error; got none", keys)
+		}
+	}
+	sources := map[string]string{
+		"a":        signer.Seal("a", `a{{template "b" .}}`),
+		"b":        old.Seal("b", `b{{.}}`),
+		"tampered": strings.Replace(signer.Seal("tampered", `{{.}}`), "{{.}}", "{{env}}", 1),
+		"renamed":  signer.Seal("a", `a`),
+		"unsealed": `{{.}}`,
+	}
+	tmpl := New("root").SetProvider(signer.Provider(ProviderFunc(func(name string) (string, error) {
+		return sources[name], nil
+	})))
+	if out, err := Must(tmpl.Parse(`{{template "a" 1}}`)).ExecuteString(nil); err != nil || out != "ab1" {
+		t.Errorf("got %q, %v", out, err)
+	}
+	for _, name := range []string{"tampered", "renamed", "unsealed"} {
+		if _, err := tmpl.Load(name); !errors.Is(err, ErrBadSignature) {
+			t.Errorf("%s: got error %v, want ErrBadSignature", name, err)
+		}
+	}
+	if _, err := New("x").ParseSigned(`{{.}}`, signer.Sign("x", `{{.}}`), signer); err != nil {
+		t.Error(err)
+	}
+	if _, err := New("x").ParseSigned(`{{.}}`, old.Sign("y", `{{.}}`), signer); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("got error %v, want ErrBadSignature", err)
+	}
+}
+
+func TestCodecProvider(t *testing.T) {
+	codec, err := NewAESCodec([]byte("0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := codec.Encode("a", `secret {{.}}`)
+	other, _ := codec.Encode("other", `{{.}}`)
+	if strings.Contains(a, "secret") {
+		t.Errorf("the stored text %q isn't encrypted", a)
+	}
+	sources := map[string]string{"a": a, "b": other}
+	tmpl := New("root").SetProvider(CodecProvider(ProviderFunc(func(name string) (string, error) {
+		return sources[name], nil
+	}), codec))
+	if out, err := Must(tmpl.Parse(`{{template "a" 1}}`)).ExecuteString(nil); err != nil || out != "secret 1" {
+		t.Errorf("got %q, %v", out, err)
+	}
+	if _, err := tmpl.Load("b"); err == nil || !strings.Contains(err.Error(), `decode "b"`) {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestCallLimits(t *testing.T) {
+	fm := FuncMap{"fetch_a": strings.ToUpper, "fetch_b": strings.ToUpper, "cheap": strings.ToLower}
+	tmpl := Must(New("x").Funcs(fm).Parse(`{{range .}}{{fetch_a .}}{{fetch_b .}}{{cheap .}}{{end}}`))
+	executor := func() *Executor {
+		return tmpl.CreateExecutor().SetCallLimits(map[string]int{"fetch_*": 4, "cheap": 3})
+	}
+	if out, err := executor().ExecuteString([]string{"a", "B"}); err != nil || out != "AAaBBb" {
+		t.Errorf("got %q, %v", out, err)
+	}
+	if _, err := executor().ExecuteString([]string{"a", "b", "c"}); err == nil || !strings.Contains(err.Error(), `"fetch_a" called, the functions "fetch_*" more than 4 times`) {
+		t.Errorf("got error %v", err)
+	}
+	tmpl = Must(New("x").Funcs(fm).Parse(`{{range .}}{{cheap .}}{{end}}`))
+	if _, err := executor().ExecuteString([]string{"a", "b", "c", "d"}); err == nil || !strings.Contains(err.Error(), `"cheap" called more than 3 times`) {
+		t.Errorf("got error %v", err)
+	}
+	// The calls of the bound functions and by State.Call count too.
+	fm["indirect"] = func(state *State, name, s string) (r string) {
+		state.Call(name, []any{s}, []any{&r})
+		return
+	}
+	for _, text := range []string{
+		`{{$f := bind "cheap"}}{{range .}}{{call $f .}}{{end}}`,
+		`{{range .}}{{indirect "cheap" .}}{{end}}`,
+	} {
+		tmpl = Must(New("x").Funcs(fm).Parse(text))
+		if out, err := executor().ExecuteString([]string{"a", "b", "c"}); err != nil || out != "abc" {
+			t.Errorf("%s: got %q, %v", text, out, err)
+		}
+		if _, err := executor().ExecuteString([]string{"a", "b", "c", "d"}); err == nil || !strings.Contains(err.Error(), `"cheap" called more than 3 times`) {
+			t.Errorf("%s: got error %v", text, err)
+		}
+	}
+}
+
+func TestMaxFieldDepth(t *testing.T) {
+	type node struct {
+		Name string
+		Next *node
+	}
+	n := &node{Name: "a", Next: &node{Name: "b", Next: &node{Name: "c"}}}
+	var cycle interface{}
+	cycle = &cycle
+	for _, test := range []struct {
+		text string
+		data interface{}
+		want string
+		err  string
+	}{
+		{`{{.Next.Name}}`, n, "b", ""},
+		{`{{.Next.Next.Name}}`, n, "", "field chain .Next.Next.Name deeper than 2"},
+		{`{{with .Next}}{{.Next.Name}}{{end}}`, n, "c", ""},
+		{`{{.X}}`, cycle, "", "reached through more than 2 indirections"},
+	} {
+		out, err := Must(New("x").Parse(test.text)).CreateExecutor().SetMaxFieldDepth(2).ExecuteString(test.data)
+		if test.err == "" && (err != nil || out != test.want) {
+			t.Errorf("%s: got %q, %v, want %q", test.text, out, err, test.want)
+		} else if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s: got error %v, want %q", test.text, err, test.err)
+		}
+	}
+}
+
+func TestPrintCycle(t *testing.T) {
+	type node struct {
+		Name     string
+		Children []interface{}
+	}
+	m := map[string]interface{}{"a": 1}
+	m["self"] = m
+	s := []interface{}{"x", nil}
+	s[1] = s
+	n := &node{Name: "root"}
+	n.Children = []interface{}{n.Children, &node{Name: "leaf"}}
+	n.Children[0] = n.Children
+	for _, test := range []struct {
+		data interface{}
+		want string
+	}{
+		{m, "map[a:1 self:…cycle…]"},
+		{s, "[x …cycle…]"},
+		{n, fmt.Sprintf("{root […cycle… %p]}", n.Children[1])},
+		{map[string]int{"b": 2, "a": 1}, "map[a:1 b:2]"},
+	} {
+		out, err := Must(New("x").Parse(`{{.}}`)).ExecuteString(test.data)
+		if err != nil || out != test.want {
+			t.Errorf("got %q, %v, want %q", out, err, test.want)
+		}
+	}
+}
+
+type okGetter struct{}
+
+func (okGetter) Get(key string) (string, bool) {
+	return strings.ToUpper(key), key != ""
+}
+
+func TestOkDecl(t *testing.T) {
+	fm := FuncMap{
+		"lookup": func(key string) (string, bool) {
+			v, ok := map[string]string{"a": "A", "empty": ""}[key]
+			return v, ok
+		},
+		"getter": func() okGetter { return okGetter{} },
+	}
+	fm["lookupFunc"] = func() interface{} { return fm["lookup"] }
+	for _, test := range []struct {
+		text string
+		want string
+		err  string
+	}{
+		{`{{if $v, $ok := lookup .}}[{{$v}} {{$ok}}]{{else}}none{{end}}`, "[A true]", ""},
+		{`{{$k := "empty"}}{{if $v, $ok := lookup $k}}[{{$v}}]{{else}}none{{end}}`, "[]", ""},
+		{`{{$k := "b"}}{{if $v, $ok := lookup $k}}[{{$v}}]{{else}}none {{$ok}}{{end}}`, "none false", ""},
+		{`{{with $v, $ok := lookup .}}{{.}}{{$v}}{{end}}`, "AA", ""},
+		{`{{$v, $ok := lookup .}}{{$v}} {{$ok}}`, "A true", ""},
+		{`{{$v, $ok := print .}}`, "", `can't declare the value and the ok of print .`},
+		{`{{$v, $ok := "a" | lookup}}{{$v}}`, "A", ""},
+		{`{{$v, $ok := call lookupFunc .}}{{$v}} {{$ok}}`, "A true", ""},
+		{`{{$v, $ok := getter.Get .}}{{$v}} {{$ok}}`, "A true", ""},
+		// The value and the ok must be declared.
+		{`{{lookup .}}`, "", `lookup returns a value and an ok, which must be declared`},
+		{`{{len (lookup .)}}`, "", `lookup returns a value and an ok, which must be declared`},
+		{`{{$v := lookup .}}`, "", `lookup returns a value and an ok, which must be declared`},
+		{`{{$v, $ok := print (lookup .)}}`, "", `lookup returns a value and an ok, which must be declared`},
+		{`{{getter.Get .}}`, "", `Get returns a value and an ok, which must be declared`},
+		{`{{call lookupFunc .}}`, "", `the function returns a value and an ok, which must be declared`},
+	} {
+		out, err := Must(New("x").Funcs(fm).Parse(test.text)).ExecuteString("a")
+		if test.err == "" && (err != nil || out != test.want) {
+			t.Errorf("%s: got %q, %v, want %q", test.text, out, err, test.want)
+		} else if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s: got error %v, want %q", test.text, err, test.err)
+		}
+	}
+	if _, err := New("x").Parse(`{{with $v, $ok := 3}}{{end}}`); err == nil {
+		t.Error("expected error declaring the ok of a constant")
+	}
+}
+
+func TestReturn(t *testing.T) {
+	const defs = `{{define "calc"}}{{$sum := 0}}{{range .}}{{$sum += .}}{{end}}{{return $sum}}ignored{{end}}` +
+		`{{define "text"}}<{{.}}>{{end}}` +
+		`{{define "first"}}{{range .}}{{if gt . 1}}{{return .}}{{end}}{{end}}{{return}}{{end}}`
+	for _, test := range []struct {
+		text string
+		want string
+		err  string
+	}{
+		{`{{$total := template "calc" .}}{{$total}} {{printf "%T" $total}}`, "6 int", ""},
+		{`{{$s := template "text" 1}}{{len $s}}{{$s}}`, "3<1>", ""},
+		{`{{$f := template "first" .}}{{$f}}`, "2", ""},
+		{`{{$f := template "first" slice}}[{{$f}}]`, "[<no value>]", ""},
+		{`{{template "calc" .}}.`, ".", ""},
+		{`a{{return}}b`, "a", ""},
+		{`{{$x := 1}}{{if $y := template "calc" .}}{{$y}}{{end}}`, "6", ""},
+		{`{{$x := template "missing" .}}`, "", `template "missing" not defined`},
+	} {
+		tmpl, err := New("x").Funcs(FuncMap{"slice": func() []int { return nil }}).Parse(test.text + defs)
+		if err != nil {
+			t.Fatalf("%s: %v", test.text, err)
+		}
+		out, err := tmpl.ExecuteString([]int{1, 2, 3})
+		if test.err == "" && (err != nil || out != test.want) {
+			t.Errorf("%s: got %q, %v, want %q", test.text, out, err, test.want)
+		} else if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s: got error %v, want %q", test.text, err, test.err)
+		}
+	}
+	for _, text := range []string{`{{print (template "x")}}`, `{{return $x := 1}}`} {
+		if _, err := New("x").Parse(text); err == nil {
+			t.Errorf("%s: expected error", text)
+		}
+	}
+	tree, err := New("x").Parse(`{{$t := template "calc" .Items}}{{return $t}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tree.Root.String(), `{{$t := template "calc" .Items}}{{return $t}}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestRenderYield(t *testing.T) {
+	const defs = `{{define "card"}}<{{.}}>{{end}}` +
+		`{{define "vars"}}{{$x}}{{end}}` +
+		`{{define "outer"}}{{$y := 2}}{{yield .Inner . "vars:globals"}}{{end}}` +
+		`{{define "inner_x"}}{{$x}}{{end}}` +
+		`{{define "inner_y"}}{{$y}}{{end}}` +
+		`{{define "depth"}}{{depth}}{{end}}` +
+		`{{define "nested"}}{{template "depth"}}{{yield "depth"}}{{end}}` +
+		`{{define "r"}}{{yield "r"}}{{end}}`
+	fm := FuncMap{"depth": func(s *State) int { return s.Depth() }}
+	for _, test := range []struct {
+		text string
+		want string
+		err  string
+	}{
+		{`{{$c := render "card" "a"}}{{$c}}{{len $c}}`, "<a>3", ""},
+		{`{{yield "card" "a"}}`, "<a>", ""},
+		{`{{$x := 1}}{{yield "vars" . "vars:all"}}`, "1", ""},
+		{`{{$x := 1}}{{yield "vars" .}}`, "", "undefined variable: $x"},
+		{`{{$x := 1}}{{yield "outer" (dict "Inner" "inner_x") "vars:all"}}`, "1", ""},
+		{`{{$x := 1}}{{yield "outer" (dict "Inner" "inner_y") "vars:all"}}`, "", "undefined variable: $y"},
+		{`{{yield "nested"}}`, "22", ""},
+		{`{{yield "card" . "vars:some"}}`, "", `yield: invalid option "vars:some"`},
+		{`{{render "card" . 1}}`, "", `render: invalid option 1`},
+		{`{{yield "missing"}}`, "", `template "missing" not defined`},
+		{`{{yield "r"}}`, "", "exceeded maximum nesting of executions (100) in cycle r → r"},
+	} {
+		tmpl := Must(New("x").Funcs(fm).Parse(defs + test.text))
+		out, err := tmpl.ExecuteString(nil)
+		if test.err == "" && (err != nil || out != test.want) {
+			t.Errorf("%s: got %q, %v, want %q", test.text, out, err, test.want)
+		} else if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s: got error %v, want %q", test.text, err, test.err)
+		}
+	}
+}
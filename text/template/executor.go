@@ -1,7 +1,6 @@
 package template
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -21,17 +20,27 @@ type Executor struct {
 	StateOptions
 	parent         *Executor
 	template       *Template
-	funcs          funcs.FuncValues
+	funcs          *funcs.AtomicFuncValues
 	writeError     int
 	Local          LocalData
 	noCaptureError bool
-	Context        context.Context
-	super          *State
-	rawData        func(dst io.Writer) error
+	// Context is the context of the executions by Execute.
+	//
+	// Deprecated: the executors may be shared by concurrent executions; use
+	// ExecuteContext.
+	Context       context.Context
+	super         *State
+	rawData       func(dst io.Writer) error
+	caller        *templateCall // the chain of templates executing this one.
+	outputFilters []OutputFilter
+	file          string   // the file rendered by render_file.
+	session       *Session // the session of Session.Eval.
+	execution     *execution
+	depth         int // the depth of the template invoking this one.
 }
 
 func ExecutorOfRawData(rawData func(dst io.Writer) error) *Executor {
-	return &Executor{rawData: rawData}
+	return &Executor{rawData: rawData, funcs: &funcs.AtomicFuncValues{}}
 }
 
 func (this *Executor) NoCaptureError() {
@@ -83,7 +92,7 @@ func (this *Executor) Parent() *Executor {
 }
 
 func (this *Executor) GetFuncs() funcs.FuncValues {
-	return this.funcs
+	return this.funcs.Load()
 }
 
 func (this *Executor) NewChild() *Executor {
@@ -91,9 +100,21 @@ func (this *Executor) NewChild() *Executor {
 	child.parent = this
 	child.StateOptions = this.StateOptions
 	child.super = this.super
+	child.outputFilters = this.outputFilters
 	return child
 }
 
+// Clone returns a copy of the executor, sharing its parents and functions,
+// with empty local data. Changing the copy doesn't change the executor, so
+// an executor may be cached and cloned for each execution.
+func (this *Executor) Clone() *Executor {
+	clone := *this
+	clone.funcs = funcs.NewAtomicFuncValues(this.funcs.Load())
+	clone.outputFilters = this.outputFilters[:len(this.outputFilters):len(this.outputFilters)]
+	clone.Local = LocalData{}
+	return &clone
+}
+
 func (this *Executor) WriteError() *Executor {
 	if this.writeError != 1 {
 		this = this.NewChild()
@@ -126,7 +147,7 @@ func (this *Executor) FilterFuncs(names ...string) (funcs.FuncValues, error) {
 		var items []funcs.FuncValues
 		e := this
 		for e != nil {
-			items = append(items, e.funcs)
+			items = append(items, e.funcs.Load())
 			e = e.parent
 		}
 		return funcs.NewValues(items...), nil
@@ -142,12 +163,69 @@ func (this *Executor) FilterFuncs(names ...string) (funcs.FuncValues, error) {
 	return fvalues, nil
 }
 
+// AppendFuncs adds the functions to the executor. The executions running
+// keep the functions they started with.
 func (this *Executor) AppendFuncs(funcMaps ...funcs.FuncMap) error {
-	return this.funcs.Append(funcMaps...)
+	return this.funcsHead().Update(func(v *funcs.FuncValues) error {
+		return v.Append(funcMaps...)
+	})
+}
+
+// AppendFuncProvider adds the functions of the provider to the executor,
+// resolved when called. See funcs.FuncProvider.
+func (this *Executor) AppendFuncProvider(p funcs.FuncProvider) *Executor {
+	this.funcsHead().Update(func(v *funcs.FuncValues) error {
+		v.AppendProvider(p)
+		return nil
+	})
+	return this
+}
+
+// AppendFuncsWithPolicy adds the functions to the executor, applying the
+// policy to the functions already found by FindFunc, as the ones of its
+// parents:
+//
+//	err := executor.AppendFuncsWithPolicy(funcs.ErrorOnConflict, funcs.FuncMap{"upper": upper})
+func (this *Executor) AppendFuncsWithPolicy(policy funcs.AppendPolicy, funcMaps ...funcs.FuncMap) error {
+	return this.funcsHead().Update(func(v *funcs.FuncValues) error {
+		all := this.parentFuncs()
+		all.AppendValues(*v)
+		values, err := all.Resolve(policy, funcMaps...)
+		if err == nil && len(values) > 0 {
+			v.AppendValues(funcs.FuncValues{values})
+		}
+		return err
+	})
+}
+
+// AllFuncs returns the layers of the functions of the parents of the
+// executor followed by its own ones, so the functions returned by their Get
+// are the ones found by FindFunc.
+func (this *Executor) AllFuncs() funcs.FuncValues {
+	all := this.parentFuncs()
+	all.AppendValues(this.funcs.Load())
+	return all
+}
+
+func (this *Executor) parentFuncs() (all funcs.FuncValues) {
+	if this.parent != nil {
+		all = this.parent.AllFuncs()
+	}
+	return
+}
+
+// FuncShadowings returns the functions of the executor shadowed by others
+// of the same name, as the functions of the templates shadowing builtins.
+// The layers are the ones of AllFuncs.
+func (this *Executor) FuncShadowings() []funcs.Shadowing {
+	return this.AllFuncs().Shadowings()
 }
 
 func (this *Executor) AppendFuncsValues(funcValues ...funcs.FuncValues) *Executor {
-	this.funcs.AppendValues(funcValues...)
+	this.funcsHead().Update(func(v *funcs.FuncValues) error {
+		v.AppendValues(funcValues...)
+		return nil
+	})
 	return this
 }
 
@@ -170,12 +248,31 @@ func (this *Executor) FuncsValues(funcValues ...funcs.FuncValues) *Executor {
 }
 
 func (this *Executor) SetFuncs(values funcs.FuncValues) *Executor {
-	this.funcs = values
+	this.funcsHead().Store(values)
 	return this
 }
 
+// funcsHead returns the holder of the functions of the executor, creating
+// it for the executors not created by NewExecutor.
+func (this *Executor) funcsHead() *funcs.AtomicFuncValues {
+	if this.funcs == nil {
+		this.funcs = &funcs.AtomicFuncValues{}
+	}
+	return this.funcs
+}
+
+// withFuncs returns a copy of the executor with the values appended to its
+// functions.
+func (this *Executor) withFuncs(values funcs.FuncValues) *Executor {
+	e := *this
+	fv := this.funcs.Load()
+	fv.AppendValues(values)
+	e.funcs = funcs.NewAtomicFuncValues(fv)
+	return &e
+}
+
 func (this *Executor) FindFunc(name string) *funcs.FuncValue {
-	if fn := this.funcs.Get(name); fn != nil {
+	if fn := this.funcs.Load().Get(name); fn != nil {
 		return fn
 	}
 	if this.parent != nil {
@@ -184,10 +281,18 @@ func (this *Executor) FindFunc(name string) *funcs.FuncValue {
 	return nil
 }
 
-func (this *Executor) execute(wr io.Writer, data interface{}) (err error) {
+func (this *Executor) execute(ctx context.Context, wr io.Writer, data interface{}) (err error) {
 	if this.rawData != nil {
 		return this.rawData(wr)
 	}
+	var state *State
+	if max := this.StateOptions.MaxSteps; max > 0 && this.execution == nil {
+		defer func() {
+			if err != nil && state != nil && state.execution.steps > max {
+				err = fmt.Errorf("%w: %v", ErrMaxSteps, err)
+			}
+		}()
+	}
 	if !this.noCaptureError {
 		defer func() {
 			if r := recover(); r != nil {
@@ -221,27 +326,38 @@ func (this *Executor) execute(wr io.Writer, data interface{}) (err error) {
 		}
 	}
 
-	t := this.template
+	t, err := this.selectTemplate(ctx)
+	if err != nil {
+		return err
+	}
 
-	state := &State{
+	state = &State{
 		e:            this,
 		tmpl:         t,
+		calls:        &templateCall{t, this.caller},
 		wr:           wr,
 		vars:         []variable{{"$", value}},
 		global:       this.StateOptions.Global,
 		funcsValue:   make(map[string]*funcs.FuncValue),
-		contextValue: funcs.NewContextValue(this.funcs),
+		contextValue: funcs.NewContextValue(this.funcs.Load()),
 		local:        this.Local,
-		context:      this.Context,
+		context:      ctx,
+		done:         ctx.Done(),
 		data:         data,
 		dataValue:    value,
+		execution:    this.execution,
+		depth:        this.depth,
 	}
-
-	if this.StateOptions.OnNoField == nil {
-		this.StateOptions.OnNoField = func(recorde interface{}, fieldName string) (r interface{}, ok bool) {
-			return
+	if state.execution == nil {
+		state.execution = &execution{}
+		if this.StateOptions.Chunking != nil {
+			state.execution.chunks = &chunkWriter{w: wr}
+			state.wr = state.execution.chunks
 		}
 	}
+	if this.StateOptions.Hydration != nil {
+		state.islands = make(map[string]int)
+	}
 
 	if t.Tree == nil || t.Root == nil {
 		state.errorf("'%s' is an incomplete or empty template", t.Name())
@@ -257,18 +373,95 @@ func (this *Executor) execute(wr io.Writer, data interface{}) (err error) {
 	}, nil)
 	state.funcsValue["_tpl_funcs"] = funcs.NewFuncValue(state.getFuncs, nil)
 	state.funcsValue["_tpl_data_funcs"] = funcs.NewFuncValue(state.dataFuncs, nil)
-	state.funcsValue["set"] = funcs.NewFuncValue(state.local.Set, nil)
-	state.funcsValue["get"] = funcs.NewFuncValue(state.local.Get, nil)
-	state.funcsValue["template_exec"] = funcs.NewFuncValue(state.templateExec, nil)
-	state.funcsValue["tpl_render"] = state.funcsValue["template_exec"]
-	state.funcsValue["tpl_yield"] = funcs.NewFuncValue(state.templateYield, nil)
-	state.funcsValue["trim"] = funcs.NewFuncValue(state.trim, nil)
-	state.funcsValue["join"] = funcs.NewFuncValue(state.join, nil)
-	state.walk(value, t.Root)
+	for name, fun := range state.stateFuncs() {
+		state.funcsValue[name] = funcs.NewFuncValue(fun, nil)
+	}
+	state.funcsValue["template_exec"].Deprecate("use render")
+	state.funcsValue["tpl_render"].Deprecate("use render")
+	state.funcsValue["tpl_yield"].Deprecate("use yield")
+	if this.session != nil {
+		state.vars = append(state.vars, this.session.vars...)
+	}
+	if this.StateOptions.ValidateData {
+		if err = state.validateData(value, nil); err != nil {
+			return
+		}
+	}
+	state.checkRequired(value)
+	state.walkRoot(value)
+	if state.execution.chunks != nil && this.execution == nil {
+		state.yieldChunk()
+	}
+	if this.session != nil {
+		this.session.setVars(state.vars[1:])
+	}
 	return
 }
 
-func (this *Executor) Execute(wr io.Writer, data interface{}, funcs_ ...interface{}) (err error) {
+// stateFuncs returns the functions bound to the state, by name, including
+// the ones enabled by the options of the executor.
+func (this *State) stateFuncs() map[string]interface{} {
+	fm := map[string]interface{}{
+		"set":           this.setLocal,
+		"get":           this.getLocal,
+		"template_exec": this.templateExec,
+		"tpl_render":    this.templateExec,
+		"tpl_yield":     this.templateYield,
+		"trim":          this.trim,
+		"join":          this.join,
+	}
+	if this.e.StateOptions.Eval != nil {
+		fm["eval"] = this.eval
+	}
+	if this.e.StateOptions.Env != nil {
+		fm["env"] = this.env
+	}
+	if this.e.StateOptions.Secrets != nil {
+		fm["secret"] = this.secret
+	}
+	if this.e.StateOptions.Fetch != nil {
+		fm["fetch"] = this.fetch
+		fm["fetch_json"] = this.fetchJSON
+	}
+	return fm
+}
+
+// Execute applies the template to the data, with the Context of the
+// executor, and writes the output to wr. See ExecuteContext.
+func (this *Executor) Execute(wr io.Writer, data interface{}, funcs_ ...interface{}) error {
+	return this.ExecuteContext(this.Context, wr, data, funcs_...)
+}
+
+// ExecuteContext applies the template to the data and writes the output to
+// wr, as Execute, with the context ctx, returned by State.Context and used
+// by the functions fetching data. The execution stops with the error of ctx
+// once it is done. The context isn't kept by the executor, so a shared
+// executor may run concurrent executions with their own contexts.
+func (this *Executor) ExecuteContext(ctx context.Context, wr io.Writer, data interface{}, funcs_ ...interface{}) (err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	defer func() {
+		// The errors of the execution don't unwrap, so the error of the
+		// context is kept apart.
+		if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+			err = fmt.Errorf("%w: %v", ctxErr, err)
+		}
+	}()
+	if secrets := this.StateOptions.Secrets; secrets != nil {
+		defer func() { err = secrets.maskError(err) }()
+	}
+	wr, closeOutput := this.filterOutput(wr)
+	defer closeOutput(&err)
+	if p := this.StateOptions.Profile; p != nil && p.MaxOutputBytes > 0 && this.execution == nil {
+		qw := &quotaWriter{w: wr, max: p.MaxOutputBytes}
+		wr = qw
+		defer func() {
+			if err != nil && qw.full {
+				err = fmt.Errorf("%w: more than %d bytes", ErrOutputTooLarge, qw.max)
+			}
+		}()
+	}
 	ee := this
 
 	if len(funcs_) > 0 {
@@ -305,26 +498,77 @@ func (this *Executor) Execute(wr io.Writer, data interface{}, funcs_ ...interfac
 
 	if data != nil {
 		if dataHaveFuncs, ok := data.(*funcs.DataFuncs); ok {
-			return ee.FuncsValues(dataHaveFuncs.GetFuncValues()).execute(wr, dataHaveFuncs.Data())
+			return ee.FuncsValues(dataHaveFuncs.GetFuncValues()).execute(ctx, wr, dataHaveFuncs.Data())
 		} else if funcs, ok := data.(FuncMap); ok {
-			return ee.Funcs(funcs).execute(wr, nil)
+			return ee.Funcs(funcs).execute(ctx, wr, nil)
 		} else if funcsValues, ok := data.(FuncValues); ok {
-			return ee.FuncsValues(funcsValues).execute(wr, nil)
+			return ee.FuncsValues(funcsValues).execute(ctx, wr, nil)
 		}
 	}
-	err = ee.execute(wr, data)
+	err = ee.execute(ctx, wr, data)
 	return
 }
 
 func (this *Executor) ExecuteString(data interface{}, funcs ...interface{}) (string, error) {
-	var out bytes.Buffer
-	err := this.Execute(&out, data, funcs...)
-	if err != nil {
+	out := getBuffer(this.StateOptions.BufferSize)
+	defer putBuffer(out)
+	if err := this.Execute(out, data, funcs...); err != nil {
 		return "", err
 	}
 	return out.String(), nil
 }
 
+// ExecuteBytes applies the template to the data, as Execute, returning the
+// output. See AppendExecute.
+func (this *Executor) ExecuteBytes(data interface{}, funcs ...interface{}) ([]byte, error) {
+	return this.AppendExecute(nil, data, funcs...)
+}
+
+// AppendExecute applies the template to the data, as Execute, appending the
+// output to dst and returning the extended slice, without copying it as
+// ExecuteString does, so a buffer may be reused along the executions:
+//
+//	buf, err = executor.AppendExecute(buf[:0], data)
+//
+// On errors, dst is returned with its length unchanged.
+func (this *Executor) AppendExecute(dst []byte, data interface{}, funcs ...interface{}) ([]byte, error) {
+	w := appendWriter(dst)
+	if err := this.Execute(&w, data, funcs...); err != nil {
+		return dst, err
+	}
+	return w, nil
+}
+
+// appendWriter is a writer appending to the slice.
+type appendWriter []byte
+
+func (w *appendWriter) Write(p []byte) (int, error) {
+	*w = append(*w, p...)
+	return len(p), nil
+}
+
+func (w *appendWriter) WriteString(s string) (int, error) {
+	*w = append(*w, s...)
+	return len(s), nil
+}
+
+// Check executes the template with the data as Execute, discarding the
+// output, so the errors are detected before writing to the real writer, as
+// a http.ResponseWriter, without buffering the output:
+//
+//	if err := executor.Check(page); err != nil {
+//		http.Error(w, "internal error", http.StatusInternalServerError)
+//		return
+//	}
+//	err := executor.Execute(w, page)
+//
+// The template is executed twice then, so the functions it calls should
+// have no side effects, and the errors of the values changing between the
+// executions, as the fetched ones, may be missed.
+func (this *Executor) Check(data interface{}, funcs ...interface{}) error {
+	return this.Execute(io.Discard, data, funcs...)
+}
+
 func NewExecutor(t *Template, funcMaps ...funcs.FuncMap) *Executor {
 	fv, err := funcs.CreateValuesFunc(funcMaps...)
 	if err != nil {
@@ -332,7 +576,7 @@ func NewExecutor(t *Template, funcMaps ...funcs.FuncMap) *Executor {
 	}
 	return &Executor{
 		template:   t,
-		funcs:      fv,
+		funcs:      funcs.NewAtomicFuncValues(fv),
 		writeError: 0,
 		Local:      LocalData{},
 		Context:    context.Background(),
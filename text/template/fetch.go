@@ -0,0 +1,222 @@
+package template
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sync"
+	"time"
+)
+
+// Defaults of the FetchPolicy.
+const (
+	DefaultFetchTimeout = 5 * time.Second
+	DefaultFetchMaxSize = 1 << 20
+	// DefaultFetchMaxEntries is the default maximum number of cached
+	// responses.
+	DefaultFetchMaxEntries = 1000
+)
+
+// FetchPolicy enables the fetch and fetch_json builtins and restricts the
+// URLs they get. It caches the responses, so a FetchPolicy should be shared
+// by the executions. See Executor.SetFetch.
+type FetchPolicy struct {
+	// Hosts are the hosts of the URLs the templates may get, or their
+	// patterns, as "*.example.com", in the syntax of path.Match.
+	Hosts []string
+	// Timeout is the timeout of the requests. If zero,
+	// DefaultFetchTimeout.
+	Timeout time.Duration
+	// MaxSize is the maximum size of the bodies, in bytes. If zero,
+	// DefaultFetchMaxSize.
+	MaxSize int64
+	// TTL is the duration of the cached responses. If zero, the responses
+	// aren't cached.
+	TTL time.Duration
+	// MaxEntries is the maximum number of cached responses, as the URLs are
+	// chosen by the templates. If zero, DefaultFetchMaxEntries.
+	MaxEntries int
+	// Client does the requests. If nil, http.DefaultClient.
+	Client *http.Client
+
+	mu     sync.Mutex
+	cache  map[string]fetchEntry
+	purged time.Time // the time of the last removal of the expired responses.
+}
+
+// fetchEntry is a cached response body.
+type fetchEntry struct {
+	body    []byte
+	expires time.Time
+}
+
+// SetFetch enables the fetch and fetch_json builtins, restricted by the
+// policy. A nil policy disables them, the default:
+//
+//	{{with fetch_json "https://status.example.com/banner.json"}}{{.message}}{{end}}
+//
+// fetch returns the body of the response to the GET request of the URL,
+// and fetch_json decodes it as JSON. The URLs must be of the HTTP or HTTPS
+// schemes and of the hosts of the policy, as their redirections. The
+// responses whose status isn't 2xx fail.
+func (this *Executor) SetFetch(policy *FetchPolicy) *Executor {
+	this.StateOptions.Fetch = policy
+	return this
+}
+
+// Allowed reports whether the policy allows the URL.
+func (this *FetchPolicy) Allowed(u *url.URL) bool {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	for _, pattern := range this.Hosts {
+		if ok, _ := path.Match(pattern, u.Hostname()); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns the body of the response to the GET request of the URL,
+// cached by the TTL of the policy.
+func (this *FetchPolicy) Get(ctx context.Context, rawURL string) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if !this.Allowed(u) {
+		return nil, fmt.Errorf("URL %q isn't allowed", rawURL)
+	}
+	key := u.String()
+	if this.TTL > 0 {
+		this.mu.Lock()
+		e, ok := this.cache[key]
+		this.mu.Unlock()
+		if ok && time.Now().Before(e.expires) {
+			return e.body, nil
+		}
+	}
+	body, err := this.get(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	if this.TTL > 0 {
+		this.put(key, body)
+	}
+	return body, nil
+}
+
+// put caches the response body of the URL key. The cache being full, or
+// once per TTL, it removes the expired responses, and then any other over
+// MaxEntries.
+func (this *FetchPolicy) put(key string, body []byte) {
+	max := this.MaxEntries
+	if max <= 0 {
+		max = DefaultFetchMaxEntries
+	}
+	now := time.Now()
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.cache == nil {
+		this.cache = map[string]fetchEntry{}
+	}
+	_, ok := this.cache[key]
+	full := !ok && len(this.cache) >= max
+	if full || now.Sub(this.purged) >= this.TTL {
+		this.purged = now
+		for k, e := range this.cache {
+			if !now.Before(e.expires) {
+				delete(this.cache, k)
+			}
+		}
+	}
+	if full {
+		for k := range this.cache {
+			if len(this.cache) < max {
+				break
+			}
+			delete(this.cache, k)
+		}
+	}
+	this.cache[key] = fetchEntry{body, now.Add(this.TTL)}
+}
+
+// get does the request of the URL.
+func (this *FetchPolicy) get(ctx context.Context, u *url.URL) ([]byte, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	timeout, maxSize := this.Timeout, this.MaxSize
+	if timeout == 0 {
+		timeout = DefaultFetchTimeout
+	}
+	if maxSize == 0 {
+		maxSize = DefaultFetchMaxSize
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	client := http.DefaultClient
+	if this.Client != nil {
+		client = this.Client
+	}
+	c := *client
+	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if !this.Allowed(req.URL) {
+			return fmt.Errorf("redirection to %q isn't allowed", req.URL)
+		}
+		if client.CheckRedirect != nil {
+			return client.CheckRedirect(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxSize {
+		return nil, fmt.Errorf("GET %s: body exceeds maximum size of %d bytes", u, maxSize)
+	}
+	return body, nil
+}
+
+// fetch implements the fetch builtin.
+func (this *State) fetch(rawURL string) (string, error) {
+	body, err := this.e.StateOptions.Fetch.Get(this.context, rawURL)
+	if err != nil {
+		return "", fmt.Errorf("fetch: %v", err)
+	}
+	return string(body), nil
+}
+
+// fetchJSON implements the fetch_json builtin.
+func (this *State) fetchJSON(rawURL string) (interface{}, error) {
+	body, err := this.e.StateOptions.Fetch.Get(this.context, rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("fetch_json: %v", err)
+	}
+	var v interface{}
+	if err = json.Unmarshal(body, &v); err != nil {
+		return nil, fmt.Errorf("fetch_json: %s: %v", rawURL, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,95 @@
+package template
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"reflect"
+	"strings"
+)
+
+// ReadFile returns the content of the file of the path, which may be
+// rooted, as "/conf/upstreams.conf". The paths out of the file system, as
+// "../secret", are invalid.
+func (a *Assets) ReadFile(pth string) ([]byte, error) {
+	name, err := openName(pth)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(a.FS, name)
+}
+
+// includeFile returns the content of the file of the path, read from the
+// assets of the execution, as is:
+//
+//	{{include_file "/conf/gzip.conf"}}
+func includeFile(state *State, pth string) (string, error) {
+	assets := state.e.StateOptions.Assets
+	if assets == nil {
+		return "", fmt.Errorf("include_file: %v", errNoAssets)
+	}
+	b, err := assets.ReadFile(pth)
+	if err != nil {
+		return "", fmt.Errorf("include_file: %v", err)
+	}
+	return string(b), nil
+}
+
+// renderFile returns the output of the template of the file of the path,
+// read from the assets of the execution, executed with the data, if given,
+// or the data of the execution:
+//
+//	{{range .Sites}}{{render_file "/sites/site.conf" .}}{{end}}
+//
+// The template is parsed with the delimiters of the executing one, as a
+// template of its own: it may define and invoke its templates, but not
+// invoke those of the executing one. A file rendering itself, directly or
+// through other files, fails reporting the cycle.
+func renderFile(state *State, pth string, data ...reflect.Value) (string, error) {
+	assets := state.e.StateOptions.Assets
+	if assets == nil {
+		return "", fmt.Errorf("render_file: %v", errNoAssets)
+	}
+	if len(data) > 1 {
+		return "", fmt.Errorf("render_file: want one data, got %d", len(data))
+	}
+	b, err := assets.ReadFile(pth)
+	if err != nil {
+		return "", fmt.Errorf("render_file: %v", err)
+	}
+	name, _ := openName(pth)
+	chain := []string{name}
+	for e := state.e; e != nil; e = e.parent {
+		if e.file != "" {
+			chain = append([]string{e.file}, chain...)
+		}
+		if e.file == name {
+			return "", fmt.Errorf("render_file: cycle %s", strings.Join(chain, " → "))
+		}
+	}
+	tmpl := New(name).Delims(state.tmpl.leftDelim, state.tmpl.rightDelim)
+	tmpl.parseMode = state.tmpl.parseMode
+	tmpl.textHooks = state.tmpl.textHooks
+	tmpl.textFilter = state.tmpl.textFilter
+	if _, err = tmpl.Parse(string(b)); err != nil {
+		return "", fmt.Errorf("render_file: %v", err)
+	}
+	calls := state.enterTemplate(tmpl)
+	value := state.dataValue
+	if len(data) == 1 {
+		value = data[0]
+	}
+	executor := tmpl.CreateExecutor()
+	executor.parent = state.e
+	executor.caller = calls.parent
+	executor.depth = state.depth + 1
+	executor.execution = state.execution
+	executor.file = name
+	executor.StateOptions = state.e.StateOptions
+	executor.StateOptions.Global = nil
+	var out bytes.Buffer
+	if err := executor.ExecuteContext(state.context, &out, value); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
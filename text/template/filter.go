@@ -0,0 +1,53 @@
+package template
+
+import "io"
+
+// OutputFilter transforms the output of an execution: it returns the writer
+// receiving the output, which writes the transformed output to w. The
+// writer is closed at the end of the execution, to flush any buffered
+// output.
+type OutputFilter func(w io.Writer) io.WriteCloser
+
+// SetOutputFilter sets the filter of the output of the executor, replacing
+// the filters added before. A nil filter removes them. The templates invoked
+// by the execution write to the filtered output, they aren't filtered
+// separately. See filter.InlineCSS.
+func (this *Executor) SetOutputFilter(filter OutputFilter) *Executor {
+	this.outputFilters = nil
+	if filter != nil {
+		this.outputFilters = []OutputFilter{filter}
+	}
+	return this
+}
+
+// AddOutputFilter adds filters of the output of the executor. The output
+// passes through the filters in the order they were added, as a minifier
+// followed by a gzip compressor, before reaching the destination writer.
+//
+// The filters are closed, from the first to the last, even if the execution
+// fails, so they can flush their output and release their resources.
+func (this *Executor) AddOutputFilter(filters ...OutputFilter) *Executor {
+	this.outputFilters = append(this.outputFilters[:len(this.outputFilters):len(this.outputFilters)], filters...)
+	return this
+}
+
+// filterOutput returns the writer filtering the output to wr and the
+// function closing the filters, that sets err to the first close error
+// unless it is set.
+func (this *Executor) filterOutput(wr io.Writer) (io.Writer, func(err *error)) {
+	if len(this.outputFilters) == 0 {
+		return wr, func(*error) {}
+	}
+	writers := make([]io.WriteCloser, len(this.outputFilters))
+	for i := len(this.outputFilters) - 1; i >= 0; i-- {
+		writers[i] = this.outputFilters[i](wr)
+		wr = writers[i]
+	}
+	return wr, func(err *error) {
+		for _, w := range writers {
+			if cerr := w.Close(); *err == nil {
+				*err = cerr
+			}
+		}
+	}
+}
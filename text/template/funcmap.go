@@ -1,3 +1,38 @@
 package template
 
+import "github.com/moisespsena-go/umbu/funcs"
+
+// DefaultFuncMap are the functions of all the executions, overriding any
+// other function of the same name.
+//
+// Deprecated: it isn't safe to change while executing; use
+// RegisterGlobalFuncs.
 var DefaultFuncMap = map[string]interface{}{}
+
+// globalFuncs are the functions registered by RegisterGlobalFuncs.
+var globalFuncs = funcs.NewAtomicFuncValues(nil)
+
+// RegisterGlobalFuncs adds the functions of the maps to the ones of the
+// executors created after, by CreateExecutor, of the templates of any
+// package, as the helpers of an application registered once:
+//
+//	func init() {
+//		template.RegisterGlobalFuncs(template.FuncMap{"money": formatMoney})
+//	}
+//
+// The global functions override the builtins of the same name, except the
+// ones bound to the execution, as set and get, and are overridden by the
+// functions of the templates and of the executors. The functions registered
+// later override the ones registered before. It panics if a value isn't a
+// valid function, as Template.Funcs. It's safe to call concurrently with
+// the executions, the executors created before keeping their functions.
+func RegisterGlobalFuncs(funcMaps ...funcs.FuncMap) {
+	fv, err := funcs.CreateValuesFunc(funcMaps...)
+	if err != nil {
+		panic(err)
+	}
+	globalFuncs.Update(func(v *funcs.FuncValues) error {
+		v.AppendValues(fv)
+		return nil
+	})
+}
@@ -0,0 +1,103 @@
+package template
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// GridPage is a page of the grid builtin, with its rows of items.
+type GridPage struct {
+	// Number is the number of the page, from 1.
+	Number int
+	// Total is the number of pages.
+	Total int
+	// Offset is the index, in the list, of the first item of the page.
+	Offset int
+	// Rows are the rows of the items of the page. The last row of the last
+	// page has the remaining items, unless filled.
+	Rows [][]interface{}
+	// IsFirst and IsLast tell the first and the last pages.
+	IsFirst, IsLast bool
+}
+
+// Len returns the number of items of the page.
+func (p *GridPage) Len() (n int) {
+	for _, row := range p.Rows {
+		n += len(row)
+	}
+	return
+}
+
+// BreakBefore reports whether a page break comes before the page, so it
+// isn't the first one:
+//
+//	<div{{if .BreakBefore}} style="page-break-before: always"{{end}}>
+func (p *GridPage) BreakBefore() bool {
+	return !p.IsFirst
+}
+
+// BreakAfter reports whether a page break comes after the page, so it
+// isn't the last one.
+func (p *GridPage) BreakAfter() bool {
+	return !p.IsLast
+}
+
+// grid distributes the items of the list in pages of rows by cols items,
+// the last row of the last page having the remaining items, filled up to
+// cols with the fill value, if given:
+//
+//	{{range grid .Labels 8 3}}
+//	  <table{{if .BreakAfter}} style="page-break-after: always"{{end}}>
+//	    {{range .Rows}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>{{end}}
+//	  </table>
+//	{{end}}
+//
+// An empty list has no pages.
+func grid(list, rows, cols reflect.Value, fill ...reflect.Value) ([]*GridPage, error) {
+	list, err := listArg("grid", list)
+	if err != nil {
+		return nil, err
+	}
+	r, err := sizeArg("grid", rows)
+	if err != nil {
+		return nil, err
+	}
+	c, err := sizeArg("grid", cols)
+	if err != nil {
+		return nil, err
+	}
+	var fillValue interface{}
+	switch len(fill) {
+	case 0:
+	case 1:
+		if fill := indirectInterface(fill[0]); fill.IsValid() {
+			fillValue = fill.Interface()
+		}
+	default:
+		return nil, fmt.Errorf("grid: want one fill value, got %d", len(fill))
+	}
+	n, perPage := list.Len(), r*c
+	total := (n + perPage - 1) / perPage
+	pages := make([]*GridPage, total)
+	for i := range pages {
+		page := &GridPage{
+			Number:  i + 1,
+			Total:   total,
+			Offset:  i * perPage,
+			IsFirst: i == 0,
+			IsLast:  i == total-1,
+		}
+		for j := page.Offset; j < n && j < page.Offset+perPage; j += c {
+			row := make([]interface{}, 0, c)
+			for k := j; k < n && k < j+c; k++ {
+				row = append(row, list.Index(k).Interface())
+			}
+			for len(fill) > 0 && len(row) < c {
+				row = append(row, fillValue)
+			}
+			page.Rows = append(page.Rows, row)
+		}
+		pages[i] = page
+	}
+	return pages, nil
+}
@@ -0,0 +1,173 @@
+package template
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/moisespsena-go/umbu/cast"
+)
+
+// Group is a group of items of the group_by builtin, with the same key.
+type Group struct {
+	Key   interface{}
+	Items []interface{}
+}
+
+// Len returns the number of items.
+func (g *Group) Len() int {
+	return len(g.Items)
+}
+
+// groupOrder is the order of the groups of the group_by builtin.
+type groupOrder struct {
+	by    string
+	field sortKey
+	desc  bool
+}
+
+// parseGroupOrder parses the order of the group_by builtin: key, count, or
+// sum, avg, min or max followed by the field path, and then asc or desc.
+func parseGroupOrder(spec string) (order groupOrder, err error) {
+	words := strings.Fields(spec)
+	if len(words) == 0 {
+		return order, fmt.Errorf("group_by: empty order")
+	}
+	order.by, words = strings.ToLower(words[0]), words[1:]
+	switch order.by {
+	case "key", "count":
+	case "sum", "avg", "min", "max":
+		if len(words) == 0 {
+			return order, fmt.Errorf("group_by: order %q: want a field", spec)
+		}
+		if order.field, err = parseSortKey("group_by", words[0]); err != nil {
+			return
+		}
+		words = words[1:]
+	default:
+		return order, fmt.Errorf("group_by: order %q: invalid %q", spec, order.by)
+	}
+	switch {
+	case len(words) == 0:
+	case len(words) == 1 && strings.EqualFold(words[0], "asc"):
+	case len(words) == 1 && strings.EqualFold(words[0], "desc"):
+		order.desc = true
+	default:
+		return order, fmt.Errorf("group_by: order %q: invalid options %q", spec, strings.Join(words, " "))
+	}
+	return
+}
+
+// aggregate returns the value of the order of the group.
+func (o groupOrder) aggregate(g *Group) (float64, error) {
+	if o.by == "count" {
+		return float64(len(g.Items)), nil
+	}
+	var result float64
+	for i, item := range g.Items {
+		v, err := o.field.value(reflect.ValueOf(item))
+		if err != nil {
+			return 0, err
+		}
+		var f float64
+		if v.IsValid() {
+			if f, err = cast.ToFloat(v.Interface()); err != nil {
+				return 0, err
+			}
+		}
+		switch {
+		case o.by == "sum" || o.by == "avg":
+			result += f
+		case i == 0, o.by == "min" && f < result, o.by == "max" && f > result:
+			result = f
+		}
+	}
+	if o.by == "avg" && len(g.Items) > 0 {
+		result /= float64(len(g.Items))
+	}
+	return result, nil
+}
+
+// groupBy returns the groups of the items of the list with the same value
+// of the key, the field path or "." for the item itself, in the order of
+// their first items:
+//
+//	{{range group_by .Orders "Day"}}
+//	  <h2>{{.Key}}</h2>
+//	  {{range .Items}}...{{end}}
+//	{{end}}
+//
+// The order, if given, sorts the groups by key, by count of items or by the
+// sum, avg, min or max of the field of their items, ascending or desc:
+//
+//	{{range group_by .Orders "Customer.Name" "sum Total desc"}}...{{end}}
+func groupBy(list reflect.Value, key string, order ...string) ([]*Group, error) {
+	list, err := listArg("group_by", list)
+	if err != nil {
+		return nil, err
+	}
+	if len(strings.Fields(key)) != 1 {
+		return nil, fmt.Errorf("group_by: invalid key %q", key)
+	}
+	field, _ := parseSortKey("group_by", key)
+	var (
+		groups []*Group
+		index  = map[interface{}]*Group{}
+	)
+	for i := 0; i < list.Len(); i++ {
+		item := list.Index(i)
+		v, err := field.value(item)
+		if err != nil {
+			return nil, fmt.Errorf("group_by: %v", err)
+		}
+		var k interface{}
+		if v.IsValid() {
+			if !v.Type().Comparable() {
+				return nil, fmt.Errorf("group_by: key %s isn't comparable", v.Type())
+			}
+			k = v.Interface()
+		}
+		g := index[k]
+		if g == nil {
+			g = &Group{Key: k}
+			index[k] = g
+			groups = append(groups, g)
+		}
+		g.Items = append(g.Items, item.Interface())
+	}
+	switch len(order) {
+	case 0:
+		return groups, nil
+	case 1:
+	default:
+		return nil, fmt.Errorf("group_by: want one order, got %d", len(order))
+	}
+	o, err := parseGroupOrder(order[0])
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[*Group]reflect.Value, len(groups))
+	for _, g := range groups {
+		if o.by == "key" {
+			values[g] = reflect.ValueOf(g.Key)
+			continue
+		}
+		f, err := o.aggregate(g)
+		if err != nil {
+			return nil, fmt.Errorf("group_by: order %q: %v", order[0], err)
+		}
+		values[g] = reflect.ValueOf(f)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if err != nil {
+			return false
+		}
+		var c int
+		if c, err = (sortKey{}).compare(values[groups[i]], values[groups[j]]); err != nil {
+			err = fmt.Errorf("group_by: order %q: %v", order[0], err)
+		}
+		return c != 0 && c < 0 != o.desc
+	})
+	return groups, err
+}
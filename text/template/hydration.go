@@ -0,0 +1,101 @@
+package template
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Hydration marks the boundaries of the components rendered by an
+// execution, the templates invoked by the template action that a frontend
+// runtime hydrates as islands. See Executor.SetHydration.
+//
+// The output of each component is wrapped in the comments
+//
+//	<!--umbu:island ID PROPS-->...<!--/umbu:island ID-->
+//
+// where ID is the name of the template followed by the number of its
+// invocation in the execution, as "card-2", and PROPS is the JSON encoding
+// of the props of the invocation: its data, or, if the template has
+// arguments, an object of the arguments, by name, and of the data, by ".".
+// The markers contain no "--" nor ">", so they can't end the comments.
+//
+// The components must be invoked in the text of HTML documents.
+type Hydration struct {
+	// Components are the names of the templates marked.
+	Components []string
+	// Prefix replaces "umbu" as the prefix of the markers.
+	Prefix string
+}
+
+// SetHydration sets the marking of the components rendered by the
+// execution. A nil hydration disables it.
+func (this *Executor) SetHydration(hydration *Hydration) *Executor {
+	this.StateOptions.Hydration = hydration
+	return this
+}
+
+// component reports whether the template named name is a component.
+func (h *Hydration) component(name string) bool {
+	for _, c := range h.Components {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Hydration) prefix() string {
+	if h.Prefix != "" {
+		return h.Prefix
+	}
+	return "umbu"
+}
+
+// commentSafe escapes the sequences of s that may end an HTML comment.
+func commentSafe(s string) string {
+	return strings.NewReplacer("--", `-\u002d`, ">", `\u003e`).Replace(s)
+}
+
+// walkComponent walks the template tmpl invoked by the state with the
+// arguments, wrapping its output in the hydration markers if it is a
+// component.
+func (this *State) walkComponent(dot reflect.Value, tmpl *Template, args []variable, walk func()) {
+	hydration := this.e.StateOptions.Hydration
+	if hydration == nil || !hydration.component(tmpl.name) {
+		walk()
+		return
+	}
+	this.islands[tmpl.name]++
+	id := commentSafe(fmt.Sprintf("%s-%d", tmpl.name, this.islands[tmpl.name]))
+
+	var props interface{}
+	if dot.IsValid() && dot.CanInterface() {
+		props = dot.Interface()
+	}
+	if len(args) > 0 {
+		m := map[string]interface{}{".": props}
+		for _, arg := range args {
+			var v interface{}
+			if arg.value.IsValid() && arg.value.CanInterface() {
+				v = arg.value.Interface()
+			}
+			m[strings.TrimPrefix(arg.name, "$")] = v
+		}
+		props = m
+	}
+	b, err := json.Marshal(props)
+	if err != nil {
+		this.errorf("component %q: props: %v", tmpl.name, err)
+	}
+
+	prefix := hydration.prefix()
+	if _, err = fmt.Fprintf(this.wr, "<!--%s:island %s %s-->", prefix, id, commentSafe(string(b))); err != nil {
+		this.writeError(err)
+	}
+	walk()
+	if _, err = fmt.Fprintf(this.wr, "<!--/%s:island %s-->", prefix, id); err != nil {
+		this.writeError(err)
+	}
+}
@@ -0,0 +1,208 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/moisespsena-go/umbu/color"
+)
+
+// Assets is the file system of the files read by the templates, as the
+// images of the image_size and image_color builtins. It caches the
+// metadata of the files, so an Assets should be shared by the executions.
+type Assets struct {
+	FS fs.FS
+
+	mu     sync.Mutex
+	images map[string]*imageEntry
+}
+
+// NewAssets returns the assets of the file system.
+func NewAssets(fsys fs.FS) *Assets {
+	return &Assets{FS: fsys, images: map[string]*imageEntry{}}
+}
+
+// SetAssets sets the assets of the execution.
+func (this *Executor) SetAssets(assets *Assets) *Executor {
+	this.StateOptions.Assets = assets
+	return this
+}
+
+// ImageInfo is the metadata of an image, returned by the image_size
+// builtin.
+type ImageInfo struct {
+	Width, Height int
+	// Format is the name of the format, as "png", "jpeg" or "gif".
+	Format string
+}
+
+// imageEntry is the cached metadata of an image, valid while the
+// modification time and the size of the file are the same.
+type imageEntry struct {
+	modTime time.Time
+	size    int64
+	info    ImageInfo
+	color   *color.Color
+}
+
+// openName returns the name of the file system of the path, which may be
+// rooted, as "/img/logo.png".
+func openName(pth string) (string, error) {
+	name := path.Clean(strings.TrimPrefix(pth, "/"))
+	if !fs.ValidPath(name) || name == "." {
+		return "", fmt.Errorf("invalid path %q", pth)
+	}
+	return name, nil
+}
+
+// entry returns the cached entry of the image, reading its metadata if the
+// file was changed.
+func (a *Assets) entry(pth string) (*imageEntry, string, error) {
+	name, err := openName(pth)
+	if err != nil {
+		return nil, "", err
+	}
+	stat, err := fs.Stat(a.FS, name)
+	if err != nil {
+		return nil, "", err
+	}
+	a.mu.Lock()
+	e := a.images[name]
+	a.mu.Unlock()
+	if e != nil && e.modTime.Equal(stat.ModTime()) && e.size == stat.Size() {
+		return e, name, nil
+	}
+
+	f, err := a.FS.Open(name)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	cfg, format, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil, "", fmt.Errorf("image %q: %v", pth, err)
+	}
+	e = &imageEntry{
+		modTime: stat.ModTime(),
+		size:    stat.Size(),
+		info:    ImageInfo{Width: cfg.Width, Height: cfg.Height, Format: format},
+	}
+	a.mu.Lock()
+	if a.images == nil {
+		a.images = map[string]*imageEntry{}
+	}
+	a.images[name] = e
+	a.mu.Unlock()
+	return e, name, nil
+}
+
+// Image returns the metadata of the image of the path.
+func (a *Assets) Image(pth string) (ImageInfo, error) {
+	e, _, err := a.entry(pth)
+	if err != nil {
+		return ImageInfo{}, err
+	}
+	return e.info, nil
+}
+
+// DominantColor returns the most frequent color of the image of the path,
+// the colors being grouped by their 4 most significant bits.
+func (a *Assets) DominantColor(pth string) (color.Color, error) {
+	e, name, err := a.entry(pth)
+	if err != nil {
+		return color.Color{}, err
+	}
+	a.mu.Lock()
+	c := e.color
+	a.mu.Unlock()
+	if c != nil {
+		return *c, nil
+	}
+
+	f, err := a.FS.Open(name)
+	if err != nil {
+		return color.Color{}, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return color.Color{}, fmt.Errorf("image %q: %v", pth, err)
+	}
+	dominant := dominantColor(img)
+	a.mu.Lock()
+	e.color = &dominant
+	a.mu.Unlock()
+	return dominant, nil
+}
+
+// dominantColor returns the average color of the most frequent group of
+// colors of at most 128x128 pixels of the image.
+func dominantColor(img image.Image) color.Color {
+	type bucket struct {
+		n          int
+		r, g, b, a uint64
+	}
+	var (
+		buckets = map[uint16]*bucket{}
+		best    *bucket
+		bounds  = img.Bounds()
+		stepX   = bounds.Dx()/128 + 1
+		stepY   = bounds.Dy()/128 + 1
+	)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += stepY {
+		for x := bounds.Min.X; x < bounds.Max.X; x += stepX {
+			r, g, b, a := img.At(x, y).RGBA()
+			key := uint16(r>>12)<<12 | uint16(g>>12)<<8 | uint16(b>>12)<<4 | uint16(a>>12)
+			bk := buckets[key]
+			if bk == nil {
+				bk = &bucket{}
+				buckets[key] = bk
+			}
+			bk.n++
+			bk.r, bk.g, bk.b, bk.a = bk.r+uint64(r>>8), bk.g+uint64(g>>8), bk.b+uint64(b>>8), bk.a+uint64(a>>8)
+			if best == nil || bk.n > best.n {
+				best = bk
+			}
+		}
+	}
+	if best == nil {
+		return color.Color{}
+	}
+	n := uint64(best.n)
+	return color.Color{R: uint8(best.r / n), G: uint8(best.g / n), B: uint8(best.b / n), A: uint8(best.a / n)}
+}
+
+// errNoAssets is returned by the image builtins if the execution has no
+// assets.
+var errNoAssets = errors.New("no assets; see Executor.SetAssets")
+
+// imageSize returns the metadata of the image of the path, read from the
+// assets of the execution:
+//
+//	{{with image_size "/img/logo.png"}}width="{{.Width}}" height="{{.Height}}"{{end}}
+func imageSize(state *State, pth string) (ImageInfo, error) {
+	assets := state.e.StateOptions.Assets
+	if assets == nil {
+		return ImageInfo{}, fmt.Errorf("image_size: %v", errNoAssets)
+	}
+	return assets.Image(pth)
+}
+
+// imageColor returns the dominant color of the image of the path, read
+// from the assets of the execution, as a placeholder while the image loads.
+func imageColor(state *State, pth string) (color.Color, error) {
+	assets := state.e.StateOptions.Assets
+	if assets == nil {
+		return color.Color{}, fmt.Errorf("image_color: %v", errNoAssets)
+	}
+	return assets.DominantColor(pth)
+}
@@ -0,0 +1,10 @@
+// Package nodeplan lets the executor of text/template cache its analysis of
+// the commands on the command nodes of text/template/parse, without
+// exporting the cache from the nodes.
+package nodeplan
+
+import "sync/atomic"
+
+// Plan returns the cache of the analysis of the command node cmd, a
+// *parse.CommandNode. It is set by package parse.
+var Plan func(cmd interface{}) *atomic.Value
@@ -0,0 +1,150 @@
+package template
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// inheritance is the variables inherited by the templates invoked by the
+// render and yield builtins.
+type inheritance int
+
+const (
+	// inheritNone inherits no variables, as {{template}}.
+	inheritNone inheritance = iota
+	// inheritGlobals inherits the variables inherited by the invoking
+	// template.
+	inheritGlobals
+	// inheritAll inherits the variables inherited by the invoking template
+	// and the ones in scope at the call.
+	inheritAll
+)
+
+// maxNestedExecutions is the maximum nesting of the templates executed in
+// the execution of the invoking one, as by render or yield. Each nesting
+// holds an executor, a state and, for render, the buffer of its output,
+// and grows the stack by the frames of a whole execution, some thousand
+// times the ones of a {{template}} invocation, so the nesting is limited to
+// the share of maxExecDepth taking about as much memory.
+const maxNestedExecutions = maxExecDepth / 1000
+
+var inheritances = map[string]inheritance{
+	"none":    inheritNone,
+	"globals": inheritGlobals,
+	"all":     inheritAll,
+}
+
+// render returns the output of the template named name, executed with dot
+// set to the data, if any:
+//
+//	{{$card := render "card" .User}}
+//	{{$card := render "card" .User "vars:all"}}
+//
+// The options follow the data. The option "vars:none", the default, lets
+// the template inherit no variables, as {{template}}; "vars:globals" the
+// variables inherited by the invoking template; and "vars:all" these and
+// the variables in scope at the call.
+//
+// The template executes in the execution of the invoking one: its depth
+// and its cycles count, as the ones of {{template}}, and the limits of the
+// execution apply to it.
+//
+// In html/template, the name must be a constant: the template is escaped in
+// the HTML text context and the result is HTML.
+func render(state *State, name string, args ...reflect.Value) (string, error) {
+	data, inherit, err := invokeArgs("render", args)
+	if err != nil {
+		return "", err
+	}
+	w := state.buffer()
+	defer putBuffer(w)
+	if err = state.execTemplate(w, name, data, inherit); err != nil {
+		return "", err
+	}
+	return w.String(), nil
+}
+
+// yield writes the output of the template named name, executed with dot
+// set to the data, if any, as {{template}}, but with a name evaluated on
+// execution and the options of render:
+//
+//	{{yield .Widget.Template .Widget "vars:globals"}}
+//
+// In html/template, the name must be a constant and yield the only command
+// of an action in the HTML text context, where the template is escaped as
+// by {{template}}; in json/template, the only command of an action, in any
+// JSON context.
+func yield(state *State, name string, args ...reflect.Value) error {
+	data, inherit, err := invokeArgs("yield", args)
+	if err != nil {
+		return err
+	}
+	return state.execTemplate(state.wr, name, data, inherit)
+}
+
+// invokeArgs returns the data and the inheritance of the options of the
+// builtin invoking a template.
+func invokeArgs(builtin string, args []reflect.Value) (data reflect.Value, inherit inheritance, err error) {
+	if len(args) > 0 {
+		data, args = args[0], args[1:]
+	}
+	for _, arg := range args {
+		arg = indirectInterface(arg)
+		if arg.Kind() != reflect.String {
+			return data, inherit, fmt.Errorf("%s: invalid option %v", builtin, arg)
+		}
+		key, value, _ := strings.Cut(arg.String(), ":")
+		i, ok := inheritances[value]
+		if key != "vars" || !ok {
+			return data, inherit, fmt.Errorf("%s: invalid option %q", builtin, arg.String())
+		}
+		inherit = i
+	}
+	return
+}
+
+// execTemplate executes the template named name in the execution of this
+// one, with dot set to data and the variables inherited, writing its output
+// to w. The errors of the template are returned, not panicked through the
+// builtin invoking it.
+func (this *State) execTemplate(w io.Writer, name string, data reflect.Value, inherit inheritance) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(error)
+			if !ok || e == errExit || IsFatal(e) {
+				panic(r)
+			}
+			err = e
+		}
+	}()
+	tmpl := this.lookupTemplate(name)
+	calls := this.enterTemplate(tmpl)
+	if this.execution.nested == maxNestedExecutions {
+		if cycle := this.calls.cycle(tmpl); cycle != "" {
+			this.errorf("exceeded maximum nesting of executions (%v) in cycle %s", maxNestedExecutions, cycle)
+		}
+		this.errorf("exceeded maximum nesting of executions (%v)", maxNestedExecutions)
+	}
+	this.execution.nested++
+	defer func() { this.execution.nested-- }()
+
+	executor := tmpl.CreateExecutor()
+	executor.noCaptureError = true
+	executor.parent = this.e
+	executor.caller = calls.parent
+	executor.depth = this.depth + 1
+	executor.execution = this.execution
+	executor.StateOptions = this.e.StateOptions
+	switch inherit {
+	case inheritNone:
+		executor.StateOptions.Global = nil
+	case inheritGlobals:
+		executor.StateOptions.Global = this.global
+	case inheritAll:
+		global := make([]variable, 0, len(this.global)+len(this.vars))
+		executor.StateOptions.Global = append(append(global, this.global...), this.vars...)
+	}
+	return executor.ExecuteContext(this.context, w, data)
+}
@@ -16,11 +16,11 @@ type wrapWriter struct {
 	begin   func(w io.Writer)
 	noEmpty bool
 	strip   bool
-	buf     bytes.Buffer
+	buf     *bytes.Buffer // the leading spaces, written before the first text.
 }
 
 func NewWrapWriter(w io.Writer, begin func(w io.Writer), strip bool) *wrapWriter {
-	return &wrapWriter{w: w, begin: begin, strip: strip}
+	return &wrapWriter{w: w, begin: begin, strip: strip, buf: new(bytes.Buffer)}
 }
 
 func (w *wrapWriter) BeginHandler() func(w io.Writer) {
@@ -0,0 +1,48 @@
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// jsonLine returns the JSON Lines (NDJSON) line of the value: its compact
+// JSON encoding followed by a newline, for the data exports:
+//
+//	{{- range .Orders}}{{json_line (dict "id" .ID "total" .Total)}}{{end -}}
+//
+// The newlines of the strings are escaped, so the line is the value, and
+// every line ends with a newline, the last one as well, as JSON Lines
+// requires. The characters special in HTML, as '<', aren't escaped.
+func jsonLine(v interface{}) (string, error) {
+	var b bytes.Buffer
+	if err := encodeJSONLine(&b, v); err != nil {
+		return "", fmt.Errorf("json_line: %v", err)
+	}
+	return b.String(), nil
+}
+
+// jsonLines returns the JSON Lines of the items of the list, each one as by
+// json_line:
+//
+//	{{json_lines .Orders}}
+func jsonLines(list reflect.Value) (string, error) {
+	list, err := listArg("json_lines", list)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	for i := 0; i < list.Len(); i++ {
+		if err := encodeJSONLine(&b, list.Index(i).Interface()); err != nil {
+			return "", fmt.Errorf("json_lines: item %d: %v", i, err)
+		}
+	}
+	return b.String(), nil
+}
+
+func encodeJSONLine(b *bytes.Buffer, v interface{}) error {
+	enc := json.NewEncoder(b)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(v)
+}
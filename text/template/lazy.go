@@ -0,0 +1,248 @@
+package template
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/moisespsena-go/umbu"
+)
+
+// sourceArg returns the source argument of the builtin, a slice, an array
+// or, read lazily, an umbu.Iterator or umbu.IteratorGetter.
+func sourceArg(name string, src reflect.Value) (reflect.Value, umbu.Iterator, error) {
+	src, isNil := indirect(indirectInterface(src))
+	if isNil || !src.IsValid() {
+		return reflect.Value{}, nil, nil
+	}
+	switch src.Kind() {
+	case reflect.Array, reflect.Slice:
+		return src, nil, nil
+	case reflect.Struct:
+		if it := iteratorOf(src); it != nil {
+			return reflect.Value{}, it, nil
+		}
+	}
+	return reflect.Value{}, nil, fmt.Errorf("%s: want a list or an iterator, got %s", name, src.Type())
+}
+
+// each calls f with the items of the list or of the iterator until it
+// returns false.
+func each(list reflect.Value, it umbu.Iterator, f func(item reflect.Value) bool) {
+	if it != nil {
+		for state := it.Start(); !it.Done(state); {
+			var item interface{}
+			if item, state = it.Next(state); !f(reflect.ValueOf(item)) {
+				return
+			}
+		}
+		return
+	}
+	for i := 0; list.IsValid() && i < list.Len(); i++ {
+		if !f(list.Index(i)) {
+			return
+		}
+	}
+}
+
+// lazyState is the state of the take and skip iterators.
+type lazyState struct {
+	state interface{}
+	i     int
+}
+
+// takeIterator reads up to n items of an iterator.
+type takeIterator struct {
+	it umbu.Iterator
+	n  int
+}
+
+func (t *takeIterator) Start() interface{} {
+	return lazyState{t.it.Start(), 0}
+}
+
+func (t *takeIterator) Done(state interface{}) bool {
+	s := state.(lazyState)
+	return s.i >= t.n || t.it.Done(s.state)
+}
+
+func (t *takeIterator) Next(state interface{}) (item, nextState interface{}) {
+	s := state.(lazyState)
+	item, next := t.it.Next(s.state)
+	return item, lazyState{next, s.i + 1}
+}
+
+// skipIterator skips the first n items of an iterator.
+type skipIterator struct {
+	it umbu.Iterator
+	n  int
+}
+
+func (s *skipIterator) Start() interface{} {
+	state := s.it.Start()
+	for i := 0; i < s.n && !s.it.Done(state); i++ {
+		_, state = s.it.Next(state)
+	}
+	return state
+}
+
+func (s *skipIterator) Done(state interface{}) bool {
+	return s.it.Done(state)
+}
+
+func (s *skipIterator) Next(state interface{}) (item, nextState interface{}) {
+	return s.it.Next(state)
+}
+
+// countArg returns the count argument of the builtin, a non negative
+// integer.
+func countArg(name string, n int) (int, error) {
+	if n < 0 {
+		return 0, fmt.Errorf("%s: negative count %d", name, n)
+	}
+	return n, nil
+}
+
+// take returns the first n items of the list, or an iterator reading the
+// first n items of the iterator, so only those are read:
+//
+//	{{range .Items | take 5}}...{{end}}
+func take(n int, src reflect.Value) (reflect.Value, error) {
+	n, err := countArg("take", n)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	list, it, err := sourceArg("take", src)
+	switch {
+	case err != nil:
+		return reflect.Value{}, err
+	case it != nil:
+		return reflect.ValueOf(&takeIterator{it, n}), nil
+	case !list.IsValid():
+		return reflect.ValueOf([]interface{}(nil)), nil
+	}
+	if n > list.Len() {
+		n = list.Len()
+	}
+	return sliceOf(list, 0, n), nil
+}
+
+// skip returns the list without its first n items, or an iterator
+// skipping the first n items of the iterator.
+func skip(n int, src reflect.Value) (reflect.Value, error) {
+	n, err := countArg("skip", n)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	list, it, err := sourceArg("skip", src)
+	switch {
+	case err != nil:
+		return reflect.Value{}, err
+	case it != nil:
+		return reflect.ValueOf(&skipIterator{it, n}), nil
+	case !list.IsValid():
+		return reflect.ValueOf([]interface{}(nil)), nil
+	}
+	if n > list.Len() {
+		n = list.Len()
+	}
+	return sliceOf(list, n, list.Len()), nil
+}
+
+// sliceOf returns the items of the list from i to j, copying the arrays
+// which aren't addressable.
+func sliceOf(list reflect.Value, i, j int) reflect.Value {
+	if list.Kind() == reflect.Slice || list.CanAddr() {
+		return list.Slice(i, j)
+	}
+	s := reflect.MakeSlice(reflect.SliceOf(list.Type().Elem()), j-i, j-i)
+	for k := i; k < j; k++ {
+		s.Index(k - i).Set(list.Index(k))
+	}
+	return s
+}
+
+// first returns the first item of the list or of the iterator, or nil if
+// it's empty.
+func first(src reflect.Value) (item interface{}, err error) {
+	list, it, err := sourceArg("first", src)
+	if err != nil {
+		return nil, err
+	}
+	each(list, it, func(v reflect.Value) bool {
+		item = valueInterface(v)
+		return false
+	})
+	return
+}
+
+// last returns the last item of the list or of the iterator, or nil if it's
+// empty. The items of the iterator are read up to the last.
+func last(src reflect.Value) (item interface{}, err error) {
+	list, it, err := sourceArg("last", src)
+	if err != nil || it == nil && (!list.IsValid() || list.Len() == 0) {
+		return nil, err
+	}
+	if it == nil {
+		return valueInterface(list.Index(list.Len() - 1)), nil
+	}
+	each(list, it, func(v reflect.Value) bool {
+		item = valueInterface(v)
+		return true
+	})
+	return
+}
+
+// valueInterface returns the value of v, or nil if it's invalid.
+func valueInterface(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	return v.Interface()
+}
+
+// itemTrue returns whether the item, or its field, is true.
+func itemTrue(name string, item reflect.Value, field []string) (bool, error) {
+	switch len(field) {
+	case 0:
+		return truth(item), nil
+	case 1:
+		v, ok, err := fieldOf(item, field[0])
+		if err != nil {
+			return false, fmt.Errorf("%s: %v", name, err)
+		}
+		return ok && truth(v), nil
+	}
+	return false, fmt.Errorf("%s: want one field, got %d", name, len(field))
+}
+
+// anyItem reports whether any item of the list or of the iterator, or its
+// field if given, is true, reading the items up to the first one:
+//
+//	{{if any .Items "Active"}}...{{end}}
+func anyItem(src reflect.Value, field ...string) (result bool, err error) {
+	list, it, err := sourceArg("any", src)
+	if err != nil {
+		return false, err
+	}
+	each(list, it, func(v reflect.Value) bool {
+		result, err = itemTrue("any", v, field)
+		return err == nil && !result
+	})
+	return
+}
+
+// allItems reports whether all the items of the list or of the iterator, or
+// their field if given, are true, reading the items up to the first false
+// one.
+func allItems(src reflect.Value, field ...string) (result bool, err error) {
+	list, it, err := sourceArg("all", src)
+	if err != nil {
+		return false, err
+	}
+	result = true
+	each(list, it, func(v reflect.Value) bool {
+		result, err = itemTrue("all", v, field)
+		return err == nil && result
+	})
+	return
+}
@@ -0,0 +1,120 @@
+package template
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/moisespsena-go/umbu/cast"
+	"github.com/moisespsena-go/umbu/locale"
+)
+
+// SetLocale sets the locale tag of the execution, as "pt-BR", used by the
+// timef, numberf and first_weekday builtins. Without it, the locale is the
+// one of the context of the execution (see locale.NewContext).
+func (this *Executor) SetLocale(tag string) *Executor {
+	this.StateOptions.Locale = tag
+	return this
+}
+
+// SetRelativeThresholds sets the thresholds choosing the units of the
+// relative times written by the reltime builtin. Nil thresholds are
+// locale.DefaultThresholds.
+func (this *Executor) SetRelativeThresholds(thresholds []locale.Threshold) *Executor {
+	this.StateOptions.RelativeThresholds = thresholds
+	return this
+}
+
+// Locale returns the locale of the execution, English by default.
+func (this *State) Locale() *locale.Locale {
+	tag := this.e.StateOptions.Locale
+	if tag == "" {
+		tag = locale.FromContext(this.context)
+	}
+	return locale.Get(tag)
+}
+
+// numberFormat formats the number, or the decimal string, with the
+// separators of the locale of the execution. The options are the decimals,
+// as many as needed if not given, and the RoundingMode, HalfUp by default.
+func numberFormat(state *State, value interface{}, opts ...interface{}) (string, error) {
+	v := reflect.ValueOf(value)
+	if !v.IsValid() {
+		return "", fmt.Errorf("numberf of untyped nil")
+	}
+	v, isNil := indirect(v)
+	if isNil {
+		return "", fmt.Errorf("numberf of nil pointer")
+	}
+	decimals, mode := -1, HalfUp
+	if len(opts) > 0 {
+		d, err := cast.ToInt(opts[0])
+		if err != nil || d < 0 {
+			return "", fmt.Errorf("numberf: invalid decimals %v", opts[0])
+		}
+		decimals = int(d)
+	}
+	if len(opts) > 1 {
+		m, err := cast.ToString(opts[1])
+		if err != nil {
+			return "", fmt.Errorf("numberf: invalid rounding mode %v", opts[1])
+		}
+		mode = RoundingMode(m)
+	}
+	var s string
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s = strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		s = strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32:
+		s = strconv.FormatFloat(v.Float(), 'f', -1, 32)
+	case reflect.Float64:
+		s = strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	case reflect.String:
+		s = strings.TrimPrefix(strings.TrimSpace(v.String()), "+")
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return "", fmt.Errorf("numberf of non decimal string %q", v.String())
+		}
+		if strings.ContainsAny(s, "eExXpP_") {
+			s = strconv.FormatFloat(f, 'f', -1, 64)
+		} else if strings.HasPrefix(s, "-.") || strings.HasPrefix(s, ".") {
+			s = strings.Replace(s, ".", "0.", 1)
+		}
+	default:
+		return "", fmt.Errorf("numberf of type %s", v.Type())
+	}
+	if decimals >= 0 {
+		var err error
+		if s, err = roundDecimal(s, decimals, mode); err != nil {
+			return "", fmt.Errorf("numberf: %v", err)
+		}
+	}
+	return state.Locale().FormatNumber(s), nil
+}
+
+// firstWeekday returns the first day of the week of the locale of the
+// execution.
+func firstWeekday(state *State) time.Weekday {
+	return state.Locale().FirstDay
+}
+
+// relativeTime writes the time relative to base, or to now, in the locale
+// of the execution, as "3 hours ago" or "in 2 days".
+func relativeTime(state *State, item interface{}, base ...interface{}) (string, error) {
+	t, err := toTime(item)
+	if err != nil {
+		return "", fmt.Errorf("reltime: %v", err)
+	}
+	now := state.now()
+	if len(base) > 0 {
+		if now, err = toTime(base[0]); err != nil {
+			return "", fmt.Errorf("reltime: %v", err)
+		}
+	}
+	return state.Locale().RelativeTime(t.Sub(now), state.e.StateOptions.RelativeThresholds), nil
+}
@@ -0,0 +1,47 @@
+package template
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SetLogger sets the logger used to report non-fatal execution events:
+// missing optional fields, calls to deprecated functions, OnNoField hits and
+// recovered include errors. A nil logger disables these reports.
+func (this *Executor) SetLogger(logger *slog.Logger) *Executor {
+	this.StateOptions.Logger = logger
+	return this
+}
+
+// Log reports a non-fatal event to the executor logger, if any. The template
+// path and the current location are added to the record attributes. The
+// secrets resolved by the execution are masked in the message and the
+// attributes.
+func (this *State) Log(level slog.Level, msg string, args ...any) {
+	logger := this.e.StateOptions.Logger
+	if logger == nil {
+		return
+	}
+	ctx := this.context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+	attrs := make([]any, 0, len(args)+4)
+	attrs = append(attrs, "template", this.e.FullPath().String())
+	if this.node != nil {
+		location, context := this.tmpl.ErrorContext(this.node)
+		attrs = append(attrs, "location", location, "context", context)
+	}
+	if secrets := this.e.StateOptions.Secrets; secrets != nil {
+		msg = secrets.Mask(msg)
+		for _, arg := range args {
+			attrs = append(attrs, secrets.maskValue(arg))
+		}
+		logger.Log(ctx, level, msg, attrs...)
+		return
+	}
+	logger.Log(ctx, level, msg, append(attrs, args...)...)
+}
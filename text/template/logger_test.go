@@ -0,0 +1,39 @@
+package template
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/moisespsena-go/umbu/funcs"
+)
+
+func TestExecutorLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	tmpl := Must(New("log").Parse(`{{.Missing?}}{{old}}`))
+	fv := funcs.NewValues()
+	fv.Set("old", func() string { return "x" })
+	fv.Deprecate("old", "use new")
+
+	out, err := tmpl.CreateExecutor().FuncsValues(fv).SetLogger(logger).ExecuteString(struct{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "x" {
+		t.Errorf("got %q want %q", out, "x")
+	}
+	log := buf.String()
+	for _, want := range []string{
+		`msg="missing optional field" template=` + "`log`",
+		"field=Missing",
+		`msg="deprecated function"`,
+		`reason="use new"`,
+	} {
+		if !strings.Contains(log, want) {
+			t.Errorf("log %q doesn't contains %q", log, want)
+		}
+	}
+}
@@ -9,7 +9,13 @@ package template
 import (
 	"bytes"
 	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
 
 	"github.com/moisespsena-go/umbu/text/template/parse"
 )
@@ -176,6 +182,27 @@ func TestParseGlobWithData(t *testing.T) {
 	testExecute(templateFileExecTests, template, t)
 }
 
+func TestParseFS(t *testing.T) {
+	fsys := os.DirFS("testdata")
+	if _, err := ParseFS(fsys, "DOES NOT EXIST"); err == nil {
+		t.Error("expected error for non-existent file; got none")
+	}
+	template, err := New("root").ParseFS(fsys, "file1.tmpl", "file2.tmpl")
+	if err != nil {
+		t.Fatalf("error parsing files: %v", err)
+	}
+	testExecute(multiExecTests, template, t)
+
+	template, err = New("root").ParseFS(fsys, "tmpl*.tmpl")
+	if err != nil {
+		t.Fatalf("error parsing files: %v", err)
+	}
+	testExecute(templateFileExecTests, template, t)
+	if path := template.Lookup("tmpl1.tmpl").Path; path != "tmpl1.tmpl" {
+		t.Errorf("got path %q, want %q", path, "tmpl1.tmpl")
+	}
+}
+
 const (
 	cloneText1 = `{{define "a"}}{{template "b"}}{{template "c"}}{{end}}`
 	cloneText2 = `{{define "b"}}b{{end}}`
@@ -285,6 +312,47 @@ func TestRedefinition(t *testing.T) {
 	}
 }
 
+func TestRedefinitionOption(t *testing.T) {
+	tmpl := Must(New("base").SetPath("base.tmpl").Parse(`{{define "layout"}}foo{{end}}{{define "empty"}}{{end}}`))
+	tmpl.Option("redefine=error")
+	if _, err := tmpl.New("plugin").Parse(`{{define "empty"}}ok{{end}}`); err != nil {
+		t.Fatalf("redefining an empty template: %v", err)
+	}
+	_, err := tmpl.New("plugin").SetPath("plugin.tmpl").Parse(`{{define "layout"}}bar{{end}}`)
+	const want = `template: redefinition of "layout" from "plugin.tmpl", previously defined as "layout" from "base.tmpl"`
+	if err == nil || err.Error() != want {
+		t.Fatalf("got error %v, want %s", err, want)
+	}
+	defs := fmt.Sprint(tmpl.Definitions())
+	if want := `["empty" from template "plugin" "layout" from "base.tmpl"]`; defs != want {
+		t.Errorf("got definitions %s, want %s", defs, want)
+	}
+
+	var buf bytes.Buffer
+	tmpl.Option("redefine=warn").SetLogger(slog.New(slog.NewTextHandler(&buf, nil)))
+	if _, err := tmpl.New("plugin").SetPath("plugin.tmpl").Parse(`{{define "layout"}}bar{{end}}`); err != nil {
+		t.Fatal(err)
+	}
+	if log := buf.String(); !strings.Contains(log, `msg="template redefined" template=layout`) {
+		t.Errorf("got log %q", log)
+	}
+	if def := tmpl.Definitions()[1]; def.Path != "plugin.tmpl" {
+		t.Errorf("got definition %v", def)
+	}
+
+	// A nil logger disables the warnings, not falling back to slog.Default.
+	var defaultLog bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&defaultLog, nil)))
+	tmpl.SetLogger(nil)
+	if _, err := tmpl.New("plugin").Parse(`{{define "layout"}}baz{{end}}`); err != nil {
+		t.Fatal(err)
+	}
+	if defaultLog.Len() != 0 {
+		t.Errorf("got default log %q", defaultLog.String())
+	}
+}
+
 // Issue 10879
 func TestEmptyTemplateCloneCrash(t *testing.T) {
 	t1 := New("base")
@@ -419,3 +487,216 @@ func TestIssue19294(t *testing.T) {
 		}
 	}
 }
+
+func TestProvider(t *testing.T) {
+	fsys := fstest.MapFS{
+		"header": {Data: []byte(`<h1>{{.}}</h1>{{template "footer"}}`)},
+		"footer": {Data: []byte(`<footer/>`)},
+		"bad":    {Data: []byte(`{{.X`)},
+	}
+	root := Must(New("root").Parse(`{{template "header" .}}`)).SetProvider(FSProvider(fsys))
+	if root.Lookup("header") != nil {
+		t.Fatal("header loaded before execution")
+	}
+	var buf bytes.Buffer
+	if err := root.Execute(&buf, "title"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "<h1>title</h1><footer/>"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+	if root.Lookup("header") == nil || root.Lookup("footer") == nil {
+		t.Error("loaded templates not associated")
+	}
+
+	for name, want := range map[string]string{
+		"missing": `template "missing" not defined`,
+		"bad":     `template: bad:1: unclosed action`,
+	} {
+		tmpl := Must(New("x").Parse(fmt.Sprintf(`{{template %q}}`, name))).SetProvider(FSProvider(fsys))
+		err := tmpl.Execute(&buf, nil)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got error %v, want %q", name, err, want)
+		}
+	}
+}
+
+func TestReparseTemplate(t *testing.T) {
+	root := Must(New("page").Parse(`{{define "page"}}[{{template "card" . .}}]{{end}}` +
+		`{{define "card" $n}}card {{$n}}{{end}}` +
+		`{{define "list"}}{{template "page" 1}}{{end}}` +
+		`{{define "other"}}other{{end}}`))
+	var changed []string
+	root.OnChange(func(names []string) { changed = names })
+
+	if got, want := strings.Join(root.Dependents("card"), " "), "list page"; got != want {
+		t.Errorf("dependents: got %q, want %q", got, want)
+	}
+
+	old := root.Lookup("card")
+	card, err := root.ReparseTemplate("card", `CARD {{$n}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Lookup("card") != card || old.Tree == card.Tree {
+		t.Error("template not swapped")
+	}
+	if got, want := strings.Join(changed, " "), "card list page"; got != want {
+		t.Errorf("changed: got %q, want %q", got, want)
+	}
+	var buf bytes.Buffer
+	if err := root.ExecuteTemplate(&buf, "list", nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := "[CARD 1]"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+
+	for src, want := range map[string]string{
+		`{{.X`: `unclosed action`,
+		`{{define "card"}}x{{end}}{{define "more"}}y{{end}}`: `template: card: reparse defines template "more"`,
+	} {
+		if _, err := root.ReparseTemplate("card", src); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got error %v, want %q", src, err, want)
+		}
+	}
+	if root.Lookup("card") != card {
+		t.Error("failed reparse swapped the template")
+	}
+}
+
+// The loads by the executions are safe with the lookups and the parses of
+// other templates: run with -race.
+func TestProviderConcurrent(t *testing.T) {
+	fsys := fstest.MapFS{}
+	for i := 0; i < 8; i++ {
+		fsys[fmt.Sprint("t", i)] = &fstest.MapFile{Data: []byte(fmt.Sprint(i))}
+	}
+	root := Must(New("root").Parse(`{{template .}}`)).SetProvider(FSProvider(fsys))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprint("t", i)
+			if out, err := root.ExecuteString(name); err != nil || out != fmt.Sprint(i) {
+				t.Errorf("%s: got %q, %v", name, out, err)
+			}
+			root.Templates()
+			if _, err := root.New(fmt.Sprint("p", i)).Parse("p"); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := len(root.Templates()); n != 17 {
+		t.Errorf("got %d templates, want 17", n)
+	}
+}
+
+// The provider is called without the lock, once for the concurrent loads
+// of a template, and once for a missing template until ForgetMissing.
+func TestProviderLoads(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls = map[string]int{}
+		root  *Template
+	)
+	root = New("root").SetProvider(ProviderFunc(func(name string) (string, error) {
+		mu.Lock()
+		calls[name]++
+		mu.Unlock()
+		root.Lookup("root")
+		if name == "missing" {
+			return "", fs.ErrNotExist
+		}
+		return name, nil
+	}))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if tmpl, err := root.Load("a"); err != nil || tmpl == nil {
+				t.Errorf("got %v, %v", tmpl, err)
+			}
+			if tmpl, err := root.Load("missing"); err != nil || tmpl != nil {
+				t.Errorf("got %v, %v", tmpl, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls["a"] != 1 || calls["missing"] != 1 {
+		t.Errorf("got calls %v", calls)
+	}
+	root.ForgetMissing("missing")
+	root.Load("missing")
+	if calls["missing"] != 2 {
+		t.Errorf("got %d calls after ForgetMissing", calls["missing"])
+	}
+}
+
+// The executions and the lookups are safe during the reparses: run with
+// -race.
+func TestReparseTemplateConcurrent(t *testing.T) {
+	root := Must(New("page").Parse(`{{define "page"}}[{{template "card" .}}]{{end}}{{define "card"}}card{{end}}`))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				var buf bytes.Buffer
+				if err := root.ExecuteTemplate(&buf, "page", nil); err != nil {
+					t.Error(err)
+					return
+				}
+				if out := buf.String(); out != "[card]" && out != "[CARD]" {
+					t.Errorf("got %q", out)
+				}
+				if root.Lookup("card") == nil || len(root.Templates()) != 2 {
+					t.Error("card not found")
+				}
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		src := "card"
+		if i%2 == 0 {
+			src = "CARD"
+		}
+		if _, err := root.ReparseTemplate("card", src); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+}
+
+func TestWarmUp(t *testing.T) {
+	fsys := fstest.MapFS{
+		"header": {Data: []byte(`<h1>{{template "title"}}</h1>`)},
+		"title":  {Data: []byte(`Title`)},
+	}
+	root := Must(New("root").Parse(`{{template "header"}}{{define "a"}}{{template "missing"}}{{end}}` +
+		`{{define "b"}}{{template "gone"}}{{end}}`)).SetProvider(FSProvider(fsys))
+	err := root.WarmUp(4)
+	want := "template: 'root':1:46: invokes undefined template \"missing\"\n" +
+		"template: 'root':1:89: invokes undefined template \"gone\""
+	if err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %q", err, want)
+	}
+	if root.Lookup("header") == nil || root.Lookup("title") == nil {
+		t.Error("invoked templates not loaded")
+	}
+	// The executors are kept until the functions change.
+	if root.executor.Load() == nil || root.Lookup("title").executor.Load() == nil {
+		t.Error("executors not kept")
+	}
+	root.Funcs(FuncMap{"f": strings.ToUpper})
+	if root.executor.Load() != nil {
+		t.Error("executor kept after Funcs")
+	}
+	if err := Must(New("x").Parse(`{{define "y"}}y{{end}}{{template "y"}}`)).WarmUp(0); err != nil {
+		t.Error(err)
+	}
+}
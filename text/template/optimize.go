@@ -0,0 +1,383 @@
+package template
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/moisespsena-go/umbu/expr"
+	"github.com/moisespsena-go/umbu/funcs"
+	"github.com/moisespsena-go/umbu/text/template/parse"
+)
+
+// pureBuiltins are the builtins without side effects, whose calls may be
+// evaluated once for all the elements of a range.
+var pureBuiltins = map[string]bool{
+	"and": true, "or": true, "not": true, "len": true, "index": true, "slice": true,
+	"html": true, "js": true, "urlquery": true, "contains": true, "default": true,
+	"print": true, "printf": true, "println": true, "string": true,
+	"int": true, "uint": true, "to_i": true, "to_u": true, "to_f": true, "to_s": true, "bool": true,
+	"eq": true, "ne": true, "lt": true, "le": true, "gt": true, "ge": true,
+}
+
+// Optimize rewrites the trees of the templates associated with t to execute
+// faster, with the same output:
+//
+//   - the expressions of constants, as {{2 * 60}}, are computed;
+//   - the printf and print calls of constants, as (printf "%d%%" 50), are
+//     replaced by their results;
+//   - the pipelines of the actions of a range body that depend neither on
+//     dot nor on the variables set in the range, as {{$.Title | printf "%q"}},
+//     are evaluated once before the range, and shared by the actions of the
+//     same pipeline.
+//
+// A pipeline is only moved out of a range if it calls no function but the
+// builtins without side effects, as printf, index and eq. The functions of
+// the templates and of values, as the functions of the executors, are taken
+// for user functions even if named as builtins. The moved pipelines are
+// evaluated on the first iteration, not if the range has no elements.
+//
+// Optimize must be called before the templates are executed.
+func (t *Template) Optimize(values ...funcs.FuncValues) *Template {
+	if t.common == nil {
+		return t
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, tmpl := range t.tmpl {
+		if tmpl.Tree == nil || tmpl.Root == nil {
+			continue
+		}
+		o := &optimizer{
+			values: append([]funcs.FuncValues{tmpl.funcs.Load()}, values...),
+			vars:   map[string]bool{},
+		}
+		parse.Inspect(tmpl.Root, func(n parse.Node) bool {
+			switch n := n.(type) {
+			case *parse.PipeNode:
+				o.foldPipe(n)
+			case *parse.VariableNode:
+				o.vars[n.Ident[0]] = true
+			}
+			return true
+		})
+		o.list(tmpl.Root)
+	}
+	return t
+}
+
+// optimizer optimizes a tree.
+type optimizer struct {
+	values []funcs.FuncValues
+	vars   map[string]bool // The names of the variables of the tree.
+}
+
+// builtin reports whether the function name is the builtin of that name.
+func (o *optimizer) builtin(name string) bool {
+	for _, v := range o.values {
+		if v.Get(name) != nil {
+			return false
+		}
+	}
+	return builtins[name] != nil
+}
+
+// foldPipe computes the constant expressions and printf calls of the pipe.
+func (o *optimizer) foldPipe(pipe *parse.PipeNode) {
+	for i, cmd := range pipe.Cmds {
+		o.foldCommand(cmd)
+		if i == 0 {
+			o.foldPrint(cmd)
+		}
+	}
+}
+
+func (o *optimizer) foldCommand(cmd *parse.CommandNode) {
+	for i, arg := range cmd.Args {
+		switch arg := arg.(type) {
+		case *parse.PipeNode:
+			o.foldPipe(arg)
+			// (printf "x") is the string "x".
+			if len(arg.Decl) == 0 && len(arg.Cmds) == 1 && len(arg.Cmds[0].Args) == 1 {
+				if s, ok := arg.Cmds[0].Args[0].(*parse.StringNode); ok {
+					cmd.Args[i] = s
+				}
+			}
+		case *parse.ExprNode:
+			o.foldCommand(arg.A)
+			o.foldCommand(arg.B)
+		}
+	}
+	if len(cmd.Args) != 1 {
+		return
+	}
+	if e, ok := cmd.Args[0].(*parse.ExprNode); ok {
+		a, aok := constantValue(e.A)
+		b, bok := constantValue(e.B)
+		if !aok || !bok {
+			return
+		}
+		if v, ok := evalExpr(e.Op, a, b); ok {
+			cmd.Args[0] = &parse.ValNode{NodeType: parse.NodeVal, Pos: e.Pos, Value: v}
+		}
+	}
+}
+
+// foldPrint replaces the printf or print call of constants by its result.
+func (o *optimizer) foldPrint(cmd *parse.CommandNode) {
+	ident, ok := cmd.Args[0].(*parse.IdentifierNode)
+	if !ok || cmd.Filter || (ident.Ident != "printf" && ident.Ident != "print") || !o.builtin(ident.Ident) {
+		return
+	}
+	if ident.Ident == "printf" && len(cmd.Args) == 1 {
+		return
+	}
+	args := make([]interface{}, len(cmd.Args)-1)
+	for i, arg := range cmd.Args[1:] {
+		v, ok := constantValue(arg)
+		if !ok {
+			return
+		}
+		args[i] = v.Interface()
+	}
+	var s string
+	if ident.Ident == "print" {
+		s = fmt.Sprint(args...)
+	} else if format, ok := args[0].(string); ok {
+		s = fmt.Sprintf(format, args[1:]...)
+	} else {
+		return
+	}
+	cmd.Args = []parse.Node{&parse.StringNode{NodeType: parse.NodeString, Pos: ident.Pos, Quoted: strconv.Quote(s), Text: s}}
+}
+
+// evalExpr computes the expression, failing on the errors and the panics,
+// as the divisions by zero, left to the execution.
+func evalExpr(op rune, a, b reflect.Value) (v reflect.Value, ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	v, err := expr.Expr(op, a, b)
+	return v, err == nil && v.IsValid()
+}
+
+// constantValue returns the value of the constant argument, as the
+// executor evaluates it with no known type.
+func constantValue(n parse.Node) (reflect.Value, bool) {
+	switch n := n.(type) {
+	case *parse.StringNode:
+		return reflect.ValueOf(n.Text), true
+	case *parse.BoolNode:
+		return reflect.ValueOf(n.True), true
+	case *parse.ValNode:
+		return n.Value, n.Value.IsValid()
+	case *parse.NumberNode:
+		switch {
+		case n.IsComplex:
+			return reflect.ValueOf(n.Complex128), true
+		case n.IsFloat && !isHexConstant(n.Text) && strings.ContainsAny(n.Text, ".eE"):
+			return reflect.ValueOf(n.Float64), true
+		case n.IsInt && int64(int(n.Int64)) == n.Int64:
+			return reflect.ValueOf(int(n.Int64)), true
+		}
+	case *parse.CommandNode:
+		if len(n.Args) == 1 {
+			return constantValue(n.Args[0])
+		}
+	case *parse.PipeNode:
+		if len(n.Decl) == 0 && len(n.Cmds) == 1 {
+			return constantValue(n.Cmds[0])
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// list optimizes the ranges of the list and of its nested lists.
+func (o *optimizer) list(list *parse.ListNode) {
+	if list == nil {
+		return
+	}
+	nodes := make([]parse.Node, 0, len(list.Nodes))
+	for _, node := range list.Nodes {
+		switch n := node.(type) {
+		case *parse.IfNode:
+			o.branch(&n.BranchNode)
+		case *parse.WithNode:
+			o.branch(&n.BranchNode)
+		case *parse.ArgNode:
+			o.branch(&n.BranchNode)
+		case *parse.CallbackNode:
+			o.branch(&n.BranchNode)
+		case *parse.RangeNode:
+			o.branch(&n.BranchNode)
+			nodes = append(nodes, o.hoist(n)...)
+		case *parse.WrapNode:
+			o.list(n.BeginList)
+			o.list(n.List)
+			o.list(n.AfterList)
+			o.list(n.ElseList)
+		case *parse.CustomNode:
+			o.list(n.List)
+			o.list(n.ElseList)
+		}
+		nodes = append(nodes, node)
+	}
+	list.Nodes = nodes
+}
+
+func (o *optimizer) branch(b *parse.BranchNode) {
+	o.list(b.List)
+	o.list(b.ElseList)
+}
+
+// hoist moves the invariant pipelines of the actions of the body of the
+// range to variables declared before it, returning their declarations. The
+// variables are set on the first iteration, so the pipelines aren't
+// evaluated if the range has no elements:
+//
+//	{{$_hoist0 := false}}{{$_hoist1 := false}}{{range .Items}}{{if $_hoist1}}{{else}}{{$_hoist0 = $.Title | printf "%s-"}}{{$_hoist1 = true}}{{end}}...{{$_hoist0}}{{end}}
+func (o *optimizer) hoist(r *parse.RangeNode) (decls []parse.Node) {
+	set := map[string]bool{}
+	parse.Inspect(r, func(n parse.Node) bool {
+		if pipe, ok := n.(*parse.PipeNode); ok && pipe != nil {
+			for _, v := range pipe.Decl {
+				set[v.Ident[0]] = true
+			}
+		}
+		return true
+	})
+	var sets []parse.Node
+	names := map[string]string{}
+	variable := func(pipe *parse.PipeNode) *parse.VariableNode {
+		key := pipe.String()
+		name, ok := names[key]
+		if !ok {
+			name = o.newVar()
+			names[key] = name
+			decls = append(decls, hoistedVar(pipe, name, false))
+			assign := *pipe
+			assign.TrimRight = false
+			assign.Decl = []*parse.VariableNode{{NodeType: parse.NodeVariable, Pos: pipe.Pos, Ident: []string{name}, Op: '='}}
+			sets = append(sets, &parse.ActionNode{NodeType: parse.NodeAction, Pos: pipe.Pos, Line: pipe.Line, Pipe: &assign})
+		}
+		return &parse.VariableNode{NodeType: parse.NodeVariable, Pos: pipe.Pos, Ident: []string{name}}
+	}
+	for _, node := range r.List.Nodes {
+		action, ok := node.(*parse.ActionNode)
+		if !ok || len(action.Pipe.Decl) > 0 {
+			continue
+		}
+		if o.hoistable(set, action.Pipe) {
+			v := variable(action.Pipe)
+			pipe := *action.Pipe
+			pipe.Cmds = []*parse.CommandNode{pipe.Cmds[0].WithArgs(v)}
+			action.Pipe = &pipe
+			continue
+		}
+		for _, cmd := range action.Pipe.Cmds {
+			for i, arg := range cmd.Args {
+				if pipe, ok := arg.(*parse.PipeNode); ok && (i > 0 || len(cmd.Args) == 1) && o.hoistable(set, pipe) {
+					cmd.Args[i] = variable(pipe)
+				}
+			}
+		}
+	}
+	if len(decls) == 0 {
+		return
+	}
+	// The flag of the variables set, tested first in the body.
+	pos, line := r.Pipe.Pos, r.Pipe.Line
+	done := o.newVar()
+	decls = append(decls, hoistedVar(r.Pipe, done, false))
+	sets = append(sets, hoistedVar(r.Pipe, done, true))
+	for _, n := range sets {
+		n.(*parse.ActionNode).Pipe.Decl[0].Update = true
+	}
+	first := &parse.IfNode{BranchNode: parse.BranchNode{
+		NodeType: parse.NodeIf, Pos: pos, Line: line,
+		Pipe: &parse.PipeNode{NodeType: parse.NodePipe, Pos: pos, Line: line, Cmds: []*parse.CommandNode{{
+			NodeType: parse.NodeCommand, Pos: pos,
+			Args: []parse.Node{&parse.VariableNode{NodeType: parse.NodeVariable, Pos: pos, Ident: []string{done}}},
+		}}},
+		List:     &parse.ListNode{NodeType: parse.NodeList, Pos: pos},
+		ElseList: &parse.ListNode{NodeType: parse.NodeList, Pos: pos, Nodes: sets},
+	}}
+	r.List.Nodes = append([]parse.Node{first}, r.List.Nodes...)
+	return
+}
+
+// hoistedVar returns the action declaring the variable named name with the
+// value, at the position of pipe.
+func hoistedVar(pipe *parse.PipeNode, name string, value bool) *parse.ActionNode {
+	return &parse.ActionNode{NodeType: parse.NodeAction, Pos: pipe.Pos, Line: pipe.Line, Pipe: &parse.PipeNode{
+		NodeType: parse.NodePipe, Pos: pipe.Pos, Line: pipe.Line,
+		Decl: []*parse.VariableNode{{NodeType: parse.NodeVariable, Pos: pipe.Pos, Ident: []string{name}, Op: '='}},
+		Cmds: []*parse.CommandNode{{NodeType: parse.NodeCommand, Pos: pipe.Pos, Args: []parse.Node{&parse.BoolNode{NodeType: parse.NodeBool, Pos: pipe.Pos, True: value}}}},
+	}}
+}
+
+// newVar returns a name of variable not used by the tree.
+func (o *optimizer) newVar() string {
+	for i := 0; ; i++ {
+		if name := "$_hoist" + strconv.Itoa(i); !o.vars[name] {
+			o.vars[name] = true
+			return name
+		}
+	}
+}
+
+// hoistable reports whether the pipe may be evaluated out of the range
+// setting the variables of set: it isn't a constant and only depends on the
+// other variables and on the builtins without side effects.
+func (o *optimizer) hoistable(set map[string]bool, pipe *parse.PipeNode) bool {
+	if len(pipe.Decl) > 0 {
+		return false
+	}
+	var worth bool
+	var invariant func(n parse.Node) bool
+	invariant = func(n parse.Node) bool {
+		switch n := n.(type) {
+		case *parse.StringNode, *parse.NumberNode, *parse.BoolNode, *parse.NilNode, *parse.ValNode:
+			return true
+		case *parse.VariableNode:
+			worth = worth || len(n.Ident) > 1
+			return !set[n.Ident[0]]
+		case *parse.IdentifierNode:
+			if n.Ident == Globals || n.Ident == Self {
+				return true
+			}
+			worth = true
+			return pureBuiltins[n.Ident] && o.builtin(n.Ident)
+		case *parse.ChainNode:
+			worth = true
+			return invariant(n.Node)
+		case *parse.ExprNode:
+			return invariant(n.A) && invariant(n.B)
+		case *parse.CommandNode:
+			if n.Filter {
+				return false
+			}
+			for _, arg := range n.Args {
+				if !invariant(arg) {
+					return false
+				}
+			}
+			return true
+		case *parse.PipeNode:
+			if len(n.Decl) > 0 {
+				return false
+			}
+			for _, cmd := range n.Cmds {
+				if !invariant(cmd) {
+					return false
+				}
+			}
+			return true
+		}
+		return false
+	}
+	return invariant(pipe) && worth
+}
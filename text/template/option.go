@@ -19,6 +19,7 @@ const (
 
 type option struct {
 	missingKey missingKeyAction
+	redefine   redefineAction
 }
 
 // Option sets options for the template. Options are described by
@@ -39,6 +40,16 @@ type option struct {
 //	"missingkey=error"
 //		Execution stops immediately with an error.
 //
+// redefine: Control the behavior when a parse redefines a non empty
+// template, including the defaults of {{block}} actions.
+//	"redefine=allow"
+//		The default behavior: The template is replaced.
+//	"redefine=warn"
+//		The template is replaced and a warning is logged, see SetLogger.
+//	"redefine=error"
+//		The parse fails. See Definitions to know where the templates are
+//		defined.
+//
 func (t *Template) Option(opt ...string) *Template {
 	t.init()
 	for _, s := range opt {
@@ -57,18 +68,36 @@ func (t *Template) setOption(opt string) {
 		// key=value
 		switch elems[0] {
 		case "missingkey":
+			if action, ok := parseMissingKey(elems[1]); ok {
+				t.option.missingKey = action
+				return
+			}
+		case "redefine":
 			switch elems[1] {
-			case "invalid", "default":
-				t.option.missingKey = mapInvalid
+			case "allow":
+				t.option.redefine = redefineAllow
 				return
-			case "zero":
-				t.option.missingKey = mapZeroValue
+			case "warn":
+				t.option.redefine = redefineWarn
 				return
 			case "error":
-				t.option.missingKey = mapError
+				t.option.redefine = redefineError
 				return
 			}
 		}
 	}
 	panic("unrecognized option: " + opt)
 }
+
+// parseMissingKey parses the value of the missingkey option.
+func parseMissingKey(value string) (missingKeyAction, bool) {
+	switch value {
+	case "invalid", "default":
+		return mapInvalid, true
+	case "zero":
+		return mapZeroValue, true
+	case "error":
+		return mapError, true
+	}
+	return mapInvalid, false
+}
@@ -0,0 +1,143 @@
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// OrderedMap is a map which keeps the insertion order of its keys. Range
+// reads its keys and values in this order, as its String and MarshalJSON
+// do:
+//
+//	{{$m := ordered_map "name" .Name "email" .Email}}
+//	{{$m.Set "phone" .Phone}}
+//	{{range $k, $v := $m}}<input name="{{$k}}" value="{{$v}}">{{end}}
+type OrderedMap struct {
+	keys   []interface{}
+	values map[interface{}]interface{}
+}
+
+// NewOrderedMap returns a new OrderedMap with the pairs of keys and values.
+func NewOrderedMap(pairs ...interface{}) (*OrderedMap, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("ordered_map: odd number of arguments %d", len(pairs))
+	}
+	m := &OrderedMap{values: make(map[interface{}]interface{}, len(pairs)/2)}
+	for i := 0; i < len(pairs); i += 2 {
+		m.Set(pairs[i], pairs[i+1])
+	}
+	return m, nil
+}
+
+// Set sets the value of the key, keeping its position if it's already set.
+func (m *OrderedMap) Set(key, value interface{}) {
+	if m.values == nil {
+		m.values = map[interface{}]interface{}{}
+	}
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+// Get returns the value of the key, or nil if it isn't set.
+func (m *OrderedMap) Get(key interface{}) interface{} {
+	return m.values[key]
+}
+
+// Has reports whether the key is set.
+func (m *OrderedMap) Has(key interface{}) bool {
+	_, ok := m.values[key]
+	return ok
+}
+
+// Delete deletes the key.
+func (m *OrderedMap) Delete(key interface{}) {
+	if _, ok := m.values[key]; !ok {
+		return
+	}
+	delete(m.values, key)
+	for i, k := range m.keys {
+		if k == key {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// Len returns the number of keys.
+func (m *OrderedMap) Len() int {
+	return len(m.keys)
+}
+
+// Keys returns the keys in insertion order.
+func (m *OrderedMap) Keys() []interface{} {
+	return append([]interface{}(nil), m.keys...)
+}
+
+// Values returns the values in the insertion order of their keys.
+func (m *OrderedMap) Values() []interface{} {
+	values := make([]interface{}, len(m.keys))
+	for i, key := range m.keys {
+		values[i] = m.values[key]
+	}
+	return values
+}
+
+func (m *OrderedMap) Start() interface{} {
+	return 0
+}
+
+func (m *OrderedMap) Done(state interface{}) bool {
+	return state.(int) >= len(m.keys)
+}
+
+func (m *OrderedMap) Next(state interface{}) (item, nextState interface{}) {
+	return m.keys[state.(int)], state.(int) + 1
+}
+
+// Pair returns the key item and its value, so range reads the map as a Go
+// map.
+func (m *OrderedMap) Pair(item interface{}) (key, value interface{}) {
+	return item, m.values[item]
+}
+
+// String returns the map formatted as a Go map, as "map[b:1 a:2]".
+func (m *OrderedMap) String() string {
+	var b bytes.Buffer
+	b.WriteString("map[")
+	for i, key := range m.keys {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "%v:%v", key, m.values[key])
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// MarshalJSON returns the JSON object of the map, with its keys in
+// insertion order.
+func (m *OrderedMap) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, err := json.Marshal(fmt.Sprint(key))
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(m.values[key])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
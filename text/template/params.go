@@ -0,0 +1,111 @@
+package template
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/moisespsena-go/umbu/text/template/parse"
+)
+
+// checkParams checks the template calls of tree against the parameters
+// declared by the called templates, and the calls to the template named name,
+// defined by tree, from the other templates associated with t. The tree is
+// checked as the definition of name, before it is associated with t.
+func (t *Template) checkParams(name string, tree *parse.Tree) (err error) {
+	if tree.Root == nil {
+		return nil
+	}
+	parse.Inspect(tree.Root, func(n parse.Node) bool {
+		if call, ok := n.(*parse.TemplateNode); ok && err == nil {
+			if call.Name == name {
+				err = checkCall(tree, call, tree.Params())
+			} else if target := t.tmpl[call.Name]; target != nil && target.Tree != nil {
+				err = checkCall(tree, call, target.Tree.Params())
+			}
+		}
+		return err == nil
+	})
+	if err != nil || tree.Params() == nil {
+		return
+	}
+	for callerName, caller := range t.tmpl {
+		if callerName == name || caller.Tree == nil || caller.Root == nil {
+			continue
+		}
+		parse.Inspect(caller.Root, func(n parse.Node) bool {
+			if call, ok := n.(*parse.TemplateNode); ok && err == nil && call.Name == name {
+				err = checkCall(caller.Tree, call, tree.Params())
+			}
+			return err == nil
+		})
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// checkCall checks the arity of the call and the types of its literal
+// arguments. Templates declaring their arguments as variables aren't checked.
+func checkCall(caller *parse.Tree, call *parse.TemplateNode, params []parse.Param) error {
+	if params == nil {
+		return nil
+	}
+	var args []parse.Node
+	if call.Pipe != nil && len(call.Pipe.Cmds) == 1 {
+		args = call.Pipe.Cmds[0].Args[1:]
+	}
+	location, _ := caller.ErrorContext(call)
+	if len(args) != len(params) {
+		want := make([]string, len(params))
+		for i, p := range params {
+			want[i] = p.String()
+		}
+		return fmt.Errorf("template: %s: template %q called with %d arguments, want %d (%s)",
+			location, call.Name, len(args), len(params), strings.Join(want, ", "))
+	}
+	for i, arg := range args {
+		if !literalConforms(arg, params[i].Type) {
+			return fmt.Errorf("template: %s: template %q called with %s as %s",
+				location, call.Name, arg, params[i])
+		}
+	}
+	return nil
+}
+
+// literalConforms reports whether the argument, if a literal, may be
+// assigned to the declared type. Only the basic types and the slices are
+// checked: the named types may have any underlying type.
+func literalConforms(arg parse.Node, typ string) bool {
+	basic := strings.HasPrefix(typ, "[]")
+	switch typ {
+	case "string", "bool", "int", "int8", "int16", "int32", "int64", "rune",
+		"uint", "uint8", "uint16", "uint32", "uint64", "uintptr", "byte",
+		"float32", "float64", "complex64", "complex128":
+		basic = true
+	}
+	if !basic {
+		return true
+	}
+	switch arg := arg.(type) {
+	case *parse.StringNode:
+		return typ == "string"
+	case *parse.BoolNode:
+		return typ == "bool"
+	case *parse.NilNode:
+		return strings.HasPrefix(typ, "[]")
+	case *parse.NumberNode:
+		switch {
+		case strings.HasPrefix(typ, "uint") || typ == "byte":
+			return arg.IsUint
+		case strings.HasPrefix(typ, "int") || typ == "rune":
+			return arg.IsInt
+		case strings.HasPrefix(typ, "float"):
+			return arg.IsFloat
+		case strings.HasPrefix(typ, "complex"):
+			return arg.IsComplex
+		}
+		return false
+	}
+	return true
+}
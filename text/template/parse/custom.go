@@ -0,0 +1,126 @@
+package parse
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Keyword is a custom action keyword, such as {{svg "icon"}}. The actions of
+// registered keywords are parsed into CustomNode nodes, executed by the
+// walker registered with them in the template package.
+type Keyword struct {
+	Name string
+	// Block tells whether the action has a body, ended by {{end}} and
+	// optionally split by {{else}}:
+	//
+	//	{{name pipeline}} T1 {{end}}
+	//	{{name pipeline}} T1 {{else}} T0 {{end}}
+	Block bool
+	// Parse, if not nil, checks the action once parsed and may set its Data.
+	Parse func(n *CustomNode) error
+}
+
+var (
+	keywordsMu sync.RWMutex
+	keywords   = map[string]Keyword{}
+)
+
+// RegisterKeyword registers the custom action keyword k. A keyword shadows
+// the functions of the same name in the actions it starts. RegisterKeyword
+// panics if the name isn't an identifier, is a builtin keyword or is already
+// registered.
+func RegisterKeyword(k Keyword) {
+	if k.Name == "" || strings.IndexFunc(k.Name, func(r rune) bool { return !isAlphaNumeric(r) }) >= 0 {
+		panic(fmt.Sprintf("parse: bad keyword name %q", k.Name))
+	}
+	if _, ok := key[k.Name]; ok {
+		panic(fmt.Sprintf("parse: keyword %q is builtin", k.Name))
+	}
+	keywordsMu.Lock()
+	defer keywordsMu.Unlock()
+	if _, ok := keywords[k.Name]; ok {
+		panic(fmt.Sprintf("parse: keyword %q already registered", k.Name))
+	}
+	keywords[k.Name] = k
+}
+
+// LookupKeyword returns the custom action keyword registered with the name.
+func LookupKeyword(name string) (k Keyword, ok bool) {
+	keywordsMu.RLock()
+	defer keywordsMu.RUnlock()
+	k, ok = keywords[name]
+	return
+}
+
+// CustomNode represents the action of a custom keyword.
+type CustomNode struct {
+	NodeType
+	Pos
+	tr       *Tree
+	Line     int       // The line number in the input. Deprecated: Kept for compatibility.
+	Keyword  string    // The keyword of the action.
+	Pipe     *PipeNode // The pipeline of the action, nil if empty.
+	List     *ListNode // What to execute for a block keyword.
+	ElseList *ListNode // What to execute for {{else}} of a block keyword, nil if absent.
+	// Data holds the data set by the Keyword.Parse function.
+	Data interface{}
+}
+
+func (t *Tree) newCustom(pos Pos, line int, keyword string, pipe *PipeNode, list, elseList *ListNode) *CustomNode {
+	return &CustomNode{tr: t, NodeType: NodeCustom, Pos: pos, Line: line, Keyword: keyword, Pipe: pipe, List: list, ElseList: elseList}
+}
+
+func (c *CustomNode) String() string {
+	var sb strings.Builder
+	sb.WriteString("{{" + c.Keyword)
+	if c.Pipe != nil {
+		sb.WriteString(" " + c.Pipe.String())
+	}
+	sb.WriteString("}}")
+	if c.List != nil {
+		sb.WriteString(c.List.String())
+		if c.ElseList != nil {
+			sb.WriteString("{{else}}" + c.ElseList.String())
+		}
+		sb.WriteString("{{end}}")
+	}
+	return sb.String()
+}
+
+func (c *CustomNode) tree() *Tree {
+	return c.tr
+}
+
+func (c *CustomNode) Copy() Node {
+	n := c.tr.newCustom(c.Pos, c.Line, c.Keyword, c.Pipe.CopyPipe(), c.List.CopyList(), c.ElseList.CopyList())
+	n.Data = c.Data
+	return n
+}
+
+// Custom:
+//
+//	{{keyword pipeline}}
+//	{{keyword pipeline}} itemList {{end}}
+//	{{keyword pipeline}} itemList {{else}} itemList {{end}}
+//
+// Keyword is past.
+func (t *Tree) customControl(k Keyword, token item) Node {
+	context := parseContext{name: k.Name, optionalPipe: true}
+	var n *CustomNode
+	if k.Block {
+		_, _, pipe, list, elseList := t.parseControl(false, context)
+		n = t.newCustom(token.pos, token.line, k.Name, pipe, list, elseList)
+	} else {
+		n = t.newCustom(token.pos, token.line, k.Name, t.pipeline(context), nil, nil)
+	}
+	if len(n.Pipe.Decl) == 0 && len(n.Pipe.Cmds) == 0 {
+		n.Pipe = nil
+	}
+	if k.Parse != nil {
+		if err := k.Parse(n); err != nil {
+			t.errorf("%s: %v", k.Name, err)
+		}
+	}
+	return n
+}
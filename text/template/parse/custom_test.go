@@ -0,0 +1,59 @@
+package parse
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func init() {
+	RegisterKeyword(Keyword{Name: "testicon"})
+	RegisterKeyword(Keyword{Name: "testbox", Block: true, Parse: func(n *CustomNode) error {
+		if n.Pipe == nil {
+			return errors.New("missing title")
+		}
+		n.Data = len(n.Pipe.Cmds)
+		return nil
+	}})
+}
+
+func TestCustomKeywords(t *testing.T) {
+	trees, err := Parse("root", `{{testicon "a" | printf "%s"}}{{testicon}}{{testbox .T}}x{{else}}y{{end}}`, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := trees["root"].Root
+	const want = `{{testicon "a" | printf "%s"}}{{testicon}}{{testbox .T}}x{{else}}y{{end}}`
+	if got := root.String(); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	box := root.Nodes[2].(*CustomNode)
+	if box.Type() != NodeCustom || box.Data != 1 || box.ElseList == nil {
+		t.Errorf("bad node %#v", box)
+	}
+	if c := box.Copy().(*CustomNode); c.String() != box.String() || c.Data != box.Data {
+		t.Errorf("bad copy %s", c)
+	}
+
+	for _, test := range []struct{ text, err string }{
+		{`{{testbox}}x{{end}}`, "testbox: missing title"},
+		{`{{testbox .}}x`, "unexpected EOF"},
+	} {
+		if _, err := Parse("root", test.text, "", ""); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got error %v, want %q", test.text, err, test.err)
+		}
+	}
+}
+
+func TestRegisterKeywordErrors(t *testing.T) {
+	for _, name := range []string{"", "if", "testicon", "a-b"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%q: expected panic", name)
+				}
+			}()
+			RegisterKeyword(Keyword{Name: name})
+		}()
+	}
+}
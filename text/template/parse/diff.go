@@ -0,0 +1,248 @@
+package parse
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ChangeKind is the kind of a Change.
+type ChangeKind int
+
+const (
+	ChangeAdded ChangeKind = iota
+	ChangeRemoved
+	ChangeModified
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	default:
+		return "changed"
+	}
+}
+
+// Change is a difference between two parse trees: an action, a control
+// clause (such as {{if .X}}, {{else}} or {{end}}) or a text added, removed
+// or changed.
+type Change struct {
+	Kind     ChangeKind
+	Template string
+	// Old and New are the changed nodes. Old is nil for additions and New is
+	// nil for removals. For {{else}} and {{end}} clauses, they are the lists
+	// or control nodes holding the clause.
+	Old, New Node
+	// OldText and NewText are the canonical texts of the change.
+	OldText, NewText string
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case ChangeAdded:
+		return fmt.Sprintf("%s:%s: added %s", c.Template, nodeLine(c.New), c.NewText)
+	case ChangeRemoved:
+		return fmt.Sprintf("%s:%s: removed %s", c.Template, nodeLine(c.Old), c.OldText)
+	}
+	return fmt.Sprintf("%s:%s: changed %s to %s", c.Template, nodeLine(c.New), c.OldText, c.NewText)
+}
+
+func nodeLine(n Node) string {
+	if t := n.tree(); t != nil {
+		line, _ := t.LineCol(n.Position())
+		return fmt.Sprint(line)
+	}
+	return "?"
+}
+
+// Diff compares the trees a and b and reports the actions, control clauses
+// and texts added, removed or changed. Whitespace-only changes are ignored:
+// texts are compared with their whitespace runs collapsed. A nil tree is
+// considered empty.
+func Diff(a, b *Tree) []Change {
+	name := ""
+	if a != nil {
+		name = a.Name
+	} else if b != nil {
+		name = b.Name
+	}
+	return diffUnits(name, flattenTree(a), flattenTree(b))
+}
+
+// DiffTrees compares the trees of two tree sets by name, as returned by
+// Parse. The changes are sorted by template name.
+func DiffTrees(a, b map[string]*Tree) (changes []Change) {
+	names := make([]string, 0, len(a)+len(b))
+	for name := range a {
+		names = append(names, name)
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		changes = append(changes, diffUnits(name, flattenTree(a[name]), flattenTree(b[name]))...)
+	}
+	return
+}
+
+// diffUnit is an element of a flattened tree.
+type diffUnit struct {
+	kind string // "text", "action" or the control keyword
+	text string
+	node Node
+}
+
+func (u diffUnit) equal(o diffUnit) bool {
+	return u.kind == o.kind && u.text == o.text
+}
+
+func flattenTree(t *Tree) (units []diffUnit) {
+	if t != nil && t.Root != nil {
+		flattenList(&units, t.Root)
+	}
+	return
+}
+
+func flattenList(units *[]diffUnit, l *ListNode) {
+	if l == nil {
+		return
+	}
+	for _, n := range l.Nodes {
+		flattenNode(units, n)
+	}
+}
+
+func flattenNode(units *[]diffUnit, n Node) {
+	add := func(kind, text string, n Node) {
+		*units = append(*units, diffUnit{kind, text, n})
+	}
+	switch n := n.(type) {
+	case *TextNode:
+		if text := strings.Join(strings.Fields(string(n.Text)), " "); text != "" {
+			add("text", strconv.Quote(text), n)
+		}
+	case *CommentNode:
+		add("comment", n.String(), n)
+	case *ActionNode:
+		add("action", n.String(), n)
+	case *TemplateNode:
+		add("template", n.String(), n)
+	case *IfNode, *RangeNode, *WithNode, *ArgNode, *CallbackNode:
+		var b *BranchNode
+		switch n := n.(type) {
+		case *IfNode:
+			b = &n.BranchNode
+		case *RangeNode:
+			b = &n.BranchNode
+		case *WithNode:
+			b = &n.BranchNode
+		case *ArgNode:
+			b = &n.BranchNode
+		case *CallbackNode:
+			b = &n.BranchNode
+		}
+		kind := b.Type().String()
+		add(kind, fmt.Sprintf("{{%s %s}}", kind, b.Pipe), n)
+		flattenList(units, b.List)
+		if b.ElseList != nil {
+			add("else", "{{else}}", b.ElseList)
+			flattenList(units, b.ElseList)
+		}
+		add("end", "{{end}}", n)
+	case *WrapNode:
+		add("wrap", fmt.Sprintf("{{wrap %s}}", n.Pipe), n)
+		if n.BeginList != nil {
+			add("begin", "{{begin}}", n.BeginList)
+			flattenList(units, n.BeginList)
+			add("enter", "{{enter}}", n.List)
+		}
+		flattenList(units, n.List)
+		if n.AfterList != nil {
+			add("after", "{{after}}", n.AfterList)
+			flattenList(units, n.AfterList)
+		}
+		if n.ElseList != nil {
+			add("else", "{{else}}", n.ElseList)
+			flattenList(units, n.ElseList)
+		}
+		add("end", "{{end}}", n)
+	case *CustomNode:
+		if n.List == nil {
+			add("action", n.String(), n)
+			break
+		}
+		head := n.Keyword
+		if n.Pipe != nil {
+			head += " " + n.Pipe.String()
+		}
+		add(n.Keyword, "{{"+head+"}}", n)
+		flattenList(units, n.List)
+		if n.ElseList != nil {
+			add("else", "{{else}}", n.ElseList)
+			flattenList(units, n.ElseList)
+		}
+		add("end", "{{end}}", n)
+	default:
+		add(n.Type().String(), n.String(), n)
+	}
+}
+
+// diffUnits computes the longest common subsequence of the units and reports
+// the others as changes. A removal followed by an addition of the same kind
+// is reported as a modification.
+func diffUnits(name string, x, y []diffUnit) (changes []Change) {
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i].equal(y[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var removed, added []diffUnit
+	flush := func() {
+		for len(removed) > 0 && len(added) > 0 && removed[0].kind == added[0].kind {
+			changes = append(changes, Change{ChangeModified, name, removed[0].node, added[0].node, removed[0].text, added[0].text})
+			removed, added = removed[1:], added[1:]
+		}
+		for _, u := range removed {
+			changes = append(changes, Change{Kind: ChangeRemoved, Template: name, Old: u.node, OldText: u.text})
+		}
+		for _, u := range added {
+			changes = append(changes, Change{Kind: ChangeAdded, Template: name, New: u.node, NewText: u.text})
+		}
+		removed, added = nil, nil
+	}
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i].equal(y[j]):
+			flush()
+			i++
+			j++
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			removed = append(removed, x[i])
+			i++
+		default:
+			added = append(added, y[j])
+			j++
+		}
+	}
+	flush()
+	return
+}
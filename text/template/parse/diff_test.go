@@ -0,0 +1,45 @@
+package parse
+
+import (
+	"strings"
+	"testing"
+)
+
+var diffTests = []struct {
+	name    string
+	a, b    string
+	changes []string
+}{
+	{"equal", "a{{.X}}b", "a{{.X}}b", nil},
+	{"whitespace", "a  b\n{{.X|f}}", "  a b {{ .X | f }}", nil},
+	{"changed action", "a{{.X}}b", "a{{.Y}}b", []string{"t:1: changed {{.X}} to {{.Y}}"}},
+	{"added action", "a{{.X}}", "a{{.X}}\n{{.Y}}", []string{"t:2: added {{.Y}}"}},
+	{"removed text", "a{{.X}}b", "a{{.X}}", []string{`t:1: removed "b"`}},
+	{"changed expr", "{{1 + 2}}", "{{1 - 2}}", []string{"t:1: changed {{1 + 2}} to {{1 - 2}}"}},
+	{"control", "{{if .A}}x{{end}}", "{{if .B}}x{{else}}y{{end}}", []string{
+		"t:1: changed {{if .A}} to {{if .B}}",
+		"t:1: added {{else}}",
+		`t:1: added "y"`,
+	}},
+	{"define", `{{define "d"}}a{{end}}`, `{{define "d"}}b{{end}}`, []string{`d:1: changed "a" to "b"`}},
+}
+
+func TestDiffTrees(t *testing.T) {
+	for _, test := range diffTests {
+		a, err := Parse("t", test.a, "", "")
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		b, err := Parse("t", test.b, "", "")
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		var got []string
+		for _, c := range DiffTrees(a, b) {
+			got = append(got, c.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(test.changes, "\n") {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.name, strings.Join(got, "\n"), strings.Join(test.changes, "\n"))
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package parse
+
+import (
+	"errors"
+	"strings"
+)
+
+// Format returns the text of the template in the canonical form of its
+// actions: the runs of spaces inside the actions are replaced by a single
+// space, the spaces after the left delimiter and before the right one are
+// removed, and the pipes, the declarations and the assignments are
+// surrounded by spaces. The text out of the actions, the comments and the
+// strings are kept. The text must parse.
+//
+//	{{ $x:=.Items|len }}  →  {{$x := .Items | len}}
+func Format(text, leftDelim, rightDelim string) (string, error) {
+	if _, err := Parse("format", text, leftDelim, rightDelim); err != nil {
+		return "", err
+	}
+	if leftDelim == "" {
+		leftDelim = "{{"
+	}
+	l := lex("format", text, leftDelim, rightDelim)
+	defer l.drain()
+	var (
+		b      strings.Builder
+		last   Pos  // end of the text copied from the input.
+		inside bool // inside an action.
+		action []item
+	)
+	for {
+		it := l.nextItem()
+		switch it.typ {
+		case itemEOF:
+			b.WriteString(text[last:])
+			return b.String(), nil
+		case itemError:
+			return "", errors.New(it.val)
+		case itemLeftDelim:
+			b.WriteString(text[last:it.pos])
+			b.WriteString(it.val)
+			last = it.pos + Pos(len(it.val))
+			if strings.HasPrefix(text[last:], leftTrimMarker) {
+				b.WriteString(leftTrimMarker)
+			}
+			inside, action = true, action[:0]
+		case itemRightDelim:
+			formatAction(&b, action)
+			if strings.HasSuffix(text[:it.pos], rightTrimMarker) {
+				b.WriteString(rightTrimMarker)
+			}
+			b.WriteString(it.val)
+			last = it.pos + Pos(len(it.val))
+			inside = false
+		default:
+			if inside {
+				action = append(action, it)
+			}
+		}
+	}
+}
+
+// formatAction writes the items of an action in canonical form.
+func formatAction(b *strings.Builder, items []item) {
+	for len(items) > 0 && items[0].typ == itemSpace {
+		items = items[1:]
+	}
+	for len(items) > 0 && items[len(items)-1].typ == itemSpace {
+		items = items[:len(items)-1]
+	}
+	spaced := func(it item) bool {
+		switch it.typ {
+		case itemPipe, itemNodePipe, itemColonEquals, itemEquals, itemPlusEquals, itemSubEquals,
+			itemPowEquals, itemMultiplicatorEquals, itemDivEquals, itemModEquals, itemFloorEquals:
+			return true
+		}
+		return false
+	}
+	space := true // whether the written text ends with a space.
+	for i, it := range items {
+		switch {
+		case it.typ == itemSpace:
+			b.WriteString(" ")
+			space = true
+			continue
+		case spaced(it):
+			if !space {
+				b.WriteString(" ")
+			}
+			b.WriteString(it.val)
+			if i+1 < len(items) && items[i+1].typ != itemSpace {
+				b.WriteString(" ")
+			}
+		default:
+			b.WriteString(it.val)
+		}
+		space = strings.HasSuffix(it.val, " ")
+		if spaced(it) {
+			space = true
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package parse
+
+import "testing"
+
+func TestFormat(t *testing.T) {
+	for _, test := range []struct{ text, want string }{
+		{"a {{ $x:=.Items|len }} b", "a {{$x := .Items | len}} b"},
+		{"{{- .X -}}\n{{/*  c  */}}{{if  eq .A 1 }}x{{else}}y{{ end }}", "{{- .X -}}\n{{/*  c  */}}{{if eq .A 1}}x{{else}}y{{end}}"},
+		{`{{ .X | default: "a  b" }}{{$y := 1}}{{$y  =  2}}{{ 1 + 2 }}`, `{{.X | default: "a  b"}}{{$y := 1}}{{$y = 2}}{{1 + 2}}`},
+		{"{{range $i , $v := .L}}{{ printf `%d` $i }}{{end}}", "{{range $i , $v := .L}}{{printf `%d` $i}}{{end}}"},
+		{"{{define \"x\"}}{{(.A).B}}{{end}}", "{{define \"x\"}}{{(.A).B}}{{end}}"},
+	} {
+		got, err := Format(test.text, "", "")
+		if err != nil {
+			t.Errorf("%q: %v", test.text, err)
+		} else if got != test.want {
+			t.Errorf("%q: got %q, want %q", test.text, got, test.want)
+		}
+	}
+	if got, err := Format("[[ .X|f ]]", "[[", "]]"); err != nil || got != "[[.X | f]]" {
+		t.Errorf("got %q, %v", got, err)
+	}
+	if _, err := Format("{{if}}", "", ""); err == nil {
+		t.Error("want error of invalid template")
+	}
+}
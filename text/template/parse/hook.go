@@ -0,0 +1,121 @@
+package parse
+
+import (
+	"sort"
+	"strings"
+)
+
+// A TextHook rewrites the text between the actions of a template before
+// it's parsed, to implement light syntax sugar. It returns the replacements
+// of parts of the text, lexed as template source in their place. The items
+// of a replacement are reported at the position of the replaced part.
+type TextHook func(text string) []Replacement
+
+// Replacement replaces the bytes [Start, End) of a text with the template
+// source Source.
+type Replacement struct {
+	Start, End int
+	Source     string
+}
+
+// A TextFilter restricts the text hooks of a parse to parts of the text. It's
+// called with the texts between the actions, in the order of the source, so
+// it can follow a context across them, as html/template follows the HTML
+// context, and returns whether the hooks apply at each offset of the text.
+// A filter is created for each parse, see Tree.NewTextFilter.
+type TextFilter func(text string) (allow func(offset int) bool)
+
+// TemplateShorthand returns a TextHook expanding "@name" to
+// {{template "name" .}}. The name is a run of letters, digits and the
+// characters "_", "-", "." and "/", not ending with "." so that "@name." ends
+// a sentence. The "@" must not follow a letter or a digit, so that emails
+// are left as they are, and "@@" is a literal "@".
+func TemplateShorthand() TextHook {
+	return func(text string) (reps []Replacement) {
+		for i := 0; i < len(text); i++ {
+			if text[i] != '@' || i > 0 && isAlphaNumeric(rune(text[i-1])) {
+				continue
+			}
+			if strings.HasPrefix(text[i:], "@@") {
+				reps = append(reps, Replacement{i, i + 2, "@"})
+				i++
+				continue
+			}
+			end := i + 1
+			for end < len(text) && (isAlphaNumeric(rune(text[end])) || strings.IndexByte("-./", text[end]) >= 0) {
+				end++
+			}
+			for end > i+1 && text[end-1] == '.' {
+				end--
+			}
+			if end > i+1 {
+				reps = append(reps, Replacement{i, end, `{{template "` + text[i+1:end] + `" .}}`})
+				i = end - 1
+			}
+		}
+		return
+	}
+}
+
+// emitText emits the pending text, applying the text hooks. It reports false
+// if the replacement of a hook fails to lex.
+func (l *lexer) emitText() bool {
+	var reps []Replacement
+	text := l.input[l.start:l.pos]
+	for _, hook := range l.options.textHooks {
+		reps = append(reps, hook(text)...)
+	}
+	if filter := l.options.textFilter; filter != nil && len(l.options.textHooks) > 0 {
+		allow := filter(text)
+		kept := reps[:0]
+		for _, rep := range reps {
+			if allow(rep.Start) {
+				kept = append(kept, rep)
+			}
+		}
+		reps = kept
+	}
+	if len(reps) == 0 {
+		l.emit(itemText)
+		return true
+	}
+	// The replacements of the first hooks take precedence on overlaps.
+	sort.SliceStable(reps, func(i, j int) bool {
+		return reps[i].Start < reps[j].Start
+	})
+	start, line, cur := l.start, l.line, 0
+	emit := func(end int) {
+		if end > cur {
+			l.items <- item{itemText, start + Pos(cur), text[cur:end], line, nil}
+			line += strings.Count(text[cur:end], "\n")
+		}
+	}
+	for _, rep := range reps {
+		if rep.Start < cur || rep.End < rep.Start || rep.End > len(text) {
+			continue
+		}
+		emit(rep.Start)
+		sub := lexWith(l.name, rep.Source, l.leftDelim, l.rightDelim, lexOptions{
+			maxActionLen: l.options.maxActionLen,
+			emitComment:  l.options.emitComment,
+		})
+		for {
+			it := sub.nextItem()
+			if it.typ == itemEOF {
+				break
+			}
+			it.pos, it.line = start+Pos(rep.Start), line
+			l.items <- it
+			if it.typ == itemError {
+				sub.drain()
+				return false
+			}
+		}
+		line += strings.Count(text[rep.Start:rep.End], "\n")
+		cur = rep.End
+	}
+	emit(len(text))
+	l.line = line
+	l.start = l.pos
+	return true
+}
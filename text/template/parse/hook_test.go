@@ -0,0 +1,92 @@
+package parse
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestTemplateShorthand(t *testing.T) {
+	for _, test := range []struct{ text, want string }{
+		{"@header", `{{template "header" .}}`},
+		{"a @x/y-z.html b", `"a "{{template "x/y-z.html" .}}" b"`},
+		{"see @note.", `"see "{{template "note" .}}"."`},
+		{"me@example.com", `"me@example.com"`},
+		{"@@x @ y", `"@""x @ y"`},
+		{"{{if .}}@a{{end}}\n@b", `{{if .}}{{template "a" .}}{{end}}"\n"{{template "b" .}}`},
+	} {
+		tree := New("root")
+		tree.TextHooks = []TextHook{TemplateShorthand()}
+		if _, err := tree.Parse(test.text, "", "", make(map[string]*Tree)); err != nil {
+			t.Errorf("%q: %v", test.text, err)
+			continue
+		}
+		var got strings.Builder
+		for _, n := range tree.Root.Nodes {
+			if text, ok := n.(*TextNode); ok {
+				got.WriteString(strconv.Quote(string(text.Text)))
+			} else {
+				got.WriteString(n.String())
+			}
+		}
+		if got.String() != test.want {
+			t.Errorf("%q: got %s, want %s", test.text, got.String(), test.want)
+		}
+	}
+}
+
+func TestTextHookErrors(t *testing.T) {
+	broken := func(text string) []Replacement {
+		if i := strings.Index(text, "!"); i >= 0 {
+			return []Replacement{{i, i + 1, "{{if"}}
+		}
+		return nil
+	}
+	tree := New("root")
+	tree.TextHooks = []TextHook{broken}
+	_, err := tree.Parse("a\nb!", "", "", make(map[string]*Tree))
+	if err == nil || !strings.Contains(err.Error(), "root:2:") {
+		t.Errorf("got error %v, want it on line 2", err)
+	}
+}
+
+func TestTextFilter(t *testing.T) {
+	// The filter skips the hooks from "off" until "on", across the actions.
+	newFilter := func() TextFilter {
+		on := true
+		return func(text string) func(offset int) bool {
+			var offs []int
+			for i := 0; i < len(text); i++ {
+				switch {
+				case strings.HasPrefix(text[i:], "off"):
+					on = false
+				case strings.HasPrefix(text[i:], "on"):
+					on = true
+				}
+				if !on {
+					offs = append(offs, i)
+				}
+			}
+			return func(offset int) bool {
+				for _, off := range offs {
+					if off == offset {
+						return false
+					}
+				}
+				return true
+			}
+		}
+	}
+	for i := 0; i < 2; i++ {
+		tree := New("root")
+		tree.TextHooks = []TextHook{TemplateShorthand()}
+		tree.NewTextFilter = newFilter
+		if _, err := tree.Parse("@a off @b{{.}}@c on @d off", "", "", make(map[string]*Tree)); err != nil {
+			t.Fatal(err)
+		}
+		const want = `{{template "a" .}} off @b{{.}}@c on {{template "d" .}} off`
+		if got := tree.Root.String(); got != want {
+			t.Errorf("parse %d: got %s, want %s", i, got, want)
+		}
+	}
+}
@@ -43,10 +43,12 @@ const (
 	itemChar                         // printable ASCII character; grab bag for comma etc.
 	itemCharConstant                 // character constant
 	itemComplex                      // complex constant (1+2i); imaginary is just a number
+	itemComment                      // comment text
 
 	// variable and math operators
 	itemMathExpr            // mathematical expression
 	itemColonEquals         // colon-equals (':=') introducing a declaration
+	itemColon               // colon (':') ending the function name of a filter
 	itemEquals              // colon-equals ('=') set value to field or variable
 	itemPlusEquals          // plus-equals ('+=') concat or sum previous declaration
 	itemSubEquals           // sub-equals ('-=') subtract previous declaration
@@ -90,6 +92,7 @@ const (
 	itemBegin
 	itemEnter
 	itemAfter
+	itemReturn // return keyword
 	itemPtr
 )
 
@@ -110,6 +113,7 @@ var key = map[string]itemType{
 	"begin":    itemBegin,
 	"enter":    itemEnter,
 	"after":    itemAfter,
+	"return":   itemReturn,
 }
 
 const eof = -1
@@ -146,6 +150,17 @@ type lexer struct {
 	items      chan item // channel of scanned items
 	parenDepth int       // nesting depth of ( ) exprs
 	line       int       // 1+number of newlines seen
+	// actionStart is the position of the left delimiter of the current action.
+	actionStart Pos
+	options     lexOptions
+}
+
+// lexOptions configures optional lexer behaviors.
+type lexOptions struct {
+	maxActionLen int  // maximum length of an action; 0 means no limit.
+	emitComment  bool // emit itemComment tokens.
+	textHooks    []TextHook
+	textFilter   TextFilter
 }
 
 // next returns the next rune in the input.
@@ -184,7 +199,7 @@ func (l *lexer) emit(t itemType, args ...interface{}) {
 	l.items <- item{t, l.start, l.input[l.start:l.pos], l.line, args}
 	// Some items contain text internally. If so, count their newlines.
 	switch t {
-	case itemText, itemRawString, itemLeftDelim, itemRightDelim:
+	case itemText, itemRawString, itemLeftDelim, itemRightDelim, itemComment:
 		l.line += strings.Count(l.input[l.start:l.pos], "\n")
 	}
 	l.start = l.pos
@@ -235,6 +250,11 @@ func (l *lexer) drain() {
 
 // lex creates a new scanner for the input string.
 func lex(name, input, left, right string) *lexer {
+	return lexWith(name, input, left, right, lexOptions{})
+}
+
+// lexWith creates a new scanner for the input string using options.
+func lexWith(name, input, left, right string, options lexOptions) *lexer {
 	if left == "" {
 		left = leftDelim
 	}
@@ -248,6 +268,7 @@ func lex(name, input, left, right string) *lexer {
 		rightDelim: right,
 		items:      make(chan item),
 		line:       1,
+		options:    options,
 	}
 	go l.run()
 	return l
@@ -281,8 +302,8 @@ func lexText(l *lexer) stateFn {
 			trimLength = rightTrimLength(l.input[l.start:l.pos])
 		}
 		l.pos -= trimLength
-		if l.pos > l.start {
-			l.emit(itemText)
+		if l.pos > l.start && !l.emitText() {
+			return nil
 		}
 		l.pos += trimLength
 		l.ignore()
@@ -291,8 +312,8 @@ func lexText(l *lexer) stateFn {
 		l.pos = Pos(len(l.input))
 	}
 	// Correctly reached EOF.
-	if l.pos > l.start {
-		l.emit(itemText)
+	if l.pos > l.start && !l.emitText() {
+		return nil
 	}
 	l.emit(itemEOF)
 	return nil
@@ -324,6 +345,7 @@ func leftTrimLength(s string) Pos {
 
 // lexLeftDelim scans the left delimiter, which is known to be present, possibly with a trim marker.
 func lexLeftDelim(l *lexer) stateFn {
+	l.actionStart = l.pos
 	l.pos += Pos(len(l.leftDelim))
 	trimSpace := strings.HasPrefix(l.input[l.pos:], leftTrimMarker)
 	afterMarker := Pos(0)
@@ -342,6 +364,11 @@ func lexLeftDelim(l *lexer) stateFn {
 	return lexInsideAction
 }
 
+// actionTooLong reports whether the current action exceeds the maximum length.
+func (l *lexer) actionTooLong() bool {
+	return l.options.maxActionLen > 0 && int(l.pos-l.actionStart) > l.options.maxActionLen
+}
+
 // lexComment scans a comment. The left comment marker is known to be present.
 func lexComment(l *lexer) stateFn {
 	l.pos += Pos(len(leftComment))
@@ -350,10 +377,16 @@ func lexComment(l *lexer) stateFn {
 		return l.errorf("unclosed comment")
 	}
 	l.pos += Pos(i + len(rightComment))
+	if l.actionTooLong() {
+		return l.errorf("comment exceeds maximum length of %d bytes", l.options.maxActionLen)
+	}
 	delim, trimSpace := l.atRightDelim()
 	if !delim {
 		return l.errorf("comment ends before closing delimiter")
 	}
+	if l.options.emitComment || isPragma(l.input[l.start:l.pos]) {
+		l.emit(itemComment)
+	}
 	if trimSpace {
 		l.pos += trimMarkerLen
 	}
@@ -386,6 +419,9 @@ func lexInsideAction(l *lexer) stateFn {
 	// Either number, quoted string, or identifier.
 	// Spaces separate arguments; runs of spaces turn into itemSpace.
 	// Pipe symbols separate and are emitted.
+	if l.actionTooLong() {
+		return l.errorf("action exceeds maximum length of %d bytes", l.options.maxActionLen)
+	}
 	delim, _ := l.atRightDelim()
 	if delim {
 		if l.parenDepth == 0 {
@@ -400,7 +436,9 @@ func lexInsideAction(l *lexer) stateFn {
 		return lexSpace
 	case r == ':':
 		if l.next() != '=' {
-			return l.errorf("expected :=")
+			l.backup()
+			l.emit(itemColon)
+			break
 		}
 		l.emit(itemColonEquals)
 	case r == '=':
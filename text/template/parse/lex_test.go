@@ -16,7 +16,9 @@ var itemName = map[itemType]string{
 	itemChar:         "char",
 	itemCharConstant: "charconst",
 	itemComplex:      "complex",
+	itemComment:      "comment",
 	itemColonEquals:  ":=",
+	itemColon:        ":",
 	itemEOF:          "EOF",
 	itemField:        "field",
 	itemIdentifier:   "identifier",
@@ -290,6 +292,19 @@ var lexTests = []lexTest{
 		tRight,
 		tEOF,
 	}},
+	{"filter", "{{.X | default: 3}}", []item{
+		tLeft,
+		mkItem(itemField, ".X"),
+		tSpace,
+		tPipe,
+		tSpace,
+		mkItem(itemIdentifier, "default"),
+		mkItem(itemColon, ":"),
+		tSpace,
+		mkItem(itemNumber, "3"),
+		tRight,
+		tEOF,
+	}},
 	{"field of parenthesized expression", "{{(.X).Y}}", []item{
 		tLeft,
 		tLpar,
@@ -462,21 +477,21 @@ func TestDelims(t *testing.T) {
 var lexPosTests = []lexTest{
 	{"empty", "", []item{tEOF}},
 	{"punctuation", "{{,@%#}}", []item{
-		{itemLeftDelim, 0, "{{", 1},
-		{itemChar, 2, ",", 1},
-		{itemChar, 3, "@", 1},
-		{itemChar, 4, "%", 1},
-		{itemChar, 5, "#", 1},
-		{itemRightDelim, 6, "}}", 1},
-		{itemEOF, 8, "", 1},
+		{itemLeftDelim, 0, "{{", 1, nil},
+		{itemChar, 2, ",", 1, nil},
+		{itemChar, 3, "@", 1, nil},
+		{itemChar, 4, "%", 1, nil},
+		{itemChar, 5, "#", 1, nil},
+		{itemRightDelim, 6, "}}", 1, nil},
+		{itemEOF, 8, "", 1, nil},
 	}},
 	{"sample", "0123{{hello}}xyz", []item{
-		{itemText, 0, "0123", 1},
-		{itemLeftDelim, 4, "{{", 1},
-		{itemIdentifier, 6, "hello", 1},
-		{itemRightDelim, 11, "}}", 1},
-		{itemText, 13, "xyz", 1},
-		{itemEOF, 16, "", 1},
+		{itemText, 0, "0123", 1, nil},
+		{itemLeftDelim, 4, "{{", 1, nil},
+		{itemIdentifier, 6, "hello", 1, nil},
+		{itemRightDelim, 11, "}}", 1, nil},
+		{itemText, 13, "xyz", 1, nil},
+		{itemEOF, 16, "", 1, nil},
 	}},
 }
 
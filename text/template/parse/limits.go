@@ -0,0 +1,67 @@
+package parse
+
+// Limits bounds the resources used to parse a template, so pathological
+// inputs are rejected while parsing instead of at execution time.
+// Zero values mean no limit.
+type Limits struct {
+	// MaxNodes is the maximum number of parsed texts, actions, commands and
+	// operands, counted across all of the templates defined by the input.
+	MaxNodes int
+	// MaxNesting is the maximum depth of nested control structures (if,
+	// range, with, wrap, ...) and parenthesized pipelines.
+	MaxNesting int
+	// MaxActionLen is the maximum length in bytes of an action or comment,
+	// including its left delimiter.
+	MaxActionLen int
+}
+
+// limitCounter holds the resource usage of a parse. It is shared by the
+// trees created by the parse.
+type limitCounter struct {
+	nodes   int
+	nesting int
+}
+
+// ParseWithLimits is like Parse, but rejects inputs exceeding the limits.
+func ParseWithLimits(name, text, leftDelim, rightDelim string, limits Limits) (map[string]*Tree, error) {
+	treeSet := make(map[string]*Tree)
+	t := New(name)
+	t.Limits = limits
+	t.text = text
+	_, err := t.Parse(text, leftDelim, rightDelim, treeSet)
+	return treeSet, err
+}
+
+// inherit copies the parse settings of t to the sub tree s, a template
+// defined inside of t.
+func (t *Tree) inherit(s *Tree) {
+	s.Limits = t.Limits
+	s.Mode = t.Mode
+	s.TextHooks = t.TextHooks
+	s.NewTextFilter = t.NewTextFilter
+	s.counter = t.counter
+}
+
+// countNode accounts a new node, failing if there are too many.
+func (t *Tree) countNode() {
+	if t.Limits.MaxNodes <= 0 {
+		return
+	}
+	if t.counter.nodes++; t.counter.nodes > t.Limits.MaxNodes {
+		t.errorf("too many nodes: maximum is %d", t.Limits.MaxNodes)
+	}
+}
+
+// enterNesting increments the nesting depth, failing if it's too deep.
+// The returned function restores the depth.
+func (t *Tree) enterNesting() func() {
+	if t.Limits.MaxNesting <= 0 {
+		return func() {}
+	}
+	if t.counter.nesting++; t.counter.nesting > t.Limits.MaxNesting {
+		t.errorf("nesting too deep: maximum is %d", t.Limits.MaxNesting)
+	}
+	return func() {
+		t.counter.nesting--
+	}
+}
@@ -0,0 +1,38 @@
+package parse
+
+import (
+	"strings"
+	"testing"
+)
+
+var limitsTests = []struct {
+	name   string
+	input  string
+	limits Limits
+	err    string
+}{
+	{"no limits", `{{if .}}{{range .}}{{.}}{{end}}{{end}}`, Limits{}, ""},
+	{"nodes ok", `a{{.X}}b`, Limits{MaxNodes: 5}, ""},
+	{"too many nodes", `a{{.X}}b{{.Y}}c`, Limits{MaxNodes: 5}, "too many nodes: maximum is 5"},
+	{"nodes across defines", `{{define "a"}}{{.}}{{end}}{{.}}`, Limits{MaxNodes: 4}, "too many nodes: maximum is 4"},
+	{"nesting ok", `{{if .}}{{with .}}x{{end}}{{end}}`, Limits{MaxNesting: 2}, ""},
+	{"nesting too deep", `{{if .}}{{with .}}{{range .}}x{{end}}{{end}}{{end}}`, Limits{MaxNesting: 2}, "nesting too deep: maximum is 2"},
+	{"parens nesting", `{{(((1)))}}`, Limits{MaxNesting: 2}, "nesting too deep: maximum is 2"},
+	{"action ok", `{{.Abc}}`, Limits{MaxActionLen: 8}, ""},
+	{"action too long", `{{.Abcdefgh}}`, Limits{MaxActionLen: 8}, "action exceeds maximum length of 8 bytes"},
+	{"comment too long", `{{/* long comment */}}`, Limits{MaxActionLen: 8}, "comment exceeds maximum length of 8 bytes"},
+}
+
+func TestParseWithLimits(t *testing.T) {
+	for _, test := range limitsTests {
+		_, err := ParseWithLimits(test.name, test.input, "", "", test.limits)
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		case test.err != "" && err == nil:
+			t.Errorf("%s: expected error %q", test.name, test.err)
+		case test.err != "" && !strings.Contains(err.Error(), test.err):
+			t.Errorf("%s: got error %q, want %q", test.name, err, test.err)
+		}
+	}
+}
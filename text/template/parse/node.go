@@ -12,6 +12,9 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync/atomic"
+
+	"github.com/moisespsena-go/umbu/text/template/internal/nodeplan"
 )
 
 var textFormat = "%s" // Changed to "%q" in tests for better error messages.
@@ -93,6 +96,9 @@ const (
 	nodeAfter
 	NodeVal
 	NodeValFactory
+	NodeComment // A comment.
+	NodeCustom  // A custom keyword action.
+	NodeReturn  // A return action.
 )
 
 var nodeName = map[NodeType]string{
@@ -124,6 +130,9 @@ var nodeName = map[NodeType]string{
 	nodeAfter:      "after",
 	NodeVal:        "val",
 	NodeValFactory: "val_factory",
+	NodeComment:    "comment",
+	NodeCustom:     "custom",
+	NodeReturn:     "return",
 }
 
 // Nodes.
@@ -195,6 +204,30 @@ func (t *TextNode) Copy() Node {
 	return &TextNode{tr: t.tr, NodeType: NodeText, Pos: t.Pos, Text: append([]byte{}, t.Text...)}
 }
 
+// CommentNode holds a comment.
+type CommentNode struct {
+	NodeType
+	Pos
+	tr   *Tree
+	Text string // Comment text.
+}
+
+func (t *Tree) newComment(pos Pos, text string) *CommentNode {
+	return &CommentNode{tr: t, NodeType: NodeComment, Pos: pos, Text: text}
+}
+
+func (c *CommentNode) String() string {
+	return "{{" + c.Text + "}}"
+}
+
+func (c *CommentNode) tree() *Tree {
+	return c.tr
+}
+
+func (c *CommentNode) Copy() Node {
+	return &CommentNode{tr: c.tr, NodeType: NodeComment, Pos: c.Pos, Text: c.Text}
+}
+
 // PipeNode holds a pipeline with optional declaration
 type PipeNode struct {
 	NodeType
@@ -204,6 +237,10 @@ type PipeNode struct {
 	Decl      []*VariableNode // Variable declarations in lexical order.
 	Cmds      []*CommandNode  // The commands in lexical order.
 	TrimRight bool
+	// OkDecl tells whether the declarations are the ones of the value and
+	// the ok of a call returning two values, as in
+	// {{if $v, $ok := lookup .Key}}.
+	OkDecl bool
 }
 
 func (t *Tree) newPipeline(pos Pos, line int, decl []*VariableNode) *PipeNode {
@@ -247,6 +284,7 @@ func (p *PipeNode) CopyPipe() *PipeNode {
 		decl = append(decl, d.Copy().(*VariableNode))
 	}
 	n := p.tr.newPipeline(p.Pos, p.Line, decl)
+	n.OkDecl = p.OkDecl
 	for _, c := range p.Cmds {
 		n.append(c.Copy().(*CommandNode))
 	}
@@ -292,6 +330,18 @@ type CommandNode struct {
 	Pos
 	tr   *Tree
 	Args []Node // Arguments in lexical order: Identifier, field, or constant.
+	// Filter tells the filter form, "name: args", receiving the previous
+	// value of the pipeline as its first argument.
+	Filter bool
+	// plan caches the analysis of the calls of the command by the
+	// executor, as the types of the arguments. It isn't part of the tree.
+	plan atomic.Value
+}
+
+func init() {
+	nodeplan.Plan = func(cmd interface{}) *atomic.Value {
+		return &cmd.(*CommandNode).plan
+	}
 }
 
 func (t *Tree) newCommand(pos Pos) *CommandNode {
@@ -313,6 +363,9 @@ func (c *CommandNode) String() string {
 			continue
 		}
 		s += arg.String()
+		if i == 0 && c.Filter {
+			s += ":"
+		}
 	}
 	return s
 }
@@ -326,12 +379,22 @@ func (c *CommandNode) Copy() Node {
 		return c
 	}
 	n := c.tr.newCommand(c.Pos)
+	n.Filter = c.Filter
 	for _, c := range c.Args {
 		n.append(c.Copy())
 	}
 	return n
 }
 
+// WithArgs returns a shallow copy of the command with the arguments, for
+// the executor evaluating a part of the command.
+func (c *CommandNode) WithArgs(args ...Node) *CommandNode {
+	n := c.tr.newCommand(c.Pos)
+	n.Filter = c.Filter
+	n.Args = args
+	return n
+}
+
 // IdentifierNode holds an identifier.
 type IdentifierNode struct {
 	NodeType
@@ -1056,10 +1119,17 @@ func (w *CallbackNode) Copy() Node {
 type TemplateNode struct {
 	NodeType
 	Pos
-	tr   *Tree
-	Line int       // The line number in the input. Deprecated: Kept for compatibility.
-	Name string    // The name of the template (unquoted).
-	Pipe *PipeNode // The command to evaluate as dot for the template.
+	tr    *Tree
+	Line  int       // The line number in the input. Deprecated: Kept for compatibility.
+	Name  string    // The name of the template (unquoted), empty if dynamic.
+	Pipe  *PipeNode // The command to evaluate as dot for the template.
+	Block bool      // The template was defined by a {{block}} action.
+	// NameNode is the operand evaluating to the name of the template, nil
+	// if the name is constant.
+	NameNode Node
+	// Value tells whether the template is invoked as an operand, for its
+	// result, as in {{$total := template "calc" .Items}}.
+	Value bool
 }
 
 func (t *Tree) newTemplate(pos Pos, line int, name string, pipe *PipeNode) *TemplateNode {
@@ -1067,10 +1137,21 @@ func (t *Tree) newTemplate(pos Pos, line int, name string, pipe *PipeNode) *Temp
 }
 
 func (t *TemplateNode) String() string {
-	if t.Pipe == nil {
-		return fmt.Sprintf("{{template %q}}", t.Name)
+	name := strconv.Quote(t.Name)
+	if t.NameNode != nil {
+		name = t.NameNode.String()
+		if _, ok := t.NameNode.(*PipeNode); ok {
+			name = "(" + name + ")"
+		}
+	}
+	s := "template " + name
+	if t.Pipe != nil {
+		s += " " + t.Pipe.String()
+	}
+	if t.Value {
+		return s
 	}
-	return fmt.Sprintf("{{template %q %s}}", t.Name, t.Pipe)
+	return "{{" + s + "}}"
 }
 
 func (t *TemplateNode) tree() *Tree {
@@ -1078,7 +1159,42 @@ func (t *TemplateNode) tree() *Tree {
 }
 
 func (t *TemplateNode) Copy() Node {
-	return t.tr.newTemplate(t.Pos, t.Line, t.Name, t.Pipe.CopyPipe())
+	n := t.tr.newTemplate(t.Pos, t.Line, t.Name, t.Pipe.CopyPipe())
+	n.Block = t.Block
+	n.Value = t.Value
+	if t.NameNode != nil {
+		n.NameNode = t.NameNode.Copy()
+	}
+	return n
+}
+
+// ReturnNode represents a {{return}} action, ending the execution of the
+// template with the value of its pipeline as its result.
+type ReturnNode struct {
+	NodeType
+	Pos
+	tr   *Tree
+	Line int       // The line number in the input. Deprecated: Kept for compatibility.
+	Pipe *PipeNode // The value returned, nil if none.
+}
+
+func (t *Tree) newReturn(pos Pos, line int, pipe *PipeNode) *ReturnNode {
+	return &ReturnNode{tr: t, NodeType: NodeReturn, Pos: pos, Line: line, Pipe: pipe}
+}
+
+func (r *ReturnNode) String() string {
+	if r.Pipe == nil {
+		return "{{return}}"
+	}
+	return fmt.Sprintf("{{return %s}}", r.Pipe)
+}
+
+func (r *ReturnNode) tree() *Tree {
+	return r.tr
+}
+
+func (r *ReturnNode) Copy() Node {
+	return r.tr.newReturn(r.Pos, r.Line, r.Pipe.CopyPipe())
 }
 
 // ValFactoryNode holds a value constant.
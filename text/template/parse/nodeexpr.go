@@ -16,7 +16,7 @@ func (t *Tree) newExpr(pos Pos, op rune, a, b *CommandNode) *ExprNode {
 }
 
 func (n *ExprNode) String() string {
-	return string(n.Op)
+	return n.A.String() + " " + string(n.Op) + " " + n.B.String()
 }
 
 func (n *ExprNode) tree() *Tree {
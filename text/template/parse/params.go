@@ -0,0 +1,81 @@
+package parse
+
+import "strings"
+
+// Param is a parameter declared by the parameter list of a {{define}}
+// action:
+//
+//	{{define "card" (title string, items []Item)}}
+//
+// The parameters are bound to variables named after them ($title and
+// $items) and the type, optional, is a Go type name: a basic type such as
+// string or int, a named type such as Item or pkg.Item, or a slice of them.
+// The template calls are checked against the parameters when the template is
+// added to its set.
+type Param struct {
+	Name string // name of the variable, with the leading '$'.
+	Type string // declared type, empty if untyped.
+}
+
+func (p Param) String() string {
+	if p.Type == "" {
+		return p.Name[1:]
+	}
+	return p.Name[1:] + " " + p.Type
+}
+
+// Params returns the parameters declared by the parameter list of the
+// {{define}} action, nil if the template declares its arguments as
+// variables.
+func (t *Tree) Params() []Param {
+	return t.params
+}
+
+// parseParams parses the parameter list of a definition, after its left
+// paren:
+//
+//	name type?, ...)
+func (t *Tree) parseParams(context string) {
+	t.params = []Param{}
+	for {
+		token := t.nextNonSpace()
+		if token.typ == itemRightParen && len(t.params) == 0 {
+			return
+		}
+		var p Param
+		switch token.typ {
+		case itemIdentifier:
+			p.Name = "$" + token.val
+		case itemVariable:
+			p.Name = token.val
+		default:
+			t.unexpected(token, context)
+		}
+		for _, arg := range t.args {
+			if arg == p.Name {
+				t.errorf("duplicate parameter %s in %s", p.Name[1:], context)
+			}
+		}
+		var typ strings.Builder
+	Type:
+		for {
+			token = t.next()
+			switch {
+			case token.typ == itemSpace:
+			case token.typ == itemRightParen, token.typ == itemChar && token.val == ",":
+				break Type
+			case token.typ == itemIdentifier, token.typ == itemField,
+				token.typ == itemChar && (token.val == "[" || token.val == "]"):
+				typ.WriteString(token.val)
+			default:
+				t.unexpected(token, context)
+			}
+		}
+		p.Type = typ.String()
+		t.params = append(t.params, p)
+		t.args = append(t.args, p.Name)
+		if token.typ == itemRightParen {
+			return
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package parse
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParams(t *testing.T) {
+	for _, test := range []struct {
+		text, params, args string
+	}{
+		{`{{define "x" (title string, items []Item, $n, u pkg.User)}}{{end}}`, "[title string items []Item n u pkg.User]", "[$title $items $n $u]"},
+		{`{{define "x" ()}}{{end}}`, "[]", "[]"},
+		{`{{define "x" $a $b}}{{end}}`, "[]", "[$a $b]"},
+	} {
+		trees := make(map[string]*Tree)
+		if _, err := New("root").Parse(test.text, "", "", trees); err != nil {
+			t.Errorf("%s: %v", test.text, err)
+			continue
+		}
+		x := trees["x"]
+		if got := fmt.Sprint(x.Params()); got != test.params {
+			t.Errorf("%s: got params %s, want %s", test.text, got, test.params)
+		}
+		if got := fmt.Sprint(x.Args()); got != test.args {
+			t.Errorf("%s: got args %s, want %s", test.text, got, test.args)
+		}
+	}
+}
+
+func TestParamsErrors(t *testing.T) {
+	for _, test := range []struct{ text, err string }{
+		{`{{define "x" (a string, a int)}}{{end}}`, "duplicate parameter a"},
+		{`{{define "x" (a string}}{{end}}`, "unexpected"},
+		{`{{define "x" ("a")}}{{end}}`, "unexpected"},
+		{`{{define "x" (a) $b}}{{end}}`, "unexpected"},
+	} {
+		_, err := New("root").Parse(test.text, "", "", make(map[string]*Tree))
+		if err == nil {
+			t.Errorf("%s: expected error", test.text)
+		} else if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got error %q, want %q", test.text, err, test.err)
+		}
+	}
+}
@@ -11,6 +11,7 @@ package parse
 import (
 	"bytes"
 	"fmt"
+	"maps"
 	"runtime"
 	"strconv"
 	"strings"
@@ -31,9 +32,29 @@ type Tree struct {
 	vars             []string // variables defined at the moment.
 	InheritedVarsLen int      // variables defined at the moment on parent tree.
 	args             []string // arguments defined in initial scope
+	params           []Param  // parameters declared by the definition.
 	treeSet          map[string]*Tree
+	Limits           Limits        // resource limits of the parse.
+	counter          *limitCounter // resource usage of the parse.
+	Mode             Mode          // parsing mode.
+	Pragmas          []Pragma      // directives found in the comments.
+	TextHooks        []TextHook    // rewriters of the text between actions.
+	Vars             []string      // variables declared before the text, as "$x".
+
+	// NewTextFilter, if set, returns the filter of the TextHooks of a parse.
+	NewTextFilter func() TextFilter
+
+	// options are the values of the "umbu:option" pragmas, by key.
+	options map[string]string
 }
 
+// A Mode value is a set of flags (or 0). Modes control parser behavior.
+type Mode uint
+
+const (
+	ParseComments Mode = 1 << iota // parse comments and add them to AST
+)
+
 func (t *Tree) Args() []string {
 	return t.args
 }
@@ -52,6 +73,10 @@ func (t *Tree) Copy() *Tree {
 		ParseName: t.ParseName,
 		Root:      t.Root.CopyList(),
 		text:      t.text,
+		args:      append(t.args[:0:0], t.args...),
+		params:    append(t.params[:0:0], t.params...),
+		Pragmas:   append([]Pragma(nil), t.Pragmas...),
+		options:   maps.Clone(t.options),
 	}
 }
 
@@ -215,7 +240,7 @@ func (t *Tree) recover(errp *error) {
 func (t *Tree) startParse(lex *lexer, treeSet map[string]*Tree) {
 	t.Root = nil
 	t.lex = lex
-	t.vars = []string{"$"}
+	t.vars = append([]string{"$"}, t.Vars...)
 	t.treeSet = treeSet
 }
 
@@ -233,9 +258,20 @@ func (t *Tree) stopParse() {
 func (t *Tree) Parse(text, leftDelim, rightDelim string, treeSet map[string]*Tree) (tree *Tree, err error) {
 	defer t.recover(&err)
 	t.ParseName = t.Name
-	t.startParse(lex(t.Name, text, leftDelim, rightDelim), treeSet)
+	t.counter = &limitCounter{}
+	var filter TextFilter
+	if t.NewTextFilter != nil {
+		filter = t.NewTextFilter()
+	}
+	t.startParse(lexWith(t.Name, text, leftDelim, rightDelim, lexOptions{
+		maxActionLen: t.Limits.MaxActionLen,
+		emitComment:  t.Mode&ParseComments != 0,
+		textHooks:    t.TextHooks,
+		textFilter:   filter,
+	}), treeSet)
 	t.text = text
 	t.parse()
+	t.applyPragmas()
 	t.add()
 	t.stopParse()
 	return t, nil
@@ -271,7 +307,15 @@ func IsEmptyTree(n Node) bool {
 	case *TemplateNode:
 	case *TextNode:
 		return len(bytes.TrimSpace(n.Text)) == 0
+	case *CommentNode:
+		return true
 	case *WithNode:
+	case *ArgNode:
+	case *CallbackNode:
+	case *WrapNode:
+	case *ValNode:
+	case *CustomNode:
+	case *ReturnNode:
 	default:
 		panic("unknown node: " + n.String())
 	}
@@ -290,6 +334,7 @@ func (t *Tree) parse() {
 				newT := New("definition") // name will be updated once we know it.
 				newT.text = t.text
 				newT.ParseName = t.ParseName
+				t.inherit(newT)
 				newT.startParse(t.lex, t.treeSet)
 				newT.vars = t.vars // inherit variables at execution point
 				newT.InheritedVarsLen = len(t.vars)
@@ -319,12 +364,18 @@ func (t *Tree) parseDefinition() {
 		t.error(err)
 	}
 
-	for {
-		token := t.expectOneOf(itemRightDelim, itemVariable, context)
-		if token.typ != itemVariable {
-			break
+	if t.peekNonSpace().typ == itemLeftParen {
+		t.nextNonSpace()
+		t.parseParams(context)
+		t.expect(itemRightDelim, context)
+	} else {
+		for {
+			token := t.expectOneOf(itemRightDelim, itemVariable, context)
+			if token.typ != itemVariable {
+				break
+			}
+			t.args = append(t.args, token.val)
 		}
-		t.args = append(t.args, token.val)
 	}
 
 	var end Node
@@ -332,6 +383,7 @@ func (t *Tree) parseDefinition() {
 	if end.Type() != nodeEnd {
 		t.errorf("unexpected %s in %s", end, context)
 	}
+	t.applyPragmas()
 	t.add()
 	t.stopParse()
 }
@@ -381,9 +433,15 @@ func (t *Tree) untilItemList(at ...NodeType) (list *ListNode, next Node) {
 //
 //	text | action
 func (t *Tree) textOrAction() Node {
+	t.countNode()
 	switch token := t.nextNonSpace(); token.typ {
 	case itemText:
 		return t.newText(token.pos, token.val)
+	case itemComment:
+		if isPragma(token.val) {
+			t.parsePragma(token.pos, token.val)
+		}
+		return t.newComment(token.pos, token.val)
 	case itemLeftDelim:
 		return t.action()
 	default:
@@ -427,6 +485,12 @@ func (t *Tree) action() (n Node) {
 		return t.enterControl()
 	case itemAfter:
 		return t.afterControl()
+	case itemReturn:
+		return t.returnControl()
+	case itemIdentifier:
+		if k, ok := LookupKeyword(token.val); ok {
+			return t.customControl(k, token)
+		}
 	}
 	t.backup()
 	token := t.peek()
@@ -472,7 +536,7 @@ func (t *Tree) pipeline(context parseContext) (pipe *PipeNode) {
 				decl = append(decl, variable)
 				t.vars = append(t.vars, v.val)
 				if next.typ == itemChar && next.val == "," {
-					if context.name == "range" && len(decl) < 3 {
+					if context.name == "range" && len(decl) < 3 || context.name != "range" && len(decl) < 2 {
 						continue
 					}
 					t.errorf("too many declarations in <%v>", context.name)
@@ -551,6 +615,7 @@ func (t *Tree) pipeline(context parseContext) (pipe *PipeNode) {
 		break
 	}
 	pipe = t.newPipeline(pos, token.line, decl)
+	pipe.OkDecl = len(decl) == 2 && context.name != "range"
 	for {
 		switch token := t.nextNonSpace(); token.typ {
 		case itemRightDelim, itemRightParen:
@@ -558,6 +623,9 @@ func (t *Tree) pipeline(context parseContext) (pipe *PipeNode) {
 			if !context.optionalPipe {
 				t.checkPipeline(pipe, context.name)
 			}
+			if pipe.OkDecl {
+				t.checkOkDecl(pipe, context.name)
+			}
 
 			switch token.typ {
 			case itemRightDelim:
@@ -588,6 +656,21 @@ func (t *Tree) pipeline(context parseContext) (pipe *PipeNode) {
 			}
 		case itemBegin, itemEnter, itemAfter:
 			pipe.append(t.command())
+		case itemTemplate:
+			// The template invoked for its result, as in
+			// {{$total := template "calc" .Items}}, ends the pipeline.
+			if len(pipe.Decl) == 0 || len(pipe.Cmds) > 0 {
+				t.unexpected(token, context.name)
+			}
+			call := t.templateControl().(*TemplateNode)
+			call.Value = true
+			cmd := t.newCommand(token.pos)
+			cmd.append(call)
+			pipe.append(cmd)
+			if call.Pipe != nil {
+				pipe.TrimRight = call.Pipe.TrimRight
+			}
+			return
 		case itemEquals:
 
 		default:
@@ -611,8 +694,22 @@ func (t *Tree) checkPipeline(pipe *PipeNode, context string) {
 	}
 }
 
+// checkOkDecl rejects the declarations of the value and the ok of a
+// pipeline which can't be a call, as in {{with $v, $ok := 3}}.
+func (t *Tree) checkOkDecl(pipe *PipeNode, context string) {
+	if len(pipe.Cmds) == 0 {
+		return
+	}
+	cmd := pipe.Cmds[len(pipe.Cmds)-1]
+	switch cmd.Args[0].Type() {
+	case NodeBool, NodeDot, NodeNil, NodeNumber, NodeString:
+		t.errorf("too many declarations in <%v>: %s isn't a call returning a value and an ok", context, cmd)
+	}
+}
+
 func (t *Tree) parseControl(allowElseIf bool, context parseContext) (pos Pos, line int, pipe *PipeNode, list, elseList *ListNode) {
 	defer t.popVars(len(t.vars))
+	defer t.enterNesting()()
 	pipe = t.pipeline(context)
 	var next Node
 	list, next = t.itemList()
@@ -700,6 +797,7 @@ func (t *Tree) callbackControl() Node {
 
 func (t *Tree) parseWrapControl(context parseContext) (pos Pos, line int, pipe *PipeNode, list, beginList, afterList, elseList *ListNode) {
 	defer t.popVars(len(t.vars))
+	defer t.enterNesting()()
 	pipe = t.pipeline(context)
 	var next Node
 	list, next = t.untilItemList(nodeBegin, nodeEnter, nodeAfter)
@@ -850,35 +948,72 @@ func (t *Tree) blockControl() Node {
 	block := New(name) // name will be updated once we know it.
 	block.text = t.text
 	block.ParseName = t.ParseName
+	t.inherit(block)
+	defer block.enterNesting()()
 	block.startParse(t.lex, t.treeSet)
 	var end Node
 	block.Root, end = block.itemList()
 	if end.Type() != nodeEnd {
 		t.errorf("unexpected %s in %s", end, context)
 	}
+	block.applyPragmas()
 	block.add()
 	block.stopParse()
 
-	return t.newTemplate(token.pos, token.line, name, pipe)
+	n := t.newTemplate(token.pos, token.line, name, pipe)
+	n.Block = true
+	return n
 }
 
 // Template:
 //
 //	{{template stringValue pipeline}}
+//	{{template operand pipeline}}
 //
 // Template keyword is past. The name must be something that can evaluate
-// to a string.
+// to a string: a string constant or an operand, such as a field, a variable
+// or a parenthesized pipeline, evaluated on execution.
 func (t *Tree) templateControl() Node {
 	const context = "template clause"
 	token := t.nextNonSpace()
-	name := t.parseTemplateName(token, context)
+	var (
+		name     string
+		nameNode Node
+	)
+	switch token.typ {
+	case itemField, itemVariable, itemLeftParen, itemDot:
+		t.backup()
+		nameNode = t.operand()
+	default:
+		name = t.parseTemplateName(token, context)
+	}
 	var pipe *PipeNode
 	if t.nextNonSpace().typ != itemRightDelim {
 		t.backup()
 		// Do not pop variables; they persist until "end".
 		pipe = t.pipeline(parseContext{name: context})
 	}
-	return t.newTemplate(token.pos, token.line, name, pipe)
+	n := t.newTemplate(token.pos, token.line, name, pipe)
+	n.NameNode = nameNode
+	return n
+}
+
+// Return:
+//
+//	{{return}}
+//	{{return pipeline}}
+//
+// Return keyword is past.
+func (t *Tree) returnControl() Node {
+	token := t.peekNonSpace()
+	pipe := t.pipeline(parseContext{name: "return", optionalPipe: true})
+	if len(pipe.Decl) > 0 {
+		t.errorf("declaration in return")
+	}
+	if len(pipe.Cmds) == 0 {
+		pipe = nil
+	}
+	return t.newReturn(token.pos, token.line, pipe)
 }
 
 func (t *Tree) parseTemplateName(token item, context string) (name string) {
@@ -904,6 +1039,7 @@ func (t *Tree) parseTemplateName(token item, context string) (name string) {
 func (t *Tree) command() *CommandNode {
 	var doCmd func() *CommandNode
 	doCmd = func() *CommandNode {
+		t.countNode()
 		cmd := t.newCommand(t.peekNonSpace().pos)
 		for {
 			t.peekNonSpace() // skip leading spaces.
@@ -928,6 +1064,12 @@ func (t *Tree) command() *CommandNode {
 				t.backup()
 			case itemPipe:
 			case itemNodePipe:
+			case itemColon:
+				if _, ok := operand.(*IdentifierNode); !ok || len(cmd.Args) != 1 {
+					t.errorf("unexpected %s in operand", token)
+				}
+				cmd.Filter = true
+				continue
 			case itemChar:
 				if operand == nil {
 					// $a = 2
@@ -964,6 +1106,7 @@ func (t *Tree) operand() Node {
 	if node == nil {
 		return nil
 	}
+	t.countNode()
 	if t.peek().typ == itemField {
 		chain := t.newChain(t.peek().pos, node)
 		for t.peek().typ == itemField {
@@ -1022,6 +1165,7 @@ func (t *Tree) term() Node {
 		}
 		return number
 	case itemLeftParen:
+		defer t.enterNesting()()
 		pipe := t.pipeline(parseContext{name: "parenthesized pipeline"})
 		if token := t.next(); token.typ != itemRightParen {
 			t.errorf("unclosed right paren: unexpected %s", token)
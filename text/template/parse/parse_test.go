@@ -190,6 +190,10 @@ var parseTests = []parseTest{
 		`{{.X | .Y}}`},
 	{"pipeline with decl", "{{$x := .X|.Y}}", noError,
 		`{{$x := .X | .Y}}`},
+	{"filter", "{{.X|default: .Y 3}}", noError,
+		`{{.X | default: .Y 3}}`},
+	{"filter of field", "{{.X|.Y: 3}}", hasError, ""},
+	{"filter argument", "{{.X|default 3: 4}}", hasError, ""},
 	{"nested pipeline", "{{.X (.Y .Z) (.A | .B .C) (.E)}}", noError,
 		`{{.X (.Y .Z) (.A | .B .C) (.E)}}`},
 	{"field applied to parentheses", "{{(.Y .Z).Field}}", noError,
@@ -224,6 +228,10 @@ var parseTests = []parseTest{
 		`{{template "x"}}`},
 	{"template with arg", "{{template `x` .Y}}", noError,
 		`{{template "x" .Y}}`},
+	{"template with dynamic name", "{{template .X.Name .Y}}", noError,
+		`{{template .X.Name .Y}}`},
+	{"template with dynamic pipeline name", "{{template (printf `%s` $) .}}", noError,
+		"{{template (printf `%s` $) .}}"},
 	{"with", "{{with .X}}hello{{end}}", noError,
 		`{{with .X}}"hello"{{end}}`},
 	{"with with else", "{{with .X}}hello{{else}}goodbye{{end}}", noError,
@@ -247,10 +255,10 @@ var parseTests = []parseTest{
 	{"missing end after else", "hello{{range .x}}{{else}}", hasError, ""},
 	{"undefined variable", "{{$x}}", hasError, ""},
 	{"variable undefined after end", "{{with $x := 4}}{{end}}{{$x}}", hasError, ""},
-	{"variable undefined in template", "{{template $v}}", hasError, ""},
+	{"variable undefined in template", "{{template $v}}", noError, "{{template $v}}"},
 	{"declare with field", "{{with $x.Y := 4}}{{end}}", hasError, ""},
-	{"template with field ref", "{{template .X}}", hasError, ""},
-	{"template with var", "{{template $v}}", hasError, ""},
+	{"template with field ref", "{{template .X}}", noError, "{{template .X}}"},
+	{"template with var", "{{template $v}}", noError, "{{template $v}}"},
 	{"invalid punctuation", "{{printf 3, 4}}", hasError, ""},
 	{"multidecl outside range", "{{with $v, $u := 3}}{{end}}", hasError, ""},
 	{"too many decls in range", "{{range $u, $v, $w := 3}}{{end}}", hasError, ""},
@@ -524,3 +532,38 @@ func BenchmarkParseLarge(b *testing.B) {
 		}
 	}
 }
+
+func TestParseComments(t *testing.T) {
+	const text = "a{{/* one */}}b{{- /* two */ -}} c{{define `x`}}{{/* three */}}{{end}}"
+	for _, mode := range []Mode{0, ParseComments} {
+		trees := make(map[string]*Tree)
+		tree := New("root")
+		tree.Mode = mode
+		if _, err := tree.Parse(text, "", "", trees); err != nil {
+			t.Fatal(err)
+		}
+		var comments []string
+		for _, name := range []string{"root", "x"} {
+			Inspect(trees[name].Root, func(n Node) bool {
+				if c, ok := n.(*CommentNode); ok {
+					comments = append(comments, c.Text)
+				}
+				return true
+			})
+		}
+		want := []string{"/* one */", "/* two */", "/* three */"}
+		if mode == 0 {
+			want = nil
+		}
+		if strings.Join(comments, ",") != strings.Join(want, ",") {
+			t.Errorf("mode %d: got comments %q, want %q", mode, comments, want)
+		}
+		got := strings.ReplaceAll(trees["root"].Root.String(), `"`, "")
+		if mode != 0 && got != "a{{/* one */}}b{{/* two */}}c" {
+			t.Errorf("got tree %s", got)
+		}
+		if !IsEmptyTree(trees["x"].Root) {
+			t.Errorf("mode %d: comment only template isn't empty", mode)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package parse
+
+import "sort"
+
+// Children returns the child nodes of the node, in the order of their
+// positions, as visited by Inspect.
+func Children(n Node) (children []Node) {
+	add := func(c Node) {
+		switch c := c.(type) {
+		case nil:
+		case *ListNode:
+			if c != nil {
+				children = append(children, c)
+			}
+		case *PipeNode:
+			if c != nil {
+				children = append(children, c)
+			}
+		case *CommandNode:
+			if c != nil {
+				children = append(children, c)
+			}
+		default:
+			children = append(children, c)
+		}
+	}
+	branch := func(b *BranchNode) {
+		add(b.Pipe)
+		add(b.List)
+		add(b.ElseList)
+	}
+	switch n := n.(type) {
+	case *ListNode:
+		if n != nil {
+			for _, c := range n.Nodes {
+				add(c)
+			}
+		}
+	case *ActionNode:
+		add(n.Pipe)
+	case *PipeNode:
+		if n != nil {
+			for _, v := range n.Decl {
+				add(v)
+			}
+			for _, c := range n.Cmds {
+				add(c)
+			}
+		}
+	case *CommandNode:
+		for _, arg := range n.Args {
+			add(arg)
+		}
+	case *ChainNode:
+		add(n.Node)
+	case *ExprNode:
+		add(n.A)
+		add(n.B)
+	case *IfNode:
+		branch(&n.BranchNode)
+	case *RangeNode:
+		branch(&n.BranchNode)
+	case *WithNode:
+		branch(&n.BranchNode)
+	case *ArgNode:
+		branch(&n.BranchNode)
+	case *CallbackNode:
+		branch(&n.BranchNode)
+	case *WrapNode:
+		add(n.Pipe)
+		add(n.BeginList)
+		add(n.List)
+		add(n.AfterList)
+		add(n.ElseList)
+	case *TemplateNode:
+		add(n.NameNode)
+		add(n.Pipe)
+	case *CustomNode:
+		add(n.Pipe)
+		add(n.List)
+		add(n.ElseList)
+	case *ReturnNode:
+		add(n.Pipe)
+	}
+	sort.SliceStable(children, func(i, j int) bool {
+		return children[i].Position() < children[j].Position()
+	})
+	return
+}
+
+// tokenLen returns the length of the text of the node, if it is a single
+// token.
+func tokenLen(n Node) (int, bool) {
+	switch n := n.(type) {
+	case *IdentifierNode:
+		return len(n.Ident), true
+	case *FieldNode, *VariableNode, *BoolNode:
+		return len(n.String()), true
+	case *DotNode:
+		return 1, true
+	case *NilNode:
+		return 3, true
+	case *NumberNode:
+		return len(n.Text), true
+	case *StringNode:
+		return len(n.Quoted), true
+	}
+	return 0, false
+}
+
+// PathAt returns the nodes of the tree enclosing the byte offset pos of its
+// text, from the root to the innermost one, or nil if pos is out of the
+// tree. A node encloses the text up to the position of its next sibling:
+//
+//	path := tree.PathAt(pos)
+//	if id, ok := path[len(path)-1].(*parse.IdentifierNode); ok {
+//		// the cursor is on the function id.Ident
+//	}
+//
+// The nodes are found by their positions in the text the tree was parsed
+// from, so the trees edited by html/template may not match it.
+func (t *Tree) PathAt(pos Pos) []Node {
+	if t == nil || t.Root == nil {
+		return nil
+	}
+	// The cursor may be at the end of the text.
+	return pathAt(t.Root, Pos(len(t.text))+1, pos)
+}
+
+func pathAt(n Node, end, pos Pos) []Node {
+	if l, ok := tokenLen(n); ok && n.Position()+Pos(l) < end {
+		end = n.Position() + Pos(l)
+	}
+	if pos < n.Position() || pos >= end {
+		return nil
+	}
+	children := Children(n)
+	for i, c := range children {
+		cend := end
+		if i+1 < len(children) && children[i+1].Position() < end {
+			cend = children[i+1].Position()
+		}
+		if path := pathAt(c, cend, pos); path != nil {
+			return append([]Node{n}, path...)
+		}
+	}
+	return []Node{n}
+}
+
+// NodeAt returns the innermost node enclosing the byte offset pos of the
+// text of the tree, or nil. See PathAt.
+func (t *Tree) NodeAt(pos Pos) Node {
+	if path := t.PathAt(pos); len(path) > 0 {
+		return path[len(path)-1]
+	}
+	return nil
+}
+
+// VarsAt returns the names of the variables in scope at the byte offset pos
+// of the text of the tree, as "$x", in declaration order: "$", the
+// variables declared before the text, the arguments of the definition and
+// the variables declared before pos, by the enclosing actions or by the
+// previous ones of the enclosing lists. A variable declared many times is
+// listed once.
+func (t *Tree) VarsAt(pos Pos) []string {
+	vars := append([]string{"$"}, t.Vars...)
+	vars = append(vars, t.args...)
+	if t.Root != nil {
+		vars = varsAt(t.Root, Pos(len(t.text))+1, pos, vars)
+	}
+	names := vars[:0:0]
+	for i, v := range vars {
+		last := true
+		for _, w := range vars[i+1:] {
+			if w == v {
+				last = false
+				break
+			}
+		}
+		if last {
+			names = append(names, v)
+		}
+	}
+	return names
+}
+
+func varsAt(n Node, end, pos Pos, vars []string) []string {
+	decl := func(pipe *PipeNode) []string {
+		if pipe != nil {
+			for _, v := range pipe.Decl {
+				vars = append(vars, v.Ident[0])
+			}
+		}
+		return vars
+	}
+	children := Children(n)
+	for i, c := range children {
+		if c.Position() > pos {
+			break
+		}
+		cend := end
+		if i+1 < len(children) {
+			cend = children[i+1].Position()
+		}
+		switch c := c.(type) {
+		case *ActionNode:
+			if pos >= cend {
+				vars = decl(c.Pipe)
+			}
+		case *ListNode, *IfNode, *RangeNode, *WithNode, *ArgNode, *CallbackNode, *WrapNode, *CustomNode:
+			if pos < cend {
+				if b, ok := c.(interface{ pipe() *PipeNode }); ok {
+					vars = decl(b.pipe())
+				}
+				return varsAt(c, cend, pos, vars)
+			}
+		}
+	}
+	return vars
+}
+
+func (b *BranchNode) pipe() *PipeNode { return b.Pipe }
+
+func (w *WrapNode) pipe() *PipeNode { return w.Pipe }
+
+func (c *CustomNode) pipe() *PipeNode { return c.Pipe }
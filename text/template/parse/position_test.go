@@ -0,0 +1,43 @@
+package parse
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPathAt(t *testing.T) {
+	src := `a{{$x := .A}}b{{range $i, $v := .L}}{{printf "%d" $i | f}}{{else}}{{.Name}}{{end}}{{if $y := 1}}c{{end}}`
+	tree, err := New("x").Parse(src, "", "", map[string]*Tree{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		at, node, vars string
+	}{
+		{"a{{", "*parse.TextNode a", "[$]"},
+		{".A", "*parse.FieldNode .A", "[$]"},
+		{"b{{", "*parse.TextNode b", "[$ $x]"},
+		{"printf", "*parse.IdentifierNode printf", "[$ $x $i $v]"},
+		{` $i |`, `*parse.CommandNode printf "%d" $i`, "[$ $x $i $v]"},
+		{"$i |", "*parse.VariableNode $i", "[$ $x $i $v]"},
+		{"f}}", "*parse.IdentifierNode f", "[$ $x $i $v]"},
+		{".Name", "*parse.FieldNode .Name", "[$ $x $i $v]"},
+		{"c{{", "*parse.TextNode c", "[$ $x $y]"},
+	} {
+		pos := Pos(strings.Index(src, test.at))
+		n := tree.NodeAt(pos)
+		if got := fmt.Sprintf("%T %s", n, n); got != test.node {
+			t.Errorf("%q: got node %s, want %s", test.at, got, test.node)
+		}
+		if path := tree.PathAt(pos); len(path) == 0 || path[0] != tree.Root || path[len(path)-1] != n {
+			t.Errorf("%q: got path %v", test.at, path)
+		}
+		if got := fmt.Sprint(tree.VarsAt(pos)); got != test.vars {
+			t.Errorf("%q: got vars %s, want %s", test.at, got, test.vars)
+		}
+	}
+	if n := tree.NodeAt(Pos(len(src) + 10)); n != nil {
+		t.Errorf("got node %v out of the text", n)
+	}
+}
@@ -0,0 +1,225 @@
+package parse
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PragmaPrefix starts the comments holding a pragma, a directive to the
+// executor of the template:
+//
+//	{{/* umbu:option missingkey=error strictfields=true */}}
+//	{{/* umbu:require .Title .Items */}}
+//
+// Pragmas are kept in the tree, as comments, in any parse mode.
+const PragmaPrefix = "umbu:"
+
+// Pragma is a directive found in a comment of the template.
+//
+// Known pragmas:
+//
+//	option key=value...
+//		Sets options of the template:
+//		"missingkey=default|invalid|zero|error", as Template.Option;
+//		"strictfields=true|false", requires the fields even when marked as
+//		optional with "?";
+//		"trim=none|all", "all" trims the spaces around every action, as if
+//		they had the "{{- " and " -}}" trim markers;
+//		"autoescape=true|false", "false" disables the contextual escaping of
+//		the template in html/template, if allowed by its
+//		Template.AllowUnescaped.
+//	require arg...
+//		Fails the execution of the template if any of the fields (".Name")
+//		or variables ("$name") is missing.
+//	arg name type?
+//		Declares a field (".Items") or a variable ("$page") of the data,
+//		required unless marked as optional with "?" (".Phone?"), and its
+//		Go type, optional, as the parameters of a {{define}} action: the
+//		data is validated against the declarations by the executors
+//		validating their data.
+type Pragma struct {
+	Pos  Pos
+	Name string
+	Args []string
+}
+
+func (p Pragma) String() string {
+	return strings.Join(append([]string{PragmaPrefix + p.Name}, p.Args...), " ")
+}
+
+var pragmaOptions = map[string][]string{
+	"missingkey":   {"default", "invalid", "zero", "error"},
+	"strictfields": {"true", "false"},
+	"trim":         {"none", "all"},
+	"autoescape":   {"true", "false"},
+}
+
+// isPragma reports whether the comment, with its markers, holds a pragma.
+func isPragma(comment string) bool {
+	return strings.HasPrefix(strings.TrimSpace(strings.TrimPrefix(comment, leftComment)), PragmaPrefix)
+}
+
+// parsePragma parses the pragma of the comment, failing on unknown pragmas
+// or options.
+func (t *Tree) parsePragma(pos Pos, comment string) {
+	body := strings.TrimSuffix(strings.TrimPrefix(comment, leftComment), rightComment)
+	fields := strings.Fields(body)
+	p := Pragma{Pos: pos, Name: strings.TrimPrefix(fields[0], PragmaPrefix), Args: fields[1:]}
+	switch p.Name {
+	case "option":
+		for _, arg := range p.Args {
+			if err := checkPragmaOption(arg); err != nil {
+				t.errorf("%s: %v", p, err)
+			}
+			if t.options == nil {
+				t.options = make(map[string]string)
+			}
+			key, value, _ := strings.Cut(arg, "=")
+			t.options[key] = value
+		}
+	case "require":
+		for _, arg := range p.Args {
+			if arg[0] != '.' && arg[0] != '$' {
+				t.errorf("%s: bad required argument %q", p, arg)
+			}
+		}
+	case "arg":
+		if len(p.Args) == 0 || len(p.Args) > 2 {
+			t.errorf("%s: want a name and an optional type", p)
+		}
+		if arg := p.Args[0]; len(arg) < 2 || arg[0] != '.' && arg[0] != '$' {
+			t.errorf("%s: bad argument name %q", p, arg)
+		}
+	default:
+		t.errorf("unknown pragma %q", PragmaPrefix+p.Name)
+	}
+	t.Pragmas = append(t.Pragmas, p)
+}
+
+func checkPragmaOption(opt string) error {
+	key, value, ok := strings.Cut(opt, "=")
+	values, known := pragmaOptions[key]
+	if !ok || !known {
+		return fmt.Errorf("unknown option %q", opt)
+	}
+	for _, v := range values {
+		if v == value {
+			return nil
+		}
+	}
+	return fmt.Errorf("bad value of option %q", opt)
+}
+
+// Option returns the value of the option key set by "umbu:option" pragmas.
+// If the option is set many times, the last value wins. The options are
+// collected once, on parse, as they are read on every field access of the
+// execution.
+func (t *Tree) Option(key string) (value string, ok bool) {
+	value, ok = t.options[key]
+	return
+}
+
+// Required returns the fields and variables required by "umbu:require"
+// pragmas.
+func (t *Tree) Required() (args []string) {
+	for _, p := range t.Pragmas {
+		if p.Name == "require" {
+			args = append(args, p.Args...)
+		}
+	}
+	return
+}
+
+// DataArg is a field or a variable of the data declared by an "umbu:arg"
+// pragma.
+type DataArg struct {
+	Name     string // name of the field, with the leading '.', or of the variable.
+	Type     string // declared type, empty if untyped.
+	Optional bool   // whether the name is marked as optional with "?".
+}
+
+func (a DataArg) String() string {
+	s := a.Name
+	if a.Optional {
+		s += "?"
+	}
+	if a.Type != "" {
+		s += " " + a.Type
+	}
+	return s
+}
+
+// DataArgs returns the fields and variables declared by "umbu:arg" pragmas.
+func (t *Tree) DataArgs() (args []DataArg) {
+	for _, p := range t.Pragmas {
+		if p.Name == "arg" {
+			arg := DataArg{Name: p.Args[0]}
+			if len(p.Args) == 2 {
+				arg.Type = p.Args[1]
+			}
+			if strings.HasSuffix(arg.Name, "?") {
+				arg.Name, arg.Optional = arg.Name[:len(arg.Name)-1], true
+			}
+			args = append(args, arg)
+		}
+	}
+	return
+}
+
+// applyPragmas applies the pragmas handled by the parser to the finished
+// tree.
+func (t *Tree) applyPragmas() {
+	if trim, _ := t.Option("trim"); trim == "all" {
+		trimList(t.Root, false, false)
+	}
+}
+
+// trimList trims the spaces of the texts adjacent to actions. The first and
+// last texts of the list are trimmed when the list starts or ends at an
+// action.
+func trimList(l *ListNode, atStart, atEnd bool) {
+	if l == nil {
+		return
+	}
+	nodes := l.Nodes[:0]
+	for i, n := range l.Nodes {
+		switch n := n.(type) {
+		case *TextNode:
+			text := n.Text
+			if i > 0 || atStart {
+				text = []byte(strings.TrimLeft(string(text), spaceChars))
+			}
+			if i < len(l.Nodes)-1 || atEnd {
+				text = []byte(strings.TrimRight(string(text), spaceChars))
+			}
+			if len(text) == 0 {
+				continue
+			}
+			n.Text = text
+		case *IfNode:
+			trimBranch(&n.BranchNode)
+		case *RangeNode:
+			trimBranch(&n.BranchNode)
+		case *WithNode:
+			trimBranch(&n.BranchNode)
+		case *ArgNode:
+			trimBranch(&n.BranchNode)
+		case *CallbackNode:
+			trimBranch(&n.BranchNode)
+		case *WrapNode:
+			for _, l := range []*ListNode{n.BeginList, n.List, n.AfterList, n.ElseList} {
+				trimList(l, true, true)
+			}
+		case *CustomNode:
+			trimList(n.List, true, true)
+			trimList(n.ElseList, true, true)
+		}
+		nodes = append(nodes, n)
+	}
+	l.Nodes = nodes
+}
+
+func trimBranch(b *BranchNode) {
+	trimList(b.List, true, true)
+	trimList(b.ElseList, true, true)
+}
@@ -0,0 +1,76 @@
+package parse
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPragmas(t *testing.T) {
+	trees := make(map[string]*Tree)
+	const text = `{{/* umbu:option missingkey=zero */}}{{/* umbu:option missingkey=error strictfields=true */}}` +
+		`{{/* umbu:require .Title $x.Name */}}x`
+	if _, err := New("root").Parse(text, "", "", trees); err != nil {
+		t.Fatal(err)
+	}
+	tree := trees["root"]
+	if len(tree.Pragmas) != 3 {
+		t.Fatalf("got pragmas %v", tree.Pragmas)
+	}
+	if got := tree.Pragmas[2].String(); got != "umbu:require .Title $x.Name" {
+		t.Errorf("got pragma %q", got)
+	}
+	if v, ok := tree.Option("missingkey"); !ok || v != "error" {
+		t.Errorf("missingkey: got %q, %v", v, ok)
+	}
+	if _, ok := tree.Option("trim"); ok {
+		t.Errorf("trim: unexpected option")
+	}
+	if got := strings.Join(tree.Required(), " "); got != ".Title $x.Name" {
+		t.Errorf("required: got %q", got)
+	}
+}
+
+func TestPragmaArgs(t *testing.T) {
+	trees := make(map[string]*Tree)
+	const text = `{{/* umbu:arg .Title string */}}{{/* umbu:arg .Phone? */}}{{/* umbu:arg $page int */}}x`
+	if _, err := New("root").Parse(text, "", "", trees); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, arg := range trees["root"].DataArgs() {
+		got = append(got, arg.String())
+	}
+	if got, want := strings.Join(got, ", "), ".Title string, .Phone?, $page int"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestPragmaTrim(t *testing.T) {
+	trees := make(map[string]*Tree)
+	const text = "{{/* umbu:option trim=all */}}\n<ul>\n{{range .}}\n  <li>{{.}}</li>\n{{end}}\n</ul>\n"
+	if _, err := New("root").Parse(text, "", "", trees); err != nil {
+		t.Fatal(err)
+	}
+	got := strings.ReplaceAll(trees["root"].Root.String(), `"`, "")
+	if want := "{{/* umbu:option trim=all */}}<ul>{{range .}}<li>{{.}}</li>{{end}}</ul>\n"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestPragmaErrors(t *testing.T) {
+	for _, test := range []struct{ text, err string }{
+		{"{{/* umbu:nope */}}", `unknown pragma "umbu:nope"`},
+		{"{{/* umbu:option trim=some */}}", `bad value of option "trim=some"`},
+		{"{{/* umbu:option color=red */}}", `unknown option "color=red"`},
+		{"{{/* umbu:require Title */}}", `bad required argument "Title"`},
+		{"{{/* umbu:arg Title */}}", `bad argument name "Title"`},
+		{"{{/* umbu:arg .Title string x */}}", `want a name and an optional type`},
+	} {
+		_, err := New("root").Parse(test.text, "", "", make(map[string]*Tree))
+		if err == nil {
+			t.Errorf("%q: expected error", test.text)
+		} else if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: got error %q, want %q", test.text, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package parse
+
+import "strings"
+
+// Inspect traverses the node n in depth-first order: it starts by calling
+// f(n); if f returns true, Inspect invokes f recursively for each of the
+// non-nil children of n.
+func Inspect(n Node, f func(Node) bool) {
+	if n == nil || !f(n) {
+		return
+	}
+	switch n := n.(type) {
+	case *ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			Inspect(c, f)
+		}
+	case *ActionNode:
+		inspectPipe(n.Pipe, f)
+	case *PipeNode:
+		if n == nil {
+			return
+		}
+		for _, v := range n.Decl {
+			Inspect(v, f)
+		}
+		for _, c := range n.Cmds {
+			Inspect(c, f)
+		}
+	case *CommandNode:
+		for _, arg := range n.Args {
+			Inspect(arg, f)
+		}
+	case *ChainNode:
+		Inspect(n.Node, f)
+	case *ExprNode:
+		if n.A != nil {
+			Inspect(n.A, f)
+		}
+		if n.B != nil {
+			Inspect(n.B, f)
+		}
+	case *IfNode:
+		inspectBranch(&n.BranchNode, f)
+	case *RangeNode:
+		inspectBranch(&n.BranchNode, f)
+	case *WithNode:
+		inspectBranch(&n.BranchNode, f)
+	case *ArgNode:
+		inspectBranch(&n.BranchNode, f)
+	case *CallbackNode:
+		inspectBranch(&n.BranchNode, f)
+	case *WrapNode:
+		inspectPipe(n.Pipe, f)
+		inspectList(n.BeginList, f)
+		inspectList(n.List, f)
+		inspectList(n.AfterList, f)
+		inspectList(n.ElseList, f)
+	case *TemplateNode:
+		if n.NameNode != nil {
+			Inspect(n.NameNode, f)
+		}
+		inspectPipe(n.Pipe, f)
+	case *CustomNode:
+		inspectPipe(n.Pipe, f)
+		inspectList(n.List, f)
+		inspectList(n.ElseList, f)
+	case *ReturnNode:
+		inspectPipe(n.Pipe, f)
+	}
+}
+
+func inspectBranch(b *BranchNode, f func(Node) bool) {
+	inspectPipe(b.Pipe, f)
+	inspectList(b.List, f)
+	inspectList(b.ElseList, f)
+}
+
+func inspectPipe(p *PipeNode, f func(Node) bool) {
+	if p != nil {
+		Inspect(p, f)
+	}
+}
+
+func inspectList(l *ListNode, f func(Node) bool) {
+	if l != nil {
+		Inspect(l, f)
+	}
+}
+
+// LineCol returns the 1-based line and the 0-based column (in bytes) of the
+// position pos in the tree source.
+func (t *Tree) LineCol(pos Pos) (line, col int) {
+	text := t.text
+	if int(pos) < len(text) {
+		text = text[:pos]
+	}
+	line = 1 + strings.Count(text, "\n")
+	if i := strings.LastIndex(text, "\n"); i >= 0 {
+		col = len(text) - i - 1
+	} else {
+		col = len(text)
+	}
+	return
+}
@@ -18,7 +18,7 @@ func (this TemplatePath) Format(f fmt.State, c rune) {
 	case 'q', 's':
 		f.Write([]byte(this.String()))
 	default:
-		fmt.Fprint(f, "%v", this.pth)
+		fmt.Fprintf(f, "%v", this.pth)
 	}
 }
 
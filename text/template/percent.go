@@ -0,0 +1,83 @@
+package template
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/moisespsena-go/umbu/cast"
+)
+
+// DefaultZeroDivision is the default placeholder written by the percent and
+// ratio builtins for the zero denominators.
+const DefaultZeroDivision = "—"
+
+// SetZeroDivision sets the placeholder written by the percent and ratio
+// builtins, instead of failing, when the denominator is zero.
+func (this *Executor) SetZeroDivision(placeholder string) *Executor {
+	this.StateOptions.ZeroDivision = &placeholder
+	return this
+}
+
+// zeroDivision returns the placeholder of the zero denominators.
+func (this *State) zeroDivision() string {
+	if p := this.e.StateOptions.ZeroDivision; p != nil {
+		return *p
+	}
+	return DefaultZeroDivision
+}
+
+// quotient returns part divided by whole, formatted with the decimals of
+// the options, or def, rounded HalfUp, and whether whole isn't zero.
+func quotient(name string, part, whole interface{}, scale float64, def int, opts []interface{}) (string, bool, error) {
+	p, err := cast.ToFloat(part)
+	if err != nil {
+		return "", false, fmt.Errorf("%s: %v", name, err)
+	}
+	w, err := cast.ToFloat(whole)
+	if err != nil {
+		return "", false, fmt.Errorf("%s: %v", name, err)
+	}
+	if w == 0 {
+		return "", false, nil
+	}
+	decimals := def
+	if len(opts) > 0 {
+		d, err := cast.ToInt(opts[0])
+		if err != nil || d < 0 {
+			return "", false, fmt.Errorf("%s: invalid decimals %v", name, opts[0])
+		}
+		decimals = int(d)
+	}
+	// Scaling before dividing keeps the exact quotients exact: 29/200*100
+	// is 14.499999999999998, 29*100/200 is 14.5.
+	s, err := roundDecimal(strconv.FormatFloat(p*scale/w, 'f', -1, 64), decimals, HalfUp)
+	return s, true, err
+}
+
+// percent writes part as a percentage of whole, with the decimals, 0 by
+// default, in the locale of the execution, as "12.5%", or the zero
+// division placeholder if whole is zero.
+func percent(state *State, part, whole interface{}, decimals ...interface{}) (string, error) {
+	s, ok, err := quotient("percent", part, whole, 100, 0, decimals)
+	if err != nil || !ok {
+		return state.zeroDivision(), err
+	}
+	l := state.Locale()
+	format := l.Percent
+	if format == "" {
+		format = "%s%"
+	}
+	return strings.Replace(format, "%s", l.FormatNumber(s), 1), nil
+}
+
+// ratio writes part divided by whole, with the decimals, 2 by default, in
+// the locale of the execution, or the zero division placeholder if whole
+// is zero.
+func ratio(state *State, part, whole interface{}, decimals ...interface{}) (string, error) {
+	s, ok, err := quotient("ratio", part, whole, 1, 2, decimals)
+	if err != nil || !ok {
+		return state.zeroDivision(), err
+	}
+	return state.Locale().FormatNumber(s), nil
+}
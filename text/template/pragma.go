@@ -0,0 +1,90 @@
+package template
+
+import (
+	"reflect"
+	"strings"
+)
+
+// missingKey returns the action on missing map keys of the executing
+// template: the "umbu:option missingkey" pragma overrides Template.Option.
+func (this *State) missingKey() missingKeyAction {
+	if value, ok := this.tmpl.Tree.Option("missingkey"); ok {
+		action, _ := parseMissingKey(value)
+		return action
+	}
+	return this.tmpl.option.missingKey
+}
+
+// requireFields reports whether the optional fields are required: the
+// "umbu:option strictfields" pragma overrides StateOptions.RequireFields.
+func (this *State) requireFields() bool {
+	if value, ok := this.tmpl.Tree.Option("strictfields"); ok {
+		return value == "true"
+	}
+	return this.e.StateOptions.RequireFields
+}
+
+// checkRequired fails if any of the fields or variables required by the
+// "umbu:require" pragmas of the executing template is missing.
+func (this *State) checkRequired(dot reflect.Value) {
+	for _, arg := range this.tmpl.Tree.Required() {
+		value, path := dot, strings.Split(arg[1:], ".")
+		if arg[0] == '$' {
+			var ok bool
+			if value, ok = this.lookupVar("$" + path[0]); !ok {
+				this.errorf("missing required variable %s", arg)
+			}
+			path = path[1:]
+		}
+		for _, name := range path {
+			if name == "" {
+				continue
+			}
+			var ok bool
+			if value, ok = requiredField(value, name); !ok {
+				this.errorf("missing required field %s", arg)
+			}
+		}
+		if value = indirectInterface(value); !value.IsValid() {
+			this.errorf("missing required %s", arg)
+		}
+	}
+}
+
+// lookupVar returns the value of the variable, if defined.
+func (this *State) lookupVar(name string) (reflect.Value, bool) {
+	for i := this.mark() - 1; i >= 0; i-- {
+		if this.vars[i].name == name {
+			return this.vars[i].value, true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// requiredField returns the field, method or map key name of v.
+func requiredField(v reflect.Value, name string) (reflect.Value, bool) {
+	v, isNil := indirect(v)
+	if !v.IsValid() || isNil {
+		return reflect.Value{}, false
+	}
+	if v.CanAddr() {
+		if m := v.Addr().MethodByName(name); m.IsValid() {
+			return m, true
+		}
+	} else if m := v.MethodByName(name); m.IsValid() {
+		return m, true
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		if f, ok := v.Type().FieldByName(name); ok && f.IsExported() {
+			return v.FieldByIndex(f.Index), true
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() == reflect.String {
+			if e := v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key())); e.IsValid() {
+				return e, true
+			}
+		}
+	}
+	return reflect.Value{}, false
+}
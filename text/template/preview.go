@@ -0,0 +1,94 @@
+package template
+
+import (
+	"reflect"
+	"sync"
+)
+
+// PreviewIssue is a missing field or a failed function call rendered as a
+// placeholder by a Preview.
+type PreviewIssue struct {
+	// Name is the name of the field or of the function.
+	Name string `json:"name"`
+	// Func tells whether the issue is a failed call of the function Name.
+	Func     bool   `json:"func,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Template string `json:"template"`
+	Location string `json:"location,omitempty"`
+}
+
+// Preview renders the missing fields and the failed function calls of the
+// executions it is attached to as placeholders, as ⟨Name⟩, recording them,
+// so the templates being written may be previewed with incomplete data. It
+// is safe for concurrent use.
+type Preview struct {
+	// Placeholder returns the placeholder of the field or the function
+	// named name. If nil, the name between "⟨" and "⟩".
+	Placeholder func(name string) string
+
+	mu     sync.Mutex
+	issues []PreviewIssue
+}
+
+// SetPreview enables the preview mode, recording the issues into p. A nil
+// value disables it, the default.
+//
+// The placeholders replace the values of the missing fields and map keys,
+// whatever the missingkey option, and the results of the function calls
+// failing with an error, so they may be passed to other functions.
+func (this *Executor) SetPreview(p *Preview) *Executor {
+	this.StateOptions.Preview = p
+	return this
+}
+
+// Issues returns the recorded issues, in the order of the executions.
+func (p *Preview) Issues() []PreviewIssue {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]PreviewIssue(nil), p.issues...)
+}
+
+// Reset clears the recorded issues.
+func (p *Preview) Reset() {
+	p.mu.Lock()
+	p.issues = nil
+	p.mu.Unlock()
+}
+
+func (p *Preview) placeholder(name string) string {
+	if p.Placeholder != nil {
+		return p.Placeholder(name)
+	}
+	return "⟨" + name + "⟩"
+}
+
+// previewIssue records the issue of the execution, returning its
+// placeholder.
+func (this *State) previewIssue(p *Preview, issue PreviewIssue) reflect.Value {
+	issue.Template = this.tmpl.Name()
+	if this.node != nil && this.tmpl.Tree != nil {
+		issue.Location, _ = this.tmpl.ErrorContext(this.node)
+	}
+	p.mu.Lock()
+	p.issues = append(p.issues, issue)
+	p.mu.Unlock()
+	return reflect.ValueOf(p.placeholder(issue.Name))
+}
+
+// previewField returns the placeholder of the missing field, recording it,
+// if in preview mode.
+func (this *State) previewField(name string) (reflect.Value, bool) {
+	if p := this.e.StateOptions.Preview; p != nil {
+		return this.previewIssue(p, PreviewIssue{Name: name}), true
+	}
+	return zero, false
+}
+
+// previewCall returns the placeholder of the call of the function failing
+// with err, recording it, if in preview mode.
+func (this *State) previewCall(name string, err error) (reflect.Value, bool) {
+	if p := this.e.StateOptions.Preview; p != nil {
+		return this.previewIssue(p, PreviewIssue{Name: name, Func: true, Error: err.Error()}), true
+	}
+	return zero, false
+}
@@ -0,0 +1,154 @@
+package template
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"sort"
+	"strings"
+)
+
+// PrintMode renders the templates for print, as by the PDF converters of
+// HTML documents which implement the CSS paged media, as WeasyPrint and
+// Prince. See Executor.SetPrintMode.
+//
+// The print builtins write nothing out of the print mode, so the same
+// template renders for screen and for print:
+//
+//	<head>{{print_css}}</head>
+//	<header style="{{running "header"}}">{{.Title}}</header>
+//	{{range .Sections}}
+//	  <section style="{{keep_together}}">...</section>
+//	  {{page_break}}
+//	{{end}}
+//	<footer style="{{running "footer"}}">Page {{page_number}} of {{page_count}}</footer>
+type PrintMode struct {
+	// Size is the size of the pages, as "A4" or "letter landscape". The
+	// default is "A4".
+	Size string
+	// Margin is the margin of the pages, as "2cm" or "1in 2cm". The default
+	// is "2cm".
+	Margin string
+	// Running are the page margin boxes, as "top-center", of the running
+	// elements, by name. The defaults are "top-center" for "header" and
+	// "bottom-center" for "footer".
+	Running map[string]string
+}
+
+// SetPrintMode sets the print mode of the execution. A nil mode renders for
+// screen.
+func (this *Executor) SetPrintMode(mode *PrintMode) *Executor {
+	this.StateOptions.PrintMode = mode
+	return this
+}
+
+// running returns the page margin box of the running element named name.
+func (m *PrintMode) running() map[string]string {
+	boxes := map[string]string{"header": "top-center", "footer": "bottom-center"}
+	for name, box := range m.Running {
+		boxes[name] = box
+	}
+	return boxes
+}
+
+// CSS returns the style sheet of the mode.
+func (m *PrintMode) CSS() string {
+	size, margin := m.Size, m.Margin
+	if size == "" {
+		size = "A4"
+	}
+	if margin == "" {
+		margin = "2cm"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "@page{size:%s;margin:%s;", cssSafe(size), cssSafe(margin))
+	boxes := m.running()
+	names := make([]string, 0, len(boxes))
+	for name := range boxes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "@%s{content:element(%s)}", cssSafe(boxes[name]), cssIdent(name))
+	}
+	b.WriteString("}")
+	b.WriteString(".umbu-page-number::after{content:counter(page)}")
+	b.WriteString(".umbu-page-count::after{content:counter(pages)}")
+	return b.String()
+}
+
+// cssSafe removes from the CSS value s the characters that may end it.
+func cssSafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ';', '{', '}', '<', '>', '"', '\'', '\\':
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// cssIdent returns the name as a CSS identifier, replacing its other
+// characters by "-".
+func cssIdent(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' {
+			return r
+		}
+		return '-'
+	}, name)
+}
+
+// printMode reports whether the execution is in print mode.
+func printMode(state *State) bool {
+	return state.e.StateOptions.PrintMode != nil
+}
+
+// printCSS returns the style element of the print mode.
+func printCSS(state *State) htmltemplate.HTML {
+	if m := state.e.StateOptions.PrintMode; m != nil {
+		return htmltemplate.HTML("<style>" + m.CSS() + "</style>")
+	}
+	return ""
+}
+
+// pageBreak returns the element which breaks the page in print mode.
+func pageBreak(state *State) htmltemplate.HTML {
+	if printMode(state) {
+		return `<div style="break-after:page;page-break-after:always"></div>`
+	}
+	return ""
+}
+
+// keepTogether returns the style which avoids breaking the page inside the
+// element in print mode.
+func keepTogether(state *State) htmltemplate.CSS {
+	if printMode(state) {
+		return "break-inside:avoid;page-break-inside:avoid;"
+	}
+	return ""
+}
+
+// running returns the style which moves the element to the running element
+// named name, repeated in its page margin box of every page, in print mode.
+func running(state *State, name string) htmltemplate.CSS {
+	if printMode(state) {
+		return htmltemplate.CSS("position:running(" + cssIdent(name) + ");")
+	}
+	return ""
+}
+
+// pageNumber returns the element of the number of the page in print mode.
+func pageNumber(state *State) htmltemplate.HTML {
+	if printMode(state) {
+		return `<span class="umbu-page-number"></span>`
+	}
+	return ""
+}
+
+// pageCount returns the element of the number of pages in print mode.
+func pageCount(state *State) htmltemplate.HTML {
+	if printMode(state) {
+		return `<span class="umbu-page-count"></span>`
+	}
+	return ""
+}
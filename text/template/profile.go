@@ -0,0 +1,136 @@
+package template
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Profile is a named set of capabilities of the executions, as the ones of
+// the templates of a tenant or of a service, applied at once by
+// Executor.SetProfile or TemplateSet.SetProfile:
+//
+//	template.RegisterProfile(&template.Profile{
+//		Name:           "email-safe",
+//		Funcs:          []string{"print*", "upper", "lower", "date*"},
+//		MaxSteps:       100000,
+//		MaxOutputBytes: 1 << 20,
+//	})
+//
+//	executor.SetProfile(template.LookupProfile("email-safe"))
+//
+// A Profile must not be changed once used.
+type Profile struct {
+	// Name is the name of the profile, as "email-safe" or "admin".
+	Name string
+	// Funcs are the functions the templates may call, or their patterns,
+	// as "date_*", in the syntax of path.Match. If nil, the templates may
+	// call any function. The escapers inserted by html/template and by
+	// json/template are always allowed, and the internal functions of the
+	// state, as _tpl_state, never are.
+	Funcs []string
+	// Eval enables the eval builtin. See Executor.SetEval.
+	Eval *EvalPolicy
+	// Env enables the env builtin. See Executor.SetEnv.
+	Env *EnvPolicy
+	// Fetch enables the fetch builtins. See Executor.SetFetch.
+	Fetch *FetchPolicy
+	// DynamicTemplates restricts the templates invoked by a dynamic name.
+	// See Executor.SetDynamicTemplates.
+	DynamicTemplates []string
+	// DetectCycles fails the template cycles. See Executor.SetDetectCycles.
+	DetectCycles bool
+	// MaxSteps is the budget of each execution. See Executor.SetMaxSteps.
+	MaxSteps int64
+	// MaxOutputBytes is the size of the output of each execution, unlimited
+	// if zero. The executions writing more fail with an error wrapping
+	// ErrOutputTooLarge.
+	MaxOutputBytes int64
+}
+
+// profiles are the profiles registered, by name.
+var profiles sync.Map
+
+// RegisterProfile registers the profile by its name, replacing the profile
+// of the same name. It panics if the name is empty.
+func RegisterProfile(p *Profile) {
+	if p.Name == "" {
+		panic("template: RegisterProfile: the profile has no name")
+	}
+	profiles.Store(p.Name, p)
+}
+
+// LookupProfile returns the profile registered with the given name, or nil
+// if there is no such profile.
+func LookupProfile(name string) *Profile {
+	if p, ok := profiles.Load(name); ok {
+		return p.(*Profile)
+	}
+	return nil
+}
+
+// SetProfile applies the capabilities of the profile to the executor: the
+// functions allowed, the policies of the builtins and the limits of the
+// executions. A nil p removes the restriction of the functions and the
+// output limit, keeping the other options.
+func (this *Executor) SetProfile(p *Profile) *Executor {
+	this.StateOptions.Profile = p
+	if p == nil {
+		return this
+	}
+	this.StateOptions.Eval = p.Eval
+	this.StateOptions.Env = p.Env
+	this.StateOptions.Fetch = p.Fetch
+	this.StateOptions.DynamicTemplates = p.DynamicTemplates
+	this.StateOptions.DetectCycles = p.DetectCycles
+	this.StateOptions.MaxSteps = p.MaxSteps
+	return this
+}
+
+// escaperPrefixes are the prefixes of the functions inserted by the
+// escapers, allowed by every profile.
+var escaperPrefixes = []string{"_html_template_", "_json_template_", "_eval_args_"}
+
+// AllowsFunc reports whether the profile allows the templates to call the
+// function named name. The internal functions of the state, whose names
+// start with "_tpl_", give access to the executor, and so to its options:
+// no profile allows them.
+func (p *Profile) AllowsFunc(name string) bool {
+	if strings.HasPrefix(name, "_tpl_") {
+		return false
+	}
+	if p.Funcs == nil {
+		return true
+	}
+	for _, prefix := range escaperPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	for _, pattern := range p.Funcs {
+		if ok, _ := path.Match(pattern, name); ok || pattern == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkFuncAllowed returns the error of the function named name not allowed
+// by the profile of the execution.
+func (this *State) checkFuncAllowed(name string) error {
+	if p := this.e.StateOptions.Profile; p != nil && !p.AllowsFunc(name) {
+		return fmt.Errorf("function %q not allowed by the profile %q", name, p.Name)
+	}
+	return nil
+}
+
+// SetProfile sets the profile of the executions of the templates of the
+// set. See Executor.SetProfile.
+func (s *TemplateSet) SetProfile(p *Profile) *TemplateSet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.profile = p
+	s.reset()
+	return s
+}
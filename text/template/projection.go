@@ -0,0 +1,174 @@
+package template
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// mapArg returns the map argument of the builtin.
+func mapArg(name string, m reflect.Value) (reflect.Value, error) {
+	m, isNil := indirect(indirectInterface(m))
+	if !isNil && m.Kind() == reflect.Map {
+		return m, nil
+	}
+	if !m.IsValid() || isNil {
+		return reflect.Value{}, fmt.Errorf("%s: map is nil", name)
+	}
+	return reflect.Value{}, fmt.Errorf("%s: want a map, got %s", name, m.Type())
+}
+
+// sortedKeys returns the keys of the map sorted, if they are of the same
+// sortable kind.
+func sortedKeys(m reflect.Value) []reflect.Value {
+	keys := m.MapKeys()
+	for i, key := range keys {
+		keys[i] = indirectInterface(key)
+		if !keys[i].IsValid() || keys[i].Kind() != keys[0].Kind() {
+			return m.MapKeys()
+		}
+	}
+	return sortKeys(keys)
+}
+
+// fieldOf returns the value of the field of the struct, or of the key of the
+// map, item, and whether it exists.
+func fieldOf(item reflect.Value, field string) (reflect.Value, bool, error) {
+	item, isNil := indirect(indirectInterface(item))
+	if isNil || !item.IsValid() {
+		return reflect.Value{}, false, nil
+	}
+	switch item.Kind() {
+	case reflect.Map:
+		key, err := prepareArg(reflect.ValueOf(field), item.Type().Key())
+		if err != nil {
+			return reflect.Value{}, false, err
+		}
+		v := item.MapIndex(key)
+		return v, v.IsValid(), nil
+	case reflect.Struct:
+		if f, ok := item.Type().FieldByName(field); ok && f.PkgPath == "" {
+			return item.FieldByIndex(f.Index), true, nil
+		}
+		return reflect.Value{}, false, fmt.Errorf("can't evaluate field %s in type %s", field, item.Type())
+	}
+	return reflect.Value{}, false, fmt.Errorf("can't evaluate field %s in type %s", field, item.Type())
+}
+
+// pluck returns the values of the field of the structs or maps of the
+// list, skipping the maps without the key:
+//
+//	{{join (pluck "Name" .Users) ", "}}
+//
+// As in Sprig, the items may also be given as arguments:
+// pluck "name" $a $b.
+func pluck(field string, items ...reflect.Value) ([]interface{}, error) {
+	if len(items) == 1 {
+		if list, err := listArg("pluck", items[0]); err == nil {
+			items = make([]reflect.Value, list.Len())
+			for i := range items {
+				items[i] = list.Index(i)
+			}
+		}
+	}
+	values := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		v, ok, err := fieldOf(item, field)
+		if err != nil {
+			return nil, fmt.Errorf("pluck: %v", err)
+		}
+		if ok {
+			values = append(values, v.Interface())
+		}
+	}
+	return values, nil
+}
+
+// keys returns the sorted keys of the maps.
+func keys(maps ...reflect.Value) ([]interface{}, error) {
+	var result []interface{}
+	for _, m := range maps {
+		m, err := mapArg("keys", m)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range sortedKeys(m) {
+			result = append(result, key.Interface())
+		}
+	}
+	return result, nil
+}
+
+// values returns the values of the map, sorted by their keys.
+func values(m reflect.Value) ([]interface{}, error) {
+	m, err := mapArg("values", m)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]interface{}, 0, m.Len())
+	for _, key := range sortedKeys(m) {
+		result = append(result, m.MapIndex(key).Interface())
+	}
+	return result, nil
+}
+
+// hasKey reports whether the map has the key.
+func hasKey(m, key reflect.Value) (bool, error) {
+	m, err := mapArg("has_key", m)
+	if err != nil {
+		return false, err
+	}
+	key, err = prepareArg(indirectInterface(key), m.Type().Key())
+	if err != nil {
+		return false, fmt.Errorf("has_key: %v", err)
+	}
+	return m.MapIndex(key).IsValid(), nil
+}
+
+// project returns a copy of the map or struct item, as a map, with or
+// without the keys.
+func project(name string, item reflect.Value, keys []reflect.Value, with bool) (reflect.Value, error) {
+	item, isNil := indirect(indirectInterface(item))
+	if isNil || !item.IsValid() {
+		return reflect.Value{}, fmt.Errorf("%s: item is nil", name)
+	}
+	if item.Kind() == reflect.Struct {
+		fields := map[string]interface{}{}
+		for i := 0; i < item.NumField(); i++ {
+			if f := item.Type().Field(i); f.PkgPath == "" {
+				fields[f.Name] = item.Field(i).Interface()
+			}
+		}
+		item = reflect.ValueOf(fields)
+	}
+	if item.Kind() != reflect.Map {
+		return reflect.Value{}, fmt.Errorf("%s: want a map or a struct, got %s", name, item.Type())
+	}
+	selected := make(map[interface{}]bool, len(keys))
+	for _, key := range keys {
+		key, err := prepareArg(indirectInterface(key), item.Type().Key())
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("%s: %v", name, err)
+		}
+		selected[key.Interface()] = true
+	}
+	result := reflect.MakeMapWithSize(item.Type(), item.Len())
+	iter := item.MapRange()
+	for iter.Next() {
+		if selected[iter.Key().Interface()] == with {
+			result.SetMapIndex(iter.Key(), iter.Value())
+		}
+	}
+	return result, nil
+}
+
+// pick returns a copy of the map or struct, as a map, with only the keys:
+//
+//	{{range $k, $v := pick .User "Name" "Email"}}{{$k}}: {{$v}}{{end}}
+func pick(item reflect.Value, keys ...reflect.Value) (reflect.Value, error) {
+	return project("pick", item, keys, true)
+}
+
+// omit returns a copy of the map or struct, as a map, without the keys.
+func omit(item reflect.Value, keys ...reflect.Value) (reflect.Value, error) {
+	return project("omit", item, keys, false)
+}
@@ -0,0 +1,162 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// TemplateProvider provides the source of templates on demand. It lets a
+// template set backed by a directory, a file system or a database load its
+// templates lazily, when first called, instead of parsing them upfront.
+type TemplateProvider interface {
+	// TemplateSource returns the text of the template named name. It returns
+	// an error matching fs.ErrNotExist if the provider hasn't the template.
+	TemplateSource(name string) (string, error)
+}
+
+// ProviderFunc is a function implementing TemplateProvider.
+type ProviderFunc func(name string) (string, error)
+
+func (f ProviderFunc) TemplateSource(name string) (string, error) {
+	return f(name)
+}
+
+// FSProvider returns a provider reading the template named name from the
+// file of fsys with that name.
+func FSProvider(fsys fs.FS) TemplateProvider {
+	return ProviderFunc(func(name string) (string, error) {
+		b, err := fs.ReadFile(fsys, name)
+		return string(b), err
+	})
+}
+
+// SetProvider sets the provider of the templates associated with t. A
+// template not defined when called by the {{template}} action, or by the
+// functions executing templates, is loaded from the provider, parsed with the
+// delimiters and parse options of the caller and associated with t.
+//
+// The loads may happen while executing t. The provider is called without
+// locking the set, once for the concurrent loads of a template, and the
+// set is locked only to add the template, as by the other changes to the
+// set, but only ReparseTemplate may replace a template while it is
+// executed. The names of the templates the provider hasn't are remembered,
+// until ForgetMissing.
+//
+// The templates of html/template are escaped before the execution, so the
+// provider is not available there: load the templates before executing.
+func (t *Template) SetProvider(p TemplateProvider) *Template {
+	t.init()
+	t.provider = p
+	return t
+}
+
+// load is a load of a template from the provider, waited by the concurrent
+// loads of the same template.
+type load struct {
+	done chan struct{}
+	tmpl *Template
+	err  error
+}
+
+// Load returns the template with the given name that is associated with t,
+// loading it from the provider if not defined. It returns nil if there is no
+// such template.
+func (t *Template) Load(name string) (*Template, error) {
+	if t.common == nil {
+		return nil, nil
+	}
+	t.mu.RLock()
+	tmpl, missing := t.tmpl[name], t.missing[name]
+	t.mu.RUnlock()
+	if tmpl != nil || missing || t.provider == nil {
+		return tmpl, nil
+	}
+
+	t.mu.Lock()
+	if tmpl = t.tmpl[name]; tmpl != nil || t.missing[name] {
+		t.mu.Unlock()
+		return tmpl, nil
+	}
+	if l := t.loads[name]; l != nil {
+		t.mu.Unlock()
+		<-l.done
+		return l.tmpl, l.err
+	}
+	l := &load{done: make(chan struct{})}
+	if t.loads == nil {
+		t.loads = make(map[string]*load)
+	}
+	t.loads[name] = l
+	t.mu.Unlock()
+
+	defer func() {
+		t.mu.Lock()
+		delete(t.loads, name)
+		t.mu.Unlock()
+		close(l.done)
+	}()
+	l.tmpl, l.err = t.load(name)
+	return l.tmpl, l.err
+}
+
+// load loads the template named name from the provider, locking t only to
+// add it.
+func (t *Template) load(name string) (*Template, error) {
+	text, err := t.provider.TemplateSource(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.missing == nil {
+			t.missing = make(map[string]bool)
+		}
+		t.missing[name] = true
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("template: load %q: %w", name, err)
+	}
+	nt := t.New(name)
+	trees, err := nt.parseTrees(text, Limits{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if tmpl := t.tmpl[name]; tmpl != nil {
+		// Defined while loading.
+		return tmpl, nil
+	}
+	return nt.addParseTrees(trees)
+}
+
+// ForgetMissing forgets that the provider hasn't the templates named names,
+// or any template if no name is given, so they are requested again, as after
+// they are added to the provider.
+func (t *Template) ForgetMissing(names ...string) *Template {
+	if t.common == nil {
+		return t
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(names) == 0 {
+		t.missing = nil
+	}
+	for _, name := range names {
+		delete(t.missing, name)
+	}
+	return t
+}
+
+// lookupTemplate returns the template called by the state, or its version
+// selected for the execution, failing if it isn't defined.
+func (this *State) lookupTemplate(name string) *Template {
+	name = this.versionedName(name)
+	tmpl, err := this.tmpl.Load(name)
+	if err != nil {
+		this.errorf("%v", err)
+	}
+	if tmpl == nil {
+		this.errorf("template %q not defined", name)
+	}
+	return tmpl
+}
@@ -0,0 +1,209 @@
+package template
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	"github.com/moisespsena-go/umbu/text/template/parse"
+)
+
+// ErrMaxSteps is the error of the executions executing more nodes than
+// their maximum steps. See Executor.SetMaxSteps.
+var ErrMaxSteps = errors.New("template: execution budget exceeded")
+
+// ErrQuotaExceeded is the error of the changes and the executions of a
+// TemplateSet exceeding its quota. See TemplateSet.SetQuota.
+var ErrQuotaExceeded = errors.New("template: quota exceeded")
+
+// SetMaxSteps bounds the nodes executed by an execution, including the ones
+// of the templates it invokes, as the budget of the untrusted templates. A
+// range executes its nodes for each element. The execution executing more
+// fails with an error wrapping ErrMaxSteps. A zero max, the default,
+// doesn't limit the executions.
+func (this *Executor) SetMaxSteps(max int64) *Executor {
+	this.StateOptions.MaxSteps = max
+	return this
+}
+
+// Quota bounds the resources of a TemplateSet, as the ones of the tenants
+// of a platform executing the templates of its customers side by side. The
+// zero limits don't limit.
+type Quota struct {
+	// MaxTemplates is the number of the templates of the set.
+	MaxTemplates int
+	// MaxCacheBytes is the size of the templates kept by the set, as the
+	// memory of their parse trees, estimated once when they are added.
+	MaxCacheBytes int64
+	// MaxSteps is the budget of each execution. See Executor.SetMaxSteps.
+	MaxSteps int64
+	// MaxExecutionTime is the duration of each execution.
+	MaxExecutionTime time.Duration
+	// MaxOutputBytes is the size of the output of each execution.
+	MaxOutputBytes int64
+}
+
+// TemplateSetMetrics are the metrics of a TemplateSet. See
+// TemplateSet.Metrics.
+type TemplateSetMetrics struct {
+	Templates   int           // the number of the templates of the set.
+	CacheBytes  int64         // the size of the templates of the set.
+	Executions  int64         // the number of the executions.
+	Failures    int64         // the number of the executions failed.
+	Rejections  int64         // the changes and the executions exceeding the quota.
+	OutputBytes int64         // the size of the outputs of the executions.
+	Duration    time.Duration // the duration of the executions.
+}
+
+// setMetrics are the counters of the metrics of a TemplateSet.
+type setMetrics struct {
+	executions, failures, rejections, outputBytes, duration int64
+}
+
+// setUsage is the size of the templates of a TemplateSet.
+type setUsage struct {
+	templates int
+	bytes     int64
+	trees     map[*parse.Tree]int64 // the sizes of the trees, by tree.
+}
+
+// SetQuota sets the quota of the set. The changes of the set exceeding it,
+// as the Parse adding too many templates, fail with an error wrapping
+// ErrQuotaExceeded, leaving the set unchanged. The executions exceeding it
+// fail with an error wrapping ErrQuotaExceeded, ErrMaxSteps or
+// context.DeadlineExceeded. The templates of the set aren't checked against
+// the new quota until the next change.
+func (s *TemplateSet) SetQuota(q Quota) *TemplateSet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.quota = q
+	s.reset()
+	return s
+}
+
+// Metrics returns the metrics of the set, as the ones of a tenant.
+func (s *TemplateSet) Metrics() TemplateSetMetrics {
+	s.mu.RLock()
+	usage := s.usage
+	s.mu.RUnlock()
+	return TemplateSetMetrics{
+		Templates:   usage.templates,
+		CacheBytes:  usage.bytes,
+		Executions:  atomic.LoadInt64(&s.metrics.executions),
+		Failures:    atomic.LoadInt64(&s.metrics.failures),
+		Rejections:  atomic.LoadInt64(&s.metrics.rejections),
+		OutputBytes: atomic.LoadInt64(&s.metrics.outputBytes),
+		Duration:    time.Duration(atomic.LoadInt64(&s.metrics.duration)),
+	}
+}
+
+// of returns the usage of the templates of root, estimating the sizes of
+// the trees not in u, the ones parsed since u.
+func (u setUsage) of(root *Template) setUsage {
+	usage := setUsage{trees: make(map[*parse.Tree]int64, len(u.trees))}
+	for _, name := range root.TemplateNames() {
+		tree := root.Lookup(name).Tree
+		if tree == nil {
+			continue
+		}
+		size, ok := usage.trees[tree]
+		if !ok {
+			if size, ok = u.trees[tree]; !ok {
+				size = treeSize(tree)
+			}
+			usage.trees[tree] = size
+		}
+		usage.templates++
+		usage.bytes += size
+	}
+	return usage
+}
+
+// treeSize returns the estimated memory of the tree: the sizes of its nodes
+// and of the texts they hold.
+func treeSize(tree *parse.Tree) (size int64) {
+	parse.Inspect(tree.Root, func(n parse.Node) bool {
+		size += int64(reflect.TypeOf(n).Elem().Size())
+		switch n := n.(type) {
+		case *parse.TextNode:
+			size += int64(len(n.Text))
+		case *parse.StringNode:
+			size += int64(len(n.Quoted) + len(n.Text))
+		case *parse.CommentNode:
+			size += int64(len(n.Text))
+		}
+		return true
+	})
+	return
+}
+
+// checkQuota returns the error of the templates of the usage exceeding the
+// quota. The caller must hold s.mu.
+func (s *TemplateSet) checkQuota(u setUsage) error {
+	var err error
+	switch q := s.quota; {
+	case q.MaxTemplates > 0 && u.templates > q.MaxTemplates:
+		err = fmt.Errorf("%w: %d templates, more than %d", ErrQuotaExceeded, u.templates, q.MaxTemplates)
+	case q.MaxCacheBytes > 0 && u.bytes > q.MaxCacheBytes:
+		err = fmt.Errorf("%w: templates of %d bytes, more than %d", ErrQuotaExceeded, u.bytes, q.MaxCacheBytes)
+	default:
+		return nil
+	}
+	atomic.AddInt64(&s.metrics.rejections, 1)
+	return err
+}
+
+// execute executes the renderer within the quota, updating the metrics.
+func (s *TemplateSet) execute(ctx context.Context, r *Renderer, q Quota, w io.Writer, data interface{}) (err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	parent := ctx
+	if q.MaxExecutionTime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, q.MaxExecutionTime)
+		defer cancel()
+	}
+	qw := &quotaWriter{w: w, max: q.MaxOutputBytes}
+	start := time.Now()
+	err = r.Execute(ctx, qw, data)
+
+	atomic.AddInt64(&s.metrics.executions, 1)
+	atomic.AddInt64(&s.metrics.outputBytes, qw.n)
+	atomic.AddInt64(&s.metrics.duration, int64(time.Since(start)))
+	if err == nil {
+		return nil
+	}
+	atomic.AddInt64(&s.metrics.failures, 1)
+	switch {
+	case qw.full:
+		err = fmt.Errorf("%w: output of more than %d bytes", ErrQuotaExceeded, q.MaxOutputBytes)
+	case errors.Is(err, ErrMaxSteps), ctx.Err() != nil && parent.Err() == nil:
+	default:
+		return err
+	}
+	atomic.AddInt64(&s.metrics.rejections, 1)
+	return err
+}
+
+// quotaWriter is a writer failing the writes past max bytes, if positive.
+type quotaWriter struct {
+	w    io.Writer
+	max  int64
+	n    int64
+	full bool
+}
+
+func (w *quotaWriter) Write(p []byte) (n int, err error) {
+	if w.max > 0 && w.n+int64(len(p)) > w.max {
+		w.full = true
+		return 0, ErrQuotaExceeded
+	}
+	n, err = w.w.Write(p)
+	w.n += int64(n)
+	return
+}
@@ -0,0 +1,77 @@
+package template
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+)
+
+// redefineAction defines how to respond to the redefinition of a template.
+type redefineAction int
+
+const (
+	redefineAllow redefineAction = iota // Replace the template silently.
+	redefineWarn                        // Replace the template and log a warning.
+	redefineError                       // Fail the parse.
+)
+
+// Definition tells where a template definition came from.
+type Definition struct {
+	Name string // name of the defined template.
+	// Source is the name of the template whose text holds the definition
+	// and Path is its Path.
+	Source, Path string
+}
+
+func (d Definition) String() string {
+	if d.Path != "" {
+		return fmt.Sprintf("%q from %q", d.Name, d.Path)
+	}
+	return fmt.Sprintf("%q from template %q", d.Name, d.Source)
+}
+
+// Definitions returns the current definitions of the non empty templates
+// associated with t, sorted by name.
+func (t *Template) Definitions() []Definition {
+	if t.common == nil {
+		return nil
+	}
+	defs := make([]Definition, 0, len(t.defs))
+	for _, def := range t.defs {
+		defs = append(defs, def)
+	}
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].Name < defs[j].Name
+	})
+	return defs
+}
+
+// SetLogger sets the logger receiving the warnings of the templates
+// associated with t, such as those of the "redefine=warn" option. The
+// default is slog.Default(); a nil logger disables the warnings, as
+// Executor.SetLogger does.
+func (t *Template) SetLogger(logger *slog.Logger) *Template {
+	t.init()
+	t.logger, t.loggerSet = logger, true
+	return t
+}
+
+// redefine applies the redefinition option to the definition of name by t,
+// that replaces a non empty template.
+func (t *Template) redefine(name string) error {
+	old := t.defs[name]
+	def := Definition{Name: name, Source: t.name, Path: t.Path}
+	switch t.option.redefine {
+	case redefineWarn:
+		logger := t.logger
+		if !t.loggerSet {
+			logger = slog.Default()
+		} else if logger == nil {
+			break
+		}
+		logger.Warn("template redefined", "template", name, "definition", def.String(), "previous", old.String())
+	case redefineError:
+		return fmt.Errorf("template: redefinition of %s, previously defined as %s", def, old)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package template
+
+import (
+	"context"
+	"io"
+
+	"github.com/moisespsena-go/umbu/funcs"
+)
+
+// Renderer executes a template with the functions and the options frozen
+// at its creation, as a shared executor of the handlers of a service:
+//
+//	var page = template.Must(template.New("page").Parse(text)).
+//		CreateExecutor(helpers).SetValidateData(true).Renderer()
+//
+//	func handler(w http.ResponseWriter, r *http.Request) {
+//		if err := page.Execute(r.Context(), w, data(r)); err != nil {
+//			log.Print(err)
+//		}
+//	}
+//
+// The functions of the executor and of its parents are resolved once, in a
+// single stack, and each execution copies only the frozen executor, so the
+// executions don't create children of the executor, as the ones of Funcs
+// and FuncsValues. A Renderer may be used by concurrent executions.
+type Renderer struct {
+	executor *Executor
+}
+
+// NewRenderer returns a renderer of the template with the options and the
+// functions, whose layers follow the ones of the template.
+func NewRenderer(t *Template, options StateOptions, funcValues ...funcs.FuncValues) *Renderer {
+	executor := t.CreateExecutor().FuncsValues(funcValues...)
+	executor.StateOptions = options
+	return executor.Renderer()
+}
+
+// Renderer returns a renderer freezing the template, the functions and the
+// options of the executor. Changing the executor after doesn't change the
+// renderer.
+func (this *Executor) Renderer() *Renderer {
+	frozen := *this
+	frozen.parent = nil
+	frozen.funcs = funcs.NewAtomicFuncValues(this.AllFuncs())
+	if this.IsWriteError() {
+		frozen.writeError = 1
+	}
+	frozen.outputFilters = this.outputFilters[:len(this.outputFilters):len(this.outputFilters)]
+	frozen.Local = nil
+	return &Renderer{&frozen}
+}
+
+// Renderer returns a renderer of the template with its functions. See
+// Executor.Renderer.
+func (t *Template) Renderer() *Renderer {
+	return t.CreateExecutor().Renderer()
+}
+
+// Template returns the template executed.
+func (r *Renderer) Template() *Template {
+	return r.executor.template
+}
+
+// Execute applies the template to the data, with the context ctx, and
+// writes the output to w. See Executor.ExecuteContext.
+func (r *Renderer) Execute(ctx context.Context, w io.Writer, data interface{}) error {
+	executor := *r.executor
+	executor.Local = LocalData{}
+	return executor.ExecuteContext(ctx, w, data)
+}
@@ -0,0 +1,151 @@
+package template
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/moisespsena-go/umbu/text/template/parse"
+)
+
+// ReparseTemplate parses text as the new definition of the template named
+// name, associated with t, and swaps it atomically: the executions in
+// progress keep the old definition and the next ones use the new. Unlike
+// Parse, only that template is parsed, so it is cheap to use to apply the
+// edit of a template of a big set.
+//
+// The text is either the body of the template, which keeps the arguments
+// of the old definition, or its {{define}} action. It may not define other
+// templates. The template is replaced by a new Template, which is returned:
+// the Template values of the old definition aren't changed.
+//
+// The functions registered by OnChange are called with name and the names
+// of the templates depending on it.
+func (t *Template) ReparseTemplate(name, text string) (*Template, error) {
+	t.init()
+	trees := make(map[string]*parse.Tree)
+	tree := parse.New(name)
+	tree.Mode = t.parseMode
+	tree.TextHooks = t.textHooks
+	tree.NewTextFilter = t.textFilter
+	if _, err := tree.Parse(text, t.leftDelim, t.rightDelim, trees); err != nil {
+		return nil, err
+	}
+	for defined := range trees {
+		if defined != name {
+			return nil, fmt.Errorf("template: %s: reparse defines template %q", name, defined)
+		}
+	}
+	tree = trees[name]
+
+	t.mu.Lock()
+	if err := t.checkParams(name, tree); err != nil {
+		t.mu.Unlock()
+		return nil, err
+	}
+	old := t.tmpl[name]
+	nt := t.New(name, tree.Args()...)
+	nt.Tree = tree
+	if old != nil {
+		nt.Path = old.Path
+		nt.funcs.Store(old.funcs.Load())
+		if len(nt.args) == 0 {
+			nt.args = old.args
+		}
+	}
+	t.tmpl[name] = nt
+	t.defs[name] = Definition{Name: name, Source: t.name, Path: nt.Path}
+	changed := append([]string{name}, t.dependents(name)...)
+	listeners := t.onChange
+	t.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(changed)
+	}
+	return nt, nil
+}
+
+// OnChange registers fn to be called with the names of the templates
+// changed by ReparseTemplate, directly or by depending on the reparsed
+// template, such as to invalidate the cached outputs of these templates.
+func (t *Template) OnChange(fn func(names []string)) *Template {
+	t.init()
+	t.mu.Lock()
+	t.onChange = append(t.onChange[:len(t.onChange):len(t.onChange)], fn)
+	t.mu.Unlock()
+	return t
+}
+
+// Calls returns the names of the templates invoked by the template named
+// name, directly, sorted. The invocations by dynamic names aren't listed.
+func (t *Template) Calls(name string) []string {
+	if t.common == nil {
+		return nil
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	tmpl := t.tmpl[name]
+	if tmpl == nil || tmpl.Tree == nil || tmpl.Root == nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	var calls []string
+	parse.Inspect(tmpl.Root, func(n parse.Node) bool {
+		if call, ok := n.(*parse.TemplateNode); ok && call.NameNode == nil && !seen[call.Name] {
+			seen[call.Name] = true
+			calls = append(calls, call.Name)
+		}
+		return true
+	})
+	sort.Strings(calls)
+	return calls
+}
+
+// Dependents returns the names of the templates associated with t that
+// invoke the template named name, directly or through other templates,
+// sorted. The templates invoking templates by dynamic names are assumed to
+// invoke any template.
+func (t *Template) Dependents(name string) []string {
+	if t.common == nil {
+		return nil
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.dependents(name)
+}
+
+func (t *Template) dependents(name string) []string {
+	// callers maps each template to the templates invoking it.
+	callers := make(map[string][]string)
+	var dynamic []string
+	for caller, tmpl := range t.tmpl {
+		if tmpl.Tree == nil || tmpl.Root == nil {
+			continue
+		}
+		parse.Inspect(tmpl.Root, func(n parse.Node) bool {
+			if call, ok := n.(*parse.TemplateNode); ok {
+				if call.NameNode != nil {
+					dynamic = append(dynamic, caller)
+				} else {
+					callers[call.Name] = append(callers[call.Name], caller)
+				}
+			}
+			return true
+		})
+	}
+	seen := map[string]bool{name: true}
+	queue := []string{name}
+	var deps []string
+	for len(queue) > 0 {
+		called := queue[0]
+		queue = queue[1:]
+		for _, caller := range append(callers[called], dynamic...) {
+			if !seen[caller] {
+				seen[caller] = true
+				deps = append(deps, caller)
+				queue = append(queue, caller)
+			}
+		}
+	}
+	sort.Strings(deps)
+	return deps
+}
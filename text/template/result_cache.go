@@ -0,0 +1,161 @@
+package template
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrNoCacheKey is the error of ExecuteCached called with an empty key.
+var ErrNoCacheKey = errors.New("template: ExecuteCached: empty key")
+
+// ResultCache caches the outputs of the executions by ExecuteCached, so it
+// should be shared by the executors. See Executor.SetResultCache.
+type ResultCache struct {
+	// TTL is the duration of the cached outputs. If zero, the outputs
+	// don't expire.
+	TTL time.Duration
+	// MaxEntries is the maximum number of cached outputs. If zero, the
+	// number isn't limited.
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries map[string]resultEntry
+	purged  time.Time // the time of the last removal of the expired outputs.
+}
+
+// resultEntry is a cached output.
+type resultEntry struct {
+	out     []byte
+	expires time.Time // zero if the output doesn't expire.
+}
+
+// SetResultCache sets the cache of the outputs of ExecuteCached. A nil
+// cache disables the caching, the default.
+func (this *Executor) SetResultCache(cache *ResultCache) *Executor {
+	this.StateOptions.ResultCache = cache
+	return this
+}
+
+// ExecuteCached executes the template as Execute, writing the output cached
+// for the key by the cache of the executor, for the templates whose data
+// changes rarely, as the footers and the menus:
+//
+//	err := executor.SetResultCache(cache).ExecuteCached(w, menu, "menu:"+lang)
+//
+// The key must identify the output: the data and anything else it depends
+// on, as the locale or the user, so an empty key fails with ErrNoCacheKey.
+// The keys are of the template, so the executors of other templates may
+// share the cache. The outputs of the failed executions aren't cached.
+// See ExecuteCachedHash to key the outputs by the data.
+func (this *Executor) ExecuteCached(wr io.Writer, data interface{}, key string) error {
+	if key == "" {
+		return ErrNoCacheKey
+	}
+	return this.executeCached(wr, data, key)
+}
+
+// ExecuteCachedHash executes the template as ExecuteCached, keying the
+// output by key, for anything else it depends on, and the hash of the JSON
+// encoding of data:
+//
+//	err := executor.SetResultCache(cache).ExecuteCachedHash(w, menu, lang)
+//
+// The hash covers only what encoding/json encodes: the exported fields, and
+// the values behind the pointers, not the pointers. It doesn't cover the
+// unexported fields, nor the results of the methods and of the functions
+// called by the template, so the data depending on them must be keyed by
+// ExecuteCached. The data that can't be encoded, as the functions and the
+// channels, fails with the error of the encoding.
+func (this *Executor) ExecuteCachedHash(wr io.Writer, data interface{}, key string) error {
+	if this.StateOptions.ResultCache == nil {
+		return this.Execute(wr, data)
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("template: ExecuteCachedHash: %w", err)
+	}
+	sum := sha256.Sum256(b)
+	return this.executeCached(wr, data, key+"\x00"+hex.EncodeToString(sum[:]))
+}
+
+// executeCached is ExecuteCached with a non-empty key.
+func (this *Executor) executeCached(wr io.Writer, data interface{}, key string) error {
+	cache := this.StateOptions.ResultCache
+	if cache == nil {
+		return this.Execute(wr, data)
+	}
+	if this.template != nil {
+		key = this.template.FullName() + "\x00" + key
+	}
+	if out, ok := cache.get(key); ok {
+		_, err := wr.Write(out)
+		return err
+	}
+	b := getBuffer(this.StateOptions.BufferSize)
+	defer putBuffer(b)
+	if err := this.Execute(b, data); err != nil {
+		return err
+	}
+	cache.put(key, b.Bytes())
+	_, err := wr.Write(b.Bytes())
+	return err
+}
+
+// Clear removes the cached outputs.
+func (this *ResultCache) Clear() {
+	this.mu.Lock()
+	this.entries = nil
+	this.mu.Unlock()
+}
+
+// get returns the output cached for the key, if not expired.
+func (this *ResultCache) get(key string) ([]byte, bool) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	e, ok := this.entries[key]
+	if ok && !e.expires.IsZero() && !time.Now().Before(e.expires) {
+		delete(this.entries, key)
+		return nil, false
+	}
+	return e.out, ok
+}
+
+// put caches a copy of the output for the key, removing the expired
+// outputs, at most once per TTL, and then any other over MaxEntries.
+func (this *ResultCache) put(key string, out []byte) {
+	e := resultEntry{out: append([]byte(nil), out...)}
+	now := time.Now()
+	if this.TTL > 0 {
+		e.expires = now.Add(this.TTL)
+	}
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.entries == nil {
+		this.entries = map[string]resultEntry{}
+	}
+	_, ok := this.entries[key]
+	full := !ok && this.MaxEntries > 0 && len(this.entries) >= this.MaxEntries
+	if full || (this.TTL > 0 && now.Sub(this.purged) >= this.TTL) {
+		this.purged = now
+		for k, e := range this.entries {
+			if !e.expires.IsZero() && !now.Before(e.expires) {
+				delete(this.entries, k)
+			}
+		}
+	}
+	if full {
+		for k := range this.entries {
+			if len(this.entries) < this.MaxEntries {
+				break
+			}
+			delete(this.entries, k)
+		}
+	}
+	this.entries[key] = e
+}
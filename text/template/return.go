@@ -0,0 +1,79 @@
+package template
+
+import (
+	"reflect"
+
+	"github.com/moisespsena-go/umbu/text/template/parse"
+)
+
+// templateResult is the result of the execution of a template, set by its
+// {{return}} action.
+type templateResult struct {
+	value    reflect.Value
+	returned bool
+}
+
+// templateReturn is the panic of the {{return}} action, ending the
+// execution of the template at depth.
+type templateReturn struct {
+	depth int
+	value reflect.Value
+}
+
+// recoverReturn ends the execution of the template stopped by its
+// {{return}} action, setting its result to r.
+func (this *State) recoverReturn(r *templateResult) {
+	if e := recover(); e != nil {
+		ret, ok := e.(*templateReturn)
+		if !ok || ret.depth != this.depth {
+			panic(e)
+		}
+		r.value, r.returned = ret.value, true
+	}
+}
+
+// SetOperandOutput sets the conversion of the output of the templates
+// invoked as operands, which don't return a value, as html/template types
+// it as HTML. The output is a string by default.
+func (this *Executor) SetOperandOutput(convert func(output string) interface{}) *Executor {
+	this.StateOptions.OperandOutput = convert
+	return this
+}
+
+// walkReturn ends the execution of the template with the value of the
+// pipeline of the {{return}} action as its result.
+//
+// The result is the value of a template invoked as an operand. A template
+// executed by Execute or by a {{template}} statement discards it: its
+// execution just ends there, its output so far kept.
+func (this *State) walkReturn(dot reflect.Value, r *parse.ReturnNode) {
+	this.at(r)
+	panic(&templateReturn{this.depth, this.evalPipeline(dot, r.Pipe)})
+}
+
+// evalTemplate executes the template invoked as an operand, as in
+// {{$total := template "calc" .Items}}, returning the value of its
+// {{return}} action or, if it doesn't return, its output, converted by
+// StateOptions.OperandOutput, if set:
+//
+//	{{define "calc"}}{{$sum := 0}}{{range .}}{{$sum += .Price}}{{end}}{{return $sum}}{{end}}
+func (this *State) evalTemplate(dot reflect.Value, t *parse.TemplateNode) reflect.Value {
+	w := this.buffer()
+	defer putBuffer(w)
+	defer this.withWriter(w)()
+	if result := this.walkTemplate(dot, t); result.returned {
+		return result.value
+	}
+	if convert := this.e.StateOptions.OperandOutput; convert != nil {
+		return reflect.ValueOf(convert(w.String()))
+	}
+	return reflect.ValueOf(w.String())
+}
+
+// walkRoot walks the body of the template executed, until its end or its
+// {{return}} action.
+func (this *State) walkRoot(dot reflect.Value) {
+	var result templateResult
+	defer this.recoverReturn(&result)
+	this.walk(dot, this.tmpl.Root)
+}
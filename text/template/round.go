@@ -0,0 +1,93 @@
+package template
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RoundingMode is the mode of the rounding of the numbers formatted by the
+// numberf builtin, which rounds their shortest decimal representations, so
+// 1.005 is rounded to 1.01 in the HalfUp mode, as in the invoices written
+// by hand.
+type RoundingMode string
+
+const (
+	// HalfUp rounds the ties away from zero. It is the default.
+	HalfUp RoundingMode = "half_up"
+	// HalfDown rounds the ties toward zero.
+	HalfDown RoundingMode = "half_down"
+	// HalfEven rounds the ties to the even digit, the banker's rounding.
+	HalfEven RoundingMode = "half_even"
+	// Up rounds away from zero.
+	Up RoundingMode = "up"
+	// Down rounds toward zero, truncating.
+	Down RoundingMode = "down"
+	// Ceil rounds toward positive infinity.
+	Ceil RoundingMode = "ceil"
+	// Floor rounds toward negative infinity.
+	Floor RoundingMode = "floor"
+)
+
+// roundDecimal rounds the decimal number s, without exponent, to the
+// decimals in the mode.
+func roundDecimal(s string, decimals int, mode RoundingMode) (string, error) {
+	neg := strings.HasPrefix(s, "-")
+	if neg {
+		s = s[1:]
+	}
+	intPart, frac, _ := strings.Cut(s, ".")
+	if len(frac) <= decimals {
+		frac += strings.Repeat("0", decimals-len(frac))
+		return joinDecimal(neg, intPart, frac), nil
+	}
+	kept, rest := frac[:decimals], frac[decimals:]
+	digits := intPart + kept
+	nonZeroRest := strings.TrimRight(rest, "0") != ""
+	nonZeroAfterFirst := strings.TrimRight(rest[1:], "0") != ""
+
+	var increment bool
+	switch mode {
+	case HalfUp, "":
+		increment = rest[0] >= '5'
+	case HalfDown:
+		increment = rest[0] > '5' || rest[0] == '5' && nonZeroAfterFirst
+	case HalfEven:
+		last := digits[len(digits)-1]
+		increment = rest[0] > '5' || rest[0] == '5' && (nonZeroAfterFirst || (last-'0')%2 == 1)
+	case Up:
+		increment = nonZeroRest
+	case Down:
+	case Ceil:
+		increment = !neg && nonZeroRest
+	case Floor:
+		increment = neg && nonZeroRest
+	default:
+		return "", fmt.Errorf("invalid rounding mode %q", mode)
+	}
+	if increment {
+		b := []byte(digits)
+		i := len(b) - 1
+		for ; i >= 0 && b[i] == '9'; i-- {
+			b[i] = '0'
+		}
+		if i < 0 {
+			b = append([]byte{'1'}, b...)
+		} else {
+			b[i]++
+		}
+		digits = string(b)
+	}
+	return joinDecimal(neg, digits[:len(digits)-decimals], digits[len(digits)-decimals:]), nil
+}
+
+// joinDecimal joins the parts of a decimal number, without the sign of zero.
+func joinDecimal(neg bool, intPart, frac string) string {
+	s := intPart
+	if frac != "" {
+		s += "." + frac
+	}
+	if neg && strings.Trim(s, "0.") != "" {
+		s = "-" + s
+	}
+	return s
+}
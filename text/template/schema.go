@@ -0,0 +1,417 @@
+package template
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/moisespsena-go/umbu/text/template/parse"
+)
+
+// Schema is the JSON Schema like description of the data expected by a
+// template, inferred by Template.Schema. Its JSON encoding is a JSON Schema:
+//
+//	{"type":"object","properties":{"Items":{"type":"array","items":{...}}},"required":["Items"]}
+//
+// A schema without type describes a value whose type can't be inferred.
+type Schema struct {
+	Type        string             `json:"type,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+}
+
+// Schema returns the description of the data expected by t, inferred from
+// its actions, as for generating sample data and forms:
+//
+//   - the fields, as .User.Name, are the properties of objects, required
+//     unless optional, as .User.Phone?, or tested by if and with;
+//   - the pipelines ranged over, as .Items, are arrays of the elements used
+//     by the range bodies;
+//   - the values compared to literals, as by eq .Status "active", have the
+//     types of the literals, and the operands of arithmetic are numbers;
+//   - the arguments of the templates called have the types declared by
+//     their parameters or documented by their "@arg" lines, see TemplateDoc;
+//   - the fields and variables declared by "umbu:arg" pragmas have their
+//     declared types, see Executor.SetValidateData.
+//
+// The called templates are followed, with the data passed to them. The
+// results of the functions and the methods are not described.
+func (t *Template) Schema() *Schema {
+	root := &Schema{}
+	if t.Tree == nil || t.Root == nil {
+		return root
+	}
+	s := &schemaInferrer{t: t, walking: map[*parse.Tree]bool{}}
+	s.template(t, root, nil)
+	return root
+}
+
+// schemaVar is a variable of the template being inferred.
+type schemaVar struct {
+	name   string
+	schema *Schema
+}
+
+// schemaInferrer infers the schemas of the data of the templates by walking
+// their trees, tracking the schemas of the dot and of the variables.
+type schemaInferrer struct {
+	t       *Template
+	vars    []schemaVar
+	walking map[*parse.Tree]bool // the templates being walked, so the recursive ones are walked once.
+}
+
+// template walks the template with the dot and the arguments.
+func (s *schemaInferrer) template(tmpl *Template, dot *Schema, args []*Schema) {
+	if s.walking[tmpl.Tree] {
+		return
+	}
+	s.walking[tmpl.Tree] = true
+	defer delete(s.walking, tmpl.Tree)
+
+	vars := s.vars
+	s.vars = []schemaVar{{"$", dot}}
+	defer func() { s.vars = vars }()
+	var params []parse.Param
+	if tmpl.Tree != nil {
+		params = tmpl.Tree.Params()
+	}
+	for i, name := range tmpl.args {
+		arg := &Schema{}
+		if i < len(args) {
+			arg = args[i]
+		}
+		if i < len(params) {
+			arg.setGoType(params[i].Type)
+		}
+		s.vars = append(s.vars, schemaVar{name, arg})
+	}
+	for _, arg := range tmpl.Tree.DataArgs() {
+		var schema *Schema
+		if strings.HasPrefix(arg.Name, ".") {
+			schema = dot.path(strings.Split(arg.Name[1:], "."), !arg.Optional)
+		} else {
+			schema = s.variable(arg.Name)
+		}
+		if schema != nil {
+			schema.setGoType(arg.Type)
+		}
+	}
+	if doc, ok := tmpl.Doc(); ok {
+		for _, arg := range doc.Args {
+			var schema *Schema
+			switch {
+			case strings.HasPrefix(arg.Name, "."):
+				schema = dot.path(strings.Split(arg.Name[1:], "."), true)
+			case strings.HasPrefix(arg.Name, "$"):
+				schema = s.variable(arg.Name)
+			}
+			if schema != nil {
+				schema.setGoType(arg.Type)
+				if schema.Description == "" {
+					schema.Description = arg.Description
+				}
+			}
+		}
+	}
+	s.list(dot, tmpl.Root)
+}
+
+func (s *schemaInferrer) list(dot *Schema, list *parse.ListNode) {
+	if list == nil {
+		return
+	}
+	mark := len(s.vars)
+	defer func() { s.vars = s.vars[:mark] }()
+	for _, n := range list.Nodes {
+		s.node(dot, n)
+	}
+}
+
+func (s *schemaInferrer) node(dot *Schema, n parse.Node) {
+	switch n := n.(type) {
+	case *parse.ActionNode:
+		s.pipe(dot, n.Pipe, true)
+	case *parse.IfNode:
+		mark := len(s.vars)
+		s.pipe(dot, n.Pipe, false)
+		s.list(dot, n.List)
+		s.list(dot, n.ElseList)
+		s.vars = s.vars[:mark]
+	case *parse.WithNode:
+		mark := len(s.vars)
+		s.list(s.pipe(dot, n.Pipe, false), n.List)
+		s.list(dot, n.ElseList)
+		s.vars = s.vars[:mark]
+	case *parse.RangeNode:
+		mark := len(s.vars)
+		elem := s.pipe(dot, n.Pipe, true).elem()
+		if decl := n.Pipe.Decl; len(decl) > 0 {
+			s.vars = append(s.vars[:len(s.vars)-len(decl)], schemaVar{decl[len(decl)-1].Ident[0], elem})
+			if len(decl) == 2 {
+				s.vars = append(s.vars, schemaVar{decl[0].Ident[0], &Schema{}})
+			}
+		}
+		s.list(elem, n.List)
+		s.vars = s.vars[:mark]
+		s.list(dot, n.ElseList)
+	case *parse.ArgNode:
+		s.branch(dot, &n.BranchNode)
+	case *parse.CallbackNode:
+		s.branch(dot, &n.BranchNode)
+	case *parse.WrapNode:
+		mark := len(s.vars)
+		s.pipe(dot, n.Pipe, true)
+		s.list(dot, n.BeginList)
+		s.list(dot, n.List)
+		s.list(dot, n.AfterList)
+		s.list(dot, n.ElseList)
+		s.vars = s.vars[:mark]
+	case *parse.CustomNode:
+		mark := len(s.vars)
+		s.pipe(dot, n.Pipe, true)
+		s.list(dot, n.List)
+		s.list(dot, n.ElseList)
+		s.vars = s.vars[:mark]
+	case *parse.TemplateNode:
+		s.call(dot, n)
+	case *parse.ReturnNode:
+		s.pipe(dot, n.Pipe, true)
+	}
+}
+
+func (s *schemaInferrer) branch(dot *Schema, b *parse.BranchNode) {
+	mark := len(s.vars)
+	s.pipe(dot, b.Pipe, true)
+	s.list(dot, b.List)
+	s.list(dot, b.ElseList)
+	s.vars = s.vars[:mark]
+}
+
+// call walks the template called by the node, if its name is constant, with
+// the schemas of the data and of the arguments passed to it.
+func (s *schemaInferrer) call(dot *Schema, n *parse.TemplateNode) {
+	data := &Schema{}
+	var args []*Schema
+	if n.Pipe != nil && len(n.Pipe.Cmds) == 1 {
+		cmd := n.Pipe.Cmds[0]
+		data = s.pipe(dot, &parse.PipeNode{Decl: n.Pipe.Decl, Cmds: []*parse.CommandNode{cmd.WithArgs(cmd.Args[0])}}, true)
+		for _, arg := range cmd.Args[1:] {
+			args = append(args, s.operand(dot, arg, true))
+		}
+	} else if n.Pipe != nil {
+		data = s.pipe(dot, n.Pipe, true)
+	}
+	if n.NameNode != nil {
+		return
+	}
+	if tmpl := s.t.Lookup(n.Name); tmpl != nil && tmpl.Tree != nil && tmpl.Root != nil {
+		s.template(tmpl, data, args)
+	}
+}
+
+// pipe returns the schema of the value of the pipeline, declaring its
+// variables. The fields of the pipelines of a single field, as the ones
+// tested by if, are required only if required is.
+func (s *schemaInferrer) pipe(dot *Schema, pipe *parse.PipeNode, required bool) *Schema {
+	if pipe == nil {
+		return &Schema{}
+	}
+	var value *Schema
+	for _, cmd := range pipe.Cmds {
+		value = s.command(dot, cmd, value, required && len(pipe.Cmds) == 1)
+	}
+	for _, v := range pipe.Decl {
+		if v.Update {
+			continue
+		}
+		s.vars = append(s.vars, schemaVar{v.Ident[0], value})
+	}
+	return value
+}
+
+// command returns the schema of the value of the command, final being the
+// one of the value piped into it, if any.
+func (s *schemaInferrer) command(dot *Schema, cmd *parse.CommandNode, final *Schema, required bool) *Schema {
+	if len(cmd.Args) == 1 && final == nil {
+		return s.operand(dot, cmd.Args[0], required)
+	}
+	operands := make([]*Schema, 0, len(cmd.Args))
+	for _, arg := range cmd.Args[1:] {
+		operands = append(operands, s.operand(dot, arg, true))
+	}
+	if final != nil {
+		operands = append(operands, final)
+	}
+	switch first := cmd.Args[0].(type) {
+	case *parse.IdentifierNode:
+		switch first.Ident {
+		case "eq", "ne", "lt", "le", "gt", "ge":
+			var typ string
+			for _, o := range operands {
+				if o.literal() {
+					typ = o.Type
+				}
+			}
+			for _, o := range operands {
+				if o.Type == "" {
+					o.Type = typ
+				}
+			}
+		case "index":
+			if len(operands) == 2 && operands[1].literal() {
+				if operands[1].Type == "string" {
+					return operands[0].property(cmd.Args[2].(*parse.StringNode).Text, true)
+				}
+				return operands[0].elem()
+			}
+		}
+	default:
+		s.operand(dot, first, required)
+	}
+	return &Schema{}
+}
+
+// literalSchemas are the schemas of the literals, to be told apart from the
+// schemas of the values by literal.
+var literalSchemas = map[string]*Schema{
+	"string":  {Type: "string"},
+	"boolean": {Type: "boolean"},
+	"integer": {Type: "integer"},
+	"number":  {Type: "number"},
+}
+
+func (s *Schema) literal() bool {
+	return literalSchemas[s.Type] == s
+}
+
+// operand returns the schema of the value of the node.
+func (s *schemaInferrer) operand(dot *Schema, n parse.Node, required bool) *Schema {
+	switch n := n.(type) {
+	case *parse.DotNode:
+		return dot
+	case *parse.FieldNode:
+		return dot.path(n.Ident, required && !n.NotRequired)
+	case *parse.VariableNode:
+		if v := s.variable(n.Ident[0]); v != nil {
+			return v.path(n.Ident[1:], required)
+		}
+	case *parse.ChainNode:
+		return s.operand(dot, n.Node, true).path(n.Field, required)
+	case *parse.PipeNode:
+		mark := len(s.vars)
+		defer func() { s.vars = s.vars[:mark] }()
+		return s.pipe(dot, n, true)
+	case *parse.ExprNode:
+		var operands []*Schema
+		for _, cmd := range []*parse.CommandNode{n.A, n.B} {
+			if cmd != nil {
+				operands = append(operands, s.command(dot, cmd, nil, true))
+			}
+		}
+		switch n.Op {
+		case '+', '-', '*', '/', '%':
+			for _, o := range operands {
+				if o.Type == "" {
+					o.Type = "number"
+				}
+			}
+		}
+	case *parse.StringNode:
+		return literalSchemas["string"]
+	case *parse.BoolNode:
+		return literalSchemas["boolean"]
+	case *parse.NumberNode:
+		if n.IsInt {
+			return literalSchemas["integer"]
+		}
+		return literalSchemas["number"]
+	case *parse.TemplateNode:
+		s.call(dot, n)
+	}
+	return &Schema{}
+}
+
+// variable returns the schema of the innermost variable named name, nil if
+// not declared.
+func (s *schemaInferrer) variable(name string) *Schema {
+	for i := len(s.vars) - 1; i >= 0; i-- {
+		if s.vars[i].name == name {
+			return s.vars[i].schema
+		}
+	}
+	return nil
+}
+
+// path returns the schema of the property of the path, adding it if
+// missing. The last property is required only if required is.
+func (s *Schema) path(path []string, required bool) *Schema {
+	for i, name := range path {
+		s = s.property(name, required || i < len(path)-1)
+	}
+	return s
+}
+
+// property returns the schema of the property named name, adding it if
+// missing. The literals have no properties.
+func (s *Schema) property(name string, required bool) *Schema {
+	if s.literal() {
+		return &Schema{}
+	}
+	if s.Type == "" {
+		s.Type = "object"
+	}
+	if s.Properties == nil {
+		s.Properties = map[string]*Schema{}
+	}
+	p := s.Properties[name]
+	if p == nil {
+		p = &Schema{}
+		s.Properties[name] = p
+	}
+	if required {
+		if i := sort.SearchStrings(s.Required, name); i == len(s.Required) || s.Required[i] != name {
+			s.Required = append(s.Required, "")
+			copy(s.Required[i+1:], s.Required[i:])
+			s.Required[i] = name
+		}
+	}
+	return p
+}
+
+// elem returns the schema of the elements of the array s, making s an array
+// if untyped.
+func (s *Schema) elem() *Schema {
+	if s.Type == "" {
+		s.Type = "array"
+	}
+	if s.Type != "array" {
+		return &Schema{}
+	}
+	if s.Items == nil {
+		s.Items = &Schema{}
+	}
+	return s.Items
+}
+
+// setGoType sets the type of the untyped s from the Go type name, as
+// "[]Item". The named types, but the basic ones, aren't described.
+func (s *Schema) setGoType(typ string) {
+	if s.Type != "" || s.literal() {
+		return
+	}
+	switch {
+	case strings.HasPrefix(typ, "[]"):
+		s.elem().setGoType(typ[2:])
+	case strings.HasPrefix(typ, "map["):
+		s.Type = "object"
+	case typ == "string":
+		s.Type = "string"
+	case typ == "bool":
+		s.Type = "boolean"
+	case typ == "float32", typ == "float64":
+		s.Type = "number"
+	case typ == "rune", typ == "byte", strings.HasPrefix(typ, "int"), strings.HasPrefix(typ, "uint"):
+		s.Type = "integer"
+	}
+}
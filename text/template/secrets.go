@@ -0,0 +1,154 @@
+package template
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SecretMask replaces the resolved secrets in the error messages.
+const SecretMask = "******"
+
+// SecretsProvider resolves the secrets of the secret builtin, as from a
+// vault or a secrets manager.
+type SecretsProvider interface {
+	Secret(ctx context.Context, key string) (string, error)
+}
+
+// SecretsFunc is a function resolving secrets.
+type SecretsFunc func(ctx context.Context, key string) (string, error)
+
+func (f SecretsFunc) Secret(ctx context.Context, key string) (string, error) {
+	return f(ctx, key)
+}
+
+// Secrets enables the secret builtin, resolving the secrets by its
+// provider. It records the keys of the resolved secrets and masks their
+// values in the errors of the executions, so a Secrets should be shared by
+// the executions. See Executor.SetSecrets.
+type Secrets struct {
+	Provider SecretsProvider
+
+	mu     sync.Mutex
+	keys   map[string]bool
+	values map[string]bool
+}
+
+// NewSecrets returns the secrets of the provider.
+func NewSecrets(provider SecretsProvider) *Secrets {
+	return &Secrets{Provider: provider}
+}
+
+// SetSecrets enables the secret builtin, resolving the secrets by the
+// provider of the secrets. A nil secrets disables it, the default:
+//
+//	password = {{secret "db/password"}}
+//
+// The values of the resolved secrets are replaced by SecretMask in the
+// errors returned by the executions.
+func (this *Executor) SetSecrets(secrets *Secrets) *Executor {
+	this.StateOptions.Secrets = secrets
+	return this
+}
+
+// Resolve returns the value of the secret of the key, recording it.
+func (s *Secrets) Resolve(ctx context.Context, key string) (string, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	value, err := s.Provider.Secret(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keys == nil {
+		s.keys, s.values = map[string]bool{}, map[string]bool{}
+	}
+	s.keys[key] = true
+	if value != "" {
+		s.values[value] = true
+	}
+	return value, nil
+}
+
+// Keys returns the sorted keys of the resolved secrets.
+func (s *Secrets) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.keys))
+	for key := range s.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Mask replaces the values of the resolved secrets in the text by
+// SecretMask, the longest ones first.
+func (s *Secrets) Mask(text string) string {
+	s.mu.Lock()
+	values := make([]string, 0, len(s.values))
+	for value := range s.values {
+		values = append(values, value)
+	}
+	s.mu.Unlock()
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	for _, value := range values {
+		text = strings.ReplaceAll(text, value, SecretMask)
+	}
+	return text
+}
+
+// maskedError is an error whose message has the secrets masked.
+type maskedError struct {
+	err     error
+	secrets *Secrets
+}
+
+func (e *maskedError) Error() string {
+	return e.secrets.Mask(e.err.Error())
+}
+
+// Is reports whether the masked error matches target, as the sentinel
+// errors, without unwrapping it, which would expose its message.
+func (e *maskedError) Is(target error) bool {
+	return errors.Is(e.err, target)
+}
+
+// maskError returns the error with the secrets masked.
+func (s *Secrets) maskError(err error) error {
+	if _, ok := err.(*maskedError); ok || err == nil {
+		return err
+	}
+	return &maskedError{err, s}
+}
+
+// maskValue returns the value of a log attribute with the secrets masked.
+func (s *Secrets) maskValue(v any) any {
+	switch v := v.(type) {
+	case string:
+		return s.Mask(v)
+	case error:
+		return s.maskError(v)
+	case slog.Attr:
+		return slog.Any(v.Key, s.maskValue(v.Value.Any()))
+	}
+	if text := fmt.Sprint(v); s.Mask(text) != text {
+		return s.Mask(text)
+	}
+	return v
+}
+
+// secret implements the secret builtin.
+func (this *State) secret(key string) (string, error) {
+	value, err := this.e.StateOptions.Secrets.Resolve(this.context, key)
+	if err != nil {
+		return "", fmt.Errorf("secret %q: %v", key, err)
+	}
+	return value, nil
+}
@@ -0,0 +1,94 @@
+package template
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/moisespsena-go/umbu/cast"
+)
+
+// sequence is the lazy sequence of integers of the seq and until builtins,
+// from start to last, inclusive, by step. It's an umbu.Iterator, so range
+// reads its numbers without allocating them.
+type sequence struct {
+	start, last, step int
+}
+
+func (s *sequence) Start() interface{} {
+	return s.start
+}
+
+func (s *sequence) Done(state interface{}) bool {
+	if s.step > 0 {
+		return state.(int) > s.last
+	}
+	return state.(int) < s.last
+}
+
+func (s *sequence) Next(state interface{}) (item, nextState interface{}) {
+	return state, state.(int) + s.step
+}
+
+// Len returns the number of items of the sequence.
+func (s *sequence) Len() int {
+	if n := (s.last-s.start)/s.step + 1; n > 0 {
+		return n
+	}
+	return 0
+}
+
+// String returns the numbers of the sequence as a slice, as "[1 2 3]".
+func (s *sequence) String() string {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i := 0; i < s.Len(); i++ {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprint(&b, s.start+i*s.step)
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// seq returns the lazy sequence of the integers from start to stop,
+// inclusive, by step. With one argument, the sequence is from 1 to it, and
+// the default step is 1, or -1 if start is greater than stop:
+//
+//	{{range seq 1 1000000}}...{{end}}
+func seq(args ...interface{}) (*sequence, error) {
+	if len(args) == 0 || len(args) > 3 {
+		return nil, fmt.Errorf("seq: want from 1 to 3 arguments, got %d", len(args))
+	}
+	var n [3]int
+	for i, arg := range args {
+		v, err := cast.ToInt(arg)
+		if err != nil {
+			return nil, fmt.Errorf("seq: %v", err)
+		}
+		n[i] = int(v)
+	}
+	s := &sequence{start: 1, last: n[0], step: 1}
+	if len(args) > 1 {
+		s.start, s.last = n[0], n[1]
+		if s.start > s.last {
+			s.step = -1
+		}
+	}
+	if len(args) == 3 {
+		if n[2] == 0 {
+			return nil, fmt.Errorf("seq: step is zero")
+		}
+		s.step = n[2]
+	}
+	return s, nil
+}
+
+// until returns the lazy sequence of the integers from 0 to n, exclusive,
+// counting down if n is negative.
+func until(n int) *sequence {
+	if n < 0 {
+		return &sequence{start: 0, last: n + 1, step: -1}
+	}
+	return &sequence{start: 0, last: n - 1, step: 1}
+}
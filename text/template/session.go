@@ -0,0 +1,135 @@
+package template
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Session evaluates template snippets incrementally, as the backend of a
+// template playground or of a REPL: the variables declared by a snippet are
+// visible to the following ones, as the templates it defines.
+//
+//	s := NewSession(New("repl").Funcs(funcMap), data)
+//	s.Eval(`{{$total := len .Items}}`)
+//	s.Eval(`{{$total}} items`) // "3 items"
+//
+// A Session isn't safe for concurrent use.
+type Session struct {
+	// Data is the data of the evaluations, the value of $ and of the dot of
+	// the snippets.
+	Data interface{}
+	// Setup, if not nil, configures the executor of each evaluation, as
+	// setting its locale or logger.
+	Setup func(e *Executor)
+
+	t    *Template
+	n    int
+	vars []variable
+}
+
+// NewSession returns a session evaluating the snippets with the functions,
+// the delimiters and the associated templates of t, and the data.
+func NewSession(t *Template, data interface{}) *Session {
+	t.init()
+	return &Session{Data: data, t: t}
+}
+
+// Eval parses and executes the snippet, returning its output. The
+// variables the snippet declares at the top level, out of the actions with
+// bodies, are kept for the next snippets. A failed snippet keeps the
+// variables of the previous ones.
+func (s *Session) Eval(src string) (string, error) {
+	s.n++
+	name := fmt.Sprintf("%s#%d", s.t.name, s.n)
+	tmpl := s.t.New(name)
+	tmpl.funcs.Store(s.t.funcs.Load())
+	names := make([]string, len(s.vars))
+	for i, v := range s.vars {
+		names[i] = v.name
+	}
+	if _, err := tmpl.parse(src, Limits{}, names); err != nil {
+		return "", err
+	}
+	defer s.t.remove(name)
+	if tmpl.Tree == nil || tmpl.Root == nil {
+		return "", nil
+	}
+	e := tmpl.CreateExecutor()
+	e.session = s
+	if s.Setup != nil {
+		s.Setup(e)
+	}
+	var b strings.Builder
+	err := e.Execute(&b, s.Data)
+	return b.String(), err
+}
+
+// setVars sets the variables of the session, keeping the last value of the
+// variables declared many times.
+func (s *Session) setVars(vars []variable) {
+	s.vars = s.vars[:0:0]
+	for i, v := range vars {
+		last := true
+		for _, w := range vars[i+1:] {
+			if w.name == v.name {
+				last = false
+				break
+			}
+		}
+		if last {
+			s.vars = append(s.vars, v)
+		}
+	}
+}
+
+// Vars returns the names of the variables of the session, as "$x", in
+// declaration order.
+func (s *Session) Vars() []string {
+	names := make([]string, len(s.vars))
+	for i, v := range s.vars {
+		names[i] = v.name
+	}
+	return names
+}
+
+// Var returns the value of the variable of the session, as "$x".
+func (s *Session) Var(name string) (value interface{}, ok bool) {
+	for _, v := range s.vars {
+		if v.name == name {
+			if v.value.IsValid() && v.value.CanInterface() {
+				value = v.value.Interface()
+			}
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// SetVar declares the variable of the session, as "$x", or sets its value.
+func (s *Session) SetVar(name string, value interface{}) {
+	if !strings.HasPrefix(name, "$") {
+		name = "$" + name
+	}
+	v := reflect.ValueOf(value)
+	for i := range s.vars {
+		if s.vars[i].name == name {
+			s.vars[i].value = v
+			return
+		}
+	}
+	s.vars = append(s.vars, variable{name, v})
+}
+
+// Reset removes the variables of the session.
+func (s *Session) Reset() {
+	s.vars = nil
+}
+
+// remove removes the template of the snippet from the associated templates.
+func (t *Template) remove(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.tmpl, name)
+	delete(t.defs, name)
+}
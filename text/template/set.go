@@ -0,0 +1,255 @@
+package template
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Set is a set of items, kept in insertion order. Range reads its items in
+// this order, as its String and MarshalJSON do:
+//
+//	{{$perms := set_new .User.Permissions}}
+//	{{if set_has $perms "admin"}}...{{end}}
+type Set struct {
+	items []interface{}
+	index map[interface{}]int
+}
+
+// NewSet returns a new Set with the items.
+func NewSet(items ...interface{}) *Set {
+	s := &Set{index: make(map[interface{}]int, len(items))}
+	for _, item := range items {
+		s.Add(item)
+	}
+	return s
+}
+
+// Add adds the item, if the set doesn't have it. The item must be
+// comparable.
+func (s *Set) Add(item interface{}) {
+	if s.index == nil {
+		s.index = map[interface{}]int{}
+	}
+	if _, ok := s.index[item]; !ok {
+		s.index[item] = len(s.items)
+		s.items = append(s.items, item)
+	}
+}
+
+// Has reports whether the set has the item.
+func (s *Set) Has(item interface{}) bool {
+	if item != nil && !reflect.TypeOf(item).Comparable() {
+		return false
+	}
+	_, ok := s.index[item]
+	return ok
+}
+
+// Remove removes the item.
+func (s *Set) Remove(item interface{}) {
+	if !s.Has(item) {
+		return
+	}
+	i := s.index[item]
+	delete(s.index, item)
+	s.items = append(s.items[:i], s.items[i+1:]...)
+	for ; i < len(s.items); i++ {
+		s.index[s.items[i]] = i
+	}
+}
+
+// Len returns the number of items.
+func (s *Set) Len() int {
+	return len(s.items)
+}
+
+// Items returns the items in insertion order.
+func (s *Set) Items() []interface{} {
+	return append([]interface{}(nil), s.items...)
+}
+
+func (s *Set) Start() interface{} {
+	return 0
+}
+
+func (s *Set) Done(state interface{}) bool {
+	return state.(int) >= len(s.items)
+}
+
+func (s *Set) Next(state interface{}) (item, nextState interface{}) {
+	return s.items[state.(int)], state.(int) + 1
+}
+
+// String returns the items formatted as a slice, as "[a b c]".
+func (s *Set) String() string {
+	return fmt.Sprint(s.items)
+}
+
+// MarshalJSON returns the JSON array of the items.
+func (s *Set) MarshalJSON() ([]byte, error) {
+	if s.items == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(s.items)
+}
+
+// addItems adds to the set the items, or the items of the lists and sets
+// of the items.
+func addItems(name string, s *Set, items []reflect.Value) error {
+	for _, item := range items {
+		item = indirectInterface(item)
+		if !item.IsValid() {
+			s.Add(nil)
+			continue
+		}
+		v, isNil := indirect(item)
+		if !isNil {
+			switch v.Kind() {
+			case reflect.Array, reflect.Slice:
+				if v.Type().Elem().Kind() != reflect.Uint8 {
+					for i := 0; i < v.Len(); i++ {
+						if err := addItem(name, s, v.Index(i)); err != nil {
+							return err
+						}
+					}
+					continue
+				}
+			case reflect.Struct:
+				if other, ok := item.Interface().(*Set); ok {
+					for _, item := range other.items {
+						s.Add(item)
+					}
+					continue
+				}
+			}
+		}
+		if err := addItem(name, s, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addItem adds the item to the set, if it's comparable.
+func addItem(name string, s *Set, item reflect.Value) error {
+	item = indirectInterface(item)
+	if !item.IsValid() {
+		s.Add(nil)
+		return nil
+	}
+	if !item.Type().Comparable() {
+		return fmt.Errorf("%s: can't add %s: it isn't comparable", name, item.Type())
+	}
+	s.Add(item.Interface())
+	return nil
+}
+
+// setArg returns the set argument of the builtin, or a new set of the items
+// of the list, empty if it's nil.
+func setArg(name string, s reflect.Value) (*Set, error) {
+	s = indirectInterface(s)
+	if !s.IsValid() {
+		return NewSet(), nil
+	}
+	if set, ok := s.Interface().(*Set); ok && set != nil {
+		return set, nil
+	}
+	set := NewSet()
+	return set, addItems(name, set, []reflect.Value{s})
+}
+
+// setNew returns a new set of the items. The items which are lists or sets
+// add their items:
+//
+//	{{$tags := set_new .Post.Tags "featured"}}
+func setNew(items ...reflect.Value) (*Set, error) {
+	s := NewSet()
+	return s, addItems("set_new", s, items)
+}
+
+// setAdd adds the items to the set, as set_new.
+func setAdd(s *Set, items ...reflect.Value) error {
+	return addItems("set_add", s, items)
+}
+
+// setHas reports whether the set, or the list, has all the items.
+func setHas(s reflect.Value, items ...reflect.Value) (bool, error) {
+	set, err := setArg("set_has", s)
+	if err != nil {
+		return false, err
+	}
+	for _, item := range items {
+		item = indirectInterface(item)
+		var v interface{}
+		if item.IsValid() {
+			v = item.Interface()
+		}
+		if !set.Has(v) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// setsArg returns the sets arguments of the builtin, at least two.
+func setsArg(name string, sets []reflect.Value) ([]*Set, error) {
+	if len(sets) < 2 {
+		return nil, fmt.Errorf("%s: want at least 2 sets, got %d", name, len(sets))
+	}
+	result := make([]*Set, len(sets))
+	for i, s := range sets {
+		var err error
+		if result[i], err = setArg(name, s); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// setUnion returns the set of the items of any of the sets or lists.
+func setUnion(sets ...reflect.Value) (*Set, error) {
+	all, err := setsArg("set_union", sets)
+	if err != nil {
+		return nil, err
+	}
+	s := NewSet()
+	for _, set := range all {
+		for _, item := range set.items {
+			s.Add(item)
+		}
+	}
+	return s, nil
+}
+
+// setIntersect returns the set of the items of the first set, or list,
+// which all the others have.
+func setIntersect(sets ...reflect.Value) (*Set, error) {
+	return filterSet("set_intersect", sets, true)
+}
+
+// setDifference returns the set of the items of the first set, or list,
+// which none of the others have.
+func setDifference(sets ...reflect.Value) (*Set, error) {
+	return filterSet("set_difference", sets, false)
+}
+
+// filterSet returns the set of the items of the first set which the others
+// all have, or none has.
+func filterSet(name string, sets []reflect.Value, all bool) (*Set, error) {
+	args, err := setsArg(name, sets)
+	if err != nil {
+		return nil, err
+	}
+	s := NewSet()
+items:
+	for _, item := range args[0].items {
+		for _, other := range args[1:] {
+			if other.Has(item) != all {
+				continue items
+			}
+		}
+		s.Add(item)
+	}
+	return s, nil
+}
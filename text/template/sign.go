@@ -0,0 +1,120 @@
+package template
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrBadSignature is the error of the templates whose signature doesn't
+// match their text, as the ones tampered with.
+var ErrBadSignature = errors.New("template: bad signature")
+
+// sealPrefix starts the first line of the sealed texts, followed by the
+// signature.
+const sealPrefix = "umbu-signature:"
+
+// Signer signs the texts of the templates, with HMAC-SHA256, and verifies
+// them before they are parsed, so the templates stored out of the
+// application, as in a database, can't be tampered with:
+//
+//	signer, err := template.NewSigner(key)
+//	sealed := signer.Seal("invoice", text) // stored
+//
+//	tmpl := template.New("invoice").SetProvider(signer.Provider(db))
+//
+// The signature covers the name of the template as well, so a text can't
+// be used as the one of another template.
+type Signer struct {
+	keys [][]byte
+}
+
+// MinSignerKeySize is the minimum size of the keys of a Signer, in bytes,
+// the size of the SHA-256 hashes.
+const MinSignerKeySize = sha256.Size
+
+// NewSigner returns a signer signing with the key and verifying with the
+// key or the previous keys, so the keys may be rotated without signing the
+// stored texts again at once. The keys must be random and of at least
+// MinSignerKeySize bytes.
+func NewSigner(key []byte, previousKeys ...[]byte) (*Signer, error) {
+	keys := append([][]byte{key}, previousKeys...)
+	for i, key := range keys {
+		if len(key) < MinSignerKeySize {
+			return nil, fmt.Errorf("template: signer key %d of %d bytes, want at least %d", i, len(key), MinSignerKeySize)
+		}
+	}
+	return &Signer{keys: keys}, nil
+}
+
+// Sign returns the signature of the text of the template named name, in
+// hexadecimal.
+func (s *Signer) Sign(name, text string) string {
+	return hex.EncodeToString(s.mac(s.keys[0], name, text))
+}
+
+// Verify returns an error wrapping ErrBadSignature unless signature is the
+// one of the text of the template named name, by any key of the signer.
+func (s *Signer) Verify(name, text, signature string) error {
+	sig, err := hex.DecodeString(signature)
+	if err == nil {
+		for _, key := range s.keys {
+			if hmac.Equal(sig, s.mac(key, name, text)) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w of template %q", ErrBadSignature, name)
+}
+
+func (s *Signer) mac(key []byte, name, text string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(text))
+	return h.Sum(nil)
+}
+
+// Seal returns the text of the template named name preceded by a line
+// with its signature, to be stored and opened by Open.
+func (s *Signer) Seal(name, text string) string {
+	return sealPrefix + s.Sign(name, text) + "\n" + text
+}
+
+// Open returns the text of the template named name sealed by Seal, once
+// verified.
+func (s *Signer) Open(name, sealed string) (string, error) {
+	line, text, ok := strings.Cut(sealed, "\n")
+	if !ok || !strings.HasPrefix(line, sealPrefix) {
+		return "", fmt.Errorf("%w: template %q isn't sealed", ErrBadSignature, name)
+	}
+	if err := s.Verify(name, text, strings.TrimPrefix(line, sealPrefix)); err != nil {
+		return "", err
+	}
+	return text, nil
+}
+
+// Provider returns a provider opening the sealed texts of the templates of
+// p, so the templates whose texts aren't verified fail to load. See
+// Template.SetProvider.
+func (s *Signer) Provider(p TemplateProvider) TemplateProvider {
+	return ProviderFunc(func(name string) (string, error) {
+		sealed, err := p.TemplateSource(name)
+		if err != nil {
+			return "", err
+		}
+		return s.Open(name, sealed)
+	})
+}
+
+// ParseSigned parses text as the body of t, as Parse, once verified by
+// the signer as the text of the template named as t.
+func (t *Template) ParseSigned(text, signature string, s *Signer) (*Template, error) {
+	if err := s.Verify(t.Name(), text, signature); err != nil {
+		return nil, err
+	}
+	return t.Parse(text)
+}
@@ -0,0 +1,227 @@
+package template
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/moisespsena-go/umbu/cast"
+)
+
+// sortKey is a key of the sort_by builtin.
+type sortKey struct {
+	path    []string
+	desc    bool
+	numeric bool
+	natural bool
+	nocase  bool
+}
+
+// parseSortKey parses the key of the builtin, as sort_by, the field path,
+// or "." for the item, followed by the options: asc, desc, numeric,
+// natural and nocase.
+func parseSortKey(name, spec string) (key sortKey, err error) {
+	words := strings.Fields(spec)
+	if len(words) == 0 {
+		return key, fmt.Errorf("%s: empty key", name)
+	}
+	if words[0] != "." {
+		key.path = strings.Split(strings.TrimPrefix(words[0], "."), ".")
+	}
+	for _, option := range words[1:] {
+		switch strings.ToLower(option) {
+		case "asc":
+			key.desc = false
+		case "desc":
+			key.desc = true
+		case "numeric":
+			key.numeric = true
+		case "natural":
+			key.natural = true
+		case "nocase":
+			key.nocase = true
+		default:
+			return key, fmt.Errorf("%s: key %q: invalid option %q", name, spec, option)
+		}
+	}
+	return
+}
+
+// value returns the value of the key of the item, invalid if the item has
+// no such field.
+func (k sortKey) value(item reflect.Value) (reflect.Value, error) {
+	item = indirectInterface(item)
+	for _, field := range k.path {
+		v, ok, err := fieldOf(item, field)
+		if err != nil || !ok {
+			return reflect.Value{}, err
+		}
+		item = indirectInterface(v)
+	}
+	if v, isNil := indirect(item); !isNil {
+		return v, nil
+	}
+	return reflect.Value{}, nil
+}
+
+// compare returns -1, 0 or 1 if the value a is less than, equal to or
+// greater than b, for the ascending order. The invalid values come first.
+func (k sortKey) compare(a, b reflect.Value) (int, error) {
+	switch {
+	case !a.IsValid() || !b.IsValid():
+		return boolCompare(a.IsValid(), b.IsValid()), nil
+	case k.numeric:
+		x, err := cast.ToFloat(a.Interface())
+		if err != nil {
+			return 0, err
+		}
+		y, err := cast.ToFloat(b.Interface())
+		if err != nil {
+			return 0, err
+		}
+		return floatCompare(x, y), nil
+	case k.natural || k.nocase:
+		x, y := fmt.Sprint(a.Interface()), fmt.Sprint(b.Interface())
+		if k.nocase {
+			x, y = strings.ToLower(x), strings.ToLower(y)
+		}
+		if k.natural {
+			return naturalCompare(x, y), nil
+		}
+		return strings.Compare(x, y), nil
+	}
+	if x, ok := a.Interface().(time.Time); ok {
+		if y, ok := b.Interface().(time.Time); ok {
+			return x.Compare(y), nil
+		}
+	}
+	if a.Kind() == reflect.Bool && b.Kind() == reflect.Bool {
+		return boolCompare(a.Bool(), b.Bool()), nil
+	}
+	less, err := lt(a, b)
+	if err != nil || less {
+		return -1, err
+	}
+	if less, _ = lt(b, a); less {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func boolCompare(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case b:
+		return -1
+	}
+	return 1
+}
+
+func floatCompare(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// naturalCompare compares the strings a and b by their runs of digits as
+// numbers, so "file2" comes before "file10".
+func naturalCompare(a, b string) int {
+	isDigit := func(c byte) bool { return '0' <= c && c <= '9' }
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			i, j := 0, 0
+			for i < len(a) && isDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isDigit(b[j]) {
+				j++
+			}
+			x, y := strings.TrimLeft(a[:i], "0"), strings.TrimLeft(b[:j], "0")
+			if len(x) != len(y) {
+				return floatCompare(float64(len(x)), float64(len(y)))
+			}
+			if c := strings.Compare(x, y); c != 0 {
+				return c
+			}
+			a, b = a[i:], b[j:]
+			continue
+		}
+		if a[0] != b[0] {
+			return strings.Compare(a[:1], b[:1])
+		}
+		a, b = a[1:], b[1:]
+	}
+	return strings.Compare(a, b)
+}
+
+// sortBy returns a copy of the list sorted, stably, by the keys, each one a
+// field path followed by the options asc, the default, or desc, and
+// numeric, natural or nocase, for case insensitive, comparing the values
+// as numbers or strings:
+//
+//	{{range sort_by .Users "Admin desc" "Name nocase"}}...{{end}}
+//
+// The key "." is the item itself. Without keys, the items are sorted by
+// themselves.
+func sortBy(list reflect.Value, specs ...string) (reflect.Value, error) {
+	list, err := listArg("sort_by", list)
+	if err != nil {
+		return list, err
+	}
+	if len(specs) == 0 {
+		specs = []string{"."}
+	}
+	keys := make([]sortKey, len(specs))
+	for i, spec := range specs {
+		if keys[i], err = parseSortKey("sort_by", spec); err != nil {
+			return reflect.Value{}, err
+		}
+	}
+	n := list.Len()
+	items := make([]reflect.Value, n)
+	values := make([][]reflect.Value, n)
+	for i := range items {
+		items[i] = list.Index(i)
+		values[i] = make([]reflect.Value, len(keys))
+		for j, key := range keys {
+			if values[i][j], err = key.value(items[i]); err != nil {
+				return reflect.Value{}, fmt.Errorf("sort_by: %v", err)
+			}
+		}
+	}
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		if err != nil {
+			return false
+		}
+		for k, key := range keys {
+			var c int
+			if c, err = key.compare(values[order[i]][k], values[order[j]][k]); err != nil {
+				err = fmt.Errorf("sort_by: key %q: %v", specs[k], err)
+				return false
+			}
+			if c != 0 {
+				return c < 0 != key.desc
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	result := reflect.MakeSlice(reflect.SliceOf(list.Type().Elem()), n, n)
+	for i, index := range order {
+		result.Index(i).Set(items[index])
+	}
+	return result, nil
+}
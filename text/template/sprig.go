@@ -0,0 +1,60 @@
+package template
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/moisespsena-go/umbu/funcs"
+)
+
+func init() {
+	// The builtins of the Sprig names and arguments. See funcs.Sprig.
+	funcs.RegisterSprig(funcs.FuncMap{
+		"hasKey": hasKey,
+		"keys":   keys,
+		"values": values,
+		"pluck":  pluck,
+		"pick":   pick,
+		"omit":   omit,
+		"first":  first,
+		"last":   last,
+		"now":    now,
+	})
+}
+
+// setLocal sets the pairs of keys and values of the local data. As in
+// Sprig, set DICT KEY VALUE sets the key of the dict, returning it.
+func (this *State) setLocal(args ...interface{}) (interface{}, error) {
+	if len(args) == 3 {
+		if m := reflect.ValueOf(args[0]); m.Kind() == reflect.Map {
+			key, err := prepareArg(reflect.ValueOf(args[1]), m.Type().Key())
+			if err != nil {
+				return nil, fmt.Errorf("set: %v", err)
+			}
+			value, err := prepareArg(reflect.ValueOf(args[2]), m.Type().Elem())
+			if err != nil {
+				return nil, fmt.Errorf("set: %v", err)
+			}
+			m.SetMapIndex(key, value)
+			return args[0], nil
+		}
+	}
+	return this.local.Set(args...), nil
+}
+
+// getLocal returns the value of the key of the local data, or the local
+// data without key. As in Sprig, get DICT KEY returns the value of the key
+// of the dict.
+func (this *State) getLocal(key ...interface{}) interface{} {
+	if len(key) == 2 {
+		if m := reflect.ValueOf(key[0]); m.Kind() == reflect.Map {
+			if k, err := prepareArg(reflect.ValueOf(key[1]), m.Type().Key()); err == nil {
+				if v := m.MapIndex(k); v.IsValid() {
+					return v.Interface()
+				}
+			}
+			return ""
+		}
+	}
+	return this.local.Get(key...)
+}
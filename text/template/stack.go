@@ -0,0 +1,10 @@
+//go:build !tinygo
+
+package template
+
+import rtdebug "runtime/debug"
+
+// stack returns the stack trace of the fatal errors.
+func stack() []byte {
+	return rtdebug.Stack()
+}
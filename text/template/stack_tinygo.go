@@ -0,0 +1,9 @@
+//go:build tinygo
+
+package template
+
+// stack returns the stack trace of the fatal errors, which TinyGo doesn't
+// provide.
+func stack() []byte {
+	return nil
+}
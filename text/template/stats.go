@@ -0,0 +1,97 @@
+package template
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+
+	"github.com/moisespsena-go/umbu/cast"
+)
+
+// floatsOf returns the sorted numbers of the items of the list, or of their
+// values by the key, as sum, skipping the nil values.
+func floatsOf(state *State, name string, list reflect.Value, key []reflect.Value) ([]float64, error) {
+	var values []float64
+	err := aggregate(state, name, list, key, func(_, v reflect.Value) error {
+		if !v.IsValid() {
+			return nil
+		}
+		f, err := cast.ToFloat(v.Interface())
+		values = append(values, f)
+		return err
+	})
+	sort.Float64s(values)
+	return values, err
+}
+
+// percentileOf returns the percentile p, from 0 to 100, of the sorted
+// values, interpolating between the closest ranks.
+func percentileOf(values []float64, p float64) float64 {
+	rank := p / 100 * float64(len(values)-1)
+	i := int(rank)
+	if i+1 >= len(values) {
+		return values[len(values)-1]
+	}
+	return values[i] + (rank-float64(i))*(values[i+1]-values[i])
+}
+
+// median returns the median of the items of the list or of their values by
+// the key, the field path or a function, as a float64, or nil if there are
+// none:
+//
+//	{{median .Requests "Duration.Seconds"}}
+func median(state *State, list reflect.Value, key ...reflect.Value) (interface{}, error) {
+	values, err := floatsOf(state, "median", list, key)
+	if err != nil || len(values) == 0 {
+		return nil, err
+	}
+	return percentileOf(values, 50), nil
+}
+
+// percentile returns the percentile p, from 0 to 100, of the items of the
+// list or of their values by the key, as median:
+//
+//	p95: {{percentile .Requests 95 "Latency"}}
+func percentile(state *State, list reflect.Value, p float64, key ...reflect.Value) (interface{}, error) {
+	if p < 0 || p > 100 || math.IsNaN(p) {
+		return nil, fmt.Errorf("percentile: invalid percentile %v", p)
+	}
+	values, err := floatsOf(state, "percentile", list, key)
+	if err != nil || len(values) == 0 {
+		return nil, err
+	}
+	return percentileOf(values, p), nil
+}
+
+// variance returns the population variance of the items of the list or of
+// their values by the key, as median.
+func variance(state *State, list reflect.Value, key ...reflect.Value) (interface{}, error) {
+	return varianceOf(state, "variance", list, key)
+}
+
+func varianceOf(state *State, name string, list reflect.Value, key []reflect.Value) (interface{}, error) {
+	values, err := floatsOf(state, name, list, key)
+	if err != nil || len(values) == 0 {
+		return nil, err
+	}
+	var mean, sum float64
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	for _, v := range values {
+		sum += (v - mean) * (v - mean)
+	}
+	return sum / float64(len(values)), nil
+}
+
+// stddev returns the population standard deviation of the items of the
+// list or of their values by the key, as median.
+func stddev(state *State, list reflect.Value, key ...reflect.Value) (interface{}, error) {
+	v, err := varianceOf(state, "stddev", list, key)
+	if v == nil {
+		return nil, err
+	}
+	return math.Sqrt(v.(float64)), nil
+}
@@ -5,14 +5,33 @@
 package template
 
 import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+
 	"github.com/moisespsena-go/umbu/funcs"
 	"github.com/moisespsena-go/umbu/text/template/parse"
 )
 
 // common holds the information shared by related templates.
 type common struct {
-	tmpl   map[string]*Template // Map from name to defined templates.
+	tmpl   map[string]*Template  // Map from name to defined templates.
+	defs   map[string]Definition // Map from name to template definitions.
 	option option
+	logger *slog.Logger
+
+	// loggerSet reports whether SetLogger set the logger, nil disabling the
+	// warnings.
+	loggerSet bool
+
+	provider TemplateProvider
+	onChange []func(names []string)
+	mu       sync.RWMutex // Guards tmpl while loading or reparsing templates.
+
+	// loads are the loads from the provider in progress, by template name.
+	loads map[string]*load
+	// missing are the names of the templates the provider hasn't.
+	missing map[string]bool
 }
 
 // Template is the representation of a parsed template. The *parse.Tree
@@ -26,7 +45,16 @@ type Template struct {
 	*common
 	leftDelim  string
 	rightDelim string
-	funcs      funcs.FuncValues
+	parseMode  parse.Mode
+	textHooks  []parse.TextHook
+	funcs      funcs.AtomicFuncValues
+
+	// textFilter returns the filter of the textHooks of a parse.
+	textFilter func() parse.TextFilter
+
+	// executor is the executor created by WarmUp, cloned by CreateExecutor
+	// until the functions of the template change.
+	executor atomic.Pointer[Executor]
 }
 
 // New allocates a new, undefined template with the given name.
@@ -67,6 +95,9 @@ func (t *Template) New(name string, args ...string) *Template {
 		common:     t.common,
 		leftDelim:  t.leftDelim,
 		rightDelim: t.rightDelim,
+		parseMode:  t.parseMode,
+		textHooks:  t.textHooks,
+		textFilter: t.textFilter,
 		args:       args,
 	}
 	return nt
@@ -77,6 +108,7 @@ func (t *Template) init() {
 	if t.common == nil {
 		c := new(common)
 		c.tmpl = make(map[string]*Template)
+		c.defs = make(map[string]Definition)
 		t.common = c
 	}
 }
@@ -93,6 +125,16 @@ func (t *Template) Clone() (*Template, error) {
 	if t.common == nil {
 		return nt, nil
 	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	nt.option = t.option
+	nt.logger = t.logger
+	nt.loggerSet = t.loggerSet
+	nt.provider = t.provider
+	nt.onChange = t.onChange
+	for k, v := range t.defs {
+		nt.defs[k] = v
+	}
 	for k, v := range t.tmpl {
 		if k == t.name {
 			nt.tmpl[t.name] = nt
@@ -113,14 +155,31 @@ func (t *Template) copy(c *common) *Template {
 	nt.args = t.args
 	nt.leftDelim = t.leftDelim
 	nt.rightDelim = t.rightDelim
+	nt.parseMode = t.parseMode
+	nt.textHooks = t.textHooks
+	nt.textFilter = t.textFilter
 	return nt
 }
 
 // AddParseTree adds parse tree for template with given name and associates it with t.
 // If the template does not already exist, it will create a new one.
 // If the template does exist, it will be replaced.
+// The template calls are checked against the parameters declared by the
+// called templates, see parse.Param.
 func (t *Template) AddParseTree(name string, tree *parse.Tree) (*Template, error) {
 	t.init()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.addParseTree(name, tree)
+}
+
+// addParseTree is AddParseTree. The caller must hold t.mu.
+func (t *Template) addParseTree(name string, tree *parse.Tree) (*Template, error) {
+	// Check the tree before installing it, so an invalid tree isn't left
+	// associated with t.
+	if err := t.checkParams(name, tree); err != nil {
+		return nil, err
+	}
 	// If the name is the name of this template, overwrite this template.
 	nt := t
 	if name != t.name {
@@ -140,6 +199,8 @@ func (t *Template) Templates() []*Template {
 	if t.common == nil {
 		return nil
 	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	// Return a slice so we don't expose the map.
 	m := make([]*Template, 0, len(t.tmpl))
 	for _, v := range t.tmpl {
@@ -150,10 +211,7 @@ func (t *Template) Templates() []*Template {
 
 // GetTemplate returns  defined template by name
 func (t *Template) Template(name string) *Template {
-	if t.common == nil {
-		return nil
-	}
-	return t.tmpl[name]
+	return t.Lookup(name)
 }
 
 // Delims sets the action delimiters to the specified strings, to be used in
@@ -168,12 +226,43 @@ func (t *Template) Delims(left, right string) *Template {
 	return t
 }
 
+// ParseMode sets the parsing mode, to be used in subsequent calls to Parse.
+// With parse.ParseComments the comments are kept in the parse trees as
+// parse.CommentNode, which are skipped on execution.
+// The return value is the template, so calls can be chained.
+func (t *Template) ParseMode(mode parse.Mode) *Template {
+	t.parseMode = mode
+	return t
+}
+
+// TextHooks adds hooks rewriting the text between the actions, to be used in
+// subsequent calls to Parse, such as parse.TemplateShorthand:
+//
+//	t.TextHooks(parse.TemplateShorthand()).Parse("@header <p>text</p>")
+//
+// The return value is the template, so calls can be chained.
+func (t *Template) TextHooks(hooks ...parse.TextHook) *Template {
+	t.textHooks = append(t.textHooks[:len(t.textHooks):len(t.textHooks)], hooks...)
+	return t
+}
+
+// TextFilter sets the function returning the filter of the text hooks of
+// each subsequent call to Parse, as html/template restricts them to the
+// HTML text. See parse.TextFilter.
+// The return value is the template, so calls can be chained.
+func (t *Template) TextFilter(newFilter func() parse.TextFilter) *Template {
+	t.textFilter = newFilter
+	return t
+}
+
 // Lookup returns the template with the given name that is associated with t.
 // It returns nil if there is no such template or the template has no definition.
 func (t *Template) Lookup(name string) *Template {
 	if t.common == nil {
 		return nil
 	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	return t.tmpl[name]
 }
 
@@ -188,14 +277,52 @@ func (t *Template) Lookup(name string) *Template {
 // This allows using Parse to add new named template definitions without
 // overwriting the main template body.
 func (t *Template) Parse(text string) (*Template, error) {
-	t.init()
-	trees, err := parse.Parse(t.name, text, t.leftDelim, t.rightDelim)
+	return t.ParseWithLimits(text, Limits{})
+}
+
+// Limits bounds the resources used to parse a template. See parse.Limits.
+type Limits = parse.Limits
+
+// ParseWithLimits is like Parse, but rejects texts exceeding the limits
+// while parsing. Use it to parse untrusted templates.
+func (t *Template) ParseWithLimits(text string, limits Limits) (*Template, error) {
+	return t.parse(text, limits, nil)
+}
+
+// parse parses the text, whose variables vars are declared before it.
+func (t *Template) parse(text string, limits Limits, vars []string) (*Template, error) {
+	trees, err := t.parseTrees(text, limits, vars)
 	if err != nil {
 		return nil, err
 	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.addParseTrees(trees)
+}
+
+// parseTrees parses the text into the trees of t and of the templates it
+// defines.
+func (t *Template) parseTrees(text string, limits Limits, vars []string) (map[string]*parse.Tree, error) {
+	t.init()
+	trees := make(map[string]*parse.Tree)
+	tree := parse.New(t.name)
+	tree.Limits = limits
+	tree.Vars = vars
+	tree.Mode = t.parseMode
+	tree.TextHooks = t.textHooks
+	tree.NewTextFilter = t.textFilter
+	if _, err := tree.Parse(text, t.leftDelim, t.rightDelim, trees); err != nil {
+		return nil, err
+	}
+	return trees, nil
+}
+
+// addParseTrees adds the trees parsed by parseTrees. The caller must hold
+// t.mu.
+func (t *Template) addParseTrees(trees map[string]*parse.Tree) (*Template, error) {
 	// Add the newly parsed trees, including the one for t, into our common structure.
 	for name, tree := range trees {
-		if _, err := t.AddParseTree(name, tree); err != nil {
+		if _, err := t.addParseTree(name, tree); err != nil {
 			return nil, err
 		}
 	}
@@ -209,42 +336,74 @@ func (t *Template) associate(new *Template, tree *parse.Tree) (bool, error) {
 	if new.common != t.common {
 		panic("internal error: associate not common")
 	}
-	if old := t.tmpl[new.name]; old != nil && parse.IsEmptyTree(tree.Root) && old.Tree != nil {
+	old := t.tmpl[new.name]
+	if old != nil && parse.IsEmptyTree(tree.Root) && old.Tree != nil {
 		// If a template by that name exists,
 		// don't replace it with an empty template.
 		return false, nil
 	}
+	if old != nil && old.Tree != nil && old.Tree != tree && !parse.IsEmptyTree(old.Root) {
+		if err := t.redefine(new.name); err != nil {
+			return false, err
+		}
+	}
 	t.tmpl[new.name] = new
+	if !parse.IsEmptyTree(tree.Root) {
+		t.defs[new.name] = Definition{Name: new.name, Source: t.name, Path: t.Path}
+	}
 	return true, nil
 }
 
 // Funcs add funcs to this Template
 func (t *Template) Funcs(funcMaps ...funcs.FuncMap) *Template {
+	t.executor.Store(nil)
 	if len(funcMaps) > 0 {
 		fv, err := funcs.CreateValuesFunc(funcMaps...)
 		if err != nil {
 			panic(err)
 		}
-		t.funcs.AppendValues(fv)
+		t.funcs.Update(func(v *funcs.FuncValues) error {
+			v.AppendValues(fv)
+			return nil
+		})
 	}
 	return t
 }
 
+// FuncProvider adds the functions of the provider to this Template,
+// resolved when called, as the ones of a large library:
+//
+//	tmpl := template.New("page").FuncProvider(funcs.LazyFuncMap(library))
+func (t *Template) FuncProvider(p funcs.FuncProvider) *Template {
+	t.executor.Store(nil)
+	t.funcs.Update(func(v *funcs.FuncValues) error {
+		v.AppendProvider(p)
+		return nil
+	})
+	return t
+}
+
 // FuncsValues add funcs values to this Template
 func (t *Template) FuncsValues(funcValues ...funcs.FuncValues) *Template {
+	t.executor.Store(nil)
 	if len(funcValues) > 0 {
-		t.funcs.AppendValues(funcs.NewValues(funcValues...))
+		fv := funcs.NewValues(funcValues...)
+		t.funcs.Update(func(v *funcs.FuncValues) error {
+			v.AppendValues(fv)
+			return nil
+		})
 	}
 	return t
 }
 
 // SetFuncs set funcs values to this template
 func (t *Template) SetFuncs(values funcs.FuncValues) *Template {
-	t.funcs = values
+	t.executor.Store(nil)
+	t.funcs.Store(values)
 	return t
 }
 
 // GetFuncs get all funcs values in this template
 func (t *Template) GetFuncs() funcs.FuncValues {
-	return t.funcs
+	return t.funcs.Load()
 }
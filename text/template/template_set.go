@@ -0,0 +1,184 @@
+package template
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"sync"
+
+	"github.com/moisespsena-go/umbu/funcs"
+)
+
+// TemplateSet is a group of associated templates with their functions, their
+// options and the cache of their renderers, isolated from the other sets, as
+// the ones of the plugins of an application:
+//
+//	set := template.NewTemplateSet("blog").Funcs(helpers)
+//	if err := set.Parse("page", text); err != nil {
+//		return err
+//	}
+//	err := set.Render(r.Context(), w, "page", post)
+//
+// The templates of a set call only the templates of the set and are executed
+// with the functions and the options of the set, so the sets don't collide,
+// even defining templates or functions of the same names.
+//
+// A TemplateSet is safe for concurrent use. The templates parsed replace
+// the ones of the set for the next executions, the executions in progress
+// keeping the old ones.
+type TemplateSet struct {
+	mu        sync.RWMutex
+	root      *Template // the namespace of the templates of the set.
+	funcs     funcs.FuncValues
+	options   StateOptions
+	renderers map[string]*Renderer // the cached renderers, by template name.
+	quota     Quota
+	profile   *Profile
+	metrics   setMetrics
+	usage     setUsage // the size of the templates of root.
+}
+
+// NewTemplateSet returns a new empty set with the given name.
+func NewTemplateSet(name string) *TemplateSet {
+	return &TemplateSet{root: New(name), renderers: map[string]*Renderer{}}
+}
+
+// Name returns the name of the set.
+func (s *TemplateSet) Name() string {
+	return s.root.Name()
+}
+
+// Funcs adds the functions of the maps to the ones of the executions of the
+// templates of the set. They override the global functions and the builtins
+// of the same name. It panics if a value isn't a valid function, as
+// Template.Funcs.
+func (s *TemplateSet) Funcs(funcMaps ...funcs.FuncMap) *TemplateSet {
+	fv, err := funcs.CreateValuesFunc(funcMaps...)
+	if err != nil {
+		panic(err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.funcs = funcs.NewValues(s.funcs, fv)
+	s.reset()
+	return s
+}
+
+// SetOptions sets the options of the executions of the templates of the
+// set.
+func (s *TemplateSet) SetOptions(options StateOptions) *TemplateSet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.options = options
+	s.reset()
+	return s
+}
+
+// Parse parses text as the body of the template of the set named name. The
+// templates it defines are added to the set, as by Template.Parse.
+func (s *TemplateSet) Parse(name, text string) error {
+	return s.update(func(root *Template) error {
+		t := root
+		if name != root.Name() {
+			if t = root.Lookup(name); t == nil {
+				t = root.New(name)
+			}
+		}
+		_, err := t.Parse(text)
+		return err
+	})
+}
+
+// ParseFS parses the templates of the files of fsys matching the patterns,
+// as Template.ParseFS, adding them to the set.
+func (s *TemplateSet) ParseFS(fsys fs.FS, patterns ...string) error {
+	return s.update(func(root *Template) error {
+		_, err := root.ParseFS(fsys, patterns...)
+		return err
+	})
+}
+
+// update applies the change to a copy of the templates of the set,
+// replacing them if it succeeds.
+func (s *TemplateSet) update(change func(root *Template) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	root, err := s.root.Clone()
+	if err != nil {
+		return err
+	}
+	if err = change(root); err != nil {
+		return err
+	}
+	usage := s.usage.of(root)
+	if err = s.checkQuota(usage); err != nil {
+		return err
+	}
+	s.root, s.usage = root, usage
+	s.reset()
+	return nil
+}
+
+// reset removes the cached renderers. The caller must hold s.mu.
+func (s *TemplateSet) reset() {
+	s.renderers = map[string]*Renderer{}
+}
+
+// Lookup returns the template of the set with the given name, or nil if
+// there is no such template. It must not be changed.
+func (s *TemplateSet) Lookup(name string) *Template {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.root.Lookup(name)
+}
+
+// TemplateNames returns the sorted names of the templates of the set.
+func (s *TemplateSet) TemplateNames() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.root.TemplateNames()
+}
+
+// Renderer returns the renderer of the template of the set with the given
+// name, cached until the set changes.
+func (s *TemplateSet) Renderer(name string) (*Renderer, error) {
+	s.mu.RLock()
+	r := s.renderers[name]
+	s.mu.RUnlock()
+	if r != nil {
+		return r, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r = s.renderers[name]; r != nil {
+		return r, nil
+	}
+	t := s.root.Lookup(name)
+	if t == nil {
+		return nil, fmt.Errorf("template: no template %q in the set %q", name, s.Name())
+	}
+	executor := t.CreateExecutor().FuncsValues(s.funcs)
+	executor.StateOptions = s.options
+	executor.SetProfile(s.profile)
+	if s.quota.MaxSteps > 0 {
+		executor.StateOptions.MaxSteps = s.quota.MaxSteps
+	}
+	r = executor.Renderer()
+	s.renderers[name] = r
+	return r, nil
+}
+
+// Render applies the template of the set with the given name to the data,
+// with the context ctx, and writes the output to w, within the quota of
+// the set.
+func (s *TemplateSet) Render(ctx context.Context, w io.Writer, name string, data interface{}) error {
+	r, err := s.Renderer(name)
+	if err != nil {
+		return err
+	}
+	s.mu.RLock()
+	q := s.quota
+	s.mu.RUnlock()
+	return s.execute(ctx, r, q, w, data)
+}
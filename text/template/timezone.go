@@ -0,0 +1,61 @@
+package template
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type locationContextKey struct{}
+
+// ContextWithLocation returns a copy of ctx with the time location of the
+// viewer, used by the executions to render the times, over the location of
+// the executor.
+func ContextWithLocation(ctx context.Context, loc *time.Location) context.Context {
+	return context.WithValue(ctx, locationContextKey{}, loc)
+}
+
+// LocationFromContext returns the time location of ctx, or nil.
+func LocationFromContext(ctx context.Context) *time.Location {
+	if ctx == nil {
+		return nil
+	}
+	loc, _ := ctx.Value(locationContextKey{}).(*time.Location)
+	return loc
+}
+
+// SetLocation sets the default time location of the execution, in which
+// the timef and in_tz builtins render the times when the context has no
+// location (see ContextWithLocation).
+func (this *Executor) SetLocation(loc *time.Location) *Executor {
+	this.StateOptions.Location = loc
+	return this
+}
+
+// Location returns the time location of the execution: the one of its
+// context, or the one of the executor, or nil if none is set.
+func (this *State) Location() *time.Location {
+	if loc := LocationFromContext(this.context); loc != nil {
+		return loc
+	}
+	return this.e.StateOptions.Location
+}
+
+// inTimezone returns the time in the location named name, or in the
+// location of the execution, or unchanged if there is none.
+func inTimezone(state *State, item interface{}, name ...string) (t time.Time, err error) {
+	if t, err = toTime(item); err != nil {
+		return
+	}
+	if len(name) > 0 && name[0] != "" {
+		loc, err := time.LoadLocation(name[0])
+		if err != nil {
+			return t, fmt.Errorf("in_tz: %v", err)
+		}
+		return t.In(loc), nil
+	}
+	if loc := state.Location(); loc != nil {
+		t = t.In(loc)
+	}
+	return
+}
@@ -0,0 +1,145 @@
+package template
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// DataError is the error of the data not conforming to the declarations of
+// a template, listing all its problems. See Executor.SetValidateData.
+type DataError struct {
+	Name     string   // name of the template.
+	Problems []string // the missing and the mistyped inputs.
+}
+
+func (e *DataError) Error() string {
+	return fmt.Sprintf("template %q: invalid data: %s", e.Name, strings.Join(e.Problems, "; "))
+}
+
+// SetValidateData sets whether the data is validated before executing the
+// template, against the fields and variables required by its
+// "umbu:require" pragmas and declared by its "umbu:arg" pragmas:
+//
+//	{{/* umbu:arg .Title string */}}
+//	{{/* umbu:arg .Items []Item */}}
+//	{{/* umbu:arg .Phone? string */}}
+//
+// The execution fails then, before writing anything, with a *DataError
+// listing all the missing and the mistyped inputs. The arguments of the
+// template calls are validated against the types of the parameters of the
+// called templates as well, see parse.Param.
+//
+// The basic types, the slices and the maps are checked; the named types may
+// have any underlying type. The integers may be given as integral floats,
+// as decoded from JSON.
+func (this *Executor) SetValidateData(validate bool) *Executor {
+	this.StateOptions.ValidateData = validate
+	return this
+}
+
+// validateData returns the *DataError of the data of the executing
+// template and of the arguments passed to it, bound to the variables, nil if
+// valid.
+func (this *State) validateData(dot reflect.Value, args []variable) error {
+	var problems []string
+	for i, p := range this.tmpl.Tree.Params() {
+		if i < len(args) && p.Type != "" {
+			if problem := typeProblem(args[i].value, p.Type); problem != "" {
+				problems = append(problems, p.Name+problem)
+			}
+		}
+	}
+	for _, arg := range this.tmpl.Tree.Required() {
+		if _, ok := this.dataArg(dot, arg); !ok {
+			problems = append(problems, fmt.Sprintf("missing %s", arg))
+		}
+	}
+	for _, arg := range this.tmpl.Tree.DataArgs() {
+		value, ok := this.dataArg(dot, arg.Name)
+		switch {
+		case !ok:
+			if !arg.Optional {
+				problems = append(problems, fmt.Sprintf("missing %s", arg.Name))
+			}
+		case arg.Type != "":
+			if problem := typeProblem(value, arg.Type); problem != "" {
+				problems = append(problems, arg.Name+problem)
+			}
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return &DataError{Name: this.tmpl.Name(), Problems: problems}
+}
+
+// dataArg returns the value of the field (".Items.Count") or of the variable
+// ("$page.Number") of the data, if present and not nil.
+func (this *State) dataArg(dot reflect.Value, arg string) (reflect.Value, bool) {
+	value, path := dot, strings.Split(arg[1:], ".")
+	if arg[0] == '$' {
+		var ok bool
+		if value, ok = this.lookupVar("$" + path[0]); !ok {
+			return value, false
+		}
+		path = path[1:]
+	}
+	for _, name := range path {
+		if name == "" {
+			continue
+		}
+		var ok bool
+		if value, ok = requiredField(value, name); !ok {
+			return value, false
+		}
+	}
+	value, isNil := indirect(value)
+	return value, value.IsValid() && !isNil
+}
+
+// typeProblem returns the problem of the value not conforming to the Go
+// type name, as " is string, want int", empty if conforming.
+func typeProblem(v reflect.Value, typ string) string {
+	v, isNil := indirect(v)
+	if !v.IsValid() || isNil {
+		if strings.HasPrefix(typ, "[]") || strings.HasPrefix(typ, "map[") {
+			return ""
+		}
+		return fmt.Sprintf(" is nil, want %s", typ)
+	}
+	var ok bool
+	switch kind := v.Kind(); {
+	case strings.HasPrefix(typ, "[]"):
+		if ok = kind == reflect.Slice || kind == reflect.Array; ok {
+			for i := 0; i < v.Len(); i++ {
+				if problem := typeProblem(v.Index(i), typ[2:]); problem != "" {
+					return fmt.Sprintf("[%d]%s", i, problem)
+				}
+			}
+		}
+	case strings.HasPrefix(typ, "map["):
+		ok = kind == reflect.Map
+	case typ == "string":
+		ok = kind == reflect.String
+	case typ == "bool":
+		ok = kind == reflect.Bool
+	case typ == "float32", typ == "float64":
+		ok = kind >= reflect.Int && kind <= reflect.Float64
+	case typ == "rune", typ == "byte", strings.HasPrefix(typ, "int"), strings.HasPrefix(typ, "uint"):
+		switch {
+		case kind >= reflect.Int && kind <= reflect.Uintptr:
+			ok = true
+		case kind == reflect.Float32 || kind == reflect.Float64:
+			ok = v.Float() == float64(int64(v.Float()))
+		}
+	case strings.HasPrefix(typ, "complex"):
+		ok = kind == reflect.Complex64 || kind == reflect.Complex128
+	default:
+		ok = true
+	}
+	if ok {
+		return ""
+	}
+	return fmt.Sprintf(" is %s, want %s", v.Type(), typ)
+}
@@ -0,0 +1,98 @@
+package template
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// VersionSeparator separates the name of a template from its version in
+// the name of a versioned template, as in "welcome@v2".
+const VersionSeparator = "@"
+
+// VersionedName returns the name of the version of the template named name.
+// An empty version is the name itself.
+func VersionedName(name, version string) string {
+	if version == "" {
+		return name
+	}
+	return name + VersionSeparator + version
+}
+
+// SplitVersion splits the name of a versioned template into the name of the
+// template and its version, empty if unversioned.
+func SplitVersion(name string) (base, version string) {
+	if i := strings.LastIndex(name, VersionSeparator); i > 0 {
+		return name[:i], name[i+1:]
+	}
+	return name, ""
+}
+
+// VersionSelector returns the version of the template named name to be
+// executed in the context, or an empty string for the template itself.
+type VersionSelector func(ctx context.Context, name string) (version string)
+
+// SetVersionSelector sets the selector of the versions of the templates
+// executed by the executor and invoked by the execution. Execute,
+// ExecuteTemplate, the template action, and the functions executing
+// templates, execute the version named by VersionedName, that must be
+// defined, or may be loaded from the provider (see Template.SetProvider).
+// It allows rolling out a new version of a template to a share of the
+// executions.
+func (this *Executor) SetVersionSelector(selector VersionSelector) *Executor {
+	this.StateOptions.VersionSelector = selector
+	return this
+}
+
+// versionedName returns the name of the version of the template to execute.
+func (this *State) versionedName(name string) string {
+	if selector := this.e.StateOptions.VersionSelector; selector != nil {
+		ctx := this.context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		return VersionedName(name, selector(ctx, name))
+	}
+	return name
+}
+
+// ExecuteTemplate applies the template associated with the template of the
+// executor that has the given name, or its version selected for the
+// execution, as Template.ExecuteTemplate, with the options of the executor.
+func (this *Executor) ExecuteTemplate(wr io.Writer, name string, data interface{}) error {
+	tmpl, err := this.template.Load(name)
+	if err != nil {
+		return err
+	}
+	if tmpl == nil {
+		return fmt.Errorf("template: no template %q associated with template %q", name, this.template.Name())
+	}
+	e := *this
+	e.template = tmpl
+	return e.Execute(wr, data)
+}
+
+// selectTemplate returns the version of the executed template selected for
+// the execution, if not itself. The versions of the templates invoked by
+// the execution are selected by the state, see State.versionedName.
+func (this *Executor) selectTemplate(ctx context.Context) (*Template, error) {
+	t := this.template
+	selector := this.StateOptions.VersionSelector
+	if selector == nil || this.execution != nil {
+		return t, nil
+	}
+	name := t.Name()
+	if _, version := SplitVersion(name); version != "" {
+		return t, nil
+	}
+	version := selector(ctx, name)
+	if version == "" {
+		return t, nil
+	}
+	tmpl, err := t.Load(VersionedName(name, version))
+	if err == nil && tmpl == nil {
+		err = fmt.Errorf("template: no template %q associated with template %q", VersionedName(name, version), name)
+	}
+	return tmpl, err
+}
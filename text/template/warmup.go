@@ -0,0 +1,130 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/moisespsena-go/umbu/text/template/parse"
+)
+
+// WarmUp prepares the templates associated with t for execution, at startup,
+// so their errors show before they are served and the first executions
+// don't load templates nor create executors: it checks the functions of the
+// templates, creating an executor of each, which CreateExecutor and Execute
+// clone until the functions of the template change, and loads from the
+// provider (see SetProvider) the templates they invoke by static names,
+// recursively. The executors keep the global functions registered before,
+// see RegisterGlobalFuncs.
+//
+// The templates are prepared by up to workers goroutines, or
+// runtime.GOMAXPROCS(0) if workers is less than 1. The errors of all the
+// templates, such as the invocations of undefined templates, are returned
+// joined, sorted by template name.
+func (t *Template) WarmUp(workers int) error {
+	if t.common == nil {
+		return nil
+	}
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	t.mu.RLock()
+	var names []string
+	for name, tmpl := range t.tmpl {
+		if tmpl.Tree != nil && tmpl.Root != nil {
+			names = append(names, name)
+		}
+	}
+	t.mu.RUnlock()
+
+	var (
+		mu   sync.Mutex
+		errs = make(map[string]error)
+		seen = make(map[string]bool)
+	)
+	for _, name := range names {
+		seen[name] = true
+	}
+	for len(names) > 0 {
+		var (
+			next []string
+			wg   sync.WaitGroup
+			jobs = make(chan string)
+		)
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for name := range jobs {
+					called, err := t.warmUp(name)
+					mu.Lock()
+					if err != nil {
+						errs[name] = err
+					}
+					for _, name := range called {
+						if !seen[name] {
+							seen[name] = true
+							next = append(next, name)
+						}
+					}
+					mu.Unlock()
+				}
+			}()
+		}
+		for _, name := range names {
+			jobs <- name
+		}
+		close(jobs)
+		wg.Wait()
+		names = next
+	}
+
+	sorted := make([]string, 0, len(errs))
+	for name := range errs {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	joined := make([]error, len(sorted))
+	for i, name := range sorted {
+		joined[i] = errs[name]
+	}
+	return errors.Join(joined...)
+}
+
+// warmUp checks the template named name, loading it if needed, and returns
+// the names of the templates it invokes.
+func (t *Template) warmUp(name string) (called []string, err error) {
+	tmpl, err := t.Load(name)
+	if err != nil {
+		return nil, err
+	}
+	if tmpl == nil || tmpl.Tree == nil || tmpl.Root == nil {
+		return nil, fmt.Errorf("template: %q is an incomplete or empty template", name)
+	}
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("template: %s: %v", name, r)
+			}
+		}()
+		tmpl.executor.Store(tmpl.newExecutor())
+	}()
+	if err != nil {
+		return nil, err
+	}
+	parse.Inspect(tmpl.Root, func(n parse.Node) bool {
+		if call, ok := n.(*parse.TemplateNode); ok && call.NameNode == nil && err == nil {
+			var target *Template
+			if target, err = t.Load(call.Name); err == nil && target == nil {
+				location, _ := tmpl.ErrorContext(call)
+				err = fmt.Errorf("template: %s: invokes undefined template %q", location, call.Name)
+			} else if target != nil {
+				called = append(called, call.Name)
+			}
+		}
+		return err == nil
+	})
+	return called, err
+}
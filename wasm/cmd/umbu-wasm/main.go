@@ -0,0 +1,11 @@
+//go:build js && wasm
+
+// Command umbu-wasm runs the templates in the browser. See package wasm.
+package main
+
+import "github.com/moisespsena-go/umbu/wasm"
+
+func main() {
+	wasm.Register()
+	select {}
+}
@@ -0,0 +1,66 @@
+//go:build js && wasm
+
+package wasm
+
+import (
+	"encoding/json"
+	"syscall/js"
+)
+
+// Register defines the global umbu object, with the render and check
+// functions, returning objects with the output and the error message, if
+// any.
+func Register() {
+	js.Global().Set("umbu", js.ValueOf(map[string]interface{}{
+		"render": js.FuncOf(render),
+		"check":  js.FuncOf(check),
+	}))
+}
+
+// render implements umbu.render(src, data, options).
+func render(_ js.Value, args []js.Value) interface{} {
+	var (
+		src  string
+		data []byte
+	)
+	if len(args) > 0 {
+		src = args[0].String()
+	}
+	if len(args) > 1 && !args[1].IsUndefined() {
+		data = []byte(js.Global().Get("JSON").Call("stringify", args[1]).String())
+	}
+	opts, err := options(args, 2)
+	if err != nil {
+		return result("", err)
+	}
+	return result(Render(src, data, opts))
+}
+
+// check implements umbu.check(src, options).
+func check(_ js.Value, args []js.Value) interface{} {
+	var src string
+	if len(args) > 0 {
+		src = args[0].String()
+	}
+	opts, err := options(args, 1)
+	if err == nil {
+		err = Check(src, opts)
+	}
+	return result("", err)
+}
+
+// options decodes the options of the argument i, if any.
+func options(args []js.Value, i int) (opts Options, err error) {
+	if len(args) > i && args[i].Type() == js.TypeObject {
+		err = json.Unmarshal([]byte(js.Global().Get("JSON").Call("stringify", args[i]).String()), &opts)
+	}
+	return
+}
+
+func result(output string, err error) interface{} {
+	r := map[string]interface{}{"output": output, "error": nil}
+	if err != nil {
+		r["error"] = err.Error()
+	}
+	return js.ValueOf(r)
+}
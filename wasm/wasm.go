@@ -0,0 +1,88 @@
+// Package wasm binds the templates to JavaScript, for the template
+// previewers running the engine in the browser, compiled to WebAssembly:
+//
+//	GOOS=js GOARCH=wasm go build -o umbu.wasm github.com/moisespsena-go/umbu/wasm/cmd/umbu-wasm
+//
+// Loaded by the wasm_exec.js of the Go distribution, it defines the global
+// umbu object:
+//
+//	const {output, error} = umbu.render("<p>{{.name}}</p>", {name: "Ann"}, {html: true})
+//	const {error} = umbu.check("{{if .}}")
+package wasm
+
+import (
+	"encoding/json"
+	"strings"
+
+	htmltemplate "github.com/moisespsena-go/umbu/html/template"
+	"github.com/moisespsena-go/umbu/text/template"
+)
+
+// Options are the options of Render and Check.
+type Options struct {
+	// Name is the name of the template. The default is "preview".
+	Name string `json:"name"`
+	// HTML escapes the template contextually, as html/template.
+	HTML bool `json:"html"`
+	// Delims are the left and right delimiters of the actions, if not the
+	// default ones.
+	Delims []string `json:"delims"`
+}
+
+func (o *Options) name() string {
+	if o.Name == "" {
+		return "preview"
+	}
+	return o.Name
+}
+
+// delims returns the delimiters of the options, empty for the default ones.
+func (o *Options) delims() (left, right string) {
+	if len(o.Delims) == 2 {
+		return o.Delims[0], o.Delims[1]
+	}
+	return "", ""
+}
+
+// Render executes the template src with the data, JSON encoded, returning
+// its output.
+func Render(src string, data []byte, opts Options) (string, error) {
+	var v interface{}
+	if len(strings.TrimSpace(string(data))) > 0 {
+		if err := json.Unmarshal(data, &v); err != nil {
+			return "", err
+		}
+	}
+	left, right := opts.delims()
+	if opts.HTML {
+		tmpl, err := htmltemplate.New(opts.name()).Delims(left, right).Parse(src)
+		if err != nil {
+			return "", err
+		}
+		var b strings.Builder
+		if err = tmpl.Execute(&b, v); err != nil {
+			return "", err
+		}
+		return b.String(), nil
+	}
+	tmpl, err := template.New(opts.name()).Delims(left, right).Parse(src)
+	if err != nil {
+		return "", err
+	}
+	return tmpl.ExecuteString(v)
+}
+
+// Check parses the template src, and escapes it if HTML, returning the
+// first error.
+func Check(src string, opts Options) error {
+	left, right := opts.delims()
+	if opts.HTML {
+		tmpl, err := htmltemplate.New(opts.name()).Delims(left, right).Parse(src)
+		if err != nil {
+			return err
+		}
+		return tmpl.WarmUp(1)
+	}
+	_, err := template.New(opts.name()).Delims(left, right).Parse(src)
+	return err
+}
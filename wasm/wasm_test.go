@@ -0,0 +1,38 @@
+package wasm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	for _, test := range []struct {
+		src, data string
+		opts      Options
+		want      string
+	}{
+		{`{{.name}}`, `{"name": "<Ann>"}`, Options{}, "<Ann>"},
+		{`<p>{{.name}}</p>`, `{"name": "<Ann>"}`, Options{HTML: true}, "<p>&lt;Ann&gt;</p>"},
+		{`[[.n]]`, `{"n": 3}`, Options{Delims: []string{"[[", "]]"}}, "3"},
+		{`x`, ``, Options{}, "x"},
+	} {
+		out, err := Render(test.src, []byte(test.data), test.opts)
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+		} else if out != test.want {
+			t.Errorf("%s: got %q, want %q", test.src, out, test.want)
+		}
+	}
+	if _, err := Render(`x`, []byte(`{`), Options{}); err == nil {
+		t.Error("want error of invalid data")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	if err := Check(`{{if .}}`, Options{Name: "page"}); err == nil || !strings.Contains(err.Error(), "page:1") {
+		t.Errorf("got error %v", err)
+	}
+	if err := Check(`<a href="{{.}}">`, Options{HTML: true}); err != nil {
+		t.Error(err)
+	}
+}